@@ -0,0 +1,82 @@
+// Command dbpool checks the health of database connections taken from a
+// ConnectionPool, from one goroutine and then from many.
+//
+// The driver must be linked into the binary; database/sql ships none.
+//
+//	go run ./cmd/dbpool -driver mysql -dsn 'reader:123456@tcp(127.0.0.1:3306)/mysql'
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/group"
+	dbpool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/db"
+)
+
+// Number of goroutines sharing the pool
+const workers = 10
+
+func main() {
+	driver := flag.String("driver", "mysql", "database/sql driver name")
+	dsn := flag.String("dsn", "reader:123456@tcp(127.0.0.1:3306)/mysql", "data source name")
+	flag.Parse()
+
+	if err := run(context.Background(), os.Stdout, *driver, *dsn); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run pings the database through the pool and reports to w.
+func run(ctx context.Context, w io.Writer, driver, dsn string) error {
+	pool := dbpool.New(10, 5, 5*time.Second)
+	pool.OpenConnection = func() (*dbpool.DBConn, error) {
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &dbpool.DBConn{DB: db, HeartBeat: time.Now(), TimeOut: 50 * time.Minute}, nil
+	}
+	if err := pool.Open(); err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// WithConn releases the connection however fn returns
+	var healthy bool
+	if err := pool.WithConn(ctx, func(conn *dbpool.DBConn) error {
+		healthy = pool.Check(conn)
+		return nil
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "connection healthy: %t\n", healthy)
+
+	// Many goroutines share the connections
+	var ok atomic.Int64
+	g := group.New(ctx)
+	for i := 0; i < workers; i++ {
+		g.Go(func(ctx context.Context) error {
+			return pool.WithConn(ctx, func(conn *dbpool.DBConn) error {
+				if pool.Check(conn) {
+					ok.Add(1)
+				}
+				return nil
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d of %d goroutines found a healthy connection\n", ok.Load(), workers)
+
+	fmt.Fprintf(w, "connections in use: %d\n", pool.Stats().InUse)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+// fakeDriver opens connections whose ping fails for the "down" DSN.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return fakeConn{down: dsn == "down"}, nil
+}
+
+// fakeConn is a connection that can only be pinged.
+type fakeConn struct {
+	down bool
+}
+
+func (c fakeConn) Ping(ctx context.Context) error {
+	if c.down {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake: not supported")
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake: not supported")
+}
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(context.Background(), &out, "fake", "up"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "connection healthy: true\n" +
+		"10 of 10 goroutines found a healthy connection\n" +
+		"connections in use: 0\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunDown(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(context.Background(), &out, "fake", "down"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "connection healthy: false\n" +
+		"0 of 10 goroutines found a healthy connection\n" +
+		"connections in use: 0\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunUnknownDriver(t *testing.T) {
+	if err := run(context.Background(), &bytes.Buffer{}, "nodriver", ""); err == nil {
+		t.Error("run with an unknown driver returned nil")
+	}
+}
@@ -0,0 +1,99 @@
+// Command producer-consumer connects a Producer generating the numbers 1
+// to n to a Consumer adding them up, and prints what each side did.
+//
+//	go run ./cmd/producer-consumer -n 1000
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/group"
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+)
+
+const (
+	// Number of producer workers
+	producerWorkers = 10
+
+	// Number of consumer workers
+	consumerWorkers = 20
+
+	// Items waiting between them
+	queueSize = 100
+)
+
+func main() {
+	n := flag.Int("n", 1000, "number of items to produce")
+	flag.Parse()
+
+	if err := run(context.Background(), os.Stdout, *n); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run produces n items, consumes them and reports to w.
+func run(ctx context.Context, w io.Writer, n int) error {
+
+	// Produce 1..n, then stop
+	var next int64
+	p := producerconsumer.NewProducer(0, producerWorkers)
+	p.ProduceFunc = func() (interface{}, error) {
+		if i := atomic.AddInt64(&next, 1); i <= int64(n) {
+			return int(i), nil
+		}
+		return nil, nil
+	}
+	p.Notify(func(string) {})
+	p.HandleError(func(err error) {
+		fmt.Fprintln(w, "produce:", err)
+	})
+
+	// Add up what is consumed
+	var mu sync.Mutex
+	sum := 0
+	c := producerconsumer.NewConsumer(0, consumerWorkers)
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sum += data.(int)
+		return nil
+	}
+	c.Notify(func(string) {})
+	c.HandleError(func(err error) {
+		fmt.Fprintln(w, "consume:", err)
+	})
+
+	// A blocking queue between them waits for room instead of dropping
+	// items, and is closed once the producer returns, so the consumer
+	// returns after taking everything
+	q := queue.New[interface{}](queueSize)
+	p.SetQueue(q)
+	c.SetQueue(q)
+
+	// Run both in a group like an errgroup: a fatal error of either, such
+	// as one of ProduceFunc wrapping ErrStopProduce, stops the other
+	g := group.New(ctx, group.WithCancelOnError())
+	g.Go(p.RunAndClose)
+	g.GoRunner(c)
+	err := g.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	ps, cs := p.Stats(), c.Stats()
+	fmt.Fprintf(w, "produced %d items with %d goroutines\n", ps.Produced, producerWorkers)
+	fmt.Fprintf(w, "consumed %d items with %d goroutines, %d failed\n", cs.Processed, consumerWorkers, cs.Failed)
+	fmt.Fprintf(w, "sum %d\n", sum)
+	return nil
+}
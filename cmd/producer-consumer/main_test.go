@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(context.Background(), &out, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "produced 1000 items with 10 goroutines\n" +
+		"consumed 1000 items with 20 goroutines, 0 failed\n" +
+		"sum 500500\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out bytes.Buffer
+	if err := run(ctx, &out, 1000); err != context.Canceled {
+		t.Errorf("run() = %v, want %v", err, context.Canceled)
+	}
+}
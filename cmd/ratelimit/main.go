@@ -0,0 +1,109 @@
+// Command ratelimit sends requests through the HTTP middleware of a rate
+// limiter allowing about 10 requests per second: first a burst, which is
+// cut down to what the limiter allows, then a few in wait mode, which are
+// all served late rather than rejected.
+//
+//	go run ./cmd/ratelimit -limiter token
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/counter"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/httpmw"
+	leakybucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/leaky_bucket"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// Requests sent at once, and then one by one in wait mode
+const (
+	burst  = 20
+	steady = 5
+)
+
+func main() {
+	name := flag.String("limiter", "token", "limiter to use: counter, leaky, token or window")
+	flag.Parse()
+
+	if err := run(context.Background(), os.Stdout, *name); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newLimiter returns the limiter called name and a function releasing it.
+func newLimiter(name string) (ratelimit.Limiter, func(), error) {
+	switch name {
+	case "counter":
+		return counter.New(10), func() {}, nil
+	case "leaky":
+		return leakybucket.New(10, 10), func() {}, nil
+	case "token":
+		tb := tokenbucket.New(10, 10)
+		return tb, tb.Close, nil
+	case "window":
+		sw, err := window.New(time.Second, 100*time.Millisecond, 10)
+		if err != nil {
+			return nil, nil, err
+		}
+		sw.SetLimit(10)
+		return sw, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown limiter %q", name)
+	}
+}
+
+// run sends the requests through the limiter called name and reports to w.
+func run(ctx context.Context, w io.Writer, name string) error {
+	l, release, err := newLimiter(name)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	reject := httpmw.Middleware(l)(ok)
+	wait := httpmw.Middleware(l, httpmw.WithWaitMode())(ok)
+
+	// Give the buckets time to fill
+	select {
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	allowed, rejected := serve(ctx, reject, burst)
+	fmt.Fprintf(w, "%s burst: %d allowed, %d rejected\n", name, allowed, rejected)
+
+	allowed, rejected = serve(ctx, wait, steady)
+	fmt.Fprintf(w, "%s wait mode: %d allowed, %d rejected\n", name, allowed, rejected)
+
+	return ctx.Err()
+}
+
+// serve sends n requests to h one after another, counting the answers.
+func serve(ctx context.Context, h http.Handler, n int) (allowed, rejected int) {
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code == http.StatusOK {
+			allowed++
+		} else {
+			rejected++
+		}
+	}
+	return allowed, rejected
+}
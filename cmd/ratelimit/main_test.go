@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	for _, name := range []string{"counter", "leaky", "token", "window"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			if err := run(context.Background(), &out, name); err != nil {
+				t.Fatal(err)
+			}
+
+			// The limiters differ on a burst, but none allows more than
+			// its 10 per second nor rejects everything
+			var got string
+			var allowed, rejected int
+			if _, err := fmt.Fscanf(&out, "%s burst: %d allowed, %d rejected\n", &got, &allowed, &rejected); err != nil {
+				t.Fatalf("burst line: %v", err)
+			}
+			if got != name || allowed < 1 || allowed > 10 || allowed+rejected != burst {
+				t.Errorf("%s burst: %d allowed, %d rejected", got, allowed, rejected)
+			}
+
+			// Waiting serves every request
+			want := fmt.Sprintf("%s wait mode: %d allowed, 0 rejected\n", name, steady)
+			if out.String() != want {
+				t.Errorf("output %q, want %q", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestRunUnknown(t *testing.T) {
+	if err := run(context.Background(), &bytes.Buffer{}, "nolimit"); err == nil {
+		t.Error("run with an unknown limiter returned nil")
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := run(ctx, &bytes.Buffer{}, "token"); !errors.Is(err, context.Canceled) {
+		t.Errorf("run = %v, want context.Canceled", err)
+	}
+}
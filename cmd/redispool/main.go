@@ -0,0 +1,92 @@
+// Command redispool runs commands on a Redis server through a
+// RedisConnectionPool, from one goroutine and then from many.
+//
+//	go run ./cmd/redispool -addr localhost:6379
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/group"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+	"github.com/go-redis/redis"
+)
+
+// Number of goroutines sharing the pool
+const workers = 20
+
+func main() {
+	addr := flag.String("addr", "localhost:6379", "address of the Redis server")
+	flag.Parse()
+
+	if err := run(context.Background(), os.Stdout, *addr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run uses the Redis server at addr and reports to w.
+func run(ctx context.Context, w io.Writer, addr string) error {
+
+	// At most 10 connections, 5 kept idle
+	pool := redispool.New(10, 5, time.Second)
+	pool.OpenConnection = func() (*redispool.RedisConn, error) {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		return &redispool.RedisConn{Conn: client, TimeOut: time.Minute}, nil
+	}
+	if err := pool.Open(); err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// Do releases the connection however fn returns
+	var greeting string
+	err := pool.Do(ctx, func(conn *redispool.RedisConn) error {
+		if err := conn.Conn.Set("greeting", "hello", 0).Err(); err != nil {
+			return err
+		}
+		var err error
+		greeting, err = conn.Conn.Get("greeting").Result()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "GET greeting: %s\n", greeting)
+
+	// Many goroutines share the connections
+	if err := pool.Do(ctx, func(conn *redispool.RedisConn) error {
+		return conn.Conn.Del("visits").Err()
+	}); err != nil {
+		return err
+	}
+	g := group.New(ctx)
+	for i := 0; i < workers; i++ {
+		g.Go(func(ctx context.Context) error {
+			return pool.Do(ctx, func(conn *redispool.RedisConn) error {
+				return conn.Conn.Incr("visits").Err()
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	var visits int64
+	if err := pool.Do(ctx, func(conn *redispool.RedisConn) error {
+		var err error
+		visits, err = conn.Conn.Get("visits").Int64()
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d goroutines counted %d visits\n", workers, visits)
+
+	fmt.Fprintf(w, "connections in use: %d\n", pool.Stats().InUse)
+	return nil
+}
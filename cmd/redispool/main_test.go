@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRun(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	var out bytes.Buffer
+	if err := run(context.Background(), &out, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "GET greeting: hello\n" +
+		"20 goroutines counted 20 visits\n" +
+		"connections in use: 0\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunDown(t *testing.T) {
+	s := miniredis.RunT(t)
+	addr := s.Addr()
+	s.Close()
+
+	// A server not answering is an error, not a panic
+	if err := run(context.Background(), &bytes.Buffer{}, addr); err == nil {
+		t.Error("run against a closed server returned nil")
+	}
+}
@@ -0,0 +1,104 @@
+// Package backoff provides context-aware sleeping and exponential backoff
+// delays, shared by the packages that wait before trying again.
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Sleep waits for d, or until ctx is done, in which case it returns the
+// context error. It does not leave a timer behind either way. With d of
+// zero or less it only checks ctx.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff produces growing delays. The zero value gives no delay; set at
+// least Initial. A Backoff is not safe for concurrent use: give every
+// goroutine its own copy, made before its first Next.
+type Backoff struct {
+
+	// Initial is the first delay.
+	Initial time.Duration
+
+	// Max caps the delays before jitter. Zero means no cap.
+	Max time.Duration
+
+	// Multiplier grows the delay after each Next. Values of 1 or less
+	// keep it constant.
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction in either
+	// direction, so 0.2 gives delays between 80% and 120% of the backoff.
+	Jitter float64
+
+	// Rand returns a random number in [0, 1) for the jitter. If nil,
+	// math/rand is used.
+	Rand func() float64
+
+	// current is the delay Next returns before jitter. Zero means Initial.
+	current time.Duration
+}
+
+// Next returns the next delay and grows the backoff.
+func (b *Backoff) Next() time.Duration {
+	d := b.current
+	if d == 0 {
+		d = b.capped(b.Initial)
+	}
+
+	next := d
+	if b.Multiplier > 1 {
+		next = b.capped(time.Duration(float64(d) * b.Multiplier))
+	}
+	b.current = next
+
+	return b.jitter(d)
+}
+
+// Reset starts the delays over from Initial.
+func (b *Backoff) Reset() {
+	b.current = 0
+}
+
+// Wait sleeps for the next delay, or until ctx is done.
+func (b *Backoff) Wait(ctx context.Context) error {
+	return Sleep(ctx, b.Next())
+}
+
+// capped limits d to Max.
+func (b *Backoff) capped(d time.Duration) time.Duration {
+	if b.Max > 0 && d > b.Max {
+		return b.Max
+	}
+	return d
+}
+
+// jitter randomizes d by up to the jitter fraction.
+func (b *Backoff) jitter(d time.Duration) time.Duration {
+	if b.Jitter <= 0 || d <= 0 {
+		return d
+	}
+
+	r := rand.Float64
+	if b.Rand != nil {
+		r = b.Rand
+	}
+
+	// Scale by a factor in [1-jitter, 1+jitter)
+	return time.Duration(float64(d) * (1 + b.Jitter*(2*r()-1)))
+}
@@ -0,0 +1,119 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	start := time.Now()
+	if err := Sleep(context.Background(), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Sleep returned after %v, want at least 20ms", elapsed)
+	}
+}
+
+func TestSleepCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	// Cancellation cuts a long sleep short
+	start := time.Now()
+	if err := Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Sleep returned %v after cancellation", elapsed)
+	}
+
+	// A done context fails even without a delay
+	if err := Sleep(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep(0) = %v, want context.Canceled", err)
+	}
+	if err := Sleep(context.Background(), 0); err != nil {
+		t.Errorf("Sleep(0) = %v, want nil", err)
+	}
+}
+
+func TestNext(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Millisecond {
+			t.Errorf("delay %d = %v, want %v", i, got, w*time.Millisecond)
+		}
+	}
+
+	b.Reset()
+	if got := b.Next(); got != 100*time.Millisecond {
+		t.Errorf("delay after Reset = %v, want 100ms", got)
+	}
+}
+
+func TestNextConstant(t *testing.T) {
+	b := Backoff{Initial: 50 * time.Millisecond}
+	for i := 0; i < 3; i++ {
+		if got := b.Next(); got != 50*time.Millisecond {
+			t.Errorf("delay %d = %v, want 50ms", i, got)
+		}
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	b := Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        2 * time.Second,
+		Multiplier: 2,
+		Jitter:     0.25,
+		Rand:       r.Float64,
+	}
+
+	// Every delay stays within 25% of the backoff it randomizes
+	base := 100 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		d := b.Next()
+		lo := time.Duration(float64(base) * 0.75)
+		hi := time.Duration(float64(base) * 1.25)
+		if d < lo || d >= hi {
+			t.Fatalf("delay %d = %v, want in [%v, %v)", i, d, lo, hi)
+		}
+		if base *= 2; base > 2*time.Second {
+			base = 2 * time.Second
+		}
+	}
+}
+
+func TestJitterExtremes(t *testing.T) {
+	for _, tt := range []struct {
+		r    float64
+		want time.Duration
+	}{
+		{0, 80 * time.Millisecond},
+		{0.5, 100 * time.Millisecond},
+	} {
+		b := Backoff{Initial: 100 * time.Millisecond, Jitter: 0.2, Rand: func() float64 { return tt.r }}
+		if got := b.Next(); got != tt.want {
+			t.Errorf("with rand %v, delay = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b := Backoff{Initial: time.Hour}
+	if err := b.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package batch coalesces bursts of channel items into slices.
+package batch
+
+import (
+	"context"
+	"time"
+)
+
+// Collect groups the items of in into slices. A slice is emitted when it
+// holds maxSize items, or when maxWait has passed since its first item,
+// whichever comes first. Empty slices are never emitted.
+//
+// The output is closed when in is closed, after emitting the partial
+// batch, or when ctx is cancelled. On cancellation the partial batch is
+// still delivered if the reader has taken every earlier batch, and dropped
+// otherwise, so Collect never blocks after ctx is done.
+func Collect[T any](ctx context.Context, in <-chan T, maxSize int, maxWait time.Duration) <-chan []T {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+
+	// One slot lets the final batch be handed over on cancellation
+	out := make(chan []T, 1)
+
+	go func() {
+		defer close(out)
+
+		// A single timer is reused for every batch. It is only running
+		// while a batch is pending.
+		timer := time.NewTimer(maxWait)
+		stopTimer(timer)
+		defer timer.Stop()
+
+		var batch []T
+		var timing bool
+
+		flush := func() bool {
+			if timing {
+				stopTimer(timer)
+				timing = false
+			}
+			if len(batch) == 0 {
+				return true
+			}
+
+			b := batch
+			batch = nil
+
+			select {
+			case out <- b:
+				return true
+			case <-ctx.Done():
+				// Last chance for the final batch
+				select {
+				case out <- b:
+				default:
+				}
+				return false
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+
+				batch = append(batch, v)
+
+				if len(batch) >= maxSize {
+					if !flush() {
+						return
+					}
+					continue
+				}
+
+				// Start waiting with the first item of a batch
+				if len(batch) == 1 {
+					timer.Reset(maxWait)
+					timing = true
+				}
+
+			case <-timer.C:
+				timing = false
+				if !flush() {
+					return
+				}
+
+			case <-ctx.Done():
+				// Hand over the partial batch without blocking
+				if len(batch) > 0 {
+					select {
+					case out <- batch:
+					default:
+					}
+				}
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// stopTimer stops t and empties its channel, so it can be Reset.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package batch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestCollectSize(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan int)
+	out := Collect(context.Background(), in, 3, time.Hour)
+
+	go func() {
+		for i := 0; i < 6; i++ {
+			in <- i
+		}
+	}()
+
+	// Full batches are emitted without waiting
+	for i := 0; i < 2; i++ {
+		select {
+		case b := <-out:
+			if len(b) != 3 || b[0] != i*3 {
+				t.Errorf("batch %d = %v", i, b)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("full batch was not emitted")
+		}
+	}
+
+	close(in)
+	if b, ok := <-out; ok {
+		t.Errorf("got %v, want the output closed", b)
+	}
+}
+
+func TestCollectTime(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan int)
+	defer close(in)
+	out := Collect(context.Background(), in, 100, 20*time.Millisecond)
+
+	// Each burst is emitted after maxWait
+	for burst := 0; burst < 3; burst++ {
+		start := time.Now()
+		in <- 1
+		in <- 2
+
+		b := <-out
+		if len(b) != 2 {
+			t.Errorf("burst %d: batch = %v, want 2 items", burst, b)
+		}
+		if d := time.Since(start); d < 20*time.Millisecond {
+			t.Errorf("burst %d: emitted after %v, want at least 20ms", burst, d)
+		}
+	}
+}
+
+func TestCollectFlushOnClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		in <- i
+	}
+	close(in)
+
+	var got [][]int
+	for b := range Collect(context.Background(), in, 2, time.Hour) {
+		got = append(got, b)
+	}
+
+	// Two full batches and the partial one
+	if len(got) != 3 || len(got[2]) != 1 || got[2][0] != 4 {
+		t.Errorf("got %v, want [[0 1] [2 3] [4]]", got)
+	}
+}
+
+func TestCollectFlushOnCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	out := Collect(ctx, in, 10, time.Hour)
+
+	in <- 1
+	in <- 2
+	cancel()
+
+	b, ok := <-out
+	if !ok || len(b) != 2 {
+		t.Errorf("got %v, %v, want the partial batch", b, ok)
+	}
+	if _, ok := <-out; ok {
+		t.Error("output should be closed")
+	}
+}
+
+func TestCollectIdle(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := Collect(ctx, make(chan int), 10, 5*time.Millisecond)
+
+	// Nothing is emitted while the input is idle
+	select {
+	case b := <-out:
+		t.Fatalf("got %v from an idle input", b)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	// And no empty batch on cancellation either
+	cancel()
+	if b, ok := <-out; ok {
+		t.Errorf("got %v, want the output closed", b)
+	}
+}
@@ -0,0 +1,197 @@
+// Package chantime provides channel sends and receives bounded by a timeout
+// or a context, reporting closed and nil channels as errors instead of
+// panicking, blocking forever or returning zero values.
+package chantime
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when the operation did not complete in time.
+	ErrTimeout = errors.New("channel operation timed out")
+
+	// ErrClosed is returned when the channel is closed.
+	ErrClosed = errors.New("channel is closed")
+
+	// ErrNilChannel is returned for a nil channel, on which the operation
+	// would block forever.
+	ErrNilChannel = errors.New("channel is nil")
+
+	// errDone tells the Ctx variants that their context is done.
+	errDone = errors.New("done")
+)
+
+// SendTimeout sends v on ch, giving up after d. With d of zero or less it
+// only sends if ch is ready now.
+func SendTimeout[T any](ch chan<- T, v T, d time.Duration) error {
+	if ch == nil {
+		return ErrNilChannel
+	}
+	if ok, err := trySend(ch, v); ok || err != nil {
+		return err
+	}
+	if d <= 0 {
+		return ErrTimeout
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	return send(ch, v, timer.C, nil)
+}
+
+// SendCtx sends v on ch, giving up when ctx is done.
+func SendCtx[T any](ctx context.Context, ch chan<- T, v T) error {
+	if ch == nil {
+		return ErrNilChannel
+	}
+	if ok, err := trySend(ch, v); ok || err != nil {
+		return err
+	}
+	if err := send(ch, v, nil, ctx.Done()); err != errDone {
+		return err
+	}
+	return ctx.Err()
+}
+
+// RecvTimeout receives from ch, giving up after d. With d of zero or less
+// it only receives if a value is ready now.
+func RecvTimeout[T any](ch <-chan T, d time.Duration) (T, error) {
+	var zero T
+	if ch == nil {
+		return zero, ErrNilChannel
+	}
+
+	// Fast path, without a timer
+	select {
+	case v, ok := <-ch:
+		return recvResult(v, ok)
+	default:
+	}
+	if d <= 0 {
+		return zero, ErrTimeout
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case v, ok := <-ch:
+		return recvResult(v, ok)
+	case <-timer.C:
+		return zero, ErrTimeout
+	}
+}
+
+// RecvCtx receives from ch, giving up when ctx is done.
+func RecvCtx[T any](ctx context.Context, ch <-chan T) (T, error) {
+	var zero T
+	if ch == nil {
+		return zero, ErrNilChannel
+	}
+
+	// A ready value wins over a done context
+	select {
+	case v, ok := <-ch:
+		return recvResult(v, ok)
+	default:
+	}
+
+	select {
+	case v, ok := <-ch:
+		return recvResult(v, ok)
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// First receives from whichever of chans delivers first and returns the
+// value and the index of its channel. Closed channels are skipped, and nil
+// channels never deliver, as in a select. It returns ErrClosed with index
+// -1 once no channel can deliver, and ctx.Err() if ctx is done first.
+func First[T any](ctx context.Context, chans ...<-chan T) (T, int, error) {
+	var zero T
+
+	// cases[0] is either a default case, to take a ready value first, or
+	// ctx.Done(); cases[i+1] is chans[i]
+	cases := make([]reflect.SelectCase, len(chans)+1)
+	ready := reflect.SelectCase{Dir: reflect.SelectDefault}
+	done := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+	open := 0
+	for i, ch := range chans {
+		cases[i+1].Dir = reflect.SelectRecv
+		if ch != nil {
+			cases[i+1].Chan = reflect.ValueOf(ch)
+			open++
+		}
+	}
+
+	// A ready value wins over a done context
+	cases[0] = ready
+	for open > 0 {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 0 {
+			if cases[0].Dir == reflect.SelectRecv {
+				return zero, -1, ctx.Err()
+			}
+			cases[0] = done
+			continue
+		}
+		if !ok {
+			// A zero Chan disables the case
+			cases[chosen].Chan = reflect.Value{}
+			open--
+			continue
+		}
+		return v.Interface().(T), chosen - 1, nil
+	}
+
+	return zero, -1, ErrClosed
+}
+
+// trySend sends v on ch if it is ready now and reports whether it did.
+func trySend[T any](ch chan<- T, v T) (sent bool, err error) {
+	defer func() {
+		if recover() != nil {
+			sent, err = false, ErrClosed
+		}
+	}()
+
+	select {
+	case ch <- v:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// send sends v on ch until timeout fires or done is closed, returning
+// ErrTimeout or errDone. Either may be nil. A send on a closed channel is
+// turned into ErrClosed.
+func send[T any](ch chan<- T, v T, timeout <-chan time.Time, done <-chan struct{}) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = ErrClosed
+		}
+	}()
+
+	select {
+	case ch <- v:
+		return nil
+	case <-timeout:
+		return ErrTimeout
+	case <-done:
+		return errDone
+	}
+}
+
+// recvResult turns the result of a receive into a value and an error.
+func recvResult[T any](v T, ok bool) (T, error) {
+	if !ok {
+		return v, ErrClosed
+	}
+	return v, nil
+}
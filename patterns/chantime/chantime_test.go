@@ -0,0 +1,221 @@
+package chantime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// Channel states every helper is checked against.
+const (
+	ready  = "ready"  // A send or receive completes at once
+	idle   = "idle"   // Full for a send, empty for a receive
+	closed = "closed" // Closed
+	none   = "nil"    // Nil
+)
+
+var states = []string{ready, idle, closed, none}
+
+// sendChan returns a channel of capacity 1 in state.
+func sendChan(state string) chan int {
+	switch state {
+	case none:
+		return nil
+	case closed:
+		ch := make(chan int, 1)
+		close(ch)
+		return ch
+	case idle:
+		ch := make(chan int, 1)
+		ch <- 0
+		return ch
+	}
+	return make(chan int, 1)
+}
+
+// recvChan returns a channel of capacity 1 in state, holding v if ready.
+func recvChan(state string, v int) chan int {
+	switch state {
+	case none:
+		return nil
+	case closed:
+		ch := make(chan int)
+		close(ch)
+		return ch
+	case ready:
+		ch := make(chan int, 1)
+		ch <- v
+		return ch
+	}
+	return make(chan int)
+}
+
+// stateErrs is the error the timeout helpers return per state.
+var stateErrs = map[string]error{ready: nil, idle: ErrTimeout, closed: ErrClosed, none: ErrNilChannel}
+
+func deadlineCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestSendTimeout(t *testing.T) {
+	for _, state := range states {
+		for _, d := range []time.Duration{0, 10 * time.Millisecond} {
+			err := SendTimeout(sendChan(state), 1, d)
+			if !errors.Is(err, stateErrs[state]) || (err == nil) != (stateErrs[state] == nil) {
+				t.Errorf("SendTimeout(%s, %v) error = %v, want %v", state, d, err, stateErrs[state])
+			}
+		}
+	}
+}
+
+func TestSendCtx(t *testing.T) {
+	for _, state := range states {
+		want := stateErrs[state]
+		if want == ErrTimeout {
+			want = context.DeadlineExceeded
+		}
+		err := SendCtx(deadlineCtx(t), sendChan(state), 1)
+		if !errors.Is(err, want) || (err == nil) != (want == nil) {
+			t.Errorf("SendCtx(%s) error = %v, want %v", state, err, want)
+		}
+	}
+}
+
+func TestRecvTimeout(t *testing.T) {
+	for _, state := range states {
+		for _, d := range []time.Duration{0, 10 * time.Millisecond} {
+			v, err := RecvTimeout(recvChan(state, 7), d)
+			if !errors.Is(err, stateErrs[state]) || (err == nil) != (stateErrs[state] == nil) {
+				t.Errorf("RecvTimeout(%s, %v) error = %v, want %v", state, d, err, stateErrs[state])
+			}
+			if err == nil && v != 7 {
+				t.Errorf("RecvTimeout(%s, %v) = %d, want 7", state, d, v)
+			}
+		}
+	}
+}
+
+func TestRecvCtx(t *testing.T) {
+	for _, state := range states {
+		want := stateErrs[state]
+		if want == ErrTimeout {
+			want = context.DeadlineExceeded
+		}
+		v, err := RecvCtx(deadlineCtx(t), recvChan(state, 7))
+		if !errors.Is(err, want) || (err == nil) != (want == nil) {
+			t.Errorf("RecvCtx(%s) error = %v, want %v", state, err, want)
+		}
+		if err == nil && v != 7 {
+			t.Errorf("RecvCtx(%s) = %d, want 7", state, v)
+		}
+	}
+}
+
+func TestReadyWinsOverDoneContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 100; i++ {
+		if _, err := RecvCtx(ctx, recvChan(ready, 1)); err != nil {
+			t.Fatalf("RecvCtx() error = %v, want the ready value", err)
+		}
+		if err := SendCtx(ctx, sendChan(ready), 1); err != nil {
+			t.Fatalf("SendCtx() error = %v, want the send to complete", err)
+		}
+		if _, _, err := First(ctx, recvChan(idle, 0), recvChan(ready, 1)); err != nil {
+			t.Fatalf("First() error = %v, want the ready value", err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Every value sent arrives unchanged
+	f := func(v int) bool {
+		ch := make(chan int, 1)
+		if err := SendTimeout(ch, v, time.Millisecond); err != nil {
+			return false
+		}
+		got, err := RecvTimeout(ch, time.Millisecond)
+		return err == nil && got == v
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFirst(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Any mix of states: the ready channel wins if there is one, closed
+	// and nil channels never deliver
+	f := func(mix []uint8) bool {
+		chans := make([]<-chan int, len(mix))
+		readyAt, idleAny := -1, false
+		for i, m := range mix {
+			state := states[int(m)%len(states)]
+			if state == ready && readyAt < 0 {
+				readyAt = i
+			} else if state == ready {
+				state = idle
+			}
+			if state == idle {
+				idleAny = true
+			}
+			chans[i] = recvChan(state, i)
+		}
+
+		v, i, err := First(deadlineCtx(t), chans...)
+		switch {
+		case readyAt >= 0:
+			return err == nil && i == readyAt && v == readyAt
+		case idleAny:
+			return errors.Is(err, context.DeadlineExceeded) && i == -1
+		default:
+			return errors.Is(err, ErrClosed) && i == -1
+		}
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 50}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFirstLaterSend(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	a, b := make(chan int), make(chan int)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		b <- 3
+	}()
+
+	v, i, err := First(context.Background(), a, b)
+	if err != nil || i != 1 || v != 3 {
+		t.Errorf("First() = %d, %d, %v, want 3, 1, nil", v, i, err)
+	}
+}
+
+func TestFirstAllClosedLater(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	a := make(chan int)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		close(a)
+	}()
+
+	if _, i, err := First(context.Background(), a, nil); !errors.Is(err, ErrClosed) || i != -1 {
+		t.Errorf("First() = %d, %v, want -1, %v", i, err, ErrClosed)
+	}
+}
+
+func TestFirstNoChannels(t *testing.T) {
+	if _, _, err := First[int](context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("First() error = %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,112 @@
+// Package chanutil provides small channel helpers that stop cleanly when
+// their context is cancelled.
+package chanutil
+
+import "context"
+
+// OrDone forwards the values of in until in is closed or ctx is done, so
+// consumers can range over the result without checking ctx themselves.
+func OrDone[T any](ctx context.Context, in <-chan T) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Tee copies every value of in to both outputs. Each value is delivered to
+// both before the next one is read, so the slower reader sets the pace.
+// Both outputs are closed when in is closed or ctx is done.
+func Tee[T any](ctx context.Context, in <-chan T) (<-chan T, <-chan T) {
+	out1 := make(chan T)
+	out2 := make(chan T)
+
+	go func() {
+		defer close(out1)
+		defer close(out2)
+
+		for v := range OrDone(ctx, in) {
+			// Send to whichever is ready first, then to the other one
+			o1, o2 := out1, out2
+			for i := 0; i < 2; i++ {
+				select {
+				case o1 <- v:
+					o1 = nil
+				case o2 <- v:
+					o2 = nil
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out1, out2
+}
+
+// Bridge flattens a stream of channels into a single channel, reading each
+// channel until it is closed before moving on to the next. The output is
+// closed when chans is closed and its last channel is drained, or when ctx
+// is done.
+func Bridge[T any](ctx context.Context, chans <-chan <-chan T) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+		for {
+			var in <-chan T
+			select {
+			case ch, ok := <-chans:
+				if !ok {
+					return
+				}
+				in = ch
+			case <-ctx.Done():
+				return
+			}
+
+			for v := range OrDone(ctx, in) {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// Drain reads and discards the values of in until in is closed or ctx is
+// done. It returns the number of values discarded.
+func Drain[T any](ctx context.Context, in <-chan T) int {
+	var n int
+	for {
+		select {
+		case _, ok := <-in:
+			if !ok {
+				return n
+			}
+			n++
+		case <-ctx.Done():
+			return n
+		}
+	}
+}
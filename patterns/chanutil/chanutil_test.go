@@ -0,0 +1,161 @@
+package chanutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// source sends 0..n-1 to a new channel and closes it.
+func source(n int) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+	}()
+	return ch
+}
+
+func TestOrDone(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var got []int
+	for v := range OrDone(context.Background(), source(5)) {
+		got = append(got, v)
+	}
+	if len(got) != 5 || got[4] != 4 {
+		t.Errorf("got %v, want [0 1 2 3 4]", got)
+	}
+}
+
+func TestOrDoneCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The input never closes
+	out := OrDone(ctx, make(chan int))
+	cancel()
+	for range out {
+	}
+
+	// Nobody reads the output
+	ctx, cancel = context.WithCancel(context.Background())
+	in := make(chan int, 1)
+	in <- 1
+	OrDone(ctx, in)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+}
+
+func TestTee(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	out1, out2 := Tee(context.Background(), source(10))
+
+	done := make(chan []int)
+	go func() {
+		var got []int
+		for v := range out2 {
+			got = append(got, v)
+		}
+		done <- got
+	}()
+
+	var got1 []int
+	for v := range out1 {
+		got1 = append(got1, v)
+	}
+	got2 := <-done
+
+	if len(got1) != 10 || len(got2) != 10 {
+		t.Fatalf("got %d and %d values, want 10 each", len(got1), len(got2))
+	}
+	for i := range got1 {
+		if got1[i] != i || got2[i] != i {
+			t.Fatalf("value %d: got %d and %d", i, got1[i], got2[i])
+		}
+	}
+}
+
+func TestTeeCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int, 1)
+	in <- 1
+
+	// Only one output is read, so Tee is stuck on the other
+	out1, out2 := Tee(ctx, in)
+	<-out1
+	cancel()
+
+	for range out1 {
+	}
+	for range out2 {
+	}
+}
+
+func TestBridge(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	chans := make(chan (<-chan int))
+	go func() {
+		defer close(chans)
+		for i := 0; i < 3; i++ {
+			chans <- source(3)
+		}
+	}()
+
+	var got []int
+	for v := range Bridge(context.Background(), chans) {
+		got = append(got, v)
+	}
+
+	want := []int{0, 1, 2, 0, 1, 2, 0, 1, 2}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestBridgeCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The current channel never closes, and neither does the stream
+	chans := make(chan (<-chan int), 1)
+	inner := make(chan int, 1)
+	inner <- 1
+	chans <- inner
+
+	out := Bridge(ctx, chans)
+	<-out
+	cancel()
+	for range out {
+	}
+}
+
+func TestDrain(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	if n := Drain(context.Background(), source(7)); n != 7 {
+		t.Errorf("Drain() = %d, want 7", n)
+	}
+
+	// Stops when ctx is done even if the input never closes
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if n := Drain(ctx, make(chan int)); n != 0 {
+		t.Errorf("Drain() = %d, want 0", n)
+	}
+}
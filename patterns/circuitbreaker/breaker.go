@@ -0,0 +1,287 @@
+// Package circuitbreaker implements the circuit breaker pattern.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// ErrOpen is returned by Execute when the breaker rejects a call, either
+// because it is open or because the half-open probes are taken.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a breaker.
+type State int
+
+const (
+	// Closed lets every call through and counts failures.
+	Closed State = iota
+
+	// Open rejects every call until the cool-down has passed.
+	Open
+
+	// HalfOpen lets a limited number of probe calls through to test
+	// whether the dependency has recovered.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Option configures a Breaker.
+type Option func(*Breaker)
+
+// WithFailureThreshold opens the breaker once n failures happen within
+// the window. The default is 5.
+func WithFailureThreshold(n int) Option {
+	return func(b *Breaker) {
+		b.threshold = n
+	}
+}
+
+// WithWindow sets the rolling window failures are counted in, split into
+// buckets of bucketSize. The default is 10s in 1s buckets.
+func WithWindow(size, bucketSize time.Duration) Option {
+	return func(b *Breaker) {
+		b.windowSize = size
+		b.bucketSize = bucketSize
+	}
+}
+
+// WithCoolDown sets how long the breaker stays open before probing.
+// The default is 30s.
+func WithCoolDown(d time.Duration) Option {
+	return func(b *Breaker) {
+		b.coolDown = d
+	}
+}
+
+// WithProbes sets how many calls are let through while half-open, and how
+// many of them must succeed to close the breaker. The default is 1.
+func WithProbes(n int) Option {
+	return func(b *Breaker) {
+		b.probes = n
+	}
+}
+
+// WithOnStateChange sets a callback invoked on every state change. It is
+// called with the breaker's lock held, so it must not call the breaker.
+func WithOnStateChange(fn func(from, to State)) Option {
+	return func(b *Breaker) {
+		b.onStateChange = fn
+	}
+}
+
+// WithIsFailure sets which errors count as failures. By default every
+// non-nil error does.
+func WithIsFailure(fn func(error) bool) Option {
+	return func(b *Breaker) {
+		b.isFailure = fn
+	}
+}
+
+// WithClock sets the clock used for the window and the cool-down.
+func WithClock(c window.Clock) Option {
+	return func(b *Breaker) {
+		b.clock = c
+	}
+}
+
+// Breaker stops calling a failing dependency for a while, giving it time
+// to recover.
+type Breaker struct {
+	threshold     int
+	windowSize    time.Duration
+	bucketSize    time.Duration
+	coolDown      time.Duration
+	probes        int
+	onStateChange func(from, to State)
+	isFailure     func(error) bool
+	clock         window.Clock
+
+	mu sync.Mutex
+
+	// state is the current state.
+	state State
+
+	// generation changes on every state change, so results of calls
+	// admitted in an earlier state are ignored.
+	generation uint64
+
+	// failures counts failures in the rolling window while closed.
+	failures *window.SlidingWindow
+
+	// openedAt is when the breaker last opened.
+	openedAt time.Time
+
+	// admitted and succeeded count the probes of the current half-open
+	// state.
+	admitted  int
+	succeeded int
+}
+
+// New creates a closed Breaker.
+func New(opts ...Option) (*Breaker, error) {
+	b := &Breaker{
+		threshold:  5,
+		windowSize: 10 * time.Second,
+		bucketSize: time.Second,
+		coolDown:   30 * time.Second,
+		probes:     1,
+		isFailure:  func(err error) bool { return err != nil },
+		clock:      realClock{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.threshold < 1 || b.probes < 1 {
+		return nil, fmt.Errorf("failure threshold and probes must be positive")
+	}
+	if b.windowSize <= 0 || b.bucketSize <= 0 {
+		return nil, fmt.Errorf("window size and bucket size must be positive")
+	}
+
+	failures, err := window.New(b.windowSize, b.bucketSize, int(b.windowSize/b.bucketSize), window.WithClock(b.clock))
+	if err != nil {
+		return nil, err
+	}
+	b.failures = failures
+
+	return b, nil
+}
+
+// Execute calls fn if the breaker admits it, and records the outcome.
+// It returns ErrOpen without calling fn if the breaker rejects the call,
+// and ctx's error if ctx is already done.
+func (b *Breaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	generation, err := b.admit()
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx)
+	b.record(generation, err)
+
+	return err
+}
+
+// State returns the current state, moving from Open to HalfOpen if the
+// cool-down has passed.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkCoolDown()
+	return b.state
+}
+
+// admit decides whether a call may run and returns the generation it runs
+// in.
+func (b *Breaker) admit() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkCoolDown()
+
+	switch b.state {
+	case Open:
+		return 0, ErrOpen
+	case HalfOpen:
+		if b.admitted >= b.probes {
+			return 0, ErrOpen
+		}
+		b.admitted++
+	}
+
+	return b.generation, nil
+}
+
+// record updates the state with the outcome of a call.
+func (b *Breaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The state changed while the call ran
+	if generation != b.generation {
+		return
+	}
+
+	failed := b.isFailure(err)
+
+	switch b.state {
+	case Closed:
+		if failed {
+			b.failures.Allow()
+			if b.failures.Used() >= b.threshold {
+				b.setState(Open)
+			}
+		}
+
+	case HalfOpen:
+		if failed {
+			b.setState(Open)
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.probes {
+			b.setState(Closed)
+		}
+	}
+}
+
+// checkCoolDown moves from Open to HalfOpen once the cool-down has
+// passed. Caller must hold the lock.
+func (b *Breaker) checkCoolDown() {
+	if b.state == Open && b.clock.Now().Sub(b.openedAt) >= b.coolDown {
+		b.setState(HalfOpen)
+	}
+}
+
+// setState moves to state and resets its bookkeeping. Caller must hold
+// the lock.
+func (b *Breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	b.generation++
+
+	switch state {
+	case Closed:
+		b.failures.Reset()
+	case Open:
+		b.openedAt = b.clock.Now()
+	case HalfOpen:
+		b.admitted = 0
+		b.succeeded = 0
+	}
+
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,237 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var errFail = errors.New("fail")
+
+func fail(context.Context) error    { return errFail }
+func succeed(context.Context) error { return nil }
+
+func TestStateMachine(t *testing.T) {
+	clock := newFakeClock()
+
+	var changes []string
+	b, err := New(
+		WithFailureThreshold(3),
+		WithWindow(10*time.Second, time.Second),
+		WithCoolDown(5*time.Second),
+		WithProbes(2),
+		WithClock(clock),
+		WithOnStateChange(func(from, to State) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Failures below the threshold keep it closed
+	b.Execute(ctx, fail)
+	b.Execute(ctx, fail)
+	if b.State() != Closed {
+		t.Fatalf("State() = %v, want closed", b.State())
+	}
+
+	// Failures slide out of the window
+	clock.Add(10 * time.Second)
+	b.Execute(ctx, fail)
+	b.Execute(ctx, fail)
+	if b.State() != Closed {
+		t.Fatalf("State() = %v, want closed after old failures expired", b.State())
+	}
+
+	// The threshold opens it
+	b.Execute(ctx, fail)
+	if b.State() != Open {
+		t.Fatalf("State() = %v, want open", b.State())
+	}
+
+	// Calls are rejected while open
+	called := false
+	err = b.Execute(ctx, func(context.Context) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrOpen) || called {
+		t.Errorf("Execute() = %v, called = %v, want ErrOpen without calling", err, called)
+	}
+
+	// After the cool-down it probes
+	clock.Add(5 * time.Second)
+	if b.State() != HalfOpen {
+		t.Fatalf("State() = %v, want half-open", b.State())
+	}
+
+	// A failed probe opens it again
+	b.Execute(ctx, fail)
+	if b.State() != Open {
+		t.Fatalf("State() = %v, want open after a failed probe", b.State())
+	}
+
+	// Enough successful probes close it
+	clock.Add(5 * time.Second)
+	b.Execute(ctx, succeed)
+	if b.State() != HalfOpen {
+		t.Fatalf("State() = %v, want half-open after one probe", b.State())
+	}
+	b.Execute(ctx, succeed)
+	if b.State() != Closed {
+		t.Fatalf("State() = %v, want closed", b.State())
+	}
+
+	// The failure count starts over
+	b.Execute(ctx, fail)
+	b.Execute(ctx, fail)
+	if b.State() != Closed {
+		t.Fatalf("State() = %v, want closed", b.State())
+	}
+
+	want := []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestHalfOpenProbeLimit(t *testing.T) {
+	clock := newFakeClock()
+	b, _ := New(WithFailureThreshold(1), WithCoolDown(time.Second), WithProbes(3), WithClock(clock))
+	ctx := context.Background()
+
+	b.Execute(ctx, fail)
+	clock.Add(time.Second)
+
+	// Probes block until released, so they are all in flight at once
+	release := make(chan struct{})
+	var admitted, rejected int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.Execute(ctx, func(context.Context) error {
+				atomic.AddInt32(&admitted, 1)
+				<-release
+				return nil
+			})
+			if errors.Is(err, ErrOpen) {
+				atomic.AddInt32(&rejected, 1)
+			}
+		}()
+	}
+
+	// Wait for every call to be admitted or rejected
+	for atomic.LoadInt32(&admitted)+atomic.LoadInt32(&rejected) < 50 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if admitted != 3 || rejected != 47 {
+		t.Errorf("admitted %d, rejected %d, want 3 and 47", admitted, rejected)
+	}
+	if b.State() != Closed {
+		t.Errorf("State() = %v, want closed", b.State())
+	}
+}
+
+func TestStaleResult(t *testing.T) {
+	clock := newFakeClock()
+	b, _ := New(WithFailureThreshold(1), WithCoolDown(time.Second), WithClock(clock))
+	ctx := context.Background()
+
+	// A slow call admitted while closed finishes after the breaker opened
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Execute(ctx, func(context.Context) error {
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+
+	b.Execute(ctx, fail)
+	clock.Add(time.Second)
+	close(finish)
+	<-done
+
+	// Its success does not count as a probe
+	if b.State() != HalfOpen {
+		t.Errorf("State() = %v, want half-open", b.State())
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	b, _ := New(WithFailureThreshold(1), WithIsFailure(func(err error) bool {
+		return err != nil && !errors.Is(err, context.Canceled)
+	}))
+
+	b.Execute(context.Background(), func(context.Context) error { return context.Canceled })
+	if b.State() != Closed {
+		t.Errorf("State() = %v, want closed", b.State())
+	}
+}
+
+func TestExecuteCancelled(t *testing.T) {
+	b, _ := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := b.Execute(ctx, succeed); !errors.Is(err, context.Canceled) {
+		t.Errorf("Execute() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(WithFailureThreshold(0)); err == nil {
+		t.Error("New should reject a zero threshold")
+	}
+	if _, err := New(WithWindow(10*time.Second, 3*time.Second)); err == nil {
+		t.Error("New should reject a window not divisible by the bucket size")
+	}
+}
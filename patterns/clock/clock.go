@@ -0,0 +1,118 @@
+// Package clock abstracts reading the time and waiting for it, so rate
+// limiters and pools can be tested without sleeping.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and makes timers.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+
+	// Sleep waits for d, or until ctx is done, returning ctx.Err().
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// Timer is a time.Timer of a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a time.Ticker of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Nower reads the time. Packages whose clocks only read the time accept
+// it; a Clock is one too.
+type Nower interface {
+	Now() time.Time
+}
+
+// New returns the system clock.
+func New() Clock {
+	return realClock{}
+}
+
+// From returns c if it is a Clock, or else a Clock reading the time from c
+// and using the system timers.
+func From(c Nower) Clock {
+	if c, ok := c.(Clock); ok {
+		return c
+	}
+	return nowClock{realClock{}, c}
+}
+
+// realClock is the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (c realClock) Sleep(ctx context.Context, d time.Duration) error {
+	return sleep(ctx, c, d)
+}
+
+// realTimer wraps a time.Timer.
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// realTicker wraps a time.Ticker.
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// nowClock is the system clock reading the time from a Nower.
+type nowClock struct {
+	realClock
+	n Nower
+}
+
+func (c nowClock) Now() time.Time {
+	return c.n.Now()
+}
+
+// sleep waits for d on a timer of c, or until ctx is done.
+func sleep(ctx context.Context, c Clock, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := c.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
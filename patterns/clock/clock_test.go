@@ -0,0 +1,189 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fired reports whether c has a value ready.
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Second)
+
+	f.Add(999 * time.Millisecond)
+	if fired(timer.C()) {
+		t.Fatal("timer fired early")
+	}
+
+	f.Add(time.Millisecond)
+	select {
+	case at := <-timer.C():
+		if !at.Equal(epoch.Add(time.Second)) {
+			t.Errorf("timer fired at %v, want %v", at, epoch.Add(time.Second))
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+	if f.Waiters() != 0 {
+		t.Errorf("Waiters = %d after firing, want 0", f.Waiters())
+	}
+
+	// A stopped timer never fires, a reset one fires again
+	if timer.Reset(time.Second) {
+		t.Error("Reset of a fired timer reported it pending")
+	}
+	if !timer.Stop() {
+		t.Error("Stop of a pending timer reported it not pending")
+	}
+	f.Add(time.Hour)
+	if fired(timer.C()) {
+		t.Error("stopped timer fired")
+	}
+
+	// A timer of zero fires right away
+	if !fired(f.NewTimer(0).C()) {
+		t.Error("timer of zero did not fire")
+	}
+}
+
+func TestFakeTimerStopDrains(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Second)
+	f.Add(time.Second)
+
+	// A fired value not received is not seen after Stop
+	timer.Stop()
+	if fired(timer.C()) {
+		t.Error("stale value received after Stop")
+	}
+}
+
+func TestFakeOrder(t *testing.T) {
+	f := NewFake(epoch)
+	late := f.NewTimer(2 * time.Second)
+	early := f.NewTimer(time.Second)
+
+	// Timers due during one Add fire at their own time, in order
+	f.Add(time.Minute)
+	if at := <-early.C(); !at.Equal(epoch.Add(time.Second)) {
+		t.Errorf("early timer fired at %v", at)
+	}
+	if at := <-late.C(); !at.Equal(epoch.Add(2 * time.Second)) {
+		t.Errorf("late timer fired at %v", at)
+	}
+	if !f.Now().Equal(epoch.Add(time.Minute)) {
+		t.Errorf("Now = %v, want %v", f.Now(), epoch.Add(time.Minute))
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Second)
+
+	for i := 1; i <= 3; i++ {
+		f.Add(time.Second)
+		if at := <-ticker.C(); !at.Equal(epoch.Add(time.Duration(i) * time.Second)) {
+			t.Errorf("tick %d at %v", i, at)
+		}
+	}
+
+	// Ticks not received are dropped
+	f.Add(10 * time.Second)
+	<-ticker.C()
+	if fired(ticker.C()) {
+		t.Error("ticker kept more than one tick")
+	}
+
+	ticker.Stop()
+	f.Add(time.Hour)
+	if fired(ticker.C()) {
+		t.Error("stopped ticker ticked")
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	f := NewFake(epoch)
+	done := make(chan error)
+	go func() {
+		done <- f.Sleep(context.Background(), time.Minute)
+	}()
+
+	// The sleep ends once the clock moved past it
+	f.BlockUntil(1)
+	f.Add(time.Minute)
+	if err := <-done; err != nil {
+		t.Errorf("Sleep = %v, want nil", err)
+	}
+
+	// Cancellation ends it before
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- f.Sleep(ctx, time.Minute)
+	}()
+	f.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep = %v, want context.Canceled", err)
+	}
+	if f.Waiters() != 0 {
+		t.Errorf("Waiters = %d after a cancelled sleep, want 0", f.Waiters())
+	}
+}
+
+func TestReal(t *testing.T) {
+	c := New()
+
+	start := time.Now()
+	if err := c.Sleep(context.Background(), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Sleep returned after %v", elapsed)
+	}
+
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+}
+
+func TestFrom(t *testing.T) {
+	f := NewFake(epoch)
+	if From(f) != Clock(f) {
+		t.Error("From did not return the Clock")
+	}
+
+	// A Nower reads the time, the timers are real
+	c := From(nower{epoch})
+	if !c.Now().Equal(epoch) {
+		t.Errorf("Now = %v, want %v", c.Now(), epoch)
+	}
+	<-c.NewTimer(time.Millisecond).C()
+}
+
+// nower is a Nower stopped at a time.
+type nower struct {
+	t time.Time
+}
+
+func (n nower) Now() time.Time {
+	return n.t
+}
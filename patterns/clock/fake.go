@@ -0,0 +1,199 @@
+package clock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock moved by hand. Its timers and tickers fire when Add or
+// Set moves the time past them, in the order they are due.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// fakeTimer is a timer or, with a period, a ticker of a Fake.
+type fakeTimer struct {
+	f      *Fake
+	c      chan time.Time
+	at     time.Time
+	period time.Duration
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the time of the clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Add moves the clock forward by d, firing the timers due.
+func (f *Fake) Add(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing the timers due. Setting it back fires
+// nothing.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.waiters) > 0 && !f.waiters[0].at.After(t) {
+		w := f.waiters[0]
+		if f.now.Before(w.at) {
+			f.now = w.at
+		}
+		f.remove(w)
+		w.fire(f.now)
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			f.add(w)
+		}
+	}
+	f.now = t
+}
+
+// Waiters returns the number of timers, tickers and sleeps pending.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until n timers, tickers or sleeps are pending, so a
+// test can move the clock once the code under test is waiting on it.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// NewTimer returns a timer firing once the clock moved d forward. A timer
+// of zero or less fires right away.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1)}
+	f.schedule(t, d)
+	return t
+}
+
+// NewTicker returns a ticker firing every time the clock moved d forward.
+// It panics if d is not positive, like time.NewTicker.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1), period: d}
+	f.schedule(t, d)
+	return fakeTicker{t}
+}
+
+// Sleep waits until the clock moved d forward, or until ctx is done.
+func (f *Fake) Sleep(ctx context.Context, d time.Duration) error {
+	return sleep(ctx, f, d)
+}
+
+// schedule makes t fire d from now. Caller must hold the lock.
+func (f *Fake) schedule(t *fakeTimer, d time.Duration) {
+	if d <= 0 && t.period == 0 {
+		t.fire(f.now)
+		return
+	}
+	t.at = f.now.Add(d)
+	f.add(t)
+}
+
+// add inserts t in due order, after the timers due at the same time.
+// Caller must hold the lock.
+func (f *Fake) add(t *fakeTimer) {
+	i := sort.Search(len(f.waiters), func(i int) bool {
+		return f.waiters[i].at.After(t.at)
+	})
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = t
+	f.cond.Broadcast()
+}
+
+// remove takes t out of the pending timers, reporting whether it was
+// pending. Caller must hold the lock.
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, w := range f.waiters {
+		if w == t {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fire sends now on the channel, dropping it if the last one was not
+// received, like the timers of the time package.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+// drain drops a value fired and not received, so a stopped or reset timer
+// sends no stale time.
+func (t *fakeTimer) drain() {
+	select {
+	case <-t.c:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop stops the timer, reporting whether it was pending.
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+
+	t.drain()
+	return t.f.remove(t)
+}
+
+// Reset makes the timer fire d from now, reporting whether it was pending.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+
+	t.drain()
+	pending := t.f.remove(t)
+	t.f.schedule(t, d)
+	return pending
+}
+
+// fakeTicker is the Ticker view of a periodic fakeTimer.
+type fakeTicker struct {
+	*fakeTimer
+}
+
+// Stop stops the ticker.
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
@@ -0,0 +1,200 @@
+// Package coalesce collapses concurrent identical lookups into one call,
+// optionally caching the result for a short time.
+package coalesce
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// PanicError is the error of a function that panicked. Every caller
+// waiting for the call gets it.
+type PanicError struct {
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("coalesced function panicked: %v", e.Value)
+}
+
+// Clock supplies the current time to a Group.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock uses the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Option configures a Group.
+type Option func(*config)
+
+type config struct {
+	ttl   time.Duration
+	clock Clock
+}
+
+// WithTTL keeps successful results for d, so calls for the same key within
+// d return them without calling fn. The default is zero: nothing is cached
+// and only calls in flight are shared.
+func WithTTL(d time.Duration) Option {
+	return func(c *config) {
+		c.ttl = d
+	}
+}
+
+// WithClock sets the clock used to expire cached results, for tests.
+func WithClock(clock Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// call is one execution of fn for a key.
+type call[V any] struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	// waiters and dups are guarded by the group's lock. val, err and
+	// shared are set before done is closed.
+	waiters int
+	dups    int
+
+	val    V
+	err    error
+	shared bool
+}
+
+// entry is a cached result.
+type entry[V any] struct {
+	val     V
+	expires time.Time
+}
+
+// Group deduplicates calls by key. The zero value is not usable; create
+// one with New.
+type Group[K comparable, V any] struct {
+	cfg config
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+	cache map[K]entry[V]
+}
+
+// New creates a Group.
+func New[K comparable, V any](opts ...Option) *Group[K, V] {
+	cfg := config{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Group[K, V]{
+		cfg:   cfg,
+		calls: make(map[K]*call[V]),
+		cache: make(map[K]entry[V]),
+	}
+}
+
+// Do calls fn for key and returns its result. Callers arriving while a
+// call for key is in flight wait for it instead of calling fn again, and a
+// cached result is returned at once. shared reports whether the result was
+// handed to more than one caller.
+//
+// fn gets a context that keeps the values of ctx but is only cancelled
+// once every caller waiting for it gave up. A caller whose ctx is done
+// returns ctx.Err() at once; callers arriving after everyone gave up start
+// a fresh call.
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if e, ok := g.cache[key]; ok {
+		if g.cfg.clock.Now().Before(e.expires) {
+			g.mu.Unlock()
+			return e.val, nil, true
+		}
+		delete(g.cache, key)
+	}
+
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+		c.dups++
+	} else {
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		g.calls[key] = c
+		go g.run(fctx, key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err, c.shared
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	c.waiters--
+	if c.waiters == 0 {
+		// Nobody wants the result anymore; stop fn and let later
+		// callers start over
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		c.cancel()
+	}
+	g.mu.Unlock()
+
+	var zero V
+	return zero, ctx.Err(), false
+}
+
+// Forget drops the cached result and the call in flight for key, so the
+// next Do calls fn again. Callers already waiting still get the result of
+// the call in flight.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.calls, key)
+	delete(g.cache, key)
+}
+
+// run calls fn, records its result and wakes the waiters.
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(ctx context.Context) (V, error)) {
+	defer c.cancel()
+
+	c.val, c.err = g.call(ctx, fn)
+
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+		if c.err == nil && g.cfg.ttl > 0 {
+			g.cache[key] = entry[V]{val: c.val, expires: g.cfg.clock.Now().Add(g.cfg.ttl)}
+		}
+	}
+	c.shared = c.dups > 0
+	g.mu.Unlock()
+
+	close(c.done)
+}
+
+// call runs fn, turning a panic into a *PanicError.
+func (g *Group[K, V]) call(ctx context.Context, fn func(ctx context.Context) (V, error)) (v V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
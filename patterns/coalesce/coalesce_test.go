@@ -0,0 +1,275 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// waitWaiters waits until n callers wait for the call of key.
+func waitWaiters[K comparable, V any](t *testing.T, g *Group[K, V], key K, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		got := 0
+		if ok {
+			got = c.waiters
+		}
+		g.mu.Unlock()
+		if got == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d waiters", n)
+}
+
+func TestDedup(t *testing.T) {
+	g := New[string, int]()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]int, n)
+	shared := make([]bool, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err, s := g.Do(context.Background(), "key", fn)
+			if err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+			results[i], shared[i] = v, s
+		}(i)
+	}
+
+	waitWaiters(t, g, "key", n)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("fn called %d times, want 1", got)
+	}
+	for i := 0; i < n; i++ {
+		if results[i] != 42 || !shared[i] {
+			t.Errorf("caller %d got %d, shared %v, want 42, true", i, results[i], shared[i])
+		}
+	}
+}
+
+func TestDistinctKeys(t *testing.T) {
+	g := New[int, int]()
+
+	var calls atomic.Int32
+	for i := 0; i < 3; i++ {
+		v, err, shared := g.Do(context.Background(), i, func(ctx context.Context) (int, error) {
+			calls.Add(1)
+			return i * 2, nil
+		})
+		if err != nil || v != i*2 || shared {
+			t.Errorf("Do(%d) = %d, %v, %v", i, v, err, shared)
+		}
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("fn called %d times, want 3", got)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	g := New[string, int](WithTTL(time.Second), WithClock(clock))
+
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	if v, _, shared := g.Do(context.Background(), "key", fn); v != 1 || shared {
+		t.Fatalf("first Do() = %d, shared %v, want 1, false", v, shared)
+	}
+
+	clock.Add(500 * time.Millisecond)
+	if v, _, shared := g.Do(context.Background(), "key", fn); v != 1 || !shared {
+		t.Errorf("cached Do() = %d, shared %v, want 1, true", v, shared)
+	}
+
+	clock.Add(500 * time.Millisecond)
+	if v, _, _ := g.Do(context.Background(), "key", fn); v != 2 {
+		t.Errorf("Do() after TTL = %d, want 2", v)
+	}
+}
+
+func TestErrorsNotCached(t *testing.T) {
+	g := New[string, int](WithTTL(time.Hour))
+
+	errBoom := errors.New("boom")
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		return 0, errBoom
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err, _ := g.Do(context.Background(), "key", fn); !errors.Is(err, errBoom) {
+			t.Errorf("Do() error = %v, want %v", err, errBoom)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("fn called %d times, want 2", got)
+	}
+}
+
+func TestForget(t *testing.T) {
+	g := New[string, int](WithTTL(time.Hour))
+
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	g.Do(context.Background(), "key", fn)
+	g.Forget("key")
+	if v, _, _ := g.Do(context.Background(), "key", fn); v != 2 {
+		t.Errorf("Do() after Forget = %d, want 2", v)
+	}
+}
+
+func TestCancelSomeCallers(t *testing.T) {
+	g := New[string, int]()
+
+	release := make(chan struct{})
+	fnErr := make(chan error, 1)
+	fn := func(ctx context.Context) (int, error) {
+		<-release
+		fnErr <- ctx.Err()
+		return 7, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err, _ := g.Do(ctx, "key", fn)
+		cancelled <- err
+	}()
+	waitWaiters(t, g, "key", 1)
+
+	stayed := make(chan int, 1)
+	go func() {
+		v, _, _ := g.Do(context.Background(), "key", fn)
+		stayed <- v
+	}()
+	waitWaiters(t, g, "key", 2)
+
+	// The caller that started the call gives up; fn keeps running for the
+	// other one
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Do() error = %v, want %v", err, context.Canceled)
+	}
+	waitWaiters(t, g, "key", 1)
+
+	close(release)
+	if v := <-stayed; v != 7 {
+		t.Errorf("remaining caller got %d, want 7", v)
+	}
+	if err := <-fnErr; err != nil {
+		t.Errorf("fn context error = %v while a caller remained", err)
+	}
+}
+
+func TestCancelAllCallers(t *testing.T) {
+	g := New[string, int]()
+
+	var calls atomic.Int32
+	started := make(chan context.Context, 2)
+	fn := func(ctx context.Context) (int, error) {
+		n := calls.Add(1)
+		if n == 1 {
+			started <- ctx
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return 2, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Do(ctx, "key", fn)
+	}()
+	fnCtx := <-started
+
+	cancel()
+	<-done
+
+	// fn is told to stop once nobody waits for it
+	select {
+	case <-fnCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("fn context not cancelled after every caller gave up")
+	}
+
+	// A late joiner gets a fresh call
+	if v, err, _ := g.Do(context.Background(), "key", fn); err != nil || v != 2 {
+		t.Errorf("late Do() = %d, %v, want 2, nil", v, err)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	g := New[string, int]()
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		<-release
+		panic("boom")
+	}
+
+	const n = 3
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err, _ := g.Do(context.Background(), "key", fn)
+			errs <- err
+		}()
+	}
+	waitWaiters(t, g, "key", n)
+	close(release)
+
+	for i := 0; i < n; i++ {
+		var pe *PanicError
+		if err := <-errs; !errors.As(err, &pe) || pe.Value != "boom" {
+			t.Errorf("Do() error = %v, want a *PanicError", err)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+// Package delayqueue releases items onto a channel once they are due,
+// for "run this at time T" work feeding a Consumer.
+package delayqueue
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by Push after Close.
+	ErrClosed = errors.New("delay queue is closed")
+
+	// ErrNoCodec is returned by Encode and Decode when no codec is set.
+	ErrNoCodec = errors.New("delay queue has no codec")
+)
+
+// Clock supplies the current time and timers to a Queue.
+type Clock interface {
+	Now() time.Time
+
+	// At returns a channel receiving the time once t has passed.
+	At(t time.Time) <-chan time.Time
+}
+
+// realClock uses the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) At(t time.Time) <-chan time.Time {
+	return time.After(time.Until(t))
+}
+
+// ID identifies a scheduled item.
+type ID uint64
+
+// Entry is a scheduled item, as returned by Snapshot.
+type Entry struct {
+	ID   ID
+	Item interface{}
+	At   time.Time
+}
+
+// before reports whether e is released before other: earlier time first,
+// then Push order.
+func (e Entry) before(other Entry) bool {
+	if !e.At.Equal(other.At) {
+		return e.At.Before(other.At)
+	}
+	return e.ID < other.ID
+}
+
+// Option configures a Queue.
+type Option func(*Queue)
+
+// WithClock sets the clock used to decide when items are due, for tests.
+func WithClock(c Clock) Option {
+	return func(q *Queue) {
+		q.clock = c
+	}
+}
+
+// WithCodec sets how items are turned into bytes and back, enabling
+// Encode and Decode.
+func WithCodec(encode func(item interface{}) ([]byte, error), decode func(data []byte) (interface{}, error)) Option {
+	return func(q *Queue) {
+		q.encode = encode
+		q.decode = decode
+	}
+}
+
+// Queue holds items until their time, then releases them onto Out in
+// order of their time, FIFO for equal times. Due items wait in order
+// while Out is not being read; none are dropped.
+type Queue struct {
+	clock  Clock
+	encode func(interface{}) ([]byte, error)
+	decode func([]byte) (interface{}, error)
+
+	out chan interface{}
+
+	// wake tells the goroutine the heap changed.
+	wake chan struct{}
+
+	// quit is closed by Close to stop the goroutine.
+	quit      chan struct{}
+	closeOnce sync.Once
+
+	// mu guards the fields below.
+	mu     sync.Mutex
+	items  entryHeap
+	byID   map[ID]*entry
+	nextID ID
+	closed bool
+}
+
+// New creates a Queue and starts its goroutine.
+func New(opts ...Option) *Queue {
+	q := &Queue{
+		clock: realClock{},
+		out:   make(chan interface{}),
+		wake:  make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+		byID:  make(map[ID]*entry),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	go q.run()
+	return q
+}
+
+// Out returns the channel receiving items once they are due. It is closed
+// by Close.
+func (q *Queue) Out() <-chan interface{} {
+	return q.out
+}
+
+// Push schedules item for release at at, and returns its ID. Items whose
+// time has passed are released right away.
+func (q *Queue) Push(item interface{}, at time.Time) (ID, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, ErrClosed
+	}
+
+	q.nextID++
+	q.add(&entry{Entry: Entry{ID: q.nextID, Item: item, At: at}})
+	q.notify()
+	return q.nextID, nil
+}
+
+// Cancel removes the item with the given ID, reporting whether it was
+// still scheduled. An item handed to Out at the same moment may still be
+// delivered.
+func (q *Queue) Cancel(id ID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.byID[id]
+	if !ok {
+		return false
+	}
+	q.remove(e)
+	q.notify()
+	return true
+}
+
+// Len returns the number of scheduled items, including due ones waiting
+// for Out to be read.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// Snapshot returns the scheduled items in release order.
+func (q *Queue) Snapshot() []Entry {
+	q.mu.Lock()
+	entries := make([]Entry, len(q.items))
+	for i, e := range q.items {
+		entries[i] = e.Entry
+	}
+	q.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].before(entries[j])
+	})
+	return entries
+}
+
+// Close stops releasing items and closes Out. Items still scheduled stay
+// available to Snapshot and Encode.
+func (q *Queue) Close() {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		close(q.quit)
+	})
+}
+
+// encodedEntry is the persisted form of an Entry.
+type encodedEntry struct {
+	At   time.Time `json:"at"`
+	Item []byte    `json:"item"`
+}
+
+// Encode writes the scheduled items to w as JSON, using the codec to
+// encode each item. IDs are not kept.
+func (q *Queue) Encode(w io.Writer) error {
+	if q.encode == nil {
+		return ErrNoCodec
+	}
+
+	snapshot := q.Snapshot()
+	encoded := make([]encodedEntry, len(snapshot))
+	for i, e := range snapshot {
+		data, err := q.encode(e.Item)
+		if err != nil {
+			return err
+		}
+		encoded[i] = encodedEntry{At: e.At, Item: data}
+	}
+	return json.NewEncoder(w).Encode(encoded)
+}
+
+// Decode reads items written by Encode from r and schedules them, in
+// addition to the items already scheduled.
+func (q *Queue) Decode(r io.Reader) error {
+	if q.decode == nil {
+		return ErrNoCodec
+	}
+
+	var encoded []encodedEntry
+	if err := json.NewDecoder(r).Decode(&encoded); err != nil {
+		return err
+	}
+	for _, e := range encoded {
+		item, err := q.decode(e.Item)
+		if err != nil {
+			return err
+		}
+		if _, err := q.Push(item, e.At); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run releases due items until Close.
+func (q *Queue) run() {
+	defer close(q.out)
+
+	for {
+		q.mu.Lock()
+		var next *entry
+		if q.items.Len() > 0 {
+			next = q.items[0]
+		}
+		q.mu.Unlock()
+
+		// Nothing scheduled: wait for a Push
+		if next == nil {
+			select {
+			case <-q.wake:
+			case <-q.quit:
+				return
+			}
+			continue
+		}
+
+		// Not due yet: wait for its time or an earlier Push
+		if q.clock.Now().Before(next.At) {
+			select {
+			case <-q.clock.At(next.At):
+			case <-q.wake:
+			case <-q.quit:
+				return
+			}
+			continue
+		}
+
+		// Due: it stays scheduled, in order, until Out takes it
+		select {
+		case q.out <- next.Item:
+			q.mu.Lock()
+			if next.index >= 0 {
+				q.remove(next)
+			}
+			q.mu.Unlock()
+		case <-q.wake:
+		case <-q.quit:
+			return
+		}
+	}
+}
+
+// add schedules e. q.mu must be held.
+func (q *Queue) add(e *entry) {
+	heap.Push(&q.items, e)
+	q.byID[e.ID] = e
+}
+
+// remove unschedules e. q.mu must be held.
+func (q *Queue) remove(e *entry) {
+	heap.Remove(&q.items, e.index)
+	delete(q.byID, e.ID)
+}
+
+// notify wakes the goroutine without blocking.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+type entry struct {
+	Entry
+
+	// index is the entry's position in the heap, or -1 once removed.
+	index int
+}
+
+// entryHeap implements heap.Interface with the earliest entry on top.
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool { return h[i].before(h[j].Entry) }
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,247 @@
+package delayqueue
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) At(t time.Time) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if !c.now.Before(t) {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{at: t, c: ch})
+	return ch
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if c.now.Before(w.at) {
+			kept = append(kept, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = kept
+}
+
+// expect receives the next item from q and checks it is want.
+func expect(t *testing.T, q *Queue, want interface{}) {
+	t.Helper()
+	select {
+	case got := <-q.Out():
+		if got != want {
+			t.Fatalf("released %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%v not released", want)
+	}
+}
+
+// expectNone checks q releases nothing for a while.
+func expectNone(t *testing.T, q *Queue) {
+	t.Helper()
+	select {
+	case got := <-q.Out():
+		t.Fatalf("released %v early", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestReleaseOrder(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	q := New(WithClock(clock))
+	defer q.Close()
+
+	start := clock.Now()
+	q.Push("c", start.Add(3*time.Second))
+	q.Push("a", start.Add(1*time.Second))
+	q.Push("b", start.Add(2*time.Second))
+
+	expectNone(t, q)
+
+	// Each item is released once its time has come, and not before
+	for _, want := range []string{"a", "b", "c"} {
+		clock.Add(999 * time.Millisecond)
+		expectNone(t, q)
+		clock.Add(time.Millisecond)
+		expect(t, q, want)
+	}
+}
+
+func TestEarlierPushPreempts(t *testing.T) {
+	clock := newFakeClock()
+	q := New(WithClock(clock))
+	defer q.Close()
+
+	q.Push("late", clock.Now().Add(time.Hour))
+	expectNone(t, q)
+
+	// The goroutine is waiting for the hour, but an earlier item wins
+	q.Push("soon", clock.Now().Add(time.Second))
+	clock.Add(time.Second)
+	expect(t, q, "soon")
+}
+
+func TestBackedUpConsumer(t *testing.T) {
+	clock := newFakeClock()
+	q := New(WithClock(clock))
+	defer q.Close()
+
+	// All become due while nobody reads Out
+	start := clock.Now()
+	for i := 9; i >= 0; i-- {
+		q.Push(i, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	q.Push("now", start)
+	clock.Add(time.Minute)
+	time.Sleep(10 * time.Millisecond)
+
+	// None are dropped, and they come out in order
+	expect(t, q, 0)
+	expect(t, q, "now")
+	for i := 1; i < 10; i++ {
+		expect(t, q, i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := q.Len(); n != 0 {
+		t.Errorf("Len() = %d, want 0", n)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	clock := newFakeClock()
+	q := New(WithClock(clock))
+	defer q.Close()
+
+	id, _ := q.Push("cancelled", clock.Now().Add(time.Second))
+	q.Push("kept", clock.Now().Add(2*time.Second))
+
+	if !q.Cancel(id) {
+		t.Fatal("Cancel() = false, want true")
+	}
+	if q.Cancel(id) {
+		t.Error("second Cancel() = true, want false")
+	}
+
+	clock.Add(2 * time.Second)
+	expect(t, q, "kept")
+}
+
+func TestRealClock(t *testing.T) {
+	q := New()
+	defer q.Close()
+
+	start := time.Now()
+	q.Push("x", start.Add(30*time.Millisecond))
+	expect(t, q, "x")
+
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("released after %v, want at least 30ms", elapsed)
+	}
+}
+
+func TestClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	q := New()
+	q.Push("x", time.Now().Add(time.Hour))
+	q.Close()
+
+	if _, ok := <-q.Out(); ok {
+		t.Error("Out should be closed")
+	}
+	if _, err := q.Push("y", time.Now()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Push() = %v, want %v", err, ErrClosed)
+	}
+	if n := len(q.Snapshot()); n != 1 {
+		t.Errorf("Snapshot() has %d items, want 1", n)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	codec := WithCodec(
+		func(item interface{}) ([]byte, error) {
+			return []byte(strconv.Itoa(item.(int))), nil
+		},
+		func(data []byte) (interface{}, error) {
+			return strconv.Atoi(string(data))
+		},
+	)
+
+	clock := newFakeClock()
+	start := clock.Now()
+
+	q := New(WithClock(clock), codec)
+	q.Push(2, start.Add(2*time.Second))
+	q.Push(1, start.Add(time.Second))
+
+	var buf bytes.Buffer
+	if err := q.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	restored := New(WithClock(clock), codec)
+	defer restored.Close()
+	if err := restored.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := restored.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Item != 1 || !snapshot[1].At.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("Snapshot() = %+v", snapshot)
+	}
+
+	clock.Add(2 * time.Second)
+	expect(t, restored, 1)
+	expect(t, restored, 2)
+}
+
+func TestNoCodec(t *testing.T) {
+	q := New()
+	defer q.Close()
+
+	if err := q.Encode(&bytes.Buffer{}); !errors.Is(err, ErrNoCodec) {
+		t.Errorf("Encode() = %v, want %v", err, ErrNoCodec)
+	}
+}
@@ -0,0 +1,277 @@
+// Package distlock implements a distributed lock on Redis, using
+// connections from a redispool.RedisConnectionPool.
+package distlock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+	"github.com/go-redis/redis"
+)
+
+var (
+	// ErrNotObtained is returned by TryAcquire when the lock is held by
+	// someone else.
+	ErrNotObtained = errors.New("lock not obtained")
+
+	// ErrNotHeld is returned by Refresh and Release when the lock is no
+	// longer held with this lock's token, because it expired and may
+	// have been taken by someone else.
+	ErrNotHeld = errors.New("lock not held")
+)
+
+// refreshScript extends the TTL only if the key still holds our token.
+const refreshScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`
+
+// releaseScript deletes the key only if it still holds our token.
+const releaseScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`
+
+// Option configures a Locker.
+type Option func(*Locker)
+
+// WithRetryInterval sets how often Acquire retries a held lock.
+// The default is 50ms, also kept for an interval that is not positive.
+func WithRetryInterval(d time.Duration) Option {
+	return func(l *Locker) {
+		if d > 0 {
+			l.retryInterval = d
+		}
+	}
+}
+
+// Locker acquires locks on Redis.
+type Locker struct {
+	pool          *redispool.RedisConnectionPool
+	retryInterval time.Duration
+}
+
+// New creates a Locker using connections from pool.
+func New(pool *redispool.RedisConnectionPool, opts ...Option) *Locker {
+	l := &Locker{
+		pool:          pool,
+		retryInterval: 50 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Acquire takes the lock on key for ttl, waiting while someone else holds
+// it until ctx is done.
+func (l *Locker) Acquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := l.TryAcquire(ctx, key, ttl)
+		if !errors.Is(err, ErrNotObtained) {
+			return lock, err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryAcquire takes the lock on key for ttl, returning ErrNotObtained at
+// once if someone else holds it.
+func (l *Locker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// The TTL runs on Redis from about when the command is sent
+	sent := time.Now()
+	var ok bool
+	err = l.do(ctx, func(c *redis.Client) error {
+		var err error
+		ok, err = c.SetNX(key, token, ttl).Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotObtained
+	}
+
+	lock := &Lock{
+		locker:   l,
+		key:      key,
+		token:    token,
+		ttl:      ttl,
+		lost:     make(chan struct{}),
+		released: make(chan struct{}),
+	}
+
+	// Report the lock lost if it is not refreshed before the TTL runs out
+	lock.watchdog = time.AfterFunc(lock.remaining(sent), lock.markLost)
+
+	return lock, nil
+}
+
+// do runs fn with a pooled connection.
+func (l *Locker) do(ctx context.Context, fn func(c *redis.Client) error) error {
+	return l.pool.Do(ctx, func(conn *redispool.RedisConn) error {
+		return fn(conn.Conn.WithContext(ctx))
+	})
+}
+
+// Lock is a held distributed lock.
+type Lock struct {
+	locker *Locker
+	key    string
+	token  string
+	ttl    time.Duration
+
+	// watchdog fires when the TTL runs out without a refresh.
+	watchdog *time.Timer
+
+	// lost is closed when the lock is known or presumed lost.
+	lost     chan struct{}
+	lostOnce sync.Once
+
+	// released is closed by Release to stop the auto-refresh goroutine.
+	released    chan struct{}
+	releaseOnce sync.Once
+}
+
+// Key returns the locked key.
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Lost returns a channel closed when the lock is lost: a refresh found
+// the lock taken over, or the TTL ran out without a successful refresh,
+// for example because the connection was lost. Work protected by the
+// lock should stop when it is closed.
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+// Refresh extends the lock's TTL. It returns ErrNotHeld, and marks the
+// lock lost, if the lock is no longer held.
+func (lk *Lock) Refresh(ctx context.Context) error {
+	sent := time.Now()
+	var n int64
+	err := lk.locker.do(ctx, func(c *redis.Client) error {
+		var err error
+		n, err = c.Eval(refreshScript, []string{lk.key}, lk.token, lk.ttl.Milliseconds()).Int64()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		lk.markLost()
+		return ErrNotHeld
+	}
+
+	// Stop refreshes from reviving a lock already reported lost
+	select {
+	case <-lk.lost:
+		return ErrNotHeld
+	default:
+		lk.watchdog.Reset(lk.remaining(sent))
+		return nil
+	}
+}
+
+// AutoRefresh starts a goroutine refreshing the lock every third of its
+// TTL until Release is called or ctx is done. Failed refreshes are retried
+// on the next tick; the lock is reported lost once a refresh finds it
+// taken over or the TTL runs out.
+func (lk *Lock) AutoRefresh(ctx context.Context) {
+	interval := lk.ttl / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if errors.Is(lk.Refresh(ctx), ErrNotHeld) {
+					return
+				}
+			case <-lk.released:
+				return
+			case <-lk.lost:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Release frees the lock if it is still held with this lock's token, and
+// stops the auto-refresh goroutine. It returns ErrNotHeld if the lock was
+// already lost, leaving whoever holds it now untouched.
+func (lk *Lock) Release(ctx context.Context) error {
+	lk.releaseOnce.Do(func() {
+		close(lk.released)
+		lk.watchdog.Stop()
+	})
+
+	var n int64
+	err := lk.locker.do(ctx, func(c *redis.Client) error {
+		var err error
+		n, err = c.Eval(releaseScript, []string{lk.key}, lk.token).Int64()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// remaining returns how long the TTL set by a command sent at sent still
+// runs, not counting the round trip after it.
+func (lk *Lock) remaining(sent time.Time) time.Duration {
+	d := lk.ttl - time.Since(sent)
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// markLost closes lost, once.
+func (lk *Lock) markLost() {
+	lk.lostOnce.Do(func() {
+		close(lk.lost)
+	})
+}
+
+// newToken returns a random token identifying a lock holder.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,284 @@
+package distlock
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+// newLocker starts a miniredis server and returns a Locker on a pool
+// connected to it.
+func newLocker(t *testing.T) (*Locker, *miniredis.Miniredis) {
+	return newSlowLocker(t, new(atomic.Int64))
+}
+
+// slowConn waits delay nanoseconds after sending each command, before
+// its reply is read, like a slow network on the way back.
+type slowConn struct {
+	net.Conn
+	delay *atomic.Int64
+}
+
+func (c slowConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	time.Sleep(time.Duration(c.delay.Load()))
+	return n, err
+}
+
+// newSlowLocker is newLocker with connections waiting delay after each
+// command.
+func newSlowLocker(t *testing.T, delay *atomic.Int64) (*Locker, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+
+	pool := redispool.New(2, 1, time.Second)
+	pool.OpenConnection = func() (*redispool.RedisConn, error) {
+		return &redispool.RedisConn{
+			Conn: redis.NewClient(&redis.Options{
+				Addr:       addr,
+				MaxRetries: 0,
+				Dialer: func() (net.Conn, error) {
+					conn, err := net.Dial("tcp", addr)
+					if err != nil {
+						return nil, err
+					}
+					return slowConn{Conn: conn, delay: delay}, nil
+				},
+			}),
+			TimeOut: time.Hour,
+		}, nil
+	}
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	return New(pool, WithRetryInterval(5*time.Millisecond)), mr
+}
+
+func TestAcquireRelease(t *testing.T) {
+	l, mr := newLocker(t)
+	ctx := context.Background()
+
+	lock, err := l.TryAcquire(ctx, "job", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("job"); ttl != time.Second {
+		t.Errorf("TTL = %v, want 1s", ttl)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release() = %v", err)
+	}
+	if mr.Exists("job") {
+		t.Error("key should be deleted")
+	}
+}
+
+func TestContention(t *testing.T) {
+	l, _ := newLocker(t)
+	ctx := context.Background()
+
+	first, err := l.TryAcquire(ctx, "job", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second locker cannot take it while held
+	if _, err := l.TryAcquire(ctx, "job", time.Second); !errors.Is(err, ErrNotObtained) {
+		t.Errorf("TryAcquire() = %v, want %v", err, ErrNotObtained)
+	}
+
+	// Acquire waits for the release
+	got := make(chan *Lock)
+	go func() {
+		lock, err := l.Acquire(ctx, "job", time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- lock
+	}()
+
+	select {
+	case <-got:
+		t.Fatal("Acquire should wait while the lock is held")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	first.Release(ctx)
+	second := <-got
+	if second == nil || second.token == first.token {
+		t.Fatal("second locker should hold the lock with its own token")
+	}
+	second.Release(ctx)
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	l, _ := newLocker(t)
+
+	l.TryAcquire(context.Background(), "job", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "job", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReleaseTokenMismatch(t *testing.T) {
+	l, mr := newLocker(t)
+	ctx := context.Background()
+
+	lock, _ := l.TryAcquire(ctx, "job", time.Second)
+
+	// The lock expired and someone else took it
+	mr.Set("job", "someone-else")
+
+	if err := lock.Release(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("Release() = %v, want %v", err, ErrNotHeld)
+	}
+	if v, _ := mr.Get("job"); v != "someone-else" {
+		t.Errorf("key = %q, the other holder's lock should be untouched", v)
+	}
+
+	// Refresh notices too, and reports the lock lost
+	if err := lock.Refresh(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("Refresh() = %v, want %v", err, ErrNotHeld)
+	}
+	select {
+	case <-lock.Lost():
+	default:
+		t.Error("Lost should be closed")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	l, mr := newLocker(t)
+	ctx := context.Background()
+
+	lock, _ := l.TryAcquire(ctx, "job", time.Second)
+	mr.FastForward(800 * time.Millisecond)
+
+	if err := lock.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("job"); ttl != time.Second {
+		t.Errorf("TTL = %v, want 1s after refresh", ttl)
+	}
+	lock.Release(ctx)
+}
+
+func TestAutoRefresh(t *testing.T) {
+	l, mr := newLocker(t)
+	ctx := context.Background()
+
+	lock, _ := l.TryAcquire(ctx, "job", 60*time.Millisecond)
+	lock.AutoRefresh(ctx)
+
+	// Held well past its TTL
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-lock.Lost():
+		t.Fatal("lock should not be lost while refreshed")
+	default:
+	}
+	if !mr.Exists("job") {
+		t.Fatal("key should still exist")
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Errorf("Release() = %v", err)
+	}
+}
+
+func TestLostOnExpiry(t *testing.T) {
+	l, _ := newLocker(t)
+
+	// Not refreshed, so the TTL runs out
+	lock, _ := l.TryAcquire(context.Background(), "job", 20*time.Millisecond)
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost should be closed after the TTL")
+	}
+}
+
+func TestLostConnection(t *testing.T) {
+	l, mr := newLocker(t)
+	ctx := context.Background()
+
+	lock, _ := l.TryAcquire(ctx, "job", 60*time.Millisecond)
+	lock.AutoRefresh(ctx)
+
+	// Refreshes fail once the server is gone
+	mr.Close()
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost should be closed once refreshes fail for a TTL")
+	}
+}
+
+func TestLostCountsFromSend(t *testing.T) {
+	delay := new(atomic.Int64)
+	l, _ := newSlowLocker(t, delay)
+	ctx := context.Background()
+	const ttl = 100 * time.Millisecond
+
+	// The reply comes 60ms after Redis started the TTL, and Lost still
+	// fires once the TTL ran out on Redis, not a round trip later
+	delay.Store(int64(60 * time.Millisecond))
+	start := time.Now()
+	lock, err := l.TryAcquire(ctx, "job", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-lock.Lost()
+	if elapsed := time.Since(start); elapsed > ttl+40*time.Millisecond {
+		t.Errorf("Lost after %v, want about %v", elapsed, ttl)
+	}
+
+	// The same for a refresh
+	delay.Store(0)
+	lock, err = l.TryAcquire(ctx, "job2", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delay.Store(int64(60 * time.Millisecond))
+	start = time.Now()
+	if err := lock.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-lock.Lost()
+	if elapsed := time.Since(start); elapsed > ttl+40*time.Millisecond {
+		t.Errorf("Lost after %v, want about %v", elapsed, ttl)
+	}
+}
+
+func TestRetryIntervalDefault(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		l := New(nil, WithRetryInterval(d))
+		if l.retryInterval != 50*time.Millisecond {
+			t.Errorf("WithRetryInterval(%v) set %v, want the 50ms default", d, l.retryInterval)
+		}
+	}
+
+	// Acquire retries a held lock instead of panicking
+	l, _ := newLocker(t)
+	WithRetryInterval(0)(l)
+	l.TryAcquire(context.Background(), "job", time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "job", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
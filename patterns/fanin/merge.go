@@ -0,0 +1,81 @@
+// Package fanin merges several channels into one.
+package fanin
+
+import (
+	"context"
+	"sync"
+)
+
+// Labeled is a value tagged with the index of the input it came from.
+type Labeled[T any] struct {
+
+	// Value is the value received from the input.
+	Value T
+
+	// Source is the index of the input in the arguments to MergeWithLabels.
+	Source int
+}
+
+// Merge forwards the values of all inputs to a single output channel.
+//
+// The output is closed once every input is closed, or once ctx is
+// cancelled, whichever comes first. Cancelling ctx stops all forwarding
+// goroutines even if some inputs are never closed, so nothing leaks.
+// Values received from an input but not yet forwarded when ctx is
+// cancelled are dropped.
+func Merge[T any](ctx context.Context, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+
+	forward(ctx, ins, out, func(_ int, v T) T { return v })
+
+	return out
+}
+
+// MergeWithLabels works like Merge, but tags each value with the index of
+// the input it came from, which helps when debugging.
+func MergeWithLabels[T any](ctx context.Context, ins ...<-chan T) <-chan Labeled[T] {
+	out := make(chan Labeled[T])
+
+	forward(ctx, ins, out, func(i int, v T) Labeled[T] {
+		return Labeled[T]{Value: v, Source: i}
+	})
+
+	return out
+}
+
+// forward starts a goroutine per input copying its values, converted by
+// wrap, to out, and closes out once they are all done.
+func forward[T, U any](ctx context.Context, ins []<-chan T, out chan<- U, wrap func(int, T) U) {
+	var wg sync.WaitGroup
+
+	for i, in := range ins {
+		wg.Add(1)
+		go func(i int, in <-chan T) {
+			defer wg.Done()
+
+			for {
+				// Check for cancellation on both the receive and the send,
+				// so neither a silent input nor a slow reader can block
+				select {
+				case v, ok := <-in:
+					if !ok {
+						return
+					}
+					select {
+					case out <- wrap(i, v):
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i, in)
+	}
+
+	// Close the output once every forwarder has stopped
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+}
@@ -0,0 +1,125 @@
+package fanin
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// produce sends values to a new channel, pausing between sends, and
+// closes it when done.
+func produce(values []int, pause time.Duration) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for _, v := range values {
+			time.Sleep(pause)
+			ch <- v
+		}
+	}()
+	return ch
+}
+
+func TestMerge(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Inputs with uneven rates and lengths
+	out := Merge(context.Background(),
+		produce([]int{1, 2, 3}, time.Millisecond),
+		produce([]int{4}, 5*time.Millisecond),
+		produce(nil, 0),
+		produce([]int{5, 6, 7, 8, 9}, 0),
+	)
+
+	var got []int
+	for v := range out {
+		got = append(got, v)
+	}
+
+	sort.Ints(got)
+	want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMergeNoInputs(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	if _, ok := <-Merge[int](context.Background()); ok {
+		t.Error("output should be closed")
+	}
+}
+
+func TestMergeCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// One input never closes, the other never stops sending
+	silent := make(chan int)
+	busy := make(chan int)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case busy <- 1:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer close(stop)
+
+	out := Merge(ctx, silent, busy)
+	<-out
+
+	// The output is closed even though neither input is
+	cancel()
+	for range out {
+	}
+}
+
+func TestMergeCancelSlowReader(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Nobody reads the output, so the forwarder blocks on the send
+	in := make(chan int, 1)
+	in <- 1
+	out := Merge(ctx, in)
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	for range out {
+	}
+}
+
+func TestMergeWithLabels(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	out := MergeWithLabels(context.Background(),
+		produce([]int{10, 11}, 0),
+		produce([]int{20}, time.Millisecond),
+	)
+
+	counts := map[int]int{}
+	for l := range out {
+		if l.Value/10 != l.Source+1 {
+			t.Errorf("value %d labeled with source %d", l.Value, l.Source)
+		}
+		counts[l.Source]++
+	}
+	if counts[0] != 2 || counts[1] != 1 {
+		t.Errorf("counts = %v, want map[0:2 1:1]", counts)
+	}
+}
@@ -0,0 +1,135 @@
+package fanin
+
+import (
+	"context"
+	"reflect"
+)
+
+// OrderedMerge forwards the values of all inputs to a single output
+// channel, like Merge, but from one goroutine taking turns among the
+// inputs: values from the same input keep their order, and inputs that
+// are ready are served round-robin rather than by whichever goroutine
+// wins a race. It takes one value per turn; see OrderedMergeBatch.
+func OrderedMerge[T any](ctx context.Context, ins ...<-chan T) <-chan T {
+	return OrderedMergeBatch(ctx, 1, ins...)
+}
+
+// OrderedMergeBatch works like OrderedMerge, but takes up to batch values
+// from an input per turn, as long as it has them ready, which makes
+// switching cheaper when inputs are busy.
+//
+// The output is closed once every input is closed, or once ctx is
+// cancelled.
+func OrderedMergeBatch[T any](ctx context.Context, batch int, ins ...<-chan T) <-chan T {
+	if batch < 1 {
+		batch = 1
+	}
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+
+		send := func(v T) bool {
+			select {
+			case out <- v:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		open := append([]<-chan T(nil), ins...)
+		cur := 0
+
+		// idle counts the inputs in a row found with nothing ready
+		idle := 0
+
+		for len(open) > 0 {
+			n := 0
+			closed := false
+
+			// Nothing is ready: sleep until an input is, and give it the turn
+			if idle == len(open) {
+				i, v, ok, err := receiveAny(ctx, open)
+				if err != nil {
+					return
+				}
+				cur, idle = i, 0
+				if !ok {
+					closed = true
+				} else if !send(v) {
+					return
+				} else {
+					n++
+				}
+			}
+
+			for !closed && n < batch {
+				v, ok, ready := poll(open[cur])
+				if !ready {
+					break
+				}
+				if !ok {
+					closed = true
+					break
+				}
+				if !send(v) {
+					return
+				}
+				n++
+			}
+
+			if closed {
+				open = append(open[:cur], open[cur+1:]...)
+				idle = 0
+				if cur == len(open) {
+					cur = 0
+				}
+				continue
+			}
+
+			if n == 0 {
+				idle++
+			} else {
+				idle = 0
+			}
+			cur = (cur + 1) % len(open)
+		}
+	}()
+
+	return out
+}
+
+// poll receives from in without waiting. ready reports whether in had a
+// value or was closed, and ok whether a value was received.
+func poll[T any](in <-chan T) (v T, ok, ready bool) {
+	select {
+	case v, ok = <-in:
+		return v, ok, true
+	default:
+		return v, false, false
+	}
+}
+
+// receiveAny waits until one of ins has a value or is closed, and returns
+// its index, the value, and whether one was received. It returns the
+// context error if ctx is done first.
+func receiveAny[T any](ctx context.Context, ins []<-chan T) (int, T, bool, error) {
+	cases := make([]reflect.SelectCase, len(ins)+1)
+	for i, in := range ins {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(in)}
+	}
+	cases[len(ins)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
+	var zero T
+	i, v, ok := reflect.Select(cases)
+	if i == len(ins) {
+		return 0, zero, false, ctx.Err()
+	}
+	if !ok {
+		return i, zero, false, nil
+	}
+	// A nil interface value does not assert to T, leave it zero
+	val, _ := v.Interface().(T)
+	return i, val, true, nil
+}
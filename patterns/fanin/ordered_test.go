@@ -0,0 +1,187 @@
+package fanin
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// tagged is a value tagged with its source and its position there.
+type tagged struct {
+	source, seq int
+}
+
+// filled returns a closed channel holding n values of source.
+func filled(source, n int) <-chan tagged {
+	ch := make(chan tagged, n)
+	for i := 0; i < n; i++ {
+		ch <- tagged{source, i}
+	}
+	close(ch)
+	return ch
+}
+
+// checkOrder fails unless the values of every source are in order and
+// complete.
+func checkOrder(t *testing.T, got []tagged, counts map[int]int) {
+	t.Helper()
+	next := make(map[int]int)
+	for _, v := range got {
+		if v.seq != next[v.source] {
+			t.Fatalf("source %d: got seq %d, want %d", v.source, v.seq, next[v.source])
+		}
+		next[v.source]++
+	}
+	for source, n := range counts {
+		if next[source] != n {
+			t.Errorf("source %d: got %d values, want %d", source, next[source], n)
+		}
+	}
+}
+
+func TestOrderedMergeRoundRobin(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	out := OrderedMerge(context.Background(), filled(0, 5), filled(1, 3), filled(2, 5))
+
+	var got []tagged
+	for v := range out {
+		got = append(got, v)
+	}
+	checkOrder(t, got, map[int]int{0: 5, 1: 3, 2: 5})
+
+	// Ready sources take turns; a closed one leaves the rotation
+	want := []int{0, 1, 2, 0, 1, 2, 0, 1, 2, 0, 2, 0, 2}
+	for i, v := range got {
+		if v.source != want[i] {
+			t.Fatalf("sources = %v, want %v", sources(got), want)
+		}
+	}
+}
+
+func TestOrderedMergeBatch(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	out := OrderedMergeBatch(context.Background(), 3, filled(0, 7), filled(1, 4))
+
+	var got []tagged
+	for v := range out {
+		got = append(got, v)
+	}
+	checkOrder(t, got, map[int]int{0: 7, 1: 4})
+
+	want := []int{0, 0, 0, 1, 1, 1, 0, 0, 0, 1, 0}
+	for i, v := range got {
+		if v.source != want[i] {
+			t.Fatalf("sources = %v, want %v", sources(got), want)
+		}
+	}
+}
+
+func TestOrderedMergeFairness(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Sources that are always ready, fed by their own goroutines
+	const n = 2000
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ins := make([]<-chan tagged, 3)
+	for s := range ins {
+		ch := make(chan tagged, 16)
+		ins[s] = ch
+		go func(s int) {
+			defer close(ch)
+			for i := 0; i < n; i++ {
+				select {
+				case ch <- tagged{s, i}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(s)
+	}
+
+	var got []tagged
+	for v := range OrderedMerge(ctx, ins...) {
+		got = append(got, v)
+	}
+	checkOrder(t, got, map[int]int{0: n, 1: n, 2: n})
+
+	// While all sources are busy, each gets about a third of the output
+	counts := make(map[int]int)
+	for _, v := range got[:n] {
+		counts[v.source]++
+	}
+	for s := 0; s < 3; s++ {
+		if counts[s] < n/5 {
+			t.Errorf("source %d got %d of the first %d values, want about a third", s, counts[s], n)
+		}
+	}
+}
+
+func TestOrderedMergeSlowSource(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// The merge waits for a source that is not ready yet
+	slow := make(chan tagged)
+	out := OrderedMerge(context.Background(), filled(0, 2), slow)
+
+	var got []tagged
+	for i := 0; i < 2; i++ {
+		got = append(got, <-out)
+	}
+	slow <- tagged{1, 0}
+	got = append(got, <-out)
+	close(slow)
+	if _, ok := <-out; ok {
+		t.Error("output should be closed")
+	}
+	checkOrder(t, got, map[int]int{0: 2, 1: 1})
+}
+
+func TestOrderedMergeCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// One input never closes, the other is never read to the end
+	silent := make(chan tagged)
+	out := OrderedMerge(ctx, silent, filled(1, 10))
+	<-out
+	cancel()
+
+	for range out {
+	}
+}
+
+func TestOrderedMergeNoInputs(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	if _, ok := <-OrderedMerge[int](context.Background()); ok {
+		t.Error("output should be closed")
+	}
+}
+
+func TestOrderedMergeNilInterface(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan error)
+	out := OrderedMerge(context.Background(), (<-chan error)(in))
+	go func() {
+		in <- nil
+		close(in)
+	}()
+	if err := <-out; err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func sources(vs []tagged) []int {
+	s := make([]int, len(vs))
+	for i, v := range vs {
+		s[i] = v.source
+	}
+	return s
+}
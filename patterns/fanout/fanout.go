@@ -0,0 +1,136 @@
+// Package fanout splits one channel into several.
+package fanout
+
+import "context"
+
+// Option configures Broadcast.
+type Option func(*config)
+
+type config struct {
+	drop bool
+}
+
+// WithDrop makes Broadcast drop an item for an output whose buffer is
+// full instead of waiting for it, so a slow output never holds up the
+// others.
+func WithDrop() Option {
+	return func(c *config) {
+		c.drop = true
+	}
+}
+
+// Broadcast copies every item of in to n outputs, each buffered with buf
+// items. By default a slow output applies backpressure to all of them;
+// see WithDrop.
+//
+// The outputs are closed when in is closed or ctx is cancelled. Cancelling
+// ctx stops the broadcaster even if an output is never read.
+func Broadcast[T any](ctx context.Context, in <-chan T, n, buf int, opts ...Option) []<-chan T {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	outs := makeOutputs[T](n, buf)
+
+	go func() {
+		defer closeAll(outs)
+
+		for {
+			v, ok := receive(ctx, in)
+			if !ok {
+				return
+			}
+
+			for _, out := range outs {
+				if c.drop {
+					// Skip outputs with a full buffer
+					select {
+					case out <- v:
+					default:
+					}
+					continue
+				}
+
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return readOnly(outs)
+}
+
+// Split distributes the items of in over n outputs round-robin, so each
+// item goes to exactly one output. A slow output holds up the others when
+// its turn comes.
+//
+// The outputs are closed when in is closed or ctx is cancelled. Cancelling
+// ctx stops the splitter even if an output is never read.
+func Split[T any](ctx context.Context, in <-chan T, n int) []<-chan T {
+	outs := makeOutputs[T](n, 0)
+
+	go func() {
+		defer closeAll(outs)
+
+		for i := 0; ; i = (i + 1) % len(outs) {
+			v, ok := receive(ctx, in)
+			if !ok {
+				return
+			}
+
+			select {
+			case outs[i] <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return readOnly(outs)
+}
+
+// receive reads the next item of in. It returns false if in is closed or
+// ctx is cancelled.
+func receive[T any](ctx context.Context, in <-chan T) (T, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// makeOutputs creates n output channels, at least one.
+func makeOutputs[T any](n, buf int) []chan T {
+	if n < 1 {
+		n = 1
+	}
+	if buf < 0 {
+		buf = 0
+	}
+
+	outs := make([]chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T, buf)
+	}
+	return outs
+}
+
+func closeAll[T any](outs []chan T) {
+	for _, out := range outs {
+		close(out)
+	}
+}
+
+func readOnly[T any](outs []chan T) []<-chan T {
+	ros := make([]<-chan T, len(outs))
+	for i, out := range outs {
+		ros[i] = out
+	}
+	return ros
+}
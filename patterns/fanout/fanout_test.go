@@ -0,0 +1,143 @@
+package fanout
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// source sends 0..n-1 to a new channel and closes it.
+func source(n int) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+	}()
+	return ch
+}
+
+// drain reads every output concurrently and returns what each received.
+func drain(outs []<-chan int) [][]int {
+	got := make([][]int, len(outs))
+
+	var wg sync.WaitGroup
+	for i, out := range outs {
+		wg.Add(1)
+		go func(i int, out <-chan int) {
+			defer wg.Done()
+			for v := range out {
+				got[i] = append(got[i], v)
+			}
+		}(i, out)
+	}
+	wg.Wait()
+
+	return got
+}
+
+func TestBroadcast(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	outs := Broadcast(context.Background(), source(100), 3, 0)
+
+	// Every output receives every item, in order
+	for i, got := range drain(outs) {
+		if len(got) != 100 {
+			t.Fatalf("output %d: got %d items, want 100", i, len(got))
+		}
+		for j, v := range got {
+			if v != j {
+				t.Fatalf("output %d: item %d = %d", i, j, v)
+			}
+		}
+	}
+}
+
+func TestBroadcastDrop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan int)
+	outs := Broadcast(context.Background(), in, 2, 5, WithDrop())
+
+	// Only the first output is read; the second fills up and drops
+	var fast int
+	for i := 0; i < 50; i++ {
+		in <- i
+		if v := <-outs[0]; v != i {
+			t.Fatalf("fast output: got %d, want %d", v, i)
+		}
+		fast++
+	}
+	close(in)
+	for range outs[0] {
+		fast++
+	}
+
+	var slow int
+	for range outs[1] {
+		slow++
+	}
+
+	if fast != 50 {
+		t.Errorf("fast output: got %d items, want 50", fast)
+	}
+	if slow != 5 {
+		t.Errorf("slow output: got %d items, want 5", slow)
+	}
+}
+
+func TestBroadcastCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int, 1)
+	in <- 1
+
+	// Nobody reads the outputs, so the broadcaster is stuck sending
+	outs := Broadcast(ctx, in, 2, 0)
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	for _, out := range outs {
+		for range out {
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	outs := Split(context.Background(), source(99), 3)
+
+	// Each output gets every third item
+	for i, got := range drain(outs) {
+		if len(got) != 33 {
+			t.Fatalf("output %d: got %d items, want 33", i, len(got))
+		}
+		for j, v := range got {
+			if v != j*3+i {
+				t.Fatalf("output %d: item %d = %d, want %d", i, j, v, j*3+i)
+			}
+		}
+	}
+}
+
+func TestSplitCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The input never closes
+	outs := Split(ctx, make(chan int), 2)
+
+	cancel()
+	for _, out := range outs {
+		for range out {
+		}
+	}
+}
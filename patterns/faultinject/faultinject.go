@@ -0,0 +1,172 @@
+// Package faultinject wraps the pools, limiters and consume functions of
+// this repository to inject latency, errors, rejections and panics, so
+// tests can exercise failure handling without depending on timing. Faults
+// follow a Schedule of rules evaluated on each call; random rules draw
+// from a seeded source, so a seed always gives the same faults.
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjected is the error of faults made with Reject.
+var ErrInjected = errors.New("injected fault")
+
+// Fault is what happens to one call: it is delayed by Delay, then panics
+// with Panic if not nil, then fails with Err if not nil. The zero Fault
+// lets the call through.
+type Fault struct {
+	Delay time.Duration
+	Err   error
+	Panic interface{}
+}
+
+// Delay returns a fault delaying the call by d.
+func Delay(d time.Duration) Fault {
+	return Fault{Delay: d}
+}
+
+// Fail returns a fault failing the call with err.
+func Fail(err error) Fault {
+	return Fault{Err: err}
+}
+
+// Reject returns a fault failing the call with ErrInjected.
+func Reject() Fault {
+	return Fault{Err: ErrInjected}
+}
+
+// Panic returns a fault making the call panic with v.
+func Panic(v interface{}) Fault {
+	return Fault{Panic: v}
+}
+
+// IsZero reports whether f lets the call through.
+func (f Fault) IsZero() bool {
+	return f.Delay == 0 && f.Err == nil && f.Panic == nil
+}
+
+// apply delays the caller, panics or returns the error as f says. The
+// delay ends early with the context error if ctx is done.
+func (f Fault) apply(ctx context.Context) error {
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if f.Panic != nil {
+		panic(f.Panic)
+	}
+	return f.Err
+}
+
+// Rule decides the fault of a call, given its number, counted from 1, and
+// the schedule's random source. It reports false to leave the call to the
+// next rule.
+type Rule func(call uint64, rng *rand.Rand) (Fault, bool)
+
+// Every injects f into every nth call.
+func Every(n uint64, f Fault) Rule {
+	return func(call uint64, _ *rand.Rand) (Fault, bool) {
+		return f, n > 0 && call%n == 0
+	}
+}
+
+// Burst injects f into length calls in a row, at the start of every
+// period calls.
+func Burst(period, length uint64, f Fault) Rule {
+	return func(call uint64, _ *rand.Rand) (Fault, bool) {
+		return f, period > 0 && (call-1)%period < length
+	}
+}
+
+// After injects f into every call after the first n.
+func After(n uint64, f Fault) Rule {
+	return func(call uint64, _ *rand.Rand) (Fault, bool) {
+		return f, call > n
+	}
+}
+
+// Chance injects f into calls with probability p.
+func Chance(p float64, f Fault) Rule {
+	return func(_ uint64, rng *rand.Rand) (Fault, bool) {
+		return f, rng.Float64() < p
+	}
+}
+
+// Script injects faults[i] into call i+1, and nothing after the script
+// has run out.
+func Script(faults ...Fault) Rule {
+	return func(call uint64, _ *rand.Rand) (Fault, bool) {
+		if call > uint64(len(faults)) {
+			return Fault{}, false
+		}
+		return faults[call-1], true
+	}
+}
+
+// Schedule decides the fault of each call by its rules; the first rule
+// matching a call wins. It is safe for concurrent use, though calls made
+// concurrently are numbered in the order they reach the schedule.
+type Schedule struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	rules    []Rule
+	calls    uint64
+	injected uint64
+}
+
+// NewSchedule creates a Schedule applying rules, drawing random decisions
+// from a source seeded with seed.
+func NewSchedule(seed int64, rules ...Rule) *Schedule {
+	return &Schedule{
+		rng:   rand.New(rand.NewSource(seed)),
+		rules: rules,
+	}
+}
+
+// Next numbers a call and returns its fault.
+func (s *Schedule) Next() Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	for _, rule := range s.rules {
+		if f, ok := rule(s.calls, s.rng); ok {
+			if !f.IsZero() {
+				s.injected++
+			}
+			return f
+		}
+	}
+	return Fault{}
+}
+
+// Set replaces the rules. The call count and the random source carry on.
+func (s *Schedule) Set(rules ...Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rules
+}
+
+// Calls returns how many calls the schedule numbered.
+func (s *Schedule) Calls() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// Injected returns how many calls got a fault.
+func (s *Schedule) Injected() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.injected
+}
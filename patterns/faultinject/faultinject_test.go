@@ -0,0 +1,110 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// trace returns which of n calls of s got a fault.
+func trace(s *Schedule, n int) []bool {
+	faults := make([]bool, n)
+	for i := range faults {
+		faults[i] = !s.Next().IsZero()
+	}
+	return faults
+}
+
+func TestScheduleSeeded(t *testing.T) {
+	newSchedule := func(seed int64) *Schedule {
+		return NewSchedule(seed, Chance(0.3, Reject()))
+	}
+
+	// The same seed gives the same faults
+	a := trace(newSchedule(42), 200)
+	b := trace(newSchedule(42), 200)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("schedules with the same seed differ")
+	}
+	if c := trace(newSchedule(43), 200); reflect.DeepEqual(a, c) {
+		t.Error("schedules with different seeds should differ")
+	}
+
+	// About the requested share of calls fail
+	n := 0
+	for _, f := range a {
+		if f {
+			n++
+		}
+	}
+	if n < 40 || n > 80 {
+		t.Errorf("%d of 200 calls faulted, want about 60", n)
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want []bool
+	}{
+		{"Every", Every(3, Reject()), []bool{false, false, true, false, false, true, false}},
+		{"Burst", Burst(5, 2, Reject()), []bool{true, true, false, false, false, true, true}},
+		{"After", After(4, Reject()), []bool{false, false, false, false, true, true, true}},
+		{"Script", Script(Fault{}, Reject(), Reject()), []bool{false, true, true, false, false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trace(NewSchedule(1, tt.rule), len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("faults = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleFirstRuleWins(t *testing.T) {
+	errEvery := errors.New("every")
+	s := NewSchedule(1, Every(2, Fail(errEvery)), After(0, Delay(time.Second)))
+
+	if f := s.Next(); f.Delay != time.Second {
+		t.Errorf("call 1 = %+v, want the delay", f)
+	}
+	if f := s.Next(); f.Err != errEvery || f.Delay != 0 {
+		t.Errorf("call 2 = %+v, want only the error", f)
+	}
+	if s.Calls() != 2 || s.Injected() != 2 {
+		t.Errorf("calls %d, injected %d, want 2 and 2", s.Calls(), s.Injected())
+	}
+
+	// New rules apply from the next call on
+	s.Set()
+	if f := s.Next(); !f.IsZero() {
+		t.Errorf("call 3 = %+v, want none", f)
+	}
+	if s.Calls() != 3 || s.Injected() != 2 {
+		t.Errorf("calls %d, injected %d, want 3 and 2", s.Calls(), s.Injected())
+	}
+}
+
+func TestFaultApply(t *testing.T) {
+	if err := Reject().apply(context.Background()); !errors.Is(err, ErrInjected) {
+		t.Errorf("Reject = %v, want ErrInjected", err)
+	}
+
+	// A delay ends with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Delay(time.Hour).apply(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Delay = %v, want context.Canceled", err)
+	}
+
+	defer func() {
+		if v := recover(); v != "boom" {
+			t.Errorf("recovered %v, want boom", v)
+		}
+	}()
+	Panic("boom").apply(context.Background())
+	t.Error("Panic should panic")
+}
@@ -0,0 +1,125 @@
+package faultinject
+
+import (
+	"context"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// Limiter implements ratelimit.Limiter.
+var _ ratelimit.Limiter = (*Limiter)(nil)
+
+// Acquirer is the part of a resource pool Pool wraps. The generic pool,
+// dbpool and redispool implement it.
+type Acquirer[T any] interface {
+	AcquireContext(ctx context.Context) (T, error)
+	Release(v T)
+}
+
+// Pool injects faults into the acquires of a pool.
+type Pool[T any] struct {
+	pool     Acquirer[T]
+	schedule *Schedule
+}
+
+// WrapPool returns a pool whose acquires first go through a fault of s:
+// they are delayed by its latency, and fail with its error without
+// reaching pool.
+func WrapPool[T any](pool Acquirer[T], s *Schedule) *Pool[T] {
+	return &Pool[T]{pool: pool, schedule: s}
+}
+
+// Acquire applies the next fault, then acquires a resource with the
+// wrapped pool's Acquire, so its wait timeout applies, or without a
+// deadline if it has none.
+func (p *Pool[T]) Acquire() (T, error) {
+	a, ok := p.pool.(interface{ Acquire() (T, error) })
+	if !ok {
+		return p.AcquireContext(context.Background())
+	}
+	if err := p.schedule.Next().apply(context.Background()); err != nil {
+		var zero T
+		return zero, err
+	}
+	return a.Acquire()
+}
+
+// AcquireContext applies the next fault, then acquires a resource from
+// the wrapped pool.
+func (p *Pool[T]) AcquireContext(ctx context.Context) (T, error) {
+	if err := p.schedule.Next().apply(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+	return p.pool.AcquireContext(ctx)
+}
+
+// Release returns v to the wrapped pool.
+func (p *Pool[T]) Release(v T) {
+	p.pool.Release(v)
+}
+
+// Limiter forces rejections onto a limiter.
+type Limiter struct {
+	limiter  ratelimit.Limiter
+	schedule *Schedule
+}
+
+// WrapLimiter returns a limiter rejecting the calls s gives a fault with
+// an error; the others are decided by l, or admitted if l is nil. Each
+// Allow, AllowN and Wait is one call of the schedule.
+func WrapLimiter(l ratelimit.Limiter, s *Schedule) *Limiter {
+	return &Limiter{limiter: l, schedule: s}
+}
+
+// Allow reports whether one event may happen now. Delays are ignored, as
+// Allow does not block.
+func (l *Limiter) Allow() bool {
+	return l.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now.
+func (l *Limiter) AllowN(n int) bool {
+	f := l.schedule.Next()
+	f.Delay = 0
+	if f.apply(context.Background()) != nil {
+		return false
+	}
+	return l.limiter == nil || l.limiter.AllowN(n)
+}
+
+// Wait blocks for the fault's delay, then returns its error if it has
+// one, so a rejected Wait fails instead of blocking. Otherwise it waits
+// for the wrapped limiter.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := l.schedule.Next().apply(ctx); err != nil {
+		return err
+	}
+	if l.limiter == nil {
+		return ctx.Err()
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// Consume decorates a consumer's ConsumeFunc: each call first goes
+// through a fault of s, which may delay it, panic or fail it without
+// calling fn.
+func Consume(fn func(interface{}) error, s *Schedule) func(interface{}) error {
+	return func(data interface{}) error {
+		if err := s.Next().apply(context.Background()); err != nil {
+			return err
+		}
+		return fn(data)
+	}
+}
+
+// ConsumeCtx decorates a consumer's ConsumeCtxFunc like Consume. Delays
+// end early if ctx is done.
+func ConsumeCtx(fn func(context.Context, interface{}) error, s *Schedule) func(context.Context, interface{}) error {
+	return func(ctx context.Context, data interface{}) error {
+		if err := s.Next().apply(ctx); err != nil {
+			return err
+		}
+		return fn(ctx, data)
+	}
+}
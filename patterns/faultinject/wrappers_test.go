@@ -0,0 +1,150 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
+)
+
+func newPool(t *testing.T) *generic.Pool[*int] {
+	p := generic.New(generic.Config[*int]{
+		Factory: func(context.Context) (*int, error) { return new(int), nil },
+		MaxSize: 2,
+	})
+	t.Cleanup(func() { p.Close(context.Background()) })
+	return p
+}
+
+func TestPool(t *testing.T) {
+	errDown := errors.New("down")
+	s := NewSchedule(1, Script(Fault{}, Fail(errDown), Delay(20*time.Millisecond)))
+	p := WrapPool[*int](newPool(t), s)
+
+	v, err := p.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(v)
+
+	if _, err := p.AcquireContext(context.Background()); !errors.Is(err, errDown) {
+		t.Errorf("second acquire = %v, want the injected error", err)
+	}
+
+	start := time.Now()
+	v, err = p.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("third acquire took %v, want the injected latency", d)
+	}
+	p.Release(v)
+
+	// A slow acquire still honors the caller's deadline
+	s.Set(After(0, Delay(time.Hour)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.AcquireContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow acquire = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// allowAll admits every event and counts the calls that reach it.
+type allowAll struct {
+	calls int
+}
+
+func (l *allowAll) Allow() bool     { return l.AllowN(1) }
+func (l *allowAll) AllowN(int) bool { l.calls++; return true }
+func (l *allowAll) Wait(ctx context.Context) error {
+	l.calls++
+	return ctx.Err()
+}
+
+func TestLimiter(t *testing.T) {
+	inner := &allowAll{}
+	l := WrapLimiter(inner, NewSchedule(1, Every(3, Reject()), Burst(10, 1, Reject())))
+
+	var got []bool
+	for i := 0; i < 7; i++ {
+		got = append(got, l.Allow())
+	}
+	want := []bool{false, true, false, true, true, false, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Allow = %v, want %v", got, want)
+	}
+	if inner.calls != 4 {
+		t.Errorf("wrapped limiter saw %d calls, want only the 4 admitted", inner.calls)
+	}
+
+	// Call 8 passes, call 9 is rejected
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("Wait = %v, want nil", err)
+	}
+	if err := l.Wait(context.Background()); !errors.Is(err, ErrInjected) {
+		t.Errorf("Wait = %v, want ErrInjected", err)
+	}
+
+	// Without a wrapped limiter, only the schedule rejects
+	l = WrapLimiter(nil, NewSchedule(1, Every(2, Reject())))
+	if !l.Allow() || l.AllowN(5) {
+		t.Error("want every other call rejected")
+	}
+}
+
+func TestConsume(t *testing.T) {
+	var consumed []interface{}
+	fn := func(data interface{}) error {
+		consumed = append(consumed, data)
+		return nil
+	}
+
+	s := NewSchedule(7, Script(Fault{}, Panic("boom"), Reject(), Delay(time.Millisecond)))
+	c := producerconsumer.NewConsumer(0, 1)
+	c.ConsumeFunc = Consume(fn, s)
+
+	var outcomes []string
+	for i := 0; i < 4; i++ {
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					outcomes = append(outcomes, "panic")
+				}
+			}()
+			// The Consumer recovers the panic into a *PanicError
+			var pe *producerconsumer.PanicError
+			err := c.Process(context.Background(), i)
+			if errors.As(err, &pe) {
+				outcomes = append(outcomes, "panic")
+				return
+			}
+			if err != nil {
+				outcomes = append(outcomes, "error")
+				return
+			}
+			outcomes = append(outcomes, "ok")
+		}()
+	}
+
+	if want := []string{"ok", "panic", "error", "ok"}; !reflect.DeepEqual(outcomes, want) {
+		t.Errorf("outcomes = %v, want %v", outcomes, want)
+	}
+	if want := []interface{}{0, 3}; !reflect.DeepEqual(consumed, want) {
+		t.Errorf("consumed = %v, want %v", consumed, want)
+	}
+}
+
+func TestConsumeCtx(t *testing.T) {
+	fn := ConsumeCtx(func(context.Context, interface{}) error { return nil }, NewSchedule(1, After(0, Delay(time.Hour))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := fn(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("ConsumeCtx = %v, want context.Canceled", err)
+	}
+}
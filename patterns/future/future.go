@@ -0,0 +1,111 @@
+// Package future implements futures for single-result asynchronous work.
+package future
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error of a future whose function panicked.
+type PanicError struct {
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("future panicked: %v", e.Value)
+}
+
+// Future is the result of work running in the background.
+//
+// The work runs once and its result is kept, so every Get returns the
+// same value and error. A caller giving up on Get, by cancelling its ctx,
+// does not affect the work or the other callers; only Cancel stops it.
+type Future[T any] struct {
+
+	// done is closed once val and err are set.
+	done chan struct{}
+
+	val T
+	err error
+
+	// cancel cancels the context passed to the work.
+	cancel context.CancelFunc
+}
+
+// New starts fn in a new goroutine and returns its future. The context
+// passed to fn is cancelled by Cancel, and once fn has returned.
+func New[T any](fn func(ctx context.Context) (T, error)) *Future[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Future[T]{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	go func() {
+		defer cancel()
+		defer close(f.done)
+
+		// Turn a panic into the future's error
+		defer func() {
+			if v := recover(); v != nil {
+				f.err = &PanicError{Value: v, Stack: debug.Stack()}
+			}
+		}()
+
+		f.val, f.err = fn(ctx)
+	}()
+
+	return f
+}
+
+// Get waits for the result. If ctx is done first, it returns the context
+// error, and the work carries on.
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Done returns a channel closed once the result is ready, for use in
+// select statements.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Cancel cancels the context passed to the work. The future completes
+// once the work returns, with whatever result it returns.
+func (f *Future[T]) Cancel() {
+	f.cancel()
+}
+
+// Then starts fn with the value of f once f succeeds, and returns the
+// future of fn. If f fails, the returned future fails with the same error
+// without calling fn. Cancelling the returned future also stops waiting
+// for f, so no goroutine is left behind.
+func Then[T, U any](f *Future[T], fn func(ctx context.Context, v T) (U, error)) *Future[U] {
+	return New(func(ctx context.Context) (U, error) {
+		v, err := f.Get(ctx)
+		if err != nil {
+			var zero U
+			return zero, err
+		}
+		return fn(ctx, v)
+	})
+}
+
+// Map is like Then for functions that cannot fail.
+func Map[T, U any](f *Future[T], fn func(v T) U) *Future[U] {
+	return Then(f, func(_ context.Context, v T) (U, error) {
+		return fn(v), nil
+	})
+}
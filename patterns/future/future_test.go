@@ -0,0 +1,183 @@
+package future
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestGet(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	f := New(func(context.Context) (int, error) {
+		return 42, nil
+	})
+
+	v, err := f.Get(context.Background())
+	if v != 42 || err != nil {
+		t.Errorf("Get() = %v, %v, want 42, nil", v, err)
+	}
+
+	select {
+	case <-f.Done():
+	default:
+		t.Error("Done should be closed")
+	}
+}
+
+func TestManyGetters(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var runs int32
+	release := make(chan struct{})
+	f := New(func(context.Context) (int, error) {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return 7, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]int, 100)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = f.Get(context.Background())
+		}(i)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// The work ran once and everyone got the same result
+	if atomic.LoadInt32(&runs) != 1 {
+		t.Errorf("work ran %d times, want 1", runs)
+	}
+	for i, v := range results {
+		if v != 7 {
+			t.Fatalf("getter %d got %d, want 7", i, v)
+		}
+	}
+}
+
+func TestGetCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	release := make(chan struct{})
+	f := New(func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	})
+
+	// One caller gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Get(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() = %v, want %v", err, context.Canceled)
+	}
+
+	// The work is unaffected
+	close(release)
+	if v, err := f.Get(context.Background()); v != 1 || err != nil {
+		t.Errorf("Get() = %v, %v, want 1, nil", v, err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	f := New(func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	f.Cancel()
+
+	if _, err := f.Get(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	f := New(func(context.Context) (int, error) {
+		panic("boom")
+	})
+
+	_, err := f.Get(context.Background())
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Errorf("Get() = %v, want a PanicError", err)
+	}
+
+	// Every caller sees the same error
+	if _, err2 := f.Get(context.Background()); err2 != err {
+		t.Errorf("second Get() = %v, want %v", err2, err)
+	}
+}
+
+func TestThenMap(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	f := New(func(context.Context) (int, error) { return 20, nil })
+	g := Then(f, func(_ context.Context, v int) (int, error) { return v + 1, nil })
+	h := Map(g, strconv.Itoa)
+
+	if v, err := h.Get(context.Background()); v != "21" || err != nil {
+		t.Errorf("Get() = %q, %v, want \"21\", nil", v, err)
+	}
+}
+
+func TestThenError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	errFail := errors.New("fail")
+	f := New(func(context.Context) (int, error) { return 0, errFail })
+
+	called := false
+	g := Map(f, func(v int) int {
+		called = true
+		return v
+	})
+
+	if _, err := g.Get(context.Background()); err != errFail {
+		t.Errorf("Get() = %v, want %v", err, errFail)
+	}
+	if called {
+		t.Error("fn should not be called when the parent fails")
+	}
+}
+
+func TestThenCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// The parent never finishes on its own
+	stop := make(chan struct{})
+	f := New(func(context.Context) (int, error) {
+		<-stop
+		return 0, nil
+	})
+	defer close(stop)
+
+	g := Map(f, func(v int) int { return v })
+	g.Cancel()
+
+	select {
+	case <-g.Done():
+	case <-time.After(time.Second):
+		t.Fatal("cancelled future should complete without its parent")
+	}
+	if _, err := g.Get(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,180 @@
+// Package group runs related goroutines, such as the producers, consumers
+// and pipeline stages of one program, and collects their errors.
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicError is the error of a function that panicked.
+type PanicError struct {
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("group function panicked: %v", e.Value)
+}
+
+// Runner is implemented by components with a blocking Run, such as
+// producerconsumer.Producer and producerconsumer.Consumer.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// Option configures a Group.
+type Option func(*Group)
+
+// WithCancelOnError cancels the context shared by the functions when the
+// first of them fails, so the others can stop early.
+func WithCancelOnError() Option {
+	return func(g *Group) {
+		g.cancelOnError = true
+	}
+}
+
+// Group runs functions in goroutines sharing one context, and waits for
+// them all.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	cancelOnError bool
+
+	wg sync.WaitGroup
+
+	// sem bounds the running functions if set.
+	sem chan struct{}
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// New creates a Group whose functions get a context derived from ctx.
+func New(ctx context.Context, opts ...Option) *Group {
+	g := &Group{}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.ctx, g.cancel = context.WithCancelCause(ctx)
+	return g
+}
+
+// Context returns the context shared by the functions. It is cancelled
+// when Wait returns, or on the first error with WithCancelOnError.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// SetLimit bounds the number of functions running at once to n, making Go
+// wait for a free slot. A negative n removes the limit. It must not be
+// called while functions are running.
+func (g *Group) SetLimit(n int) {
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("group: modify limit while %v functions are running", len(g.sem)))
+	}
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Go runs fn in a goroutine, waiting first for a free slot if a limit is
+// set. A panic in fn is recovered and recorded as a *PanicError.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+
+		if err := g.call(fn); err != nil {
+			g.record(err)
+		}
+	}()
+}
+
+// GoRunner runs r.Run in a goroutine, like Go. The error of Run counts
+// unless the group's context is done, as Run then returns its cause.
+func (g *Group) GoRunner(r Runner) {
+	g.Go(func(ctx context.Context) error {
+		if err := r.Run(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// Sink runs a goroutine in g handing every value from in, such as the
+// output of a pipeline, to fn. It stops when in is closed, the group's
+// context is done, or fn fails.
+func Sink[T any](g *Group, in <-chan T, fn func(ctx context.Context, v T) error) {
+	g.Go(func(ctx context.Context) error {
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return nil
+				}
+				if err := fn(ctx, v); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+}
+
+// Wait waits for all functions to return, cancels the shared context, and
+// returns their errors joined with errors.Join, or nil if none failed.
+// context.Cause of the shared context is the first error.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return errors.Join(g.errs...)
+}
+
+// call runs fn, turning a panic into a *PanicError.
+func (g *Group) call(fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn(g.ctx)
+}
+
+// record keeps err and, with WithCancelOnError, cancels the context.
+// Once the group cancelled itself, context.Canceled errors are only the
+// echo of the first failure and are left out.
+func (g *Group) record(err error) {
+	g.mu.Lock()
+	if g.cancelOnError && len(g.errs) > 0 && errors.Is(err, context.Canceled) {
+		g.mu.Unlock()
+		return
+	}
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+
+	if g.cancelOnError {
+		g.cancel(err)
+	}
+}
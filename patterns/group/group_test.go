@@ -0,0 +1,198 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/group"
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	"go.uber.org/goleak"
+)
+
+var _ group.Runner = (*producerconsumer.Producer)(nil)
+var _ group.Runner = (*producerconsumer.Consumer)(nil)
+
+func TestWaitJoinsErrors(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	errA := errors.New("a")
+	errB := errors.New("b")
+
+	g := group.New(context.Background())
+	g.Go(func(context.Context) error { return errA })
+	g.Go(func(context.Context) error { return errB })
+	g.Go(func(context.Context) error { return nil })
+
+	err := g.Wait()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Wait() = %v, want both errors", err)
+	}
+}
+
+func TestNoErrors(t *testing.T) {
+	g := group.New(context.Background())
+	g.Go(func(context.Context) error { return nil })
+
+	if err := g.Wait(); err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+	if g.Context().Err() == nil {
+		t.Error("context should be cancelled after Wait")
+	}
+}
+
+func TestCancelOnError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	boom := errors.New("boom")
+
+	g := group.New(context.Background(), group.WithCancelOnError())
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.Go(func(context.Context) error { return boom })
+
+	err := g.Wait()
+	if !errors.Is(err, boom) {
+		t.Errorf("Wait() = %v, want %v", err, boom)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() = %v, the cancellation echo should be left out", err)
+	}
+	if cause := context.Cause(g.Context()); !errors.Is(cause, boom) {
+		t.Errorf("Cause() = %v, want %v", cause, boom)
+	}
+}
+
+func TestNoCancelWithoutOption(t *testing.T) {
+	g := group.New(context.Background())
+	g.Go(func(context.Context) error { return errors.New("boom") })
+
+	var cancelled atomic.Bool
+	g.Go(func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		cancelled.Store(ctx.Err() != nil)
+		return nil
+	})
+	g.Wait()
+
+	if cancelled.Load() {
+		t.Error("context should not be cancelled by an error without WithCancelOnError")
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const limit = 3
+
+	g := group.New(context.Background())
+	g.SetLimit(limit)
+
+	var running, peak atomic.Int32
+	for i := 0; i < 20; i++ {
+		g.Go(func(context.Context) error {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+	}
+	g.Wait()
+
+	if p := peak.Load(); p > limit {
+		t.Errorf("peak concurrency = %d, want at most %d", p, limit)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	g := group.New(context.Background(), group.WithCancelOnError())
+	g.Go(func(context.Context) error { panic("oops") })
+
+	var pe *group.PanicError
+	if err := g.Wait(); !errors.As(err, &pe) || pe.Value != "oops" {
+		t.Fatalf("Wait() = %v, want a *group.PanicError", err)
+	}
+	if len(pe.Stack) == 0 {
+		t.Error("PanicError should carry the stack")
+	}
+}
+
+func TestGoRunner(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := producerconsumer.NewConsumer(10, 2)
+	c.Notify(func(string) {})
+
+	var consumed atomic.Int32
+	c.ConsumeFunc = func(interface{}) error {
+		consumed.Add(1)
+		return nil
+	}
+	for i := 0; i < 10; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+
+	g := group.New(context.Background())
+	g.GoRunner(c)
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := consumed.Load(); n != 10 {
+		t.Errorf("consumed %d items, want 10", n)
+	}
+
+	// the reason a runner was stopped is its error
+	errFatal := errors.New("fatal")
+	p := producerconsumer.NewProducer(1, 1)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		return 1, nil
+	}
+	p.Stop(errFatal)
+
+	g = group.New(context.Background())
+	g.GoRunner(p)
+	if err := g.Wait(); !errors.Is(err, errFatal) {
+		t.Errorf("Wait() = %v, want %v", err, errFatal)
+	}
+}
+
+func TestSink(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 1; i <= 3; i++ {
+			in <- i
+		}
+	}()
+
+	var sum int
+	g := group.New(context.Background())
+	group.Sink(g, in, func(_ context.Context, v int) error {
+		sum += v
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 6 {
+		t.Errorf("sum = %d, want 6", sum)
+	}
+}
@@ -0,0 +1,225 @@
+// Package heartbeat detects wedged worker goroutines: workers pulse
+// periodically, and a Monitor reports those that stop pulsing.
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// ErrStop ends a WithHeartbeat loop without an error.
+var ErrStop = errors.New("heartbeat: stop")
+
+// Stall describes a worker that missed its pulses.
+type Stall struct {
+
+	// Name identifies the worker, as given to Register.
+	Name string
+
+	// LastPulse is when the worker last pulsed, or registered.
+	LastPulse time.Time
+
+	// Missed is how many intervals passed since LastPulse.
+	Missed int
+}
+
+// Option configures a Monitor.
+type Option func(*Monitor)
+
+// WithMisses sets how many intervals a worker may miss before it is
+// reported. The default is 3.
+func WithMisses(n int) Option {
+	return func(m *Monitor) {
+		m.misses = n
+	}
+}
+
+// WithOnStall sets a callback invoked for each reported stall, from the
+// goroutine calling Check.
+func WithOnStall(fn func(Stall)) Option {
+	return func(m *Monitor) {
+		m.onStall = fn
+	}
+}
+
+// WithClock sets the clock used to time pulses, for tests.
+func WithClock(c window.Clock) Option {
+	return func(m *Monitor) {
+		m.clock = c
+	}
+}
+
+// realClock reads the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Monitor tracks registered workers and reports those that miss their
+// pulses. A stalled worker is reported once, and again only if it pulses
+// and then stalls anew.
+type Monitor struct {
+	interval time.Duration
+	misses   int
+	clock    window.Clock
+	onStall  func(Stall)
+
+	stalls chan Stall
+
+	mu    sync.Mutex
+	beats map[*Beat]struct{}
+}
+
+// New creates a Monitor expecting workers to pulse every interval.
+func New(interval time.Duration, opts ...Option) *Monitor {
+	m := &Monitor{
+		interval: interval,
+		misses:   3,
+		clock:    realClock{},
+		stalls:   make(chan Stall, 16),
+		beats:    make(map[*Beat]struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Register adds a worker named name and returns its Beat. The worker
+// counts as having pulsed now.
+func (m *Monitor) Register(name string) *Beat {
+	b := &Beat{monitor: m, name: name}
+	b.last.Store(m.clock.Now().UnixNano())
+
+	m.mu.Lock()
+	m.beats[b] = struct{}{}
+	m.mu.Unlock()
+
+	return b
+}
+
+// Stalls returns a channel receiving reported stalls. It is buffered, and
+// stalls are dropped rather than blocking Check when nobody reads it.
+func (m *Monitor) Stalls() <-chan Stall {
+	return m.stalls
+}
+
+// Check reports the workers that missed their pulses at the current time
+// and returns the newly stalled ones. Run calls it every interval.
+func (m *Monitor) Check() []Stall {
+	now := m.clock.Now()
+	limit := m.interval * time.Duration(m.misses)
+
+	var found []Stall
+	m.mu.Lock()
+	for b := range m.beats {
+		last := time.Unix(0, b.last.Load())
+		if now.Sub(last) < limit {
+			continue
+		}
+		// Pulse clears reported, so each stall is reported once
+		if !b.reported.CompareAndSwap(false, true) {
+			continue
+		}
+		found = append(found, Stall{
+			Name:      b.name,
+			LastPulse: last,
+			Missed:    int(now.Sub(last) / m.interval),
+		})
+	}
+	m.mu.Unlock()
+
+	for _, s := range found {
+		if m.onStall != nil {
+			m.onStall(s)
+		}
+		select {
+		case m.stalls <- s:
+		default:
+		}
+	}
+	return found
+}
+
+// Run calls Check every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Beat is a registered worker's handle. The methods of a nil Beat do
+// nothing, so workers can pulse unconditionally.
+type Beat struct {
+	monitor *Monitor
+	name    string
+
+	// last is the time of the last pulse in Unix nanoseconds.
+	last atomic.Int64
+
+	// reported is set once the current stall has been reported.
+	reported atomic.Bool
+}
+
+// Name returns the worker's name.
+func (b *Beat) Name() string {
+	if b == nil {
+		return ""
+	}
+	return b.name
+}
+
+// Pulse records that the worker is alive.
+func (b *Beat) Pulse() {
+	if b == nil {
+		return
+	}
+	b.last.Store(b.monitor.clock.Now().UnixNano())
+	b.reported.Store(false)
+}
+
+// Stop unregisters the worker, so it is no longer checked.
+func (b *Beat) Stop() {
+	if b == nil {
+		return
+	}
+	b.monitor.mu.Lock()
+	delete(b.monitor.beats, b)
+	b.monitor.mu.Unlock()
+}
+
+// WithHeartbeat returns a function that registers a worker named name with
+// m and calls step repeatedly, pulsing after each call, until ctx is done
+// or step fails. A step returning ErrStop ends the loop without an error.
+// The result can be passed to group.Group.Go.
+func WithHeartbeat(m *Monitor, name string, step func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		b := m.Register(name)
+		defer b.Stop()
+
+		for ctx.Err() == nil {
+			if err := step(ctx); err != nil {
+				if errors.Is(err, ErrStop) {
+					return nil
+				}
+				return err
+			}
+			b.Pulse()
+		}
+		return nil
+	}
+}
@@ -0,0 +1,175 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestDetectionLatency(t *testing.T) {
+	clock := newFakeClock()
+	m := New(time.Second, WithMisses(3), WithClock(clock))
+
+	healthy := m.Register("healthy")
+	m.Register("stalled")
+
+	// Detected after exactly three missed intervals, not before
+	for i := 0; i < 3; i++ {
+		if got := m.Check(); len(got) != 0 {
+			t.Fatalf("after %ds: Check() = %v, want none", i, got)
+		}
+		clock.Add(time.Second)
+		healthy.Pulse()
+	}
+
+	got := m.Check()
+	if len(got) != 1 || got[0].Name != "stalled" || got[0].Missed != 3 {
+		t.Fatalf("Check() = %+v, want the stalled worker after 3 misses", got)
+	}
+	if got[0].LastPulse != time.Unix(1000, 0) {
+		t.Errorf("LastPulse = %v, want the registration time", got[0].LastPulse)
+	}
+
+	select {
+	case s := <-m.Stalls():
+		if s.Name != "stalled" {
+			t.Errorf("Stalls() got %q", s.Name)
+		}
+	default:
+		t.Error("stall should be sent on Stalls")
+	}
+}
+
+func TestReportedOnce(t *testing.T) {
+	clock := newFakeClock()
+
+	var reported []string
+	m := New(time.Second, WithMisses(1), WithClock(clock), WithOnStall(func(s Stall) {
+		reported = append(reported, s.Name)
+	}))
+	b := m.Register("w")
+
+	clock.Add(time.Second)
+	m.Check()
+	clock.Add(time.Second)
+	m.Check()
+	if len(reported) != 1 {
+		t.Fatalf("reported %d times, want 1", len(reported))
+	}
+
+	// A recovered worker is reported again when it stalls anew
+	b.Pulse()
+	m.Check()
+	clock.Add(time.Second)
+	m.Check()
+	if len(reported) != 2 {
+		t.Errorf("reported %d times, want 2", len(reported))
+	}
+}
+
+func TestStop(t *testing.T) {
+	clock := newFakeClock()
+	m := New(time.Second, WithMisses(1), WithClock(clock))
+
+	m.Register("w").Stop()
+	clock.Add(time.Hour)
+
+	if got := m.Check(); len(got) != 0 {
+		t.Errorf("Check() = %v, stopped workers should not be checked", got)
+	}
+}
+
+func TestNilBeat(t *testing.T) {
+	var b *Beat
+	b.Pulse()
+	b.Stop()
+}
+
+func TestWithHeartbeat(t *testing.T) {
+	clock := newFakeClock()
+	m := New(time.Second, WithMisses(2), WithClock(clock))
+
+	stuck := make(chan struct{})
+	release := make(chan struct{})
+	steps := 0
+	fn := WithHeartbeat(m, "loop", func(context.Context) error {
+		steps++
+		switch steps {
+		case 2:
+			// Wedge inside a step
+			close(stuck)
+			<-release
+		case 3:
+			return ErrStop
+		}
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- fn(context.Background())
+	}()
+
+	<-stuck
+	clock.Add(2 * time.Second)
+	if got := m.Check(); len(got) != 1 || got[0].Name != "loop" {
+		t.Errorf("Check() = %v, want the wedged loop", got)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("loop = %v, want nil after ErrStop", err)
+	}
+}
+
+func TestWithHeartbeatError(t *testing.T) {
+	m := New(time.Second)
+	boom := errors.New("boom")
+
+	fn := WithHeartbeat(m, "loop", func(context.Context) error { return boom })
+	if err := fn(context.Background()); !errors.Is(err, boom) {
+		t.Errorf("loop = %v, want %v", err, boom)
+	}
+}
+
+func TestRun(t *testing.T) {
+	m := New(10 * time.Millisecond)
+	m.Register("stalled")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	select {
+	case s := <-m.Stalls():
+		if s.Name != "stalled" {
+			t.Errorf("Stalls() got %q", s.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stall not reported")
+	}
+}
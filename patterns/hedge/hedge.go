@@ -0,0 +1,184 @@
+// Package hedge runs hedged requests: when an attempt is slow, another is
+// started alongside it and the first to succeed wins, cutting the tail
+// latency of calls to replicated backends.
+package hedge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// Attempt describes a finished attempt.
+type Attempt struct {
+
+	// Number is the attempt, starting at 1.
+	Number int
+
+	// Err is the error the attempt returned. Losers usually return the
+	// error of their cancelled context.
+	Err error
+
+	// Won tells whether the attempt's result was returned.
+	Won bool
+
+	// Hedged tells whether the attempt was started because the previous
+	// ones were slow, rather than because one failed. The first attempt
+	// is not hedged.
+	Hedged bool
+
+	// Latency is how long the attempt took.
+	Latency time.Duration
+}
+
+// Option configures Do.
+type Option func(*options)
+
+type options struct {
+	clock     clock.Clock
+	limiter   ratelimit.Limiter
+	onAttempt func(Attempt)
+}
+
+// WithClock sets the clock timing the hedging delay and the latencies.
+// The default is the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithLimiter makes every hedged attempt take an event from l first,
+// bounding the extra load hedging puts on the backend. Share l between
+// calls, such as one per backend. When l refuses, no attempt is started
+// and Do tries again after another delay. Attempts replacing failed ones
+// are not limited.
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(o *options) {
+		o.limiter = l
+	}
+}
+
+// WithOnAttempt sets a function called with every attempt once it
+// returns, including the winner. Losers still running when Do returns are
+// reported when they return, from their own goroutines.
+func WithOnAttempt(fn func(Attempt)) Option {
+	return func(o *options) {
+		o.onAttempt = fn
+	}
+}
+
+// result is what an attempt returned.
+type result[T any] struct {
+	attempt Attempt
+	value   T
+}
+
+// Do calls fn and, if it has not succeeded within delay, calls it again
+// alongside, up to maxAttempts calls, starting one every delay. An attempt
+// that fails is replaced at once. The first value returned without error
+// wins: Do returns it and cancels the context of the other attempts,
+// without waiting for them.
+//
+// Do only returns an error once every attempt failed, joining their
+// errors, or if ctx is done first, returning the context error. fn must
+// return soon after its context is cancelled, and be safe to run
+// concurrently. Values below 1 for maxAttempts mean a single call.
+func Do[T any](ctx context.Context, delay time.Duration, maxAttempts int, fn func(ctx context.Context, attempt int) (T, error), opts ...Option) (T, error) {
+	o := options{clock: clock.New()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	// Cancelling ctx stops the losers
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so attempts never block after Do returned
+	results := make(chan result[T], maxAttempts)
+
+	started, running := 0, 0
+	start := func(hedged bool) {
+		started++
+		running++
+		a := Attempt{Number: started, Hedged: hedged}
+		go func() {
+			begin := o.clock.Now()
+			v, err := fn(ctx, a.Number)
+			a.Err = err
+			a.Latency = o.clock.Now().Sub(begin)
+			results <- result[T]{attempt: a, value: v}
+		}()
+	}
+
+	start(false)
+	timer := o.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	var zero T
+	var errs []error
+	for {
+		// Hedge only while attempts are left
+		var hedge <-chan time.Time
+		if started < maxAttempts {
+			hedge = timer.C()
+		}
+
+		select {
+		case <-hedge:
+			if o.limiter == nil || o.limiter.Allow() {
+				start(true)
+			}
+			timer.Reset(delay)
+
+		case r := <-results:
+			running--
+			if r.attempt.Err == nil {
+				r.attempt.Won = true
+				o.report(r.attempt)
+				reportLosers(&o, results, running)
+				return r.value, nil
+			}
+
+			o.report(r.attempt)
+			errs = append(errs, fmt.Errorf("attempt %d: %w", r.attempt.Number, r.attempt.Err))
+			if started < maxAttempts {
+				start(false)
+				timer.Reset(delay)
+			} else if running == 0 {
+				return zero, errors.Join(errs...)
+			}
+
+		case <-ctx.Done():
+			reportLosers(&o, results, running)
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// report calls the attempt callback, if set.
+func (o *options) report(a Attempt) {
+	if o.onAttempt != nil {
+		o.onAttempt(a)
+	}
+}
+
+// reportLosers reports the running attempts as they return, without
+// blocking.
+func reportLosers[T any](o *options, results <-chan result[T], running int) {
+	if o.onAttempt == nil || running == 0 {
+		return
+	}
+	go func() {
+		for i := 0; i < running; i++ {
+			o.report((<-results).attempt)
+		}
+	}()
+}
@@ -0,0 +1,247 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+)
+
+// backend is a fake backend whose calls take as long as the test decides:
+// a call returns once its attempt is released or its context is done.
+type backend struct {
+	started   chan int
+	cancelled chan int
+
+	mu       sync.Mutex
+	release  map[int]chan error
+	attempts []Attempt
+}
+
+func newBackend(maxAttempts int) *backend {
+	b := &backend{
+		started:   make(chan int, maxAttempts),
+		cancelled: make(chan int, maxAttempts),
+		release:   make(map[int]chan error),
+	}
+	for i := 1; i <= maxAttempts; i++ {
+		b.release[i] = make(chan error, 1)
+	}
+	return b
+}
+
+// call is the hedged function, returning 10 times the attempt.
+func (b *backend) call(ctx context.Context, attempt int) (int, error) {
+	b.started <- attempt
+	select {
+	case err := <-b.release[attempt]:
+		if err != nil {
+			return 0, err
+		}
+		return attempt * 10, nil
+	case <-ctx.Done():
+		b.cancelled <- attempt
+		return 0, ctx.Err()
+	}
+}
+
+// onAttempt records the finished attempts.
+func (b *backend) onAttempt(a Attempt) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempts = append(b.attempts, a)
+}
+
+// won returns the winning attempt recorded.
+func (b *backend) won() (Attempt, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, a := range b.attempts {
+		if a.Won {
+			return a, true
+		}
+	}
+	return Attempt{}, false
+}
+
+type outcome struct {
+	v   int
+	err error
+}
+
+// run calls Do in a goroutine.
+func run(ctx context.Context, clk clock.Clock, b *backend, maxAttempts int, opts ...Option) chan outcome {
+	out := make(chan outcome, 1)
+	opts = append(opts, WithClock(clk), WithOnAttempt(b.onAttempt))
+	go func() {
+		v, err := Do(ctx, 10*time.Millisecond, maxAttempts, b.call, opts...)
+		out <- outcome{v, err}
+	}()
+	return out
+}
+
+func TestHedgeFires(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	b := newBackend(3)
+	out := run(context.Background(), clk, b, 3)
+
+	if n := <-b.started; n != 1 {
+		t.Fatalf("started attempt %d, want 1", n)
+	}
+
+	// the first attempt is slow, a second one is started after the delay
+	clk.BlockUntil(1)
+	clk.Add(10 * time.Millisecond)
+	if n := <-b.started; n != 2 {
+		t.Fatalf("started attempt %d, want 2", n)
+	}
+
+	// the second one wins, the first is cancelled
+	clk.Add(5 * time.Millisecond)
+	b.release[2] <- nil
+	if got := <-out; got.v != 20 || got.err != nil {
+		t.Errorf("Do() = %d, %v, want 20", got.v, got.err)
+	}
+	if n := <-b.cancelled; n != 1 {
+		t.Errorf("cancelled attempt %d, want 1", n)
+	}
+
+	a, ok := b.won()
+	if !ok || a.Number != 2 || !a.Hedged || a.Latency != 5*time.Millisecond {
+		t.Errorf("winner %+v, want hedged attempt 2 taking 5ms", a)
+	}
+	if len(b.started) != 0 {
+		t.Error("no third attempt should start")
+	}
+}
+
+func TestHedgeFastFirst(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	b := newBackend(3)
+	b.release[1] <- nil
+
+	// the first attempt returns before the delay, nothing is hedged
+	if got := <-run(context.Background(), clk, b, 3); got.v != 10 || got.err != nil {
+		t.Errorf("Do() = %d, %v, want 10", got.v, got.err)
+	}
+	clk.Add(time.Second)
+	if len(b.started) != 1 {
+		t.Errorf("started %d attempts, want 1", len(b.started))
+	}
+	if a, ok := b.won(); !ok || a.Number != 1 || a.Hedged {
+		t.Errorf("winner %+v, want attempt 1", a)
+	}
+}
+
+func TestHedgeAllFail(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	b := newBackend(3)
+	errs := []error{errors.New("timeout"), errors.New("refused"), errors.New("reset")}
+	for i, err := range errs {
+		b.release[i+1] <- err
+	}
+
+	// failed attempts are replaced at once, without waiting for the delay
+	got := <-run(context.Background(), clk, b, 3)
+	if got.err == nil {
+		t.Fatal("Do() should fail once every attempt failed")
+	}
+	for _, err := range errs {
+		if !errors.Is(got.err, err) {
+			t.Errorf("Do() = %v, want it to hold %v", got.err, err)
+		}
+	}
+	if len(b.started) != 3 {
+		t.Errorf("started %d attempts, want 3", len(b.started))
+	}
+}
+
+func TestHedgeFailureThenSuccess(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	b := newBackend(2)
+	out := run(context.Background(), clk, b, 2)
+
+	// an error is not returned while another attempt may succeed
+	<-b.started
+	b.release[1] <- errors.New("refused")
+	<-b.started
+	b.release[2] <- nil
+	if got := <-out; got.v != 20 || got.err != nil {
+		t.Errorf("Do() = %d, %v, want 20", got.v, got.err)
+	}
+}
+
+// limiter allows a fixed number of events.
+type limiter struct {
+	mu   sync.Mutex
+	left int
+}
+
+func (l *limiter) Allow() bool { return l.AllowN(1) }
+
+func (l *limiter) AllowN(n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.left {
+		return false
+	}
+	l.left -= n
+	return true
+}
+
+func (l *limiter) Wait(context.Context) error { return errors.New("not implemented") }
+
+func TestHedgeLimiter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	b := newBackend(3)
+	l := &limiter{left: 1}
+	out := run(context.Background(), clk, b, 3, WithLimiter(l))
+	<-b.started
+
+	// the limiter allows one hedge only
+	clk.BlockUntil(1)
+	clk.Add(10 * time.Millisecond)
+	if n := <-b.started; n != 2 {
+		t.Fatalf("started attempt %d, want 2", n)
+	}
+	for i := 0; i < 3; i++ {
+		clk.BlockUntil(1)
+		clk.Add(10 * time.Millisecond)
+	}
+	if len(b.started) != 0 {
+		t.Error("the limiter should stop further hedges")
+	}
+
+	b.release[1] <- nil
+	if got := <-out; got.v != 10 || got.err != nil {
+		t.Errorf("Do() = %d, %v, want 10", got.v, got.err)
+	}
+	if n := <-b.cancelled; n != 2 {
+		t.Errorf("cancelled attempt %d, want 2", n)
+	}
+}
+
+func TestHedgeContextDone(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	b := newBackend(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := run(ctx, clk, b, 2)
+
+	<-b.started
+	clk.BlockUntil(1)
+	clk.Add(10 * time.Millisecond)
+	<-b.started
+
+	// cancelling the caller stops every attempt
+	cancel()
+	if got := <-out; !errors.Is(got.err, context.Canceled) {
+		t.Errorf("Do() = %v, want %v", got.err, context.Canceled)
+	}
+	cancelled := map[int]bool{<-b.cancelled: true, <-b.cancelled: true}
+	if !cancelled[1] || !cancelled[2] {
+		t.Errorf("cancelled %v, want attempts 1 and 2", cancelled)
+	}
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/circuitbreaker"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
+)
+
+// PoolLeaks returns a leak callback for DetectLeaks of a pool, logging a
+// "pool.leak" event with when the resource was acquired and its stack.
+func PoolLeaks[T comparable](n *Notifier) func(generic.Leak[T]) {
+	return func(l generic.Leak[T]) {
+		n.Event(Event{Name: "pool.leak", Attrs: []slog.Attr{
+			slog.Time("acquired_at", l.AcquiredAt),
+			slog.String("stack", string(l.Stack)),
+		}})
+	}
+}
+
+// BreakerStateChanges returns a callback for circuitbreaker
+// WithOnStateChange, logging a "breaker.state" event with the states.
+func BreakerStateChanges(n *Notifier) func(from, to circuitbreaker.State) {
+	return func(from, to circuitbreaker.State) {
+		n.Event(Event{Name: "breaker.state", Attrs: []slog.Attr{
+			slog.String("from", from.String()),
+			slog.String("to", to.String()),
+		}})
+	}
+}
+
+// Limiter logs the rejections of a ratelimit.Limiter, and is one itself.
+type Limiter struct {
+	inner ratelimit.Limiter
+	n     *Notifier
+}
+
+// WrapLimiter returns l logging a "ratelimit.rejected" event with the
+// number of events for every rejection. Use WithSampling to keep a flood
+// of rejections out of the logs.
+func WrapLimiter(l ratelimit.Limiter, n *Notifier) *Limiter {
+	return &Limiter{inner: l, n: n}
+}
+
+// Allow calls the limiter's Allow, logging a rejection.
+func (l *Limiter) Allow() bool {
+	return l.AllowN(1)
+}
+
+// AllowN calls the limiter's AllowN, logging a rejection.
+func (l *Limiter) AllowN(n int) bool {
+	ok := l.inner.AllowN(n)
+	if !ok {
+		l.n.Event(Event{Name: "ratelimit.rejected", Attrs: []slog.Attr{slog.Int("n", n)}})
+	}
+	return ok
+}
+
+// Wait calls the limiter's Wait, logging an error other than the context
+// being done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	err := l.inner.Wait(ctx)
+	if err != nil && ctx.Err() == nil {
+		l.n.Event(Event{Name: "ratelimit.wait", Err: err})
+	}
+	return err
+}
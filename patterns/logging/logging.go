@@ -0,0 +1,219 @@
+// Package logging turns the Notifier strings and event callbacks of the
+// producers, consumers, pools and limiters into structured slog records,
+// without slowing down the code that emits them.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/counter"
+)
+
+// Event is something that happened in a component.
+type Event struct {
+
+	// Name is the kind of event. It is the log message, and events are
+	// sampled by it.
+	Name string
+
+	// Err is logged as the "error" attribute if set.
+	Err error
+
+	// Attrs are logged as they are.
+	Attrs []slog.Attr
+}
+
+// Stats counts what happened to the events.
+type Stats struct {
+	Logged  uint64 // Events written to the logger
+	Sampled uint64 // Events skipped by sampling
+	Dropped uint64 // Events dropped because the logger fell behind
+}
+
+// Option configures a Notifier.
+type Option func(*Notifier)
+
+// WithComponent adds a "component" attribute to every record.
+func WithComponent(name string) Option {
+	return func(n *Notifier) {
+		n.component = name
+	}
+}
+
+// WithSampling logs at most perSecond events of each name per second.
+// By default every event is logged.
+func WithSampling(perSecond int) Option {
+	return func(n *Notifier) {
+		n.perSecond = perSecond
+	}
+}
+
+// WithBuffer sets how many events may wait for the logger before new ones
+// are dropped. The default is 256.
+func WithBuffer(size int) Option {
+	return func(n *Notifier) {
+		n.buffer = size
+	}
+}
+
+// Notifier writes events to a slog.Logger from its own goroutine. Its
+// methods never block: when the logger falls behind, events are dropped
+// and counted.
+type Notifier struct {
+	logger    *slog.Logger
+	level     slog.Level
+	component string
+	perSecond int
+	buffer    int
+
+	events    chan record
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	// samplers holds a *counter.Counter per event name.
+	samplers sync.Map
+
+	logged  atomic.Uint64
+	sampled atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// record is an event and when it happened.
+type record struct {
+	at    time.Time
+	event Event
+}
+
+// NewSlogNotifier creates a Notifier logging at level to logger, and
+// starts its goroutine. Call Close to stop it.
+func NewSlogNotifier(logger *slog.Logger, level slog.Level, opts ...Option) *Notifier {
+	n := &Notifier{
+		logger:  logger,
+		level:   level,
+		buffer:  256,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	n.events = make(chan record, n.buffer)
+
+	go n.run()
+	return n
+}
+
+// Notify logs msg as an event with no attributes. It is a Notifier for
+// Producer and Consumer.
+func (n *Notifier) Notify(msg string) {
+	n.Event(Event{Name: msg})
+}
+
+// Error logs err as an "error" event. It is an ErrHandler for Producer
+// and Consumer.
+func (n *Notifier) Error(err error) {
+	n.Event(Event{Name: "error", Err: err})
+}
+
+// Event logs e, unless it is sampled out or the logger is behind.
+func (n *Notifier) Event(e Event) {
+	if !n.sample(e.Name) {
+		n.sampled.Add(1)
+		return
+	}
+
+	select {
+	case <-n.done:
+		n.dropped.Add(1)
+		return
+	default:
+	}
+
+	select {
+	case n.events <- record{at: time.Now(), event: e}:
+	default:
+		n.dropped.Add(1)
+	}
+}
+
+// Stats returns how many events were logged, sampled out and dropped.
+func (n *Notifier) Stats() Stats {
+	return Stats{
+		Logged:  n.logged.Load(),
+		Sampled: n.sampled.Load(),
+		Dropped: n.dropped.Load(),
+	}
+}
+
+// Close logs the events already accepted, then stops the goroutine. Events
+// after Close are dropped.
+func (n *Notifier) Close() {
+	n.closeOnce.Do(func() {
+		close(n.done)
+	})
+	<-n.stopped
+}
+
+// run writes events to the logger until Close, then writes the rest.
+func (n *Notifier) run() {
+	defer close(n.stopped)
+
+	for {
+		select {
+		case r := <-n.events:
+			n.write(r)
+		case <-n.done:
+			for {
+				select {
+				case r := <-n.events:
+					n.write(r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write logs one record.
+func (n *Notifier) write(r record) {
+	attrs := make([]slog.Attr, 0, len(r.event.Attrs)+2)
+	if n.component != "" {
+		attrs = append(attrs, slog.String("component", n.component))
+	}
+	if r.event.Err != nil {
+		attrs = append(attrs, slog.Any("error", r.event.Err))
+	}
+	attrs = append(attrs, r.event.Attrs...)
+
+	handler := n.logger.Handler()
+	ctx := context.Background()
+	if handler.Enabled(ctx, n.level) {
+		rec := slog.NewRecord(r.at, n.level, r.event.Name, 0)
+		rec.AddAttrs(attrs...)
+		handler.Handle(ctx, rec)
+	}
+	n.logged.Add(1)
+}
+
+// sample reports whether an event named name may be logged now.
+func (n *Notifier) sample(name string) bool {
+	if n.perSecond <= 0 {
+		return true
+	}
+
+	c, ok := n.samplers.Load(name)
+	if !ok {
+		c, _ = n.samplers.LoadOrStore(name, counter.New(n.perSecond))
+	}
+
+	// Ask first: rejected events would count against the next ones, and
+	// a steady flood would then never be logged again
+	limiter := c.(*counter.Counter)
+	return limiter.Remaining() > 0 && limiter.Allow()
+}
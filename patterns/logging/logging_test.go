@@ -0,0 +1,241 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/circuitbreaker"
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
+	"go.uber.org/goleak"
+)
+
+// recorder is a slog.Handler keeping the records it handles. If block is
+// set, Handle waits on it.
+type recorder struct {
+	block chan struct{}
+
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recorder) Handle(_ context.Context, r slog.Record) error {
+	if h.block != nil {
+		<-h.block
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recorder) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recorder) WithGroup(string) slog.Handler { return h }
+
+// attrs returns the attributes of r by key.
+func attrs(r slog.Record) map[string]slog.Value {
+	m := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value
+		return true
+	})
+	return m
+}
+
+func (h *recorder) all() []slog.Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]slog.Record(nil), h.records...)
+}
+
+func TestAttributes(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	h := &recorder{}
+	n := NewSlogNotifier(slog.New(h), slog.LevelWarn, WithComponent("orders"))
+
+	errBoom := errors.New("boom")
+	n.Notify("ConsumerStarted")
+	n.Error(errBoom)
+	n.Event(Event{Name: "custom", Attrs: []slog.Attr{slog.Int("depth", 7)}})
+	n.Close()
+
+	records := h.all()
+	if len(records) != 3 {
+		t.Fatalf("logged %d records, want 3", len(records))
+	}
+	for _, r := range records {
+		if r.Level != slog.LevelWarn {
+			t.Errorf("%q logged at %v, want WARN", r.Message, r.Level)
+		}
+		if got := attrs(r)["component"].String(); got != "orders" {
+			t.Errorf("%q component = %q, want orders", r.Message, got)
+		}
+	}
+
+	if records[0].Message != "ConsumerStarted" {
+		t.Errorf("message = %q, want ConsumerStarted", records[0].Message)
+	}
+	if err, _ := attrs(records[1])["error"].Any().(error); records[1].Message != "error" || err != errBoom {
+		t.Errorf("error record = %q with %v, want error with %v", records[1].Message, err, errBoom)
+	}
+	if got := attrs(records[2])["depth"].Int64(); got != 7 {
+		t.Errorf("depth = %d, want 7", got)
+	}
+	if s := n.Stats(); s.Logged != 3 || s.Dropped != 0 || s.Sampled != 0 {
+		t.Errorf("Stats = %+v, want 3 logged", s)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	h := &recorder{}
+	n := NewSlogNotifier(slog.New(h), slog.LevelInfo, WithSampling(5), WithBuffer(1000))
+
+	// A burst logs at most the per-second allowance of each event name
+	for i := 0; i < 100; i++ {
+		n.Notify("buff full sleep")
+		n.Notify("ConsumerRetry")
+	}
+	n.Close()
+
+	counts := make(map[string]int)
+	for _, r := range h.all() {
+		counts[r.Message]++
+	}
+	for _, name := range []string{"buff full sleep", "ConsumerRetry"} {
+		if counts[name] < 1 || counts[name] > 5 {
+			t.Errorf("%q logged %d times, want 1 to 5", name, counts[name])
+		}
+	}
+	s := n.Stats()
+	if s.Logged+s.Sampled != 200 {
+		t.Errorf("Stats = %+v, want logged and sampled to add up to 200", s)
+	}
+}
+
+func TestSamplingRecovers(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	h := &recorder{}
+	n := NewSlogNotifier(slog.New(h), slog.LevelInfo, WithSampling(100))
+
+	// A steady flood keeps being logged at about the sampling rate
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		n.Notify("flood")
+		time.Sleep(100 * time.Microsecond)
+	}
+	n.Close()
+
+	if got := len(h.all()); got < 5 || got > 25 {
+		t.Errorf("logged %d of a 200ms flood sampled at 100/s, want about 20", got)
+	}
+}
+
+func TestSlowLoggerDrops(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	h := &recorder{block: make(chan struct{})}
+	n := NewSlogNotifier(slog.New(h), slog.LevelInfo, WithBuffer(4))
+
+	// The logger is stuck: the caller goes on, events beyond the buffer
+	// are dropped
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		n.Notify("event")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Notify blocked for %v", elapsed)
+	}
+
+	close(h.block)
+	n.Close()
+
+	s := n.Stats()
+	if s.Dropped < 90 || s.Logged+s.Dropped != 100 {
+		t.Errorf("Stats = %+v, want most of 100 dropped", s)
+	}
+	if int(s.Logged) != len(h.all()) {
+		t.Errorf("Logged = %d, handler got %d", s.Logged, len(h.all()))
+	}
+
+	// After Close events are dropped
+	n.Notify("late")
+	if n.Stats().Dropped != s.Dropped+1 {
+		t.Error("event after Close was not dropped")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	h := &recorder{}
+	n := NewSlogNotifier(slog.New(h), slog.LevelInfo)
+
+	// Producer and Consumer take the methods as hooks
+	c := producerconsumer.NewConsumer(1, 1)
+	c.Notify(n.Notify)
+	c.HandleError(n.Error)
+	c.ConsumeFunc = func(interface{}) error { return errors.New("bad item") }
+	c.Buffer <- 1
+	c.Close()
+	c.Run(context.Background())
+
+	acquired := time.Unix(100, 0)
+	PoolLeaks[int](n)(generic.Leak[int]{Resource: 1, AcquiredAt: acquired, Stack: []byte("main.go:1")})
+	BreakerStateChanges(n)(circuitbreaker.Closed, circuitbreaker.Open)
+	n.Close()
+
+	byMessage := make(map[string]slog.Record)
+	for _, r := range h.all() {
+		byMessage[r.Message] = r
+	}
+	for _, name := range []string{"ConsumerStarted", "ConsumerError", "error", "pool.leak", "breaker.state"} {
+		if _, ok := byMessage[name]; !ok {
+			t.Errorf("no %q record, got %v", name, h.all())
+		}
+	}
+
+	leak := attrs(byMessage["pool.leak"])
+	if !leak["acquired_at"].Time().Equal(acquired) || leak["stack"].String() != "main.go:1" {
+		t.Errorf("pool.leak attributes = %v", leak)
+	}
+	state := attrs(byMessage["breaker.state"])
+	if state["from"].String() != "closed" || state["to"].String() != "open" {
+		t.Errorf("breaker.state attributes = %v", state)
+	}
+}
+
+func TestWrapLimiter(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	h := &recorder{}
+	n := NewSlogNotifier(slog.New(h), slog.LevelInfo)
+
+	l := WrapLimiter(rejectAll{}, n)
+	if l.AllowN(3) {
+		t.Fatal("AllowN should be rejected")
+	}
+	n.Close()
+
+	records := h.all()
+	if len(records) != 1 || records[0].Message != "ratelimit.rejected" || attrs(records[0])["n"].Int64() != 3 {
+		t.Errorf("records = %v, want one ratelimit.rejected with n=3", records)
+	}
+}
+
+// rejectAll is a limiter admitting nothing.
+type rejectAll struct{}
+
+func (rejectAll) Allow() bool                    { return false }
+func (rejectAll) AllowN(int) bool                { return false }
+func (rejectAll) Wait(ctx context.Context) error { return ctx.Err() }
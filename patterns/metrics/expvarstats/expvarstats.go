@@ -0,0 +1,20 @@
+// Package expvarstats publishes component stats through expvar, for
+// services that do not run Prometheus.
+package expvarstats
+
+import "expvar"
+
+// StatsProvider is implemented by components that can report their stats
+// as named integer values.
+type StatsProvider interface {
+	StatsMap() map[string]int64
+}
+
+// Publish publishes v under name in /debug/vars. The stats are read
+// lazily each time the variables are served, with no background goroutine.
+// Like expvar.Publish, it panics if name is already registered.
+func Publish(name string, v StatsProvider) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return v.StatsMap()
+	}))
+}
@@ -0,0 +1,84 @@
+package expvarstats
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	dbpool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/db"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+)
+
+// The components publish through StatsProvider.
+var (
+	_ StatsProvider = (*dbpool.ConnectionPool)(nil)
+	_ StatsProvider = (*redispool.RedisConnectionPool)(nil)
+	_ StatsProvider = (*tokenbucket.TokenBucket)(nil)
+)
+
+// counter reports how many times it was read.
+type counter struct {
+	reads int64
+}
+
+func (c *counter) StatsMap() map[string]int64 {
+	return map[string]int64{"reads": atomic.AddInt64(&c.reads, 1)}
+}
+
+// published counts the variables the tests published. expvar names are
+// global and cannot be reused, so each run of a test publishes a new one.
+var published int64
+
+// uniqueName returns a variable name for t not published yet.
+func uniqueName(t *testing.T) string {
+	return fmt.Sprintf("%s_%d", t.Name(), atomic.AddInt64(&published, 1))
+}
+
+// debugVars fetches /debug/vars and returns the value published as name.
+func debugVars(t *testing.T, srv *httptest.Server, name string) map[string]int64 {
+	resp, err := srv.Client().Get(srv.URL + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats map[string]int64
+	if err := json.Unmarshal(vars[name], &stats); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return stats
+}
+
+func TestPublish(t *testing.T) {
+	c := &counter{}
+	name := uniqueName(t)
+	Publish(name, c)
+
+	// Nothing is read until the variables are served
+	if atomic.LoadInt64(&c.reads) != 0 {
+		t.Fatal("stats should be read lazily")
+	}
+
+	srv := httptest.NewServer(expvar.Handler())
+	defer srv.Close()
+
+	first := debugVars(t, srv, name)
+	if _, ok := first["reads"]; !ok {
+		t.Fatalf("reads not published: %v", first)
+	}
+
+	// Every request reads fresh values
+	second := debugVars(t, srv, name)
+	if second["reads"] <= first["reads"] {
+		t.Errorf("reads = %v after %v, want it to update", second["reads"], first["reads"])
+	}
+}
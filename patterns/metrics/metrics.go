@@ -0,0 +1,126 @@
+// Package metrics exposes the Stats snapshots of the connection pools and
+// rate limiters as Prometheus metrics.
+//
+// The collectors only call Stats, which reads atomics, so scraping never
+// contends with the pools and limiters for their internal locks.
+package metrics
+
+import (
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	dbpool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/db"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolStats is the common shape of dbpool.Stats and redispool.Stats.
+type poolStats struct {
+	idle, inUse, waiters                  int
+	acquireTimeouts, dials, expiredClosed uint64
+}
+
+// PoolCollector is a prometheus.Collector for a connection pool.
+type PoolCollector struct {
+	stats func() poolStats
+
+	idle            *prometheus.Desc
+	inUse           *prometheus.Desc
+	waiters         *prometheus.Desc
+	acquireTimeouts *prometheus.Desc
+	dials           *prometheus.Desc
+	expiredClosed   *prometheus.Desc
+}
+
+// NewDBPoolCollector creates a collector for a database pool. The name is
+// exported as the "pool" label so several pools can share a registry.
+func NewDBPoolCollector(name string, p *dbpool.ConnectionPool) *PoolCollector {
+	return newPoolCollector("db_pool", name, func() poolStats {
+		s := p.Stats()
+		return poolStats{s.Idle, s.InUse, s.Waiters, s.AcquireTimeouts, s.Dials, s.ExpiredClosed}
+	})
+}
+
+// NewRedisPoolCollector creates a collector for a Redis pool. The name is
+// exported as the "pool" label so several pools can share a registry.
+func NewRedisPoolCollector(name string, p *redispool.RedisConnectionPool) *PoolCollector {
+	return newPoolCollector("redis_pool", name, func() poolStats {
+		s := p.Stats()
+		return poolStats{s.Idle, s.InUse, s.Waiters, s.AcquireTimeouts, s.Dials, s.ExpiredClosed}
+	})
+}
+
+func newPoolCollector(subsystem, name string, stats func() poolStats) *PoolCollector {
+	labels := prometheus.Labels{"pool": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("", subsystem, metric), help, nil, labels)
+	}
+
+	return &PoolCollector{
+		stats:           stats,
+		idle:            desc("idle", "Number of idle connections in the pool."),
+		inUse:           desc("in_use", "Number of connections acquired and not yet released."),
+		waiters:         desc("waiters", "Number of callers waiting to acquire a connection."),
+		acquireTimeouts: desc("acquire_timeouts_total", "Total number of acquires that timed out."),
+		dials:           desc("dials_total", "Total number of connections opened."),
+		expiredClosed:   desc("expired_closed_total", "Total number of connections closed because they expired."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.idle
+	ch <- c.inUse
+	ch <- c.waiters
+	ch <- c.acquireTimeouts
+	ch <- c.dials
+	ch <- c.expiredClosed
+}
+
+// Collect implements prometheus.Collector.
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.idle))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.inUse))
+	ch <- prometheus.MustNewConstMetric(c.waiters, prometheus.GaugeValue, float64(s.waiters))
+	ch <- prometheus.MustNewConstMetric(c.acquireTimeouts, prometheus.CounterValue, float64(s.acquireTimeouts))
+	ch <- prometheus.MustNewConstMetric(c.dials, prometheus.CounterValue, float64(s.dials))
+	ch <- prometheus.MustNewConstMetric(c.expiredClosed, prometheus.CounterValue, float64(s.expiredClosed))
+}
+
+// LimiterCollector is a prometheus.Collector for a rate limiter.
+type LimiterCollector struct {
+	limiter ratelimit.StatsProvider
+
+	available  *prometheus.Desc
+	allowed    *prometheus.Desc
+	rejections *prometheus.Desc
+}
+
+// NewLimiterCollector creates a collector for a limiter exposing Stats.
+// The name is exported as the "limiter" label.
+func NewLimiterCollector(name string, l ratelimit.StatsProvider) *LimiterCollector {
+	labels := prometheus.Labels{"limiter": name}
+
+	return &LimiterCollector{
+		limiter:    l,
+		available:  prometheus.NewDesc("ratelimit_available_tokens", "Number of events that may happen now.", nil, labels),
+		allowed:    prometheus.NewDesc("ratelimit_allowed_total", "Total number of events allowed.", nil, labels),
+		rejections: prometheus.NewDesc("ratelimit_rejections_total", "Total number of events rejected.", nil, labels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *LimiterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.available
+	ch <- c.allowed
+	ch <- c.rejections
+}
+
+// Collect implements prometheus.Collector.
+func (c *LimiterCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.limiter.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.available, prometheus.GaugeValue, float64(s.Available))
+	ch <- prometheus.MustNewConstMetric(c.allowed, prometheus.CounterValue, float64(s.Allowed))
+	ch <- prometheus.MustNewConstMetric(c.rejections, prometheus.CounterValue, float64(s.Rejected))
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	dbpool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/db"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDBPoolCollector(t *testing.T) {
+	pool := dbpool.New(2, 1, 10*time.Millisecond)
+	pool.OpenConnection = func() (*dbpool.DBConn, error) {
+		return &dbpool.DBConn{TimeOut: time.Hour}, nil
+	}
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Take both connections, then time out on a third
+	pool.Acquire()
+	pool.Acquire()
+	pool.Acquire()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewDBPoolCollector("main", pool))
+
+	expected := `
+# HELP db_pool_acquire_timeouts_total Total number of acquires that timed out.
+# TYPE db_pool_acquire_timeouts_total counter
+db_pool_acquire_timeouts_total{pool="main"} 1
+# HELP db_pool_dials_total Total number of connections opened.
+# TYPE db_pool_dials_total counter
+db_pool_dials_total{pool="main"} 2
+# HELP db_pool_expired_closed_total Total number of connections closed because they expired.
+# TYPE db_pool_expired_closed_total counter
+db_pool_expired_closed_total{pool="main"} 0
+# HELP db_pool_idle Number of idle connections in the pool.
+# TYPE db_pool_idle gauge
+db_pool_idle{pool="main"} 0
+# HELP db_pool_in_use Number of connections acquired and not yet released.
+# TYPE db_pool_in_use gauge
+db_pool_in_use{pool="main"} 2
+# HELP db_pool_waiters Number of callers waiting to acquire a connection.
+# TYPE db_pool_waiters gauge
+db_pool_waiters{pool="main"} 0
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedisPoolCollector(t *testing.T) {
+	pool := redispool.New(2, 1, 10*time.Millisecond)
+	pool.OpenConnection = func() (*redispool.RedisConn, error) {
+		return &redispool.RedisConn{TimeOut: time.Hour}, nil
+	}
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _ := pool.Acquire()
+	pool.Acquire()
+	pool.Release(conn)
+
+	expected := `
+# HELP redis_pool_idle Number of idle connections in the pool.
+# TYPE redis_pool_idle gauge
+redis_pool_idle{pool="cache"} 1
+# HELP redis_pool_in_use Number of connections acquired and not yet released.
+# TYPE redis_pool_in_use gauge
+redis_pool_in_use{pool="cache"} 1
+`
+	c := NewRedisPoolCollector("cache", pool)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "redis_pool_idle", "redis_pool_in_use"); err != nil {
+		t.Error(err)
+	}
+}
+
+// fixedStats is a StatsProvider returning a fixed snapshot.
+type fixedStats ratelimit.Stats
+
+func (s fixedStats) Stats() ratelimit.Stats { return ratelimit.Stats(s) }
+
+func TestLimiterCollector(t *testing.T) {
+	c := NewLimiterCollector("api", fixedStats{Available: 3, Allowed: 10, Rejected: 4})
+
+	expected := `
+# HELP ratelimit_allowed_total Total number of events allowed.
+# TYPE ratelimit_allowed_total counter
+ratelimit_allowed_total{limiter="api"} 10
+# HELP ratelimit_available_tokens Number of events that may happen now.
+# TYPE ratelimit_available_tokens gauge
+ratelimit_available_tokens{limiter="api"} 3
+# HELP ratelimit_rejections_total Total number of events rejected.
+# TYPE ratelimit_rejections_total counter
+ratelimit_rejections_total{limiter="api"} 4
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
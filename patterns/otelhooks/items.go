@@ -0,0 +1,94 @@
+package otelhooks
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+)
+
+// spanKey is the envelope metadata name of the propagated span context.
+const spanKey = "otel.span"
+
+// spanPropagator carries the span context through envelopes.
+type spanPropagator struct{}
+
+// SpanPropagator returns a producerconsumer.Propagator carrying the span
+// of the producing context, so consumer spans become its children.
+func SpanPropagator() producerconsumer.Propagator {
+	return spanPropagator{}
+}
+
+func (spanPropagator) Extract(ctx context.Context, md map[string]interface{}) {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		md[spanKey] = sc
+	}
+}
+
+func (spanPropagator) Inject(ctx context.Context, md map[string]interface{}) (context.Context, context.CancelFunc) {
+	sc, ok := md[spanKey].(trace.SpanContext)
+	if !ok {
+		return ctx, func() {}
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc), func() {}
+}
+
+// WrapConsume returns a ConsumeCtxFunc running fn in a span named name for
+// each sampled item. With a Consumer Carrier using SpanPropagator, the
+// span is a child of the span that produced the item.
+func WrapConsume(name string, fn func(ctx context.Context, data interface{}) error, opts ...Option) func(context.Context, interface{}) error {
+	c := newConfig(opts)
+	tracer := c.tracer()
+
+	return func(ctx context.Context, data interface{}) error {
+		if !c.sampled(ctx) {
+			return fn(ctx, data)
+		}
+
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindConsumer))
+		defer span.End()
+
+		err := fn(ctx, data)
+		recordError(span, err)
+		return err
+	}
+}
+
+// WrapProduce returns a ProduceFunc running fn in a span named name for
+// each sampled item. If carrier is not nil, each item is wrapped in an
+// Envelope carrying the context fn ran with, including the span when the
+// carrier uses SpanPropagator. Nil items, which stop the Producer, are
+// passed through unwrapped.
+func WrapProduce(name string, fn func(ctx context.Context) (interface{}, error), carrier *producerconsumer.ContextCarrier, opts ...Option) func() (interface{}, error) {
+	c := newConfig(opts)
+	tracer := c.tracer()
+
+	return func() (interface{}, error) {
+		ctx := context.Background()
+
+		var span trace.Span
+		if c.sampled(ctx) {
+			ctx, span = tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindProducer))
+			defer span.End()
+		}
+
+		data, err := fn(ctx)
+		if span != nil {
+			recordError(span, err)
+		}
+		if err != nil || data == nil || carrier == nil {
+			return data, err
+		}
+		return carrier.WrapContext(ctx, data), nil
+	}
+}
+
+// recordError marks span as failed if err is not nil.
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
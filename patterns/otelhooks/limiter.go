@@ -0,0 +1,82 @@
+package otelhooks
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// Limiter instruments a ratelimit.Limiter, and is one itself.
+type Limiter struct {
+	inner     ratelimit.Limiter
+	name      string
+	decisions metric.Int64Counter
+	wait      metric.Float64Histogram
+}
+
+// WrapLimiter instruments l, named name. It counts Allow and AllowN
+// decisions in the ratelimit.decisions counter, labelled allowed=true or
+// false, and records the time spent in Wait in the ratelimit.wait
+// histogram.
+func WrapLimiter(name string, l ratelimit.Limiter, opts ...Option) (*Limiter, error) {
+	meter := newConfig(opts).meter()
+
+	decisions, err := meter.Int64Counter("ratelimit.decisions",
+		metric.WithDescription("Events allowed or rejected."))
+	if err != nil {
+		return nil, err
+	}
+	wait, err := meter.Float64Histogram("ratelimit.wait",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time spent in Wait."))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{
+		inner:     l,
+		name:      name,
+		decisions: decisions,
+		wait:      wait,
+	}, nil
+}
+
+// Allow calls the limiter's Allow, counting the decision.
+func (l *Limiter) Allow() bool {
+	ok := l.inner.Allow()
+	l.record(ok, 1)
+	return ok
+}
+
+// AllowN calls the limiter's AllowN, counting the n events.
+func (l *Limiter) AllowN(n int) bool {
+	ok := l.inner.AllowN(n)
+	l.record(ok, n)
+	return ok
+}
+
+// Wait calls the limiter's Wait, recording how long it took.
+func (l *Limiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.inner.Wait(ctx)
+
+	l.wait.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		nameAttr(l.name),
+		attribute.Bool("allowed", err == nil),
+	))
+	return err
+}
+
+func (l *Limiter) record(allowed bool, n int) {
+	if n <= 0 {
+		return
+	}
+	l.decisions.Add(context.Background(), int64(n), metric.WithAttributes(
+		nameAttr(l.name),
+		attribute.Bool("allowed", allowed),
+	))
+}
@@ -0,0 +1,117 @@
+// Package otelhooks instruments the producers, consumers, pools and rate
+// limiters of this repository with OpenTelemetry spans and metrics. It
+// decorates their functions and reads their Stats hooks, so the core
+// packages do not depend on OpenTelemetry.
+package otelhooks
+
+import (
+	"context"
+	"math/rand"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/metrics/expvarstats"
+)
+
+// instrumentationName names the tracer and meter of this package.
+const instrumentationName = "github.com/Alan-333333/go-channel-patterns/patterns/otelhooks"
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	sampleRate     float64
+	rand           func() float64
+}
+
+// WithTracerProvider sets the tracer provider. The default is the global
+// one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider sets the meter provider. The default is the global
+// one.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = mp
+	}
+}
+
+// WithSampleRate sets the fraction of items, between 0 and 1, that get a
+// span when their context carries no sampled span. Items continuing a
+// sampled trace always get one. The default is 1.
+func WithSampleRate(rate float64) Option {
+	return func(c *config) {
+		c.sampleRate = rate
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+		sampleRate:     1,
+		rand:           rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *config) tracer() trace.Tracer {
+	return c.tracerProvider.Tracer(instrumentationName)
+}
+
+func (c *config) meter() metric.Meter {
+	return c.meterProvider.Meter(instrumentationName)
+}
+
+// sampled reports whether an item processed under ctx gets a span.
+func (c *config) sampled(ctx context.Context) bool {
+	if trace.SpanContextFromContext(ctx).IsSampled() {
+		return true
+	}
+	return c.sampleRate >= 1 || c.rand() < c.sampleRate
+}
+
+// RegisterStats reports the values of v, such as a pool or a token bucket,
+// as observable gauges named prefix + "." + key, read at each collection.
+func RegisterStats(prefix string, v expvarstats.StatsProvider, opts ...Option) (metric.Registration, error) {
+	meter := newConfig(opts).meter()
+
+	// Instruments are created for the keys known now
+	keys := v.StatsMap()
+	gauges := make(map[string]metric.Int64ObservableGauge, len(keys))
+	observables := make([]metric.Observable, 0, len(keys))
+	for key := range keys {
+		g, err := meter.Int64ObservableGauge(prefix + "." + key)
+		if err != nil {
+			return nil, err
+		}
+		gauges[key] = g
+		observables = append(observables, g)
+	}
+
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for key, value := range v.StatsMap() {
+			if g, ok := gauges[key]; ok {
+				o.ObserveInt64(g, value)
+			}
+		}
+		return nil
+	}, observables...)
+}
+
+// nameAttr labels metrics with the instrumented component's name.
+func nameAttr(name string) attribute.KeyValue {
+	return attribute.String("name", name)
+}
@@ -0,0 +1,266 @@
+package otelhooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+var _ ratelimit.Limiter = (*Limiter)(nil)
+
+func newTracing() (*tracetest.SpanRecorder, Option) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	return sr, WithTracerProvider(tp)
+}
+
+func newMetrics() (*sdkmetric.ManualReader, Option) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return reader, WithMeterProvider(mp)
+}
+
+// collect returns the metric named name from reader.
+func collect(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return nil
+}
+
+func TestSpanParentageThroughCarrier(t *testing.T) {
+	sr, tracing := newTracing()
+	carrier := producerconsumer.NewContextCarrier(SpanPropagator())
+
+	produce := WrapProduce("produce", func(context.Context) (interface{}, error) {
+		return "job", nil
+	}, carrier, tracing)
+
+	var consumed interface{}
+	c := producerconsumer.NewConsumer(1, 1)
+	c.Notify(func(string) {})
+	c.SetCarrier(carrier)
+	c.ConsumeCtxFunc = WrapConsume("consume", func(_ context.Context, data interface{}) error {
+		consumed = data
+		return nil
+	}, tracing)
+
+	item, err := produce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Buffer <- item
+	c.Close()
+	c.Run(context.Background())
+
+	if consumed != "job" {
+		t.Fatalf("consumed %v, want the unwrapped payload", consumed)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	producer, consumer := spans[0], spans[1]
+	if producer.Name() != "produce" || consumer.Name() != "consume" {
+		t.Fatalf("spans = %s, %s", producer.Name(), consumer.Name())
+	}
+	if consumer.Parent().SpanID() != producer.SpanContext().SpanID() {
+		t.Error("consume span should be a child of the produce span")
+	}
+	if consumer.SpanContext().TraceID() != producer.SpanContext().TraceID() {
+		t.Error("spans should share the trace")
+	}
+}
+
+func TestConsumeError(t *testing.T) {
+	sr, tracing := newTracing()
+	boom := errors.New("boom")
+
+	fn := WrapConsume("consume", func(context.Context, interface{}) error { return boom }, tracing)
+	if err := fn(context.Background(), 1); !errors.Is(err, boom) {
+		t.Fatalf("fn() = %v, want %v", err, boom)
+	}
+
+	span := sr.Ended()[0]
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want Error", span.Status().Code)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	sr, tracing := newTracing()
+
+	fn := WrapConsume("consume", func(context.Context, interface{}) error { return nil },
+		tracing, WithSampleRate(0))
+	for i := 0; i < 10; i++ {
+		fn(context.Background(), i)
+	}
+	if n := len(sr.Ended()); n != 0 {
+		t.Errorf("recorded %d spans at sample rate 0, want none", n)
+	}
+
+	// Items continuing a sampled trace are always traced
+	tp := sdktrace.NewTracerProvider()
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	defer parent.End()
+
+	fn(ctx, 1)
+	if n := len(sr.Ended()); n != 1 {
+		t.Errorf("recorded %d spans under a sampled parent, want 1", n)
+	}
+}
+
+func TestProduceStopItem(t *testing.T) {
+	carrier := producerconsumer.NewContextCarrier(SpanPropagator())
+	produce := WrapProduce("produce", func(context.Context) (interface{}, error) {
+		return nil, nil
+	}, carrier)
+
+	// A nil item stops the Producer, so it must not be wrapped
+	if item, _ := produce(); item != nil {
+		t.Errorf("produce() = %v, want nil", item)
+	}
+}
+
+func TestPool(t *testing.T) {
+	sr, tracing := newTracing()
+	reader, metrics := newMetrics()
+
+	conns := make(chan int, 1)
+	conns <- 7
+	pool, err := WrapPool("db", func() (int, error) {
+		select {
+		case c := <-conns:
+			return c, nil
+		case <-time.After(10 * time.Millisecond):
+			return 0, errors.New("timeout")
+		}
+	}, func(c int) { conns <- c }, tracing, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	conn, err := pool.Acquire(ctx)
+	if err != nil || conn != 7 {
+		t.Fatalf("Acquire() = %d, %v", conn, err)
+	}
+	if _, err := pool.Acquire(ctx); err == nil {
+		t.Fatal("second Acquire should time out")
+	}
+	pool.Release(ctx, conn)
+
+	var names []string
+	for _, s := range sr.Ended() {
+		names = append(names, s.Name())
+	}
+	if len(names) != 3 || names[0] != "db.acquire" || names[2] != "db.release" {
+		t.Errorf("spans = %v", names)
+	}
+
+	hist := collect(t, reader, "pool.acquire.wait").(metricdata.Histogram[float64])
+	if hist.DataPoints[0].Count != 2 {
+		t.Errorf("wait histogram count = %d, want 2", hist.DataPoints[0].Count)
+	}
+	// The timed-out call waited the full 10ms
+	if max, _ := hist.DataPoints[0].Max.Value(); max < 0.01 {
+		t.Errorf("max wait = %v, want at least 10ms", max)
+	}
+	failures := collect(t, reader, "pool.acquire.failures").(metricdata.Sum[int64])
+	if failures.DataPoints[0].Value != 1 {
+		t.Errorf("failures = %d, want 1", failures.DataPoints[0].Value)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	reader, metrics := newMetrics()
+
+	l, err := WrapLimiter("api", &fakeLimiter{tokens: 3}, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Allow()
+	l.Allow()
+	l.Wait(context.Background())
+	l.Allow()
+
+	counts := make(map[bool]int64)
+	sum := collect(t, reader, "ratelimit.decisions").(metricdata.Sum[int64])
+	for _, dp := range sum.DataPoints {
+		allowed, _ := dp.Attributes.Value(attribute.Key("allowed"))
+		counts[allowed.AsBool()] = dp.Value
+	}
+	if counts[true] != 2 || counts[false] != 1 {
+		t.Errorf("decisions = %v, want 2 allowed and 1 rejected", counts)
+	}
+
+	hist := collect(t, reader, "ratelimit.wait").(metricdata.Histogram[float64])
+	if hist.DataPoints[0].Count != 1 {
+		t.Errorf("wait count = %d, want 1", hist.DataPoints[0].Count)
+	}
+}
+
+// fakeLimiter allows a fixed number of events.
+type fakeLimiter struct {
+	tokens int
+}
+
+func (l *fakeLimiter) Allow() bool { return l.AllowN(1) }
+
+func (l *fakeLimiter) AllowN(n int) bool {
+	if n > l.tokens {
+		return false
+	}
+	l.tokens -= n
+	return true
+}
+
+func (l *fakeLimiter) Wait(ctx context.Context) error {
+	if !l.Allow() {
+		return errors.New("no tokens")
+	}
+	return nil
+}
+
+type fakeStats map[string]int64
+
+func (s fakeStats) StatsMap() map[string]int64 { return s }
+
+func TestRegisterStats(t *testing.T) {
+	reader, metrics := newMetrics()
+
+	stats := fakeStats{"idle": 3, "in_use": 1}
+	if _, err := RegisterStats("db_pool", stats, metrics); err != nil {
+		t.Fatal(err)
+	}
+	stats["idle"] = 2
+
+	gauge := collect(t, reader, "db_pool.idle").(metricdata.Gauge[int64])
+	if v := gauge.DataPoints[0].Value; v != 2 {
+		t.Errorf("db_pool.idle = %d, want 2", v)
+	}
+}
@@ -0,0 +1,76 @@
+package otelhooks
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Pool instruments a connection pool's Acquire and Release, such as those
+// of dbpool.ConnectionPool and redispool.RedisConnectionPool.
+type Pool[C any] struct {
+	name    string
+	acquire func() (C, error)
+	release func(C)
+
+	tracer   trace.Tracer
+	wait     metric.Float64Histogram
+	failures metric.Int64Counter
+}
+
+// WrapPool instruments the acquire and release functions of the pool
+// named name. It records a span per call, the time spent waiting in
+// Acquire in the pool.acquire.wait histogram, and failed acquisitions in
+// the pool.acquire.failures counter.
+func WrapPool[C any](name string, acquire func() (C, error), release func(C), opts ...Option) (*Pool[C], error) {
+	c := newConfig(opts)
+	meter := c.meter()
+
+	wait, err := meter.Float64Histogram("pool.acquire.wait",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time spent waiting for a connection."))
+	if err != nil {
+		return nil, err
+	}
+	failures, err := meter.Int64Counter("pool.acquire.failures",
+		metric.WithDescription("Acquire calls that returned an error."))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pool[C]{
+		name:     name,
+		acquire:  acquire,
+		release:  release,
+		tracer:   c.tracer(),
+		wait:     wait,
+		failures: failures,
+	}, nil
+}
+
+// Acquire acquires a connection in a span, recording the wait.
+func (p *Pool[C]) Acquire(ctx context.Context) (C, error) {
+	ctx, span := p.tracer.Start(ctx, p.name+".acquire")
+	defer span.End()
+
+	start := time.Now()
+	conn, err := p.acquire()
+
+	attrs := metric.WithAttributes(nameAttr(p.name))
+	p.wait.Record(ctx, time.Since(start).Seconds(), attrs)
+	if err != nil {
+		p.failures.Add(ctx, 1, attrs)
+		recordError(span, err)
+	}
+	return conn, err
+}
+
+// Release releases conn in a span.
+func (p *Pool[C]) Release(ctx context.Context, conn C) {
+	_, span := p.tracer.Start(ctx, p.name+".release")
+	defer span.End()
+
+	p.release(conn)
+}
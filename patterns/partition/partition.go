@@ -0,0 +1,415 @@
+// Package partition implements an in-process consumer group: items are
+// partitioned by key across a fixed number of partitions, and the
+// partitions are shared among a group of consumers that may join and leave
+// while items flow. Each partition is read by one consumer at a time, so
+// items with the same key are consumed in order.
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+)
+
+// ErrClosed is returned by Send and AddConsumer after Close has been
+// called.
+var ErrClosed = errors.New("partition coordinator is closed")
+
+// KeyFunc returns the key an item is partitioned by.
+type KeyFunc func(item interface{}) string
+
+// PartitionStats is a snapshot of one partition's owner and offsets.
+type PartitionStats struct {
+	Owner     string // Consumer reading the partition, empty if none
+	Offset    uint64 // Items routed to the partition
+	Committed uint64 // Items consumed from the partition
+	Lag       uint64 // Items routed and not yet consumed
+}
+
+// Option configures a Coordinator.
+type Option func(*config)
+
+type config struct {
+	buffer int
+}
+
+// WithBuffer sets how many items each partition queues before Send
+// blocks. The default is 64.
+func WithBuffer(n int) Option {
+	return func(c *config) {
+		c.buffer = n
+	}
+}
+
+// partition is a queue read by at most one consumer at a time.
+type partition struct {
+	items     chan interface{}
+	offset    atomic.Uint64
+	committed atomic.Uint64
+
+	// mu guards owner, stop and stopped. stop is closed to hand the
+	// partition off; stopped is closed once its reader has returned.
+	mu      sync.Mutex
+	owner   string
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Coordinator routes items to partitions and assigns the partitions to
+// its consumers.
+type Coordinator struct {
+	ctx   context.Context
+	key   KeyFunc
+	parts []*partition
+
+	// mu guards closed; sending tracks Send calls in progress, so the
+	// partitions are only closed once none can send on them.
+	mu      sync.RWMutex
+	closed  bool
+	sending sync.WaitGroup
+
+	// quit is closed by Close to unblock pending Send calls.
+	quit chan struct{}
+
+	// members serializes membership changes and guards consumers.
+	members   sync.Mutex
+	consumers map[string]*producerconsumer.Consumer
+}
+
+// New creates a Coordinator with the given number of partitions, routing
+// items by the key returned by key. Consumers process items with ctx;
+// once it is done they stop, leaving the remaining items queued.
+func New(ctx context.Context, partitions int, key KeyFunc, opts ...Option) *Coordinator {
+	cfg := config{buffer: 64}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if partitions <= 0 {
+		partitions = 1
+	}
+	if cfg.buffer < 0 {
+		cfg.buffer = 0
+	}
+
+	c := &Coordinator{
+		ctx:       ctx,
+		key:       key,
+		parts:     make([]*partition, partitions),
+		quit:      make(chan struct{}),
+		consumers: make(map[string]*producerconsumer.Consumer),
+	}
+	for i := range c.parts {
+		c.parts[i] = &partition{items: make(chan interface{}, cfg.buffer)}
+	}
+	return c
+}
+
+// Partitions returns the number of partitions.
+func (c *Coordinator) Partitions() int {
+	return len(c.parts)
+}
+
+// PartitionFor returns the index of the partition holding key.
+func (c *Coordinator) PartitionFor(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(c.parts)))
+}
+
+// Send routes item to the partition of its key, blocking while that
+// partition is full. It returns ErrClosed after Close, or the context
+// error if ctx is done first.
+func (c *Coordinator) Send(ctx context.Context, item interface{}) error {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return ErrClosed
+	}
+	c.sending.Add(1)
+	c.mu.RUnlock()
+	defer c.sending.Done()
+
+	// Count the item before sending, so the lag never goes negative
+	p := c.parts[c.PartitionFor(c.key(producerconsumer.Unwrap(item)))]
+	p.offset.Add(1)
+	select {
+	case p.items <- item:
+		return nil
+	case <-c.quit:
+		p.offset.Add(^uint64(0))
+		return ErrClosed
+	case <-ctx.Done():
+		p.offset.Add(^uint64(0))
+		return ctx.Err()
+	}
+}
+
+// Route sends every item read from in, such as a producer's Buffer, until
+// in is closed. It returns the first error of Send.
+func (c *Coordinator) Route(ctx context.Context, in <-chan interface{}) error {
+	for item := range in {
+		if err := c.Send(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddConsumer adds consumer to the group under name and rebalances the
+// partitions. Only the consumer's processing settings are used: items are
+// passed to its Process method one at a time per partition, and its
+// Buffer and NumProcs are ignored.
+func (c *Coordinator) AddConsumer(name string, consumer *producerconsumer.Consumer) error {
+	c.members.Lock()
+	defer c.members.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if _, ok := c.consumers[name]; ok {
+		return fmt.Errorf("consumer %q already added", name)
+	}
+	c.consumers[name] = consumer
+	c.rebalance()
+	return nil
+}
+
+// RemoveConsumer removes the consumer added under name, rebalances the
+// partitions and reports whether it was there. It returns once the
+// consumer has finished the items it was processing.
+func (c *Coordinator) RemoveConsumer(name string) bool {
+	c.members.Lock()
+	defer c.members.Unlock()
+
+	if _, ok := c.consumers[name]; !ok {
+		return false
+	}
+	delete(c.consumers, name)
+	c.rebalance()
+	return true
+}
+
+// Assignment returns the partitions owned by each consumer.
+func (c *Coordinator) Assignment() map[string][]int {
+	assignment := make(map[string][]int)
+	for i, p := range c.parts {
+		p.mu.Lock()
+		owner := p.owner
+		p.mu.Unlock()
+
+		if owner != "" {
+			assignment[owner] = append(assignment[owner], i)
+		}
+	}
+	return assignment
+}
+
+// Stats returns a snapshot of every partition, indexed like PartitionFor.
+func (c *Coordinator) Stats() []PartitionStats {
+	stats := make([]PartitionStats, len(c.parts))
+	for i, p := range c.parts {
+		p.mu.Lock()
+		owner := p.owner
+		p.mu.Unlock()
+
+		// Read the committed count first, so it never exceeds the offset
+		committed := p.committed.Load()
+		offset := p.offset.Load()
+		stats[i] = PartitionStats{
+			Owner:     owner,
+			Offset:    offset,
+			Committed: committed,
+			Lag:       offset - committed,
+		}
+	}
+	return stats
+}
+
+// Close stops accepting items and waits for the consumers to drain the
+// partitions they own. Items in partitions without an owner are left
+// unconsumed. If ctx is done first it returns the context error; the
+// consumers keep draining in the background.
+func (c *Coordinator) Close(ctx context.Context) error {
+	c.members.Lock()
+	if !c.isClosed() {
+		c.mu.Lock()
+		c.closed = true
+		close(c.quit)
+		c.mu.Unlock()
+
+		// No Send can send once the in-flight ones have returned
+		c.sending.Wait()
+		for _, p := range c.parts {
+			close(p.items)
+		}
+	}
+
+	var stopped []chan struct{}
+	for _, p := range c.parts {
+		p.mu.Lock()
+		if p.stopped != nil {
+			stopped = append(stopped, p.stopped)
+		}
+		p.mu.Unlock()
+	}
+	c.members.Unlock()
+
+	for _, done := range stopped {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// isClosed reports whether Close has been called.
+func (c *Coordinator) isClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed
+}
+
+// rebalance hands the partitions whose owner changes from the old owner
+// to the new one. The old owner finishes its current item first, and the
+// new one starts where it stopped. Caller must hold members.
+func (c *Coordinator) rebalance() {
+	names := make([]string, 0, len(c.consumers))
+	for name := range c.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	owners := make([]string, len(c.parts))
+	for i, p := range c.parts {
+		p.mu.Lock()
+		owners[i] = p.owner
+		p.mu.Unlock()
+	}
+
+	for i, owner := range assign(owners, names) {
+		if owner != owners[i] {
+			c.handoff(c.parts[i], owner)
+		}
+	}
+}
+
+// handoff stops the reader of p, if any, and starts one for owner, if
+// not empty. Caller must hold members.
+func (c *Coordinator) handoff(p *partition, owner string) {
+	p.mu.Lock()
+	stop, stopped := p.stop, p.stopped
+	p.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-stopped
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.owner, p.stop, p.stopped = "", nil, nil
+	if owner == "" {
+		return
+	}
+
+	// After Close, readers still drain what the partition holds
+	p.owner = owner
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go c.read(p, c.consumers[owner], p.stop, p.stopped)
+}
+
+// read passes the items of p to consumer until stop is closed, the
+// partition is closed and drained, or the context is done.
+func (c *Coordinator) read(p *partition, consumer *producerconsumer.Consumer, stop, stopped chan struct{}) {
+	defer close(stopped)
+
+	for {
+		// Prefer stopping over taking another item, to keep handoffs brief
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		select {
+		case item, ok := <-p.items:
+			if !ok {
+				return
+			}
+			consumer.Process(c.ctx, item)
+			p.committed.Add(1)
+		case <-stop:
+			return
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// assign returns the owner of every partition given the current owners
+// and the consumers, sorted. Each consumer gets an equal share, give or
+// take one partition, and partitions stay with their owner when the
+// shares allow it.
+func assign(owners, names []string) []string {
+	next := make([]string, len(owners))
+	if len(names) == 0 {
+		return next
+	}
+
+	// Every consumer gets base partitions, and extra of them one more
+	base := len(owners) / len(names)
+	extra := len(owners) % len(names)
+
+	counts := make(map[string]int, len(names))
+	for _, name := range names {
+		counts[name] = 0
+	}
+
+	// Keep current owners within their share
+	for i, owner := range owners {
+		n, ok := counts[owner]
+		switch {
+		case !ok:
+			continue
+		case n < base:
+		case n == base && extra > 0:
+			extra--
+		default:
+			continue
+		}
+		counts[owner]++
+		next[i] = owner
+	}
+
+	// Give the rest to the consumers below their share, in name order
+	for i := range next {
+		if next[i] != "" {
+			continue
+		}
+		for _, name := range names {
+			n := counts[name]
+			if n < base {
+				counts[name]++
+				next[i] = name
+				break
+			}
+			if n == base && extra > 0 {
+				extra--
+				counts[name]++
+				next[i] = name
+				break
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,291 @@
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	"go.uber.org/goleak"
+)
+
+// msg is an item with its position among the items of its key.
+type msg struct {
+	key string
+	seq int
+}
+
+func keyOf(item interface{}) string {
+	return item.(msg).key
+}
+
+// recorder records the items consumed for every key, and by whom.
+type recorder struct {
+	mu   sync.Mutex
+	seen map[string][]int
+	by   map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{seen: make(map[string][]int), by: make(map[string]int)}
+}
+
+// consumer returns a consumer recording its items under name.
+func (r *recorder) consumer(name string) *producerconsumer.Consumer {
+	c := producerconsumer.NewConsumer(0, 1)
+	c.ConsumeFunc = func(item interface{}) error {
+		m := item.(msg)
+		r.mu.Lock()
+		r.seen[m.key] = append(r.seen[m.key], m.seq)
+		r.by[name]++
+		r.mu.Unlock()
+
+		// Leave time for handoffs to happen mid-item
+		time.Sleep(50 * time.Microsecond)
+		return nil
+	}
+	return c
+}
+
+func TestRebalanceMidStream(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const keys, perKey = 20, 300
+
+	r := newRecorder()
+	c := New(context.Background(), 8, keyOf, WithBuffer(4))
+	if err := c.AddConsumer("a", r.consumer("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Change the group while items flow
+	membership := make(chan struct{})
+	go func() {
+		defer close(membership)
+		steps := []func(){
+			func() { c.AddConsumer("b", r.consumer("b")) },
+			func() { c.AddConsumer("c", r.consumer("c")) },
+			func() { c.RemoveConsumer("a") },
+			func() { c.AddConsumer("d", r.consumer("d")) },
+			func() { c.RemoveConsumer("c") },
+		}
+		for _, step := range steps {
+			time.Sleep(5 * time.Millisecond)
+			step()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for k := 0; k < keys; k++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 0; i < perKey; i++ {
+				if err := c.Send(context.Background(), msg{key: key, seq: i}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(fmt.Sprintf("key-%d", k))
+	}
+	wg.Wait()
+	<-membership
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every item once, in order per key
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprintf("key-%d", k)
+		got := r.seen[key]
+		if len(got) != perKey {
+			t.Fatalf("%s: consumed %d items, want %d", key, len(got), perKey)
+		}
+		for i, seq := range got {
+			if seq != i {
+				t.Fatalf("%s: item %d has seq %d", key, i, seq)
+			}
+		}
+	}
+
+	for i, s := range c.Stats() {
+		if s.Lag != 0 || s.Offset != s.Committed {
+			t.Errorf("partition %d: %+v, want no lag", i, s)
+		}
+	}
+	for _, name := range []string{"a", "b"} {
+		if r.by[name] == 0 {
+			t.Errorf("consumer %s consumed nothing", name)
+		}
+	}
+}
+
+func TestLag(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	r := newRecorder()
+	c := New(context.Background(), 2, keyOf)
+
+	// Without consumers, items wait in their partition
+	key := "k"
+	for i := 0; i < 5; i++ {
+		if err := c.Send(context.Background(), msg{key: key, seq: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := c.PartitionFor(key)
+	stats := c.Stats()
+	if want := (PartitionStats{Offset: 5, Lag: 5}); stats[p] != want {
+		t.Errorf("stats = %+v, want %+v", stats[p], want)
+	}
+	if stats[1-p] != (PartitionStats{}) {
+		t.Errorf("other partition stats = %+v, want zero", stats[1-p])
+	}
+
+	// A consumer joining drains the backlog
+	if err := c.AddConsumer("a", r.consumer("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := (PartitionStats{Owner: "a", Offset: 5, Committed: 5}); c.Stats()[p] != want {
+		t.Errorf("stats = %+v, want %+v", c.Stats()[p], want)
+	}
+	if !reflect.DeepEqual(r.seen[key], []int{0, 1, 2, 3, 4}) {
+		t.Errorf("consumed %v", r.seen[key])
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := New(context.Background(), 5, keyOf)
+	defer c.Close(context.Background())
+
+	r := newRecorder()
+	c.AddConsumer("a", r.consumer("a"))
+	if got := c.Assignment(); !reflect.DeepEqual(got, map[string][]int{"a": {0, 1, 2, 3, 4}}) {
+		t.Errorf("assignment = %v", got)
+	}
+
+	// The new consumer only takes partitions from the old one
+	c.AddConsumer("b", r.consumer("b"))
+	if got := c.Assignment(); !reflect.DeepEqual(got, map[string][]int{"a": {0, 1, 2}, "b": {3, 4}}) {
+		t.Errorf("assignment = %v", got)
+	}
+	c.AddConsumer("c", r.consumer("c"))
+	if got := c.Assignment(); !reflect.DeepEqual(got, map[string][]int{"a": {0, 1}, "b": {3, 4}, "c": {2}}) {
+		t.Errorf("assignment = %v", got)
+	}
+
+	// The partitions of a removed consumer are shared among the others
+	c.RemoveConsumer("b")
+	if got := c.Assignment(); !reflect.DeepEqual(got, map[string][]int{"a": {0, 1, 3}, "c": {2, 4}}) {
+		t.Errorf("assignment = %v", got)
+	}
+
+	if err := c.AddConsumer("a", r.consumer("a")); err == nil {
+		t.Error("adding a consumer twice should fail")
+	}
+	if c.RemoveConsumer("b") {
+		t.Error("removing an unknown consumer should report false")
+	}
+}
+
+func TestMoreConsumersThanPartitions(t *testing.T) {
+	got := assign([]string{"", ""}, []string{"a", "b", "c"})
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("assign = %v", got)
+	}
+	got = assign([]string{"c", "b"}, []string{"a", "b", "c"})
+	if !reflect.DeepEqual(got, []string{"c", "b"}) {
+		t.Errorf("assign = %v, want owners kept", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := New(context.Background(), 1, keyOf, WithBuffer(0))
+
+	// A Send blocked on a partition without reader is released
+	errs := make(chan error)
+	go func() {
+		errs <- c.Send(context.Background(), msg{key: "k"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Send = %v, want ErrClosed", err)
+	}
+	if s := c.Stats()[0]; s.Offset != 0 {
+		t.Errorf("offset = %d, want the failed Send uncounted", s.Offset)
+	}
+
+	if err := c.Send(context.Background(), msg{key: "k"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send = %v, want ErrClosed", err)
+	}
+	if err := c.AddConsumer("a", newRecorder().consumer("a")); !errors.Is(err, ErrClosed) {
+		t.Errorf("AddConsumer = %v, want ErrClosed", err)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	r := newRecorder()
+	c := New(context.Background(), 4, keyOf)
+	c.AddConsumer("a", r.consumer("a"))
+
+	in := make(chan interface{}, 10)
+	for i := 0; i < 10; i++ {
+		in <- msg{key: "k", seq: i}
+	}
+	close(in)
+
+	if err := c.Route(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.seen["k"]) != 10 {
+		t.Errorf("consumed %d items, want 10", len(r.seen["k"]))
+	}
+}
+
+func TestConsumerSettings(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := New(context.Background(), 1, keyOf)
+
+	var mu sync.Mutex
+	var errs []error
+	boom := errors.New("boom")
+	consumer := producerconsumer.NewConsumer(0, 1)
+	consumer.ConsumeFunc = func(interface{}) error { return boom }
+	consumer.HandleError(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	c.AddConsumer("a", consumer)
+
+	c.Send(context.Background(), msg{key: "k"})
+	c.Close(context.Background())
+
+	if len(errs) != 1 || !errors.Is(errs[0], boom) {
+		t.Errorf("errors = %v, want the consumer's error handler called", errs)
+	}
+	if s := c.Stats()[0]; s.Committed != 1 {
+		t.Errorf("committed = %d, want failed items committed", s.Committed)
+	}
+}
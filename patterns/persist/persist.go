@@ -0,0 +1,241 @@
+// Package persist saves the state of limiters, pipelines and other
+// components to a single file, and restores it on startup.
+package persist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the format of the files written by a Saver.
+const Version = 1
+
+// ErrVersion is returned by LoadAll when the file was written in another
+// format.
+var ErrVersion = errors.New("persist: unsupported file version")
+
+// Snapshotter is implemented by components whose state can be saved and
+// restored.
+type Snapshotter interface {
+
+	// Snapshot returns the current state.
+	Snapshot() ([]byte, error)
+
+	// Restore replaces the state with one returned by Snapshot.
+	Restore(data []byte) error
+}
+
+// ComponentError reports the components that failed to snapshot or
+// restore, by name.
+type ComponentError struct {
+	Errors map[string]error
+}
+
+func (e *ComponentError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+	return "persist: " + strings.Join(msgs, "; ")
+}
+
+// Option configures a Saver.
+type Option func(*Saver)
+
+// WithInterval sets how often Run saves. The default is 10s.
+func WithInterval(d time.Duration) Option {
+	return func(s *Saver) {
+		s.interval = d
+	}
+}
+
+// WithErrorHandler sets a function receiving the errors of the saves made
+// by Run. By default they are dropped.
+func WithErrorHandler(fn func(error)) Option {
+	return func(s *Saver) {
+		s.onError = fn
+	}
+}
+
+// file is the persisted form of all components.
+type file struct {
+	Version int               `json:"version"`
+	SavedAt time.Time         `json:"saved_at"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+// Saver writes the snapshots of registered components to one file.
+type Saver struct {
+	path     string
+	interval time.Duration
+	onError  func(error)
+
+	// mu guards components and last, and serializes writes.
+	mu         sync.Mutex
+	components map[string]Snapshotter
+
+	// last holds the latest snapshot of every entry, so a component that
+	// fails to snapshot, or is not registered, keeps its saved state.
+	last map[string][]byte
+}
+
+// New creates a Saver writing to path.
+func New(path string, opts ...Option) *Saver {
+	s := &Saver{
+		path:       path,
+		interval:   10 * time.Second,
+		components: make(map[string]Snapshotter),
+		last:       make(map[string][]byte),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds a component under name, replacing any registered before.
+func (s *Saver) Register(name string, c Snapshotter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.components[name] = c
+}
+
+// LoadAll reads the file and restores every registered component saved
+// in it. A missing file is not an error. A component failing to restore
+// does not stop the others: their errors are returned together as a
+// *ComponentError. Temporary files left by an interrupted save are
+// removed.
+func (s *Saver) LoadAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeTemps()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("persist: decode %s: %w", s.path, err)
+	}
+	if f.Version != Version {
+		return fmt.Errorf("%w: %d", ErrVersion, f.Version)
+	}
+
+	errs := make(map[string]error)
+	for name, entry := range f.Entries {
+		s.last[name] = entry
+		if c, ok := s.components[name]; ok {
+			if err := c.Restore(entry); err != nil {
+				errs[name] = err
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &ComponentError{Errors: errs}
+	}
+	return nil
+}
+
+// Save writes the snapshots of all components to the file. It writes a
+// temporary file first and renames it over the old one, so a crash never
+// leaves a partial file behind. A component failing to snapshot keeps its
+// previous state in the file, and its error is returned in a
+// *ComponentError after the file is written.
+func (s *Saver) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make(map[string]error)
+	for name, c := range s.components {
+		data, err := c.Snapshot()
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		s.last[name] = data
+	}
+
+	f := file{Version: Version, SavedAt: time.Now(), Entries: s.last}
+	if err := s.write(f); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &ComponentError{Errors: errs}
+	}
+	return nil
+}
+
+// Run saves at every interval until ctx is done, then saves once more and
+// returns that save's error.
+func (s *Saver) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Save(); err != nil && s.onError != nil {
+				s.onError(err)
+			}
+		case <-ctx.Done():
+			return s.Save()
+		}
+	}
+}
+
+// write writes f to a temporary file next to the target and renames it
+// into place. Caller must hold the lock.
+func (s *Saver) write(f file) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// removeTemps deletes temporary files left by saves that did not finish.
+// Caller must hold the lock.
+func (s *Saver) removeTemps() {
+	temps, _ := filepath.Glob(s.path + ".tmp-*")
+	for _, name := range temps {
+		os.Remove(name)
+	}
+}
@@ -0,0 +1,228 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/counter"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+)
+
+// state is a Snapshotter holding a string.
+type state struct {
+	value string
+	err   error
+}
+
+func (s *state) Snapshot() ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []byte(s.value), nil
+}
+
+func (s *state) Restore(data []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.value = string(data)
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// A bucket that never fills, holding 3 tokens
+	bucket := tokenbucket.New(0, 10)
+	if err := bucket.Restore([]byte(`{"rate":0,"available":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	c := counter.New(10)
+	c.AllowN(4)
+
+	s := New(path)
+	s.Register("bucket", bucket)
+	s.Register("counter", c)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket2 := tokenbucket.New(0, 10)
+	c2 := counter.New(10)
+	s2 := New(path)
+	s2.Register("bucket", bucket2)
+	s2.Register("counter", c2)
+	if err := s2.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if bucket2.Available() != 3 {
+		t.Errorf("restored bucket has %d tokens, want 3", bucket2.Available())
+	}
+	want, _ := c.Snapshot()
+	if got, _ := c2.Snapshot(); string(got) != string(want) {
+		t.Errorf("restored counter = %s, want %s", got, want)
+	}
+
+	// The restored counter counts from the saved requests
+	if c2.Remaining() >= 10 {
+		t.Errorf("restored counter Remaining = %d, want the saved requests counted", c2.Remaining())
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "state.json"))
+	s.Register("a", &state{value: "initial"})
+	if err := s.LoadAll(); err != nil {
+		t.Errorf("LoadAll = %v, want nil for a missing file", err)
+	}
+}
+
+func TestCrashMidWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	s := New(path)
+	s.Register("a", &state{value: "saved"})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A save interrupted before its rename leaves a partial temp file
+	partial := path + ".tmp-12345"
+	if err := os.WriteFile(partial, []byte(`{"version":1,"entr`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &state{}
+	s2 := New(path)
+	s2.Register("a", a)
+	if err := s2.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if a.value != "saved" {
+		t.Errorf("restored %q, want the last complete save", a.value)
+	}
+	if _, err := os.Stat(partial); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial temp file was not removed: %v", err)
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"version":99,"entries":{"a":"eA=="}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &state{value: "initial"}
+	s := New(path)
+	s.Register("a", a)
+	if err := s.LoadAll(); !errors.Is(err, ErrVersion) {
+		t.Errorf("LoadAll = %v, want ErrVersion", err)
+	}
+	if a.value != "initial" {
+		t.Errorf("restored %q from a file of another version", a.value)
+	}
+}
+
+func TestCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(path).LoadAll(); err == nil {
+		t.Error("LoadAll should fail on a corrupt file")
+	}
+}
+
+func TestComponentErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s := New(path)
+	s.Register("good", &state{value: "g"})
+	s.Register("bad", &state{value: "b"})
+	s.Register("unregistered", &state{value: "u"})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// One entry failing to restore does not block the others
+	errBroken := errors.New("broken")
+	good, bad := &state{}, &state{err: errBroken}
+	s2 := New(path)
+	s2.Register("good", good)
+	s2.Register("bad", bad)
+
+	var cerr *ComponentError
+	if err := s2.LoadAll(); !errors.As(err, &cerr) {
+		t.Fatalf("LoadAll = %v, want a *ComponentError", err)
+	}
+	if len(cerr.Errors) != 1 || cerr.Errors["bad"] != errBroken {
+		t.Errorf("errors = %v, want only bad", cerr.Errors)
+	}
+	if good.value != "g" {
+		t.Errorf("good restored %q, want %q", good.value, "g")
+	}
+
+	// A failed snapshot and an unregistered entry keep their saved state
+	if err := s2.Save(); !errors.As(err, &cerr) || cerr.Errors["bad"] != errBroken {
+		t.Fatalf("Save = %v, want bad's error", err)
+	}
+	check := map[string]*state{"good": {}, "bad": {}, "unregistered": {}}
+	s3 := New(path)
+	for name, c := range check {
+		s3.Register(name, c)
+	}
+	if err := s3.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"good": "g", "bad": "b", "unregistered": "u"} {
+		if check[name].value != want {
+			t.Errorf("%s = %q, want %q", name, check[name].value, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	a := &state{value: "first"}
+	s := New(path, WithInterval(5*time.Millisecond))
+	s.Register("a", a)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	// Periodic saves write the file
+	for deadline := time.Now().Add(time.Second); ; {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Run did not save")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Stopping saves the latest state
+	s.mu.Lock()
+	a.value = "last"
+	s.mu.Unlock()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &state{}
+	s2 := New(path)
+	s2.Register("a", restored)
+	if err := s2.LoadAll(); err != nil || restored.value != "last" {
+		t.Errorf("LoadAll = %v, restored %q, want %q", err, restored.value, "last")
+	}
+}
@@ -0,0 +1,264 @@
+// Package pipeline provides composable generic pipeline stages.
+//
+// Each stage reads an input channel and returns an output channel that is
+// closed once the input is closed and drained. Cancelling ctx stops every
+// stage, closing its output without draining the input.
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/sequencer"
+)
+
+// Option configures a stage.
+type Option func(*config)
+
+type config struct {
+	ordered bool
+}
+
+// Ordered makes a stage emit its output in input order, even with several
+// workers. By default output is emitted as soon as each worker is done.
+func Ordered() Option {
+	return func(c *config) {
+		c.ordered = true
+	}
+}
+
+// Map applies fn to every item using the given number of workers.
+func Map[T, U any](ctx context.Context, in <-chan T, fn func(T) U, workers int, opts ...Option) <-chan U {
+	return run(ctx, in, workers, opts, func(v T, emit func(U) bool) bool {
+		return emit(fn(v))
+	})
+}
+
+// Filter keeps the items for which keep returns true, using the given
+// number of workers.
+func Filter[T any](ctx context.Context, in <-chan T, keep func(T) bool, workers int, opts ...Option) <-chan T {
+	return run(ctx, in, workers, opts, func(v T, emit func(T) bool) bool {
+		if keep(v) {
+			return emit(v)
+		}
+		return true
+	})
+}
+
+// FlatMap applies fn to every item using the given number of workers and
+// emits each item of the returned slices.
+func FlatMap[T, U any](ctx context.Context, in <-chan T, fn func(T) []U, workers int, opts ...Option) <-chan U {
+	return run(ctx, in, workers, opts, func(v T, emit func(U) bool) bool {
+		for _, u := range fn(v) {
+			if !emit(u) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Batch groups items into slices of up to size items. A partial batch is
+// emitted once interval has passed since its first item, and when in is
+// closed. A non-positive interval only emits full batches and the last one.
+func Batch[T any](ctx context.Context, in <-chan T, size int, interval time.Duration) <-chan []T {
+	if size < 1 {
+		size = 1
+	}
+	out := make(chan []T)
+
+	go func() {
+		defer close(out)
+
+		var batch []T
+		var timer *time.Timer
+		var timeout <-chan time.Time
+
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+			if len(batch) == 0 {
+				return true
+			}
+			b := batch
+			batch = nil
+			return send(ctx, out, b)
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+
+				// Start the interval with the first item of a batch
+				if len(batch) == 0 && interval > 0 {
+					timer = time.NewTimer(interval)
+					timeout = timer.C
+				}
+
+				batch = append(batch, v)
+				if len(batch) >= size && !flush() {
+					return
+				}
+
+			case <-timeout:
+				timer, timeout = nil, nil
+				if !flush() {
+					return
+				}
+
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// process handles one item, passing each output to emit. It returns false
+// once emit does, which means the stage was cancelled.
+type process[T, U any] func(v T, emit func(U) bool) bool
+
+// run starts the workers of a stage.
+func run[T, U any](ctx context.Context, in <-chan T, workers int, opts []Option, p process[T, U]) <-chan U {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	if c.ordered {
+		return runOrdered(ctx, in, workers, p)
+	}
+
+	out := make(chan U)
+	emit := func(u U) bool { return send(ctx, out, u) }
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, ok := receive(ctx, in)
+				if !ok || !p(v, emit) {
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// runOrdered starts the workers of an ordered stage.
+//
+// A dispatcher numbers the items and hands them to the workers, whose
+// outputs sequencer.Reorder puts back in input order. The dispatcher takes
+// a token per item, returned once the item's outputs are emitted, which
+// bounds how far the workers can get ahead of the slowest item and so the
+// reorder buffer.
+func runOrdered[T, U any](ctx context.Context, in <-chan T, workers int, p process[T, U]) <-chan U {
+	window := 2 * workers
+	out := make(chan U)
+	jobs := make(chan sequencer.Indexed[T])
+	results := make(chan sequencer.Indexed[[]U])
+	tokens := make(chan struct{}, window)
+
+	// Dispatcher
+	go func() {
+		defer close(jobs)
+
+		for seq := uint64(0); ; seq++ {
+			if !send(ctx, tokens, struct{}{}) {
+				return
+			}
+			v, ok := receive(ctx, in)
+			if !ok {
+				return
+			}
+			if !send(ctx, jobs, sequencer.Indexed[T]{Seq: seq, Value: v}) {
+				return
+			}
+		}
+	}()
+
+	// Workers
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var us []U
+				p(j.Value, func(u U) bool {
+					us = append(us, u)
+					return true
+				})
+				if !send(ctx, results, sequencer.Indexed[[]U]{Seq: j.Seq, Value: us}) {
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Collector
+	go func() {
+		defer close(out)
+
+		for us := range sequencer.Reorder(ctx, results, window) {
+			for _, u := range us {
+				if !send(ctx, out, u) {
+					return
+				}
+			}
+			<-tokens
+		}
+	}()
+
+	return out
+}
+
+// receive reads the next item of in. It returns false if in is closed or
+// ctx is cancelled.
+func receive[T any](ctx context.Context, in <-chan T) (T, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// send writes v to out. It returns false if ctx is cancelled first.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// source sends 0..n-1 to a new channel and closes it.
+func source(ctx context.Context, n int) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 0; i < n; i++ {
+			select {
+			case ch <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func collect[T any](in <-chan T) []T {
+	var got []T
+	for v := range in {
+		got = append(got, v)
+	}
+	return got
+}
+
+// jitter sleeps for a random short time, so workers finish out of order.
+func jitter() {
+	time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+}
+
+func TestMapUnordered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx := context.Background()
+	got := collect(Map(ctx, source(ctx, 100), func(v int) int {
+		jitter()
+		return v * 2
+	}, 4))
+
+	sort.Ints(got)
+	if len(got) != 100 {
+		t.Fatalf("got %d items, want 100", len(got))
+	}
+	for i, v := range got {
+		if v != i*2 {
+			t.Fatalf("item %d = %d, want %d", i, v, i*2)
+		}
+	}
+}
+
+func TestMapOrdered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx := context.Background()
+	got := collect(Map(ctx, source(ctx, 200), func(v int) int {
+		jitter()
+		return v * 2
+	}, 8, Ordered()))
+
+	if len(got) != 200 {
+		t.Fatalf("got %d items, want 200", len(got))
+	}
+	for i, v := range got {
+		if v != i*2 {
+			t.Fatalf("item %d = %d, want %d", i, v, i*2)
+		}
+	}
+}
+
+func TestFlatMapOrdered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx := context.Background()
+
+	// 0 -> [], 1 -> [1], 2 -> [2 2], ...
+	got := collect(FlatMap(ctx, source(ctx, 5), func(v int) []int {
+		jitter()
+		out := make([]int, v)
+		for i := range out {
+			out[i] = v
+		}
+		return out
+	}, 3, Ordered()))
+
+	want := []int{1, 2, 2, 3, 3, 3, 4, 4, 4, 4}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMapOrderedBounded(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx := context.Background()
+	release := make(chan struct{})
+	var started atomic.Int32
+
+	// The first item is slow; the workers only get so far ahead of it
+	out := Map(ctx, source(ctx, 100), func(v int) int {
+		started.Add(1)
+		if v == 0 {
+			<-release
+		}
+		return v
+	}, 4, Ordered())
+
+	time.Sleep(20 * time.Millisecond)
+	if n := started.Load(); n > 8 {
+		t.Errorf("%d items started while the first was pending, want at most 8", n)
+	}
+	close(release)
+
+	got := collect(out)
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("item %d = %d, want %d", i, v, i)
+		}
+	}
+}
+
+func TestBatchInterval(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan int)
+	out := Batch(context.Background(), in, 10, 20*time.Millisecond)
+
+	// A partial batch is flushed after the interval
+	in <- 1
+	in <- 2
+	select {
+	case b := <-out:
+		if len(b) != 2 {
+			t.Errorf("batch = %v, want [1 2]", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("partial batch was not flushed")
+	}
+
+	// The last batch is flushed on close
+	in <- 3
+	close(in)
+	if b := <-out; len(b) != 1 || b[0] != 3 {
+		t.Errorf("batch = %v, want [3]", b)
+	}
+	if _, ok := <-out; ok {
+		t.Error("output should be closed")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx := context.Background()
+
+	// Square, keep the even ones, group in fours
+	squares := Map(ctx, source(ctx, 20), func(v int) int { return v * v }, 4, Ordered())
+	even := Filter(ctx, squares, func(v int) bool { return v%2 == 0 }, 2, Ordered())
+	batches := collect(Batch(ctx, even, 4, 0))
+
+	want := [][]int{{0, 4, 16, 36}, {64, 100, 144, 196}, {256, 324}}
+	if len(batches) != len(want) {
+		t.Fatalf("got %v, want %v", batches, want)
+	}
+	for i := range want {
+		if len(batches[i]) != len(want[i]) {
+			t.Fatalf("got %v, want %v", batches, want)
+		}
+		for j := range want[i] {
+			if batches[i][j] != want[i][j] {
+				t.Fatalf("got %v, want %v", batches, want)
+			}
+		}
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// An endless source, read just once
+	endless := make(chan int)
+	go func() {
+		defer close(endless)
+		for i := 0; ; i++ {
+			select {
+			case endless <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	id := func(v int) int { return v }
+	unordered := Map(ctx, endless, id, 4)
+	ordered := Map(ctx, unordered, id, 4, Ordered())
+	flat := FlatMap(ctx, ordered, func(v int) []int { return []int{v, v} }, 2)
+	filtered := Filter(ctx, flat, func(int) bool { return true }, 2)
+	out := Batch(ctx, filtered, 3, time.Millisecond)
+	<-out
+
+	// Every stage stops and closes its output
+	cancel()
+	for range out {
+	}
+}
+
+func benchmarkMap(b *testing.B, opts ...Option) {
+	ctx := context.Background()
+	out := Map(ctx, source(ctx, b.N), func(v int) int { return v * 2 }, 4, opts...)
+
+	b.ResetTimer()
+	for range out {
+	}
+}
+
+func BenchmarkMapUnordered(b *testing.B) { benchmarkMap(b) }
+func BenchmarkMapOrdered(b *testing.B)   { benchmarkMap(b, Ordered()) }
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// Clock supplies the current time and timers to the window stages.
+type Clock interface {
+	Now() time.Time
+
+	// At returns a channel receiving the time once t has passed.
+	At(t time.Time) <-chan time.Time
+}
+
+// realClock uses the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) At(t time.Time) <-chan time.Time {
+	return time.After(time.Until(t))
+}
+
+// WindowOption configures Tumbling and Sliding.
+type WindowOption func(*windowConfig)
+
+type windowConfig struct {
+	clock     Clock
+	eventTime interface{}
+	late      interface{}
+}
+
+// WithClock sets the clock that closes windows. The default reads the
+// system clock.
+func WithClock(c Clock) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.clock = c
+	}
+}
+
+// WithEventTime places items in windows by the time fn returns for them,
+// instead of the time they arrive. Items may then arrive late, after
+// their windows closed. Its type must match the stage's items.
+func WithEventTime[T any](fn func(T) time.Time) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.eventTime = fn
+	}
+}
+
+// WithLate sends items arriving after all their windows closed to late,
+// instead of dropping them. Its type must match the stage's items.
+func WithLate[T any](late chan<- T) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.late = late
+	}
+}
+
+// Tumbling aggregates items into consecutive windows of length every,
+// starting when the stage starts, and emits the aggregate of each window
+// when it closes. Each window starts from the zero value of A and folds
+// its items with agg. Windows close on the clock, so quiet windows are
+// emitted too, with the zero value. When in is closed, the open window is
+// emitted as is.
+func Tumbling[T, A any](ctx context.Context, in <-chan T, every time.Duration, agg func(A, T) A, opts ...WindowOption) <-chan A {
+	return Sliding(ctx, in, every, every, agg, opts...)
+}
+
+// Sliding aggregates items into windows of length size starting every
+// step, so each item counts in size/step overlapping windows, and emits
+// the aggregate of each window when it closes. size must be a multiple of
+// step. Windows are otherwise handled like in Tumbling; the first windows
+// started before the stage and only cover part of their length.
+//
+// An item is late once every window it belongs to has closed. With
+// WithLate it is sent there, else it is dropped.
+func Sliding[T, A any](ctx context.Context, in <-chan T, size, step time.Duration, agg func(A, T) A, opts ...WindowOption) <-chan A {
+	if step <= 0 || size < step || size%step != 0 {
+		panic(fmt.Errorf("pipeline: window size %v must be a positive multiple of step %v", size, step))
+	}
+
+	cfg := windowConfig{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	eventTime, late := windowTypes[T](cfg)
+
+	out := make(chan A)
+	start := cfg.clock.Now()
+	timeout := cfg.clock.At(start.Add(step))
+
+	go func() {
+		defer close(out)
+
+		// Ring slot k accumulates the window starting at start+k*step. The
+		// oldest window held closes once the head moves past it.
+		ring := window.NewRing[A](int(size / step))
+		slotOf := func(t time.Time) int {
+			d := t.Sub(start)
+			k := d / step
+			if d < 0 && d%step != 0 {
+				k--
+			}
+			return int(k)
+		}
+
+		cancelled := false
+		emit := func(_ int, a A) {
+			if !cancelled && !send(ctx, out, a) {
+				cancelled = true
+			}
+		}
+
+		for !cancelled {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					// Emit every open window
+					ring.Advance(ring.Head()+ring.Len(), emit)
+					return
+				}
+
+				t := cfg.clock.Now()
+				if eventTime != nil {
+					t = eventTime(v)
+				}
+
+				// An item from the future closes the windows before it
+				slot := slotOf(t)
+				ring.Advance(slot, emit)
+
+				// Fold into every open window containing t
+				folded := false
+				for k := slot - ring.Len() + 1; k <= slot; k++ {
+					if a := ring.At(k); a != nil {
+						*a = agg(*a, v)
+						folded = true
+					}
+				}
+				if !folded && late != nil && !send(ctx, late, v) {
+					return
+				}
+
+			case now := <-timeout:
+				ring.Advance(slotOf(now), emit)
+				timeout = cfg.clock.At(start.Add(time.Duration(ring.Head()+1) * step))
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// windowTypes returns the event time function and late channel of cfg,
+// checking they match the items.
+func windowTypes[T any](cfg windowConfig) (func(T) time.Time, chan<- T) {
+	var eventTime func(T) time.Time
+	if cfg.eventTime != nil {
+		fn, ok := cfg.eventTime.(func(T) time.Time)
+		if !ok {
+			panic(fmt.Errorf("pipeline: event time function %T does not match items of type %T", cfg.eventTime, *new(T)))
+		}
+		eventTime = fn
+	}
+
+	var late chan<- T
+	if cfg.late != nil {
+		ch, ok := cfg.late.(chan<- T)
+		if !ok {
+			panic(fmt.Errorf("pipeline: late channel %T does not match items of type %T", cfg.late, *new(T)))
+		}
+		late = ch
+	}
+
+	return eventTime, late
+}
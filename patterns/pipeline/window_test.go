@@ -0,0 +1,274 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) At(t time.Time) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if !c.now.Before(t) {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{at: t, c: ch})
+	return ch
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if c.now.Before(w.at) {
+			kept = append(kept, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = kept
+}
+
+// event is an item with its event time, as an offset from the clock's
+// start.
+type event struct {
+	at time.Duration
+	n  int
+}
+
+func sum(total int, e event) int {
+	return total + e.n
+}
+
+// expectWindow receives the next window and checks it is want.
+func expectWindow(t *testing.T, out <-chan int, want int) {
+	t.Helper()
+	select {
+	case got, ok := <-out:
+		if !ok {
+			t.Fatalf("output closed, want %d", want)
+		}
+		if got != want {
+			t.Fatalf("window = %d, want %d", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no window, want %d", want)
+	}
+}
+
+// expectNone checks that no window is emitted for a moment.
+func expectNone(t *testing.T, out <-chan int) {
+	t.Helper()
+	select {
+	case got := <-out:
+		t.Fatalf("got window %d, want none yet", got)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func eventTimeFrom(clock *fakeClock) WindowOption {
+	start := clock.Now()
+	return WithEventTime(func(e event) time.Time { return start.Add(e.at) })
+}
+
+func TestTumbling(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	in := make(chan event)
+	out := Tumbling(context.Background(), in, time.Second, sum, WithClock(clock), eventTimeFrom(clock))
+
+	// Window [0s, 1s): the boundary item belongs to the next window
+	in <- event{at: 0, n: 1}
+	in <- event{at: 999 * time.Millisecond, n: 2}
+	in <- event{at: time.Second, n: 4}
+	expectWindow(t, out, 3)
+
+	// The clock closes [1s, 2s)
+	expectNone(t, out)
+	clock.Add(2 * time.Second)
+	expectWindow(t, out, 4)
+
+	// A quiet period still emits empty windows
+	clock.Add(2 * time.Second)
+	expectWindow(t, out, 0)
+	expectWindow(t, out, 0)
+
+	// Closing the input emits the open window
+	in <- event{at: 4500 * time.Millisecond, n: 8}
+	close(in)
+	expectWindow(t, out, 8)
+	if _, ok := <-out; ok {
+		t.Error("output should be closed")
+	}
+}
+
+func TestTumblingLate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	in := make(chan event)
+	late := make(chan event, 1)
+	out := Tumbling(context.Background(), in, time.Second, sum,
+		WithClock(clock), eventTimeFrom(clock), WithLate[event](late))
+
+	in <- event{at: 500 * time.Millisecond, n: 1}
+	clock.Add(time.Second)
+	expectWindow(t, out, 1)
+
+	// [0s, 1s) closed: the item goes to late, not to [1s, 2s)
+	in <- event{at: 700 * time.Millisecond, n: 2}
+	in <- event{at: 1200 * time.Millisecond, n: 4}
+	select {
+	case e := <-late:
+		if e.n != 2 {
+			t.Errorf("late item = %+v, want n 2", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("late item not routed")
+	}
+
+	clock.Add(time.Second)
+	expectWindow(t, out, 4)
+
+	close(in)
+	for range out {
+	}
+}
+
+func TestTumblingLateDropped(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	in := make(chan event)
+	out := Tumbling(context.Background(), in, time.Second, sum, WithClock(clock), eventTimeFrom(clock))
+
+	clock.Add(time.Second)
+	expectWindow(t, out, 0)
+
+	in <- event{at: 100 * time.Millisecond, n: 1}
+	close(in)
+	expectWindow(t, out, 0)
+}
+
+func TestSliding(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	in := make(chan event)
+	late := make(chan event, 1)
+
+	// Windows of 3s every 1s: [-2s, 1s), [-1s, 2s), [0s, 3s), [1s, 4s), ...
+	out := Sliding(context.Background(), in, 3*time.Second, time.Second, sum,
+		WithClock(clock), eventTimeFrom(clock), WithLate[event](late))
+
+	in <- event{at: 500 * time.Millisecond, n: 1}
+	in <- event{at: 1500 * time.Millisecond, n: 10}
+
+	// The item at 1.5s closed [-2s, 1s)
+	expectWindow(t, out, 1)
+
+	clock.Add(2 * time.Second)
+	expectWindow(t, out, 11) // [-1s, 2s)
+
+	// Only partly late: [0s, 3s) and [1s, 4s) are still open
+	in <- event{at: 1200 * time.Millisecond, n: 100}
+
+	clock.Add(time.Second)
+	expectWindow(t, out, 111) // [0s, 3s)
+
+	// Entirely late: [-1s, 2s) was its last window
+	in <- event{at: -500 * time.Millisecond, n: 1000}
+	select {
+	case e := <-late:
+		if e.n != 1000 {
+			t.Errorf("late item = %+v, want n 1000", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("late item not routed")
+	}
+
+	close(in)
+	expectWindow(t, out, 110) // [1s, 4s)
+	expectWindow(t, out, 0)   // [2s, 5s)
+	expectWindow(t, out, 0)   // [3s, 6s)
+	if _, ok := <-out; ok {
+		t.Error("output should be closed")
+	}
+}
+
+func TestTumblingArrivalTime(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	in := make(chan int)
+	out := Tumbling(context.Background(), in, time.Second, func(n, _ int) int { return n + 1 }, WithClock(clock))
+
+	for i := 0; i < 5; i++ {
+		in <- i
+	}
+	close(in)
+
+	total := 0
+	for n := range out {
+		total += n
+	}
+	if total != 5 {
+		t.Errorf("counted %d items, want 5", total)
+	}
+}
+
+func TestWindowCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	clock := newFakeClock()
+	out := Tumbling(ctx, make(chan int), time.Second, func(n, _ int) int { return n + 1 }, WithClock(clock))
+
+	// Nobody reads the window
+	clock.Add(time.Second)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	for range out {
+	}
+}
+
+func TestSlidingInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Sliding() should panic when size is not a multiple of step")
+		}
+	}()
+	Sliding(context.Background(), make(chan int), 3*time.Second, 2*time.Second, func(n, _ int) int { return n })
+}
@@ -0,0 +1,262 @@
+// Package priority implements a channel-like queue whose receivers always
+// get the highest-priority item available.
+package priority
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by Send after Close, and by Receive once the
+	// channel is closed and drained.
+	ErrClosed = errors.New("priority channel is closed")
+
+	// ErrFull is returned by Send under RejectLowest when the channel is
+	// full and the item's priority is not above the lowest queued one.
+	ErrFull = errors.New("priority channel is full")
+)
+
+// Policy decides what Send does when the channel is full.
+type Policy int
+
+const (
+	// Block makes the sender wait for room, or for its ctx to be done.
+	Block Policy = iota
+
+	// RejectLowest drops the lowest-priority item, which is either the
+	// queued item with the lowest priority or the one being sent.
+	RejectLowest
+)
+
+// Option configures a PriorityChannel.
+type Option func(*config)
+
+type config struct {
+	policy Policy
+	aging  time.Duration
+}
+
+// WithPolicy sets what Send does when the channel is full. The default is
+// Block.
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// WithAging raises the priority of queued items by one for every d they
+// wait, so a steady stream of high-priority items cannot starve lower ones
+// forever. Without it priorities are fixed.
+func WithAging(d time.Duration) Option {
+	return func(c *config) {
+		c.aging = d
+	}
+}
+
+// PriorityChannel is a bounded queue of items ordered by priority, higher
+// first. Items of equal priority are received in the order they were sent.
+type PriorityChannel[T any] struct {
+	config
+
+	capacity int
+
+	// mu guards all fields below. notEmpty and notFull wait on it.
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	items   itemHeap[T]
+	seq     uint64
+	start   time.Time
+	closed  bool
+	dropped uint64
+}
+
+// New creates a PriorityChannel holding up to capacity items. A capacity
+// of zero or less means unbounded.
+func New[T any](capacity int, opts ...Option) *PriorityChannel[T] {
+	c := &PriorityChannel[T]{
+		capacity: capacity,
+		start:    time.Now(),
+	}
+	for _, opt := range opts {
+		opt(&c.config)
+	}
+	c.notEmpty = sync.NewCond(&c.mu)
+	c.notFull = sync.NewCond(&c.mu)
+	return c
+}
+
+// Send queues item with the given priority. When the channel is full it
+// blocks or drops an item, depending on the Policy. It returns ErrClosed
+// after Close, ErrFull if the item was rejected, or the context error if
+// ctx is done while waiting.
+func (c *PriorityChannel[T]) Send(ctx context.Context, item T, priority int) error {
+	// Wake the waiters when ctx is done, so they can give up
+	stop := context.AfterFunc(ctx, c.wakeAll)
+	defer stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		if c.closed {
+			return ErrClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !c.full() {
+			break
+		}
+		if c.policy == RejectLowest {
+			return c.replaceLowest(item, priority)
+		}
+		c.notFull.Wait()
+	}
+
+	heap.Push(&c.items, c.newItem(item, priority))
+	c.notEmpty.Signal()
+	return nil
+}
+
+// Receive returns the highest-priority item, waiting for one if the
+// channel is empty. Once the channel is closed it keeps returning queued
+// items, then ErrClosed. It returns the context error if ctx is done while
+// waiting.
+func (c *PriorityChannel[T]) Receive(ctx context.Context) (T, error) {
+	stop := context.AfterFunc(ctx, c.wakeAll)
+	defer stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	for c.items.Len() == 0 {
+		if c.closed {
+			return zero, ErrClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+		c.notEmpty.Wait()
+	}
+
+	it := heap.Pop(&c.items).(*item[T])
+	c.notFull.Signal()
+	return it.value, nil
+}
+
+// Len returns the number of queued items.
+func (c *PriorityChannel[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items.Len()
+}
+
+// Dropped returns how many items RejectLowest has discarded, counting both
+// evicted queued items and rejected sends.
+func (c *PriorityChannel[T]) Dropped() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// Close stops further sends. Receivers get the queued items, then
+// ErrClosed. Unlike closing a channel, closing twice is allowed.
+func (c *PriorityChannel[T]) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	c.notEmpty.Broadcast()
+	c.notFull.Broadcast()
+}
+
+// full reports whether the channel is at capacity. c.mu must be held.
+func (c *PriorityChannel[T]) full() bool {
+	return c.capacity > 0 && c.items.Len() >= c.capacity
+}
+
+// replaceLowest makes room for item by evicting the lowest-ranked queued
+// item, or rejects item if it ranks no higher. The scan is linear, which
+// is fine for the bounded sizes the policy applies to. c.mu must be held.
+func (c *PriorityChannel[T]) replaceLowest(value T, priority int) error {
+	it := c.newItem(value, priority)
+	c.dropped++
+
+	lowest := 0
+	for i := 1; i < len(c.items); i++ {
+		if c.items.Less(lowest, i) {
+			lowest = i
+		}
+	}
+	if !it.before(c.items[lowest]) {
+		return ErrFull
+	}
+
+	heap.Remove(&c.items, lowest)
+	heap.Push(&c.items, it)
+	c.notEmpty.Signal()
+	return nil
+}
+
+// newItem wraps value, computing its rank. c.mu must be held.
+func (c *PriorityChannel[T]) newItem(value T, priority int) *item[T] {
+	c.seq++
+	rank := float64(priority)
+	if c.aging > 0 {
+		// An item's effective priority is priority + waited/aging. All items
+		// age at the same rate, so ordering by priority - sentAt/aging is
+		// the same at any time and the heap stays valid.
+		rank -= float64(time.Since(c.start)) / float64(c.aging)
+	}
+	return &item[T]{value: value, rank: rank, seq: c.seq}
+}
+
+// wakeAll wakes every waiter so they can recheck their context.
+func (c *PriorityChannel[T]) wakeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notEmpty.Broadcast()
+	c.notFull.Broadcast()
+}
+
+type item[T any] struct {
+	value T
+	rank  float64
+	seq   uint64
+}
+
+// before reports whether it should be received before other: higher rank
+// first, then FIFO.
+func (it *item[T]) before(other *item[T]) bool {
+	if it.rank != other.rank {
+		return it.rank > other.rank
+	}
+	return it.seq < other.seq
+}
+
+// itemHeap implements heap.Interface with the next item to receive on top.
+type itemHeap[T any] []*item[T]
+
+func (h itemHeap[T]) Len() int           { return len(h) }
+func (h itemHeap[T]) Less(i, j int) bool { return h[i].before(h[j]) }
+func (h itemHeap[T]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *itemHeap[T]) Push(x any) {
+	*h = append(*h, x.(*item[T]))
+}
+
+func (h *itemHeap[T]) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return it
+}
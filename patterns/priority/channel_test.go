@@ -0,0 +1,221 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrdering(t *testing.T) {
+	c := New[string](10)
+	ctx := context.Background()
+
+	c.Send(ctx, "low", 1)
+	c.Send(ctx, "high", 10)
+	c.Send(ctx, "mid", 5)
+
+	for _, want := range []string{"high", "mid", "low"} {
+		got, err := c.Receive(ctx)
+		if err != nil || got != want {
+			t.Fatalf("Receive() = %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestFIFOWithinLevel(t *testing.T) {
+	c := New[int](0)
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		c.Send(ctx, i, i%2)
+	}
+
+	// Odd items have the higher priority, each level in send order
+	for _, start := range []int{1, 0} {
+		for want := start; want < 100; want += 2 {
+			got, _ := c.Receive(ctx)
+			if got != want {
+				t.Fatalf("Receive() = %d, want %d", got, want)
+			}
+		}
+	}
+}
+
+func TestConcurrentSenders(t *testing.T) {
+	const senders, perSender = 8, 200
+
+	c := New[[2]int](0)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				c.Send(ctx, [2]int{s, i}, i%5)
+			}
+		}(s)
+	}
+	wg.Wait()
+	c.Close()
+
+	// Priorities never increase, and each sender's items of one level
+	// come out in the order that sender sent them
+	lastPriority := 5
+	lastIndex := make(map[[2]int]int)
+	n := 0
+	for {
+		v, err := c.Receive(ctx)
+		if errors.Is(err, ErrClosed) {
+			break
+		}
+		n++
+
+		p := v[1] % 5
+		if p > lastPriority {
+			t.Fatalf("priority %d received after %d", p, lastPriority)
+		}
+		lastPriority = p
+
+		key := [2]int{v[0], p}
+		if last, ok := lastIndex[key]; ok && v[1] < last {
+			t.Fatalf("sender %d: item %d received after %d", v[0], v[1], last)
+		}
+		lastIndex[key] = v[1]
+	}
+	if n != senders*perSender {
+		t.Errorf("received %d items, want %d", n, senders*perSender)
+	}
+}
+
+func TestBlockWhenFull(t *testing.T) {
+	c := New[int](1)
+	ctx := context.Background()
+
+	c.Send(ctx, 1, 0)
+
+	sent := make(chan error)
+	go func() {
+		sent <- c.Send(ctx, 2, 0)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("Send should block while full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.Receive(ctx)
+	if err := <-sent; err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	if got, _ := c.Receive(ctx); got != 2 {
+		t.Errorf("Receive() = %d, want 2", got)
+	}
+}
+
+func TestSendCancel(t *testing.T) {
+	c := New[int](1)
+	c.Send(context.Background(), 1, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Send(ctx, 2, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestReceiveCancel(t *testing.T) {
+	c := New[int](1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Receive() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRejectLowest(t *testing.T) {
+	c := New[string](2, WithPolicy(RejectLowest))
+	ctx := context.Background()
+
+	c.Send(ctx, "a", 5)
+	c.Send(ctx, "b", 1)
+
+	// Not above the lowest queued item
+	if err := c.Send(ctx, "c", 1); !errors.Is(err, ErrFull) {
+		t.Errorf("Send() = %v, want %v", err, ErrFull)
+	}
+
+	// Evicts "b"
+	if err := c.Send(ctx, "d", 3); err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+
+	for _, want := range []string{"a", "d"} {
+		if got, _ := c.Receive(ctx); got != want {
+			t.Errorf("Receive() = %q, want %q", got, want)
+		}
+	}
+	if got := c.Dropped(); got != 2 {
+		t.Errorf("Dropped() = %d, want 2", got)
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	c := New[int](10)
+	ctx := context.Background()
+
+	c.Send(ctx, 1, 1)
+	c.Send(ctx, 2, 2)
+	c.Close()
+	c.Close()
+
+	if err := c.Send(ctx, 3, 3); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send() = %v, want %v", err, ErrClosed)
+	}
+	for _, want := range []int{2, 1} {
+		if got, err := c.Receive(ctx); err != nil || got != want {
+			t.Errorf("Receive() = %d, %v, want %d", got, err, want)
+		}
+	}
+	if _, err := c.Receive(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Receive() = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestCloseWakesWaiters(t *testing.T) {
+	c := New[int](1)
+	ctx := context.Background()
+
+	received := make(chan error)
+	go func() {
+		_, err := c.Receive(ctx)
+		received <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+
+	if err := <-received; !errors.Is(err, ErrClosed) {
+		t.Errorf("Receive() = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestAging(t *testing.T) {
+	c := New[string](0, WithAging(10*time.Millisecond))
+	ctx := context.Background()
+
+	c.Send(ctx, "old", 1)
+	time.Sleep(50 * time.Millisecond)
+
+	// "old" has aged about five levels, past a fresh priority 3
+	c.Send(ctx, "new", 3)
+
+	if got, _ := c.Receive(ctx); got != "old" {
+		t.Errorf("Receive() = %q, want %q", got, "old")
+	}
+}
@@ -0,0 +1,174 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/signal"
+)
+
+// Autoscale makes Run grow and shrink its goroutines with the occupancy
+// of Buffer or Queue, the share of its capacity holding items. A Consumer
+// adds a goroutine while occupancy is above HighWater and retires one
+// below LowWater; a Producer, filling it, does the opposite. A Queue must
+// have a Cap method to be measured.
+//
+// Run starts NumProcs goroutines, within MinProcs and MaxProcs, then
+// checks the occupancy every Interval and moves one goroutine at a time.
+// A retired goroutine returns once it finished the item in hand, before
+// reading or producing another. Once a goroutine returns by itself, such
+// as after the input is closed or ProduceFunc has no more data, Run stops
+// adding goroutines.
+type Autoscale struct {
+
+	// MinProcs and MaxProcs bound the goroutines. MinProcs below 1 means
+	// 1, and MaxProcs below MinProcs means MinProcs.
+	MinProcs int
+	MaxProcs int
+
+	// HighWater and LowWater are occupancies between 0 and 1.
+	HighWater float64
+	LowWater  float64
+
+	// Interval is the time between checks. It defaults to a second.
+	Interval time.Duration
+}
+
+// retireKey is the context key of the signal retiring a goroutine of Run.
+type retireKey struct{}
+
+// retirement returns the signal closed once the goroutine running with
+// ctx is retired, or nil if it never is.
+func retirement(ctx context.Context) *signal.Done {
+	retire, _ := ctx.Value(retireKey{}).(*signal.Done)
+	return retire
+}
+
+// bounds returns MinProcs and MaxProcs with their defaults.
+func (a *Autoscale) bounds() (int, int) {
+	lo, hi := a.MinProcs, a.MaxProcs
+	if lo < 1 {
+		lo = 1
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// run runs n goroutines of runProc, within the bounds, then every
+// Interval adds one while grow reports true or retires one while shrink
+// does, emitting the new number of goroutines with emit. It returns once
+// all of them returned.
+func (a *Autoscale) run(ctx context.Context, n int, runProc func(context.Context, *sync.WaitGroup), grow, shrink func() bool, emit func(EventKind, interface{})) {
+	lo, hi := a.bounds()
+	if n < lo {
+		n = lo
+	}
+	if n > hi {
+		n = hi
+	}
+	interval := a.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var wg sync.WaitGroup
+	exited := make(chan *signal.Done)
+	var retirers []*signal.Done
+	running := 0
+	start := func() {
+		retire := signal.New()
+		retirers = append(retirers, retire)
+		running++
+		wg.Add(1)
+		go func() {
+			runProc(context.WithValue(ctx, retireKey{}, retire), &wg)
+			exited <- retire
+		}()
+	}
+	for i := 0; i < n; i++ {
+		start()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ended := false
+	for running > 0 {
+		select {
+		case retire := <-exited:
+			running--
+
+			// Not retired, so the goroutines are done with the input
+			if retire.Close(nil) {
+				ended = true
+				for i, r := range retirers {
+					if r == retire {
+						retirers = append(retirers[:i], retirers[i+1:]...)
+						break
+					}
+				}
+			}
+
+		case <-ticker.C:
+			if ctx.Err() != nil {
+				continue
+			}
+			switch {
+			case !ended && len(retirers) < hi && grow():
+				start()
+				emit(WorkerAdded, len(retirers))
+			case len(retirers) > lo && shrink():
+				retirers[len(retirers)-1].Close(nil)
+				retirers = retirers[:len(retirers)-1]
+				emit(WorkerRetired, len(retirers))
+			}
+		}
+	}
+	wg.Wait()
+}
+
+// occupancy returns the share of the capacity of q if set, or else of
+// buffer, holding items. The second return value is false if the
+// capacity is unknown or zero.
+func occupancy[T any](buffer chan T, q QueueOf[T]) (float64, bool) {
+	c := bufferCap(buffer, q)
+	if c <= 0 {
+		return 0, false
+	}
+	return float64(buffered(buffer, q)) / float64(c), true
+}
+
+// autoscale runs the processing goroutines following Autoscale.
+func (c *ConsumerOf[T]) autoscale(ctx context.Context) {
+	a := c.Autoscale
+	runProc := func(ctx context.Context, wg *sync.WaitGroup) {
+		c.emit(ConsumerStarted, nil)
+		c.runProc(ctx, wg)
+	}
+	grow := func() bool {
+		o, ok := occupancy(c.Buffer, c.Queue)
+		return ok && o > a.HighWater
+	}
+	shrink := func() bool {
+		o, ok := occupancy(c.Buffer, c.Queue)
+		return ok && o < a.LowWater
+	}
+	a.run(ctx, c.NumProcs, runProc, grow, shrink, c.emit)
+}
+
+// autoscale runs the goroutines of run following Autoscale.
+func (p *ProducerOf[T]) autoscale(ctx context.Context, runProc func(context.Context, *sync.WaitGroup)) {
+	a := p.Autoscale
+	grow := func() bool {
+		o, ok := occupancy(p.Buffer, p.Queue)
+		return ok && o < a.LowWater
+	}
+	shrink := func() bool {
+		o, ok := occupancy(p.Buffer, p.Queue)
+		return ok && o > a.HighWater
+	}
+	a.run(ctx, p.NumProcs, runProc, grow, shrink, p.emit)
+}
@@ -0,0 +1,169 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scaleEvents records the scaling events, safe for concurrent use.
+type scaleEvents struct {
+	mu     sync.Mutex
+	kinds  []EventKind
+	counts []interface{}
+}
+
+func (s *scaleEvents) handle(e Event) {
+	if e.Kind != WorkerAdded && e.Kind != WorkerRetired {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds = append(s.kinds, e.Kind)
+	s.counts = append(s.counts, e.Payload)
+}
+
+func (s *scaleEvents) has(kind EventKind) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConsumerAutoscale(t *testing.T) {
+	c := NewConsumer(100, 1)
+	c.Autoscale = &Autoscale{MinProcs: 1, MaxProcs: 4, HighWater: 0.5, LowWater: 0.1, Interval: 5 * time.Millisecond}
+	var events scaleEvents
+	c.SetEventHandler(events.handle)
+	var names []string
+	var mu sync.Mutex
+	c.Notify(func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		names = append(names, name)
+	})
+	c.ConsumeFunc = func(interface{}) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	require.Eventually(t, func() bool { return c.Stats().Workers == 1 }, time.Second, time.Millisecond)
+
+	// 突发数据,缓冲超过高水位,增加到 MaxProcs
+	for i := 0; i < 100; i++ {
+		c.Buffer <- i
+	}
+	require.Eventually(t, func() bool { return c.Stats().Workers == 4 }, 2*time.Second, time.Millisecond)
+	require.True(t, events.has(WorkerAdded))
+
+	// 空闲后低于低水位,减少到 MinProcs
+	require.Eventually(t, func() bool { return c.Stats().Workers == 1 }, 3*time.Second, time.Millisecond)
+	require.True(t, events.has(WorkerRetired))
+	require.Eventually(t, func() bool { return c.Stats().Processed == 100 }, time.Second, time.Millisecond)
+
+	// 事件带着 goroutine 数量,Notifier 也收到
+	events.mu.Lock()
+	for i, n := range events.counts {
+		require.GreaterOrEqual(t, n, 1)
+		require.LessOrEqual(t, n, 4)
+		if i > 0 && events.kinds[i] == WorkerAdded {
+			require.Equal(t, events.counts[i-1].(int)+1, n)
+		}
+	}
+	events.mu.Unlock()
+	mu.Lock()
+	require.Contains(t, names, "ScaleUp")
+	require.Contains(t, names, "ScaleDown")
+	mu.Unlock()
+
+	// 关闭后全部退出
+	c.Close()
+	require.NoError(t, <-done)
+	require.Zero(t, c.Stats().Workers)
+}
+
+func TestProducerAutoscale(t *testing.T) {
+	p := NewProducer(50, 1)
+	p.Overflow = OverflowDropNewest
+	p.Autoscale = &Autoscale{MinProcs: 1, MaxProcs: 3, HighWater: 0.9, LowWater: 0.5, Interval: 5 * time.Millisecond}
+	var events scaleEvents
+	p.SetEventHandler(events.handle)
+	p.ProduceFunc = func() (interface{}, error) {
+		time.Sleep(2 * time.Millisecond)
+		return 1, nil
+	}
+
+	// 消费者取得快,缓冲低于低水位,增加生产 goroutine
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reading := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-p.Buffer:
+			case <-reading:
+				return
+			}
+		}
+	}()
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+	require.Eventually(t, func() bool { return p.Stats().Workers == 3 }, 2*time.Second, time.Millisecond)
+
+	// 消费者停止,缓冲满后减少到 MinProcs
+	close(reading)
+	require.Eventually(t, func() bool { return p.Stats().Workers == 1 }, 2*time.Second, time.Millisecond)
+	require.True(t, events.has(WorkerRetired))
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.Zero(t, p.Stats().Workers)
+}
+
+func TestAutoscaleEnded(t *testing.T) {
+
+	// 生产完后不再增加 goroutine,Run 返回
+	n := 0
+	var mu sync.Mutex
+	p := NewProducer(10, 2)
+	p.Autoscale = &Autoscale{MaxProcs: 4, LowWater: 1.1, Interval: time.Millisecond}
+	p.ProduceFunc = func() (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if n++; n > 5 {
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+	go func() {
+		for range p.Buffer {
+		}
+	}()
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return once ProduceFunc was done")
+	}
+	close(p.Buffer)
+}
+
+func TestAutoscaleBounds(t *testing.T) {
+	lo, hi := (&Autoscale{}).bounds()
+	require.Equal(t, []int{1, 1}, []int{lo, hi})
+	lo, hi = (&Autoscale{MinProcs: 3, MaxProcs: 2}).bounds()
+	require.Equal(t, []int{3, 3}, []int{lo, hi})
+}
@@ -0,0 +1,77 @@
+package producerconsumer
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+)
+
+// BackpressureStrategy decides how Run waits on a full Buffer with
+// OverflowBackpressure before trying to write the item again.
+type BackpressureStrategy interface {
+
+	// Wait waits after the attempt-th write of an item found Buffer full,
+	// starting at 1, or until ctx is done, in which case it returns the
+	// context error. attempt starts over with the next item.
+	Wait(ctx context.Context, attempt int) error
+}
+
+// FixedBackpressure waits d after every failed write.
+func FixedBackpressure(d time.Duration) BackpressureStrategy {
+	return fixedBackpressure(d)
+}
+
+type fixedBackpressure time.Duration
+
+func (f fixedBackpressure) Wait(ctx context.Context, attempt int) error {
+	return backoff.Sleep(ctx, time.Duration(f))
+}
+
+// ExponentialBackpressure waits b.Initial after the first failed write of
+// an item, multiplying the wait by b.Multiplier after each one up to
+// b.Max, randomized by b.Jitter. It is the default, from 100ms to 1s.
+func ExponentialBackpressure(b backoff.Backoff) BackpressureStrategy {
+	return exponentialBackpressure{b: b}
+}
+
+type exponentialBackpressure struct {
+	b backoff.Backoff
+}
+
+func (e exponentialBackpressure) Wait(ctx context.Context, attempt int) error {
+	return backoff.Sleep(ctx, e.delay(attempt))
+}
+
+// delay returns the wait after the attempt-th failed write.
+func (e exponentialBackpressure) delay(attempt int) time.Duration {
+	d := float64(e.b.Initial)
+	if e.b.Multiplier > 1 && attempt > 1 {
+		d *= math.Pow(e.b.Multiplier, float64(attempt-1))
+	}
+	if e.b.Max > 0 && d > float64(e.b.Max) {
+		d = float64(e.b.Max)
+	}
+	if d > math.MaxInt64 {
+		d = math.MaxInt64
+	}
+
+	// Apply the jitter of b to the delay
+	j := backoff.Backoff{Initial: time.Duration(d), Jitter: e.b.Jitter, Rand: e.b.Rand}
+	return j.Next()
+}
+
+// BlockBackpressure makes Run wait for room in Buffer instead of sleeping,
+// so the item is written as soon as a reader takes one. Unlike
+// OverflowBlock, the waits still count in Stats as Backpressure. Its Wait,
+// which Run does not call, polls every millisecond.
+func BlockBackpressure() BackpressureStrategy {
+	return blockBackpressure{}
+}
+
+type blockBackpressure struct{}
+
+func (blockBackpressure) Wait(ctx context.Context, attempt int) error {
+	return backoff.Sleep(ctx, time.Millisecond)
+}
@@ -0,0 +1,137 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExponentialBackpressure(t *testing.T) {
+
+	// 每次失败后等待翻倍,直到上限
+	e := ExponentialBackpressure(backoff.Backoff{
+		Initial:    time.Millisecond,
+		Max:        8 * time.Millisecond,
+		Multiplier: 2,
+	}).(exponentialBackpressure)
+	var delays []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		delays = append(delays, e.delay(attempt))
+	}
+	ms := time.Millisecond
+	require.Equal(t, []time.Duration{ms, 2 * ms, 4 * ms, 8 * ms, 8 * ms, 8 * ms}, delays)
+
+	// 次数很大时不溢出
+	require.Equal(t, 8*ms, e.delay(10000))
+
+	// 抖动在范围内
+	e.b.Jitter = 0.5
+	e.b.Rand = func() float64 { return 0 }
+	require.Equal(t, 2*ms, e.delay(3))
+	e.b.Rand = func() float64 { return 0.999999 }
+	require.InDelta(t, float64(6*ms), float64(e.delay(3)), float64(time.Microsecond))
+}
+
+func TestBackpressureCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	// ctx 取消时中断等待
+	for _, s := range []BackpressureStrategy{
+		FixedBackpressure(time.Hour),
+		ExponentialBackpressure(backoff.Backoff{Initial: time.Hour}),
+	} {
+		start := time.Now()
+		require.ErrorIs(t, s.Wait(ctx, 1), context.Canceled)
+		require.Less(t, time.Since(start), time.Second)
+	}
+
+	// 运行中的生产者在等待时取消,立即返回
+	p := NewProducer(1, 1)
+	p.Notify(func(string) {})
+	p.SetBackpressure(FixedBackpressure(time.Hour))
+	p.ProduceFunc = func() (interface{}, error) { return 1, nil }
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	require.ErrorIs(t, p.Run(ctx), context.Canceled)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+// recordingBackpressure records the attempts, taking an item out of buf at
+// every third one.
+type recordingBackpressure struct {
+	mu       sync.Mutex
+	attempts []int
+	buf      chan interface{}
+	taken    []interface{}
+}
+
+func (r *recordingBackpressure) Wait(ctx context.Context, attempt int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, attempt)
+	if attempt == 3 {
+		r.taken = append(r.taken, <-r.buf)
+	}
+	return nil
+}
+
+func TestBackpressureAttempts(t *testing.T) {
+
+	// 次数在写入成功后重新开始,写不进的数据等待后重试,不丢失
+	n := 0
+	p := NewProducer(1, 1)
+	p.Notify(func(string) {})
+	r := &recordingBackpressure{buf: p.Buffer}
+	p.SetBackpressure(r)
+	p.ProduceFunc = func() (interface{}, error) {
+		if n++; n > 3 {
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+	require.NoError(t, p.Run(context.Background()))
+
+	require.Equal(t, []int{1, 2, 3, 1, 2, 3}, r.attempts)
+	require.Equal(t, []interface{}{1, 2}, r.taken)
+	require.Equal(t, 3, <-p.Buffer)
+	require.Equal(t, uint64(3), p.Stats().Produced)
+	require.Equal(t, uint64(6), p.Stats().Backpressure)
+}
+
+func TestBlockBackpressure(t *testing.T) {
+
+	// 缓冲区满时等待空间,读取后立即写入
+	n := 0
+	p := NewProducer(1, 1)
+	p.Notify(func(string) {})
+	p.SetBackpressure(BlockBackpressure())
+	p.ProduceFunc = func() (interface{}, error) {
+		if n++; n > 5 {
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+
+	var got []interface{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for len(got) < 5 {
+			time.Sleep(2 * time.Millisecond)
+			got = append(got, <-p.Buffer)
+		}
+	}()
+
+	start := time.Now()
+	require.NoError(t, p.Run(context.Background()))
+	<-done
+	require.Equal(t, []interface{}{1, 2, 3, 4, 5}, got)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	require.NotZero(t, p.Stats().Backpressure)
+}
@@ -0,0 +1,156 @@
+package producerconsumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/heartbeat"
+)
+
+// BatchError is the error ErrHandler receives when ConsumeBatchFunc
+// fails, holding the whole batch. ItemErrHandler receives it once for
+// each item of the batch.
+type BatchError[T any] struct {
+
+	// Items is the batch that failed.
+	Items []T
+
+	// Err is the error of ConsumeBatchFunc.
+	Err error
+}
+
+func (e *BatchError[T]) Error() string {
+	return fmt.Sprintf("batch of %d items: %v", len(e.Items), e.Err)
+}
+
+// Unwrap returns the error of ConsumeBatchFunc.
+func (e *BatchError[T]) Unwrap() error {
+	return e.Err
+}
+
+// consumeBatches is runProc for ConsumeBatchFunc: it collects the items
+// read with readCtx into batches, flushing them once full or due. The
+// partial batch is flushed when reading stops.
+func (c *ConsumerOf[T]) consumeBatches(ctx, readCtx context.Context, beat *heartbeat.Beat) {
+	size := c.BatchSize
+	if size < 1 {
+		size = 1
+	}
+
+	var batch []T
+	var due time.Time
+	panics := false
+	flush := func() {
+		c.pause.wait(readCtx)
+		panics = panicked(c.flushBatch(ctx, batch)) || panics
+		batch = nil
+		beat.Pulse()
+	}
+
+	for {
+		// Return after a panic, unless RestartOnPanic or partitioned
+		if panics && !c.RestartOnPanic && partitionOf[T](ctx) == nil {
+			return
+		}
+
+		// Wait while paused, holding the partial batch
+		if !c.pause.wait(readCtx) {
+			if len(batch) > 0 {
+				flush()
+			}
+			return
+		}
+
+		// Wait for an item until the partial batch is due
+		waitCtx, cancel := readCtx, context.CancelFunc(func() {})
+		if len(batch) > 0 && c.BatchFlushInterval > 0 {
+			waitCtx, cancel = context.WithDeadline(readCtx, due)
+		}
+		data, ok := c.read(waitCtx)
+		cancel()
+
+		if !ok {
+			if waitCtx.Err() != nil && readCtx.Err() == nil {
+				flush()
+				continue
+			}
+			// Closed, idle, cancelled or stopped
+			if len(batch) > 0 {
+				flush()
+			}
+			return
+		}
+
+		// Items that outlived their producer's ItemTTL are not consumed
+		data, live := unstamp(data)
+		if !live {
+			continue
+		}
+
+		// Skip the items seen already
+		if c.Dedup != nil && c.Dedup.Seen(payload(data)) {
+			c.duplicates.Add(1)
+			continue
+		}
+
+		if len(batch) == 0 {
+			due = time.Now().Add(c.BatchFlushInterval)
+		}
+		batch = append(batch, data)
+		if len(batch) >= size {
+			flush()
+		}
+	}
+}
+
+// flushBatch calls ConsumeBatchFunc with batch, then records its items
+// like finish does, reporting a failure once as a *BatchError and sending
+// every item to DeadLetter. It returns the *BatchError, or nil.
+func (c *ConsumerOf[T]) flushBatch(ctx context.Context, batch []T) error {
+	for range batch {
+		c.stats.begin()
+	}
+
+	err := catch(c.PanicHandler, &c.panics, func() error {
+		return c.ConsumeBatchFunc(batch)
+	})
+	if err != nil {
+		err = &BatchError[T]{Items: batch, Err: err}
+
+		// Let the items be processed again
+		if c.Dedup != nil {
+			for _, data := range batch {
+				c.Dedup.Forget(payload(data))
+			}
+		}
+		c.handleBatchError(batch, err)
+	}
+
+	for _, data := range batch {
+		c.stats.end(err)
+		if err != nil {
+			c.deadLetter(data, err, 1)
+		}
+		c.emit(ItemConsumed, data)
+		c.deliver(ctx, data, err)
+	}
+	return err
+}
+
+// handleBatchError reports the failure of batch like handleError: once to
+// ErrHandler, and for each item to ItemErrHandler, all with err.
+func (c *ConsumerOf[T]) handleBatchError(batch []T, err error) {
+	c.emit(ConsumeError, err)
+	if c.PanicHandler != nil && panicked(err) {
+		return
+	}
+	if c.ErrHandler != nil {
+		c.ErrHandler(err)
+	}
+	if c.ItemErrHandler != nil {
+		for _, data := range batch {
+			c.ItemErrHandler(data, err)
+		}
+	}
+}
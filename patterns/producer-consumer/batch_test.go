@@ -0,0 +1,162 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+	"github.com/stretchr/testify/require"
+)
+
+// batcher returns a consumer of one goroutine collecting its batches.
+func batcher(size int, interval time.Duration) (*Consumer, func() [][]interface{}) {
+	var mu sync.Mutex
+	var batches [][]interface{}
+
+	c := NewConsumer(10, 1)
+	c.Notify(func(string) {})
+	c.BatchSize = size
+	c.BatchFlushInterval = interval
+	c.ConsumeBatchFunc = func(items []interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, items)
+		return nil
+	}
+	return c, func() [][]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][]interface{}(nil), batches...)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	c, batches := batcher(3, 0)
+	for i := 1; i <= 7; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+
+	// 攒满 BatchSize 个就处理,关闭时处理剩下的
+	require.NoError(t, c.Run(context.Background()))
+	require.Equal(t, [][]interface{}{{1, 2, 3}, {4, 5, 6}, {7}}, batches())
+	require.Equal(t, uint64(7), c.Stats().Processed)
+}
+
+func TestBatchFlushInterval(t *testing.T) {
+	c, batches := batcher(100, 20*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+
+	// 未攒满时,第一个数据到达 BatchFlushInterval 后处理
+	start := time.Now()
+	c.Buffer <- 1
+	c.Buffer <- 2
+	require.Eventually(t, func() bool { return len(batches()) == 1 }, time.Second, time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	require.Equal(t, []interface{}{1, 2}, batches()[0])
+
+	// 之后的数据开始新的一批
+	c.Buffer <- 3
+	require.Eventually(t, func() bool { return len(batches()) == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, []interface{}{3}, batches()[1])
+
+	c.Close()
+	require.NoError(t, <-done)
+	require.Len(t, batches(), 2)
+}
+
+func TestBatchFlushOnCancel(t *testing.T) {
+	c, batches := batcher(100, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+	for i := 1; i <= 3; i++ {
+		c.Buffer <- i
+	}
+	require.Eventually(t, func() bool { return len(c.Buffer) == 0 }, time.Second, time.Millisecond)
+	require.Empty(t, batches())
+
+	// ctx 取消时处理未满的一批
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.Equal(t, [][]interface{}{{1, 2, 3}}, batches())
+
+	// Stop 时同样处理
+	c, batches = batcher(100, 0)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+	c.Buffer <- 4
+	require.Eventually(t, func() bool { return len(c.Buffer) == 0 }, time.Second, time.Millisecond)
+	errStop := errors.New("shutdown")
+	c.Stop(errStop)
+	require.Equal(t, errStop, <-done)
+	require.Equal(t, [][]interface{}{{4}}, batches())
+}
+
+func TestBatchError(t *testing.T) {
+	errInsert := errors.New("insert failed")
+	c := NewConsumer(10, 1)
+	c.Notify(func(string) {})
+	c.BatchSize = 2
+	c.ConsumeBatchFunc = func(items []interface{}) error {
+		if items[0] == "bad" {
+			return errInsert
+		}
+		return nil
+	}
+	var errs []error
+	c.HandleError(func(err error) { errs = append(errs, err) })
+	var items []interface{}
+	c.SetItemErrHandler(func(data interface{}, err error) {
+		require.ErrorIs(t, err, errInsert)
+		items = append(items, data)
+	})
+	out := make(chan result.Result[interface{}], 4)
+	c.SetOut(out)
+	dlq := make(chan FailedItem, 4)
+	c.SetDeadLetter(dlq)
+
+	for _, v := range []interface{}{"bad", "x", "good", "y"} {
+		c.Buffer <- v
+	}
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+
+	// 错误处理收到整批数据
+	require.Len(t, errs, 1)
+	var be *BatchError[interface{}]
+	require.ErrorAs(t, errs[0], &be)
+	require.ErrorIs(t, errs[0], errInsert)
+	require.Equal(t, []interface{}{"bad", "x"}, be.Items)
+
+	// ItemErrHandler 逐个收到失败的数据
+	require.Equal(t, []interface{}{"bad", "x"}, items)
+
+	// 每个数据的结果都发送到 Out
+	close(out)
+	var failed int
+	for r := range out {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	require.Equal(t, 2, failed)
+
+	// 失败的一批逐个进入死信队列
+	require.Len(t, dlq, 2)
+	require.Equal(t, "bad", (<-dlq).Data)
+	require.Equal(t, "x", (<-dlq).Data)
+	require.Equal(t, uint64(4), c.Stats().Processed)
+	require.Equal(t, uint64(2), c.Stats().Failed)
+}
@@ -0,0 +1,143 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Envelope wraps a payload with metadata carried from the producer to the
+// consumer, such as the deadline of the request that produced it.
+type Envelope struct {
+
+	// Payload is the data to consume.
+	Payload interface{}
+
+	// Metadata holds the values captured by a ContextCarrier's
+	// propagators, by name.
+	Metadata map[string]interface{}
+}
+
+// Propagator captures part of a context into envelope metadata at produce
+// time, and restores it into the consumer's context at consume time.
+type Propagator interface {
+
+	// Extract copies the state it propagates from ctx into md.
+	Extract(ctx context.Context, md map[string]interface{})
+
+	// Inject returns a child of ctx carrying the state found in md, and
+	// the function releasing it.
+	Inject(ctx context.Context, md map[string]interface{}) (context.Context, context.CancelFunc)
+}
+
+// ContextCarrier carries selected context state through the buffer along
+// with each item. Only what its propagators capture crosses over; the
+// consumer's context is derived from its own, never from the producer's.
+type ContextCarrier struct {
+	mu          sync.RWMutex
+	propagators []Propagator
+}
+
+// NewContextCarrier creates a ContextCarrier using the given propagators.
+func NewContextCarrier(propagators ...Propagator) *ContextCarrier {
+	return &ContextCarrier{propagators: propagators}
+}
+
+// Register adds a propagator.
+func (c *ContextCarrier) Register(p Propagator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.propagators = append(c.propagators, p)
+}
+
+// WrapContext wraps payload in an Envelope carrying the state of ctx
+// captured by the propagators.
+func (c *ContextCarrier) WrapContext(ctx context.Context, payload interface{}) *Envelope {
+	env := &Envelope{
+		Payload:  payload,
+		Metadata: make(map[string]interface{}),
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, p := range c.propagators {
+		p.Extract(ctx, env.Metadata)
+	}
+	return env
+}
+
+// Context returns a child of parent carrying the state in env, and the
+// function releasing it.
+func (c *ContextCarrier) Context(parent context.Context, env *Envelope) (context.Context, context.CancelFunc) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ctx := parent
+	var cancels []context.CancelFunc
+	for _, p := range c.propagators {
+		var cancel context.CancelFunc
+		ctx, cancel = p.Inject(ctx, env.Metadata)
+		cancels = append(cancels, cancel)
+	}
+
+	return ctx, func() {
+		for i := len(cancels) - 1; i >= 0; i-- {
+			cancels[i]()
+		}
+	}
+}
+
+// deadlineKey is the metadata name of the propagated deadline.
+const deadlineKey = "deadline"
+
+// deadlinePropagator propagates the context deadline.
+type deadlinePropagator struct{}
+
+// DeadlinePropagator propagates the deadline of the producing context, so
+// items whose request has expired are not consumed.
+func DeadlinePropagator() Propagator {
+	return deadlinePropagator{}
+}
+
+func (deadlinePropagator) Extract(ctx context.Context, md map[string]interface{}) {
+	if d, ok := ctx.Deadline(); ok {
+		md[deadlineKey] = d
+	}
+}
+
+func (deadlinePropagator) Inject(ctx context.Context, md map[string]interface{}) (context.Context, context.CancelFunc) {
+	d, ok := md[deadlineKey].(time.Time)
+	if !ok {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, d)
+}
+
+// allowlistPropagator propagates the context values of listed keys.
+type allowlistPropagator struct {
+	keys map[string]interface{}
+}
+
+// AllowlistPropagator propagates the context values of the given keys,
+// such as trace and span IDs. keys maps the metadata name of each value
+// to its context key. Values of other keys are never propagated.
+func AllowlistPropagator(keys map[string]interface{}) Propagator {
+	return allowlistPropagator{keys: keys}
+}
+
+func (a allowlistPropagator) Extract(ctx context.Context, md map[string]interface{}) {
+	for name, key := range a.keys {
+		if v := ctx.Value(key); v != nil {
+			md[name] = v
+		}
+	}
+}
+
+func (a allowlistPropagator) Inject(ctx context.Context, md map[string]interface{}) (context.Context, context.CancelFunc) {
+	for name, key := range a.keys {
+		if v, ok := md[name]; ok {
+			ctx = context.WithValue(ctx, key, v)
+		}
+	}
+	return ctx, func() {}
+}
@@ -0,0 +1,112 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/retry"
+	"github.com/stretchr/testify/require"
+)
+
+type ctxKey string
+
+func TestCarrierDeadlineEnforced(t *testing.T) {
+
+	// 生产时设置的截止时间,在消费时仍然生效
+	carrier := NewContextCarrier(DeadlinePropagator())
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	env := carrier.WrapContext(reqCtx, "data")
+
+	calls := 0
+	c := &Consumer{}
+	c.SetCarrier(carrier)
+
+	// 截止时间前可以消费,且消费 ctx 带有同样的截止时间
+	c.ConsumeCtxFunc = func(ctx context.Context, data interface{}) error {
+		calls++
+		require.Equal(t, "data", data)
+		d, ok := ctx.Deadline()
+		require.True(t, ok)
+		want, _ := reqCtx.Deadline()
+		require.True(t, d.Equal(want))
+		return nil
+	}
+	require.NoError(t, c.consume(context.Background(), env))
+
+	// 过期后不再调用消费函数
+	time.Sleep(30 * time.Millisecond)
+	err := c.consume(context.Background(), env)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, calls)
+}
+
+func TestCarrierAllowlist(t *testing.T) {
+
+	// 只传递白名单中的值
+	traceKey := ctxKey("trace")
+	secretKey := ctxKey("secret")
+	carrier := NewContextCarrier()
+	carrier.Register(AllowlistPropagator(map[string]interface{}{"trace_id": traceKey}))
+
+	reqCtx := context.WithValue(context.Background(), traceKey, "t-1")
+	reqCtx = context.WithValue(reqCtx, secretKey, "s3cret")
+	env := carrier.WrapContext(reqCtx, 42)
+
+	require.Equal(t, map[string]interface{}{"trace_id": "t-1"}, env.Metadata)
+
+	c := &Consumer{Carrier: carrier}
+	c.ConsumeCtxFunc = func(ctx context.Context, data interface{}) error {
+		require.Equal(t, 42, data)
+		require.Equal(t, "t-1", ctx.Value(traceKey))
+		require.Nil(t, ctx.Value(secretKey))
+		return nil
+	}
+	require.NoError(t, c.consume(context.Background(), env))
+}
+
+func TestCarrierPlainItems(t *testing.T) {
+
+	// 没有 Carrier 时 envelope 原样传给消费函数,普通数据不受影响
+	var got []interface{}
+	c := &Consumer{
+		ConsumeFunc: func(data interface{}) error {
+			got = append(got, data)
+			return nil
+		},
+	}
+	env := &Envelope{Payload: "x"}
+	require.NoError(t, c.consume(context.Background(), env))
+
+	c.SetCarrier(NewContextCarrier(DeadlinePropagator()))
+	require.NoError(t, c.consume(context.Background(), "plain"))
+	require.NoError(t, c.consume(context.Background(), env))
+
+	require.Equal(t, []interface{}{env, "plain", "x"}, got)
+}
+
+func TestCarrierWithRetry(t *testing.T) {
+
+	// 重试在截止时间到达时停止
+	carrier := NewContextCarrier(DeadlinePropagator())
+	reqCtx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	fail := errors.New("fail")
+	c := &Consumer{Carrier: carrier}
+	c.SetRetryPolicy(retry.Policy{
+		MaxAttempts:    1000,
+		InitialBackoff: 5 * time.Millisecond,
+	})
+	c.ConsumeCtxFunc = func(ctx context.Context, data interface{}) error {
+		return fail
+	}
+
+	start := time.Now()
+	err := c.consume(context.Background(), carrier.WrapContext(reqCtx, "data"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
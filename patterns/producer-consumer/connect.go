@@ -0,0 +1,57 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+)
+
+// errConsumerReturned cancels the Producer of Connect once the Consumer
+// returned.
+var errConsumerReturned = errors.New("consumer returned")
+
+// Connect runs p and c with a blocking queue of the given capacity between
+// them instead of their Buffer channels. Unlike Inject, nothing is
+// dropped: the producing goroutines wait while the queue is full, and the
+// consuming ones while it is empty. The queue is closed once p returns.
+// If c returns first, such as after Stop or once all its goroutines
+// exited on a panic, p is cancelled rather than left waiting on the full
+// queue.
+//
+// Connect returns nil once every item produced has been consumed, the
+// context error if ctx is done first, or else what Run of p and of c
+// returned, such as an error of ProduceFunc wrapping ErrStopProduce.
+func Connect(ctx context.Context, p *Producer, c *Consumer, capacity int) error {
+	return ConnectOf(ctx, p, c, capacity)
+}
+
+// ConnectOf is Connect for a ProducerOf and ConsumerOf the same items.
+func ConnectOf[T any](ctx context.Context, p *ProducerOf[T], c *ConsumerOf[T], capacity int) error {
+	q := queue.New[T](capacity)
+	p.SetQueue(q)
+	c.SetQueue(q)
+
+	// Nothing drains the queue once c returns
+	pctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	var perr error
+	go func() {
+		defer close(done)
+		perr = p.RunAndClose(pctx)
+	}()
+
+	cerr := c.Run(ctx)
+	cancel(errConsumerReturned)
+	<-done
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if perr == errConsumerReturned {
+		perr = nil
+	}
+	return errors.Join(perr, cerr)
+}
@@ -0,0 +1,200 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/group"
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnect(t *testing.T) {
+
+	// 4 个生产 goroutine 共生产 1..1000
+	var next int64
+	p := NewProducer(0, 4)
+	p.ProduceFunc = func() (interface{}, error) {
+		if n := atomic.AddInt64(&next, 1); n <= 1000 {
+			return int(n), nil
+		}
+		return nil, nil
+	}
+
+	// 消费者比生产者慢,队列会被写满
+	var mu sync.Mutex
+	sum := 0
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sum += data.(int)
+		return nil
+	}
+
+	// 队列满时等待而不是丢弃,所有数据都被消费
+	require.NoError(t, Connect(context.Background(), p, c, 8))
+	require.Equal(t, 500500, sum)
+	require.Equal(t, uint64(1000), p.Stats().Produced)
+	require.Equal(t, uint64(1000), c.Stats().Processed)
+}
+
+func TestConnectCancel(t *testing.T) {
+
+	// 生产者永不结束
+	p := NewProducer(0, 1)
+	p.ProduceFunc = func() (interface{}, error) {
+		return 1, nil
+	}
+	c := NewConsumer(0, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+
+	// 取消后返回 ctx 的错误
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, Connect(ctx, p, c, 4), context.DeadlineExceeded)
+}
+
+func TestConnectError(t *testing.T) {
+
+	// 生产者读到第 100 个数据时失败
+	var next int64
+	p := NewProducer(0, 2)
+	p.ProduceFunc = func() (interface{}, error) {
+		if n := atomic.AddInt64(&next, 1); n < 100 {
+			return int(n), nil
+		}
+		return nil, fmt.Errorf("reading input: %w", ErrStopProduce)
+	}
+	var processed atomic.Int64
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error {
+		processed.Add(1)
+		return nil
+	}
+
+	// Connect 返回生产者的错误,已生产的数据仍被消费完
+	err := Connect(context.Background(), p, c, 8)
+	require.ErrorIs(t, err, ErrStopProduce)
+	require.EqualError(t, err, "reading input: stop producing")
+	require.Equal(t, int64(p.Stats().Produced), processed.Load())
+}
+
+func TestRunGroup(t *testing.T) {
+	q := queue.New[interface{}](8)
+	errFatal := errors.New("fatal")
+
+	// 生产者失败后,group 取消消费者,Wait 只返回生产者的错误
+	p := NewProducer(0, 2)
+	p.Notify(func(string) {})
+	p.SetQueue(q)
+	p.ProduceFunc = func() (interface{}, error) {
+		return nil, fmt.Errorf("%w: %w", ErrStopProduce, errFatal)
+	}
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+	c.ConsumeFunc = func(interface{}) error { return nil }
+
+	g := group.New(context.Background(), group.WithCancelOnError())
+	g.Go(p.Run)
+	g.GoRunner(c)
+	err := g.Wait()
+	require.ErrorIs(t, err, errFatal)
+	require.NotErrorIs(t, err, context.Canceled)
+
+	// 数据生产完、队列关闭后,两者都返回 nil
+	q = queue.New[interface{}](8)
+	var next int64
+	p = NewProducer(0, 2)
+	p.Notify(func(string) {})
+	p.SetQueue(q)
+	p.ProduceFunc = func() (interface{}, error) {
+		if n := atomic.AddInt64(&next, 1); n <= 100 {
+			return int(n), nil
+		}
+		return nil, nil
+	}
+	c = NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+	c.ConsumeFunc = func(interface{}) error { return nil }
+
+	g = group.New(context.Background(), group.WithCancelOnError())
+	g.Go(p.RunAndClose)
+	g.GoRunner(c)
+	require.NoError(t, g.Wait())
+	require.Equal(t, uint64(100), c.Stats().Processed)
+}
+
+func TestConnectConsumerStops(t *testing.T) {
+
+	// 生产者永不结束
+	p := NewProducerOf[int](0, 2)
+	p.ProduceFunc = func() (int, error) {
+		return 1, nil
+	}
+
+	// 消费者处理 10 个数据后停止
+	errEnough := errors.New("enough")
+	var processed atomic.Int64
+	c := NewConsumerOf[int](0, 2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(int) error {
+		if processed.Add(1) == 10 {
+			c.Stop(errEnough)
+		}
+		return nil
+	}
+
+	// 生产者被取消而不是阻塞在满的队列上,返回消费者的原因
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ConnectOf(context.Background(), p, c, 4)
+	}()
+	select {
+	case err := <-errc:
+		require.ErrorIs(t, err, errEnough)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Connect did not return after the consumer stopped")
+	}
+}
+
+func TestConnectConsumerPanics(t *testing.T) {
+
+	// 生产者永不结束
+	p := NewProducer(0, 2)
+	p.ProduceFunc = func() (interface{}, error) {
+		return 1, nil
+	}
+
+	// 没有 RestartOnPanic,每个消费 goroutine 第一次 panic 后退出
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error {
+		panic("boom")
+	}
+
+	// 消费者全部退出后 Connect 返回,不会等待满的队列
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Connect(context.Background(), p, c, 4)
+	}()
+	select {
+	case <-errc:
+		require.Equal(t, uint64(2), c.Stats().Panics)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Connect did not return after the consumer goroutines exited")
+	}
+}
@@ -4,8 +4,18 @@ package producerconsumer
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/circuitbreaker"
+	"github.com/Alan-333333/go-channel-patterns/patterns/heartbeat"
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+	"github.com/Alan-333333/go-channel-patterns/patterns/retry"
+	"github.com/Alan-333333/go-channel-patterns/patterns/signal"
 )
 
 // ErrHandler Consumer err
@@ -14,11 +24,15 @@ type ErrHandler func(error)
 // Notifier
 type Notifier func(string)
 
-// Consumer represents a consumer for processing data concurrently.
-type Consumer struct {
+// Consumer is a ConsumerOf any items, which ConsumeFunc type-asserts.
+type Consumer = ConsumerOf[interface{}]
+
+// ConsumerOf represents a consumer for processing data of type T
+// concurrently.
+type ConsumerOf[T any] struct {
 
 	// Buffer is a buffered channel that holds data to be consumed.
-	Buffer chan interface{}
+	Buffer chan T
 
 	// NumProcs is the number of concurrent goroutines that will
 	// process data.
@@ -26,25 +40,222 @@ type Consumer struct {
 
 	// ConsumeFunc is a handler function that will be invoked for
 	// each data item to process it.
-	ConsumeFunc func(interface{}) error
+	ConsumeFunc func(T) error
+
+	// ConsumeCtxFunc is used instead of ConsumeFunc if set, and also
+	// receives the context, carrying the state restored by Carrier.
+	ConsumeCtxFunc func(context.Context, T) error
+
+	// MaxRedeliveries makes the processing goroutines acknowledge items
+	// only once ConsumeFunc returns nil, if positive. An item that fails
+	// is requeued, up to that many times, before its error goes to
+	// ErrHandler and DeadLetter. An item whose context is cancelled while
+	// it is processed, or before it is, is requeued without counting.
+	// Requeued items are delivered before those of Buffer or Queue, and
+	// wait on the Consumer for the next Run if this one returns, so they
+	// are not lost and never block on a full Buffer. Stats counts them as
+	// Buffered and Requeued, not as processed. ConsumeBatchFunc and
+	// Process ignore it, and requeued items are not Ordered.
+	MaxRedeliveries int
+
+	// Autoscale grows and shrinks the processing goroutines with the
+	// occupancy of Buffer or Queue if set, starting from NumProcs.
+	Autoscale *Autoscale
+
+	// Ordered makes the items finish in the order they were read from
+	// Buffer or Queue, while ConsumeFunc still runs for several of them
+	// at once: an item that is done waits for those before it before
+	// its outcome goes to Stats, ErrHandler, DeadLetter, the events and
+	// Out. Reads take turns, and a slow item holds back the ones after
+	// it, so throughput drops to what the slowest items allow, and
+	// NumProcs bounds the items waiting. MaxPending does not hand items
+	// off while Ordered. ConsumeBatchFunc and Process ignore it.
+	Ordered bool
+
+	// PartitionFunc, if set, makes each processing goroutine read a
+	// channel of its own, to which Run routes the items of Buffer or
+	// Queue: those of partition PartitionFunc(item) modulo NumProcs go to
+	// the same goroutine, so items of the same key are processed one
+	// after the other, in the order they were read. Autoscale and Ordered
+	// do not apply, and a goroutine keeps its partition after a panic as if
+	// RestartOnPanic was set. Items requeued for MaxRedeliveries, or left
+	// in the partitions when Run returns early, are delivered to any
+	// goroutine, and an item handed off with MaxPending lets the next one
+	// of its partition start.
+	PartitionFunc func(data T) int
+
+	// PerItemTimeout bounds each call to ConsumeCtxFunc or ConsumeFunc, if
+	// positive: ConsumeCtxFunc receives a context with that deadline, and
+	// a call that outlasts it fails with an error matching
+	// context.DeadlineExceeded, going to ErrHandler, RetryPolicy and
+	// DeadLetter like any other, even if it returned nil. Each retry of RetryPolicy
+	// gets its own deadline. ConsumeFunc cannot be interrupted, so the
+	// goroutine still waits for it to return.
+	PerItemTimeout time.Duration
+
+	// ConsumeBatchFunc is used instead of ConsumeFunc if set, receiving
+	// the items in batches: each processing goroutine calls it once it
+	// collected BatchSize items, or BatchFlushInterval after the first item
+	// of a partial batch, and with the partial batch when it stops. A
+	// failure reaches ErrHandler as a *BatchError holding the batch, and
+	// Out for every item. Carrier, RetryPolicy, Breaker, MaxPending,
+	// MaxRedeliveries and Mirror only apply to ConsumeFunc and
+	// ConsumeCtxFunc.
+	ConsumeBatchFunc func(items []T) error
+
+	// BatchSize is the most items passed to ConsumeBatchFunc at once.
+	// Values below 1 mean 1.
+	BatchSize int
+
+	// BatchFlushInterval is how long a partial batch waits for more items,
+	// if positive. By default it waits until it is full or reading stops.
+	BatchFlushInterval time.Duration
+
+	// Carrier unwraps *Envelope items if set: the payload is consumed
+	// with a context restored from the envelope's metadata, and items
+	// whose restored context is already done fail with its error.
+	Carrier *ContextCarrier
 
 	// ErrHandler is a handler function that will be called
 	// if an error occurs during processing.
 	ErrHandler func(error)
 
+	// ItemErrHandler, if set, receives the same errors as ErrHandler
+	// together with the item that failed. Both are called if both are
+	// set, ErrHandler first.
+	ItemErrHandler func(data T, err error)
+
+	// PanicHandler, if set, receives the value ConsumeFunc,
+	// ConsumeCtxFunc or ConsumeBatchFunc panicked with and the stack. The
+	// panic is recovered either way, and the item fails with a
+	// *PanicError, which goes to ErrHandler and ItemErrHandler only if
+	// PanicHandler is not set.
+	PanicHandler func(recovered interface{}, stack []byte)
+
+	// RestartOnPanic keeps a processing goroutine going after an item it
+	// read failed with a panic. Otherwise the goroutine returns once done
+	// with the items it holds, and the others go on.
+	RestartOnPanic bool
+
 	// Notifier is a callback function that will be invoked
 	// on specific events.
 	Notifier func(string)
+
+	// EventHandler receives the lifecycle events if set. Notifier keeps
+	// receiving the names it did before events were typed.
+	EventHandler EventHandler
+
+	// RetryPolicy retries ConsumeFunc on errors if set.
+	// Only the error of the last attempt reaches ErrHandler.
+	RetryPolicy *retry.Policy
+
+	// Breaker stops calling ConsumeFunc while it keeps failing if set.
+	// Rejected items reach ErrHandler with circuitbreaker.ErrOpen.
+	Breaker *circuitbreaker.Breaker
+
+	// Heartbeat watches the processing goroutines if set. Each registers
+	// as "consumer-N" and pulses between items.
+	Heartbeat *heartbeat.Monitor
+
+	// Out receives the outcome of every item if set: the item as Value
+	// and the error of ConsumeFunc, after ErrHandler saw it. Sends block
+	// until Out is read or the context is done.
+	Out chan<- result.Result[T]
+
+	// DeadLetter receives the items that failed for good if set, after
+	// RetryPolicy gave up and ErrHandler saw the error, with the number of
+	// calls to ConsumeFunc made for them, so they can be kept and replayed
+	// later. Sends do not block: items that find it full are dropped and
+	// counted in Stats as DeadLetterDropped.
+	DeadLetter chan<- FailedItem
+
+	// Queue is read from instead of Buffer if set.
+	Queue QueueOf[T]
+
+	// IdleTimeout makes the processing goroutines return once no item
+	// arrived from Buffer or Queue for that long, if positive, notifying
+	// ConsumerIdle. The time is since the latest item any of them read, so
+	// they stay while items keep coming, however sparse for each. By
+	// default they wait for items until the input is closed and drained,
+	// ctx is done or Stop is called.
+	IdleTimeout time.Duration
+
+	// Dedup skips the items whose ID it saw within its window if set,
+	// counting them in Stats as DuplicatesSkipped. Items that fail are
+	// forgotten, so they are processed if seen again. The ID is taken
+	// from the payload of an *Envelope.
+	Dedup *Dedup
+
+	// MaxPending bounds the items processed or handed off to a sink at
+	// once, if positive. ConsumeFunc hands an item off by returning a
+	// *Pending: processing goes on while the item waits for it to be
+	// settled, until MaxPending items are in flight. Otherwise the
+	// processing goroutine waits for the handle.
+	MaxPending int
+
+	// Mirror shadows a sample of the processed items to another consumer
+	// if set, comparing their outcomes without affecting this one.
+	Mirror *MirrorOf[T]
+
+	// Tuning trades latency for throughput when reading items. Items
+	// taken with MaxBatchDrain are processed even after Stop. With
+	// ConsumeBatchFunc, only SpinBeforePark applies.
+	Tuning Tuning
+
+	// procs numbers the processing goroutines for Heartbeat.
+	procs uint32
+
+	// lastRead is when the latest item was read, in Unix nanoseconds, for
+	// IdleTimeout.
+	lastRead atomic.Int64
+
+	// stopped is closed by Stop with the reason Run returns.
+	stopped signal.Done
+
+	// pause holds the goroutines back between Pause and Resume.
+	pause pause
+
+	// workers counts the processing goroutines running.
+	workers atomic.Int64
+
+	// order numbers the items read while Ordered.
+	order ordering
+
+	// redelivery holds the items requeued for MaxRedeliveries, and
+	// requeued counts them.
+	redelivery redeliveries[T]
+	requeued   atomic.Uint64
+
+	// Counters backing Stats.
+	stats progress
+
+	// Items handed off with a Pending handle.
+	handoff handoffs
+
+	// duplicates counts the items Dedup skipped.
+	duplicates atomic.Uint64
+
+	// panics counts the calls that panicked.
+	panics atomic.Uint64
+
+	// deadLetterDropped counts the failed items DeadLetter had no room
+	// for.
+	deadLetterDropped atomic.Uint64
 }
 
 // NewConsumer creates a new Consumer instance.
 func NewConsumer(bufferSize int, numProcs int) *Consumer {
+	return NewConsumerOf[interface{}](bufferSize, numProcs)
+}
+
+// NewConsumerOf creates a Consumer of items of type T, like NewConsumer.
+func NewConsumerOf[T any](bufferSize int, numProcs int) *ConsumerOf[T] {
 
 	// Create a buffered channel to serve as the buff.
-	buff := make(chan interface{}, bufferSize)
+	buff := make(chan T, bufferSize)
 
 	// Initialize a Consumer instance.
-	c := &Consumer{
+	c := &ConsumerOf[T]{
 		Buffer:   buff,
 		NumProcs: numProcs,
 	}
@@ -54,64 +265,245 @@ func NewConsumer(bufferSize int, numProcs int) *Consumer {
 
 // Run starts the consumer by spinning up multiple
 // concurrent goroutines to process data.
-func (c *Consumer) Run(ctx context.Context) {
+//
+// The goroutines wait while the input is empty. Run returns nil once it
+// is closed and drained, or stayed empty for IdleTimeout, the cause of
+// the context if it is done first, or the reason passed to Stop. A
+// Consumer is a group.Runner, and Run fits errgroup.Group.Go too.
+func (c *ConsumerOf[T]) Run(ctx context.Context) error {
 
 	// wg is used to wait for all goroutines to finish.
 	var wg sync.WaitGroup
 
-	// Spin up a goroutine for each processor.
-	for i := 0; i < c.NumProcs; i++ {
+	// The idle time starts now
+	c.lastRead.Store(time.Now().UnixNano())
+
+	// Partition the items among the goroutines, or let Autoscale run
+	// them, if set
+	if c.PartitionFunc != nil {
+		c.partition(ctx)
+	} else if c.Autoscale != nil {
+		c.autoscale(ctx)
+	} else {
+		// Spin up a goroutine for each processor.
+		for i := 0; i < c.NumProcs; i++ {
+
+			wg.Add(1)
+
+			// Notify that a processor has started.
+			c.emit(ConsumerStarted, nil)
 
-		wg.Add(1)
+			// Launch a goroutine to process data.
+			go c.runProc(ctx, &wg)
+		}
+
+		// Block until all processors have finished.
+		wg.Wait()
+	}
+
+	err := c.stopped.Reason()
+	if ctx.Err() != nil {
+		err = context.Cause(ctx)
+	}
+	c.emit(ConsumerStopped, err)
+	return err
+}
 
-		// Notify that a processor has started.
-		c.Notifier("ConsumerStarted")
+// Stop stops Run, which returns reason, or signal.ErrClosed if reason is
+// nil. The goroutines finish processing the item in hand, and items handed
+// off stay pending. Only the first Stop counts, and a stopped Consumer
+// does not run again.
+func (c *ConsumerOf[T]) Stop(reason error) {
+	c.stopped.Close(reason)
+}
+
+// Pause makes the processing goroutines stop calling ConsumeFunc until
+// Resume, finishing the items being processed. They keep running, and
+// return if the context is done or Stop is called meanwhile. The input
+// keeps its items, but those the goroutines were already waiting for,
+// and a partial batch, are held until Resume.
+func (c *ConsumerOf[T]) Pause() {
+	if c.pause.pause() {
+		c.emit(ConsumerPaused, nil)
+	}
+}
 
-		// Launch a goroutine to process data.
-		go c.runProc(ctx, &wg)
+// Resume lets the goroutines paused by Pause take items again. The idle
+// time of IdleTimeout starts over.
+func (c *ConsumerOf[T]) Resume() {
+	if c.pause.resume() {
+		c.lastRead.Store(time.Now().UnixNano())
+		c.emit(ConsumerResumed, nil)
 	}
+}
 
-	// Block until all processors have finished.
-	wg.Wait()
+// Paused reports whether the Consumer is paused.
+func (c *ConsumerOf[T]) Paused() bool {
+	return c.pause.paused()
 }
 
 // runProc runs in a goroutine to process data from the inbox channel.
-func (c *Consumer) runProc(ctx context.Context, wg *sync.WaitGroup) {
+func (c *ConsumerOf[T]) runProc(ctx context.Context, wg *sync.WaitGroup) {
 
 	// Defer marking this goroutine as done in the WaitGroup.
 	defer wg.Done()
 
-	// Define a timeout duration.
-	timeout := 2 * time.Second
+	// Count it for Stats until it returns
+	c.workers.Add(1)
+	defer c.workers.Add(-1)
+
+	// Stop ends the reads, not the items being processed
+	readCtx, cancel := signal.Context(ctx, &c.stopped)
+	defer cancel()
 
+	// So does retiring the goroutine, for Autoscale
+	if retire := retirement(ctx); retire != nil {
+		var cancelRetire context.CancelFunc
+		readCtx, cancelRetire = signal.Context(readCtx, retire)
+		defer cancelRetire()
+	}
+
+	// Register with the heartbeat monitor, if any
+	beat := c.registerBeat()
+	defer beat.Stop()
+
+	// Collect the items into batches instead, if set
+	if c.ConsumeBatchFunc != nil {
+		c.consumeBatches(ctx, readCtx, beat)
+		return
+	}
+
+	// Keep reading a partition after a panic, and in any order
+	partitioned := partitionOf[T](ctx) != nil
+	restart := c.RestartOnPanic || partitioned
+	ordered := c.Ordered && !partitioned
+
+	y := yielder{every: c.Tuning.YieldEvery}
+	var held []T
 	for {
 		// ctx Timeout case
-		if c.isCancelled(ctx) {
+		if c.isCancelled(readCtx) {
 			return
 		}
-		// Timeout case
-		if c.isTimedOut(timeout) {
+		// Wait while paused
+		if !c.pause.wait(readCtx) {
 			return
 		}
-		// Try read from buffer
-		data, ok := c.tryReadBuffer()
+		// Deliver the requeued items first
+		if r, ok := c.redelivery.pop(); ok {
+			err := c.process(ctx, r.data, &handoffItem{requeue: true, deliveries: r.deliveries, attempts: r.attempts})
+			beat.Pulse()
+			y.item()
+			if panicked(err) && !restart {
+				return
+			}
+			continue
+		}
+
+		// Wait for data from the queue, if set, or the buffer, taking
+		// the items already there too, up to MaxBatchDrain
+		var seq uint64
+		var ok bool
+		held, seq, ok = c.take(readCtx, held)
 		if !ok {
 			return
 		}
-		// Invoke custom function to consume data
-		err := c.ConsumeFunc(data)
 
-		// Handle error
-		if err != nil {
-			c.handleError(err)
+		panics := false
+		for i, data := range held {
+			// Hold the items taken while pausing until Resume or Stop
+			c.pause.wait(readCtx)
+
+			// Invoke custom function to consume data
+			err := c.process(ctx, data, &handoffItem{ordered: ordered, seq: seq + uint64(i), requeue: true})
+			panics = panics || panicked(err)
+
+			// Report progress
+			beat.Pulse()
+			y.item()
+		}
+
+		// Return after a panic, unless RestartOnPanic
+		if panics && !restart {
+			return
 		}
 	}
 
 }
 
+// Process consumes one item the way the processing goroutines do:
+// through Carrier, Breaker and RetryPolicy, reporting an error to
+// ErrHandler and the outcome to Out. It returns the error of ConsumeFunc,
+// or ErrItemExpired without consuming an item that outlived ItemTTL.
+// With MaxPending set, it returns nil once the item is handed off, and
+// the item finishes when its Pending handle is settled. It returns nil
+// for an item Dedup skips.
+// It lets other components drive the consumer without its Buffer.
+// Ordered does not apply to the items passed to it.
+func (c *ConsumerOf[T]) Process(ctx context.Context, data T) error {
+	return c.process(ctx, data, &handoffItem{})
+}
+
+// process is Process for item, which is numbered if read by an Ordered
+// Consumer.
+func (c *ConsumerOf[T]) process(ctx context.Context, data T, item *handoffItem) error {
+
+	// Requeue the items not started once ctx is done, for MaxRedeliveries
+	if item.requeue && c.MaxRedeliveries > 0 && ctx.Err() != nil {
+		c.order.inTurn(item, func() {
+			c.redeliver(redelivery[T]{data: data, deliveries: item.deliveries, attempts: item.attempts})
+		})
+		return context.Cause(ctx)
+	}
+
+	// Items that outlived their producer's ItemTTL are not consumed
+	data, live := unstamp(data)
+	if !live {
+		c.order.inTurn(item, func() {})
+		return ErrItemExpired
+	}
+
+	// Skip the items seen already
+	if c.Dedup != nil && c.Dedup.Seen(payload(data)) {
+		c.duplicates.Add(1)
+		c.order.inTurn(item, func() {})
+		return nil
+	}
+
+	c.stats.begin()
+	start := time.Now()
+
+	// Without MaxPending, or if Ordered, wait here for a handed-off item
+	if c.MaxPending <= 0 || item.ordered {
+		return c.finish(ctx, data, item, start, c.consume(context.WithValue(ctx, handoffKey{}, item), data))
+	}
+
+	// Otherwise take a slot, and return once the item is handed off
+	c.handoff.begin(c.MaxPending)
+	item.counted = true
+	item.detached = make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.finish(ctx, data, item, start, c.consume(context.WithValue(ctx, handoffKey{}, item), data))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-item.detached:
+		return nil
+	}
+}
+
 // Close gracefully closes the Consumer.
 // It closes the Buffer channel and notifies shutdown.
-func (c *Consumer) Close() {
+func (c *ConsumerOf[T]) Close() {
+
+	// Close the queue instead, if set
+	if c.Queue != nil {
+		c.Queue.Close()
+		return
+	}
 
 	// Close Buffer channel
 	close(c.Buffer)
@@ -119,20 +511,270 @@ func (c *Consumer) Close() {
 }
 
 // sets the error handler function.
-func (c *Consumer) HandleError(handler ErrHandler) {
+func (c *ConsumerOf[T]) HandleError(handler ErrHandler) {
 	c.ErrHandler = handler
 }
 
+// sets the error handler receiving the failed items.
+func (c *ConsumerOf[T]) SetItemErrHandler(handler func(data T, err error)) {
+	c.ItemErrHandler = handler
+}
+
+// sets the handler receiving the panics of the consume functions.
+func (c *ConsumerOf[T]) SetPanicHandler(handler func(recovered interface{}, stack []byte)) {
+	c.PanicHandler = handler
+}
+
 // sets the Notify handler function.
-func (c *Consumer) Notify(notifier Notifier) {
+func (c *ConsumerOf[T]) Notify(notifier Notifier) {
 	c.Notifier = notifier
 }
 
+// sets the handler receiving the lifecycle events.
+func (c *ConsumerOf[T]) SetEventHandler(handler EventHandler) {
+	c.EventHandler = handler
+}
+
+// emit sends an event of kind to EventHandler and Notifier.
+func (c *ConsumerOf[T]) emit(kind EventKind, payload interface{}) {
+	emit(c.EventHandler, c.Notifier, kind, payload)
+}
+
+// sets the retry policy for ConsumeFunc.
+func (c *ConsumerOf[T]) SetRetryPolicy(policy retry.Policy) {
+	c.RetryPolicy = &policy
+}
+
+// sets the circuit breaker guarding ConsumeFunc.
+func (c *ConsumerOf[T]) SetBreaker(b *circuitbreaker.Breaker) {
+	c.Breaker = b
+}
+
+// sets the carrier unwrapping *Envelope items.
+func (c *ConsumerOf[T]) SetCarrier(carrier *ContextCarrier) {
+	c.Carrier = carrier
+}
+
+// sets the heartbeat monitor watching the processing goroutines.
+func (c *ConsumerOf[T]) SetHeartbeat(m *heartbeat.Monitor) {
+	c.Heartbeat = m
+}
+
+// sets the queue read from instead of Buffer.
+func (c *ConsumerOf[T]) SetQueue(q QueueOf[T]) {
+	c.Queue = q
+}
+
+// sets the Dedup skipping the items seen already.
+func (c *ConsumerOf[T]) SetDedup(d *Dedup) {
+	c.Dedup = d
+}
+
+// sets the Mirror shadowing a sample of the items.
+func (c *ConsumerOf[T]) SetMirror(m *MirrorOf[T]) {
+	c.Mirror = m
+}
+
+// sets the channel receiving the outcome of every item.
+func (c *ConsumerOf[T]) SetOut(out chan<- result.Result[T]) {
+	c.Out = out
+}
+
+// sets the function partitioning the items among the goroutines.
+func (c *ConsumerOf[T]) SetPartitionFunc(fn func(data T) int) {
+	c.PartitionFunc = fn
+}
+
+// sets the deadline of each call to ConsumeCtxFunc or ConsumeFunc.
+func (c *ConsumerOf[T]) SetPerItemTimeout(d time.Duration) {
+	c.PerItemTimeout = d
+}
+
+// sets the channel receiving the items that failed for good.
+func (c *ConsumerOf[T]) SetDeadLetter(deadLetter chan<- FailedItem) {
+	c.DeadLetter = deadLetter
+}
+
 // Helper methods
 
+// finish records data processed since start with err, reports err to
+// ErrHandler, a failed item to DeadLetter, the outcome to Out and the item
+// to Mirror, and frees the slot of a handed-off item.
+func (c *ConsumerOf[T]) finish(ctx context.Context, data T, item *handoffItem, start time.Time, err error) error {
+
+	// Wait for the items read before, if Ordered
+	c.order.inTurn(item, func() {
+		// Requeue a failed item, if set, instead of finishing it
+		if err != nil && c.requeue(ctx, data, item) {
+			return
+		}
+
+		c.stats.end(err)
+		if c.Mirror != nil {
+			c.Mirror.offer(data, err, time.Since(start))
+		}
+
+		// Handle error, letting the item be processed again
+		if err != nil {
+			if c.Dedup != nil {
+				c.Dedup.Forget(payload(data))
+			}
+			c.handleError(data, err)
+			c.deadLetter(data, err, item.attempts)
+		}
+		c.emit(ItemConsumed, data)
+
+		// Deliver the outcome
+		c.deliver(ctx, data, err)
+	})
+
+	if item.counted {
+		c.handoff.end()
+	}
+	return err
+}
+
+// deliver sends the outcome of data to Out, if set.
+func (c *ConsumerOf[T]) deliver(ctx context.Context, data T, err error) {
+	if c.Out == nil {
+		return
+	}
+
+	select {
+	case c.Out <- result.Of(data, err):
+	case <-ctx.Done():
+	}
+}
+
+// deadLetter sends data, which failed with err after attempts calls, to
+// DeadLetter if set, dropping it if DeadLetter is full.
+func (c *ConsumerOf[T]) deadLetter(data T, err error, attempts int) {
+	if c.DeadLetter == nil {
+		return
+	}
+
+	select {
+	case c.DeadLetter <- FailedItem{Data: data, Err: err, Attempts: attempts}:
+	default:
+		c.deadLetterDropped.Add(1)
+	}
+}
+
+// payload returns the payload of an *Envelope, or data itself.
+func payload[T any](data T) interface{} {
+	if env, ok := any(data).(*Envelope); ok {
+		return env.Payload
+	}
+	return any(data)
+}
+
+// registerBeat registers a processing goroutine with Heartbeat.
+// It returns nil, whose methods do nothing, if Heartbeat is not set.
+func (c *ConsumerOf[T]) registerBeat() *heartbeat.Beat {
+	if c.Heartbeat == nil {
+		return nil
+	}
+	n := atomic.AddUint32(&c.procs, 1)
+	return c.Heartbeat.Register(fmt.Sprintf("consumer-%d", n))
+}
+
+// consume invokes ConsumeFunc on data through the Breaker, if set.
+func (c *ConsumerOf[T]) consume(ctx context.Context, data T) error {
+
+	// Restore the producer's context state from an envelope
+	if env, ok := any(data).(*Envelope); ok && c.Carrier != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = c.Carrier.Context(ctx, env)
+		defer cancel()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		payload, ok := env.Payload.(T)
+		if !ok {
+			return fmt.Errorf("envelope payload %T is not a %v", env.Payload, reflect.TypeFor[T]())
+		}
+		data = payload
+	}
+
+	if c.Breaker == nil {
+		return c.consumeWithRetry(ctx, data)
+	}
+
+	return c.Breaker.Execute(ctx, func(ctx context.Context) error {
+		return c.consumeWithRetry(ctx, data)
+	})
+}
+
+// consumeWithRetry invokes ConsumeFunc on data, retrying per RetryPolicy.
+func (c *ConsumerOf[T]) consumeWithRetry(ctx context.Context, data T) error {
+
+	if c.RetryPolicy == nil {
+		return c.call(ctx, data)
+	}
+
+	// Notify each retry, then call the policy's own hook
+	policy := *c.RetryPolicy
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		c.emit(ConsumeRetry, err)
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+	}
+
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		return c.call(ctx, data)
+	})
+}
+
+// call invokes ConsumeCtxFunc if set, or ConsumeFunc, within
+// PerItemTimeout, waiting for the item to be settled if it was handed off.
+func (c *ConsumerOf[T]) call(ctx context.Context, data T) error {
+
+	// Count the attempts for DeadLetter
+	if item, ok := ctx.Value(handoffKey{}).(*handoffItem); ok {
+		item.attempts++
+	}
+
+	// Bound the call, not the wait for a handed-off item
+	callCtx := ctx
+	if c.PerItemTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.PerItemTimeout)
+		defer cancel()
+	}
+
+	// Recover a panic into the error of the item
+	err := catch(c.PanicHandler, &c.panics, func() error {
+		if c.ConsumeCtxFunc != nil {
+			return c.ConsumeCtxFunc(callCtx, data)
+		}
+		return c.ConsumeFunc(data)
+	})
+
+	// A call that outlasted its deadline failed, whatever it returned
+	if c.PerItemTimeout > 0 && ctx.Err() == nil && callCtx.Err() != nil {
+		var p *Pending
+		switch {
+		case err == nil:
+			err = context.DeadlineExceeded
+		case errors.As(err, &p), errors.Is(err, context.DeadlineExceeded):
+		default:
+			err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+		}
+	}
+
+	var p *Pending
+	if errors.As(err, &p) {
+		return c.await(ctx, any(data), p)
+	}
+	return err
+}
+
 // isCancelled checks if the context has been cancelled.
 // This allows goroutines to stop when a cancellation signal is received.
-func (c *Consumer) isCancelled(ctx context.Context) bool {
+func (c *ConsumerOf[T]) isCancelled(ctx context.Context) bool {
 
 	select {
 	case <-ctx.Done():
@@ -145,48 +787,131 @@ func (c *Consumer) isCancelled(ctx context.Context) bool {
 
 // handleError handles any errors returned by the ConsumeFunc.
 //
-// It logs the error and invokes any configured ErrHandler.
+// It logs the error and invokes any configured ErrHandler and
+// ItemErrHandler, passing data, the item that failed, to the latter.
 //
-// If no ErrHandler set, the error will be ignored.
+// If no handler set, the error will be ignored.
 //
 // This method allows customizing error handling logic.
-func (c *Consumer) handleError(err error) {
+func (c *ConsumerOf[T]) handleError(data T, err error) {
 
 	// Notify error happened
-	c.Notifier("ConsumerError")
+	c.emit(ConsumeError, err)
 
-	// Invoke custom error handler
+	// A panic went to PanicHandler already
+	if c.PanicHandler != nil && panicked(err) {
+		return
+	}
+
+	// Invoke custom error handlers
 	if c.ErrHandler != nil {
 		c.ErrHandler(err)
 	}
+	if c.ItemErrHandler != nil {
+		c.ItemErrHandler(data, err)
+	}
 
 	// Any other error handling logic...
 
 }
 
+// read waits for the next item from Queue, if set, or from Buffer. The
+// second return value is false once the input is closed and drained, ctx
+// is done or no item arrived for IdleTimeout.
+func (c *ConsumerOf[T]) read(ctx context.Context) (T, bool) {
+
+	// Read the partition of the goroutine, if set, which Run fills
+	if in := partitionOf[T](ctx); in != nil {
+		return readPartition(ctx, in)
+	}
+
+	if c.IdleTimeout <= 0 {
+		return c.readInput(ctx)
+	}
+
+	for {
+		// Wait until IdleTimeout after the latest item read by any goroutine
+		idleCtx, cancel := context.WithDeadline(ctx, c.idleDeadline())
+		data, ok := c.readInput(idleCtx)
+		cancel()
+
+		if ok {
+			c.lastRead.Store(time.Now().UnixNano())
+			return data, true
+		}
+		if ctx.Err() != nil || idleCtx.Err() == nil {
+			return data, false
+		}
+
+		// Another goroutine may have read an item meanwhile
+		if !time.Now().Before(c.idleDeadline()) {
+			c.emit(ConsumerIdle, nil)
+			return data, false
+		}
+	}
+}
+
+// idleDeadline returns when the input is idle for IdleTimeout.
+func (c *ConsumerOf[T]) idleDeadline() time.Time {
+	last := time.Now()
+	if n := c.lastRead.Load(); n != 0 {
+		last = time.Unix(0, n)
+	}
+	return last.Add(c.IdleTimeout)
+}
+
+// readInput waits for the next item from Queue, if set, or from Buffer,
+// spinning for SpinBeforePark first.
+func (c *ConsumerOf[T]) readInput(ctx context.Context) (T, bool) {
+	if d := c.Tuning.SpinBeforePark; d > 0 {
+		if data, ok := spin(ctx, d, c.tryRead); ok {
+			return data, true
+		}
+	}
+	if c.Queue != nil {
+		data, err := c.Queue.Pop(ctx)
+		return data, err == nil
+	}
+	return c.readBuffer(ctx)
+}
+
+// tryRead takes the next item from Queue, if it can without waiting, or
+// from Buffer, in a non-blocking way.
+func (c *ConsumerOf[T]) tryRead() (T, bool) {
+	if c.Queue == nil {
+		return c.tryReadBuffer()
+	}
+	if q, ok := c.Queue.(interface{ TryPop() (T, bool) }); ok {
+		return q.TryPop()
+	}
+	var zero T
+	return zero, false
+}
+
 // tryReadBuffer tries to read data from the buffer channel in a
 // non-blocking way.
 // It returns the data if read succeeded, otherwise nil.
-// The second return value indicates if read succeeded.
-func (c *Consumer) tryReadBuffer() (interface{}, bool) {
+// The second return value indicates if read succeeded, and is false
+// once the buffer is closed and drained.
+func (c *ConsumerOf[T]) tryReadBuffer() (T, bool) {
 	// 非阻塞读取 buffer
 	select {
-	case data := <-c.Buffer:
-		return data, true
+	case data, ok := <-c.Buffer:
+		return data, ok
 	default:
-		return nil, false
+		var zero T
+		return zero, false
 	}
 }
 
-// isTimedOut checks if timeout has occurred.
-func (c *Consumer) isTimedOut(timeout time.Duration) bool {
-
+// readBuffer waits for data from the buffer channel. The second return
+// value is false once the buffer is closed and drained, or ctx is done.
+func (c *ConsumerOf[T]) readBuffer(ctx context.Context) (T, bool) {
 	select {
-	case <-time.After(timeout):
-		return true
-
-	default:
-		return false
+	case data, ok := <-c.Buffer:
+		return data, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
 	}
-
 }
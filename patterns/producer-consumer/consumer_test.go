@@ -6,9 +6,15 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/Alan-333333/go-channel-patterns/patterns/circuitbreaker"
+	"github.com/Alan-333333/go-channel-patterns/patterns/heartbeat"
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+	"github.com/Alan-333333/go-channel-patterns/patterns/retry"
 	"github.com/stretchr/testify/require"
 )
 
@@ -63,6 +69,8 @@ func TestRunProc(t *testing.T) {
 		ConsumeFunc: consumeFunc,
 	}
 	c.Buffer <- "data"
+	// 关闭后取完数据即返回
+	close(c.Buffer)
 	ctx := context.Background()
 	// 初始化 WaitGroup
 	var wg sync.WaitGroup
@@ -159,7 +167,7 @@ func TestHandleError(t *testing.T) {
 	}
 
 	// 测试调用
-	c.handleError(errors.New("test error"))
+	c.handleError(nil, errors.New("test error"))
 
 	// 验证
 	if !calledNotifier {
@@ -198,27 +206,383 @@ func TestTryReadBuffer(t *testing.T) {
 		t.Error("Should return channel data correctly")
 	}
 
+	// 测试通道关闭的情况,先读出剩余数据
+	c.Buffer <- "last"
+	close(c.Buffer)
+
+	if data, ok = c.tryReadBuffer(); !ok || data != "last" {
+		t.Error("Should return the data left in a closed buffer")
+	}
+
+	if _, ok = c.tryReadBuffer(); ok {
+		t.Error("Should return false when buffer is closed and drained")
+	}
+
 }
-func TestIsTimedOut(t *testing.T) {
+func TestConsumeRetry(t *testing.T) {
 
-	c := &Consumer{}
+	// 前两次失败,第三次成功
+	calls := 0
+	c := &Consumer{
+		ConsumeFunc: func(data interface{}) error {
+			calls++
+			if calls < 3 {
+				return errors.New("temporary")
+			}
+			return nil
+		},
+	}
+
+	var events []string
+	c.Notify(func(msg string) {
+		events = append(events, msg)
+	})
 
-	// 短暂 sleep 期间不应超时
-	timeout := 10 * time.Millisecond
-	time.Sleep(5 * time.Millisecond)
-	require.False(t, c.isTimedOut(timeout))
+	var delays []time.Duration
+	c.SetRetryPolicy(retry.Policy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	})
 
-	// 长时间 sleep 期间应超时
-	timeout = 10 * time.Millisecond
-	timer := time.After(20 * time.Millisecond)
+	err := c.consume(context.Background(), "data")
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+	require.Equal(t, []string{"ConsumerRetry", "ConsumerRetry"}, events)
+	require.Equal(t, []time.Duration{time.Second, time.Second}, delays)
+}
+
+func TestConsumeRetryExhausted(t *testing.T) {
+
+	// 重试次数用尽,返回最后一次的错误
+	errFail := errors.New("fail")
+	calls := 0
+	c := &Consumer{
+		ConsumeFunc: func(data interface{}) error {
+			calls++
+			return errFail
+		},
+	}
+	c.SetRetryPolicy(retry.Policy{
+		MaxAttempts: 2,
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			return nil
+		},
+	})
+
+	err := c.consume(context.Background(), "data")
+
+	require.Equal(t, errFail, err)
+	require.Equal(t, 2, calls)
+}
+
+func TestConsumeBreaker(t *testing.T) {
+
+	// 连续失败两次后熔断,不再调用消费函数
+	calls := 0
+	c := &Consumer{
+		ConsumeFunc: func(data interface{}) error {
+			calls++
+			return errors.New("fail")
+		},
+	}
+	b, err := circuitbreaker.New(circuitbreaker.WithFailureThreshold(2))
+	require.NoError(t, err)
+	c.SetBreaker(b)
+
+	for i := 0; i < 5; i++ {
+		err = c.consume(context.Background(), "data")
+	}
+
+	require.ErrorIs(t, err, circuitbreaker.ErrOpen)
+	require.Equal(t, 2, calls)
+}
+
+func TestConsumerHeartbeat(t *testing.T) {
+
+	// 消费函数卡住时,心跳监控报告该 goroutine
+	release := make(chan struct{})
+	c := NewConsumer(1, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		<-release
+		return nil
+	}
+
+	m := heartbeat.New(10*time.Millisecond, heartbeat.WithMisses(2))
+	c.SetHeartbeat(m)
+
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	go m.Run(ctx)
+
+	c.Buffer <- "data"
+	c.Close()
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
 
 	select {
-	case <-timer:
-	case <-timeoutCtx.Done():
-		// 处理接收被阻塞问题
-		require.True(t, c.isTimedOut(timeout))
+	case s := <-m.Stalls():
+		require.Equal(t, "consumer-1", s.Name)
+	case <-time.After(time.Second):
+		t.Fatal("stalled consumer not reported")
+	}
+
+	close(release)
+	<-done
+}
+
+func TestConsumerOut(t *testing.T) {
+
+	// 每个数据的处理结果都发送到 Out
+	errOdd := errors.New("odd")
+	c := NewConsumer(4, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		if data.(int)%2 == 1 {
+			return errOdd
+		}
+		return nil
+	}
+
+	out := make(chan result.Result[interface{}], 4)
+	c.SetOut(out)
+
+	for i := 0; i < 4; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	c.runProc(context.Background(), &wg)
+	close(out)
+
+	var got []result.Result[interface{}]
+	for r := range out {
+		got = append(got, r)
+	}
+	require.Len(t, got, 4)
+	for i, r := range got {
+		require.Equal(t, i, r.Value)
+		if i%2 == 1 {
+			require.ErrorIs(t, r.Err, errOdd)
+		} else {
+			require.NoError(t, r.Err)
+		}
+	}
+}
+
+func TestConsumerRunReason(t *testing.T) {
+	q := queue.New[interface{}](10)
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+	c.ConsumeFunc = func(interface{}) error { return nil }
+
+	// 队列为空时等待,Stop 后返回 Stop 的原因
+	errFatal := errors.New("fatal")
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Run(context.Background())
+	}()
+	q.Push(context.Background(), 1)
+	require.Eventually(t, func() bool { return c.Stats().Processed == 1 }, time.Second, time.Millisecond)
+	c.Stop(errFatal)
+	require.Equal(t, errFatal, <-errc)
+
+	// 关闭并取完时返回 nil
+	q = queue.New[interface{}](10)
+	c = NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+	c.ConsumeFunc = func(interface{}) error { return nil }
+	q.Push(context.Background(), 1)
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+
+	// ctx 结束时返回 ctx 的原因
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errFatal)
+	c = NewConsumer(1, 1)
+	c.Notify(func(string) {})
+	require.Equal(t, errFatal, c.Run(ctx))
+}
+
+func TestConsumerBursts(t *testing.T) {
+	var consumed atomic.Int32
+	c := NewConsumer(10, 2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error {
+		consumed.Add(1)
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+
+	// 第一批数据处理完后缓冲为空,消费者继续等待
+	for i := 0; i < 5; i++ {
+		c.Buffer <- i
+	}
+	require.Eventually(t, func() bool { return consumed.Load() == 5 }, time.Second, time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	// 同一次 Run 处理第二批数据
+	for i := 0; i < 5; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+	require.NoError(t, <-done)
+	require.Equal(t, int32(10), consumed.Load())
+}
+
+func TestConsumerIdleTimeout(t *testing.T) {
+	const idle = 40 * time.Millisecond
+
+	var idled atomic.Int32
+	c := NewConsumer(10, 4)
+	c.Notify(func(event string) {
+		if event == "ConsumerIdle" {
+			idled.Add(1)
+		}
+	})
+	c.ConsumeFunc = func(interface{}) error { return nil }
+	c.IdleTimeout = idle
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+
+	// 数据持续到达时不退出,即使每个 goroutine 各自等待的时间超过 IdleTimeout
+	for i := 0; i < 10; i++ {
+		time.Sleep(idle / 2)
+		c.Buffer <- i
+		select {
+		case <-done:
+			t.Fatalf("Run returned after %d items while data kept coming", i)
+		default:
+		}
+	}
+	last := time.Now()
+
+	// 最后一个数据之后 IdleTimeout 退出,每个 goroutine 通知一次
+	require.NoError(t, <-done)
+	require.GreaterOrEqual(t, time.Since(last), idle)
+	require.Less(t, time.Since(last), 3*idle)
+	require.Equal(t, uint64(10), c.Stats().Processed)
+	require.Equal(t, int32(4), idled.Load())
+
+	// 队列同样适用
+	c.SetQueue(queue.New[interface{}](10))
+	start := time.Now()
+	require.NoError(t, c.Run(context.Background()))
+	require.GreaterOrEqual(t, time.Since(start), idle)
+}
+
+func TestConsumerItemErrHandler(t *testing.T) {
+
+	// 失败的数据和错误一起交给 ItemErrHandler,ErrHandler 仍然被调用
+	type order struct{ ID int }
+	errFail := errors.New("fail")
+	c := NewConsumerOf[*order](10, 1)
+	c.Notify(func(string) {})
+	bad := &order{ID: 2}
+	c.ConsumeFunc = func(o *order) error {
+		if o.ID == 2 {
+			return errFail
+		}
+		return nil
+	}
+	var calls []string
+	var items []*order
+	c.HandleError(func(err error) {
+		calls = append(calls, "ErrHandler")
+		require.ErrorIs(t, err, errFail)
+	})
+	c.SetItemErrHandler(func(o *order, err error) {
+		calls = append(calls, "ItemErrHandler")
+		items = append(items, o)
+		require.ErrorIs(t, err, errFail)
+	})
+
+	c.Buffer <- &order{ID: 1}
+	c.Buffer <- bad
+	c.Buffer <- &order{ID: 3}
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+
+	require.Equal(t, []string{"ErrHandler", "ItemErrHandler"}, calls)
+	require.Len(t, items, 1)
+	require.Same(t, bad, items[0])
+
+	// 只设置 ItemErrHandler 也可以
+	c = NewConsumerOf[*order](1, 1)
+	c.ConsumeFunc = func(*order) error { return errFail }
+	items = nil
+	c.SetItemErrHandler(func(o *order, err error) { items = append(items, o) })
+	c.Buffer <- bad
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+	require.Equal(t, []*order{bad}, items)
+}
+
+func TestConsumePerItemTimeout(t *testing.T) {
+
+	// 超时的数据收到 DeadlineExceeded,按时完成的正常处理
+	c := NewConsumer(10, 1)
+	c.Notify(func(string) {})
+	c.SetPerItemTimeout(20 * time.Millisecond)
+	c.ConsumeCtxFunc = func(ctx context.Context, data interface{}) error {
+		_, ok := ctx.Deadline()
+		require.True(t, ok)
+		if data == "slow" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+	var failed []interface{}
+	c.SetItemErrHandler(func(data interface{}, err error) {
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		failed = append(failed, data)
+	})
+	c.Buffer <- "fast"
+	c.Buffer <- "slow"
+	c.Close()
+	start := time.Now()
+	require.NoError(t, c.Run(context.Background()))
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, []interface{}{"slow"}, failed)
+	require.Equal(t, uint64(2), c.Stats().Processed)
+	require.Equal(t, uint64(1), c.Stats().Failed)
+
+	// 超时后返回 nil 也算失败,其他错误包装在内
+	errNet := errors.New("connection reset")
+	c = &Consumer{PerItemTimeout: 5 * time.Millisecond}
+	c.ConsumeFunc = func(data interface{}) error {
+		time.Sleep(10 * time.Millisecond)
+		if data == "err" {
+			return errNet
+		}
+		return nil
 	}
+	require.ErrorIs(t, c.consume(context.Background(), "ok"), context.DeadlineExceeded)
+	err := c.consume(context.Background(), "err")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, errNet)
+
+	// 不设置时不限制
+	c.PerItemTimeout = 0
+	require.NoError(t, c.consume(context.Background(), "ok"))
 }
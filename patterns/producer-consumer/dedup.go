@@ -0,0 +1,154 @@
+package producerconsumer
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+)
+
+// DedupOption configures a Dedup.
+type DedupOption func(*Dedup)
+
+// WithDedupClock sets the clock the window is measured with. The default
+// reads the system clock.
+func WithDedupClock(c clock.Nower) DedupOption {
+	return func(d *Dedup) {
+		d.clock = c
+	}
+}
+
+// DedupStats is a snapshot of a Dedup.
+type DedupStats struct {
+
+	// IDs is the number of IDs kept.
+	IDs int
+
+	// Evicted counts the IDs dropped to make room before their window
+	// ended. A duplicate of one of them is not detected.
+	Evicted uint64
+}
+
+// Dedup remembers the IDs of items for a time window, so a Consumer can
+// skip the items it sees again, such as when a producer retries or a
+// Replayer replays them.
+//
+// It keeps at most maxIDs IDs, dropping the oldest when full, so memory
+// is bounded. There are no false positives: an item is only skipped if
+// its exact ID was seen within the window. There can be false negatives:
+// a duplicate arriving after its ID was dropped is processed again, as
+// counted by DedupStats.Evicted. Size maxIDs for the items expected
+// within the window.
+type Dedup struct {
+	mu sync.Mutex
+
+	// idFunc returns the ID of an item.
+	idFunc func(interface{}) string
+
+	// window is how long an ID is remembered.
+	window time.Duration
+
+	// capacity is the maximum number of IDs kept.
+	capacity int
+
+	clock clock.Nower
+
+	// entries maps IDs to their element in order.
+	entries map[string]*list.Element
+
+	// order holds the IDs from newest to oldest.
+	order *list.List
+
+	evicted uint64
+}
+
+type dedupEntry struct {
+	id   string
+	seen time.Time
+}
+
+// NewDedup creates a Dedup remembering the IDs returned by idFunc for
+// window, keeping at most maxIDs of them. A non-positive maxIDs defaults
+// to 10000.
+func NewDedup(idFunc func(item interface{}) string, window time.Duration, maxIDs int, opts ...DedupOption) *Dedup {
+	if maxIDs <= 0 {
+		maxIDs = 10000
+	}
+	d := &Dedup{
+		idFunc:   idFunc,
+		window:   window,
+		capacity: maxIDs,
+		clock:    clock.New(),
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Seen reports whether the ID of item was seen within the window, and
+// remembers it if not. The window starts when an ID is first seen; seeing
+// it again does not extend it.
+func (d *Dedup) Seen(item interface{}) bool {
+	id := d.idFunc(item)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	d.expire(now)
+
+	if _, ok := d.entries[id]; ok {
+		return true
+	}
+
+	// Make room by dropping the oldest ID
+	for d.order.Len() >= d.capacity {
+		d.remove(d.order.Back())
+		d.evicted++
+	}
+
+	d.entries[id] = d.order.PushFront(&dedupEntry{id: id, seen: now})
+	return false
+}
+
+// Forget drops the ID of item, so it is not skipped if seen again, such as
+// after it failed.
+func (d *Dedup) Forget(item interface{}) {
+	id := d.idFunc(item)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if el, ok := d.entries[id]; ok {
+		d.remove(el)
+	}
+}
+
+// Stats returns a snapshot of the Dedup.
+func (d *Dedup) Stats() DedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(d.clock.Now())
+	return DedupStats{IDs: d.order.Len(), Evicted: d.evicted}
+}
+
+// expire drops the IDs seen longer than the window ago.
+func (d *Dedup) expire(now time.Time) {
+	for el := d.order.Back(); el != nil; el = d.order.Back() {
+		if now.Sub(el.Value.(*dedupEntry).seen) < d.window {
+			return
+		}
+		d.remove(el)
+	}
+}
+
+// remove drops the ID held by el.
+func (d *Dedup) remove(el *list.Element) {
+	d.order.Remove(el)
+	delete(d.entries, el.Value.(*dedupEntry).id)
+}
@@ -0,0 +1,116 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// order is an item identified by its ID.
+type order struct {
+	ID string
+}
+
+func orderID(item interface{}) string {
+	return item.(order).ID
+}
+
+func TestDedupReplay(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+
+	c := NewConsumer(10, 2)
+	c.Notify(func(string) {})
+	c.SetDedup(NewDedup(orderID, time.Minute, 100))
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[data.(order).ID]++
+		return nil
+	}
+
+	// 同一批数据送两次
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(context.Background())
+	}()
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 10; i++ {
+			c.Buffer <- order{ID: fmt.Sprint("order-", i)}
+		}
+	}
+	c.Close()
+	<-done
+
+	// 每个数据只交给 ConsumeFunc 一次
+	require.Len(t, calls, 10)
+	for id, n := range calls {
+		require.Equal(t, 1, n, id)
+	}
+	require.Equal(t, uint64(10), c.Stats().Processed)
+	require.Equal(t, uint64(10), c.Stats().DuplicatesSkipped)
+}
+
+func TestDedupFailedAgain(t *testing.T) {
+	calls := 0
+	c := NewConsumer(0, 1)
+	c.Notify(func(string) {})
+	c.SetDedup(NewDedup(orderID, time.Minute, 100))
+	c.ConsumeFunc = func(interface{}) error {
+		calls++
+		if calls == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	// 失败的数据再次出现时重新处理
+	item := order{ID: "a"}
+	require.Error(t, c.Process(context.Background(), item))
+	require.NoError(t, c.Process(context.Background(), item))
+	require.NoError(t, c.Process(context.Background(), item))
+	require.Equal(t, 2, calls)
+	require.Equal(t, uint64(1), c.Stats().DuplicatesSkipped)
+}
+
+func TestDedupWindow(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	d := NewDedup(orderID, time.Minute, 100, WithDedupClock(clk))
+
+	require.False(t, d.Seen(order{ID: "a"}))
+	clk.Add(30 * time.Second)
+	require.True(t, d.Seen(order{ID: "a"}))
+	require.False(t, d.Seen(order{ID: "b"}))
+
+	// 窗口从第一次看到时算起,过期后不再视为重复
+	clk.Add(30 * time.Second)
+	require.False(t, d.Seen(order{ID: "a"}))
+	require.True(t, d.Seen(order{ID: "b"}))
+	require.Equal(t, 2, d.Stats().IDs)
+
+	clk.Add(time.Hour)
+	require.Zero(t, d.Stats().IDs)
+}
+
+func TestDedupBounded(t *testing.T) {
+	d := NewDedup(orderID, time.Hour, 3)
+
+	for i := 0; i < 5; i++ {
+		require.False(t, d.Seen(order{ID: fmt.Sprint(i)}))
+	}
+
+	// 最多保留 3 个 ID,最早的被挤出后不再识别为重复
+	require.Equal(t, DedupStats{IDs: 3, Evicted: 2}, d.Stats())
+	require.False(t, d.Seen(order{ID: "0"}))
+	require.True(t, d.Seen(order{ID: "4"}))
+
+	d.Forget(order{ID: "4"})
+	require.False(t, d.Seen(order{ID: "4"}))
+}
@@ -0,0 +1,37 @@
+package producerconsumer
+
+import "context"
+
+// Drain processes the items left in Buffer or Queue, and those requeued
+// for MaxRedeliveries, one at a time in the calling goroutine, like the
+// processing goroutines do, without waiting for new ones. It returns the
+// number of items it took, failed ones included, and nil once there is
+// none left, or the cause of ctx if it is done first, such as at a drain
+// deadline.
+//
+// It is meant for after Run returned, such as when its context was
+// cancelled with items still buffered. A Queue must have a TryPop method
+// to be drained. Items handed off with MaxPending may still be pending
+// when it returns: see WaitPending.
+func (c *ConsumerOf[T]) Drain(ctx context.Context) (int, error) {
+	n := 0
+	for {
+		if ctx.Err() != nil {
+			return n, context.Cause(ctx)
+		}
+
+		// Take the requeued items first, then those of the input
+		item := &handoffItem{requeue: true}
+		r, ok := c.redelivery.pop()
+		data := r.data
+		if ok {
+			item.deliveries = r.deliveries
+			item.attempts = r.attempts
+		} else if data, ok = c.tryRead(); !ok {
+			return n, nil
+		}
+
+		c.process(ctx, data, item)
+		n++
+	}
+}
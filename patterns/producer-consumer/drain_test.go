@@ -0,0 +1,87 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+
+	// 流水线取消时缓冲中还有 50 个数据
+	p := NewProducer(50, 1)
+	p.Notify(func(string) {})
+	n := 0
+	p.ProduceFunc = func() (interface{}, error) {
+		if n++; n > 50 {
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+	require.NoError(t, p.Run(context.Background()))
+
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.Buffer = p.Buffer
+	var consumed atomic.Int64
+	c.ConsumeFunc = func(interface{}) error {
+		consumed.Add(1)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, c.Run(ctx), context.Canceled)
+	left := c.Stats().Buffered
+
+	// Run 返回后 Drain 处理剩下的全部数据
+	handled, err := c.Drain(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, left, handled)
+	require.Equal(t, int64(50), consumed.Load())
+	require.Zero(t, c.Stats().Buffered)
+
+	// 没有数据时立即返回
+	handled, err = c.Drain(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, handled)
+}
+
+func TestDrainDeadline(t *testing.T) {
+
+	// 到截止时间后停止,剩下的数据留在缓冲中
+	c := NewConsumer(50, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+	for i := 0; i < 50; i++ {
+		c.Buffer <- i
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	handled, err := c.Drain(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Greater(t, handled, 0)
+	require.Less(t, handled, 50)
+	require.Equal(t, 50-handled, len(c.Buffer))
+
+	// 等待重新投递的数据先处理
+	c = NewConsumer(10, 1)
+	c.Notify(func(string) {})
+	c.MaxRedeliveries = 1
+	c.redelivery.push(redelivery[interface{}]{data: "requeued"})
+	c.Buffer <- "buffered"
+	var got []interface{}
+	c.ConsumeFunc = func(data interface{}) error {
+		got = append(got, data)
+		return nil
+	}
+	handled, err = c.Drain(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, handled)
+	require.Equal(t, []interface{}{"requeued", "buffered"}, got)
+}
@@ -0,0 +1,217 @@
+package producerconsumer
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventKind is the kind of a lifecycle Event.
+type EventKind int
+
+const (
+	// ProducerStarted is sent once when Run starts.
+	ProducerStarted EventKind = iota + 1
+
+	// ProducerStopped is sent once when Run returns, with its error as
+	// the payload.
+	ProducerStopped
+
+	// ItemProduced is sent for each item written to Buffer or Queue, with
+	// the item as the payload.
+	ItemProduced
+
+	// ProducerError is sent for each error of ProduceFunc, or of Limiter,
+	// with the error as the payload.
+	ProducerError
+
+	// BackpressureApplied is sent each time Run backs off from a full
+	// Buffer, with the attempt as the payload.
+	BackpressureApplied
+
+	// InjectCompleted is sent for each item Inject or InjectAll wrote,
+	// with the item as the payload.
+	InjectCompleted
+
+	// ConsumerStarted is sent when Run starts each processing goroutine.
+	ConsumerStarted
+
+	// ConsumerStopped is sent once when Run returns, with its error as
+	// the payload.
+	ConsumerStopped
+
+	// ItemConsumed is sent for each item processed, failed or not, with
+	// the item as the payload. A failed one comes after its ConsumeError.
+	ItemConsumed
+
+	// ConsumeError is sent for each item that failed, with the error as
+	// the payload.
+	ConsumeError
+
+	// ConsumeRetry is sent before each retry of RetryPolicy, with the
+	// error of the failed attempt as the payload.
+	ConsumeRetry
+
+	// ConsumerIdle is sent when a processing goroutine returns after
+	// IdleTimeout.
+	ConsumerIdle
+
+	// TransformerStarted is sent when Inject of a Transformer starts each
+	// goroutine.
+	TransformerStarted
+
+	// ItemTransformed is sent for each item a Transformer wrote, with the
+	// result as the payload.
+	ItemTransformed
+
+	// TransformError is sent for each error of TransformFunc, with the
+	// error as the payload.
+	TransformError
+
+	// ProducerPaused is sent when Pause pauses a running Producer.
+	ProducerPaused
+
+	// ProducerResumed is sent when Resume resumes a paused Producer.
+	ProducerResumed
+
+	// ConsumerPaused is sent when Pause pauses a running Consumer.
+	ConsumerPaused
+
+	// ConsumerResumed is sent when Resume resumes a paused Consumer.
+	ConsumerResumed
+
+	// WorkerAdded is sent when Autoscale adds a goroutine to Run of a
+	// Producer or Consumer, with the number of goroutines as the payload.
+	WorkerAdded
+
+	// WorkerRetired is sent when Autoscale retires a goroutine, with the
+	// number of goroutines left as the payload.
+	WorkerRetired
+
+	// ItemRequeued is sent for each item requeued for MaxRedeliveries,
+	// with the item as the payload.
+	ItemRequeued
+
+	// ThrottleAdjusted is sent when Inject changes the delay of Throttle,
+	// with the new time.Duration as the payload.
+	ThrottleAdjusted
+)
+
+// String returns the name of the kind.
+func (k EventKind) String() string {
+	switch k {
+	case ProducerStarted:
+		return "ProducerStarted"
+	case ProducerStopped:
+		return "ProducerStopped"
+	case ItemProduced:
+		return "ItemProduced"
+	case ProducerError:
+		return "ProducerError"
+	case BackpressureApplied:
+		return "BackpressureApplied"
+	case InjectCompleted:
+		return "InjectCompleted"
+	case ConsumerStarted:
+		return "ConsumerStarted"
+	case ConsumerStopped:
+		return "ConsumerStopped"
+	case ItemConsumed:
+		return "ItemConsumed"
+	case ConsumeError:
+		return "ConsumeError"
+	case ConsumeRetry:
+		return "ConsumeRetry"
+	case ConsumerIdle:
+		return "ConsumerIdle"
+	case TransformerStarted:
+		return "TransformerStarted"
+	case ItemTransformed:
+		return "ItemTransformed"
+	case TransformError:
+		return "TransformError"
+	case ProducerPaused:
+		return "ProducerPaused"
+	case ProducerResumed:
+		return "ProducerResumed"
+	case ConsumerPaused:
+		return "ConsumerPaused"
+	case ConsumerResumed:
+		return "ConsumerResumed"
+	case WorkerAdded:
+		return "WorkerAdded"
+	case WorkerRetired:
+		return "WorkerRetired"
+	case ItemRequeued:
+		return "ItemRequeued"
+	case ThrottleAdjusted:
+		return "ThrottleAdjusted"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// notification returns the string Notifier received for k before events
+// were typed, or "" if it received none. Of the later kinds, only the
+// scaling ones have one.
+func (k EventKind) notification() string {
+	switch k {
+	case WorkerAdded:
+		return "ScaleUp"
+	case WorkerRetired:
+		return "ScaleDown"
+	case ProducerError:
+		return "ProducerError"
+	case BackpressureApplied:
+		return "buff full sleep"
+	case InjectCompleted:
+		return "InjectFinished"
+	case ConsumerStarted:
+		return "ConsumerStarted"
+	case ConsumeError:
+		return "ConsumerError"
+	case ConsumeRetry:
+		return "ConsumerRetry"
+	case ConsumerIdle:
+		return "ConsumerIdle"
+	case TransformerStarted:
+		return "TransformerStarted"
+	case ItemTransformed:
+		return "TransformFinished"
+	case TransformError:
+		return "TransformerError"
+	default:
+		return ""
+	}
+}
+
+// Event is something that happened in a Producer, Consumer or
+// Transformer, passed to their EventHandler.
+type Event struct {
+
+	// Kind tells what happened.
+	Kind EventKind
+
+	// Time is when it happened.
+	Time time.Time
+
+	// Payload is the item, error or attempt the kind documents, or nil.
+	Payload interface{}
+}
+
+// EventHandler receives the lifecycle events of a Producer, Consumer or
+// Transformer. It is called from their goroutines, so it must be safe for
+// concurrent use and return quickly.
+type EventHandler func(Event)
+
+// emit sends an event of kind to handler, if set, and its old name to
+// notifier, if set and it has one.
+func emit(handler EventHandler, notifier func(string), kind EventKind, payload interface{}) {
+	if handler != nil {
+		handler(Event{Kind: kind, Time: time.Now(), Payload: payload})
+	}
+	if notifier != nil {
+		if name := kind.notification(); name != "" {
+			notifier(name)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordEvents returns a handler appending the events it receives to
+// events, and the strings a Notifier receives to names.
+func recordEvents(events *[]Event, names *[]string) (EventHandler, Notifier) {
+	return func(e Event) { *events = append(*events, e) },
+		func(name string) { *names = append(*names, name) }
+}
+
+func TestEvents(t *testing.T) {
+	errProduce := errors.New("produce failed")
+	errConsume := errors.New("consume failed")
+	ctx := context.Background()
+
+	// 生产者:一个数据,一次错误,再一个数据,然后结束
+	var pEvents []Event
+	var pNames []string
+	p := NewProducer(10, 1)
+	handler, notifier := recordEvents(&pEvents, &pNames)
+	p.SetEventHandler(handler)
+	p.Notify(notifier)
+	n := 0
+	p.ProduceFunc = func() (interface{}, error) {
+		n++
+		switch n {
+		case 2:
+			return nil, errProduce
+		case 4:
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+	require.NoError(t, p.RunAndClose(ctx))
+
+	// 消费者:第二个数据失败
+	var cEvents []Event
+	var cNames []string
+	c := NewConsumer(10, 1)
+	handler, notifier = recordEvents(&cEvents, &cNames)
+	c.SetEventHandler(handler)
+	c.Notify(notifier)
+	c.ConsumeFunc = func(data interface{}) error {
+		if data == 3 {
+			return errConsume
+		}
+		return nil
+	}
+	p.Inject(ctx, c.Buffer)
+	require.NoError(t, c.Run(ctx))
+
+	// 事件按发生顺序到达,带着数据或错误
+	type kp struct {
+		Kind    EventKind
+		Payload interface{}
+	}
+	got := func(events []Event) []kp {
+		var out []kp
+		for i, e := range events {
+			out = append(out, kp{e.Kind, e.Payload})
+			require.False(t, e.Time.IsZero())
+			if i > 0 {
+				require.False(t, e.Time.Before(events[i-1].Time))
+			}
+		}
+		return out
+	}
+	require.Equal(t, []kp{
+		{ProducerStarted, nil},
+		{ItemProduced, 1},
+		{ProducerError, errProduce},
+		{ItemProduced, 3},
+		{ProducerStopped, nil},
+		{InjectCompleted, 1},
+		{InjectCompleted, 3},
+	}, got(pEvents))
+	require.Equal(t, []kp{
+		{ConsumerStarted, nil},
+		{ItemConsumed, 1},
+		{ConsumeError, errConsume},
+		{ItemConsumed, 3},
+		{ConsumerStopped, nil},
+	}, got(cEvents))
+
+	// Notifier 仍然收到原来的字符串
+	require.Equal(t, []string{"ProducerError", "InjectFinished", "InjectFinished"}, pNames)
+	require.Equal(t, []string{"ConsumerStarted", "ConsumerError"}, cNames)
+}
+
+func TestEventsStopped(t *testing.T) {
+
+	// 停止事件带着 Run 返回的错误
+	var events []Event
+	c := NewConsumer(1, 1)
+	c.SetEventHandler(func(e Event) { events = append(events, e) })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, c.Run(ctx), context.Canceled)
+	require.Equal(t, ConsumerStopped, events[len(events)-1].Kind)
+	require.ErrorIs(t, events[len(events)-1].Payload.(error), context.Canceled)
+
+	// 没有 Notifier 和 EventHandler 时不发送
+	failed := false
+	p := NewProducer(1, 1)
+	p.ProduceFunc = func() (interface{}, error) {
+		if !failed {
+			failed = true
+			return nil, errors.New("failed")
+		}
+		return nil, ErrDone
+	}
+	require.NoError(t, p.Run(context.Background()))
+	require.Equal(t, uint64(1), p.Stats().Failed)
+}
+
+func TestEventKindString(t *testing.T) {
+	require.Equal(t, "BackpressureApplied", BackpressureApplied.String())
+	require.Equal(t, "ConsumeError", ConsumeError.String())
+	require.Equal(t, "EventKind(99)", EventKind(99).String())
+
+	// 原来的字符串
+	require.Equal(t, "buff full sleep", BackpressureApplied.notification())
+	require.Equal(t, "InjectFinished", InjectCompleted.notification())
+	require.Empty(t, ItemProduced.notification())
+}
+
+func TestNilCallbacks(t *testing.T) {
+
+	// 不设置任何回调,完整运行生产、转换和消费,出错时也不 panic
+	n := 0
+	p := NewProducer(2, 1)
+	p.Overflow = OverflowBlock
+	p.ProduceFunc = func() (interface{}, error) {
+		n++
+		switch {
+		case n == 3:
+			return nil, errors.New("produce failed")
+		case n > 20:
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+
+	tr := NewTransformer(2, 2)
+	tr.TransformFunc = func(data interface{}) (interface{}, error) {
+		if data.(int)%5 == 0 {
+			return nil, errors.New("transform failed")
+		}
+		return data, nil
+	}
+
+	var consumed []interface{}
+	c := NewConsumer(2, 1)
+	c.ConsumeFunc = func(data interface{}) error {
+		consumed = append(consumed, data)
+		if data.(int)%7 == 0 {
+			return errors.New("consume failed")
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	go p.RunAndClose(ctx)
+	go p.Inject(ctx, tr.Buffer)
+	go tr.Inject(ctx, c.Buffer)
+	require.NotPanics(t, func() {
+		require.NoError(t, c.Run(ctx))
+	})
+	require.Len(t, consumed, 15)
+	require.Equal(t, uint64(1), p.Stats().Failed)
+	require.Equal(t, uint64(2), c.Stats().Failed)
+
+	// 缓冲满时反压也不 panic
+	full := NewProducer(1, 1)
+	full.SetBackpressure(FixedBackpressure(time.Millisecond))
+	full.ProduceFunc = func() (interface{}, error) { return 1, nil }
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.NotPanics(t, func() {
+		require.ErrorIs(t, full.Run(timeout), context.DeadlineExceeded)
+	})
+	require.NotZero(t, full.Stats().Backpressure)
+
+	// 设置为 nil 同样不通知
+	p.Notify(nil)
+	p.HandleError(nil)
+	c.Notify(nil)
+	c.HandleError(nil)
+	require.NotPanics(t, func() {
+		p.handleError(nil, errors.New("failed"))
+		c.handleError(nil, errors.New("failed"))
+	})
+}
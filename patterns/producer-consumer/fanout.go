@@ -0,0 +1,176 @@
+package producerconsumer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// FanOutStrategy decides which of its out channels InjectAll writes an
+// item to.
+type FanOutStrategy int
+
+const (
+	// FanOutBroadcast writes a copy of every item to each channel.
+	FanOutBroadcast FanOutStrategy = iota
+
+	// FanOutRoundRobin writes each item to a single channel, taking them
+	// in turn and skipping the full ones.
+	FanOutRoundRobin
+)
+
+// String returns the name of the strategy.
+func (s FanOutStrategy) String() string {
+	switch s {
+	case FanOutBroadcast:
+		return "broadcast"
+	case FanOutRoundRobin:
+		return "round-robin"
+	default:
+		return fmt.Sprintf("FanOutStrategy(%d)", int(s))
+	}
+}
+
+// InjectAll is Inject to several out channels, such as the Buffers of
+// several consumers, writing each item to them following strategy.
+//
+// A full channel follows Overflow on its own: with the default policy,
+// broadcast drops the copy for that channel only, and round-robin tries
+// the next channels before dropping the item when all of them are full.
+// With OverflowBlock, broadcast waits for every channel to take its copy,
+// writing to the others as soon as they have room, and round-robin waits
+// for the first channel with room. Dropped copies count in Stats as
+// Dropped.
+//
+// Like Inject, it closes every out once the buffer is closed and drained,
+// unless ctx is done first. outs must not be closed while it runs. With
+// no outs, it returns at once, leaving the items in the buffer.
+func (p *ProducerOf[T]) InjectAll(ctx context.Context, outs []chan T, strategy FanOutStrategy) {
+
+	// Nowhere to write, so do not take the items
+	if len(outs) == 0 {
+		return
+	}
+
+	next := 0
+	y := yielder{every: p.Tuning.YieldEvery}
+	var held []T
+	for {
+
+		// Check for context cancellation
+		if p.isCancelled(ctx) {
+			return
+		}
+
+		// Wait for data in the buffer
+		data, ok := p.readBuffer(ctx)
+		if !ok {
+			// Closed and drained, nothing more for outs
+			if ctx.Err() == nil {
+				for _, out := range outs {
+					close(out)
+				}
+			}
+			return
+		}
+		// Take the items already there too, up to MaxBatchDrain
+		held = drainInto(append(held[:0], data), p.Tuning.MaxBatchDrain, p.tryReadBuffer)
+
+		for _, data := range held {
+			// Drop the items that waited too long
+			data, live := unstamp(data)
+			if !live {
+				continue
+			}
+
+			// Write to the out channels, or handle the overflow
+			var written bool
+			if strategy == FanOutRoundRobin {
+				written = p.roundRobin(ctx, outs, &next, data)
+			} else {
+				written = p.broadcast(ctx, outs, data)
+			}
+			y.item()
+			if !written {
+				continue
+			}
+			// Notify data injected
+			p.emit(InjectCompleted, data)
+		}
+
+	}
+}
+
+// broadcast writes data to each of outs following Overflow. It returns
+// false if no channel took it.
+func (p *ProducerOf[T]) broadcast(ctx context.Context, outs []chan T, data T) bool {
+	if p.Overflow == OverflowBlock {
+		return p.sendAll(ctx, outs, data) > 0
+	}
+
+	written := false
+	for _, out := range outs {
+		if p.overflow(ctx, out, data) {
+			written = true
+		}
+	}
+	return written
+}
+
+// roundRobin writes data to the first of outs with room from next on,
+// moving next past it. If all of them are full, it follows Overflow on
+// the channel whose turn it is, or, for OverflowBlock, waits for any of
+// them. It returns false if data was not written.
+func (p *ProducerOf[T]) roundRobin(ctx context.Context, outs []chan T, next *int, data T) bool {
+	n := len(outs)
+	for i := 0; i < n; i++ {
+		j := (*next + i) % n
+		if p.tryWrite(outs[j], data) {
+			*next = (j + 1) % n
+			return true
+		}
+	}
+
+	if p.Overflow == OverflowBlock {
+		j, ok := sendAny(ctx, outs, data)
+		if ok {
+			*next = (j + 1) % n
+		}
+		return ok
+	}
+
+	out := outs[*next]
+	*next = (*next + 1) % n
+	return p.overflow(ctx, out, data)
+}
+
+// sendAll writes data to each of outs, waiting for the full ones, in the
+// order they have room. It returns how many took it before ctx was done.
+func (p *ProducerOf[T]) sendAll(ctx context.Context, outs []chan T, data T) int {
+	left := append([]chan T(nil), outs...)
+	for len(left) > 0 {
+		j, ok := sendAny(ctx, left, data)
+		if !ok {
+			break
+		}
+		left = append(left[:j], left[j+1:]...)
+	}
+	return len(outs) - len(left)
+}
+
+// sendAny writes data to the first of outs with room, waiting for one
+// until ctx is done. It returns the index of the channel and whether data
+// was written.
+func sendAny[T any](ctx context.Context, outs []chan T, data T) (int, bool) {
+	cases := make([]reflect.SelectCase, len(outs)+1)
+	for i, out := range outs {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(out), Send: reflect.ValueOf(&data).Elem()}
+	}
+	cases[len(outs)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
+	i, _, _ := reflect.Select(cases)
+	if i == len(outs) {
+		return 0, false
+	}
+	return i, true
+}
@@ -0,0 +1,171 @@
+package producerconsumer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fanOutConsumers returns consumers taking delays[i] per item, recording
+// the items each one consumed.
+func fanOutConsumers(delays ...time.Duration) ([]*Consumer, func(i int) []int) {
+	var mu sync.Mutex
+	got := make([][]int, len(delays))
+	cs := make([]*Consumer, len(delays))
+	for i, d := range delays {
+		i, d := i, d
+		c := NewConsumer(2, 1)
+		c.Notify(func(string) {})
+		c.ConsumeFunc = func(data interface{}) error {
+			time.Sleep(d)
+			mu.Lock()
+			defer mu.Unlock()
+			got[i] = append(got[i], data.(int))
+			return nil
+		}
+		cs[i] = c
+	}
+	return cs, func(i int) []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), got[i]...)
+	}
+}
+
+// fanOut injects items 0 to n-1 from a producer into the consumers with
+// strategy, and waits for them to finish.
+func fanOut(t *testing.T, p *Producer, cs []*Consumer, n int, strategy FanOutStrategy) {
+	for i := 0; i < n; i++ {
+		p.Buffer <- i
+	}
+	p.Close()
+
+	outs := make([]chan interface{}, len(cs))
+	for i, c := range cs {
+		outs[i] = c.Buffer
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, c := range cs {
+		wg.Add(1)
+		go func(c *Consumer) {
+			defer wg.Done()
+			require.NoError(t, c.Run(ctx))
+		}(c)
+	}
+	p.InjectAll(ctx, outs, strategy)
+	wg.Wait()
+}
+
+func TestInjectAllBroadcast(t *testing.T) {
+	const n = 50
+
+	// 阻塞时快慢不同的消费者都按顺序收到全部数据
+	cs, got := fanOutConsumers(0, 2*time.Millisecond)
+	p := NewProducer(n, 1)
+	p.Notify(func(string) {})
+	p.Overflow = OverflowBlock
+	fanOut(t, p, cs, n, FanOutBroadcast)
+
+	for i := range cs {
+		require.Len(t, got(i), n)
+		require.True(t, sort.IntsAreSorted(got(i)))
+	}
+	require.Zero(t, p.Stats().Dropped)
+
+	// 默认策略下只丢弃满了的那个 channel 的一份,不影响其他 channel
+	p = NewProducer(n, 1)
+	p.Notify(func(string) {})
+	for i := 0; i < n; i++ {
+		p.Buffer <- i
+	}
+	p.Close()
+	outs := []chan interface{}{make(chan interface{}, n), make(chan interface{}, 5)}
+	p.InjectAll(context.Background(), outs, FanOutBroadcast)
+	require.Len(t, outs[0], n)
+	require.Len(t, outs[1], 5)
+	require.Equal(t, uint64(n-5), p.Stats().Dropped)
+	require.Equal(t, 0, <-outs[1])
+}
+
+func TestInjectAllRoundRobin(t *testing.T) {
+	const n = 60
+
+	// 阻塞时每个数据恰好交给一个消费者,快的消费者分到更多
+	cs, got := fanOutConsumers(0, 5*time.Millisecond)
+	p := NewProducer(n, 1)
+	p.Notify(func(string) {})
+	p.Overflow = OverflowBlock
+	fanOut(t, p, cs, n, FanOutRoundRobin)
+
+	all := append(got(0), got(1)...)
+	sort.Ints(all)
+	for i := 0; i < n; i++ {
+		require.Equal(t, i, all[i])
+	}
+	require.Greater(t, len(got(0)), len(got(1)))
+	require.Zero(t, p.Stats().Dropped)
+
+	// 都有空间时轮流分配
+	p = NewProducer(6, 1)
+	p.Notify(func(string) {})
+	for i := 0; i < 6; i++ {
+		p.Buffer <- i
+	}
+	p.Close()
+	outs := []chan interface{}{make(chan interface{}, 6), make(chan interface{}, 6)}
+	p.InjectAll(context.Background(), outs, FanOutRoundRobin)
+	for i, want := range [][]interface{}{{0, 2, 4}, {1, 3, 5}} {
+		var items []interface{}
+		for v := range outs[i] {
+			items = append(items, v)
+		}
+		require.Equal(t, want, items)
+	}
+
+	// 默认策略下全部满时丢弃
+	p = NewProducer(6, 1)
+	p.Notify(func(string) {})
+	for i := 0; i < 6; i++ {
+		p.Buffer <- i
+	}
+	p.Close()
+	outs = []chan interface{}{make(chan interface{}, 1), make(chan interface{}, 2)}
+	p.InjectAll(context.Background(), outs, FanOutRoundRobin)
+	require.Equal(t, uint64(3), p.Stats().Dropped)
+	require.Len(t, outs[0], 1)
+	require.Len(t, outs[1], 2)
+}
+
+func TestInjectAllNoOuts(t *testing.T) {
+	for _, strategy := range []FanOutStrategy{FanOutBroadcast, FanOutRoundRobin} {
+		for _, overflow := range []OverflowPolicy{OverflowBackpressure, OverflowBlock} {
+
+			// 没有输出 channel 时立即返回,数据留在缓冲中
+			p := NewProducer(6, 1)
+			p.Notify(func(string) {})
+			p.Overflow = overflow
+			for i := 0; i < 6; i++ {
+				p.Buffer <- i
+			}
+			p.Close()
+			p.InjectAll(context.Background(), nil, strategy)
+			require.Len(t, p.Buffer, 6, "%v %v", strategy, overflow)
+			require.Zero(t, p.Stats().Dropped)
+
+			p.InjectAll(context.Background(), []chan interface{}{}, strategy)
+			require.Len(t, p.Buffer, 6, "%v %v", strategy, overflow)
+		}
+	}
+}
+
+func TestFanOutStrategyString(t *testing.T) {
+	require.Equal(t, "broadcast", FanOutBroadcast.String())
+	require.Equal(t, "round-robin", FanOutRoundRobin.String())
+	require.Equal(t, "FanOutStrategy(7)", FanOutStrategy(7).String())
+}
@@ -0,0 +1,124 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+	"github.com/stretchr/testify/require"
+)
+
+// event is a struct item.
+type event struct {
+	ID   int
+	Name string
+}
+
+func TestProducerConsumerOfStruct(t *testing.T) {
+	var mu sync.Mutex
+	next := 0
+	p := NewProducerOf[event](0, 2)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (event, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// 结构体没有 nil,用 ErrDone 结束
+		if next == 20 {
+			return event{}, ErrDone
+		}
+		next++
+		return event{ID: next, Name: "click"}, nil
+	}
+
+	sum, clicks := 0, 0
+	c := NewConsumerOf[event](0, 2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(e event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sum += e.ID
+		if e.Name == "click" {
+			clicks++
+		}
+		return nil
+	}
+
+	require.NoError(t, ConnectOf(context.Background(), p, c, 4))
+	require.Equal(t, 210, sum)
+	require.Equal(t, 20, clicks)
+	require.Equal(t, uint64(20), p.Stats().Produced)
+	require.Equal(t, uint64(20), c.Stats().Processed)
+}
+
+func TestProducerConsumerOfPointer(t *testing.T) {
+	events := []*event{{ID: 1}, {ID: 2}, {ID: 3}}
+	p := NewProducerOf[*event](0, 1)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (*event, error) {
+
+		// nil 指针结束生产
+		if len(events) == 0 {
+			return nil, nil
+		}
+		e := events[0]
+		events = events[1:]
+		return e, nil
+	}
+
+	boom := errors.New("boom")
+	out := make(chan result.Result[*event], 3)
+	c := NewConsumerOf[*event](0, 1)
+	c.Notify(func(string) {})
+	c.HandleError(func(error) {})
+	c.SetOut(out)
+	c.ConsumeFunc = func(e *event) error {
+		e.Name = "seen"
+		if e.ID == 2 {
+			return boom
+		}
+		return nil
+	}
+
+	require.NoError(t, ConnectOf(context.Background(), p, c, 1))
+
+	// 结果也是带类型的
+	for id := 1; id <= 3; id++ {
+		r := <-out
+		require.Equal(t, id, r.Value.ID)
+		require.Equal(t, "seen", r.Value.Name)
+		if id == 2 {
+			require.ErrorIs(t, r.Err, boom)
+		} else {
+			require.NoError(t, r.Err)
+		}
+	}
+}
+
+func TestProducerOfZeroValues(t *testing.T) {
+	values := []int{0, 1, 0}
+	p := NewProducerOf[int](10, 1)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (int, error) {
+		if len(values) == 0 {
+			return 0, ErrDone
+		}
+		v := values[0]
+		values = values[1:]
+		return v, nil
+	}
+
+	var got []int
+	c := NewConsumerOf[int](0, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(v int) error {
+		got = append(got, v)
+		return nil
+	}
+
+	// 0 是数据,不会结束生产
+	require.NoError(t, ConnectOf(context.Background(), p, c, 1))
+	require.Equal(t, []int{0, 1, 0}, got)
+}
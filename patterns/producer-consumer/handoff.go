@@ -0,0 +1,291 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/retry"
+)
+
+// ErrAbandoned is the error of an item whose Pending handle WaitPending
+// abandoned before it was confirmed or failed.
+var ErrAbandoned = errors.New("pending item abandoned")
+
+// Pending is the handle of an item handed off to an asynchronous sink,
+// such as a Kafka producer. ConsumeFunc returns it as its error to leave
+// the item in flight: the item is consumed only once Confirm is called.
+type Pending struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// NewPending creates a Pending handle.
+func NewPending() *Pending {
+	return &Pending{done: make(chan struct{})}
+}
+
+// Confirm consumes the item. Only the first Confirm or Fail counts.
+func (p *Pending) Confirm() {
+	p.resolve(nil)
+}
+
+// Fail fails the item with err as if ConsumeFunc returned it: it is
+// retried per RetryPolicy, then reported to ErrHandler and Out.
+func (p *Pending) Fail(err error) {
+	p.resolve(err)
+}
+
+func (p *Pending) Error() string {
+	return "item pending"
+}
+
+// resolve settles the handle with err, reporting false if it was settled
+// already.
+func (p *Pending) resolve(err error) bool {
+	resolved := false
+	p.once.Do(func() {
+		p.err = err
+		close(p.done)
+		resolved = true
+	})
+	return resolved
+}
+
+// PendingReport tells what WaitPending waited for.
+type PendingReport struct {
+
+	// Settled counts the handed-off items that finished while waiting.
+	Settled uint64
+
+	// Abandoned holds the items whose handles were still pending when
+	// the context was done. They failed with ErrAbandoned.
+	Abandoned []interface{}
+}
+
+// WaitPending waits for the items handed off with a Pending handle to be
+// confirmed or failed, and for failed ones to be retried and reported.
+// If ctx is done first, it abandons the handles still pending, waits for
+// their items to fail with ErrAbandoned and returns the context error.
+//
+// Call it once the consumer stopped taking items, such as after Run
+// returned.
+func (c *ConsumerOf[T]) WaitPending(ctx context.Context) (*PendingReport, error) {
+	h := &c.handoff
+	settled := h.settledCount()
+
+	err := h.wait(ctx)
+	if err != nil {
+		h.abandon()
+		h.wait(context.Background())
+	}
+
+	return h.report(settled), err
+}
+
+// handoffKey is the context key of the *handoffItem being processed.
+type handoffKey struct{}
+
+// handoffItem follows one item through its handed-off attempts.
+type handoffItem struct {
+
+	// detached is closed once the item is handed off, letting Process
+	// return. It is nil without MaxPending.
+	detached chan struct{}
+
+	// counted tells whether the item is counted in the handoffs.
+	counted bool
+
+	// handedOff tells whether a handle was returned for the item.
+	handedOff bool
+
+	// attempts counts the calls to ConsumeFunc for the item.
+	attempts int
+
+	// ordered tells whether the item was read by an Ordered Consumer,
+	// numbered seq.
+	ordered bool
+	seq     uint64
+
+	// requeue tells whether the item was read by a processing goroutine,
+	// and may be requeued for MaxRedeliveries, and deliveries how many
+	// times it was already.
+	requeue    bool
+	deliveries int
+}
+
+// handoffs tracks the items of a Consumer handed off to sinks.
+type handoffs struct {
+	mu sync.Mutex
+
+	// slots bounds the items processed or handed off at once to
+	// MaxPending. It is made on first use.
+	slots chan struct{}
+
+	// waiting holds the unsettled handles, with their items.
+	waiting map[*Pending]interface{}
+
+	// items counts the items holding a slot or handed off, and not
+	// finished.
+	items int
+
+	// changed is closed, and replaced, whenever items drops.
+	changed chan struct{}
+
+	// abandoning settles new handles as abandoned while set.
+	abandoning bool
+	abandoned  []interface{}
+
+	settled uint64
+}
+
+// await waits for p, returned by ConsumeFunc for data, to be settled.
+// The first handle of an item lets Process return.
+func (c *ConsumerOf[T]) await(ctx context.Context, data interface{}, p *Pending) error {
+	h := &c.handoff
+	item, _ := ctx.Value(handoffKey{}).(*handoffItem)
+
+	if item != nil && !item.handedOff {
+		item.handedOff = true
+		if !item.counted {
+			item.counted = true
+			h.begin(0)
+		}
+		if item.detached != nil {
+			close(item.detached)
+		}
+	}
+
+	h.watch(p, data)
+	<-p.done
+	h.unwatch(p)
+
+	// Abandoned items are not retried
+	if errors.Is(p.err, ErrAbandoned) && c.RetryPolicy != nil {
+		return retry.Permanent(p.err)
+	}
+	return p.err
+}
+
+// begin counts an item, taking one of max slots, waiting for one if all
+// are taken, if max is positive.
+func (h *handoffs) begin(max int) {
+	h.mu.Lock()
+	if h.slots == nil && max > 0 {
+		h.slots = make(chan struct{}, max)
+	}
+	slots := h.slots
+	h.items++
+	h.mu.Unlock()
+
+	if slots != nil {
+		slots <- struct{}{}
+	}
+}
+
+// end counts an item started by begin finishing, freeing its slot.
+func (h *handoffs) end() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.slots != nil {
+		<-h.slots
+	}
+	h.items--
+	h.settled++
+	if h.changed != nil {
+		close(h.changed)
+		h.changed = nil
+	}
+}
+
+// watch adds p, the handle of data, to the unsettled handles, settling it
+// at once while abandoning.
+func (h *handoffs) watch(p *Pending, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.abandoning {
+		if p.resolve(ErrAbandoned) {
+			h.abandoned = append(h.abandoned, data)
+		}
+		return
+	}
+	if h.waiting == nil {
+		h.waiting = make(map[*Pending]interface{})
+	}
+	h.waiting[p] = data
+}
+
+// unwatch removes the settled handle p.
+func (h *handoffs) unwatch(p *Pending) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.waiting, p)
+}
+
+// pending returns the number of unsettled handles.
+func (h *handoffs) pending() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.waiting)
+}
+
+// wait waits for every item handed off to finish, or for ctx to be done.
+func (h *handoffs) wait(ctx context.Context) error {
+	for {
+		h.mu.Lock()
+		if h.items == 0 {
+			h.mu.Unlock()
+			return nil
+		}
+		if h.changed == nil {
+			h.changed = make(chan struct{})
+		}
+		changed := h.changed
+		h.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// abandon settles the unsettled handles, and the ones watched until the
+// next report, with ErrAbandoned.
+func (h *handoffs) abandon() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.abandoning = true
+	for p, data := range h.waiting {
+		if p.resolve(ErrAbandoned) {
+			h.abandoned = append(h.abandoned, data)
+		}
+	}
+}
+
+// settledCount returns the number of items handed off that finished.
+func (h *handoffs) settledCount() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.settled
+}
+
+// report returns what finished since settled and what was abandoned, and
+// stops abandoning.
+func (h *handoffs) report(settled uint64) *PendingReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := &PendingReport{Settled: h.settled - settled, Abandoned: h.abandoned}
+	h.abandoning = false
+	h.abandoned = nil
+	return r
+}
@@ -0,0 +1,215 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+	"github.com/Alan-333333/go-channel-patterns/patterns/retry"
+	"github.com/stretchr/testify/require"
+)
+
+// handoffConsumer returns a consumer handing every item off, sending the
+// handles to the returned channel.
+func handoffConsumer(items ...interface{}) (*Consumer, chan *Pending) {
+	handles := make(chan *Pending, 100)
+
+	c := NewConsumer(len(items), 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error {
+		p := NewPending()
+		handles <- p
+		return p
+	}
+	for _, v := range items {
+		c.Buffer <- v
+	}
+	c.Close()
+	return c, handles
+}
+
+func TestHandoffDelayedConfirm(t *testing.T) {
+	c, handles := handoffConsumer(1, 2, 3, 4, 5, 6)
+	c.MaxPending = 2
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(context.Background())
+	}()
+
+	// 两个数据在等待确认时,不再取新的数据
+	first, second := <-handles, <-handles
+	select {
+	case <-handles:
+		t.Fatal("handed off more than MaxPending items")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Equal(t, 2, c.Stats().Pending)
+	require.Zero(t, c.Stats().Processed)
+	require.Equal(t, 3, c.Stats().Buffered)
+
+	// 确认后才计为已消费,并空出位置
+	first.Confirm()
+	third := <-handles
+	require.Eventually(t, func() bool { return c.Stats().Processed == 1 }, time.Second, time.Millisecond)
+
+	// 其余的数据延迟确认
+	go func() {
+		for _, p := range []*Pending{second, third} {
+			time.Sleep(10 * time.Millisecond)
+			p.Confirm()
+		}
+		for p := range handles {
+			time.Sleep(10 * time.Millisecond)
+			p.Confirm()
+		}
+	}()
+
+	<-done
+	report, err := c.WaitPending(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Abandoned)
+	require.Equal(t, uint64(6), c.Stats().Processed)
+	require.Zero(t, c.Stats().Failed)
+	require.Zero(t, c.Stats().Pending)
+	close(handles)
+}
+
+func TestHandoffFailRetries(t *testing.T) {
+	c, handles := handoffConsumer("a")
+	c.MaxPending = 1
+	c.SetRetryPolicy(retry.Policy{MaxAttempts: 3})
+
+	var errs []error
+	c.HandleError(func(err error) { errs = append(errs, err) })
+
+	go c.Run(context.Background())
+
+	// 失败的数据按重试策略重新交给 ConsumeFunc
+	sinkErr := errors.New("broker unavailable")
+	(<-handles).Fail(sinkErr)
+	(<-handles).Fail(sinkErr)
+	(<-handles).Confirm()
+
+	_, err := c.WaitPending(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Equal(t, uint64(1), c.Stats().Processed)
+	require.Zero(t, c.Stats().Failed)
+}
+
+func TestHandoffWaitsWithoutMaxPending(t *testing.T) {
+	c, handles := handoffConsumer()
+
+	// 没有 MaxPending 时 Process 等待确认
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Process(context.Background(), "x")
+	}()
+
+	p := <-handles
+	select {
+	case <-errc:
+		t.Fatal("Process returned before the item was settled")
+	case <-time.After(20 * time.Millisecond):
+	}
+	require.Equal(t, 1, c.Stats().Pending)
+
+	sinkErr := errors.New("rejected")
+	p.Fail(sinkErr)
+	require.ErrorIs(t, <-errc, sinkErr)
+	require.Equal(t, uint64(1), c.Stats().Failed)
+}
+
+func TestHandoffFailDuringShutdown(t *testing.T) {
+	c, handles := handoffConsumer(1, 2)
+	c.MaxPending = 2
+
+	out := make(chan result.Result[interface{}], 2)
+	c.SetOut(out)
+	var mu sync.Mutex
+	var errs []error
+	c.HandleError(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+
+	c.Run(context.Background())
+	first, second := <-handles, <-handles
+
+	// 关闭过程中确认或失败的数据照常处理
+	reports := make(chan *PendingReport, 1)
+	go func() {
+		report, err := c.WaitPending(context.Background())
+		require.NoError(t, err)
+		reports <- report
+	}()
+
+	sinkErr := errors.New("delivery failed")
+	time.Sleep(10 * time.Millisecond)
+	first.Fail(sinkErr)
+	time.Sleep(10 * time.Millisecond)
+	second.Confirm()
+
+	report := <-reports
+	require.Equal(t, uint64(2), report.Settled)
+	require.Empty(t, report.Abandoned)
+
+	mu.Lock()
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], sinkErr)
+	mu.Unlock()
+
+	failed := <-out
+	require.Equal(t, 1, failed.Value)
+	require.ErrorIs(t, failed.Err, sinkErr)
+	require.NoError(t, (<-out).Err)
+}
+
+func TestHandoffAbandon(t *testing.T) {
+	c, handles := handoffConsumer(1, 2, 3)
+	c.MaxPending = 3
+	c.SetRetryPolicy(retry.Policy{MaxAttempts: 3})
+
+	var mu sync.Mutex
+	var errs []error
+	c.HandleError(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+
+	c.Run(context.Background())
+	first := <-handles
+	first.Confirm()
+	require.Eventually(t, func() bool { return c.Stats().Processed == 1 }, time.Second, time.Millisecond)
+
+	// 超时后放弃仍在等待的数据,不再重试
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	report, err := c.WaitPending(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ElementsMatch(t, []interface{}{2, 3}, report.Abandoned)
+	require.Equal(t, uint64(2), report.Settled)
+
+	mu.Lock()
+	require.Len(t, errs, 2)
+	for _, err := range errs {
+		require.ErrorIs(t, err, ErrAbandoned)
+	}
+	mu.Unlock()
+
+	require.Equal(t, uint64(3), c.Stats().Processed)
+	require.Equal(t, uint64(2), c.Stats().Failed)
+	require.Zero(t, c.Stats().Pending)
+
+	// 放弃后的确认不再起作用
+	(<-handles).Confirm()
+	require.Equal(t, uint64(2), c.Stats().Failed)
+	require.Len(t, handles, 1)
+}
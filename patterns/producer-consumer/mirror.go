@@ -0,0 +1,177 @@
+package producerconsumer
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorComparison is the outcome of an item processed by both the
+// primary and the shadow consumer.
+type MirrorComparison[T any] struct {
+
+	// Item is the item processed, shared by both consumers.
+	Item T
+
+	// PrimaryErr and ShadowErr are the errors Process returned.
+	PrimaryErr error
+	ShadowErr  error
+
+	// PrimaryLatency and ShadowLatency are how long Process took.
+	PrimaryLatency time.Duration
+	ShadowLatency  time.Duration
+}
+
+// MirrorStats is a snapshot of a Mirror.
+type MirrorStats struct {
+
+	// Sampled counts the items picked for mirroring.
+	Sampled uint64
+
+	// Dropped counts the sampled items dropped because the queue of the
+	// shadow was full.
+	Dropped uint64
+
+	// Compared counts the items the shadow processed.
+	Compared uint64
+
+	// Divergent counts the compared items whose outcomes diverged.
+	Divergent uint64
+}
+
+// Mirror is a MirrorOf interface{} items.
+type Mirror = MirrorOf[interface{}]
+
+// MirrorOf shadows a sample of the items a Consumer processes to another
+// consumer, such as one running a new ConsumeFunc to validate, and
+// compares their outcomes. The shadow never affects the primary: its
+// errors are not returned, and the sampled items wait in a bounded queue,
+// dropped when it is full, so a slow shadow does not slow the primary
+// down. Set it as the Mirror of the primary Consumer, and call Run.
+//
+// Both consumers process the same item, so it must not be modified.
+type MirrorOf[T any] struct {
+
+	// Shadow processes the mirrored items with Process. Its outcomes only
+	// reach Compare and its own ErrHandler and Out.
+	Shadow *ConsumerOf[T]
+
+	// Rate is the fraction of the items mirrored, from 0 to 1.
+	Rate float64
+
+	// Select picks the items mirrored instead of Rate if set.
+	Select func(data T) bool
+
+	// Compare receives the outcome of every compared item and reports
+	// whether it diverged. If nil, outcomes diverge when only one of the
+	// consumers failed. It is called from the goroutines of Run.
+	Compare func(c MirrorComparison[T]) bool
+
+	// queue holds the sampled items for the shadow.
+	queue chan MirrorComparison[T]
+
+	// Counters backing Stats.
+	sampled   atomic.Uint64
+	dropped   atomic.Uint64
+	compared  atomic.Uint64
+	divergent atomic.Uint64
+}
+
+// NewMirror creates a Mirror of interface{} items, like NewMirrorOf.
+func NewMirror(shadow *Consumer, rate float64, capacity int) *Mirror {
+	return NewMirrorOf[interface{}](shadow, rate, capacity)
+}
+
+// NewMirrorOf creates a Mirror sending the fraction rate of the items to
+// shadow, keeping up to capacity of them waiting.
+func NewMirrorOf[T any](shadow *ConsumerOf[T], rate float64, capacity int) *MirrorOf[T] {
+	return &MirrorOf[T]{
+		Shadow: shadow,
+		Rate:   rate,
+		queue:  make(chan MirrorComparison[T], capacity),
+	}
+}
+
+// Run processes the mirrored items with the shadow, using its NumProcs
+// goroutines, and compares their outcomes until ctx is done. It returns
+// the cause of ctx. Items left waiting are not processed.
+func (m *MirrorOf[T]) Run(ctx context.Context) error {
+	procs := m.Shadow.NumProcs
+	if procs < 1 {
+		procs = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < procs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case c := <-m.queue:
+					m.compare(ctx, c)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+// Stats returns a snapshot of the mirror. It reads atomics, so it can be
+// called at any time.
+func (m *MirrorOf[T]) Stats() MirrorStats {
+	return MirrorStats{
+		Sampled:   m.sampled.Load(),
+		Dropped:   m.dropped.Load(),
+		Compared:  m.compared.Load(),
+		Divergent: m.divergent.Load(),
+	}
+}
+
+// offer queues data processed by the primary with err in latency, if it
+// is sampled, without waiting.
+func (m *MirrorOf[T]) offer(data T, err error, latency time.Duration) {
+	if !m.sample(data) {
+		return
+	}
+	m.sampled.Add(1)
+
+	select {
+	case m.queue <- MirrorComparison[T]{Item: data, PrimaryErr: err, PrimaryLatency: latency}:
+	default:
+		m.dropped.Add(1)
+	}
+}
+
+// sample reports whether data is mirrored.
+func (m *MirrorOf[T]) sample(data T) bool {
+	if m.Select != nil {
+		return m.Select(data)
+	}
+	return m.Rate >= 1 || rand.Float64() < m.Rate
+}
+
+// compare processes c.Item with the shadow and compares the outcomes.
+func (m *MirrorOf[T]) compare(ctx context.Context, c MirrorComparison[T]) {
+	start := time.Now()
+	c.ShadowErr = m.Shadow.Process(ctx, c.Item)
+	c.ShadowLatency = time.Since(start)
+
+	var diverged bool
+	if m.Compare != nil {
+		diverged = m.Compare(c)
+	} else {
+		diverged = (c.PrimaryErr == nil) != (c.ShadowErr == nil)
+	}
+
+	m.compared.Add(1)
+	if diverged {
+		m.divergent.Add(1)
+	}
+}
@@ -0,0 +1,126 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	const n = 200
+
+	// 影子消费者很慢,并且对偶数返回错误
+	shadow := NewConsumer(0, 2)
+	shadow.Notify(func(string) {})
+	shadow.ConsumeFunc = func(data interface{}) error {
+		time.Sleep(5 * time.Millisecond)
+		if data.(int)%2 == 0 {
+			return errors.New("shadow failed")
+		}
+		return nil
+	}
+
+	var mu sync.Mutex
+	var diverged []MirrorComparison[interface{}]
+	m := NewMirror(shadow, 1, 4)
+	m.Compare = func(c MirrorComparison[interface{}]) bool {
+		if (c.PrimaryErr == nil) == (c.ShadowErr == nil) {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		diverged = append(diverged, c)
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	c := NewConsumer(n, 4)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error { return nil }
+	c.SetMirror(m)
+	for i := 1; i <= n; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+
+	// 影子消费者不拖慢主消费者
+	start := time.Now()
+	require.NoError(t, c.Run(context.Background()))
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	require.Equal(t, uint64(n), c.Stats().Processed)
+	require.Zero(t, c.Stats().Failed)
+
+	// 队列满时丢弃,其余的都被比较
+	require.Eventually(t, func() bool {
+		s := m.Stats()
+		return s.Compared+s.Dropped == n
+	}, time.Second, time.Millisecond)
+	s := m.Stats()
+	require.Equal(t, uint64(n), s.Sampled)
+	require.NotZero(t, s.Dropped)
+	require.NotZero(t, s.Divergent)
+
+	// 比较函数收到主消费者和影子消费者的结果
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, diverged, int(s.Divergent))
+	for _, d := range diverged {
+		require.Zero(t, d.Item.(int)%2)
+		require.NoError(t, d.PrimaryErr)
+		require.Error(t, d.ShadowErr)
+		require.GreaterOrEqual(t, d.ShadowLatency, 5*time.Millisecond)
+	}
+}
+
+func TestMirrorSample(t *testing.T) {
+	shadow := NewConsumer(0, 1)
+	shadow.Notify(func(string) {})
+	shadow.ConsumeFunc = func(interface{}) error { return nil }
+
+	// Select 优先于 Rate
+	m := NewMirror(shadow, 1, 100)
+	m.Select = func(data interface{}) bool { return data.(int) < 10 }
+	for i := 0; i < 100; i++ {
+		m.offer(i, nil, 0)
+	}
+	require.Equal(t, MirrorStats{Sampled: 10}, m.Stats())
+
+	// 按比例抽样
+	m = NewMirror(shadow, 0.1, 10000)
+	for i := 0; i < 10000; i++ {
+		m.offer(i, nil, 0)
+	}
+	require.InDelta(t, 1000, m.Stats().Sampled, 200)
+
+	// 比例为 0 时不抽样
+	m = NewMirror(shadow, 0, 10)
+	m.offer(1, nil, 0)
+	require.Zero(t, m.Stats().Sampled)
+}
+
+func TestMirrorDefaultCompare(t *testing.T) {
+	shadow := NewConsumer(0, 1)
+	shadow.Notify(func(string) {})
+	shadow.ConsumeFunc = func(data interface{}) error {
+		if data == "bad" {
+			return errors.New("bad")
+		}
+		return nil
+	}
+	m := NewMirror(shadow, 1, 10)
+
+	// 只有一方失败时视为不一致
+	ctx := context.Background()
+	m.compare(ctx, MirrorComparison[interface{}]{Item: "good"})
+	m.compare(ctx, MirrorComparison[interface{}]{Item: "bad"})
+	m.compare(ctx, MirrorComparison[interface{}]{Item: "good", PrimaryErr: errors.New("primary")})
+	m.compare(ctx, MirrorComparison[interface{}]{Item: "bad", PrimaryErr: errors.New("primary")})
+	require.Equal(t, MirrorStats{Compared: 4, Divergent: 2}, m.Stats())
+}
@@ -0,0 +1,93 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+)
+
+// ordering numbers the items of an Ordered Consumer as they are read, and
+// lets them finish in that order.
+type ordering struct {
+
+	// reading is held while reading and numbering items, so numbers
+	// follow the reads.
+	reading sync.Mutex
+	next    uint64
+
+	mu sync.Mutex
+
+	// turn is the number of the next item to finish.
+	turn uint64
+
+	// changed is closed, and replaced, whenever turn moves.
+	changed chan struct{}
+}
+
+// take reads the next items into held like runProc does, up to
+// MaxBatchDrain, numbering them from the returned number on if Ordered
+// and not partitioned. The third return value is false once read is.
+func (c *ConsumerOf[T]) take(ctx context.Context, held []T) ([]T, uint64, bool) {
+	ordered := c.Ordered && partitionOf[T](ctx) == nil
+	if ordered {
+		c.order.reading.Lock()
+		defer c.order.reading.Unlock()
+	}
+
+	data, ok := c.read(ctx)
+	if !ok {
+		return held, 0, false
+	}
+	tryRead := c.tryRead
+	if in := partitionOf[T](ctx); in != nil {
+		tryRead = tryReadPartition(in)
+	}
+	held = drainInto(append(held[:0], data), c.Tuning.MaxBatchDrain, tryRead)
+
+	seq := c.order.next
+	if ordered {
+		c.order.next += uint64(len(held))
+	}
+	return held, seq, true
+}
+
+// wait waits until the items numbered before seq finished.
+func (o *ordering) wait(seq uint64) {
+	for {
+		o.mu.Lock()
+		if o.turn == seq {
+			o.mu.Unlock()
+			return
+		}
+		if o.changed == nil {
+			o.changed = make(chan struct{})
+		}
+		changed := o.changed
+		o.mu.Unlock()
+
+		<-changed
+	}
+}
+
+// done lets the next item finish.
+func (o *ordering) done() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.turn++
+	if o.changed != nil {
+		close(o.changed)
+		o.changed = nil
+	}
+}
+
+// inTurn runs fn once the items read before item finished, if item is
+// ordered, then lets the next one finish.
+func (o *ordering) inTurn(item *handoffItem, fn func()) {
+	if !item.ordered {
+		fn()
+		return
+	}
+	o.wait(item.seq)
+	defer o.done()
+	fn()
+}
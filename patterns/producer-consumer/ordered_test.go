@@ -0,0 +1,89 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrdered(t *testing.T) {
+	const n = 1000
+
+	// 8 个 goroutine 并发处理,每个数据随机延迟,7 的倍数失败
+	var running, peak atomic.Int64
+	c := NewConsumer(n, 8)
+	c.Ordered = true
+	c.Tuning.MaxBatchDrain = 4
+	c.ConsumeFunc = func(data interface{}) error {
+		if r := running.Add(1); r > peak.Load() {
+			peak.Store(r)
+		}
+		defer running.Add(-1)
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+		if data.(int)%7 == 0 {
+			return errors.New("failed")
+		}
+		return nil
+	}
+	var done []interface{}
+	c.SetEventHandler(func(e Event) {
+		if e.Kind == ItemConsumed {
+			done = append(done, e.Payload)
+		}
+	})
+	var failed []interface{}
+	c.SetItemErrHandler(func(data interface{}, err error) {
+		failed = append(failed, data)
+	})
+
+	for i := 0; i < n; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+
+	// 完成顺序和读取顺序一致
+	require.Len(t, done, n)
+	for i, data := range done {
+		require.Equal(t, i, data)
+	}
+	for i := 1; i < len(failed); i++ {
+		require.Less(t, failed[i-1].(int), failed[i].(int))
+	}
+	require.Greater(t, peak.Load(), int64(1))
+}
+
+func TestOrderedSkipped(t *testing.T) {
+
+	// 重复的数据被跳过,不阻塞后面的数据
+	c := NewConsumer(10, 4)
+	c.Ordered = true
+	c.SetDedup(NewDedup(func(item interface{}) string { return fmt.Sprint(item) }, time.Minute, 100))
+	c.ConsumeFunc = func(interface{}) error { return nil }
+	var done []interface{}
+	c.SetEventHandler(func(e Event) {
+		if e.Kind == ItemConsumed {
+			done = append(done, e.Payload)
+		}
+	})
+	for _, v := range []interface{}{1, 1, 2, 2, 3} {
+		c.Buffer <- v
+	}
+	c.Close()
+
+	finished := make(chan error)
+	go func() { finished <- c.Run(context.Background()) }()
+	select {
+	case err := <-finished:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run blocked on a skipped item")
+	}
+	require.Equal(t, []interface{}{1, 2, 3}, done)
+}
@@ -0,0 +1,78 @@
+package producerconsumer
+
+import (
+	"context"
+	"fmt"
+)
+
+// OverflowPolicy decides what a Producer does with an item when the
+// channel it writes to is full: Buffer for Run, out for Inject.
+type OverflowPolicy int
+
+const (
+	// OverflowBackpressure makes Run back off until Buffer has room, and
+	// Inject drop the item. It is the default.
+	OverflowBackpressure OverflowPolicy = iota
+
+	// OverflowBlock waits for room, or for the context to be done.
+	OverflowBlock
+
+	// OverflowDropNewest drops the item being written.
+	OverflowDropNewest
+
+	// OverflowDropOldest takes the oldest item out of the channel and
+	// drops it to make room. An unbuffered channel has nothing to take, so
+	// the item being written is dropped instead.
+	OverflowDropOldest
+)
+
+// String returns the name of the policy.
+func (o OverflowPolicy) String() string {
+	switch o {
+	case OverflowBackpressure:
+		return "backpressure"
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(o))
+	}
+}
+
+// overflow writes data to out following the Overflow policy, counting the
+// items dropped. OverflowBackpressure drops data like OverflowDropNewest.
+// It returns false if data was not written, because it was dropped or ctx
+// is done.
+func (p *ProducerOf[T]) overflow(ctx context.Context, out chan T, data T) bool {
+	switch p.Overflow {
+	case OverflowBlock:
+		select {
+		case out <- data:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+
+	case OverflowDropOldest:
+		for cap(out) > 0 {
+			if p.tryWrite(out, data) {
+				return true
+			}
+			select {
+			case <-out:
+				p.dropped.Add(1)
+			default:
+				// Drained by a reader meanwhile
+			}
+		}
+	}
+
+	if p.tryWrite(out, data) {
+		return true
+	}
+	p.dropped.Add(1)
+	return false
+}
@@ -0,0 +1,169 @@
+package producerconsumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// full returns a channel of the given capacity filled with items.
+func full(capacity int, items ...interface{}) chan interface{} {
+	ch := make(chan interface{}, capacity)
+	for _, v := range items {
+		ch <- v
+	}
+	return ch
+}
+
+// drain returns the items left in ch.
+func drain(ch chan interface{}) []interface{} {
+	var items []interface{}
+	for len(ch) > 0 {
+		items = append(items, <-ch)
+	}
+	return items
+}
+
+// counting returns a producer of the items 1 to n writing to a full buffer
+// of the given capacity.
+func counting(n, capacity int, overflow OverflowPolicy) *Producer {
+	p := NewProducer(capacity, 1)
+	p.Notify(func(string) {})
+	p.Overflow = overflow
+	next := 0
+	p.ProduceFunc = func() (interface{}, error) {
+		if next == n {
+			return nil, nil
+		}
+		next++
+		return next, nil
+	}
+	return p
+}
+
+func TestOverflowInjectDrop(t *testing.T) {
+	for _, overflow := range []OverflowPolicy{OverflowBackpressure, OverflowDropNewest} {
+		t.Run(overflow.String(), func(t *testing.T) {
+			p := NewProducer(3, 1)
+			p.Notify(func(string) {})
+			p.Overflow = overflow
+			p.Buffer <- 1
+			p.Buffer <- 2
+			p.Buffer <- 3
+			p.Close()
+
+			// out 已满,新数据被丢弃,原有数据不变
+			out := full(2, "a", "b")
+			p.Inject(context.Background(), out)
+			require.Equal(t, []interface{}{"a", "b"}, drain(out))
+			require.Equal(t, uint64(3), p.Stats().Dropped)
+		})
+	}
+}
+
+func TestOverflowInjectDropOldest(t *testing.T) {
+	p := NewProducer(3, 1)
+	p.Notify(func(string) {})
+	p.Overflow = OverflowDropOldest
+	p.Buffer <- 1
+	p.Buffer <- 2
+	p.Buffer <- 3
+	p.Close()
+
+	// 最早的数据被挤出,保留最新的
+	out := full(2, "a", "b")
+	p.Inject(context.Background(), out)
+	require.Equal(t, []interface{}{2, 3}, drain(out))
+	require.Equal(t, uint64(3), p.Stats().Dropped)
+}
+
+func TestOverflowInjectBlock(t *testing.T) {
+	p := NewProducer(3, 1)
+	p.Notify(func(string) {})
+	p.Overflow = OverflowBlock
+	p.Buffer <- 1
+	p.Buffer <- 2
+	p.Close()
+
+	out := full(1, "a")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Inject(context.Background(), out)
+	}()
+
+	// 等待 out 有空位,不丢弃数据
+	for _, want := range []interface{}{"a", 1, 2} {
+		time.Sleep(10 * time.Millisecond)
+		require.Equal(t, want, <-out)
+	}
+	<-done
+	require.Zero(t, p.Stats().Dropped)
+
+	// ctx 结束时停止等待
+	p = NewProducer(1, 1)
+	p.Notify(func(string) {})
+	p.Overflow = OverflowBlock
+	p.Buffer <- 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	out = full(1, "a")
+	p.Inject(ctx, out)
+	require.Equal(t, []interface{}{"a"}, drain(out))
+}
+
+func TestOverflowRun(t *testing.T) {
+	tests := []struct {
+		overflow OverflowPolicy
+		buffered []interface{}
+		produced uint64
+		dropped  uint64
+	}{
+		{OverflowDropNewest, []interface{}{1, 2}, 2, 3},
+		{OverflowDropOldest, []interface{}{4, 5}, 5, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overflow.String(), func(t *testing.T) {
+			p := counting(5, 2, tt.overflow)
+
+			// Buffer 满时不退避,按策略丢弃
+			start := time.Now()
+			p.Run(context.Background())
+			require.Less(t, time.Since(start), 50*time.Millisecond)
+
+			require.Equal(t, tt.buffered, drain(p.Buffer))
+			require.Equal(t, tt.produced, p.Stats().Produced)
+			require.Equal(t, tt.dropped, p.Stats().Dropped)
+		})
+	}
+}
+
+func TestOverflowRunBlock(t *testing.T) {
+	p := counting(5, 2, OverflowBlock)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(context.Background())
+	}()
+
+	// 消费者跟上后生产者继续,不丢弃数据
+	for want := 1; want <= 5; want++ {
+		time.Sleep(5 * time.Millisecond)
+		require.Equal(t, want, <-p.Buffer)
+	}
+	<-done
+	require.Equal(t, uint64(5), p.Stats().Produced)
+	require.Zero(t, p.Stats().Dropped)
+
+	// ctx 结束时停止等待
+	p = counting(5, 2, OverflowBlock)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p.Run(ctx)
+	require.Equal(t, []interface{}{1, 2}, drain(p.Buffer))
+	require.Zero(t, p.Stats().Dropped)
+}
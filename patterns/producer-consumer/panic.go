@@ -0,0 +1,51 @@
+package producerconsumer
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// PanicError is the error of a call to ProduceFunc, ConsumeFunc,
+// ConsumeCtxFunc or ConsumeBatchFunc that panicked.
+type PanicError struct {
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns Value if it is an error, such as with panic(err).
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// catch calls fn, turning a panic into a *PanicError, counted in panics
+// and passed to handler if set.
+func catch(handler func(recovered interface{}, stack []byte), panics *atomic.Uint64, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			e := &PanicError{Value: v, Stack: debug.Stack()}
+			panics.Add(1)
+			if handler != nil {
+				handler(e.Value, e.Stack)
+			}
+			err = e
+		}
+	}()
+	return fn()
+}
+
+// panicked reports whether err comes from a panic.
+func panicked(err error) bool {
+	var e *PanicError
+	return errors.As(err, &e)
+}
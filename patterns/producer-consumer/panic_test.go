@@ -0,0 +1,199 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerPanic(t *testing.T) {
+	c := NewConsumer(100, 4)
+	c.Notify(func(string) {})
+	var mu sync.Mutex
+	var recovered []interface{}
+	c.SetPanicHandler(func(v interface{}, stack []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		recovered = append(recovered, v)
+		require.Contains(t, string(stack), "panic")
+	})
+	var errs atomic.Int64
+	c.HandleError(func(error) { errs.Add(1) })
+
+	// 第 1 个数据让一个 goroutine panic,其余 goroutine 继续处理
+	var processed atomic.Int64
+	c.ConsumeFunc = func(data interface{}) error {
+		if data.(int) == 1 {
+			panic("boom")
+		}
+		processed.Add(1)
+		return nil
+	}
+	for i := 1; i <= 50; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+
+	require.NoError(t, c.Run(context.Background()))
+	require.Equal(t, int64(49), processed.Load())
+	require.Equal(t, []interface{}{"boom"}, recovered)
+
+	// 设置了 PanicHandler 时不再交给 ErrHandler,数据计为失败
+	require.Zero(t, errs.Load())
+	stats := c.Stats()
+	require.Equal(t, uint64(1), stats.Panics)
+	require.Equal(t, uint64(50), stats.Processed)
+	require.Equal(t, uint64(1), stats.Failed)
+}
+
+func TestConsumerPanicExit(t *testing.T) {
+	c := NewConsumer(100, 3)
+	c.Notify(func(string) {})
+	c.SetPanicHandler(func(interface{}, []byte) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		if data.(int) < 0 {
+			panic("boom")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	require.Eventually(t, func() bool { return c.Stats().Workers == 3 }, time.Second, time.Millisecond)
+
+	// 没有设置 RestartOnPanic 时,panic 的 goroutine 退出
+	c.Buffer <- -1
+	require.Eventually(t, func() bool { return c.Stats().Workers == 2 }, time.Second, time.Millisecond)
+
+	// 其余 goroutine 继续处理
+	for i := 0; i < 10; i++ {
+		c.Buffer <- i
+	}
+	require.Eventually(t, func() bool { return c.Stats().Processed == 11 }, time.Second, time.Millisecond)
+	require.Equal(t, 2, c.Stats().Workers)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestConsumerRestartOnPanic(t *testing.T) {
+	c := NewConsumer(100, 1)
+	c.Notify(func(string) {})
+	c.RestartOnPanic = true
+
+	// 没有 PanicHandler 时 panic 包装成 *PanicError 交给 ErrHandler
+	var mu sync.Mutex
+	var errs []error
+	c.HandleError(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+	errBoom := errors.New("boom")
+	c.ConsumeFunc = func(data interface{}) error {
+		if data.(int)%10 == 0 {
+			panic(errBoom)
+		}
+		return nil
+	}
+	for i := 1; i <= 30; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+
+	// 唯一的 goroutine 重新开始,处理完全部数据
+	require.NoError(t, c.Run(context.Background()))
+	require.Equal(t, uint64(30), c.Stats().Processed)
+	require.Equal(t, uint64(3), c.Stats().Panics)
+	require.Len(t, errs, 3)
+	var pe *PanicError
+	require.ErrorAs(t, errs[0], &pe)
+	require.Equal(t, errBoom, pe.Value)
+	require.NotEmpty(t, pe.Stack)
+	require.ErrorIs(t, errs[0], errBoom)
+	require.EqualError(t, errs[0], "panic: boom")
+}
+
+func TestConsumerBatchPanic(t *testing.T) {
+	c := NewConsumer(100, 1)
+	c.Notify(func(string) {})
+	c.BatchSize = 5
+	var errs []error
+	c.HandleError(func(err error) { errs = append(errs, err) })
+	var batches int
+	c.ConsumeBatchFunc = func(items []interface{}) error {
+		batches++
+		panic("boom")
+	}
+	for i := 1; i <= 20; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+
+	// 一批 panic 后 goroutine 退出,不再取数据
+	require.NoError(t, c.Run(context.Background()))
+	require.Equal(t, 1, batches)
+	require.Equal(t, uint64(5), c.Stats().Failed)
+	require.Len(t, errs, 1)
+	var pe *PanicError
+	require.ErrorAs(t, errs[0], &pe)
+	require.Len(t, c.Buffer, 15)
+}
+
+func TestProducerPanic(t *testing.T) {
+	p := NewProducer(100, 2)
+	p.Notify(func(string) {})
+	var errs atomic.Int64
+	p.HandleError(func(err error) {
+		var pe *PanicError
+		if errors.As(err, &pe) && pe.Value == "boom" {
+			errs.Add(1)
+		}
+	})
+
+	// 没有 RestartOnPanic 时 panic 的 goroutine 退出,另一个继续生产
+	var calls atomic.Int64
+	p.ProduceFunc = func() (interface{}, error) {
+		n := calls.Add(1)
+		if n == 1 {
+			panic("boom")
+		}
+		if n > 21 {
+			return nil, nil
+		}
+		return int(n), nil
+	}
+	require.NoError(t, p.Run(context.Background()))
+	require.Equal(t, uint64(20), p.Stats().Produced)
+	require.Equal(t, uint64(1), p.Stats().Panics)
+	require.Equal(t, int64(1), errs.Load())
+
+	// RestartOnPanic 时继续生产,panic 交给 PanicHandler
+	var recovered atomic.Int64
+	p = NewProducer(100, 1)
+	p.Notify(func(string) {})
+	p.RestartOnPanic = true
+	p.SetPanicHandler(func(interface{}, []byte) { recovered.Add(1) })
+	p.HandleError(func(error) { t.Error("ErrHandler called with a PanicHandler set") })
+	calls.Store(0)
+	p.ProduceFunc = func() (interface{}, error) {
+		n := calls.Add(1)
+		if n%5 == 0 {
+			panic("boom")
+		}
+		if n > 20 {
+			return nil, nil
+		}
+		return int(n), nil
+	}
+	require.NoError(t, p.Run(context.Background()))
+	require.Equal(t, uint64(16), p.Stats().Produced)
+	require.Equal(t, int64(4), recovered.Load())
+}
@@ -0,0 +1,114 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/signal"
+)
+
+// partitionKey is the context key of the channel a goroutine of a
+// partitioned Run reads instead of Buffer or Queue.
+type partitionKey struct{}
+
+// partitionOf returns the channel the goroutine running with ctx reads,
+// or nil if Run is not partitioned.
+func partitionOf[T any](ctx context.Context) chan T {
+	in, _ := ctx.Value(partitionKey{}).(chan T)
+	return in
+}
+
+// readPartition waits for the next item of in. The second return value is
+// false once in is closed and drained, or ctx is done.
+func readPartition[T any](ctx context.Context, in chan T) (T, bool) {
+	select {
+	case data, ok := <-in:
+		return data, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// tryReadPartition takes the next item of in without waiting.
+func tryReadPartition[T any](in chan T) func() (T, bool) {
+	return func() (T, bool) {
+		select {
+		case data, ok := <-in:
+			return data, ok
+		default:
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+// partition runs NumProcs processing goroutines, each reading a channel of
+// its own, and routes the items read from Buffer or Queue to the goroutine
+// of partition PartitionFunc(item) modulo NumProcs. Once reading stops, the
+// goroutines finish their partitions, and the items left in them when ctx
+// is done or on Stop wait for Drain or the next Run like requeued ones.
+func (c *ConsumerOf[T]) partition(ctx context.Context) {
+	n := c.NumProcs
+	if n < 1 {
+		n = 1
+	}
+
+	// Split the capacity of the input among the partitions
+	size := bufferCap(c.Buffer, c.Queue) / n
+	if size < 1 {
+		size = 1
+	}
+
+	var wg sync.WaitGroup
+	parts := make([]chan T, n)
+	for i := range parts {
+		parts[i] = make(chan T, size)
+		wg.Add(1)
+		c.emit(ConsumerStarted, nil)
+		go c.runProc(context.WithValue(ctx, partitionKey{}, parts[i]), &wg)
+	}
+
+	// Stop ends the reads, like in runProc
+	readCtx, cancel := signal.Context(ctx, &c.stopped)
+	defer cancel()
+
+	var left []T
+	for {
+		data, ok := c.read(readCtx)
+		if !ok {
+			break
+		}
+
+		// Route by the item a Producer with an ItemTTL wrapped
+		item := data
+		if v, ok := Unwrap(any(data)).(T); ok {
+			item = v
+		}
+		i := c.PartitionFunc(item) % n
+		if i < 0 {
+			i += n
+		}
+
+		select {
+		case parts[i] <- data:
+		case <-readCtx.Done():
+			left = append(left, data)
+		}
+	}
+
+	for _, in := range parts {
+		close(in)
+	}
+	wg.Wait()
+
+	// Keep the items no goroutine took
+	for _, in := range parts {
+		for data := range in {
+			left = append(left, data)
+		}
+	}
+	for _, data := range left {
+		c.redelivery.push(redelivery[T]{data: data})
+	}
+}
@@ -0,0 +1,115 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// keyed is an event of a customer, numbered per customer.
+type keyed struct {
+	key int
+	seq int
+}
+
+func TestConsumerPartition(t *testing.T) {
+	c := NewConsumer(100, 3)
+	c.Notify(func(string) {})
+	c.SetPartitionFunc(func(data interface{}) int {
+		return data.(keyed).key
+	})
+
+	// 记录每个 key 的处理顺序,以及同时处理的数量
+	var mu sync.Mutex
+	seen := map[int][]int{}
+	var active, maxActive atomic.Int64
+	var perKey [3]atomic.Int64
+	c.ConsumeFunc = func(data interface{}) error {
+		e := data.(keyed)
+		if perKey[e.key].Add(1) > 1 {
+			t.Errorf("key %d processed concurrently", e.key)
+		}
+		n := active.Add(1)
+		for {
+			m := maxActive.Load()
+			if n <= m || maxActive.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		active.Add(-1)
+		perKey[e.key].Add(-1)
+
+		mu.Lock()
+		defer mu.Unlock()
+		seen[e.key] = append(seen[e.key], e.seq)
+		return nil
+	}
+
+	// 三个 key 的事件交替写入
+	for seq := 0; seq < 20; seq++ {
+		for key := 0; key < 3; key++ {
+			c.Buffer <- keyed{key: key, seq: seq}
+		}
+	}
+	c.Close()
+
+	start := time.Now()
+	require.NoError(t, c.Run(context.Background()))
+	elapsed := time.Since(start)
+
+	// 每个 key 按写入顺序处理
+	for key := 0; key < 3; key++ {
+		require.Len(t, seen[key], 20)
+		for i, seq := range seen[key] {
+			require.Equal(t, i, seq)
+		}
+	}
+
+	// 三个 goroutine 同时处理,比逐个处理快
+	require.Equal(t, int64(3), maxActive.Load())
+	require.Less(t, elapsed, 60*2*time.Millisecond)
+	require.Equal(t, uint64(60), c.Stats().Processed)
+}
+
+func TestConsumerPartitionLeft(t *testing.T) {
+	c := NewConsumer(40, 2)
+	c.Notify(func(string) {})
+	c.PartitionFunc = func(data interface{}) int {
+		return -data.(int) // 负数也按模分区
+	}
+	var mu sync.Mutex
+	seen := map[int]int{}
+	c.ConsumeFunc = func(data interface{}) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		seen[data.(int)]++
+		return nil
+	}
+	for i := 0; i < 40; i++ {
+		c.Buffer <- i
+	}
+
+	// ctx 结束时分区中剩下的数据留在消费者中
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	require.ErrorIs(t, c.Run(ctx), context.Canceled)
+	require.Equal(t, 40, int(c.Stats().Processed)+c.Stats().Buffered)
+
+	// Drain 处理剩下的数据,每个数据只处理一次
+	n, err := c.Drain(context.Background())
+	require.NoError(t, err)
+	require.Greater(t, n, 0)
+	require.Len(t, seen, 40)
+	for i, count := range seen {
+		require.Equal(t, 1, count, "item %d", i)
+	}
+}
@@ -0,0 +1,65 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+)
+
+// pause holds the goroutines of a Producer or Consumer back while paused.
+// The zero value is running.
+type pause struct {
+	mu sync.Mutex
+
+	// resumed is closed by Resume, and nil while running.
+	resumed chan struct{}
+}
+
+// pause pauses p, and reports whether it was running.
+func (p *pause) pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resumed != nil {
+		return false
+	}
+	p.resumed = make(chan struct{})
+	return true
+}
+
+// resume resumes p, and reports whether it was paused.
+func (p *pause) resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resumed == nil {
+		return false
+	}
+	close(p.resumed)
+	p.resumed = nil
+	return true
+}
+
+// paused reports whether p is paused.
+func (p *pause) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.resumed != nil
+}
+
+// wait waits while p is paused. It returns false if ctx is done first.
+func (p *pause) wait(ctx context.Context) bool {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,131 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerPause(t *testing.T) {
+	var consumed atomic.Int64
+	var events []EventKind
+	c := NewConsumer(100, 4)
+	c.SetEventHandler(func(e Event) {
+		if e.Kind == ConsumerPaused || e.Kind == ConsumerResumed {
+			events = append(events, e.Kind)
+		}
+	})
+	c.ConsumeFunc = func(interface{}) error {
+		consumed.Add(1)
+		return nil
+	}
+	for i := 0; i < 10; i++ {
+		c.Buffer <- i
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	require.Eventually(t, func() bool { return consumed.Load() == 10 }, time.Second, time.Millisecond)
+
+	// 暂停后不再处理,数据留在缓冲中
+	c.Pause()
+	c.Pause()
+	require.True(t, c.Paused())
+	for i := 0; i < 10; i++ {
+		c.Buffer <- i
+	}
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(10), consumed.Load())
+
+	// 正在等待的 goroutine 最多各拿走一个
+	require.GreaterOrEqual(t, len(c.Buffer), 10-c.NumProcs)
+
+	// 恢复后继续处理
+	c.Resume()
+	c.Resume()
+	require.False(t, c.Paused())
+	require.Eventually(t, func() bool { return consumed.Load() == 20 }, time.Second, time.Millisecond)
+	require.Equal(t, []EventKind{ConsumerPaused, ConsumerResumed}, events)
+
+	// 暂停时 ctx 取消,立即返回
+	c.Pause()
+	cancel()
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return while paused")
+	}
+}
+
+func TestConsumerPauseBatch(t *testing.T) {
+
+	// 未满的一批等待恢复
+	var batches [][]interface{}
+	c := NewConsumer(10, 1)
+	c.BatchSize = 3
+	c.ConsumeBatchFunc = func(items []interface{}) error {
+		batches = append(batches, items)
+		return nil
+	}
+	c.Pause()
+	c.Buffer <- 1
+	c.Buffer <- 2
+	c.Close()
+	done := make(chan error)
+	go func() { done <- c.Run(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	require.Empty(t, batches)
+
+	c.Resume()
+	require.NoError(t, <-done)
+	require.Equal(t, [][]interface{}{{1, 2}}, batches)
+}
+
+func TestProducerPause(t *testing.T) {
+	var produced atomic.Int64
+	var events []EventKind
+	p := NewProducer(1000, 4)
+	p.SetEventHandler(func(e Event) {
+		if e.Kind == ProducerPaused || e.Kind == ProducerResumed {
+			events = append(events, e.Kind)
+		}
+	})
+	p.ProduceFunc = func() (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return produced.Add(1), nil
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	require.Eventually(t, func() bool { return produced.Load() >= 10 }, time.Second, time.Millisecond)
+
+	// 暂停后最多完成手上的数据,不再调用生产函数
+	p.Pause()
+	require.True(t, p.Paused())
+	time.Sleep(10 * time.Millisecond)
+	n := produced.Load()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, n, produced.Load())
+	require.Len(t, p.Buffer, int(n))
+
+	// 恢复后继续生产
+	p.Resume()
+	require.False(t, p.Paused())
+	require.Eventually(t, func() bool { return produced.Load() >= n+10 }, time.Second, time.Millisecond)
+	require.Equal(t, []EventKind{ProducerPaused, ProducerResumed}, events)
+
+	// 暂停时 Stop,立即返回
+	p.Pause()
+	p.Stop(nil)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return while paused")
+	}
+}
@@ -4,18 +4,43 @@ package producerconsumer
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/signal"
 )
 
-// Producer generates data and writes to a buffered channel.
+// ErrDone is returned by ProduceFunc to stop producing, such as when T
+// has no nil value to return instead.
+var ErrDone = errors.New("no more data")
+
+// ErrStopProduce is returned by ProduceFunc to stop all the goroutines of
+// Run, not only the one calling it. Run returns nil once they did, or the
+// error itself if ProduceFunc wrapped it, such as with
+// fmt.Errorf("reading input: %w", ErrStopProduce), to report a failure.
+var ErrStopProduce = errors.New("stop producing")
+
+// stopProduceKey is the context key of the function a goroutine of Run
+// calls to stop the others.
+type stopProduceKey struct{}
+
+// Producer is a ProducerOf any items, which ProduceFunc returns as
+// interface{}.
+type Producer = ProducerOf[interface{}]
+
+// ProducerOf generates data of type T and writes to a buffered channel.
 // It controls a number of goroutines that invoke the custom ProduceFunc
 // to generate data and handle errors.
-type Producer struct {
+type ProducerOf[T any] struct {
 
 	// Buffer is the buffered channel for holding produced data before
 	// it is consumed.
-	Buffer chan interface{}
+	Buffer chan T
 
 	// NumProcs controls the number of goroutines that invoke ProduceFunc
 	// to generate data concurrently.
@@ -23,16 +48,105 @@ type Producer struct {
 
 	// ProduceFunc is the custom data generation function provided by
 	// clients. It should return generated data and any error encountered.
-	ProduceFunc func() (interface{}, error)
+	// Returning a nil item or ErrDone stops the goroutine calling it,
+	// and ErrStopProduce all of them.
+	ProduceFunc func() (T, error)
 
 	// ErrHandler handles any errors returned by ProduceFunc.
 	// If not set, errors will be ignored.
 	ErrHandler func(error)
 
+	// ItemErrHandler, if set, receives the same errors as ErrHandler
+	// together with the item ProduceFunc returned with the error, or the
+	// zero T for errors of Limiter. Both are called if both are set,
+	// ErrHandler first.
+	ItemErrHandler func(data T, err error)
+
+	// PanicHandler, if set, receives the value ProduceFunc panicked with
+	// and the stack. The panic is recovered either way, and goes to
+	// ErrHandler as a *PanicError if PanicHandler is not set.
+	PanicHandler func(recovered interface{}, stack []byte)
+
+	// RestartOnPanic keeps a goroutine of Run producing after ProduceFunc
+	// panicked. Otherwise the goroutine returns, and the others go on.
+	RestartOnPanic bool
+
 	// Notifier sends notifications about the producer lifecycle,
 	// e.g. when data generation starts and finishes.
 	// This can be used to add monitoring and logging.
 	Notifier func(string)
+
+	// EventHandler receives the lifecycle events if set. Notifier keeps
+	// receiving the names it did before events were typed.
+	EventHandler EventHandler
+
+	// Queue is written to instead of Buffer if set. Its policy decides
+	// what happens when it is full; errors from it other than ErrClosed
+	// go to ErrHandler.
+	Queue QueueOf[T]
+
+	// ItemTTL, if set, is how long an item may wait in Buffer or Queue.
+	// Items are stamped when written and checked when delivered, by
+	// Inject or the Consumer taking them; older ones are dropped instead.
+	// Read a Buffer with a TTL only through those, as it holds the
+	// stamped items. Stamping needs interface{} items: Run of a
+	// ProducerOf a concrete type returns ErrItemTTLUnsupported instead.
+	ItemTTL time.Duration
+
+	// OnExpired receives the items dropped because they outlived ItemTTL.
+	OnExpired func(data T)
+
+	// Overflow decides what Run does when Buffer is full, and Inject when
+	// out is full. The default, OverflowBackpressure, backs Run off and
+	// makes Inject drop the item.
+	Overflow OverflowPolicy
+
+	// Backpressure decides how Run backs off with OverflowBackpressure,
+	// before trying to write the same item again. If nil,
+	// ExponentialBackpressure waits from 100ms, doubling up to 1s.
+	Backpressure BackpressureStrategy
+
+	// Limiter caps how fast items are produced if set: each goroutine
+	// waits for it before calling ProduceFunc. A token bucket or a leaky
+	// bucket of the rate-limiting packages fits. An error from it other
+	// than the context's goes to ErrHandler and stops the goroutine.
+	Limiter ratelimit.Limiter
+
+	// Autoscale grows and shrinks the goroutines of Run with the
+	// occupancy of Buffer or Queue if set, starting from NumProcs: more
+	// while it is low, fewer while it is high.
+	Autoscale *Autoscale
+
+	// Throttle makes Run wait between items for a delay growing while the
+	// out channel of Inject stays full, and shrinking once it empties, if
+	// set.
+	Throttle *Throttle
+
+	// Tuning trades latency for throughput in Run and Inject. Run yields
+	// every YieldEvery items written and, under OverflowBackpressure,
+	// spins on a full Buffer before backing off. Inject reads Buffer like
+	// a Consumer does.
+	Tuning Tuning
+
+	// stopped is closed by Stop with the reason Run returns.
+	stopped signal.Done
+
+	// pause holds the goroutines back between Pause and Resume.
+	pause pause
+
+	// workers counts the goroutines of Run running.
+	workers atomic.Int64
+
+	// throttling holds the delay of Throttle.
+	throttling throttling
+
+	// Counters backing Stats.
+	stats        progress
+	failed       atomic.Uint64
+	expired      atomic.Uint64
+	dropped      atomic.Uint64
+	backpressure atomic.Uint64
+	panics       atomic.Uint64
 }
 
 // NewProducer creates a new Producer instance.
@@ -49,13 +163,18 @@ type Producer struct {
 //   p.Start()
 //
 func NewProducer(bufferSize int, numProcs int) *Producer {
+	return NewProducerOf[interface{}](bufferSize, numProcs)
+}
+
+// NewProducerOf creates a Producer of items of type T, like NewProducer.
+func NewProducerOf[T any](bufferSize int, numProcs int) *ProducerOf[T] {
 
 	// Create a buffered channel to hold produced data.
 	// bufferSize determines the max number of items the channel can hold
-	buffer := make(chan interface{}, bufferSize)
+	buffer := make(chan T, bufferSize)
 
 	// Create the Producer instance with the injected config.
-	p := &Producer{
+	p := &ProducerOf[T]{
 		Buffer:   buffer,
 		NumProcs: numProcs,
 	}
@@ -72,68 +191,262 @@ func NewProducer(bufferSize int, numProcs int) *Producer {
 //
 // Run blocks until all goroutines finish or the context is canceled.
 //
+// It returns nil once ProduceFunc has no more data or returned
+// ErrStopProduce, the cause of the context if it is done first, such as
+// context.Canceled, the reason passed to Stop, or the error wrapping
+// ErrStopProduce that ProduceFunc returned. This makes Run fit a function
+// of errgroup.Group.Go, or of group.Group.Go in this repository.
+//
 // Example usage:
 //
 //   ctx := context.Background()
-//   p.Run(ctx)
+//   err := p.Run(ctx)
 //
-func (p *Producer) Run(ctx context.Context) {
+func (p *ProducerOf[T]) Run(ctx context.Context) error {
+	return p.run(ctx, p.runProc)
+}
 
-	var wg sync.WaitGroup
+// run starts NumProcs goroutines running runProc and waits for them.
+func (p *ProducerOf[T]) run(ctx context.Context, runProc func(context.Context, *sync.WaitGroup)) error {
 
-	// Add a WaitGroup counter for each goroutine
-	for i := 0; i < p.NumProcs; i++ {
-		wg.Add(1)
-		// Start a goroutine to execute the ProduceFunc
-		go p.runProc(ctx, &wg)
+	// Refuse an ItemTTL the items cannot carry
+	if err := p.checkTTL(); err != nil {
+		return err
 	}
 
-	// Wait for all goroutines to finish
-	wg.Wait()
+	// Stop cancels the goroutines with its reason
+	ctx, cancel := signal.Context(ctx, &p.stopped)
+	defer cancel()
+
+	// ErrStopProduce cancels them too
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	ctx = context.WithValue(ctx, stopProduceKey{}, stop)
+
+	p.emit(ProducerStarted, nil)
+
+	// Let Autoscale run the goroutines, if set
+	if p.Autoscale != nil {
+		p.autoscale(ctx, runProc)
+	} else {
+		var wg sync.WaitGroup
+
+		// Add a WaitGroup counter for each goroutine
+		for i := 0; i < p.NumProcs; i++ {
+			wg.Add(1)
+			// Start a goroutine to execute the ProduceFunc
+			go runProc(ctx, &wg)
+		}
+
+		// Wait for all goroutines to finish
+		wg.Wait()
+	}
+
+	var err error
+	if cause := context.Cause(ctx); ctx.Err() != nil && cause != ErrStopProduce {
+		err = cause
+	}
+	p.emit(ProducerStopped, err)
+	return err
+}
+
+// RunAndClose runs the Producer like Run, then closes it once all the
+// goroutines returned, so readers of Buffer or Queue see the end of the
+// data after draining it. A closed Producer does not run again.
+func (p *ProducerOf[T]) RunAndClose(ctx context.Context) error {
+	err := p.Run(ctx)
+	p.Close()
+	return err
+}
+
+// Stop stops Run, which returns reason, or signal.ErrClosed if reason is
+// nil. The goroutines finish writing the item in hand. Only the first
+// Stop counts, and a stopped Producer does not run again.
+func (p *ProducerOf[T]) Stop(reason error) {
+	p.stopped.Close(reason)
+}
+
+// Pause makes the goroutines of Run stop calling ProduceFunc until
+// Resume, finishing the item in hand. They keep running, and return if
+// the context is done or Stop is called meanwhile. Buffer keeps its
+// items, and Inject keeps delivering them.
+func (p *ProducerOf[T]) Pause() {
+	if p.pause.pause() {
+		p.emit(ProducerPaused, nil)
+	}
+}
+
+// Resume lets the goroutines paused by Pause call ProduceFunc again.
+func (p *ProducerOf[T]) Resume() {
+	if p.pause.resume() {
+		p.emit(ProducerResumed, nil)
+	}
+}
+
+// Paused reports whether the Producer is paused.
+func (p *ProducerOf[T]) Paused() bool {
+	return p.pause.paused()
 }
 
 // runProc executes the custom ProduceFunc to generate data.
 // It runs in a goroutine started by the Run method.
-func (p *Producer) runProc(ctx context.Context, wg *sync.WaitGroup) {
+func (p *ProducerOf[T]) runProc(ctx context.Context, wg *sync.WaitGroup) {
 
 	defer wg.Done()
 
+	// Count it for Stats until it returns
+	p.workers.Add(1)
+	defer p.workers.Add(-1)
+
+	y := yielder{every: p.Tuning.YieldEvery}
+	retire := retirement(ctx)
+
 	for {
 		// Check for context cancellation
 		if p.isCancelled(ctx) {
 			return
 		}
 
-		// Invoke custom function to generate data
-		data, err := p.ProduceFunc()
+		// Return once retired by Autoscale
+		if retire != nil && retire.Reason() != nil {
+			return
+		}
+
+		// Wait while paused
+		if !p.pause.wait(ctx) {
+			return
+		}
+
+		// Wait for the limiter to admit the next item
+		if p.Limiter != nil {
+			if err := p.Limiter.Wait(ctx); err != nil {
+				if ctx.Err() == nil {
+					var zero T
+					p.handleError(zero, err)
+				}
+				return
+			}
+		}
+
+		// Wait for the delay of Throttle
+		if !p.throttle(ctx) {
+			return
+		}
+
+		// Invoke custom function to generate data, recovering a panic
+		var data T
+		err := catch(p.PanicHandler, &p.panics, func() (err error) {
+			data, err = p.ProduceFunc()
+			return err
+		})
+		if panicked(err) {
+			if p.PanicHandler == nil {
+				p.handleError(data, err)
+			}
+			if !p.RestartOnPanic {
+				return
+			}
+			continue
+		}
+
+		// No more data
+		if errors.Is(err, ErrDone) {
+			return
+		}
+
+		// No more data for any goroutine, and Run returns err if it
+		// wraps ErrStopProduce
+		if errors.Is(err, ErrStopProduce) {
+			if stop, ok := ctx.Value(stopProduceKey{}).(context.CancelCauseFunc); ok {
+				stop(err)
+			}
+			return
+		}
 
 		// Handle any errors
 		if err != nil {
-			p.handleError(err)
+			p.failed.Add(1)
+			p.handleError(data, err)
 			continue
 		}
 
 		// No data produced
-		if data == nil {
+		if isNil(data) {
 			return
 		}
-		// Write data to buffer, applying backpressure if full
+		item := data
+		data = p.stamp(data)
+
+		// Write data to the queue, if set
+		if p.Queue != nil {
+			if !p.push(ctx, data) {
+				return
+			}
+			p.stats.add()
+			p.emit(ItemProduced, item)
+			y.item()
+			continue
+		}
+		// Write data to buffer following the overflow policy
+		if p.Overflow != OverflowBackpressure {
+			if p.overflow(ctx, p.Buffer, data) {
+				p.stats.add()
+				p.emit(ItemProduced, item)
+				y.item()
+			} else if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		// Write data to buffer, spinning then applying backpressure if full
 		written := p.tryWrite(p.Buffer, data)
-		if !written {
-			p.applyBackpressure()
+		if !written && p.Tuning.SpinBeforePark > 0 {
+			written = spinWrite(ctx, p.Tuning.SpinBeforePark, func() bool {
+				return p.tryWrite(p.Buffer, data)
+			})
+		}
+
+		// Wait for room with BlockBackpressure
+		if _, ok := p.Backpressure.(blockBackpressure); ok && !written {
+			p.backpressure.Add(1)
+			p.emit(BackpressureApplied, 1)
+			select {
+			case p.Buffer <- data:
+				written = true
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// Back off and try again while full, counting the attempts
+		for attempt := 1; !written; attempt++ {
+			p.backpressure.Add(1)
+			if !p.applyBackpressure(ctx, attempt) || p.isCancelled(ctx) {
+				return
+			}
+			written = p.tryWrite(p.Buffer, data)
 		}
+		p.stats.add()
+		p.emit(ItemProduced, item)
+		y.item()
 	}
 }
 
 // Inject pipes data from the Producer's buffer channel to the
 // provided out channel.
 
-// It runs until the out channel is closed or the context is cancelled.
+// It waits for data while the buffer is empty, and runs until the
+// context is cancelled or the buffer is closed and drained.
 
-// Inject writes to out channel in a non-blocking manner, dropping messages
-// if the out channel is full.
-func (p *Producer) Inject(ctx context.Context, out chan interface{}) {
+// When the out channel is full Inject follows Overflow, dropping messages
+// by default. out must not be closed while Inject runs: Inject closes it
+// itself once the buffer is closed and drained, unless ctx is done first,
+// so each out takes a single Inject.
+func (p *ProducerOf[T]) Inject(ctx context.Context, out chan T) {
 
+	y := yielder{every: p.Tuning.YieldEvery}
+	var held []T
 	for {
 
 		// Check for context cancellation
@@ -141,20 +454,37 @@ func (p *Producer) Inject(ctx context.Context, out chan interface{}) {
 			return
 		}
 
-		// Non-blocking write to out channel
-		// Try read from buffer
-		data, ok := p.tryReadBuffer()
+		// Wait for data in the buffer
+		data, ok := p.readBuffer(ctx)
 		if !ok {
+			// Closed and drained, nothing more for out
+			if ctx.Err() == nil {
+				close(out)
+			}
 			return
 		}
-
-		// Try write to out channel
-		written := p.tryWrite(out, data)
-		if !written {
-			continue
+		// Take the items already there too, up to MaxBatchDrain
+		held = drainInto(append(held[:0], data), p.Tuning.MaxBatchDrain, p.tryReadBuffer)
+
+		for _, data := range held {
+			// Drop the items that waited too long
+			data, live := unstamp(data)
+			if !live {
+				continue
+			}
+
+			// Measure how far the reader of out lags, for Throttle
+			p.sample(out)
+
+			// Write to out channel, or handle the overflow
+			written := p.overflow(ctx, out, data)
+			y.item()
+			if !written {
+				continue
+			}
+			// Notify data injected
+			p.emit(InjectCompleted, data)
 		}
-		// Notify data injected
-		p.Notifier("InjectFinished")
 
 	}
 }
@@ -166,12 +496,28 @@ func (p *Producer) Inject(ctx context.Context, out chan interface{}) {
 //
 // It should be called when data generation is complete and before disposing
 // the Producer object.
-func (p *Producer) Close() {
+func (p *ProducerOf[T]) Close() {
+
+	// Close the queue instead, if set
+	if p.Queue != nil {
+		p.Queue.Close()
+		return
+	}
 
 	close(p.Buffer)
 
 }
 
+// sets the queue written to instead of Buffer.
+func (p *ProducerOf[T]) SetQueue(q QueueOf[T]) {
+	p.Queue = q
+}
+
+// sets the limiter capping how fast items are produced.
+func (p *ProducerOf[T]) SetLimiter(l ratelimit.Limiter) {
+	p.Limiter = l
+}
+
 // HandleError sets a custom error handler function.
 //
 // The handler will be invoked whenever an error is returned
@@ -184,12 +530,22 @@ func (p *Producer) Close() {
 //   p.HandleError(func(err error){
 //     log.Printf("data generation failed: %v", err)
 //   })
-func (p *Producer) HandleError(handler ErrHandler) {
+func (p *ProducerOf[T]) HandleError(handler ErrHandler) {
 
 	p.ErrHandler = handler
 
 }
 
+// sets the error handler receiving the items along with the errors.
+func (p *ProducerOf[T]) SetItemErrHandler(handler func(data T, err error)) {
+	p.ItemErrHandler = handler
+}
+
+// sets the handler receiving the panics of ProduceFunc.
+func (p *ProducerOf[T]) SetPanicHandler(handler func(recovered interface{}, stack []byte)) {
+	p.PanicHandler = handler
+}
+
 // Notify sets a notifier function to receive lifecycle notifications.
 //
 // The notifier will be invoked during key events like start/stop of
@@ -202,7 +558,7 @@ func (p *Producer) HandleError(handler ErrHandler) {
 //   p.Notify(func(msg string){
 //     log.Println(msg)
 //   })
-func (p *Producer) Notify(notifier Notifier) {
+func (p *ProducerOf[T]) Notify(notifier Notifier) {
 
 	p.Notifier = notifier
 
@@ -213,26 +569,64 @@ func (p *Producer) Notify(notifier Notifier) {
 // tryReadBuffer tries to read data from the buffer channel in a
 // non-blocking way.
 // It returns the data if read succeeded, otherwise nil.
-// The second return value indicates if read succeeded.
-func (p *Producer) tryReadBuffer() (interface{}, bool) {
+// The second return value indicates if read succeeded, and is false
+// once the buffer is closed and drained.
+func (p *ProducerOf[T]) tryReadBuffer() (T, bool) {
 	// 非阻塞读取 buffer
 	select {
-	case data := <-p.Buffer:
-		return data, true
+	case data, ok := <-p.Buffer:
+		return data, ok
 	default:
-		return nil, false
+		var zero T
+		return zero, false
 	}
 }
 
-// tryWrite attempts to write data to out channel in non-blocking manner.
-// Returns true if write succeeded, false otherwise.
-func (p *Producer) tryWrite(out chan interface{}, data interface{}) bool {
-
+// readBuffer waits for data from the buffer channel, spinning for
+// SpinBeforePark first. The second return value is false once the buffer
+// is closed and drained, or ctx is done.
+func (p *ProducerOf[T]) readBuffer(ctx context.Context) (T, bool) {
+	if d := p.Tuning.SpinBeforePark; d > 0 {
+		if data, ok := spin(ctx, d, p.tryReadBuffer); ok {
+			return data, true
+		}
+	}
 	select {
-	case <-out:
-		// out is closed
+	case data, ok := <-p.Buffer:
+		return data, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// push writes data to Queue, reporting errors to ErrHandler. It returns
+// false once the queue is closed or ctx is done.
+func (p *ProducerOf[T]) push(ctx context.Context, data T) bool {
+	err := p.Queue.Push(ctx, data)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, ErrQueueClosed) || ctx.Err() != nil {
 		return false
+	}
+	if p.ErrHandler != nil {
+		p.ErrHandler(err)
+	}
+	if p.ItemErrHandler != nil {
+		p.ItemErrHandler(data, err)
+	}
+	return true
+}
 
+// tryWrite attempts to write data to out channel in non-blocking manner.
+// Returns true if write succeeded, false if out is full.
+//
+// It never reads from out, so it cannot take items meant for its readers.
+// out must not be closed: writing to a closed channel panics.
+func (p *ProducerOf[T]) tryWrite(out chan T, data T) bool {
+
+	select {
 	case out <- data:
 		// Write succeeded
 		return true
@@ -244,9 +638,27 @@ func (p *Producer) tryWrite(out chan interface{}, data interface{}) bool {
 
 }
 
+// isNil reports whether data is a nil pointer, map, slice, channel or
+// function, or a nil interface{}.
+func isNil[T any](data T) bool {
+	if any(data) == nil {
+		return true
+	}
+
+	// Typed nils in interface{} items are data
+	if reflect.TypeFor[T]().Kind() == reflect.Interface {
+		return false
+	}
+	switch v := reflect.ValueOf(data); v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
 // isCancelled checks if the context has been cancelled.
 // This allows goroutines to stop when a cancellation signal is received.
-func (p *Producer) isCancelled(ctx context.Context) bool {
+func (p *ProducerOf[T]) isCancelled(ctx context.Context) bool {
 
 	select {
 	case <-ctx.Done():
@@ -257,42 +669,69 @@ func (p *Producer) isCancelled(ctx context.Context) bool {
 
 }
 
+// backpressure is the default delay between writes to a full buffer:
+// 100ms, doubling up to 1s.
+var backpressure = ExponentialBackpressure(backoff.Backoff{
+	Initial:    100 * time.Millisecond,
+	Max:        time.Second,
+	Multiplier: 2,
+	Jitter:     0.1,
+})
+
 // applyBackpressure applies throttling when buffer channel is full.
 // This gives time for the channel to drain and prevent Producer from
 // overwhelming downstream consumers.
 //
-// Current implementation simply sleeps for a short period. More
-// sophisticated throttling and metrics can be added, for example:
-//
-//   - exponential backoff
-//   - adaptive throttling based on consumer speed
-//   - metrics for drop count, throttle time, etc
-func (p *Producer) applyBackpressure() {
+// It waits following Backpressure after the attempt-th write of an item
+// found the buffer full. It returns false if ctx is done while waiting.
+func (p *ProducerOf[T]) applyBackpressure(ctx context.Context, attempt int) bool {
 
 	// Notify backpressure applied
-	p.Notifier("buff full sleep")
+	p.emit(BackpressureApplied, attempt)
 
-	// Simple throttling sleep
-	time.Sleep(100 * time.Millisecond)
+	strategy := p.Backpressure
+	if strategy == nil {
+		strategy = backpressure
+	}
+	return strategy.Wait(ctx, attempt) == nil
+}
+
+// sets the handler receiving the lifecycle events.
+func (p *ProducerOf[T]) SetEventHandler(handler EventHandler) {
+	p.EventHandler = handler
+}
 
+// emit sends an event of kind to EventHandler and Notifier.
+func (p *ProducerOf[T]) emit(kind EventKind, payload interface{}) {
+	emit(p.EventHandler, p.Notifier, kind, payload)
+}
+
+// sets the strategy backing Run off from a full Buffer.
+func (p *ProducerOf[T]) SetBackpressure(strategy BackpressureStrategy) {
+	p.Backpressure = strategy
 }
 
 // handleError handles any errors returned by the ProduceFunc.
 //
-// It logs the error and invokes any configured ErrHandler.
+// It logs the error and invokes any configured ErrHandler and
+// ItemErrHandler, passing data, the item returned with the error, to the
+// latter.
 //
-// If no ErrHandler set, the error will be ignored.
+// If no handler set, the error will be ignored.
 //
 // This method allows customizing error handling logic.
-func (p *Producer) handleError(err error) {
+func (p *ProducerOf[T]) handleError(data T, err error) {
 
 	// Notify error happened
-	p.Notifier("ProducerError")
+	p.emit(ProducerError, err)
 
-	// Invoke custom error handler
+	// Invoke custom error handlers
 	if p.ErrHandler != nil {
 		p.ErrHandler(err)
 	}
+	if p.ItemErrHandler != nil {
+		p.ItemErrHandler(data, err)
+	}
 
 	// Any other error handling logic...
 
@@ -6,13 +6,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
-	gomonkey "github.com/agiledragon/gomonkey/v2"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
 )
 
 func TestNewProducer(t *testing.T) {
@@ -46,35 +45,18 @@ func TestProducer_Run(t *testing.T) {
 	// 用一个channel来标识done
 	done := make(chan bool)
 
-	p := NewProducer(1, 3)
-
-	patch := gomonkey.ApplyPrivateMethod(reflect.TypeOf(p), "runProc",
-		func(_ context.Context, _ *sync.WaitGroup) {
-			// 自定义逻辑
-		})
-
-	defer patch.Reset()
-
-	var wg sync.WaitGroup
-	var counter int32
-
 	const EXPECTED_PROCS = 3
 
-	patchWg := gomonkey.ApplyMethod(reflect.TypeOf(&wg), "Wait", func() {})
-	defer patchWg.Reset()
-
-	for i := 0; i < EXPECTED_PROCS; i++ {
-		wg.Add(1)
+	// 每个 goroutine 调用一次 ProduceFunc 后没有数据而返回
+	var counter int32
+	p := NewProducer(1, EXPECTED_PROCS)
+	p.ProduceFunc = func() (interface{}, error) {
+		atomic.AddInt32(&counter, 1)
+		return nil, ErrDone
 	}
 
-	// 使用 atomic 原子操作来更新计数
-	atomic.AddInt32(&counter, int32(EXPECTED_PROCS))
-
-	ctx, cancel := context.WithCancel(context.Background())
-
 	go func() {
-		p.Run(ctx)
-		wg.Done()
+		p.Run(context.Background())
 		done <- true
 	}()
 
@@ -86,17 +68,12 @@ func TestProducer_Run(t *testing.T) {
 	case <-done:
 		// pass
 	}
-	time.Sleep(time.Millisecond * 100)
 
 	// 对比 atomic 的计数和期望值
 	if atomic.LoadInt32(&counter) != int32(EXPECTED_PROCS) {
 		t.Errorf("Expected %d procs, got %d", EXPECTED_PROCS, counter)
 	}
 
-	cancel()
-
-	wg.Wait()
-
 }
 
 func TestProducer_runProc(t *testing.T) {
@@ -108,12 +85,9 @@ func TestProducer_runProc(t *testing.T) {
 			return "data", nil
 		},
 	}
-	patch := gomonkey.ApplyPrivateMethod(reflect.TypeOf(p), "applyBackpressure",
-		func() {
-			// 自定义逻辑
-		})
+	// Buffer 满时短暂等待后重试
+	p.Backpressure = FixedBackpressure(time.Millisecond)
 
-	defer patch.Reset()
 	// 用 WaitGroup 记录执行次数
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -139,9 +113,18 @@ func TestProducer_runProc(t *testing.T) {
 	// 等待结束
 	wg.Wait()
 
-	// Buffer 不应有其他数据
+	// Buffer 被写满,写入的数据没有被写入方自己取走
+	if len(p.Buffer) < cap(p.Buffer)-1 {
+		t.Errorf("Expected a full buffer after cancel, got %d items", len(p.Buffer))
+	}
+
+	// 取消后不再写入
+	for len(p.Buffer) > 0 {
+		<-p.Buffer
+	}
+	time.Sleep(10 * time.Millisecond)
 	if len(p.Buffer) != 0 {
-		t.Error("Buffer should be empty after cancel")
+		t.Error("Buffer should stay empty after cancel")
 	}
 }
 
@@ -152,9 +135,9 @@ func TestProducer_Inject(t *testing.T) {
 	}
 
 	// 校验通知被调用
-	notified := false
+	var notified atomic.Bool
 	p.Notifier = func(string) {
-		notified = true
+		notified.Store(true)
 	}
 
 	// 用来接收注入的数据
@@ -185,7 +168,7 @@ func TestProducer_Inject(t *testing.T) {
 	<-time.After(time.Millisecond * 100)
 
 	// 校验通知被调用
-	if !notified {
+	if !notified.Load() {
 		t.Error("InjectFinished notification not received")
 	}
 
@@ -195,6 +178,86 @@ func TestProducer_Inject(t *testing.T) {
 	}
 }
 
+func TestProducer_InjectSlowProducer(t *testing.T) {
+
+	// 生产者每 50ms 生产一个数据,比 Inject 慢
+	const n = 5
+	produced := 0
+	p := NewProducer(10, 1)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		if produced == n {
+			return nil, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+		produced++
+		return produced, nil
+	}
+
+	go func() {
+		p.Run(context.Background())
+		p.Close()
+	}()
+
+	// Inject 在 Buffer 暂时为空时等待,直到 Buffer 关闭
+	out := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Inject(context.Background(), out)
+	}()
+
+	for i := 1; i <= n; i++ {
+		select {
+		case data := <-out:
+			if data != i {
+				t.Errorf("Expected %d in out, got %v", i, data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Item %d did not reach out", i)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Inject did not return after the buffer was closed")
+	}
+}
+
+func TestProducer_tryWrite(t *testing.T) {
+
+	p := NewProducer(1, 1)
+
+	// out 已满,写入失败,原有数据不能被取走
+	out := make(chan interface{}, 3)
+	for i := 0; i < 3; i++ {
+		out <- i
+	}
+	for i := 0; i < 100; i++ {
+		if p.tryWrite(out, "new") {
+			t.Fatal("Write to full channel should fail")
+		}
+	}
+	if len(out) != 3 {
+		t.Fatalf("Expected 3 items in out, got %d", len(out))
+	}
+
+	// out 有空位,写入成功,原有数据保持顺序
+	out = make(chan interface{}, 4)
+	for i := 0; i < 3; i++ {
+		out <- i
+	}
+	if !p.tryWrite(out, "new") {
+		t.Fatal("Write to channel with room should succeed")
+	}
+	for _, want := range []interface{}{0, 1, 2, "new"} {
+		if got := <-out; got != want {
+			t.Errorf("Expected %v in out, got %v", want, got)
+		}
+	}
+}
+
 func TestProducer_Close(t *testing.T) {
 
 	p := &Producer{
@@ -249,7 +312,7 @@ func TestProducer_HandleError(t *testing.T) {
 		handledCount++
 	})
 
-	p.handleError(err)
+	p.handleError(nil, err)
 
 	// 检查错误是否被处理函数接收到
 	if handledCount == 0 {
@@ -277,6 +340,13 @@ func TestProducer_tryReadBuffer(t *testing.T) {
 	if !ok || d != "data" {
 		t.Error("Should return data when buffer has data")
 	}
+
+	// buffer 关闭并取完后,tryReadBuffer 应该返回 false
+	close(buffer)
+	_, ok = p.tryReadBuffer()
+	if ok {
+		t.Error("Should return false when buffer is closed")
+	}
 }
 
 func TestProducer_isCancelled(t *testing.T) {
@@ -305,25 +375,36 @@ func TestProducer_applyBackpressure(t *testing.T) {
 	p.Buffer <- "data"
 
 	// 定义通知函数,检测是否被调用
-	var notified bool
+	var notified atomic.Bool
 	p.Notifier = func(string) {
-		notified = true
+		notified.Store(true)
 	}
 
 	// 调用 applyBackpressure
-	p.applyBackpressure()
+	p.applyBackpressure(context.Background(), 1)
 
 	// 检查通知函数是否被调用
-	if !notified {
+	if !notified.Load() {
 		t.Error("Notifier should be called")
 	}
 
 	// 检查是否有睡眠
 	start := time.Now()
-	p.applyBackpressure()
+	p.applyBackpressure(context.Background(), 2)
 	if time.Since(start) < time.Millisecond*50 {
 		t.Error("Should sleep on backpressure")
 	}
+
+	// ctx 取消时立即返回 false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	if p.applyBackpressure(ctx, 3) {
+		t.Error("Cancelled context should stop backpressure")
+	}
+	if time.Since(start) > time.Millisecond*50 {
+		t.Error("Should not sleep after cancellation")
+	}
 }
 
 func TestProducer_handleError(t *testing.T) {
@@ -337,17 +418,17 @@ func TestProducer_handleError(t *testing.T) {
 	}
 
 	// 定义通知函数
-	var notified bool
+	var notified atomic.Bool
 	p.Notifier = func(string) {
-		notified = true
+		notified.Store(true)
 	}
 
 	// 传入错误,调用 handleError
 	err := errors.New("test error")
-	p.handleError(err)
+	p.handleError(nil, err)
 
 	// 检查通知和错误处理是否被调用
-	if !notified {
+	if !notified.Load() {
 		t.Error("Notifier should be called")
 	}
 
@@ -355,3 +436,299 @@ func TestProducer_handleError(t *testing.T) {
 		t.Error("ErrHandler should be called")
 	}
 }
+
+func TestProducer_RunReason(t *testing.T) {
+
+	// 数据生产完时返回 nil
+	p := NewProducer(10, 2)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		return nil, nil
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Errorf("Expected nil when the data ran out, got %v", err)
+	}
+
+	// ctx 结束时返回 ctx 的原因
+	p = NewProducer(1, 2)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		return "data", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// Stop 时返回 Stop 的原因
+	p = NewProducer(1, 2)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		return "data", nil
+	}
+	errFatal := errors.New("upstream failed")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		p.Stop(errFatal)
+		p.Stop(errors.New("later"))
+	}()
+	if err := p.Run(context.Background()); err != errFatal {
+		t.Errorf("Expected %v, got %v", errFatal, err)
+	}
+
+	// ctx 被取消时返回 context.Canceled
+	p = NewProducer(1, 2)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		return "data", nil
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := p.Run(ctx); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+
+	// 包装了 ErrStopProduce 的错误停止全部 goroutine,并由 Run 返回
+	var calls atomic.Int64
+	p = NewProducer(1000, 4)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		if calls.Add(1) == 10 {
+			return nil, fmt.Errorf("reading input: %w", ErrStopProduce)
+		}
+		return "data", nil
+	}
+	err := p.Run(context.Background())
+	if !errors.Is(err, ErrStopProduce) || err.Error() != "reading input: stop producing" {
+		t.Errorf("Expected the wrapped ErrStopProduce, got %v", err)
+	}
+	if p.Stats().Failed != 0 {
+		t.Errorf("Failed = %d, want 0", p.Stats().Failed)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	const n = 100
+
+	// 生产者较慢,缓冲常常为空
+	var next atomic.Int64
+	p := NewProducer(4, 3)
+	p.Notify(func(string) {})
+	p.Overflow = OverflowBlock
+	p.ProduceFunc = func() (interface{}, error) {
+		i := next.Add(1)
+		if i > n {
+			return nil, nil
+		}
+		if i%10 == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		return i, nil
+	}
+
+	var mu sync.Mutex
+	seen := make(map[interface{}]bool)
+	c := NewConsumer(2, 2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[data] = true
+		return nil
+	}
+
+	// 生产完关闭 Buffer,Inject 转发完关闭消费者的 Buffer,消费者取完后返回
+	ctx := context.Background()
+	errs := make(chan error, 2)
+	go func() { errs <- p.RunAndClose(ctx) }()
+	go func() {
+		p.Inject(ctx, c.Buffer)
+		errs <- nil
+	}()
+	if err := c.Run(ctx); err != nil {
+		t.Errorf("Expected consumer to return nil, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected producer to return nil, got %v", err)
+		}
+	}
+
+	if len(seen) != n || c.Stats().Processed != n {
+		t.Errorf("Expected %d items processed, got %d", n, len(seen))
+	}
+	if _, ok := <-c.Buffer; ok {
+		t.Error("Expected Inject to close the consumer's buffer")
+	}
+}
+
+func TestProducer_Limiter(t *testing.T) {
+
+	// 令牌桶每秒 10 个,运行 1 秒应生产约 10 个
+	var calls int32
+	p := NewProducer(100, 2)
+	p.Notify(func(string) {})
+	p.SetLimiter(tokenbucket.New(10, 10))
+	p.ProduceFunc = func() (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	produced := p.Stats().Produced
+	if produced < 7 || produced > 12 {
+		t.Errorf("produced %d items in a second, want about 10", produced)
+	}
+
+	// 被拒绝时等待,不会反复调用 ProduceFunc
+	if n := atomic.LoadInt32(&calls); uint64(n) != produced {
+		t.Errorf("ProduceFunc called %d times for %d items", n, produced)
+	}
+}
+
+// failingLimiter refuses every wait with err.
+type failingLimiter struct {
+	err error
+}
+
+func (l failingLimiter) Allow() bool                { return false }
+func (l failingLimiter) AllowN(int) bool            { return false }
+func (l failingLimiter) Wait(context.Context) error { return l.err }
+
+func TestProducer_LimiterError(t *testing.T) {
+
+	// 限流器出错时交给错误处理,goroutine 退出
+	errClosed := errors.New("limiter closed")
+	var handled []error
+	var mu sync.Mutex
+	p := NewProducer(10, 2)
+	p.SetLimiter(failingLimiter{err: errClosed})
+	p.HandleError(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, err)
+	})
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		t.Error("ProduceFunc should not be called")
+		return nil, ErrDone
+	}
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+	if len(handled) != 2 || !errors.Is(handled[0], errClosed) {
+		t.Errorf("handled %v, want %v for each goroutine", handled, errClosed)
+	}
+}
+
+func TestProducer_ItemErrHandler(t *testing.T) {
+
+	// 生产函数和错误一起返回的数据交给 ItemErrHandler
+	errPartial := errors.New("partial")
+	n := 0
+	p := NewProducer(10, 1)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		n++
+		switch n {
+		case 2:
+			return "half-read", errPartial
+		case 3:
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+	var handled []error
+	var items []interface{}
+	p.HandleError(func(err error) { handled = append(handled, err) })
+	p.SetItemErrHandler(func(data interface{}, err error) {
+		items = append(items, data)
+		if !errors.Is(err, errPartial) {
+			t.Errorf("ItemErrHandler got %v, want %v", err, errPartial)
+		}
+	})
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+
+	// 两个处理函数都被调用
+	if len(handled) != 1 || handled[0] != errPartial {
+		t.Errorf("ErrHandler got %v, want [%v]", handled, errPartial)
+	}
+	if len(items) != 1 || items[0] != "half-read" {
+		t.Errorf("ItemErrHandler got %v, want [half-read]", items)
+	}
+
+	// 限流器出错时没有数据
+	p = NewProducer(10, 1)
+	p.SetLimiter(failingLimiter{err: errPartial})
+	items = nil
+	p.SetItemErrHandler(func(data interface{}, err error) { items = append(items, data) })
+	p.ProduceFunc = func() (interface{}, error) { return nil, ErrDone }
+	if err := p.Run(context.Background()); err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+	if len(items) != 1 || items[0] != nil {
+		t.Errorf("ItemErrHandler got %v, want [<nil>]", items)
+	}
+}
+
+func TestProducer_ErrStopProduce(t *testing.T) {
+
+	// 一个 goroutine 返回 ErrStopProduce,全部 goroutine 退出
+	var calls atomic.Int64
+	p := NewProducer(1000, 8)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		if calls.Add(1) == 50 {
+			return nil, ErrStopProduce
+		}
+		time.Sleep(time.Millisecond)
+		return 1, nil
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ErrStopProduce")
+	}
+
+	// 其余 goroutine 最多完成手上的一次调用
+	n := calls.Load()
+	if n < 50 || n > 50+7 {
+		t.Errorf("ProduceFunc called %d times, want 50 to 57", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if calls.Load() != n {
+		t.Error("ProduceFunc called after Run returned")
+	}
+	if p.Stats().Failed != 0 {
+		t.Errorf("Failed = %d, want 0", p.Stats().Failed)
+	}
+
+	// 返回 nil 仍然只结束一个 goroutine
+	var nils atomic.Int64
+	p = NewProducer(1000, 2)
+	p.ProduceFunc = func() (interface{}, error) {
+		if nils.Add(1) <= 2 {
+			return nil, nil
+		}
+		t.Error("ProduceFunc called after both goroutines got nil")
+		return nil, nil
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,33 @@
+package producerconsumer
+
+import (
+	"context"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+)
+
+// ErrQueueClosed is the error a Queue returns once it is closed.
+var ErrQueueClosed = queue.ErrClosed
+
+// Queue is a QueueOf any items, such as a
+// *queue.BoundedQueue[interface{}].
+type Queue = QueueOf[interface{}]
+
+// QueueOf is a buffer between producers and consumers of items of type T
+// other than a channel, such as a *queue.BoundedQueue[T].
+// Implementations must be safe for many pushing and popping goroutines.
+type QueueOf[T any] interface {
+
+	// Push queues item, returning ErrQueueClosed after Close.
+	Push(ctx context.Context, item T) error
+
+	// Pop returns the oldest item, waiting for one until ctx is done. It
+	// returns ErrQueueClosed once the queue is closed and drained.
+	Pop(ctx context.Context) (T, error)
+
+	// Close stops further pushes.
+	Close()
+}
+
+// BoundedQueue implements Queue.
+var _ Queue = (*queue.BoundedQueue[interface{}])(nil)
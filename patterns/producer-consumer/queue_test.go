@@ -0,0 +1,159 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueBacked(t *testing.T) {
+
+	// 生产者和消费者共享一个有界队列,满时丢弃最旧的数据
+	q := queue.New[interface{}](4, queue.WithPolicy(queue.DropOldest))
+	var evicted []interface{}
+	q.OnEvict(func(v interface{}) { evicted = append(evicted, v) })
+
+	n := 0
+	p := NewProducer(0, 1)
+	p.Notify(func(string) {})
+	p.SetQueue(q)
+	p.ProduceFunc = func() (interface{}, error) {
+		n++
+		if n > 10 {
+			return nil, nil
+		}
+		return n, nil
+	}
+
+	// 生产结束后关闭队列
+	p.Run(context.Background())
+	p.Close()
+	require.Equal(t, []interface{}{1, 2, 3, 4, 5, 6}, evicted)
+
+	var mu sync.Mutex
+	var consumed []interface{}
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		consumed = append(consumed, data)
+		mu.Unlock()
+		return nil
+	}
+
+	// 队列关闭且取完后消费者返回
+	c.Run(context.Background())
+	require.ElementsMatch(t, []interface{}{7, 8, 9, 10}, consumed)
+}
+
+func TestQueueRejectErrors(t *testing.T) {
+
+	// 队列拒绝的数据交给生产者的错误处理
+	q := queue.New[interface{}](1, queue.WithPolicy(queue.Reject))
+
+	var errs []error
+	n := 0
+	p := NewProducer(0, 1)
+	p.SetQueue(q)
+	p.HandleError(func(err error) { errs = append(errs, err) })
+	p.ProduceFunc = func() (interface{}, error) {
+		n++
+		if n > 3 {
+			return nil, nil
+		}
+		return n, nil
+	}
+	p.Run(context.Background())
+
+	require.Len(t, errs, 2)
+	require.ErrorIs(t, errs[0], queue.ErrFull)
+	require.Equal(t, 1, q.Len())
+}
+
+func TestQueueConsumerWaits(t *testing.T) {
+
+	// 使用队列时消费者等待新数据,而不是在队列为空时退出
+	q := queue.New[interface{}](4)
+	c := NewConsumer(0, 1)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+
+	got := make(chan interface{}, 1)
+	c.ConsumeFunc = func(data interface{}) error {
+		got <- data
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Run(context.Background())
+		close(done)
+	}()
+
+	require.NoError(t, q.Push(context.Background(), "late"))
+	require.Equal(t, "late", <-got)
+
+	c.Close()
+	<-done
+}
+
+func TestQueueBytes(t *testing.T) {
+	const maxBytes = 1 << 20
+
+	// 按字节数限制队列,小数据和 256KB 以上的大数据混合
+	q := queue.NewSized[interface{}](1000, maxBytes, func(v interface{}) int {
+		return len(Unwrap(v).([]byte))
+	})
+
+	var n atomic.Int64
+	p := NewProducer(0, 4)
+	p.Notify(func(string) {})
+	p.SetQueue(q)
+	p.ItemTTL = time.Second
+	p.ProduceFunc = func() (interface{}, error) {
+		i := n.Add(1)
+		if i > 200 {
+			return nil, nil
+		}
+		if i%5 == 0 {
+			return make([]byte, 256<<10+int(i)), nil
+		}
+		return make([]byte, 100), nil
+	}
+
+	var consumed atomic.Int64
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+	c.ConsumeFunc = func(data interface{}) error {
+		consumed.Add(1)
+		time.Sleep(100 * time.Microsecond)
+
+		// 队列中的字节数不超过上限
+		if s := p.Stats(); s.BufferedBytes > maxBytes {
+			t.Errorf("BufferedBytes = %d, over %d", s.BufferedBytes, maxBytes)
+		}
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.RunAndClose(context.Background())
+	}()
+	require.NoError(t, c.Run(context.Background()))
+	<-done
+
+	// 取完后没有剩余字节,峰值不超过上限
+	s := p.Stats()
+	require.Equal(t, int64(200), consumed.Load())
+	require.Zero(t, s.BufferedBytes)
+	require.Greater(t, s.PeakBufferedBytes, 512<<10)
+	require.LessOrEqual(t, s.PeakBufferedBytes, maxBytes)
+}
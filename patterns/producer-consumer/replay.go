@@ -0,0 +1,154 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// FailedItem is an item whose consumption failed, as kept in a
+// dead-letter store.
+type FailedItem struct {
+
+	// Data is the item as it was handed to the consumer.
+	Data interface{}
+
+	// Err is the error of the last attempt.
+	Err error
+
+	// Attempts counts the attempts made so far.
+	Attempts int
+}
+
+// ReplayProgress counts what a Replayer did with the items it read.
+type ReplayProgress struct {
+	Read      uint64 // Items read from the source
+	Succeeded uint64 // Items consumed without error
+	Failed    uint64 // Items whose consumption failed again
+	Skipped   uint64 // Items the fix-up function dropped
+}
+
+// Replayer feeds failed items back into a consumer.
+type Replayer struct {
+
+	// Fixup rewrites each item before it is resubmitted, if set. It
+	// returns the data to consume, or false to skip the item.
+	Fixup func(FailedItem) (interface{}, bool)
+
+	// Refailed receives the items that fail again, with their new error
+	// and attempt count, if set. Sends block until Refailed is read or
+	// the context is done.
+	Refailed chan<- FailedItem
+
+	// next returns the next item, or io.EOF once there is none.
+	next func(ctx context.Context) (FailedItem, error)
+
+	read      uint64
+	succeeded uint64
+	failed    uint64
+	skipped   uint64
+}
+
+// NewReplayer creates a Replayer reading failed items from source until
+// it is closed.
+func NewReplayer(source <-chan FailedItem) *Replayer {
+	return &Replayer{
+		next: func(ctx context.Context) (FailedItem, error) {
+			select {
+			case item, ok := <-source:
+				if !ok {
+					return FailedItem{}, io.EOF
+				}
+				return item, nil
+			case <-ctx.Done():
+				return FailedItem{}, ctx.Err()
+			}
+		},
+	}
+}
+
+// NewReaderReplayer creates a Replayer reading failed items from r, such
+// as a dead-letter file, with decode. decode returns one item per call,
+// and io.EOF once r is exhausted.
+func NewReaderReplayer(r io.Reader, decode func(io.Reader) (FailedItem, error)) *Replayer {
+	return &Replayer{
+		next: func(ctx context.Context) (FailedItem, error) {
+			if err := ctx.Err(); err != nil {
+				return FailedItem{}, err
+			}
+			return decode(r)
+		},
+	}
+}
+
+// sets the function rewriting items before they are resubmitted.
+func (r *Replayer) SetFixup(fixup func(FailedItem) (interface{}, bool)) {
+	r.Fixup = fixup
+}
+
+// sets the channel receiving the items that fail again.
+func (r *Replayer) SetRefailed(refailed chan<- FailedItem) {
+	r.Refailed = refailed
+}
+
+// Replay passes every item of the source to target's Process, waiting for
+// rate before each one if it is not nil. It returns nil once the source is
+// exhausted, the context error if ctx is done first, or the error of the
+// source. Items that fail again do not stop it; Progress tells how many
+// did.
+func (r *Replayer) Replay(ctx context.Context, target *Consumer, rate ratelimit.Limiter) error {
+	for {
+		item, err := r.next(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&r.read, 1)
+
+		data := item.Data
+		if r.Fixup != nil {
+			var ok bool
+			if data, ok = r.Fixup(item); !ok {
+				atomic.AddUint64(&r.skipped, 1)
+				continue
+			}
+		}
+
+		if rate != nil {
+			if err := rate.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		err = target.Process(ctx, data)
+		if err == nil {
+			atomic.AddUint64(&r.succeeded, 1)
+			continue
+		}
+		atomic.AddUint64(&r.failed, 1)
+
+		if r.Refailed != nil {
+			select {
+			case r.Refailed <- FailedItem{Data: data, Err: err, Attempts: item.Attempts + 1}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Progress returns what the Replayer did so far. It may be called while
+// Replay runs.
+func (r *Replayer) Progress() ReplayProgress {
+	return ReplayProgress{
+		Read:      atomic.LoadUint64(&r.read),
+		Succeeded: atomic.LoadUint64(&r.succeeded),
+		Failed:    atomic.LoadUint64(&r.failed),
+		Skipped:   atomic.LoadUint64(&r.skipped),
+	}
+}
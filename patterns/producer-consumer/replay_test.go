@@ -0,0 +1,240 @@
+package producerconsumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+	"github.com/Alan-333333/go-channel-patterns/patterns/retry"
+	"github.com/stretchr/testify/require"
+)
+
+// job fails while broken is set.
+type job struct {
+	ID     int
+	Broken bool
+}
+
+var errBroken = errors.New("broken job")
+
+// jobConsumer returns a consumer failing broken jobs and recording the
+// others.
+func jobConsumer(done *[]int) *Consumer {
+	var mu sync.Mutex
+	c := NewConsumer(8, 1)
+	c.ConsumeFunc = func(data interface{}) error {
+		j := data.(job)
+		if j.Broken {
+			return errBroken
+		}
+		mu.Lock()
+		*done = append(*done, j.ID)
+		mu.Unlock()
+		return nil
+	}
+	return c
+}
+
+// countingLimiter admits every event and counts the waits.
+type countingLimiter struct {
+	waits int
+}
+
+func (l *countingLimiter) Allow() bool     { return true }
+func (l *countingLimiter) AllowN(int) bool { return true }
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.waits++
+	return ctx.Err()
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+
+	// 第一次消费时失败的数据进入死信队列
+	var done []int
+	c := jobConsumer(&done)
+	out := make(chan result.Result[interface{}], 8)
+	c.SetOut(out)
+
+	for i := 0; i < 6; i++ {
+		c.Buffer <- job{ID: i, Broken: i%2 == 1}
+	}
+	c.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	c.runProc(context.Background(), &wg)
+	close(out)
+
+	dlq := make(chan FailedItem, 8)
+	for r := range out {
+		if r.Err != nil {
+			dlq <- FailedItem{Data: r.Value, Err: r.Err, Attempts: 1}
+		}
+	}
+	close(dlq)
+	require.Equal(t, []int{0, 2, 4}, done)
+
+	// 修复后重放,全部消费成功
+	r := NewReplayer(dlq)
+	r.SetFixup(func(item FailedItem) (interface{}, bool) {
+		j := item.Data.(job)
+		j.Broken = false
+		return j, true
+	})
+
+	target := jobConsumer(&done)
+	limiter := &countingLimiter{}
+	require.NoError(t, r.Replay(context.Background(), target, limiter))
+
+	require.Equal(t, []int{0, 2, 4, 1, 3, 5}, done)
+	require.Equal(t, ReplayProgress{Read: 3, Succeeded: 3}, r.Progress())
+	require.Equal(t, 3, limiter.waits)
+}
+
+func TestDeadLetter(t *testing.T) {
+
+	// 重试用尽后失败的数据带着最后的错误和次数进入死信队列
+	var done []int
+	var errs []error
+	c := jobConsumer(&done)
+	c.Notify(func(string) {})
+	c.SetRetryPolicy(retry.Policy{MaxAttempts: 3})
+	c.HandleError(func(err error) { errs = append(errs, err) })
+	dlq := make(chan FailedItem, 8)
+	c.SetDeadLetter(dlq)
+
+	for i := 0; i < 6; i++ {
+		c.Buffer <- job{ID: i, Broken: i%2 == 1}
+	}
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+	close(dlq)
+
+	var dead []FailedItem
+	for item := range dlq {
+		dead = append(dead, item)
+	}
+	require.Len(t, dead, 3)
+	for i, item := range dead {
+		require.Equal(t, job{ID: 2*i + 1, Broken: true}, item.Data)
+		require.ErrorIs(t, item.Err, errBroken)
+		require.Equal(t, 3, item.Attempts)
+	}
+
+	// 错误处理仍然收到每个失败的错误
+	require.Len(t, errs, 3)
+	require.Equal(t, []int{0, 2, 4}, done)
+	require.Zero(t, c.Stats().DeadLetterDropped)
+}
+
+func TestDeadLetterFull(t *testing.T) {
+
+	// 死信队列满时不阻塞,丢弃并计数
+	var done []int
+	c := jobConsumer(&done)
+	c.Notify(func(string) {})
+	dlq := make(chan FailedItem, 1)
+	c.SetDeadLetter(dlq)
+
+	for i := 0; i < 3; i++ {
+		c.Buffer <- job{ID: i, Broken: true}
+	}
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+
+	require.Equal(t, FailedItem{Data: job{ID: 0, Broken: true}, Err: errBroken, Attempts: 1}, <-dlq)
+	require.Equal(t, uint64(2), c.Stats().DeadLetterDropped)
+	require.Equal(t, uint64(3), c.Stats().Failed)
+}
+
+func TestReplayRefailed(t *testing.T) {
+
+	// 再次失败的数据单独计数,并带着新的错误和次数发送到 Refailed
+	dlq := make(chan FailedItem, 3)
+	dlq <- FailedItem{Data: job{ID: 1, Broken: true}, Err: errBroken, Attempts: 3}
+	dlq <- FailedItem{Data: job{ID: 2}, Err: errBroken, Attempts: 1}
+	dlq <- FailedItem{Data: job{ID: 3}, Err: errBroken, Attempts: 1}
+	close(dlq)
+
+	var errs []error
+	var done []int
+	target := jobConsumer(&done)
+	target.HandleError(func(err error) { errs = append(errs, err) })
+
+	refailed := make(chan FailedItem, 3)
+	r := NewReplayer(dlq)
+	r.SetRefailed(refailed)
+
+	// 修复函数可以跳过数据
+	r.SetFixup(func(item FailedItem) (interface{}, bool) {
+		return item.Data, item.Data.(job).ID != 3
+	})
+
+	require.NoError(t, r.Replay(context.Background(), target, nil))
+	require.Equal(t, ReplayProgress{Read: 3, Succeeded: 1, Failed: 1, Skipped: 1}, r.Progress())
+	require.Equal(t, []int{2}, done)
+	require.Len(t, errs, 1)
+
+	close(refailed)
+	item := <-refailed
+	require.Equal(t, job{ID: 1, Broken: true}, item.Data)
+	require.ErrorIs(t, item.Err, errBroken)
+	require.Equal(t, 4, item.Attempts)
+}
+
+func TestReplayCancel(t *testing.T) {
+
+	// 取消后停止重放,进度反映已处理的数据
+	dlq := make(chan FailedItem, 1)
+	dlq <- FailedItem{Data: job{ID: 1}}
+
+	var done []int
+	ctx, cancel := context.WithCancel(context.Background())
+	target := jobConsumer(&done)
+	target.ConsumeFunc = func(interface{}) error {
+		cancel()
+		return nil
+	}
+
+	r := NewReplayer(dlq)
+	err := r.Replay(ctx, target, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, ReplayProgress{Read: 1, Succeeded: 1}, r.Progress())
+}
+
+func TestReaderReplayer(t *testing.T) {
+
+	// 从死信文件中解码数据重放
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, enc.Encode(job{ID: i}))
+	}
+
+	dec := json.NewDecoder(&buf)
+	r := NewReaderReplayer(&buf, func(io.Reader) (FailedItem, error) {
+		var j job
+		if err := dec.Decode(&j); err != nil {
+			return FailedItem{}, err
+		}
+		return FailedItem{Data: j, Attempts: 1}, nil
+	})
+
+	var done []int
+	require.NoError(t, r.Replay(context.Background(), jobConsumer(&done), nil))
+	require.Equal(t, []int{0, 1, 2}, done)
+
+	// 解码错误中止重放
+	r = NewReaderReplayer(bytes.NewBufferString("{"), func(r io.Reader) (FailedItem, error) {
+		var j job
+		err := json.NewDecoder(r).Decode(&j)
+		return FailedItem{Data: j}, err
+	})
+	err := r.Replay(context.Background(), jobConsumer(&done), nil)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,89 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+)
+
+// redelivery is an item of a Consumer waiting to be delivered again.
+type redelivery[T any] struct {
+	data T
+
+	// deliveries counts the times the item failed and was requeued.
+	deliveries int
+
+	// attempts counts the calls to ConsumeFunc made for it so far.
+	attempts int
+}
+
+// redeliveries holds the items a Consumer requeued. The processing
+// goroutines take them before reading their input, so they go first.
+type redeliveries[T any] struct {
+	mu    sync.Mutex
+	items []redelivery[T]
+}
+
+// push queues r.
+func (q *redeliveries[T]) push(r redelivery[T]) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = append(q.items, r)
+}
+
+// pop takes the oldest item. The second return value is false if there
+// is none.
+func (q *redeliveries[T]) pop() (redelivery[T], bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return redelivery[T]{}, false
+	}
+	r := q.items[0]
+	q.items[0] = redelivery[T]{}
+	q.items = q.items[1:]
+	return r, true
+}
+
+// len returns the number of items waiting.
+func (q *redeliveries[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// requeue queues data, a failed item read by a processing goroutine, to
+// be delivered again, unless it failed MaxRedeliveries times already or
+// MaxRedeliveries is not set. It reports whether it did. The caller began
+// the item in Stats.
+func (c *ConsumerOf[T]) requeue(ctx context.Context, data T, item *handoffItem) bool {
+	if !item.requeue || c.MaxRedeliveries <= 0 {
+		return false
+	}
+
+	// A cancelled item did not fail, so it does not count
+	deliveries := item.deliveries
+	if ctx.Err() == nil {
+		if deliveries >= c.MaxRedeliveries {
+			return false
+		}
+		deliveries++
+	}
+
+	// Let the item be processed again
+	if c.Dedup != nil {
+		c.Dedup.Forget(payload(data))
+	}
+	c.stats.abandon()
+	c.redeliver(redelivery[T]{data: data, deliveries: deliveries, attempts: item.attempts})
+	return true
+}
+
+// redeliver queues r to be delivered again.
+func (c *ConsumerOf[T]) redeliver(r redelivery[T]) {
+	c.redelivery.push(r)
+	c.requeued.Add(1)
+	c.emit(ItemRequeued, r.data)
+}
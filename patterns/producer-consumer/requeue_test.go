@@ -0,0 +1,114 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequeueCancelled(t *testing.T) {
+
+	// 处理中取消的数据回到消费者,下一次 Run 可以处理
+	c := NewConsumer(10, 2)
+	c.Notify(func(string) {})
+	c.MaxRedeliveries = 1
+	started := make(chan struct{}, 2)
+	c.ConsumeCtxFunc = func(ctx context.Context, data interface{}) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	for i := 0; i < 5; i++ {
+		c.Buffer <- i
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	<-started
+	<-started
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	// 没有数据丢失,也没有算作失败
+	s := c.Stats()
+	require.Equal(t, 5, s.Buffered)
+	require.Equal(t, uint64(2), s.Requeued)
+	require.Zero(t, s.Processed)
+	require.Zero(t, s.Active)
+
+	// 再次运行时全部处理,取消的数据先处理
+	var mu sync.Mutex
+	var got []interface{}
+	c.ConsumeCtxFunc = func(ctx context.Context, data interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, data)
+		return nil
+	}
+	c.NumProcs = 1
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+	require.ElementsMatch(t, []interface{}{0, 1, 2, 3, 4}, got)
+	require.ElementsMatch(t, []interface{}{0, 1}, got[:2])
+	require.Equal(t, uint64(5), c.Stats().Processed)
+	require.Zero(t, c.Stats().Buffered)
+}
+
+func TestRequeueLimit(t *testing.T) {
+
+	// 失败的数据重新投递,超过次数后进入错误处理和死信队列
+	errFail := errors.New("fail")
+	c := NewConsumer(1, 1)
+	c.Notify(func(string) {})
+	c.MaxRedeliveries = 2
+	calls := map[interface{}]int{}
+	c.ConsumeFunc = func(data interface{}) error {
+		calls[data]++
+		if data == "bad" || calls[data] == 1 {
+			return errFail
+		}
+		return nil
+	}
+	var handled []interface{}
+	c.SetItemErrHandler(func(data interface{}, err error) { handled = append(handled, data) })
+	dlq := make(chan FailedItem, 1)
+	c.SetDeadLetter(dlq)
+	var requeued []interface{}
+	c.SetEventHandler(func(e Event) {
+		if e.Kind == ItemRequeued {
+			requeued = append(requeued, e.Payload)
+		}
+	})
+
+	// 缓冲满时重新投递不阻塞
+	c.Buffer <- "bad"
+	go func() {
+		c.Buffer <- "flaky"
+		c.Close()
+	}()
+	done := make(chan error)
+	go func() { done <- c.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run blocked requeueing to a full Buffer")
+	}
+
+	require.Equal(t, 3, calls["bad"])
+	require.Equal(t, 2, calls["flaky"])
+	require.Equal(t, []interface{}{"bad"}, handled)
+	require.Equal(t, []interface{}{"bad", "bad", "flaky"}, requeued)
+	failed := <-dlq
+	require.Equal(t, "bad", failed.Data)
+	require.Equal(t, 3, failed.Attempts)
+	s := c.Stats()
+	require.Equal(t, uint64(2), s.Processed)
+	require.Equal(t, uint64(1), s.Failed)
+	require.Equal(t, uint64(3), s.Requeued)
+}
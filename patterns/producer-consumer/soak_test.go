@@ -0,0 +1,140 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	"github.com/Alan-333333/go-channel-patterns/patterns/testkit"
+)
+
+// TestSoak 在随机负载下运行生产者和消费者,检查数据守恒:
+// 生产的数据要么被消费,要么被队列丢弃。-short 时跳过,
+// TESTKIT_DURATION 设置运行时长,TESTKIT_SEED 重放。
+func TestSoak(t *testing.T) {
+	r := testkit.New()
+
+	// 工作负载随机地往 feed 送数据,生产者从 feed 取
+	feed := make(chan int)
+	stop := make(chan struct{})
+	var fed atomic.Uint64
+
+	const producers = 3
+	p := NewProducer(0, producers)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		select {
+		case v := <-feed:
+			return v, nil
+		case <-stop:
+			return nil, nil
+		}
+	}
+
+	// 队列满时丢弃最旧的数据,记下丢弃数
+	q := queue.New[interface{}](16, queue.WithPolicy(queue.DropOldest))
+	p.SetQueue(q)
+
+	// 消费者随机变慢或失败
+	var mu sync.Mutex
+	rnd := rand.New(rand.NewSource(r.Seed()))
+	c := NewConsumer(0, 4)
+	c.SetQueue(q)
+	c.Notify(func(string) {})
+	c.HandleError(func(error) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		delay := time.Duration(rnd.Intn(200)) * time.Microsecond
+		fail := rnd.Intn(20) == 0
+		mu.Unlock()
+
+		time.Sleep(delay)
+		if fail {
+			return errors.New("random failure")
+		}
+		return nil
+	}
+
+	producerDone := make(chan struct{})
+	consumerDone := make(chan struct{})
+	r.Start(func(ctx context.Context) error {
+		go func() {
+			defer close(producerDone)
+			p.Run(ctx)
+		}()
+		go func() {
+			defer close(consumerDone)
+			c.Run(ctx)
+		}()
+		return nil
+	})
+
+	// 突发或稀疏地送数据
+	r.Workload("feed", 4, func(ctx context.Context, rnd *rand.Rand) error {
+		for i := rnd.Intn(32); i >= 0; i-- {
+			select {
+			case feed <- i:
+				fed.Add(1)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		time.Sleep(time.Duration(rnd.Intn(2000)) * time.Microsecond)
+		return nil
+	})
+
+	// 先读下游再读上游,下游的数不会超过上游
+	r.Observe("consumer", func() interface{} { return c.Stats() })
+	r.Observe("queue", func() interface{} { return q.Stats() })
+	r.Observe("producer", func() interface{} { return p.Stats() })
+	r.Observe("fed", func() interface{} { return fed.Load() })
+
+	r.Invariant("consumed + dropped <= produced", func(s testkit.Snapshot) error {
+		consumed := s["consumer"].(ConsumerStats).Processed
+		dropped := s["queue"].(queue.Stats).Evicted
+		produced := s["producer"].(ProducerStats).Produced
+
+		// 生产 goroutine 写入队列后才计数
+		if consumed+dropped > produced+producers {
+			return fmt.Errorf("consumed %d + dropped %d > produced %d", consumed, dropped, produced)
+		}
+		return nil
+	})
+	r.Invariant("nothing rejected", func(s testkit.Snapshot) error {
+		if n := s["queue"].(queue.Stats).Rejected; n != 0 {
+			return fmt.Errorf("%d pushes rejected", n)
+		}
+		return nil
+	})
+
+	// 停止生产,关闭队列,等消费者取完
+	r.Drain(func(ctx context.Context) error {
+		close(stop)
+		<-producerDone
+		p.Close()
+		<-consumerDone
+		return nil
+	})
+
+	r.Final("consumed + dropped == produced == fed", func(s testkit.Snapshot) error {
+		consumed := s["consumer"].(ConsumerStats).Processed
+		dropped := s["queue"].(queue.Stats).Evicted
+		produced := s["producer"].(ProducerStats).Produced
+		if consumed+dropped != produced || produced != s["fed"].(uint64) {
+			return fmt.Errorf("fed %d, produced %d, consumed %d, dropped %d",
+				s["fed"], produced, consumed, dropped)
+		}
+		if produced == 0 {
+			return errors.New("nothing produced")
+		}
+		return nil
+	})
+
+	r.RunT(t)
+}
@@ -0,0 +1,274 @@
+package producerconsumer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	"github.com/Alan-333333/go-channel-patterns/patterns/signal"
+)
+
+// State is what a Producer or Consumer is doing.
+type State int
+
+const (
+	// StateIdle is before Run, and after it returned unless stopped.
+	StateIdle State = iota
+
+	// StateRunning is while goroutines of Run are running.
+	StateRunning
+
+	// StatePaused is between Pause and Resume, running or not.
+	StatePaused
+
+	// StateStopped is after Stop.
+	StateStopped
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRunning:
+		return "running"
+	case StatePaused:
+		return "paused"
+	case StateStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// ProducerStats is a snapshot of a Producer's progress.
+type ProducerStats struct {
+
+	// State is what the Producer is doing.
+	State State
+
+	// Workers is the number of goroutines of Run running now.
+	Workers int
+
+	// Produced counts the items written to Buffer or Queue.
+	Produced uint64
+
+	// Buffered is the number of items waiting in Buffer or Queue, and
+	// BufferCap how many it holds, or 0 for a Queue that does not tell.
+	Buffered  int
+	BufferCap int
+
+	// BufferedBytes is the size of the items waiting in Queue, and
+	// PeakBufferedBytes the highest it reached, for a Queue with a byte
+	// budget such as one made by queue.NewSized.
+	BufferedBytes     int
+	PeakBufferedBytes int
+
+	// Failed counts the errors ProduceFunc returned, other than ErrDone
+	// and ErrStopProduce.
+	Failed uint64
+
+	// Expired counts the items dropped because they outlived ItemTTL.
+	Expired uint64
+
+	// Dropped counts the items dropped because Buffer or the out channel
+	// of Inject was full.
+	Dropped uint64
+
+	// Backpressure counts the times Run found Buffer full and backed off,
+	// with the default OverflowBackpressure.
+	Backpressure uint64
+
+	// Panics counts the calls to ProduceFunc that panicked.
+	Panics uint64
+
+	// ThrottleDelay is the delay Throttle makes Run wait between items
+	// now.
+	ThrottleDelay time.Duration
+
+	// LastItem is when the latest item was written. It is zero before the
+	// first one.
+	LastItem time.Time
+}
+
+// ConsumerStats is a snapshot of a Consumer's progress.
+type ConsumerStats struct {
+
+	// State is what the Consumer is doing.
+	State State
+
+	// Workers is the number of processing goroutines running now.
+	Workers int
+
+	// Processed counts the items Process finished, failed or not.
+	Processed uint64
+
+	// Failed counts the processed items that returned an error.
+	Failed uint64
+
+	// Active is the number of items being processed now.
+	Active int
+
+	// Buffered is the number of items waiting in Buffer or Queue, and
+	// BufferCap how many it holds, or 0 for a Queue that does not tell.
+	Buffered  int
+	BufferCap int
+
+	// DuplicatesSkipped counts the items Dedup skipped. They are not
+	// counted as processed.
+	DuplicatesSkipped uint64
+
+	// Pending is the number of items handed off with a Pending handle
+	// that is not settled yet.
+	Pending int
+
+	// DeadLetterDropped counts the failed items dropped because
+	// DeadLetter was full.
+	DeadLetterDropped uint64
+
+	// Requeued counts the items requeued for MaxRedeliveries.
+	Requeued uint64
+
+	// Panics counts the calls to ConsumeFunc, ConsumeCtxFunc or
+	// ConsumeBatchFunc that panicked.
+	Panics uint64
+
+	// LastItem is when the latest item finished processing. It is zero
+	// before the first one.
+	LastItem time.Time
+}
+
+// Stats returns a snapshot of the producer's progress. It reads atomics,
+// so it can be called at any time.
+func (p *ProducerOf[T]) Stats() ProducerStats {
+	bytes, peak := bufferedBytes(p.Queue)
+	workers := int(p.workers.Load())
+	return ProducerStats{
+		State:             state(&p.stopped, &p.pause, workers),
+		Workers:           workers,
+		BufferedBytes:     bytes,
+		PeakBufferedBytes: peak,
+		Produced:          p.stats.done.Load(),
+		Buffered:          buffered(p.Buffer, p.Queue),
+		BufferCap:         bufferCap(p.Buffer, p.Queue),
+		Failed:            p.failed.Load(),
+		Expired:           p.expired.Load(),
+		Dropped:           p.dropped.Load(),
+		Backpressure:      p.backpressure.Load(),
+		Panics:            p.panics.Load(),
+		ThrottleDelay:     time.Duration(p.throttling.delay.Load()),
+		LastItem:          p.stats.lastItem(),
+	}
+}
+
+// Stats returns a snapshot of the consumer's progress. It reads atomics,
+// so it can be called at any time.
+func (c *ConsumerOf[T]) Stats() ConsumerStats {
+	workers := int(c.workers.Load())
+	return ConsumerStats{
+		State:             state(&c.stopped, &c.pause, workers),
+		Workers:           workers,
+		Processed:         c.stats.done.Load(),
+		Failed:            c.stats.failed.Load(),
+		Active:            int(c.stats.active.Load()),
+		Buffered:          buffered(c.Buffer, c.Queue) + c.redelivery.len(),
+		BufferCap:         bufferCap(c.Buffer, c.Queue),
+		Requeued:          c.requeued.Load(),
+		Panics:            c.panics.Load(),
+		Pending:           c.handoff.pending(),
+		LastItem:          c.stats.lastItem(),
+		DuplicatesSkipped: c.duplicates.Load(),
+		DeadLetterDropped: c.deadLetterDropped.Load(),
+	}
+}
+
+// progress counts the items a Producer or Consumer handled.
+type progress struct {
+	done   atomic.Uint64
+	failed atomic.Uint64
+	active atomic.Int64
+	last   atomic.Int64 // Unix nanoseconds of the latest item
+}
+
+// add records an item handled now.
+func (s *progress) add() {
+	s.last.Store(time.Now().UnixNano())
+	s.done.Add(1)
+}
+
+// begin records an item being started.
+func (s *progress) begin() {
+	s.active.Add(1)
+}
+
+// abandon records an item started by begin that will be started again.
+func (s *progress) abandon() {
+	s.active.Add(-1)
+}
+
+// end records an item started by begin finishing with err.
+func (s *progress) end(err error) {
+	if err != nil {
+		s.failed.Add(1)
+	}
+	s.add()
+	s.active.Add(-1)
+}
+
+// lastItem returns when the latest item was handled.
+func (s *progress) lastItem() time.Time {
+	if n := s.last.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// bufferedBytes returns the bytes waiting in q and their peak, if q tells
+// them.
+func bufferedBytes[T any](q QueueOf[T]) (int, int) {
+	if s, ok := q.(interface{ Stats() queue.Stats }); ok {
+		stats := s.Stats()
+		return stats.Bytes, stats.PeakBytes
+	}
+	return 0, 0
+}
+
+// buffered returns the items waiting in q if set, which may tell its
+// length, or else in buffer.
+func buffered[T any](buffer chan T, q QueueOf[T]) int {
+	if q == nil {
+		return len(buffer)
+	}
+	if l, ok := q.(interface{ Len() int }); ok {
+		return l.Len()
+	}
+	return 0
+}
+
+// bufferCap returns the capacity of q if set, which may tell it, or else
+// of buffer.
+func bufferCap[T any](buffer chan T, q QueueOf[T]) int {
+	if q == nil {
+		return cap(buffer)
+	}
+	if c, ok := q.(interface{ Cap() int }); ok {
+		return c.Cap()
+	}
+	return 0
+}
+
+// state returns the State of a Producer or Consumer stopped by stopped,
+// paused by pause, with workers goroutines running.
+func state(stopped *signal.Done, pause *pause, workers int) State {
+	switch {
+	case stopped.Reason() != nil:
+		return StateStopped
+	case pause.paused():
+		return StatePaused
+	case workers > 0:
+		return StateRunning
+	default:
+		return StateIdle
+	}
+}
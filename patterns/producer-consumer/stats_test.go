@@ -0,0 +1,168 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/signal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerStats(t *testing.T) {
+
+	c := NewConsumer(4, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		if data == "bad" {
+			return errors.New("bad item")
+		}
+		return nil
+	}
+
+	// 处理前只有缓冲中的数据
+	c.Buffer <- "good"
+	c.Buffer <- "bad"
+	require.Equal(t, ConsumerStats{Buffered: 2, BufferCap: 4}, c.Stats())
+
+	// 处理后统计成功和失败的数量
+	c.Close()
+	c.Run(context.Background())
+	s := c.Stats()
+	require.Equal(t, uint64(2), s.Processed)
+	require.Equal(t, uint64(1), s.Failed)
+	require.Zero(t, s.Active)
+	require.Zero(t, s.Buffered)
+	require.False(t, s.LastItem.IsZero())
+}
+
+func TestPipelineStats(t *testing.T) {
+
+	// 每 5 次生产失败一次
+	var calls atomic.Int64
+	p := NewProducer(8, 2)
+	p.Notify(func(string) {})
+	p.ProduceFunc = func() (interface{}, error) {
+		n := calls.Add(1)
+		if n%5 == 0 {
+			return nil, errors.New("produce failed")
+		}
+		return n, nil
+	}
+
+	// 消费者读生产者的缓冲,处理 10 个后停止,3 的倍数处理失败
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.Buffer = p.Buffer
+	c.ConsumeFunc = func(data interface{}) error {
+		time.Sleep(time.Millisecond)
+		if c.Stats().Processed >= 10 {
+			c.Stop(nil)
+		}
+		if data.(int64)%3 == 0 {
+			return errors.New("consume failed")
+		}
+		return nil
+	}
+
+	// 运行中并发读取统计
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				p.Stats()
+				c.Stats()
+			}
+		}
+	}()
+
+	go p.Run(context.Background())
+	c.Run(context.Background())
+	p.Stop(nil)
+	close(done)
+	<-sampled
+
+	// 生产的数量等于处理的数量加缓冲中剩余的数量
+	ps, cs := p.Stats(), c.Stats()
+	require.Equal(t, ps.Produced, cs.Processed+uint64(ps.Buffered))
+	require.GreaterOrEqual(t, cs.Processed, uint64(10))
+	require.NotZero(t, cs.Failed)
+	require.NotZero(t, ps.Failed)
+	require.NotZero(t, ps.Backpressure)
+	require.Zero(t, ps.Dropped)
+}
+
+func TestStatsState(t *testing.T) {
+
+	// 运行前空闲,缓冲容量来自 Buffer
+	p := NewProducer(8, 3)
+	p.Notify(func(string) {})
+	c := NewConsumer(0, 2)
+	c.Notify(func(string) {})
+	c.Buffer = p.Buffer
+	require.Equal(t, StateIdle, p.Stats().State)
+	require.Equal(t, 8, p.Stats().BufferCap)
+	require.Equal(t, 8, c.Stats().BufferCap)
+
+	release := make(chan struct{})
+	p.ProduceFunc = func() (interface{}, error) {
+		<-release
+		return nil, ErrDone
+	}
+	c.ConsumeFunc = func(interface{}) error { return nil }
+
+	// 运行中统计 goroutine 数量,同时并发读取
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pDone := make(chan error)
+	cDone := make(chan error)
+	go func() { pDone <- p.Run(ctx) }()
+	go func() { cDone <- c.Run(ctx) }()
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				p.Stats()
+				c.Stats()
+			}
+		}
+	}()
+	require.Eventually(t, func() bool {
+		return p.Stats().Workers == 3 && c.Stats().Workers == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, StateRunning, p.Stats().State)
+	require.Equal(t, StateRunning, c.Stats().State)
+
+	// 暂停
+	c.Pause()
+	require.Equal(t, StatePaused, c.Stats().State)
+	c.Resume()
+	require.Equal(t, StateRunning, c.Stats().State)
+
+	// 生产完后 goroutine 退出,回到空闲
+	close(release)
+	require.NoError(t, <-pDone)
+	require.Zero(t, p.Stats().Workers)
+	require.Equal(t, StateIdle, p.Stats().State)
+
+	// 停止
+	c.Stop(nil)
+	require.ErrorIs(t, <-cDone, signal.ErrClosed)
+	close(stop)
+	<-sampled
+	require.Zero(t, c.Stats().Workers)
+	require.Equal(t, StateStopped, c.Stats().State)
+	require.Equal(t, "stopped", c.Stats().State.String())
+}
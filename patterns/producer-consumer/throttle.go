@@ -0,0 +1,140 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+)
+
+// Throttle makes the goroutines of Run wait between items for a delay
+// following how far the consumer lags behind, measured by Inject as the
+// occupancy of its out channel, the share of its capacity holding items.
+//
+// Inject averages the occupancy over each Interval. While the average is
+// above Threshold, the delay is multiplied by Multiplier, starting from
+// Initial, up to Max. Below, it shrinks in proportion to the average, so
+// an empty out channel removes it. An unbuffered out channel is not
+// measured.
+type Throttle struct {
+
+	// Threshold is an occupancy between 0 and 1. It defaults to 0.5.
+	Threshold float64
+
+	// Initial is the first delay, and the smallest one kept. It defaults
+	// to a millisecond.
+	Initial time.Duration
+
+	// Max caps the delay. It defaults to a second.
+	Max time.Duration
+
+	// Multiplier grows the delay. It defaults to 2.
+	Multiplier float64
+
+	// Interval is the time averaged over. It defaults to 100ms.
+	Interval time.Duration
+}
+
+// throttling is the state of Throttle in a Producer.
+type throttling struct {
+
+	// delay is the current delay in nanoseconds.
+	delay atomic.Int64
+
+	mu sync.Mutex
+
+	// start is when the interval began, and sum the n samples taken
+	// since.
+	start time.Time
+	sum   float64
+	n     int
+}
+
+// adjust returns the delay following delay for an average occupancy.
+func (t *Throttle) adjust(delay time.Duration, occupancy float64) time.Duration {
+	threshold := t.Threshold
+	if threshold <= 0 {
+		threshold = 0.5
+	}
+	initial := t.Initial
+	if initial <= 0 {
+		initial = time.Millisecond
+	}
+	limit := t.Max
+	if limit <= 0 {
+		limit = time.Second
+	}
+	multiplier := t.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+
+	// Back off exponentially while the consumer lags
+	if occupancy > threshold {
+		if delay < initial {
+			return initial
+		}
+		d := float64(delay) * multiplier
+		if d > float64(limit) {
+			return limit
+		}
+		return time.Duration(d)
+	}
+
+	// Speed up in proportion while it keeps up
+	d := time.Duration(float64(delay) * occupancy / threshold)
+	if d < initial {
+		return 0
+	}
+	return d
+}
+
+// sample adds the occupancy of out, about to be written by Inject, to the
+// interval, and adjusts the delay once the interval is over.
+func (p *ProducerOf[T]) sample(out chan T) {
+	t := p.Throttle
+	if t == nil || cap(out) == 0 {
+		return
+	}
+	interval := t.Interval
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	s := &p.throttling
+	s.mu.Lock()
+	now := time.Now()
+	if s.start.IsZero() {
+		s.start = now
+	}
+	s.sum += float64(len(out)) / float64(cap(out))
+	s.n++
+	if now.Sub(s.start) < interval {
+		s.mu.Unlock()
+		return
+	}
+
+	// Start the next interval
+	occupancy := s.sum / float64(s.n)
+	s.start, s.sum, s.n = now, 0, 0
+	old := time.Duration(s.delay.Load())
+	d := t.adjust(old, occupancy)
+	s.delay.Store(int64(d))
+	s.mu.Unlock()
+
+	if d != old {
+		p.emit(ThrottleAdjusted, d)
+	}
+}
+
+// throttle waits for the current delay. It returns false if ctx is done
+// first.
+func (p *ProducerOf[T]) throttle(ctx context.Context) bool {
+	d := time.Duration(p.throttling.delay.Load())
+	if d <= 0 {
+		return true
+	}
+	return backoff.Sleep(ctx, d) == nil
+}
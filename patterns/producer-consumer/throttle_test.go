@@ -0,0 +1,88 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottleAdjust(t *testing.T) {
+	th := &Throttle{Threshold: 0.5, Initial: time.Millisecond, Max: 8 * time.Millisecond, Multiplier: 2}
+
+	// 超过阈值时从 Initial 开始翻倍,不超过 Max
+	require.Equal(t, time.Millisecond, th.adjust(0, 0.9))
+	require.Equal(t, 4*time.Millisecond, th.adjust(2*time.Millisecond, 0.9))
+	require.Equal(t, 8*time.Millisecond, th.adjust(8*time.Millisecond, 1))
+
+	// 低于阈值时按比例减小,小于 Initial 时归零
+	require.Equal(t, 4*time.Millisecond, th.adjust(8*time.Millisecond, 0.25))
+	require.Equal(t, time.Duration(0), th.adjust(8*time.Millisecond, 0))
+	require.Equal(t, time.Duration(0), th.adjust(time.Millisecond, 0.4))
+
+	// 默认值
+	require.Equal(t, time.Millisecond, (&Throttle{}).adjust(0, 0.6))
+	require.Equal(t, time.Second, (&Throttle{}).adjust(time.Second, 0.6))
+}
+
+func TestProducerThrottle(t *testing.T) {
+	p := NewProducer(10, 2)
+	p.Throttle = &Throttle{Threshold: 0.5, Initial: time.Millisecond, Max: 20 * time.Millisecond, Interval: 5 * time.Millisecond}
+	p.Overflow = OverflowDropNewest
+	p.ProduceFunc = func() (interface{}, error) {
+		return 1, nil
+	}
+	var mu sync.Mutex
+	var delays []time.Duration
+	p.SetEventHandler(func(e Event) {
+		if e.Kind == ThrottleAdjusted {
+			mu.Lock()
+			defer mu.Unlock()
+			delays = append(delays, e.Payload.(time.Duration))
+		}
+	})
+
+	// 消费者先很慢,out 保持写满
+	var slow atomic.Bool
+	slow.Store(true)
+	out := make(chan interface{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+	go p.Inject(ctx, out)
+	go func() {
+		for {
+			select {
+			case <-out:
+			case <-ctx.Done():
+				return
+			}
+			if slow.Load() {
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+	}()
+
+	// 延迟逐步增加到 Max
+	require.Eventually(t, func() bool {
+		return p.Stats().ThrottleDelay == 20*time.Millisecond
+	}, 2*time.Second, time.Millisecond)
+	mu.Lock()
+	require.Equal(t, time.Millisecond, delays[0])
+	for i := 1; i < len(delays); i++ {
+		require.Greater(t, delays[i], delays[i-1])
+	}
+	mu.Unlock()
+
+	// 消费者恢复后延迟减小直到归零
+	slow.Store(false)
+	require.Eventually(t, func() bool {
+		return p.Stats().ThrottleDelay == 0
+	}, 2*time.Second, time.Millisecond)
+	mu.Lock()
+	require.Equal(t, time.Duration(0), delays[len(delays)-1])
+	mu.Unlock()
+}
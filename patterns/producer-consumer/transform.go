@@ -0,0 +1,151 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+)
+
+// Transformer is a TransformerOf any items, which TransformFunc
+// type-asserts.
+type Transformer = TransformerOf[interface{}, interface{}]
+
+// TransformerOf is a pipeline stage between a producer and a consumer. It
+// controls a number of goroutines that read items of type In from Buffer,
+// transform them with TransformFunc and write the results to an output
+// channel, such as the Buffer of a Consumer:
+//
+//	go p.Inject(ctx, t.Buffer)
+//	go t.Inject(ctx, c.Buffer)
+//	c.Run(ctx)
+type TransformerOf[In, Out any] struct {
+
+	// Buffer is the buffered channel holding the items waiting to be
+	// transformed.
+	Buffer chan In
+
+	// NumProcs controls the number of goroutines that invoke
+	// TransformFunc concurrently.
+	NumProcs int
+
+	// TransformFunc turns an item into the one written to the output. An
+	// item it returns an error for goes to ErrHandler and is not written.
+	TransformFunc func(In) (Out, error)
+
+	// ErrHandler handles any errors returned by TransformFunc.
+	// If not set, errors will be ignored.
+	ErrHandler func(error)
+
+	// Notifier sends notifications about the transformer lifecycle.
+	// If not set, nothing is sent.
+	Notifier func(string)
+
+	// EventHandler receives the lifecycle events if set.
+	EventHandler EventHandler
+}
+
+// NewTransformer creates a new Transformer instance.
+// bufferSize controls the size of Buffer, and numProcs the number of
+// goroutines transforming items.
+func NewTransformer(bufferSize int, numProcs int) *Transformer {
+	return NewTransformerOf[interface{}, interface{}](bufferSize, numProcs)
+}
+
+// NewTransformerOf creates a Transformer from In to Out items, like
+// NewTransformer.
+func NewTransformerOf[In, Out any](bufferSize int, numProcs int) *TransformerOf[In, Out] {
+	return &TransformerOf[In, Out]{
+		Buffer:   make(chan In, bufferSize),
+		NumProcs: numProcs,
+	}
+}
+
+// Inject transforms the items of Buffer and writes them to out, waiting
+// while Buffer is empty or out is full, until the context is cancelled or
+// Buffer is closed and drained.
+//
+// Like Producer.Inject, it closes out once Buffer is closed and drained,
+// unless ctx is done first, so stages can be chained. out must not be
+// closed while Inject runs, and each out takes a single Inject.
+func (t *TransformerOf[In, Out]) Inject(ctx context.Context, out chan Out) {
+
+	var wg sync.WaitGroup
+	for i := 0; i < t.NumProcs; i++ {
+		wg.Add(1)
+		t.emit(TransformerStarted, nil)
+		go t.runProc(ctx, out, &wg)
+	}
+	wg.Wait()
+
+	// Closed and drained, nothing more for out
+	if ctx.Err() == nil {
+		close(out)
+	}
+}
+
+// Close closes Buffer, letting Inject return once it is drained.
+func (t *TransformerOf[In, Out]) Close() {
+	close(t.Buffer)
+}
+
+// HandleError sets the handler of the errors returned by TransformFunc.
+func (t *TransformerOf[In, Out]) HandleError(handler ErrHandler) {
+	t.ErrHandler = handler
+}
+
+// Notify sets a notifier function to receive lifecycle notifications.
+func (t *TransformerOf[In, Out]) Notify(notifier Notifier) {
+	t.Notifier = notifier
+}
+
+// sets the handler receiving the lifecycle events.
+func (t *TransformerOf[In, Out]) SetEventHandler(handler EventHandler) {
+	t.EventHandler = handler
+}
+
+// runProc runs in a goroutine to transform the items of Buffer.
+func (t *TransformerOf[In, Out]) runProc(ctx context.Context, out chan Out, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	for {
+		// Wait for data in the buffer
+		var data In
+		var ok bool
+		select {
+		case data, ok = <-t.Buffer:
+		case <-ctx.Done():
+			return
+		}
+		if !ok {
+			return
+		}
+
+		// Transform it, dropping the items that fail
+		result, err := t.TransformFunc(data)
+		if err != nil {
+			t.handleError(err)
+			continue
+		}
+
+		// Write the result to out
+		select {
+		case out <- result:
+			t.emit(ItemTransformed, result)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleError notifies the error and passes it to ErrHandler, if set.
+func (t *TransformerOf[In, Out]) handleError(err error) {
+	t.emit(TransformError, err)
+	if t.ErrHandler != nil {
+		t.ErrHandler(err)
+	}
+}
+
+// emit sends an event of kind to EventHandler and Notifier.
+func (t *TransformerOf[In, Out]) emit(kind EventKind, payload interface{}) {
+	emit(t.EventHandler, t.Notifier, kind, payload)
+}
@@ -0,0 +1,127 @@
+package producerconsumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformerPipeline(t *testing.T) {
+	const n = 200
+	ctx := context.Background()
+
+	// 生产者 -> 转换器 -> 消费者,阻塞写入,不丢数据
+	i := 0
+	var mu sync.Mutex
+	p := NewProducer(10, 1)
+	p.Notify(func(string) {})
+	p.Overflow = OverflowBlock
+	p.ProduceFunc = func() (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if i++; i > n {
+			return nil, ErrDone
+		}
+		return i, nil
+	}
+
+	calls := make(map[int]int)
+	tr := NewTransformer(10, 4)
+	tr.TransformFunc = func(data interface{}) (interface{}, error) {
+		mu.Lock()
+		calls[data.(int)]++
+		mu.Unlock()
+		return data.(int) * 10, nil
+	}
+
+	var got []int
+	c := NewConsumer(10, 4)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, data.(int))
+		return nil
+	}
+
+	go p.RunAndClose(ctx)
+	go p.Inject(ctx, tr.Buffer)
+	go tr.Inject(ctx, c.Buffer)
+	require.NoError(t, c.Run(ctx))
+
+	// 每个数据恰好转换一次,消费者收到全部转换结果
+	require.Len(t, calls, n)
+	for k, v := range calls {
+		require.Equal(t, 1, v, "item %d", k)
+	}
+	sort.Ints(got)
+	for k := range got {
+		require.Equal(t, (k+1)*10, got[k])
+	}
+	require.Len(t, got, n)
+}
+
+func TestTransformerError(t *testing.T) {
+	errOdd := errors.New("odd")
+
+	// 转换失败的数据交给错误处理,不写入输出
+	var errs []error
+	var events []string
+	tr := NewTransformerOf[int, string](10, 1)
+	tr.HandleError(func(err error) { errs = append(errs, err) })
+	tr.Notify(func(msg string) { events = append(events, msg) })
+	tr.TransformFunc = func(n int) (string, error) {
+		if n%2 == 1 {
+			return "", fmt.Errorf("item %d: %w", n, errOdd)
+		}
+		return strconv.Itoa(n), nil
+	}
+	for n := 0; n < 6; n++ {
+		tr.Buffer <- n
+	}
+	tr.Close()
+
+	out := make(chan string, 10)
+	tr.Inject(context.Background(), out)
+
+	// 输出在取完后关闭
+	var got []string
+	for s := range out {
+		got = append(got, s)
+	}
+	require.Equal(t, []string{"0", "2", "4"}, got)
+	require.Len(t, errs, 3)
+	require.ErrorIs(t, errs[0], errOdd)
+	require.Contains(t, events, "TransformerError")
+	require.Contains(t, events, "TransformFinished")
+}
+
+func TestTransformerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// ctx 取消时返回,不关闭输出
+	tr := NewTransformer(1, 2)
+	tr.TransformFunc = func(data interface{}) (interface{}, error) { return data, nil }
+	tr.Buffer <- 1
+	out := make(chan interface{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tr.Inject(ctx, out)
+	}()
+	cancel()
+	<-done
+
+	select {
+	case _, ok := <-out:
+		require.True(t, ok, "out should stay open")
+	default:
+	}
+}
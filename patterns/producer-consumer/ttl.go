@@ -0,0 +1,88 @@
+package producerconsumer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrItemExpired is returned by Consumer.Process for an item that waited
+// longer than the ItemTTL of its producer. The item is not consumed.
+var ErrItemExpired = errors.New("item expired")
+
+// ErrItemTTLUnsupported is returned by Run of a Producer with an ItemTTL
+// whose items cannot hold the stamped ones, such as a ProducerOf a
+// concrete type.
+var ErrItemTTLUnsupported = errors.New("ItemTTL needs interface{} items")
+
+// stamped is an item written by a Producer with an ItemTTL.
+type stamped struct {
+	data     interface{}
+	deadline time.Time
+
+	// expire reports data expired to its producer.
+	expire func(data interface{})
+}
+
+// stamp wraps data with its deadline if p has an ItemTTL and its items
+// can hold the wrapped one.
+func (p *ProducerOf[T]) stamp(data T) T {
+	if p.ItemTTL <= 0 {
+		return data
+	}
+	s := &stamped{
+		data:     data,
+		deadline: time.Now().Add(p.ItemTTL),
+		expire:   func(data interface{}) { p.expire(data.(T)) },
+	}
+	if wrapped, ok := any(s).(T); ok {
+		return wrapped
+	}
+	return data
+}
+
+// checkTTL returns an error wrapping ErrItemTTLUnsupported if ItemTTL is
+// set but stamp cannot wrap the items.
+func (p *ProducerOf[T]) checkTTL() error {
+	if p.ItemTTL <= 0 {
+		return nil
+	}
+	if _, ok := any(&stamped{}).(T); ok {
+		return nil
+	}
+	return fmt.Errorf("%w, not %v", ErrItemTTLUnsupported, reflect.TypeFor[T]())
+}
+
+// unstamp returns the item wrapped in data, or data itself if it is not
+// stamped. It reports false, and tells the producer, if the item expired.
+func unstamp[T any](data T) (T, bool) {
+	s, ok := any(data).(*stamped)
+	if !ok {
+		return data, true
+	}
+	if time.Now().After(s.deadline) {
+		s.expire(s.data)
+		var zero T
+		return zero, false
+	}
+	return s.data.(T), true
+}
+
+// Unwrap returns the item a Producer with an ItemTTL wrapped in data, or
+// data itself, without checking whether it expired. It lets code routing
+// items read from a Buffer, such as by key, look at them.
+func Unwrap(data interface{}) interface{} {
+	if s, ok := data.(*stamped); ok {
+		return s.data
+	}
+	return data
+}
+
+// expire counts data as expired and passes it to OnExpired.
+func (p *ProducerOf[T]) expire(data T) {
+	p.expired.Add(1)
+	if p.OnExpired != nil {
+		p.OnExpired(data)
+	}
+}
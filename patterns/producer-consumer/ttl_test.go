@@ -0,0 +1,139 @@
+package producerconsumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// produceN returns a ProduceFunc producing the given items, then stopping.
+func produceN(items ...interface{}) func() (interface{}, error) {
+	var mu sync.Mutex
+	return func() (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(items) == 0 {
+			return nil, nil
+		}
+		v := items[0]
+		items = items[1:]
+		return v, nil
+	}
+}
+
+func TestItemTTL(t *testing.T) {
+	var mu sync.Mutex
+	var expired, consumed []interface{}
+
+	p := NewProducer(0, 1)
+	p.Notify(func(string) {})
+	p.ProduceFunc = produceN(1, 2, 3, 4, 5)
+	p.ItemTTL = 50 * time.Millisecond
+	p.OnExpired = func(data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = append(expired, data)
+	}
+
+	// 消费者处理第一个数据时卡住,超过 TTL
+	c := NewConsumer(0, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		mu.Lock()
+		consumed = append(consumed, data)
+		mu.Unlock()
+		if data == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return nil
+	}
+
+	require.NoError(t, Connect(context.Background(), p, c, 16))
+
+	// 排队超时的数据不会交给 ConsumeFunc
+	require.Equal(t, []interface{}{1}, consumed)
+	require.Equal(t, []interface{}{2, 3, 4, 5}, expired)
+	require.Equal(t, uint64(5), p.Stats().Produced)
+	require.Equal(t, uint64(4), p.Stats().Expired)
+	require.Equal(t, uint64(1), c.Stats().Processed)
+}
+
+func TestItemTTLInject(t *testing.T) {
+	var expired []interface{}
+
+	p := NewProducerOf[interface{}](10, 1)
+	p.Notify(func(string) {})
+	p.ItemTTL = 20 * time.Millisecond
+	p.OnExpired = func(data interface{}) {
+		expired = append(expired, data)
+	}
+
+	// 数据在 Buffer 中等待超过 TTL
+	for _, v := range []string{"a", "b", "c"} {
+		p.Buffer <- p.stamp(v)
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	// 未超时的数据去掉包装后送出
+	p.Buffer <- p.stamp("d")
+	p.Close()
+
+	out := make(chan interface{}, 10)
+	p.Inject(context.Background(), out)
+	require.Equal(t, "d", <-out)
+	require.Empty(t, out)
+	require.Equal(t, []interface{}{"a", "b", "c"}, expired)
+	require.Equal(t, uint64(3), p.Stats().Expired)
+}
+
+func TestItemTTLProcess(t *testing.T) {
+	p := NewProducerOf[interface{}](1, 1)
+	p.ItemTTL = time.Millisecond
+	item := p.stamp("stale")
+	time.Sleep(5 * time.Millisecond)
+
+	called := false
+	c := NewConsumer(0, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error {
+		called = true
+		return nil
+	}
+
+	// Unwrap 只取出数据,不检查是否过期
+	require.Equal(t, "stale", Unwrap(item))
+	require.Equal(t, "plain", Unwrap("plain"))
+	require.Zero(t, p.Stats().Expired)
+
+	// Process 直接收到过期的数据也不消费
+	require.ErrorIs(t, c.Process(context.Background(), item), ErrItemExpired)
+	require.False(t, called)
+	require.Zero(t, c.Stats().Processed)
+	require.Equal(t, uint64(1), p.Stats().Expired)
+
+	// 没有 TTL 的数据照常消费
+	require.NoError(t, c.Process(context.Background(), "fresh"))
+	require.True(t, called)
+}
+
+func TestItemTTLUnsupported(t *testing.T) {
+
+	// 具体类型无法包装,Run 直接返回错误,不调用生产函数
+	p := NewProducerOf[int](10, 2)
+	p.ItemTTL = time.Second
+	p.ProduceFunc = func() (int, error) {
+		t.Error("ProduceFunc called")
+		return 0, ErrDone
+	}
+	err := p.Run(context.Background())
+	require.ErrorIs(t, err, ErrItemTTLUnsupported)
+	require.EqualError(t, err, "ItemTTL needs interface{} items, not int")
+
+	// 不设置 TTL 时照常运行
+	p.ItemTTL = 0
+	p.ProduceFunc = func() (int, error) { return 0, ErrDone }
+	require.NoError(t, p.Run(context.Background()))
+}
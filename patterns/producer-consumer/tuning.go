@@ -0,0 +1,90 @@
+package producerconsumer
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// Tuning trades latency for throughput in the loops of Producer, Inject
+// and Consumer moving items. The zero value keeps their default: one item
+// per wakeup, no yielding, and parking at once on an empty input or a full
+// buffer.
+type Tuning struct {
+
+	// MaxBatchDrain is the most items a goroutine takes from its input
+	// each time it wakes up, if above 1: after waiting for one item, it
+	// takes those already there without waiting, then handles them. It
+	// saves wakeups under load, while the taken items wait for the ones
+	// before them. Run of a Producer does not read items and ignores it.
+	MaxBatchDrain int
+
+	// YieldEvery makes a goroutine call runtime.Gosched after that many
+	// items, if positive, so busy loops do not starve other goroutines
+	// sharing their thread.
+	YieldEvery int
+
+	// SpinBeforePark is how long a goroutine keeps polling, yielding
+	// between polls, before parking on an empty input or, for Run of a
+	// Producer, backing off from a full Buffer. It saves the cost of
+	// waking up when items come back within that time, at the price of a
+	// busy processor.
+	SpinBeforePark time.Duration
+}
+
+// gosched is runtime.Gosched, replaced in tests.
+var gosched = runtime.Gosched
+
+// yielder counts the items of one goroutine for YieldEvery.
+type yielder struct {
+	every int
+	n     int
+}
+
+// item counts an item, yielding every YieldEvery of them.
+func (y *yielder) item() {
+	if y.every <= 0 {
+		return
+	}
+	y.n++
+	if y.n >= y.every {
+		y.n = 0
+		gosched()
+	}
+}
+
+// spin polls try until it succeeds, d passes or ctx is done.
+func spin[T any](ctx context.Context, d time.Duration, try func() (T, bool)) (T, bool) {
+	deadline := time.Now().Add(d)
+	for {
+		if data, ok := try(); ok {
+			return data, true
+		}
+		if ctx.Err() != nil || !time.Now().Before(deadline) {
+			var zero T
+			return zero, false
+		}
+		gosched()
+	}
+}
+
+// drainInto appends to held the items try takes without waiting, until it
+// holds max of them.
+func drainInto[T any](held []T, max int, try func() (T, bool)) []T {
+	for len(held) < max {
+		data, ok := try()
+		if !ok {
+			break
+		}
+		held = append(held, data)
+	}
+	return held
+}
+
+// spinWrite polls tryWrite until it succeeds, d passes or ctx is done.
+func spinWrite(ctx context.Context, d time.Duration, tryWrite func() bool) bool {
+	_, ok := spin(ctx, d, func() (struct{}, bool) {
+		return struct{}{}, tryWrite()
+	})
+	return ok
+}
@@ -0,0 +1,250 @@
+package producerconsumer
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	"github.com/stretchr/testify/require"
+)
+
+// countYields replaces gosched with a counter until the test ends.
+func countYields(t *testing.T) *atomic.Int32 {
+	var n atomic.Int32
+	gosched = func() { n.Add(1) }
+	t.Cleanup(func() { gosched = runtimeGosched })
+	return &n
+}
+
+var runtimeGosched = gosched
+
+func TestTuningMaxBatchDrain(t *testing.T) {
+	// 每个数据处理时记录输入中剩余的数量
+	run := func(drain int, q *queue.BoundedQueue[interface{}]) []int {
+		c := NewConsumer(10, 1)
+		c.Notify(func(string) {})
+		c.Tuning.MaxBatchDrain = drain
+		var left []int
+		c.ConsumeFunc = func(interface{}) error {
+			if q != nil {
+				left = append(left, q.Len())
+			} else {
+				left = append(left, len(c.Buffer))
+			}
+			return nil
+		}
+		for i := 0; i < 10; i++ {
+			if q != nil {
+				require.NoError(t, q.Push(context.Background(), i))
+			} else {
+				c.Buffer <- i
+			}
+		}
+		if q != nil {
+			c.SetQueue(q)
+			q.Close()
+		} else {
+			c.Close()
+		}
+		require.NoError(t, c.Run(context.Background()))
+		return left
+	}
+
+	// 默认每次唤醒取一个
+	require.Equal(t, []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}, run(0, nil))
+
+	// 每次唤醒最多取 MaxBatchDrain 个,再逐个处理
+	require.Equal(t, []int{6, 6, 6, 6, 2, 2, 2, 2, 0, 0}, run(4, nil))
+	require.Equal(t, []int{6, 6, 6, 6, 2, 2, 2, 2, 0, 0}, run(4, queue.New[interface{}](10)))
+}
+
+func TestTuningInjectDrain(t *testing.T) {
+	p := NewProducer(10, 1)
+	p.Tuning.MaxBatchDrain = 3
+	var left []int
+	p.Notify(func(string) { left = append(left, len(p.Buffer)) })
+	for i := 0; i < 7; i++ {
+		p.Buffer <- i
+	}
+	p.Close()
+
+	out := make(chan interface{}, 10)
+	p.Inject(context.Background(), out)
+
+	// Inject 同样每次唤醒最多取 MaxBatchDrain 个,全部转发
+	require.Equal(t, []int{4, 4, 4, 1, 1, 1, 0}, left)
+	var got []interface{}
+	for v := range out {
+		got = append(got, v)
+	}
+	require.Equal(t, []interface{}{0, 1, 2, 3, 4, 5, 6}, got)
+}
+
+func TestTuningYieldEvery(t *testing.T) {
+	yields := countYields(t)
+
+	// 消费者每 YieldEvery 个数据让出一次
+	c := NewConsumer(10, 1)
+	c.Notify(func(string) {})
+	c.Tuning.YieldEvery = 3
+	c.ConsumeFunc = func(interface{}) error { return nil }
+	for i := 0; i < 10; i++ {
+		c.Buffer <- i
+	}
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+	require.Equal(t, int32(3), yields.Load())
+
+	// 生产者同样按写入的数据计数
+	yields.Store(0)
+	n := 0
+	p := NewProducer(10, 1)
+	p.Notify(func(string) {})
+	p.Tuning.YieldEvery = 5
+	p.ProduceFunc = func() (interface{}, error) {
+		if n++; n > 10 {
+			return nil, ErrDone
+		}
+		return n, nil
+	}
+	require.NoError(t, p.Run(context.Background()))
+	require.Equal(t, int32(2), yields.Load())
+
+	// 默认不让出
+	yields.Store(0)
+	c = NewConsumer(10, 1)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(interface{}) error { return nil }
+	c.Buffer <- 1
+	c.Close()
+	require.NoError(t, c.Run(context.Background()))
+	require.Zero(t, yields.Load())
+}
+
+func TestTuningSpinBeforePark(t *testing.T) {
+	// 缓冲区满时先自旋,被取走后写入,不退避
+	run := func(spin time.Duration) ProducerStats {
+		n := 0
+		p := NewProducer(1, 1)
+		p.Notify(func(string) {})
+		p.Tuning.SpinBeforePark = spin
+		p.ProduceFunc = func() (interface{}, error) {
+			if n++; n > 2 {
+				return nil, ErrDone
+			}
+			return n, nil
+		}
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			<-p.Buffer
+		}()
+		require.NoError(t, p.Run(context.Background()))
+		return p.Stats()
+	}
+	require.Zero(t, run(time.Second).Backpressure)
+	require.NotZero(t, run(0).Backpressure)
+
+	// 数据在自旋期间到达时直接读取
+	c := NewConsumer(1, 1)
+	c.Tuning.SpinBeforePark = time.Second
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		c.Buffer <- "late"
+	}()
+	start := time.Now()
+	data, ok := c.readInput(context.Background())
+	require.True(t, ok)
+	require.Equal(t, "late", data)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// 自旋不超过 SpinBeforePark,ctx 结束时立即停止
+	start = time.Now()
+	_, ok = spin(context.Background(), 10*time.Millisecond, c.tryReadBuffer)
+	require.False(t, ok)
+	require.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	_, ok = spin(ctx, time.Second, c.tryReadBuffer)
+	require.False(t, ok)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+// BenchmarkTuningThroughput moves b.N items through a busy Buffer.
+// MaxBatchDrain saves the consumer a wakeup per item, raising throughput
+// while the items taken together wait for one another; YieldEvery costs
+// a little throughput for fairness; SpinBeforePark rarely matters here,
+// as the input is seldom empty.
+func BenchmarkTuningThroughput(b *testing.B) {
+	for _, tc := range []struct {
+		name   string
+		tuning Tuning
+	}{
+		{"default", Tuning{}},
+		{"drain-64", Tuning{MaxBatchDrain: 64}},
+		{"yield-16", Tuning{YieldEvery: 16}},
+		{"spin-50us", Tuning{SpinBeforePark: 50 * time.Microsecond}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			c := NewConsumer(1024, 1)
+			c.Notify(func(string) {})
+			c.Tuning = tc.tuning
+			var latency atomic.Int64
+			c.ConsumeFunc = func(data interface{}) error {
+				latency.Add(int64(time.Since(data.(time.Time))))
+				return nil
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.Run(context.Background())
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Buffer <- time.Now()
+			}
+			c.Close()
+			<-done
+			b.ReportMetric(float64(latency.Load())/float64(b.N), "ns-latency/op")
+		})
+	}
+}
+
+// BenchmarkTuningSparse sends b.N items one at a time, waiting for each to
+// be consumed, so the consumer finds its input empty every time.
+// SpinBeforePark keeps it from parking, lowering the latency of each item
+// at the cost of a busy processor.
+func BenchmarkTuningSparse(b *testing.B) {
+	for _, d := range []time.Duration{0, 50 * time.Microsecond} {
+		b.Run(fmt.Sprintf("spin-%v", d), func(b *testing.B) {
+			c := NewConsumer(1, 1)
+			c.Notify(func(string) {})
+			c.Tuning.SpinBeforePark = d
+			consumed := make(chan struct{})
+			c.ConsumeFunc = func(interface{}) error {
+				consumed <- struct{}{}
+				return nil
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.Run(context.Background())
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Buffer <- i
+				<-consumed
+			}
+			c.Close()
+			<-done
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package producerconsumer
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+)
+
+// WeightedDispatcher moves data from several producer buffers into one
+// consumer buffer, sharing it among them by weight. A source of weight 3
+// gets three items through for every one of a source of weight 1 while
+// both have data, so a fast producer cannot starve the others.
+//
+// Sources are served in deficit round-robin: every turn a source earns its
+// weight in credit and sends one item per credit while it has data ready.
+// A source that runs dry keeps at most one turn of unused credit, so one
+// coming back after being idle does not flood the consumer.
+type WeightedDispatcher struct {
+	sources []*weightedSource
+}
+
+// weightedSource is a producer buffer and its share.
+type weightedSource struct {
+	in        <-chan interface{}
+	weight    int
+	deficit   int
+	delivered atomic.Uint64
+}
+
+// NewWeightedDispatcher creates a dispatcher with no sources.
+func NewWeightedDispatcher() *WeightedDispatcher {
+	return &WeightedDispatcher{}
+}
+
+// Add registers a producer buffer with its weight, which is raised to 1 if
+// lower, and returns its index in Delivered. Sources must be added before
+// Dispatch is called.
+func (d *WeightedDispatcher) Add(in <-chan interface{}, weight int) int {
+	if weight < 1 {
+		weight = 1
+	}
+	d.sources = append(d.sources, &weightedSource{in: in, weight: weight})
+	return len(d.sources) - 1
+}
+
+// Delivered returns how many items each source has sent to the consumer,
+// in the order they were added.
+func (d *WeightedDispatcher) Delivered() []uint64 {
+	counts := make([]uint64, len(d.sources))
+	for i, s := range d.sources {
+		counts[i] = s.delivered.Load()
+	}
+	return counts
+}
+
+// Dispatch sends the data of the sources to out until every source is
+// closed, then returns nil. It waits while out is full, and returns the
+// context error if ctx is done first. out is not closed.
+func (d *WeightedDispatcher) Dispatch(ctx context.Context, out chan<- interface{}) error {
+	open := append([]*weightedSource(nil), d.sources...)
+	cur := 0
+
+	// idle counts the sources in a row found with nothing ready
+	idle := 0
+
+	for len(open) > 0 {
+		s := open[cur]
+
+		// Nothing is ready: wait until a source is, and give it the turn
+		var first interface{}
+		var hasFirst, closed bool
+		if idle == len(open) {
+			i, v, ok, err := receiveAny(ctx, open)
+			if err != nil {
+				return err
+			}
+			cur, idle, s = i, 0, open[i]
+			first, hasFirst, closed = v, ok, !ok
+		}
+
+		n := 0
+		if !closed {
+			var err error
+			n, closed, err = s.turn(ctx, out, first, hasFirst)
+			if err != nil {
+				return err
+			}
+		}
+
+		if closed {
+			open = append(open[:cur], open[cur+1:]...)
+			idle = 0
+			if cur == len(open) {
+				cur = 0
+			}
+			continue
+		}
+
+		if n == 0 {
+			idle++
+		} else {
+			idle = 0
+		}
+		cur = (cur + 1) % len(open)
+	}
+	return nil
+}
+
+// turn adds the weight of s to its credit and sends its ready items to out
+// while the credit lasts, starting with first if hasFirst. It returns how
+// many items were sent and whether s was found closed.
+func (s *weightedSource) turn(ctx context.Context, out chan<- interface{}, first interface{}, hasFirst bool) (int, bool, error) {
+
+	// Unused credit is capped at one turn
+	s.deficit += s.weight
+	if s.deficit > 2*s.weight {
+		s.deficit = 2 * s.weight
+	}
+
+	send := func(v interface{}) error {
+		select {
+		case out <- v:
+			s.deficit--
+			s.delivered.Add(1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	n := 0
+	if hasFirst {
+		if err := send(first); err != nil {
+			return n, false, err
+		}
+		n++
+	}
+
+	for s.deficit > 0 {
+		select {
+		case v, ok := <-s.in:
+			if !ok {
+				return n, true, nil
+			}
+			if err := send(v); err != nil {
+				return n, false, err
+			}
+			n++
+		default:
+			return n, false, nil
+		}
+	}
+	return n, false, nil
+}
+
+// receiveAny waits until one of the sources has an item or is closed, and
+// returns its index, the item, and whether one was received. It returns
+// the context error if ctx is done first.
+func receiveAny(ctx context.Context, sources []*weightedSource) (int, interface{}, bool, error) {
+	cases := make([]reflect.SelectCase, len(sources)+1)
+	for i, s := range sources {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.in)}
+	}
+	cases[len(sources)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
+	i, v, ok := reflect.Select(cases)
+	if i == len(sources) {
+		return 0, nil, false, ctx.Err()
+	}
+	if !ok {
+		return i, nil, false, nil
+	}
+	return i, v.Interface(), true, nil
+}
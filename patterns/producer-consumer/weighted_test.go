@@ -0,0 +1,109 @@
+package producerconsumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// filled returns a buffer holding n copies of tag.
+func filled(tag string, n int) chan interface{} {
+	buf := make(chan interface{}, n)
+	for i := 0; i < n; i++ {
+		buf <- tag
+	}
+	return buf
+}
+
+func TestWeightedDispatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 两个一直有数据的生产者,权重 3:1
+	d := NewWeightedDispatcher()
+	d.Add(filled("fast", 4000), 3)
+	d.Add(filled("slow", 4000), 1)
+
+	out := make(chan interface{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- d.Dispatch(ctx, out)
+	}()
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[(<-out).(string)]++
+	}
+	cancel()
+	require.ErrorIs(t, <-errc, context.Canceled)
+
+	// 消费者按权重分给两个生产者
+	ratio := float64(counts["fast"]) / float64(counts["slow"])
+	require.InDelta(t, 3.0, ratio, 0.3, "fast %d, slow %d", counts["fast"], counts["slow"])
+
+	delivered := d.Delivered()
+	require.Equal(t, uint64(counts["fast"]), delivered[0])
+	require.Equal(t, uint64(counts["slow"]), delivered[1])
+}
+
+func TestWeightedDispatcherIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := filled("a", 200)
+	b := make(chan interface{}, 100)
+
+	d := NewWeightedDispatcher()
+	d.Add(a, 1)
+	d.Add(b, 3)
+
+	out := make(chan interface{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- d.Dispatch(ctx, out)
+	}()
+
+	// 空闲的 b 不挡住 a
+	for i := 0; i < 50; i++ {
+		require.Equal(t, "a", <-out)
+	}
+	require.Zero(t, d.Delivered()[1])
+
+	// b 空闲时没有攒下无限的额度,回来后按权重分享
+	for i := 0; i < 100; i++ {
+		b <- "b"
+	}
+	counts := map[string]int{}
+	for i := 0; i < 40; i++ {
+		counts[(<-out).(string)]++
+	}
+	require.LessOrEqual(t, counts["b"], 33, "a %d, b %d", counts["a"], counts["b"])
+	require.GreaterOrEqual(t, counts["b"], 27, "a %d, b %d", counts["a"], counts["b"])
+
+	cancel()
+	require.ErrorIs(t, <-errc, context.Canceled)
+	require.Equal(t, []uint64{uint64(50 + counts["a"]), uint64(counts["b"])}, d.Delivered())
+}
+
+func TestWeightedDispatcherClosed(t *testing.T) {
+	a := filled("a", 30)
+	b := filled("b", 10)
+	close(a)
+	close(b)
+
+	d := NewWeightedDispatcher()
+	d.Add(a, 2)
+	d.Add(b, 0)
+
+	// 所有来源关闭并读完后返回 nil,不关闭 out
+	out := make(chan interface{}, 40)
+	require.NoError(t, d.Dispatch(context.Background(), out))
+	require.Len(t, out, 40)
+	require.Equal(t, []uint64{30, 10}, d.Delivered())
+
+	// 权重不足 1 时按 1 算:前两轮 a, a, b
+	require.Equal(t, "a", <-out)
+	require.Equal(t, "a", <-out)
+	require.Equal(t, "b", <-out)
+}
@@ -0,0 +1,341 @@
+// Package pubsub implements topic-based publish/subscribe over channels.
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrClosed is returned when using a broker after Close. It is also
+	// the Err of subscriptions ended by Close.
+	ErrClosed = errors.New("broker is closed")
+
+	// ErrSlowSubscriber is the Err of subscriptions cancelled by the
+	// Cancel policy.
+	ErrSlowSubscriber = errors.New("subscription cancelled: subscriber too slow")
+)
+
+// Policy decides what happens when a message is published to a
+// subscription whose buffer is full.
+type Policy int
+
+const (
+	// Block makes the publisher wait for room, or for its ctx to be done.
+	Block Policy = iota
+
+	// DropOldest discards the oldest buffered message to make room.
+	DropOldest
+
+	// DropNewest discards the message being published.
+	DropNewest
+
+	// Cancel ends the subscription with ErrSlowSubscriber.
+	Cancel
+)
+
+// Option configures a Broker.
+type Option func(*config)
+
+type config struct {
+	policy      Policy
+	prefixMatch bool
+}
+
+// WithPolicy sets how slow subscribers are handled. The default is Block.
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// WithPrefixMatch lets subscriptions to a topic ending in "*" receive the
+// messages of every topic starting with the part before it, so "orders.*"
+// matches "orders.created". Without it "*" has no special meaning.
+func WithPrefixMatch() Option {
+	return func(c *config) {
+		c.prefixMatch = true
+	}
+}
+
+// Broker delivers messages published to a topic to every subscription of
+// that topic.
+type Broker[T any] struct {
+	config
+
+	// mu guards topics, prefixes and closed.
+	mu sync.RWMutex
+
+	// topics holds the subscriptions by exact topic.
+	topics map[string]map[*Subscription[T]]struct{}
+
+	// prefixes holds the wildcard subscriptions by prefix.
+	prefixes map[string]map[*Subscription[T]]struct{}
+
+	closed bool
+}
+
+// New creates a Broker.
+func New[T any](opts ...Option) *Broker[T] {
+	b := &Broker[T]{
+		topics:   make(map[string]map[*Subscription[T]]struct{}),
+		prefixes: make(map[string]map[*Subscription[T]]struct{}),
+	}
+	for _, opt := range opts {
+		opt(&b.config)
+	}
+	return b
+}
+
+// Subscribe creates a subscription to topic buffering up to buf messages.
+func (b *Broker[T]) Subscribe(topic string, buf int) (*Subscription[T], error) {
+	if buf < 0 {
+		buf = 0
+	}
+
+	s := &Subscription[T]{
+		broker: b,
+		topic:  topic,
+		ch:     make(chan T, buf),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	index, key := b.index(topic)
+	if index[key] == nil {
+		index[key] = make(map[*Subscription[T]]struct{})
+	}
+	index[key][s] = struct{}{}
+
+	return s, nil
+}
+
+// Unsubscribe ends s and closes its channel. It is the same as
+// s.Unsubscribe.
+func (b *Broker[T]) Unsubscribe(s *Subscription[T]) {
+	b.remove(s)
+	s.close(nil)
+}
+
+// Publish delivers msg to every subscription of topic, following the slow
+// subscriber policy. With the Block policy it returns the context error if
+// ctx is done before every subscription has room.
+func (b *Broker[T]) Publish(ctx context.Context, topic string, msg T) error {
+	subs, err := b.match(topic)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range subs {
+		if err := b.deliver(ctx, s, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close ends every subscription with ErrClosed. Subscribe and Publish fail
+// with ErrClosed afterwards.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+
+	var subs []*Subscription[T]
+	for _, index := range []map[string]map[*Subscription[T]]struct{}{b.topics, b.prefixes} {
+		for key, set := range index {
+			for s := range set {
+				subs = append(subs, s)
+			}
+			delete(index, key)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.close(ErrClosed)
+	}
+}
+
+// match returns the subscriptions receiving messages published to topic.
+func (b *Broker[T]) match(topic string) ([]*Subscription[T], error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	var subs []*Subscription[T]
+	for s := range b.topics[topic] {
+		subs = append(subs, s)
+	}
+	for prefix, set := range b.prefixes {
+		if strings.HasPrefix(topic, prefix) {
+			for s := range set {
+				subs = append(subs, s)
+			}
+		}
+	}
+
+	return subs, nil
+}
+
+// deliver sends msg to s following the policy.
+func (b *Broker[T]) deliver(ctx context.Context, s *Subscription[T], msg T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Skip subscriptions ended since they were matched
+	if s.closed {
+		return nil
+	}
+
+	// Deliver right away if there is room
+	select {
+	case s.ch <- msg:
+		return nil
+	default:
+	}
+
+	switch b.policy {
+	case DropOldest:
+		// Holding s.mu, only the subscriber can take messages meanwhile,
+		// which only makes more room
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- msg:
+		default:
+		}
+
+	case DropNewest:
+
+	case Cancel:
+		s.closeLocked(ErrSlowSubscriber)
+		b.remove(s)
+
+	default:
+		select {
+		case s.ch <- msg:
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// remove stops routing messages to s.
+func (b *Broker[T]) remove(s *Subscription[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	index, key := b.index(s.topic)
+	if set, ok := index[key]; ok {
+		delete(set, s)
+		if len(set) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+// index returns the map and key topic is subscribed under.
+func (b *Broker[T]) index(topic string) (map[string]map[*Subscription[T]]struct{}, string) {
+	if b.prefixMatch && strings.HasSuffix(topic, "*") {
+		return b.prefixes, strings.TrimSuffix(topic, "*")
+	}
+	return b.topics, topic
+}
+
+// Subscription receives the messages published to a topic.
+type Subscription[T any] struct {
+	broker *Broker[T]
+	topic  string
+
+	// mu serializes deliveries and closing ch.
+	mu     sync.Mutex
+	ch     chan T
+	closed bool
+
+	// done is closed first when the subscription ends, to release
+	// publishers blocked on ch before ch itself is closed.
+	done     chan struct{}
+	doneOnce sync.Once
+	err      error
+}
+
+// C returns the channel delivering messages. It is closed when the
+// subscription ends.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Topic returns the topic subscribed to.
+func (s *Subscription[T]) Topic() string {
+	return s.topic
+}
+
+// Unsubscribe ends the subscription and closes its channel.
+func (s *Subscription[T]) Unsubscribe() {
+	s.broker.Unsubscribe(s)
+}
+
+// Done returns a channel closed when the subscription ends.
+func (s *Subscription[T]) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription ended: nil while active or after
+// Unsubscribe, ErrSlowSubscriber if cancelled by the Cancel policy, or
+// ErrClosed if the broker was closed.
+func (s *Subscription[T]) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// close ends the subscription with err.
+func (s *Subscription[T]) close(err error) {
+	s.end(err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked(err)
+}
+
+// closeLocked ends the subscription with err. Caller must hold s.mu.
+func (s *Subscription[T]) closeLocked(err error) {
+	s.end(err)
+
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// end records err and closes done, the first time only.
+func (s *Subscription[T]) end(err error) {
+	s.doneOnce.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
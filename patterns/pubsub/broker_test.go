@@ -0,0 +1,256 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	b := New[string]()
+	defer b.Close()
+
+	s1, _ := b.Subscribe("news", 2)
+	s2, _ := b.Subscribe("news", 2)
+	other, _ := b.Subscribe("sports", 2)
+
+	if err := b.Publish(context.Background(), "news", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*Subscription[string]{s1, s2} {
+		if msg := <-s.C(); msg != "hello" {
+			t.Errorf("got %q, want %q", msg, "hello")
+		}
+	}
+	if len(other.C()) != 0 {
+		t.Error("other topic should not receive the message")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	b := New[int]()
+	defer b.Close()
+
+	s, _ := b.Subscribe("t", 1)
+	s.Unsubscribe()
+
+	if _, ok := <-s.C(); ok {
+		t.Error("channel should be closed")
+	}
+	if s.Err() != nil {
+		t.Errorf("Err() = %v, want nil", s.Err())
+	}
+
+	// Publishing to a topic without subscribers is fine
+	if err := b.Publish(context.Background(), "t", 1); err != nil {
+		t.Error(err)
+	}
+
+	// Unsubscribing twice is fine
+	b.Unsubscribe(s)
+}
+
+func TestClose(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	b := New[int]()
+	s, _ := b.Subscribe("t", 0)
+
+	// A publisher blocked on the subscription is released by Close
+	errc := make(chan error)
+	go func() { errc <- b.Publish(context.Background(), "t", 1) }()
+	time.Sleep(10 * time.Millisecond)
+
+	b.Close()
+	<-errc
+
+	if _, ok := <-s.C(); ok {
+		t.Error("channel should be closed")
+	}
+	if !errors.Is(s.Err(), ErrClosed) {
+		t.Errorf("Err() = %v, want %v", s.Err(), ErrClosed)
+	}
+	if _, err := b.Subscribe("t", 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe() = %v, want %v", err, ErrClosed)
+	}
+	if err := b.Publish(context.Background(), "t", 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() = %v, want %v", err, ErrClosed)
+	}
+	b.Close()
+}
+
+func TestPolicyBlock(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	b := New[int](WithPolicy(Block))
+	defer b.Close()
+
+	s, _ := b.Subscribe("t", 1)
+	b.Publish(context.Background(), "t", 1)
+
+	// The buffer is full, so the publisher waits until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Publish(ctx, "t", 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Publish() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Once there is room, the publisher goes through
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Publish(context.Background(), "t", 3)
+	}()
+	if v := <-s.C(); v != 1 {
+		t.Errorf("got %d, want 1", v)
+	}
+	<-done
+	if v := <-s.C(); v != 3 {
+		t.Errorf("got %d, want 3", v)
+	}
+}
+
+func TestPolicyDrop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		policy Policy
+		want   []int
+	}{
+		{DropOldest, []int{4, 5}},
+		{DropNewest, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		b := New[int](WithPolicy(tt.policy))
+		s, _ := b.Subscribe("t", 2)
+
+		for i := 1; i <= 5; i++ {
+			if err := b.Publish(context.Background(), "t", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := []int{<-s.C(), <-s.C()}
+		if got[0] != tt.want[0] || got[1] != tt.want[1] {
+			t.Errorf("policy %d: got %v, want %v", tt.policy, got, tt.want)
+		}
+		b.Close()
+	}
+}
+
+func TestPolicyCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	b := New[int](WithPolicy(Cancel))
+	defer b.Close()
+
+	slow, _ := b.Subscribe("t", 1)
+	fast, _ := b.Subscribe("t", 10)
+
+	b.Publish(context.Background(), "t", 1)
+	b.Publish(context.Background(), "t", 2)
+
+	// The slow subscription is cancelled, keeping what it had buffered
+	if v, ok := <-slow.C(); !ok || v != 1 {
+		t.Errorf("got %d, %v, want 1, true", v, ok)
+	}
+	if _, ok := <-slow.C(); ok {
+		t.Error("slow channel should be closed")
+	}
+	if !errors.Is(slow.Err(), ErrSlowSubscriber) {
+		t.Errorf("Err() = %v, want %v", slow.Err(), ErrSlowSubscriber)
+	}
+
+	// The other subscription is unaffected
+	if len(fast.C()) != 2 || fast.Err() != nil {
+		t.Errorf("fast subscription: %d buffered, Err() = %v", len(fast.C()), fast.Err())
+	}
+}
+
+func TestPrefixMatch(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	b := New[string](WithPrefixMatch())
+	defer b.Close()
+
+	all, _ := b.Subscribe("orders.*", 10)
+	created, _ := b.Subscribe("orders.created", 10)
+
+	b.Publish(context.Background(), "orders.created", "a")
+	b.Publish(context.Background(), "orders.paid", "b")
+	b.Publish(context.Background(), "users.created", "c")
+
+	if len(all.C()) != 2 {
+		t.Errorf("orders.* got %d messages, want 2", len(all.C()))
+	}
+	if len(created.C()) != 1 {
+		t.Errorf("orders.created got %d messages, want 1", len(created.C()))
+	}
+
+	// Without the option "*" is literal
+	literal := New[string]()
+	defer literal.Close()
+	s, _ := literal.Subscribe("orders.*", 10)
+	literal.Publish(context.Background(), "orders.created", "a")
+	if len(s.C()) != 0 {
+		t.Error("orders.* should not match without WithPrefixMatch")
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	for _, policy := range []Policy{Block, DropOldest, DropNewest, Cancel} {
+		b := New[int](WithPolicy(policy), WithPrefixMatch())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+
+			// Publishers
+			go func(i int) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				for j := 0; j < 200; j++ {
+					b.Publish(ctx, fmt.Sprintf("t%d", j%4), j)
+				}
+			}(i)
+
+			// Subscribers that read a little, then unsubscribe
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					topic := fmt.Sprintf("t%d", i)
+					if j%2 == 0 {
+						topic = "t*"
+					}
+					s, err := b.Subscribe(topic, 2)
+					if err != nil {
+						return
+					}
+					for k := 0; k < 3; k++ {
+						select {
+						case <-s.C():
+						case <-time.After(time.Millisecond):
+						}
+					}
+					s.Unsubscribe()
+				}
+			}(i)
+		}
+		wg.Wait()
+		b.Close()
+	}
+}
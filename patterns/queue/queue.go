@@ -0,0 +1,350 @@
+// Package queue implements a bounded FIFO queue whose behavior when full
+// is chosen by a policy, for producers and consumers that need more than
+// a channel's blocking send.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrClosed is returned by Push after Close, and by Pop once the queue
+	// is closed and drained.
+	ErrClosed = errors.New("queue is closed")
+
+	// ErrFull is returned by Push under Reject when the queue is full.
+	ErrFull = errors.New("queue is full")
+
+	// ErrTooLarge is returned by Push for an item larger than the byte
+	// budget of a queue made by NewSized, whatever the policy.
+	ErrTooLarge = errors.New("item is larger than the queue")
+)
+
+// Policy decides what Push does when the queue is full.
+type Policy int
+
+const (
+	// Block makes the pusher wait for room, or for its ctx to be done.
+	Block Policy = iota
+
+	// DropNewest discards the item being pushed.
+	DropNewest
+
+	// DropOldest evicts the oldest queued item to make room.
+	DropOldest
+
+	// Reject makes Push fail with ErrFull.
+	Reject
+)
+
+// String returns the name of the policy.
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Reject:
+		return "reject"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// Option configures a BoundedQueue.
+type Option func(*config)
+
+type config struct {
+	policy Policy
+}
+
+// WithPolicy sets what Push does when the queue is full. The default is
+// Block.
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// Stats counts the items a BoundedQueue did not deliver, and the bytes it
+// holds if made by NewSized.
+type Stats struct {
+	Evicted  uint64 // Items dropped by DropNewest or DropOldest
+	Rejected uint64 // Pushes failed with ErrFull or ErrTooLarge
+
+	Bytes     int // Size of the queued items
+	PeakBytes int // Highest Bytes reached
+}
+
+// BoundedQueue is a FIFO queue holding up to a fixed number of items. It
+// is safe for any number of pushing and popping goroutines.
+type BoundedQueue[T any] struct {
+	config
+
+	onEvict func(T)
+
+	// mu guards all fields below. notEmpty and notFull wait on it.
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	// items is a ring of count items, oldest at head.
+	items  []T
+	head   int
+	count  int
+	closed bool
+	stats  Stats
+
+	// With a byte budget, sizes holds the size of every item as it was
+	// pushed, parallel to items, and stats.Bytes their sum.
+	sizeOf   func(T) int
+	maxBytes int
+	sizes    []int
+}
+
+// New creates a BoundedQueue holding up to capacity items. It panics if
+// capacity is less than one.
+func New[T any](capacity int, opts ...Option) *BoundedQueue[T] {
+	if capacity < 1 {
+		panic("queue: capacity must be positive")
+	}
+
+	q := &BoundedQueue[T]{items: make([]T, capacity)}
+	for _, opt := range opts {
+		opt(&q.config)
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// NewSized creates a BoundedQueue holding up to capacity items and up to
+// maxBytes bytes of them, as measured by size when they are pushed. The
+// queue is full when either limit would be exceeded. Items larger than
+// maxBytes are refused with ErrTooLarge. It panics if capacity or
+// maxBytes is less than one.
+func NewSized[T any](capacity, maxBytes int, size func(item T) int, opts ...Option) *BoundedQueue[T] {
+	if maxBytes < 1 {
+		panic("queue: maxBytes must be positive")
+	}
+
+	q := New[T](capacity, opts...)
+	q.sizeOf = size
+	q.maxBytes = maxBytes
+	q.sizes = make([]int, capacity)
+	return q
+}
+
+// OnEvict sets a function receiving the items dropped by DropNewest and
+// DropOldest. It is called without the queue's lock held, so it may use
+// the queue. Set it before using the queue.
+func (q *BoundedQueue[T]) OnEvict(fn func(T)) {
+	q.onEvict = fn
+}
+
+// Push queues item. When the queue is full it blocks, drops an item or
+// fails, depending on the Policy. It returns ErrClosed after Close, ErrFull
+// under Reject, ErrTooLarge for an item larger than the byte budget, or
+// the context error if ctx is done while waiting. An item dropped by
+// DropNewest is not an error.
+func (q *BoundedQueue[T]) Push(ctx context.Context, item T) error {
+	size := 0
+	if q.sizeOf != nil {
+		size = q.sizeOf(item)
+	}
+
+	// Wake the waiters when ctx is done, so they can give up
+	stop := context.AfterFunc(ctx, q.wakeAll)
+	defer stop()
+
+	q.mu.Lock()
+	if q.maxBytes > 0 && size > q.maxBytes {
+		q.stats.Rejected++
+		q.mu.Unlock()
+		return ErrTooLarge
+	}
+	for {
+		if q.closed {
+			q.mu.Unlock()
+			return ErrClosed
+		}
+		if q.fits(size) {
+			break
+		}
+
+		switch q.policy {
+		case DropNewest:
+			q.stats.Evicted++
+			q.mu.Unlock()
+			q.evict(item)
+			return nil
+		case DropOldest:
+			// Several small items may have to go for a large one
+			var old []T
+			for !q.fits(size) {
+				old = append(old, q.take())
+				q.stats.Evicted++
+			}
+			q.put(item, size)
+			q.mu.Unlock()
+			for _, o := range old {
+				q.evict(o)
+			}
+			return nil
+		case Reject:
+			q.stats.Rejected++
+			q.mu.Unlock()
+			return ErrFull
+		}
+
+		if err := ctx.Err(); err != nil {
+			q.mu.Unlock()
+			return err
+		}
+		q.notFull.Wait()
+	}
+
+	q.put(item, size)
+	q.mu.Unlock()
+	return nil
+}
+
+// Pop returns the oldest item, waiting for one if the queue is empty. Once
+// the queue is closed it keeps returning queued items, then ErrClosed. It
+// returns the context error if ctx is done while waiting.
+func (q *BoundedQueue[T]) Pop(ctx context.Context) (T, error) {
+	stop := context.AfterFunc(ctx, q.wakeAll)
+	defer stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var zero T
+	for q.count == 0 {
+		if q.closed {
+			return zero, ErrClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+		q.notEmpty.Wait()
+	}
+
+	item := q.take()
+	q.freed()
+	return item, nil
+}
+
+// TryPop returns the oldest item without waiting, and reports whether
+// there was one.
+func (q *BoundedQueue[T]) TryPop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.count == 0 {
+		var zero T
+		return zero, false
+	}
+	item := q.take()
+	q.freed()
+	return item, true
+}
+
+// Len returns the number of queued items.
+func (q *BoundedQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Cap returns how many items the queue holds.
+func (q *BoundedQueue[T]) Cap() int {
+	return len(q.items)
+}
+
+// Stats returns how many items were evicted and rejected, and the bytes
+// queued.
+func (q *BoundedQueue[T]) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
+
+// Close stops further pushes, failing the blocked ones with ErrClosed.
+// Poppers get the queued items, then ErrClosed. Closing twice is allowed.
+func (q *BoundedQueue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// fits reports whether an item of size fits. q.mu must be held.
+func (q *BoundedQueue[T]) fits(size int) bool {
+	if q.count == len(q.items) {
+		return false
+	}
+	return q.maxBytes == 0 || q.stats.Bytes+size <= q.maxBytes
+}
+
+// put appends item of size, which must fit. q.mu must be held.
+func (q *BoundedQueue[T]) put(item T, size int) {
+	i := (q.head + q.count) % len(q.items)
+	q.items[i] = item
+	q.count++
+	if q.sizes != nil {
+		q.sizes[i] = size
+		q.stats.Bytes += size
+		if q.stats.Bytes > q.stats.PeakBytes {
+			q.stats.PeakBytes = q.stats.Bytes
+		}
+	}
+	q.notEmpty.Signal()
+}
+
+// take removes the oldest item, which must exist. q.mu must be held.
+func (q *BoundedQueue[T]) take() T {
+	var zero T
+	item := q.items[q.head]
+	q.items[q.head] = zero
+	if q.sizes != nil {
+		q.stats.Bytes -= q.sizes[q.head]
+		q.sizes[q.head] = 0
+	}
+	q.head = (q.head + 1) % len(q.items)
+	q.count--
+	return item
+}
+
+// freed wakes the pushers waiting for room after an item was taken. With
+// a byte budget, the room may fit a smaller item than the first waiter's,
+// so all of them check. q.mu must be held.
+func (q *BoundedQueue[T]) freed() {
+	if q.maxBytes > 0 {
+		q.notFull.Broadcast()
+		return
+	}
+	q.notFull.Signal()
+}
+
+// evict reports item to the eviction callback, if any.
+func (q *BoundedQueue[T]) evict(item T) {
+	if q.onEvict != nil {
+		q.onEvict(item)
+	}
+}
+
+// wakeAll wakes every waiter so they can recheck their context.
+func (q *BoundedQueue[T]) wakeAll() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
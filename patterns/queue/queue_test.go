@@ -0,0 +1,402 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFIFO(t *testing.T) {
+	q := New[int](3)
+	ctx := context.Background()
+
+	// Wrap around the end of the ring
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 3; i++ {
+			if err := q.Push(ctx, round*10+i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if v, err := q.Pop(ctx); err != nil || v != round*10+i {
+				t.Fatalf("Pop = %d, %v, want %d", v, err, round*10+i)
+			}
+		}
+	}
+	if _, ok := q.TryPop(); ok {
+		t.Error("TryPop on an empty queue should fail")
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		policy  Policy
+		err     error
+		want    []int
+		evicted []int
+		stats   Stats
+	}{
+		{DropNewest, nil, []int{1, 2}, []int{3}, Stats{Evicted: 1}},
+		{DropOldest, nil, []int{2, 3}, []int{1}, Stats{Evicted: 1}},
+		{Reject, ErrFull, []int{1, 2}, nil, Stats{Rejected: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var evicted []int
+			q := New[int](2, WithPolicy(tt.policy))
+			q.OnEvict(func(v int) { evicted = append(evicted, v) })
+
+			q.Push(ctx, 1)
+			q.Push(ctx, 2)
+			if err := q.Push(ctx, 3); !errors.Is(err, tt.err) {
+				t.Errorf("Push on a full queue = %v, want %v", err, tt.err)
+			}
+
+			var got []int
+			for q.Len() > 0 {
+				v, _ := q.Pop(ctx)
+				got = append(got, v)
+			}
+			if !equal(got, tt.want) || !equal(evicted, tt.evicted) {
+				t.Errorf("got %v, evicted %v, want %v and %v", got, evicted, tt.want, tt.evicted)
+			}
+			if q.Stats() != tt.stats {
+				t.Errorf("Stats = %+v, want %+v", q.Stats(), tt.stats)
+			}
+		})
+	}
+}
+
+func TestBlock(t *testing.T) {
+	q := New[int](1)
+	q.Push(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Push(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Push on a full queue = %v, want context.DeadlineExceeded", err)
+	}
+
+	// A pop makes room for a blocked push
+	done := make(chan error)
+	go func() {
+		done <- q.Push(context.Background(), 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Pop(context.Background())
+	if err := <-done; err != nil {
+		t.Errorf("blocked Push = %v, want nil", err)
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	q := New[int](2)
+	ctx := context.Background()
+	q.Push(ctx, 1)
+	q.Push(ctx, 2)
+
+	// A push blocked on the full queue fails
+	done := make(chan error)
+	go func() {
+		done <- q.Push(ctx, 3)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Push = %v, want ErrClosed", err)
+	}
+
+	for _, want := range []int{1, 2} {
+		if v, err := q.Pop(ctx); err != nil || v != want {
+			t.Errorf("Pop = %d, %v, want %d", v, err, want)
+		}
+	}
+	if _, err := q.Pop(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Pop = %v, want ErrClosed once drained", err)
+	}
+	if err := q.Push(ctx, 4); !errors.Is(err, ErrClosed) {
+		t.Errorf("Push = %v, want ErrClosed", err)
+	}
+	q.Close()
+}
+
+func TestPopCancel(t *testing.T) {
+	q := New[int](1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.Pop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Pop = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// TestContention pushes and pops from many goroutines under each policy,
+// checking that every item is either popped once or accounted for.
+func TestContention(t *testing.T) {
+	const producers, consumers, perProducer = 8, 8, 2000
+
+	for _, policy := range []Policy{Block, DropNewest, DropOldest, Reject} {
+		t.Run(policy.String(), func(t *testing.T) {
+			q := New[int](16, WithPolicy(policy))
+			ctx := context.Background()
+
+			var evicted, rejected atomic.Int64
+			seen := make([]atomic.Int32, producers*perProducer)
+			q.OnEvict(func(v int) {
+				evicted.Add(1)
+				seen[v].Add(1)
+			})
+
+			var pushers sync.WaitGroup
+			for p := 0; p < producers; p++ {
+				pushers.Add(1)
+				go func(p int) {
+					defer pushers.Done()
+					for i := 0; i < perProducer; i++ {
+						v := p*perProducer + i
+						err := q.Push(ctx, v)
+						if errors.Is(err, ErrFull) {
+							rejected.Add(1)
+							seen[v].Add(1)
+						} else if err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(p)
+			}
+
+			var popped atomic.Int64
+			var poppers sync.WaitGroup
+			for c := 0; c < consumers; c++ {
+				poppers.Add(1)
+				go func() {
+					defer poppers.Done()
+					for {
+						v, err := q.Pop(ctx)
+						if errors.Is(err, ErrClosed) {
+							return
+						}
+						if q.Len() > q.Cap() {
+							t.Error("queue over capacity")
+						}
+						popped.Add(1)
+						seen[v].Add(1)
+					}
+				}()
+			}
+
+			pushers.Wait()
+			q.Close()
+			poppers.Wait()
+
+			for v := range seen {
+				if n := seen[v].Load(); n != 1 {
+					t.Fatalf("item %d accounted for %d times", v, n)
+				}
+			}
+			stats := q.Stats()
+			if uint64(evicted.Load()) != stats.Evicted || uint64(rejected.Load()) != stats.Rejected {
+				t.Errorf("Stats = %+v, want %d evicted and %d rejected", stats, evicted.Load(), rejected.Load())
+			}
+			if policy == Block && popped.Load() != producers*perProducer {
+				t.Errorf("popped %d items, want all under Block", popped.Load())
+			}
+		})
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// size makes an int its own size in bytes.
+func size(v int) int { return v }
+
+func TestSizedPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		policy  Policy
+		err     error
+		want    []int
+		evicted []int
+		stats   Stats
+	}{
+		{Block, context.DeadlineExceeded, []int{40, 40}, nil, Stats{PeakBytes: 80}},
+		{DropNewest, nil, []int{40, 40}, []int{30}, Stats{Evicted: 1, PeakBytes: 80}},
+		{DropOldest, nil, []int{40, 30}, []int{40}, Stats{Evicted: 1, PeakBytes: 80}},
+		{Reject, ErrFull, []int{40, 40}, nil, Stats{Rejected: 1, PeakBytes: 80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var evicted []int
+			q := NewSized(10, 100, size, WithPolicy(tt.policy))
+			q.OnEvict(func(v int) { evicted = append(evicted, v) })
+
+			// The byte budget is full long before the item count
+			q.Push(ctx, 40)
+			q.Push(ctx, 40)
+			if s := q.Stats(); s.Bytes != 80 {
+				t.Errorf("Bytes = %d, want 80", s.Bytes)
+			}
+			pushCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+			if err := q.Push(pushCtx, 30); !errors.Is(err, tt.err) {
+				t.Errorf("Push over the budget = %v, want %v", err, tt.err)
+			}
+
+			var got []int
+			for q.Len() > 0 {
+				v, _ := q.Pop(ctx)
+				got = append(got, v)
+			}
+			if !equal(got, tt.want) || !equal(evicted, tt.evicted) {
+				t.Errorf("got %v, evicted %v, want %v and %v", got, evicted, tt.want, tt.evicted)
+			}
+			if q.Stats() != tt.stats {
+				t.Errorf("Stats = %+v, want %+v", q.Stats(), tt.stats)
+			}
+		})
+	}
+}
+
+func TestSizedDropOldestMany(t *testing.T) {
+	ctx := context.Background()
+	var evicted []int
+	q := NewSized(10, 100, size, WithPolicy(DropOldest))
+	q.OnEvict(func(v int) { evicted = append(evicted, v) })
+
+	// A large item evicts as many small ones as it needs
+	for _, v := range []int{20, 20, 20, 20} {
+		q.Push(ctx, v)
+	}
+	q.Push(ctx, 70)
+	if !equal(evicted, []int{20, 20, 20}) || q.Len() != 2 || q.Stats().Bytes != 90 {
+		t.Errorf("evicted %v, left %d items of %d bytes, want 3 evicted and 90 bytes", evicted, q.Len(), q.Stats().Bytes)
+	}
+
+	// An item over the budget is refused whatever the policy
+	if err := q.Push(ctx, 101); err != ErrTooLarge {
+		t.Errorf("Push = %v, want %v", err, ErrTooLarge)
+	}
+	if s := q.Stats(); s.Rejected != 1 || s.Bytes != 90 {
+		t.Errorf("Stats = %+v, want 1 rejected and 90 bytes", s)
+	}
+}
+
+func TestSizedBlockWakesFitting(t *testing.T) {
+	ctx := context.Background()
+	q := NewSized(10, 100, size)
+	q.Push(ctx, 60)
+	q.Push(ctx, 40)
+
+	// Both wait; once 40 bytes are freed only the small one fits
+	large := make(chan error, 1)
+	small := make(chan error, 1)
+	go func() { large <- q.Push(ctx, 80) }()
+	time.Sleep(10 * time.Millisecond)
+	go func() { small <- q.Push(ctx, 30) }()
+	time.Sleep(10 * time.Millisecond)
+
+	q.Pop(ctx)
+	select {
+	case err := <-small:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the pusher whose item fits was not woken")
+	}
+	if q.Stats().Bytes != 70 {
+		t.Errorf("Bytes = %d, want 70", q.Stats().Bytes)
+	}
+
+	// The large one goes in once there is room for it
+	q.Pop(ctx)
+	q.Pop(ctx)
+	if err := <-large; err != nil {
+		t.Fatal(err)
+	}
+	if q.Stats().Bytes != 80 {
+		t.Errorf("Bytes = %d, want 80", q.Stats().Bytes)
+	}
+}
+
+func TestSizedConcurrent(t *testing.T) {
+	const maxBytes = 4096
+
+	for _, policy := range []Policy{Block, DropOldest, DropNewest} {
+		t.Run(policy.String(), func(t *testing.T) {
+			ctx := context.Background()
+			q := NewSized(64, maxBytes, size, WithPolicy(policy))
+
+			var pushed, popped, evicted atomic.Int64
+			q.OnEvict(func(v int) { evicted.Add(int64(v)) })
+
+			// Small items and items of up to half the budget
+			var pushers sync.WaitGroup
+			for p := 0; p < 4; p++ {
+				pushers.Add(1)
+				go func(p int) {
+					defer pushers.Done()
+					for i := 0; i < 300; i++ {
+						v := 1 + (i*7+p)%16
+						if i%10 == 0 {
+							v = 1024 + (i*37+p)%1024
+						}
+						if err := q.Push(ctx, v); err != nil {
+							t.Error(err)
+							return
+						}
+						pushed.Add(int64(v))
+					}
+				}(p)
+			}
+
+			// The budget holds whenever it is looked at
+			var poppers sync.WaitGroup
+			for c := 0; c < 2; c++ {
+				poppers.Add(1)
+				go func() {
+					defer poppers.Done()
+					for {
+						v, err := q.Pop(ctx)
+						if err != nil {
+							return
+						}
+						popped.Add(int64(v))
+						if b := q.Stats().Bytes; b > maxBytes || b < 0 {
+							t.Errorf("Bytes = %d, over the budget of %d", b, maxBytes)
+						}
+					}
+				}()
+			}
+
+			pushers.Wait()
+			q.Close()
+			poppers.Wait()
+
+			// Every byte pushed was popped or evicted
+			s := q.Stats()
+			if s.Bytes != 0 || s.PeakBytes > maxBytes {
+				t.Errorf("Stats = %+v, want no bytes left and a peak within %d", s, maxBytes)
+			}
+			if pushed.Load() != popped.Load()+evicted.Load() {
+				t.Errorf("pushed %d bytes, popped %d and evicted %d", pushed.Load(), popped.Load(), evicted.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+// Package adaptive implements a rate limiter whose rate follows the health
+// of the downstream it protects: the rate grows additively while calls
+// succeed and is cut multiplicatively when they fail (AIMD).
+package adaptive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// Limiter implements ratelimit.Limiter and ratelimit.Reporter.
+var _ ratelimit.Limiter = (*Limiter)(nil)
+var _ ratelimit.Reporter = (*Limiter)(nil)
+
+// Reason tells why the rate was adjusted.
+type Reason int
+
+const (
+	// ReasonIncrease means calls succeeded for an interval.
+	ReasonIncrease Reason = iota
+
+	// ReasonDecrease means a call failed.
+	ReasonDecrease
+)
+
+// String returns the name of the reason.
+func (r Reason) String() string {
+	switch r {
+	case ReasonIncrease:
+		return "increase"
+	case ReasonDecrease:
+		return "decrease"
+	default:
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+}
+
+// Adjustment records a change of the rate.
+type Adjustment struct {
+	At     time.Time
+	From   float64
+	To     float64
+	Reason Reason
+}
+
+// Stats is a snapshot of the limiter's rate and counters.
+type Stats struct {
+	Rate      float64      // Current rate, in events per second
+	Min       float64      // Lowest rate allowed
+	Max       float64      // Highest rate allowed
+	Successes uint64       // Successful calls reported
+	Failures  uint64       // Failed calls reported
+	History   []Adjustment // Latest adjustments, oldest first
+}
+
+// Option configures a Limiter.
+type Option func(*config)
+
+type config struct {
+	min, max float64
+	initial  float64
+	step     float64
+	factor   float64
+	interval time.Duration
+	burst    int
+	history  int
+	clock    window.Clock
+}
+
+// WithBounds bounds the rate to [min, max] events per second. The default
+// is [1, 1000].
+func WithBounds(min, max float64) Option {
+	return func(c *config) {
+		c.min = min
+		c.max = max
+	}
+}
+
+// WithInitialRate sets the rate to start from. The default is the
+// minimum.
+func WithInitialRate(rate float64) Option {
+	return func(c *config) {
+		c.initial = rate
+	}
+}
+
+// WithIncrease sets how much the rate grows after an interval of
+// successful calls. The default is 1.
+func WithIncrease(step float64) Option {
+	return func(c *config) {
+		c.step = step
+	}
+}
+
+// WithDecrease sets the factor the rate is multiplied by when a call
+// fails. The default is 0.5.
+func WithDecrease(factor float64) Option {
+	return func(c *config) {
+		c.factor = factor
+	}
+}
+
+// WithInterval sets how often the rate may grow, and how long after a
+// decrease further failures are ignored, so one burst of errors only cuts
+// the rate once. The default is 100ms.
+func WithInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.interval = d
+	}
+}
+
+// WithBurst sets the capacity of the inner token bucket. The default is 10.
+func WithBurst(n int) Option {
+	return func(c *config) {
+		c.burst = n
+	}
+}
+
+// WithHistory sets how many adjustments Stats keeps. The default is 32.
+func WithHistory(n int) Option {
+	return func(c *config) {
+		c.history = n
+	}
+}
+
+// WithClock sets the clock used to pace adjustments. The default reads the
+// system clock.
+func WithClock(clock window.Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// realClock reads the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Limiter admits events through a token bucket whose rate is adjusted by
+// Report.
+type Limiter struct {
+	bucket *tokenbucket.TokenBucket
+	cfg    config
+
+	// mu guards the fields below.
+	mu           sync.Mutex
+	rate         float64
+	lastIncrease time.Time
+	lastDecrease time.Time
+	successes    uint64
+	failures     uint64
+	history      []Adjustment
+}
+
+// New creates a Limiter.
+func New(opts ...Option) (*Limiter, error) {
+	cfg := config{
+		min:      1,
+		max:      1000,
+		step:     1,
+		factor:   0.5,
+		interval: 100 * time.Millisecond,
+		burst:    10,
+		history:  32,
+		clock:    realClock{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.min <= 0 || cfg.max < cfg.min {
+		return nil, fmt.Errorf("bounds must satisfy 0 < min <= max")
+	}
+	if cfg.step <= 0 {
+		return nil, fmt.Errorf("increase must be positive")
+	}
+	if cfg.factor <= 0 || cfg.factor >= 1 {
+		return nil, fmt.Errorf("decrease factor must be between 0 and 1")
+	}
+	if cfg.burst <= 0 {
+		return nil, fmt.Errorf("burst must be positive")
+	}
+	if cfg.initial == 0 {
+		cfg.initial = cfg.min
+	}
+
+	rate := clamp(cfg.initial, cfg.min, cfg.max)
+	now := cfg.clock.Now()
+	return &Limiter{
+		bucket:       tokenbucket.New(rate, cfg.burst),
+		cfg:          cfg,
+		rate:         rate,
+		lastIncrease: now,
+	}, nil
+}
+
+// Allow reports whether one event may happen now.
+func (l *Limiter) Allow() bool {
+	return l.bucket.Allow()
+}
+
+// AllowN reports whether n events may happen now.
+func (l *Limiter) AllowN(n int) bool {
+	return l.bucket.AllowN(n)
+}
+
+// Wait blocks until one event may happen, or until ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.bucket.Wait(ctx)
+}
+
+// Remaining returns how many events may happen now.
+func (l *Limiter) Remaining() int {
+	return l.bucket.Remaining()
+}
+
+// RetryAfter returns how long until the next event may happen.
+func (l *Limiter) RetryAfter() time.Duration {
+	return l.bucket.RetryAfter()
+}
+
+// Do waits for the limiter, calls fn and reports its error. An error from
+// ctx being canceled by the caller is not reported, since it says nothing
+// about the downstream; a deadline exceeded is reported as a timeout.
+func (l *Limiter) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := l.Wait(ctx); err != nil {
+		return err
+	}
+
+	err := fn(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() == context.Canceled {
+		return err
+	}
+	l.Report(err)
+	return err
+}
+
+// Report feeds back the outcome of a call. A nil error counts as a
+// success and grows the rate once per interval; any other error cuts it,
+// then further errors are ignored for an interval.
+func (l *Limiter) Report(err error) {
+	now := l.cfg.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err == nil {
+		l.successes++
+		if now.Sub(l.lastIncrease) >= l.cfg.interval {
+			l.lastIncrease = now
+			l.adjust(now, l.rate+l.cfg.step, ReasonIncrease)
+		}
+		return
+	}
+
+	l.failures++
+	if !l.lastDecrease.IsZero() && now.Sub(l.lastDecrease) < l.cfg.interval {
+		return
+	}
+	l.lastDecrease = now
+	l.lastIncrease = now
+	l.adjust(now, l.rate*l.cfg.factor, ReasonDecrease)
+}
+
+// Rate returns the current rate, in events per second.
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// Stats returns a snapshot of the rate, the reported outcomes and the
+// latest adjustments.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Stats{
+		Rate:      l.rate,
+		Min:       l.cfg.min,
+		Max:       l.cfg.max,
+		Successes: l.successes,
+		Failures:  l.failures,
+		History:   append([]Adjustment(nil), l.history...),
+	}
+}
+
+// Close stops the inner token bucket.
+func (l *Limiter) Close() {
+	l.bucket.Close()
+}
+
+// adjust moves the rate to rate, within the bounds, and records the
+// change. Caller must hold the lock.
+func (l *Limiter) adjust(now time.Time, rate float64, reason Reason) {
+	rate = clamp(rate, l.cfg.min, l.cfg.max)
+	if rate == l.rate {
+		return
+	}
+
+	if l.cfg.history > 0 {
+		if len(l.history) == l.cfg.history {
+			copy(l.history, l.history[1:])
+			l.history = l.history[:len(l.history)-1]
+		}
+		l.history = append(l.history, Adjustment{At: now, From: l.rate, To: rate, Reason: reason})
+	}
+
+	l.rate = rate
+	l.bucket.SetRate(rate)
+}
+
+// clamp limits v to [min, max].
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,211 @@
+package adaptive
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/ratelimittest"
+)
+
+// fakeClock is a clock moved by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var errOverloaded = errors.New("overloaded")
+
+// simulate offers the limiter's rate to a downstream that tolerates
+// capacity calls per second, for the given simulated time, and returns
+// the rate after every step.
+func simulate(l *Limiter, clock *fakeClock, capacity float64, d time.Duration) []float64 {
+	const step = 100 * time.Millisecond
+
+	var rates []float64
+	for elapsed := time.Duration(0); elapsed < d; elapsed += step {
+		clock.Add(step)
+
+		// The calls made this step, beyond capacity they fail
+		calls := int(l.Rate() * step.Seconds())
+		for i := 0; i < calls; i++ {
+			if float64(i) < capacity*step.Seconds() {
+				l.Report(nil)
+			} else {
+				l.Report(errOverloaded)
+			}
+		}
+		rates = append(rates, l.Rate())
+	}
+	return rates
+}
+
+func TestConverges(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		initial float64
+	}{
+		{"FromBelow", 10},
+		{"FromAbove", 800},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			l, err := New(
+				WithBounds(1, 1000),
+				WithInitialRate(tc.initial),
+				WithIncrease(2),
+				WithDecrease(0.9),
+				WithClock(clock),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rates := simulate(l, clock, 100, time.Minute)
+
+			// After warming up the rate stays near the capacity
+			var sum float64
+			settled := rates[len(rates)/2:]
+			for _, r := range settled {
+				if r < 85 || r > 115 {
+					t.Fatalf("rate %.1f strayed from the capacity of 100", r)
+				}
+				sum += r
+			}
+			if mean := sum / float64(len(settled)); mean < 95 || mean > 110 {
+				t.Errorf("mean rate = %.1f, want near 100", mean)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	l, _ := New(WithBounds(10, 100), WithInitialRate(40), WithIncrease(5), WithClock(clock))
+
+	// Successes grow the rate once per interval
+	l.Report(nil)
+	if l.Rate() != 40 {
+		t.Fatalf("rate = %v, want 40 before an interval passed", l.Rate())
+	}
+	clock.Add(100 * time.Millisecond)
+	l.Report(nil)
+	l.Report(nil)
+	if l.Rate() != 45 {
+		t.Fatalf("rate = %v, want 45", l.Rate())
+	}
+
+	// A burst of failures halves it once
+	l.Report(errOverloaded)
+	l.Report(errOverloaded)
+	if l.Rate() != 22.5 {
+		t.Fatalf("rate = %v, want 22.5", l.Rate())
+	}
+
+	// Never below the minimum
+	clock.Add(100 * time.Millisecond)
+	l.Report(errOverloaded)
+	clock.Add(100 * time.Millisecond)
+	l.Report(errOverloaded)
+	if l.Rate() != 10 {
+		t.Fatalf("rate = %v, want the minimum 10", l.Rate())
+	}
+
+	s := l.Stats()
+	if s.Successes != 3 || s.Failures != 4 || s.Rate != 10 {
+		t.Errorf("Stats() = %+v", s)
+	}
+	want := []struct {
+		from, to float64
+		reason   Reason
+	}{
+		{40, 45, ReasonIncrease},
+		{45, 22.5, ReasonDecrease},
+		{22.5, 11.25, ReasonDecrease},
+		{11.25, 10, ReasonDecrease},
+	}
+	if len(s.History) != len(want) {
+		t.Fatalf("history has %d adjustments, want %d", len(s.History), len(want))
+	}
+	for i, w := range want {
+		a := s.History[i]
+		if a.From != w.from || a.To != w.to || a.Reason != w.reason {
+			t.Errorf("History[%d] = %+v, want %v -> %v (%v)", i, a, w.from, w.to, w.reason)
+		}
+	}
+}
+
+func TestHistoryBounded(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	l, _ := New(WithHistory(3), WithClock(clock))
+
+	for i := 0; i < 10; i++ {
+		clock.Add(100 * time.Millisecond)
+		l.Report(nil)
+	}
+
+	h := l.Stats().History
+	if len(h) != 3 || h[2].To != 11 {
+		t.Errorf("History = %+v, want the latest 3", h)
+	}
+}
+
+func TestDo(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	l, _ := New(WithInitialRate(100), WithClock(clock))
+
+	// Failures are reported
+	err := l.Do(context.Background(), func(context.Context) error { return errOverloaded })
+	if !errors.Is(err, errOverloaded) || l.Stats().Failures != 1 {
+		t.Fatalf("Do() = %v, failures = %d", err, l.Stats().Failures)
+	}
+
+	// Cancellation by the caller is not
+	ctx, cancel := context.WithCancel(context.Background())
+	l.Do(ctx, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if s := l.Stats(); s.Failures != 1 || s.Successes != 0 {
+		t.Errorf("Stats() = %+v, cancellation should not be reported", s)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithBounds(0, 10)},
+		{WithBounds(10, 5)},
+		{WithIncrease(0)},
+		{WithDecrease(1)},
+		{WithBurst(0)},
+	} {
+		if _, err := New(opts...); err == nil {
+			t.Errorf("New() should reject the options")
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Limiter {
+		l, err := New(WithInitialRate(20), WithBurst(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	})
+}
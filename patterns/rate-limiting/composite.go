@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// CompositeLimiter implements Limiter and Reporter.
+var _ Limiter = (*CompositeLimiter)(nil)
+var _ Reporter = (*CompositeLimiter)(nil)
+
+// compositePoll is how long Wait sleeps when no limiter reports a delay.
+const compositePoll = 10 * time.Millisecond
+
+// CompositeLimiter admits events only if all of its limiters do.
+type CompositeLimiter struct {
+	limiters []Limiter
+}
+
+// Composite returns a limiter that admits events only if every one of
+// limiters does, consuming from all of them or none. Every limiter but the
+// last must implement Refunder, so a rejection from a later limiter can
+// be undone in the earlier ones; Composite panics otherwise.
+func Composite(limiters ...Limiter) *CompositeLimiter {
+	for i, l := range limiters {
+		if _, ok := l.(Refunder); !ok && i < len(limiters)-1 {
+			panic(fmt.Sprintf("ratelimit: Composite limiter %d (%T) does not implement Refunder", i, l))
+		}
+	}
+	return &CompositeLimiter{limiters: limiters}
+}
+
+// Allow reports whether every limiter admits one event.
+func (c *CompositeLimiter) Allow() bool {
+	return c.AllowN(1)
+}
+
+// AllowN reports whether every limiter admits n events. Limiters that
+// implement Reporter are asked first, so an obvious rejection consumes
+// nothing. Otherwise the events are taken from each limiter in turn, and
+// refunded to those that admitted them if a later one rejects.
+func (c *CompositeLimiter) AllowN(n int) bool {
+	if n <= 0 {
+		return true
+	}
+
+	// Probe
+	for _, l := range c.limiters {
+		if r, ok := l.(Reporter); ok && r.Remaining() < n {
+			return false
+		}
+	}
+
+	// Take, or refund what was taken
+	for i, l := range c.limiters {
+		if l.AllowN(n) {
+			continue
+		}
+		for _, taken := range c.limiters[:i] {
+			taken.(Refunder).RefundN(n)
+		}
+		return false
+	}
+	return true
+}
+
+// Wait blocks until every limiter admits an event, or until ctx is done.
+// Between attempts it sleeps for the longest delay any limiter reports.
+func (c *CompositeLimiter) Wait(ctx context.Context) error {
+	for {
+		if c.Allow() {
+			return nil
+		}
+
+		d := c.RetryAfter()
+		if d <= 0 {
+			d = compositePoll
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Remaining returns the fewest events any Reporter limiter allows now.
+// Without Reporters it returns math.MaxInt32.
+func (c *CompositeLimiter) Remaining() int {
+	left := math.MaxInt32
+	for _, l := range c.limiters {
+		if r, ok := l.(Reporter); ok {
+			if n := r.Remaining(); n < left {
+				left = n
+			}
+		}
+	}
+	return left
+}
+
+// RetryAfter returns the longest delay any Reporter limiter reports.
+func (c *CompositeLimiter) RetryAfter() time.Duration {
+	var wait time.Duration
+	for _, l := range c.limiters {
+		if r, ok := l.(Reporter); ok {
+			if d := r.RetryAfter(); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// RefundN refunds n events to every limiter that implements Refunder.
+func (c *CompositeLimiter) RefundN(n int) {
+	for _, l := range c.limiters {
+		if r, ok := l.(Refunder); ok {
+			r.RefundN(n)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/ratelimittest"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// quota admits a fixed number of events and cannot report how many are
+// left, so a Composite has to take and refund.
+type quota struct {
+	mu   sync.Mutex
+	left int
+}
+
+func (q *quota) Allow() bool { return q.AllowN(1) }
+
+func (q *quota) AllowN(n int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > q.left {
+		return false
+	}
+	q.left -= n
+	return true
+}
+
+func (q *quota) Wait(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (q *quota) RefundN(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.left += n
+}
+
+func (q *quota) Left() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.left
+}
+
+// fixed never admits anything and does not refund.
+type fixed struct{}
+
+func (fixed) Allow() bool                { return false }
+func (fixed) AllowN(int) bool            { return false }
+func (fixed) Wait(context.Context) error { return errors.New("never") }
+
+func TestCompositeRefundsOnRejection(t *testing.T) {
+	a, b := &quota{left: 10}, &quota{left: 10}
+	last := &quota{left: 1}
+	c := ratelimit.Composite(a, b, last)
+
+	if !c.Allow() {
+		t.Fatal("Allow() should admit while every limiter has quota")
+	}
+
+	// The last limiter rejects, the others get their quota back
+	if c.AllowN(1) {
+		t.Fatal("AllowN(1) should be rejected by the last limiter")
+	}
+	if a.Left() != 9 || b.Left() != 9 {
+		t.Errorf("quota left = %d and %d, want 9 and 9", a.Left(), b.Left())
+	}
+}
+
+func TestCompositeProbesReporters(t *testing.T) {
+	w, _ := window.New(time.Second, 100*time.Millisecond, 10)
+	w.SetLimit(5)
+
+	// Never filled during the test
+	bucket := tokenbucket.New(1, 1)
+	defer bucket.Close()
+
+	c := ratelimit.Composite(w, bucket)
+	if c.AllowN(2) {
+		t.Fatal("AllowN(2) should be rejected by the empty bucket")
+	}
+	if w.Used() != 0 {
+		t.Errorf("window used %d, want none consumed", w.Used())
+	}
+	if r := c.Remaining(); r != 0 {
+		t.Errorf("Remaining() = %d, want 0", r)
+	}
+}
+
+func TestCompositeNonRefunderLast(t *testing.T) {
+	a := &quota{left: 10}
+	c := ratelimit.Composite(a, fixed{})
+
+	if c.Allow() {
+		t.Fatal("Allow() should be rejected")
+	}
+	if a.Left() != 10 {
+		t.Errorf("quota left = %d, want 10", a.Left())
+	}
+}
+
+func TestCompositeNonRefunderPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Composite should panic when an earlier limiter cannot refund")
+		}
+	}()
+	ratelimit.Composite(fixed{}, &quota{})
+}
+
+func TestCompositeWaitLongest(t *testing.T) {
+	w, _ := window.New(time.Second, 100*time.Millisecond, 10)
+	w.SetLimit(1)
+	w.Allow()
+
+	short, _ := window.New(100*time.Millisecond, 100*time.Millisecond, 1)
+	short.SetLimit(1)
+	short.Allow()
+
+	c := ratelimit.Composite(short, w)
+	if d := c.RetryAfter(); d < 500*time.Millisecond {
+		t.Errorf("RetryAfter() = %v, want the longer delay", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := c.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The short window freed up meanwhile, but was not consumed
+	if short.Used() != 0 {
+		t.Errorf("short window used %d, want 0", short.Used())
+	}
+}
+
+func TestCompositeConformance(t *testing.T) {
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Limiter {
+		w, _ := window.New(time.Second, 100*time.Millisecond, 10)
+		w.SetLimit(100)
+		bucket := tokenbucket.New(20, 5)
+		t.Cleanup(func() { bucket.Close() })
+		return ratelimit.Composite(w, bucket)
+	})
+}
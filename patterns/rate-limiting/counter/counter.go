@@ -2,34 +2,78 @@
 
 package counter
 
-import "time"
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// Counter implements ratelimit.Limiter and ratelimit.Reporter.
+var _ ratelimit.Limiter = (*Counter)(nil)
+var _ ratelimit.Reporter = (*Counter)(nil)
 
 // Counter for rate limiting
 type Counter struct {
-	reqs int       // Number of current requests
-	last time.Time // Time of last request
-	rps  int       // Requests per second allowed
+	mu    sync.Mutex
+	clock clock.Clock // Clock measuring the time between requests
+	reqs  int         // Number of current requests
+	last  time.Time   // Time of last request
+	rps   int         // Requests per second allowed
+}
+
+// Option configures a Counter
+type Option func(*Counter)
+
+// WithClock sets the clock measuring the time between requests, the
+// system clock by default
+func WithClock(clk clock.Clock) Option {
+	return func(c *Counter) {
+		c.clock = clk
+	}
 }
 
 // New creates a new rate limiter
-func New(rps int) *Counter {
-	return &Counter{
-		rps: rps,
+func New(rps int, opts ...Option) *Counter {
+	c := &Counter{
+		clock: clock.New(),
+		rps:   rps,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Allow checks if request is allowed under limit
 func (c *Counter) Allow() bool {
-	now := time.Now()
+	return c.AllowN(1)
+}
+
+// AllowN checks if n requests are allowed under limit at once.
+// Like Allow, rejected requests still count towards the next check.
+func (c *Counter) AllowN(n int) bool {
+	if n <= 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
 	if c.last.IsZero() {
 		// First request, do not limit
 		c.last = now
-		c.reqs = 1
+		c.reqs = n
 		return true
 	}
 
 	elapsed := now.Sub(c.last)
-	c.reqs++
+	c.reqs += n
 
 	// Check if requests exceed RPS
 	if float64(c.reqs) > float64(c.rps)*elapsed.Seconds() {
@@ -41,3 +85,96 @@ func (c *Counter) Allow() bool {
 	c.reqs = 0
 	return true
 }
+
+// Wait blocks until a request is allowed or ctx is done.
+func (c *Counter) Wait(ctx context.Context) error {
+	for {
+		// Only try once enough time has passed, so waiting does not
+		// add rejected requests
+		d := c.RetryAfter()
+		if d <= 0 {
+			if c.Allow() {
+				return nil
+			}
+			continue
+		}
+
+		timer := c.clock.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// Remaining returns how many requests are allowed now.
+func (c *Counter) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last.IsZero() {
+		return c.rps
+	}
+
+	allowed := float64(c.rps) * c.clock.Now().Sub(c.last).Seconds()
+	if allowed > math.MaxInt32 {
+		allowed = math.MaxInt32
+	}
+	if left := int(allowed) - c.reqs; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// RetryAfter returns how long until the next request is allowed.
+func (c *Counter) RetryAfter() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last.IsZero() {
+		return 0
+	}
+
+	// Requests are never allowed again without a rate
+	if c.rps <= 0 {
+		return math.MaxInt64
+	}
+
+	// The next request needs (reqs+1)/rps seconds since the last one
+	need := time.Duration(float64(c.reqs+1) / float64(c.rps) * float64(time.Second))
+	if d := need - c.clock.Now().Sub(c.last); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// snapshot is the saved state of a Counter.
+type snapshot struct {
+	Reqs int       `json:"reqs"`
+	Last time.Time `json:"last"`
+}
+
+// Snapshot returns the pending requests and the time of the last allowed
+// one as JSON.
+func (c *Counter) Snapshot() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return json.Marshal(snapshot{Reqs: c.reqs, Last: c.last})
+}
+
+// Restore sets the state from a Snapshot.
+func (c *Counter) Restore(data []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reqs = s.Reqs
+	c.last = s.Last
+	return nil
+}
@@ -4,6 +4,11 @@ package counter
 
 import (
 	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/ratelimittest"
 )
 
 func TestNew(t *testing.T) {
@@ -64,3 +69,35 @@ func TestAllow(t *testing.T) {
 
 	// ... more tests
 }
+
+func TestConformance(t *testing.T) {
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Limiter {
+		return New(20)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	limiter := New(10, WithClock(clk))
+
+	if limiter.RetryAfter() != 0 {
+		t.Error("First request should not wait")
+	}
+
+	limiter.Allow()
+	limiter.Allow()
+
+	// The first and the rejected second request are counted, so the
+	// third needs 0.3s at 10 rps
+	if d := limiter.RetryAfter(); d != 300*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 300ms", d)
+	}
+
+	clk.Add(300 * time.Millisecond)
+	if d := limiter.RetryAfter(); d != 0 {
+		t.Errorf("RetryAfter = %v after waiting, want 0", d)
+	}
+	if !limiter.Allow() {
+		t.Error("Request after RetryAfter should be allowed")
+	}
+}
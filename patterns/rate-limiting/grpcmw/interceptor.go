@@ -0,0 +1,176 @@
+// ratelimit/grpcmw/interceptor.go
+
+// Package grpcmw provides gRPC server interceptors built on
+// ratelimit.Limiter.
+package grpcmw
+
+import (
+	"context"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Option configures the interceptors.
+type Option func(*config)
+
+type config struct {
+	methods    map[string]ratelimit.Limiter
+	newLimiter func(key string) ratelimit.Limiter
+	maxKeys    int
+	wait       bool
+}
+
+// WithMethodLimits limits the listed methods, keyed by full method name
+// such as "/pkg.Service/Method", with their own limiters instead of the
+// shared one.
+func WithMethodLimits(limits map[string]ratelimit.Limiter) Option {
+	return func(c *config) {
+		c.methods = limits
+	}
+}
+
+// WithPerKey gives every key returned by the key function its own limiter,
+// created by newLimiter on first use.
+func WithPerKey(newLimiter func(key string) ratelimit.Limiter) Option {
+	return func(c *config) {
+		c.newLimiter = newLimiter
+	}
+}
+
+// WithMaxKeys bounds the number of per-key limiters kept, dropping the
+// least recently used key when full. The default is 10000.
+func WithMaxKeys(n int) Option {
+	return func(c *config) {
+		c.maxKeys = n
+	}
+}
+
+// WithWait makes the interceptors wait for the limiter instead of
+// rejecting, bounded by the request deadline.
+func WithWait() Option {
+	return func(c *config) {
+		c.wait = true
+	}
+}
+
+// UnaryServerInterceptor limits unary calls with l. Denied calls fail with
+// codes.ResourceExhausted, carrying a RetryInfo detail when the limiter
+// implements ratelimit.Reporter.
+//
+// If keyFn is set and WithPerKey is given, calls are limited per key.
+// Methods listed in WithMethodLimits always use their own limiter.
+func UnaryServerInterceptor(l ratelimit.Limiter, keyFn func(ctx context.Context, info *grpc.UnaryServerInfo) string, opts ...Option) grpc.UnaryServerInterceptor {
+	lim := newLimiters(l, opts)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var key func() string
+		if keyFn != nil {
+			key = func() string { return keyFn(ctx, info) }
+		}
+		if err := lim.take(ctx, info.FullMethod, key); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming equivalent of
+// UnaryServerInterceptor. It limits the opening of streams, not the
+// messages sent on them.
+func StreamServerInterceptor(l ratelimit.Limiter, keyFn func(ctx context.Context, info *grpc.StreamServerInfo) string, opts ...Option) grpc.StreamServerInterceptor {
+	lim := newLimiters(l, opts)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+
+		var key func() string
+		if keyFn != nil {
+			key = func() string { return keyFn(ctx, info) }
+		}
+		if err := lim.take(ctx, info.FullMethod, key); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// limiters selects the limiter for each call.
+type limiters struct {
+	config
+	shared ratelimit.Limiter
+	keys   *ratelimit.Keyed
+}
+
+func newLimiters(l ratelimit.Limiter, opts []Option) *limiters {
+	lim := &limiters{shared: l}
+	for _, opt := range opts {
+		opt(&lim.config)
+	}
+	if lim.newLimiter != nil {
+		lim.keys = ratelimit.NewKeyed(lim.maxKeys, lim.newLimiter)
+	}
+	return lim
+}
+
+// take admits one call to method or returns the status error to fail it
+// with. key is nil when there is no key function.
+func (lim *limiters) take(ctx context.Context, method string, key func() string) error {
+	l := lim.pick(method, key)
+	if l == nil {
+		return nil
+	}
+
+	if lim.wait {
+		if err := l.Wait(ctx); err == nil {
+			return nil
+		}
+	} else if l.Allow() {
+		return nil
+	}
+
+	return exhausted(l)
+}
+
+// pick returns the limiter for a call, or nil if it is not limited.
+func (lim *limiters) pick(method string, key func() string) ratelimit.Limiter {
+	if l, ok := lim.methods[method]; ok {
+		return l
+	}
+
+	if key == nil || lim.keys == nil {
+		return lim.shared
+	}
+	return lim.keys.Get(key())
+}
+
+// exhausted builds the ResourceExhausted error for a denied call.
+func exhausted(l ratelimit.Limiter) error {
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+
+	r, ok := l.(ratelimit.Reporter)
+	if !ok {
+		return st.Err()
+	}
+
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(retryDelay(r.RetryAfter())),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// retryDelay keeps the delay positive so clients always back off.
+func retryDelay(d time.Duration) time.Duration {
+	if d <= 0 {
+		return time.Millisecond
+	}
+	return d
+}
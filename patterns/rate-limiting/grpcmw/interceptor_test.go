@@ -0,0 +1,213 @@
+package grpcmw
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// quota allows a fixed number of events and never refills. Wait blocks
+// until release is closed.
+type quota struct {
+	mu      sync.Mutex
+	left    int
+	release chan struct{}
+}
+
+func newQuota(n int) *quota {
+	return &quota{left: n, release: make(chan struct{})}
+}
+
+func (q *quota) Allow() bool { return q.AllowN(1) }
+
+func (q *quota) AllowN(n int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > q.left {
+		return false
+	}
+	q.left -= n
+	return true
+}
+
+func (q *quota) Wait(ctx context.Context) error {
+	if q.Allow() {
+		return nil
+	}
+	select {
+	case <-q.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *quota) Remaining() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.left
+}
+
+func (q *quota) RetryAfter() time.Duration { return 2 * time.Second }
+
+// dial starts a health server over bufconn with the given options and
+// returns a client for it.
+func dial(t *testing.T, opts ...grpc.ServerOption) healthpb.HealthClient {
+	lis := bufconn.Listen(1 << 20)
+
+	srv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func check(c healthpb.HealthClient, ctx context.Context) error {
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestUnaryReject(t *testing.T) {
+	c := dial(t, grpc.UnaryInterceptor(UnaryServerInterceptor(newQuota(1), nil)))
+	ctx := context.Background()
+
+	if err := check(c, ctx); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+
+	err := check(c, ctx)
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("code = %v, want %v", st.Code(), codes.ResourceExhausted)
+	}
+
+	// The retry delay is carried as a detail
+	var delay time.Duration
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			delay = info.RetryDelay.AsDuration()
+		}
+	}
+	if delay != 2*time.Second {
+		t.Errorf("retry delay = %v, want 2s", delay)
+	}
+}
+
+func TestUnaryWait(t *testing.T) {
+	q := newQuota(0)
+	c := dial(t, grpc.UnaryInterceptor(UnaryServerInterceptor(q, nil, WithWait())))
+
+	// The deadline bounds the wait
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := check(c, ctx); status.Code(err) == codes.OK {
+		t.Error("call should fail when the deadline passes first")
+	}
+
+	// Released calls go through
+	done := make(chan error)
+	go func() { done <- check(c, context.Background()) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("call should wait for the limiter, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(q.release)
+	if err := <-done; err != nil {
+		t.Errorf("call after release: %v", err)
+	}
+}
+
+func TestUnaryKeyed(t *testing.T) {
+	keyFn := func(ctx context.Context, _ *grpc.UnaryServerInfo) string {
+		md, _ := metadata.FromIncomingContext(ctx)
+		return md.Get("client")[0]
+	}
+	perKey := WithPerKey(func(string) ratelimit.Limiter { return newQuota(1) })
+	c := dial(t, grpc.UnaryInterceptor(UnaryServerInterceptor(nil, keyFn, perKey)))
+
+	as := func(client string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "client", client)
+	}
+
+	if err := check(c, as("a")); err != nil {
+		t.Errorf("client a: %v", err)
+	}
+	if err := check(c, as("b")); err != nil {
+		t.Errorf("client b: %v", err)
+	}
+	if err := check(c, as("a")); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("client a again: %v, want ResourceExhausted", err)
+	}
+}
+
+func TestUnaryMethodLimits(t *testing.T) {
+	limits := WithMethodLimits(map[string]ratelimit.Limiter{
+		"/grpc.health.v1.Health/Check": newQuota(0),
+	})
+	c := dial(t, grpc.UnaryInterceptor(UnaryServerInterceptor(newQuota(100), nil, limits)))
+
+	if err := check(c, context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Check: %v, want ResourceExhausted", err)
+	}
+}
+
+func TestStreamReject(t *testing.T) {
+	c := dial(t, grpc.StreamInterceptor(StreamServerInterceptor(newQuota(1), nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The first stream is admitted and gets the initial status
+	s, err := c.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Recv(); err != nil {
+		t.Fatalf("first stream: %v", err)
+	}
+
+	// The second one is rejected
+	s, err = c.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second stream: %v, want ResourceExhausted", err)
+	}
+}
+
+func TestNoReporter(t *testing.T) {
+	err := exhausted(struct{ ratelimit.Limiter }{newQuota(0)})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || len(st.Details()) != 0 {
+		t.Errorf("exhausted() = %v with %d details, want ResourceExhausted without details", err, len(st.Details()))
+	}
+}
@@ -0,0 +1,247 @@
+// Package hierarchy implements a two-level rate limiter: a parent limiter
+// shared by the whole service and a child limiter per tenant. A tenant's
+// events count against both, so tenants may use the headroom others leave
+// under the global ceiling but never exceed their own cap.
+package hierarchy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// Child implements ratelimit.Limiter.
+var _ ratelimit.Limiter = (*Child)(nil)
+
+// pollInterval is how long Wait sleeps when no limiter reports a delay.
+const pollInterval = 10 * time.Millisecond
+
+// ChildStats is a snapshot of one tenant's consumption.
+type ChildStats struct {
+	Allowed        uint64 // Events admitted by both limiters
+	RejectedOwn    uint64 // Events rejected by the tenant's own cap
+	RejectedParent uint64 // Events the tenant's cap admitted but the parent rejected
+}
+
+// Limiter holds the parent limiter and a child per tenant.
+type Limiter struct {
+	parent   ratelimit.Limiter
+	newChild func(tenant string) ratelimit.Limiter
+
+	mu       sync.RWMutex
+	children map[string]*Child
+}
+
+// New creates a Limiter under parent. Tenants seen for the first time get
+// a child limiter from newChild; if newChild is nil, only tenants added
+// with Add are admitted. The limiters newChild returns must implement
+// ratelimit.Refunder.
+func New(parent ratelimit.Limiter, newChild func(tenant string) ratelimit.Limiter) *Limiter {
+	return &Limiter{
+		parent:   parent,
+		newChild: newChild,
+		children: make(map[string]*Child),
+	}
+}
+
+// Add sets the limiter of tenant, replacing its current one and its
+// stats. The limiter must implement ratelimit.Refunder, so events it
+// admitted can be given back when the parent rejects them.
+func (h *Limiter) Add(tenant string, l ratelimit.Limiter) (*Child, error) {
+	c, err := h.child(tenant, l)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.children[tenant] = c
+	return c, nil
+}
+
+// Remove drops tenant and reports whether it was there. A Child obtained
+// earlier keeps working, but no longer shows in Stats.
+func (h *Limiter) Remove(tenant string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := h.children[tenant]
+	delete(h.children, tenant)
+	return ok
+}
+
+// Child returns the limiter of tenant, creating it with the factory passed
+// to New if needed. It returns nil for an unknown tenant without a
+// factory, and panics if the factory returns a limiter that does not
+// implement ratelimit.Refunder.
+func (h *Limiter) Child(tenant string) *Child {
+	h.mu.RLock()
+	c, ok := h.children[tenant]
+	h.mu.RUnlock()
+	if ok || h.newChild == nil {
+		return c
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Another caller may have created it meanwhile
+	if c, ok := h.children[tenant]; ok {
+		return c
+	}
+	c, err := h.child(tenant, h.newChild(tenant))
+	if err != nil {
+		panic(err)
+	}
+	h.children[tenant] = c
+	return c
+}
+
+// Allow reports whether tenant may have one event now.
+func (h *Limiter) Allow(tenant string) bool {
+	return h.AllowN(tenant, 1)
+}
+
+// AllowN reports whether tenant may have n events now. Unknown tenants
+// are rejected when there is no factory.
+func (h *Limiter) AllowN(tenant string, n int) bool {
+	c := h.Child(tenant)
+	if c == nil {
+		return n <= 0
+	}
+	return c.AllowN(n)
+}
+
+// Wait blocks until tenant may have one event, or until ctx is done.
+func (h *Limiter) Wait(ctx context.Context, tenant string) error {
+	c := h.Child(tenant)
+	if c == nil {
+		return fmt.Errorf("unknown tenant %q", tenant)
+	}
+	return c.Wait(ctx)
+}
+
+// Tenants returns the tenants, sorted.
+func (h *Limiter) Tenants() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	tenants := make([]string, 0, len(h.children))
+	for tenant := range h.children {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Stats returns the consumption of every tenant.
+func (h *Limiter) Stats() map[string]ChildStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats := make(map[string]ChildStats, len(h.children))
+	for tenant, c := range h.children {
+		stats[tenant] = c.Stats()
+	}
+	return stats
+}
+
+// child wraps l as the child of tenant.
+func (h *Limiter) child(tenant string, l ratelimit.Limiter) (*Child, error) {
+	own, ok := l.(ratelimit.Refunder)
+	if !ok {
+		return nil, fmt.Errorf("limiter %T of tenant %q does not implement ratelimit.Refunder", l, tenant)
+	}
+	return &Child{own: l, refund: own, parent: h.parent}, nil
+}
+
+// Child is a tenant's limiter. Its events count against both the tenant's
+// own limiter and the parent, or neither.
+type Child struct {
+	own    ratelimit.Limiter
+	refund ratelimit.Refunder
+	parent ratelimit.Limiter
+
+	allowed        atomic.Uint64
+	rejectedOwn    atomic.Uint64
+	rejectedParent atomic.Uint64
+}
+
+// Allow reports whether one event may happen now.
+func (c *Child) Allow() bool {
+	return c.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now under both the tenant's
+// cap and the parent. The tenant's limiter is asked first; if the parent
+// then rejects, the tenant's events are refunded.
+func (c *Child) AllowN(n int) bool {
+	if n <= 0 {
+		return true
+	}
+
+	if r, ok := c.own.(ratelimit.Reporter); ok && r.Remaining() < n {
+		c.rejectedOwn.Add(uint64(n))
+		return false
+	}
+	if !c.own.AllowN(n) {
+		c.rejectedOwn.Add(uint64(n))
+		return false
+	}
+	if !c.parent.AllowN(n) {
+		c.refund.RefundN(n)
+		c.rejectedParent.Add(uint64(n))
+		return false
+	}
+
+	c.allowed.Add(uint64(n))
+	return true
+}
+
+// Wait blocks until one event may happen, or until ctx is done. Between
+// attempts it sleeps for the longer delay the two limiters report.
+func (c *Child) Wait(ctx context.Context) error {
+	for {
+		if c.Allow() {
+			return nil
+		}
+
+		d := retryAfter(c.own)
+		if p := retryAfter(c.parent); p > d {
+			d = p
+		}
+		if d <= 0 {
+			d = pollInterval
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Stats returns the tenant's consumption.
+func (c *Child) Stats() ChildStats {
+	return ChildStats{
+		Allowed:        c.allowed.Load(),
+		RejectedOwn:    c.rejectedOwn.Load(),
+		RejectedParent: c.rejectedParent.Load(),
+	}
+}
+
+// retryAfter returns the delay l reports, or zero if it cannot tell.
+func retryAfter(l ratelimit.Limiter) time.Duration {
+	if r, ok := l.(ratelimit.Reporter); ok {
+		return r.RetryAfter()
+	}
+	return 0
+}
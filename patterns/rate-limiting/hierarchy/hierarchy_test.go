@@ -0,0 +1,219 @@
+package hierarchy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// fakeClock is a clock moved by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// perSecond returns a window admitting limit events per second.
+func perSecond(clock *fakeClock, limit int) *window.SlidingWindow {
+	w, _ := window.New(time.Second, 100*time.Millisecond, 10, window.WithClock(clock))
+	w.SetLimit(limit)
+	return w
+}
+
+// newLimiter returns a Limiter admitting 100 events per second overall and
+// 30 per tenant, and the tenant windows by name.
+func newLimiter(clock *fakeClock) (*Limiter, map[string]*window.SlidingWindow) {
+	windows := make(map[string]*window.SlidingWindow)
+	h := New(perSecond(clock, 100), func(tenant string) ratelimit.Limiter {
+		windows[tenant] = perSecond(clock, 30)
+		return windows[tenant]
+	})
+	return h, windows
+}
+
+func TestHotTenantCapped(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	h, _ := newLimiter(clock)
+
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		if h.Allow("hot") {
+			allowed++
+		}
+	}
+	if allowed != 30 {
+		t.Errorf("hot tenant got %d events, want its cap of 30", allowed)
+	}
+
+	want := ChildStats{Allowed: 30, RejectedOwn: 70}
+	if s := h.Stats()["hot"]; s != want {
+		t.Errorf("Stats()[hot] = %+v, want %+v", s, want)
+	}
+
+	// The global headroom is still there for others
+	if !h.Allow("other") {
+		t.Error("another tenant should not be affected")
+	}
+}
+
+func TestAggregateReachesCeiling(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	h, windows := newLimiter(clock)
+
+	// Five tenants with caps of 30 compete for 100
+	total := 0
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 5; j++ {
+			if h.Allow(fmt.Sprint("tenant-", j)) {
+				total++
+			}
+		}
+	}
+	if total != 100 {
+		t.Errorf("admitted %d events in total, want the ceiling of 100", total)
+	}
+
+	// Events the parent rejected were refunded to the tenants
+	for tenant, s := range h.Stats() {
+		if used := windows[tenant].Used(); uint64(used) != s.Allowed {
+			t.Errorf("%s used %d of its cap, but was allowed %d", tenant, used, s.Allowed)
+		}
+		if s.RejectedParent == 0 {
+			t.Errorf("%s should have been rejected by the parent", tenant)
+		}
+	}
+
+	// Everyone recovers when the window slides
+	clock.Add(time.Second)
+	if !h.Allow("tenant-0") {
+		t.Error("tenant should be admitted again after a second")
+	}
+}
+
+func TestAddRemove(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	h := New(perSecond(clock, 100), nil)
+
+	// Unknown tenants are rejected without a factory
+	if h.Allow("a") {
+		t.Fatal("unknown tenant should be rejected")
+	}
+	if err := h.Wait(context.Background(), "a"); err == nil {
+		t.Error("Wait() should fail for an unknown tenant")
+	}
+
+	if _, err := h.Add("a", perSecond(clock, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if !h.Allow("a") || h.Allow("a") {
+		t.Fatal("tenant a should get exactly its cap of 1")
+	}
+
+	// Replacing the limiter raises the cap and resets the stats
+	h.Add("a", perSecond(clock, 5))
+	if !h.Allow("a") {
+		t.Error("tenant a should be admitted under its new cap")
+	}
+	if s := h.Stats()["a"]; s.Allowed != 1 {
+		t.Errorf("Stats()[a] = %+v, want stats since the replacement", s)
+	}
+
+	if got := h.Tenants(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("Tenants() = %v, want [a]", got)
+	}
+	if !h.Remove("a") || h.Remove("a") {
+		t.Error("Remove should report whether the tenant was there")
+	}
+	if h.Allow("a") {
+		t.Error("removed tenant should be rejected")
+	}
+}
+
+// plain is a limiter that cannot refund.
+type plain struct{}
+
+func (plain) Allow() bool                { return true }
+func (plain) AllowN(int) bool            { return true }
+func (plain) Wait(context.Context) error { return nil }
+
+func TestAddRequiresRefunder(t *testing.T) {
+	h := New(plain{}, nil)
+	if _, err := h.Add("a", plain{}); err == nil {
+		t.Error("Add should reject a limiter that cannot refund")
+	}
+}
+
+func TestWait(t *testing.T) {
+	h := New(plain{}, nil)
+	w, _ := window.New(100*time.Millisecond, 100*time.Millisecond, 1)
+	w.SetLimit(1)
+	c, _ := h.Add("a", w)
+
+	c.Allow()
+
+	// Waits for the tenant's window to slide
+	start := time.Now()
+	if err := h.Wait(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Wait should wait for the tenant's cap")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	h := New(perSecond(clock, 100), func(string) ratelimit.Limiter {
+		return perSecond(clock, 30)
+	})
+
+	var mu sync.Mutex
+	total := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(tenant string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if h.Allow(tenant) {
+					mu.Lock()
+					total++
+					mu.Unlock()
+				}
+			}
+		}(fmt.Sprint("tenant-", i%4))
+	}
+	wg.Wait()
+
+	if total != 100 {
+		t.Errorf("admitted %d events, want the ceiling of 100", total)
+	}
+	for tenant, s := range h.Stats() {
+		if s.Allowed > 30 {
+			t.Errorf("%s got %d events, over its cap", tenant, s.Allowed)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// ratelimit/httpmw/middleware.go
+
+// Package httpmw provides net/http middleware built on ratelimit.Limiter,
+// so every handler gets the same 429 semantics.
+package httpmw
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// KeyFunc selects the key a request is limited by.
+type KeyFunc func(r *http.Request) string
+
+// Option configures the middleware.
+type Option func(*config)
+
+type config struct {
+	keyFunc    KeyFunc
+	newLimiter func(key string) ratelimit.Limiter
+	maxKeys    int
+	wait       bool
+}
+
+// WithKeyFunc sets how requests are mapped to keys in keyed mode.
+// The default is RemoteIP.
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(c *config) {
+		c.keyFunc = fn
+	}
+}
+
+// WithForwardedFor keys requests by ForwardedIP instead of RemoteIP. Only
+// use it behind a proxy that sets X-Forwarded-For, since clients can forge it.
+func WithForwardedFor() Option {
+	return WithKeyFunc(ForwardedIP)
+}
+
+// WithPerKey enables keyed mode: every key gets its own limiter, created by
+// newLimiter on first use. The limiter passed to Middleware is not used and
+// may be nil.
+func WithPerKey(newLimiter func(key string) ratelimit.Limiter) Option {
+	return func(c *config) {
+		c.newLimiter = newLimiter
+	}
+}
+
+// WithMaxKeys bounds the number of per-key limiters kept, dropping the
+// least recently used key when full. The default is 10000.
+func WithMaxKeys(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxKeys = n
+		}
+	}
+}
+
+// WithWaitMode makes the middleware block until the limiter allows the
+// request instead of rejecting it. The wait ends with a 429 if the request
+// context is done first.
+func WithWaitMode() Option {
+	return func(c *config) {
+		c.wait = true
+	}
+}
+
+// Middleware limits requests with l. Rejected requests get a 429 response.
+// If the limiter implements ratelimit.Reporter, responses carry
+// X-RateLimit-Remaining, and rejections carry Retry-After and
+// X-RateLimit-Reset.
+func Middleware(l ratelimit.Limiter, opts ...Option) func(http.Handler) http.Handler {
+	c := &config{
+		keyFunc: RemoteIP,
+		maxKeys: 10000,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Select the limiter for each request
+	limiterFor := func(*http.Request) ratelimit.Limiter { return l }
+	if c.newLimiter != nil {
+		keys := ratelimit.NewKeyed(c.maxKeys, c.newLimiter)
+		limiterFor = func(r *http.Request) ratelimit.Limiter {
+			return keys.Get(c.keyFunc(r))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lim := limiterFor(r)
+
+			var allowed bool
+			if c.wait {
+				allowed = lim.Wait(r.Context()) == nil
+			} else {
+				allowed = lim.Allow()
+			}
+
+			rep, hasReporter := lim.(ratelimit.Reporter)
+			if hasReporter {
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(rep.Remaining()))
+			}
+
+			if !allowed {
+				if hasReporter {
+					secs := retrySeconds(rep.RetryAfter())
+					w.Header().Set("Retry-After", secs)
+					w.Header().Set("X-RateLimit-Reset", secs)
+				}
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RemoteIP returns the IP address the request came from.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedIP returns the first address in X-Forwarded-For, which is the
+// original client, falling back to RemoteIP.
+func ForwardedIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		if ip := strings.TrimSpace(first); ip != "" {
+			return ip
+		}
+	}
+	return RemoteIP(r)
+}
+
+// retrySeconds formats d as whole seconds, rounded up, for Retry-After.
+func retrySeconds(d time.Duration) string {
+	secs := math.Ceil(d.Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	if secs > math.MaxInt32 {
+		secs = math.MaxInt32
+	}
+	return strconv.Itoa(int(secs))
+}
@@ -0,0 +1,223 @@
+package httpmw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// quota allows a fixed number of events and never refills. Wait blocks
+// until release is closed.
+type quota struct {
+	mu      sync.Mutex
+	left    int
+	release chan struct{}
+}
+
+func newQuota(n int) *quota {
+	return &quota{left: n, release: make(chan struct{})}
+}
+
+func (q *quota) Allow() bool { return q.AllowN(1) }
+
+func (q *quota) AllowN(n int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > q.left {
+		return false
+	}
+	q.left -= n
+	return true
+}
+
+func (q *quota) Wait(ctx context.Context) error {
+	if q.Allow() {
+		return nil
+	}
+	select {
+	case <-q.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *quota) Remaining() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.left
+}
+
+func (q *quota) RetryAfter() time.Duration { return 1500 * time.Millisecond }
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func serve(h http.Handler, remoteAddr, xff string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareReject(t *testing.T) {
+	h := Middleware(newQuota(2))(okHandler)
+
+	for i := 0; i < 2; i++ {
+		rec := serve(h, "10.0.0.1:1234", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: code = %v, want 200", i, rec.Code)
+		}
+		if got, want := rec.Header().Get("X-RateLimit-Remaining"), []string{"1", "0"}[i]; got != want {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %q", i, got, want)
+		}
+	}
+
+	rec := serve(h, "10.0.0.1:1234", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("code = %v, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if got := rec.Header().Get("X-RateLimit-Reset"); got != "2" {
+		t.Errorf("X-RateLimit-Reset = %q, want %q", got, "2")
+	}
+}
+
+// allowOnly is a limiter without Reporter.
+type allowOnly struct{ ratelimit.Limiter }
+
+func TestMiddlewareNoReporter(t *testing.T) {
+	h := Middleware(allowOnly{newQuota(0)})(okHandler)
+
+	rec := serve(h, "10.0.0.1:1234", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("code = %v, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "" || rec.Header().Get("X-RateLimit-Remaining") != "" {
+		t.Errorf("unexpected rate limit headers: %v", rec.Header())
+	}
+}
+
+func TestMiddlewareWait(t *testing.T) {
+	q := newQuota(0)
+	h := Middleware(q, WithWaitMode())(okHandler)
+
+	// The request is held until the limiter releases it
+	done := make(chan int)
+	go func() {
+		done <- serve(h, "10.0.0.1:1234", "").Code
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("request should wait for the limiter")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(q.release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("code = %v, want 200", code)
+	}
+}
+
+func TestMiddlewareWaitCancelled(t *testing.T) {
+	h := Middleware(newQuota(0), WithWaitMode())(okHandler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("code = %v, want 429", rec.Code)
+	}
+}
+
+func TestMiddlewareKeyed(t *testing.T) {
+	var created []string
+	h := Middleware(nil, WithPerKey(func(key string) ratelimit.Limiter {
+		created = append(created, key)
+		return newQuota(1)
+	}))(okHandler)
+
+	// Each client gets its own quota
+	if rec := serve(h, "10.0.0.1:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("first client: code = %v, want 200", rec.Code)
+	}
+	if rec := serve(h, "10.0.0.1:5678", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("first client again: code = %v, want 429", rec.Code)
+	}
+	if rec := serve(h, "10.0.0.2:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("second client: code = %v, want 200", rec.Code)
+	}
+
+	if len(created) != 2 || created[0] != "10.0.0.1" || created[1] != "10.0.0.2" {
+		t.Errorf("created = %v, want [10.0.0.1 10.0.0.2]", created)
+	}
+}
+
+func TestMiddlewareForwardedFor(t *testing.T) {
+	h := Middleware(nil, WithForwardedFor(), WithPerKey(func(string) ratelimit.Limiter {
+		return newQuota(1)
+	}))(okHandler)
+
+	// Same proxy, different clients
+	if rec := serve(h, "10.0.0.1:1234", "192.168.0.1, 10.0.0.1"); rec.Code != http.StatusOK {
+		t.Errorf("first client: code = %v, want 200", rec.Code)
+	}
+	if rec := serve(h, "10.0.0.1:1234", "192.168.0.2"); rec.Code != http.StatusOK {
+		t.Errorf("second client: code = %v, want 200", rec.Code)
+	}
+	if rec := serve(h, "10.0.0.1:1234", "192.168.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("first client again: code = %v, want 429", rec.Code)
+	}
+}
+
+func TestMiddlewareMaxKeys(t *testing.T) {
+	h := Middleware(nil, WithMaxKeys(1), WithPerKey(func(string) ratelimit.Limiter {
+		return newQuota(1)
+	}))(okHandler)
+
+	serve(h, "10.0.0.1:1234", "")
+	serve(h, "10.0.0.2:1234", "")
+
+	// The first key was dropped, so it starts over with a fresh quota
+	if rec := serve(h, "10.0.0.1:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("code = %v, want 200", rec.Code)
+	}
+}
+
+func TestForwardedIP(t *testing.T) {
+	tests := []struct {
+		remote, xff, want string
+	}{
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "192.168.0.1", "192.168.0.1"},
+		{"10.0.0.1:1234", " 192.168.0.1 , 10.0.0.2", "192.168.0.1"},
+		{"10.0.0.1", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if got := ForwardedIP(req); got != tt.want {
+			t.Errorf("ForwardedIP(%q, %q) = %q, want %q", tt.remote, tt.xff, got, tt.want)
+		}
+	}
+}
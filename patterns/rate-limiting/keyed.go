@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Keyed keeps a separate limiter per key, created on first use. Memory is
+// bounded by dropping the least recently used key when full.
+type Keyed struct {
+	sync.Mutex
+
+	// capacity is the maximum number of keys kept.
+	capacity int
+
+	// newLimiter creates the limiter for a new key.
+	newLimiter func(key string) Limiter
+
+	// entries maps keys to their element in lru.
+	entries map[string]*list.Element
+
+	// lru orders entries from most to least recently used.
+	lru *list.List
+}
+
+type keyedEntry struct {
+	key     string
+	limiter Limiter
+}
+
+// NewKeyed creates a Keyed holding at most maxKeys limiters created by
+// newLimiter. A non-positive maxKeys defaults to 10000.
+func NewKeyed(maxKeys int, newLimiter func(key string) Limiter) *Keyed {
+	if maxKeys <= 0 {
+		maxKeys = 10000
+	}
+	return &Keyed{
+		capacity:   maxKeys,
+		newLimiter: newLimiter,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get returns the limiter for key, creating it if needed.
+func (k *Keyed) Get(key string) Limiter {
+	k.Lock()
+	defer k.Unlock()
+
+	if el, ok := k.entries[key]; ok {
+		k.lru.MoveToFront(el)
+		return el.Value.(*keyedEntry).limiter
+	}
+
+	// Make room by dropping the least recently used key
+	for k.lru.Len() >= k.capacity {
+		el := k.lru.Back()
+		k.lru.Remove(el)
+		delete(k.entries, el.Value.(*keyedEntry).key)
+	}
+
+	entry := &keyedEntry{key: key, limiter: k.newLimiter(key)}
+	k.entries[key] = k.lru.PushFront(entry)
+	return entry.limiter
+}
+
+// Len returns the number of keys currently kept.
+func (k *Keyed) Len() int {
+	k.Lock()
+	defer k.Unlock()
+	return k.lru.Len()
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+)
+
+type nopLimiter struct{ key string }
+
+func (nopLimiter) Allow() bool                { return true }
+func (nopLimiter) AllowN(int) bool            { return true }
+func (nopLimiter) Wait(context.Context) error { return nil }
+
+func TestKeyed(t *testing.T) {
+	var created int
+	k := NewKeyed(2, func(key string) Limiter {
+		created++
+		return &nopLimiter{key: key}
+	})
+
+	a := k.Get("a")
+	if k.Get("a") != a {
+		t.Error("Get should return the same limiter for the same key")
+	}
+	k.Get("b")
+
+	// Touch a so b is the least recently used
+	k.Get("a")
+	k.Get("c")
+
+	if k.Len() != 2 {
+		t.Errorf("Len() = %v, want 2", k.Len())
+	}
+	if k.Get("a") != a {
+		t.Error("a should not have been dropped")
+	}
+	if created != 3 {
+		t.Errorf("created = %v, want 3", created)
+	}
+
+	// b was dropped and is created again
+	k.Get("b")
+	if created != 4 {
+		t.Errorf("created = %v, want 4", created)
+	}
+}
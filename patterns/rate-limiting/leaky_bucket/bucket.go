@@ -3,30 +3,69 @@
 package leakybucket
 
 import (
+	"context"
+	"math"
+	"sync"
 	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
 )
 
+// LeakyBucket implements ratelimit.Limiter and ratelimit.Reporter.
+var _ ratelimit.Limiter = (*LeakyBucket)(nil)
+var _ ratelimit.Reporter = (*LeakyBucket)(nil)
+
 // LeakyBucket rate limiter
 type LeakyBucket struct {
-	capacity int     // Bucket capacity
-	rate     float64 // Outflow rate (REQs/sec)
+	mu       sync.Mutex
+	clock    clock.Clock // Clock measuring the outflow
+	capacity int         // Bucket capacity
+	rate     float64     // Outflow rate (REQs/sec)
 
 	requests int       // Current number of requests
 	lastTime time.Time // Time of last request
 }
 
+// Option configures a LeakyBucket
+type Option func(*LeakyBucket)
+
+// WithClock sets the clock measuring the outflow, the system clock by default
+func WithClock(c clock.Clock) Option {
+	return func(b *LeakyBucket) {
+		b.clock = c
+	}
+}
+
 // New creates a leaky bucket limiter
-func New(capacity, rate int) *LeakyBucket {
-	return &LeakyBucket{
+func New(capacity, rate int, opts ...Option) *LeakyBucket {
+	b := &LeakyBucket{
+		clock:    clock.New(),
 		capacity: capacity,
 		rate:     float64(rate),
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 // Allow checks if a request should be limited
 func (b *LeakyBucket) Allow() bool {
-	now := time.Now()
-	b.requests++
+	return b.AllowN(1)
+}
+
+// AllowN checks if n requests should be limited, allowing all or none.
+func (b *LeakyBucket) AllowN(n int) bool {
+	if n <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	b.requests += n
 
 	if b.lastTime.IsZero() {
 		// First request, allow
@@ -35,21 +74,88 @@ func (b *LeakyBucket) Allow() bool {
 		return true
 	}
 
-	if b.requests >= b.capacity {
-		// Not enought capacity, limit
-		return false
-	}
-
 	// Calculate outflow for this request
 	elapsed := now.Sub(b.lastTime).Seconds()
 	outflow := elapsed * b.rate
 
 	// Allow if outflow >= requests
-	if int(outflow) >= b.requests {
+	if outflow >= float64(b.requests) {
 		b.requests = 0
 		b.lastTime = now
 		return true
 	}
+
+	if b.requests >= b.capacity {
+		// Not enought capacity, limit. The bucket never holds more than
+		// its capacity, so it always drains eventually.
+		b.requests = b.capacity
+		return false
+	}
+
 	// Not enough outflow, limit
 	return false
 }
+
+// Wait blocks until a request is allowed or ctx is done.
+func (b *LeakyBucket) Wait(ctx context.Context) error {
+	for {
+		// Only try once enough has leaked, so waiting does not add
+		// rejected requests
+		d := b.RetryAfter()
+		if d <= 0 {
+			if b.Allow() {
+				return nil
+			}
+			continue
+		}
+
+		timer := b.clock.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// Remaining returns how many requests are allowed now.
+func (b *LeakyBucket) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lastTime.IsZero() {
+		return b.capacity
+	}
+
+	outflow := b.clock.Now().Sub(b.lastTime).Seconds() * b.rate
+	if outflow > math.MaxInt32 {
+		outflow = math.MaxInt32
+	}
+	if left := int(outflow) - b.requests; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// RetryAfter returns how long until the next request is allowed.
+func (b *LeakyBucket) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lastTime.IsZero() {
+		return 0
+	}
+
+	// Nothing ever leaks without a rate
+	if b.rate <= 0 {
+		return math.MaxInt64
+	}
+
+	// The next request needs requests+1 to have leaked since the last one
+	need := time.Duration(float64(b.requests+1) / b.rate * float64(time.Second))
+	if d := need - b.clock.Now().Sub(b.lastTime); d > 0 {
+		return d
+	}
+	return 0
+}
@@ -5,6 +5,10 @@ package leakybucket
 import (
 	"testing"
 	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/ratelimittest"
 )
 
 func TestLeakyBucket(t *testing.T) {
@@ -23,12 +27,13 @@ func TestLeakyBucket(t *testing.T) {
 	})
 
 	t.Run("Allow", func(t *testing.T) {
-		b := New(10, 1)
+		clk := clock.NewFake(time.Unix(0, 0))
+		b := New(10, 1, WithClock(clk))
 		for i := 0; i < 2; i++ {
 			if !b.Allow() {
 				t.Error("Request within capacity should pass")
 			}
-			time.Sleep(1 * time.Second)
+			clk.Add(1 * time.Second)
 		}
 
 		// Reset bucket
@@ -46,3 +51,27 @@ func TestLeakyBucket(t *testing.T) {
 	})
 
 }
+
+func TestConformance(t *testing.T) {
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Limiter {
+		return New(5, 20)
+	})
+}
+
+func TestLeakyBucketDrains(t *testing.T) {
+	b := New(3, 100)
+	b.Allow()
+
+	// Rejections beyond capacity must not keep the bucket full forever
+	for i := 0; i < 100; i++ {
+		b.Allow()
+	}
+	if b.requests > b.capacity {
+		t.Errorf("requests %d exceed capacity %d", b.requests, b.capacity)
+	}
+
+	time.Sleep(b.RetryAfter())
+	if !b.Allow() {
+		t.Error("Request after draining should pass")
+	}
+}
@@ -0,0 +1,79 @@
+// Package ratelimit defines the interface shared by the rate limiters in
+// the counter, leakybucket, tokenbucket and window packages, so application
+// code can swap algorithms without rewrites.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter decides whether events may happen now.
+type Limiter interface {
+
+	// Allow reports whether one event may happen now. If it returns true
+	// the event is counted against the limit.
+	Allow() bool
+
+	// AllowN reports whether n events may happen now, counting all of
+	// them if so. It never admits only part of the n events.
+	// AllowN with n <= 0 always returns true.
+	AllowN(n int) bool
+
+	// Wait blocks until one event may happen, counting it, or until ctx
+	// is done, in which case it returns the context error.
+	Wait(ctx context.Context) error
+}
+
+// Reporter is implemented by limiters that can tell how much of the
+// limit is left. It is optional: check for it with a type assertion.
+type Reporter interface {
+
+	// Remaining returns how many events may happen now.
+	Remaining() int
+
+	// RetryAfter returns how long until the next event may happen.
+	// It returns zero if an event may happen now.
+	RetryAfter() time.Duration
+}
+
+// Refunder is implemented by limiters that can give back events they
+// admitted, so a Composite can undo a partial admission. It is optional:
+// check for it with a type assertion.
+type Refunder interface {
+
+	// RefundN returns n events admitted by an earlier Allow or AllowN to
+	// the limit, as if they had not happened. It never frees more than the
+	// limit holds.
+	RefundN(n int)
+}
+
+// Stats is a snapshot of a limiter's state and counters.
+type Stats struct {
+
+	// Available is how many events may happen now, such as the tokens in
+	// a token bucket.
+	Available int
+
+	// Allowed counts the events admitted so far.
+	Allowed uint64
+
+	// Rejected counts the events denied so far.
+	Rejected uint64
+}
+
+// Map returns the stats as named values, for publishing through expvar.
+func (s Stats) Map() map[string]int64 {
+	return map[string]int64{
+		"available": int64(s.Available),
+		"allowed":   int64(s.Allowed),
+		"rejected":  int64(s.Rejected),
+	}
+}
+
+// StatsProvider is implemented by limiters that expose Stats. Stats must
+// not block on the limiter's internal locks, so metrics scrapers can call
+// it at any time.
+type StatsProvider interface {
+	Stats() Stats
+}
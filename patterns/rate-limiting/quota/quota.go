@@ -0,0 +1,248 @@
+// Package quota implements daily and monthly quotas kept in a shared
+// store, so they survive restarts and are enforced across replicas.
+// Windows are aligned to the calendar: a daily quota starts afresh at
+// midnight, a monthly one on the first of the month.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// Period is the length of a quota window.
+type Period int
+
+const (
+	// Daily windows start at midnight.
+	Daily Period = iota
+
+	// Monthly windows start at midnight on the first of the month.
+	Monthly
+)
+
+// String returns the name of the period.
+func (p Period) String() string {
+	switch p {
+	case Daily:
+		return "daily"
+	case Monthly:
+		return "monthly"
+	default:
+		return fmt.Sprintf("Period(%d)", int(p))
+	}
+}
+
+// Policy tells what Consume decides when the store fails.
+type Policy int
+
+const (
+	// FailClosed rejects events while the store fails.
+	FailClosed Policy = iota
+
+	// FailOpen admits events while the store fails, without counting
+	// them.
+	FailOpen
+)
+
+// String returns the name of the policy.
+func (p Policy) String() string {
+	switch p {
+	case FailClosed:
+		return "fail-closed"
+	case FailOpen:
+		return "fail-open"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// Store keeps the counts of the quota windows. Implementations must make
+// IncrBy atomic, since replicas share the counts.
+type Store interface {
+
+	// Get returns the count of key, or zero if it does not exist.
+	Get(ctx context.Context, key string) (int64, error)
+
+	// IncrBy adds n to the count of key and returns the new count. A key
+	// that did not exist is created, expiring after ttl.
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// Option configures a Manager.
+type Option func(*config)
+
+type config struct {
+	location *time.Location
+	policy   Policy
+	prefix   string
+	grace    time.Duration
+	clock    window.Clock
+}
+
+// WithLocation sets the time zone windows are aligned to. The default is
+// UTC.
+func WithLocation(loc *time.Location) Option {
+	return func(c *config) {
+		c.location = loc
+	}
+}
+
+// WithPolicy sets what happens when the store fails. The default is
+// FailClosed.
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// WithPrefix sets the prefix of the store keys. The default is "quota:".
+func WithPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// WithGrace sets how long the count of a window is kept after the window
+// ends, to absorb clock skew between replicas. The default is one hour.
+func WithGrace(d time.Duration) Option {
+	return func(c *config) {
+		c.grace = d
+	}
+}
+
+// WithClock sets the clock deciding the current window. The default reads
+// the system clock.
+func WithClock(clock window.Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// realClock reads the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Manager enforces a quota per key.
+type Manager struct {
+	store  Store
+	limit  int
+	period Period
+	cfg    config
+}
+
+// New creates a Manager allowing limit events per key and period, counted
+// in store.
+func New(store Store, limit int, period Period, opts ...Option) *Manager {
+	cfg := config{
+		location: time.UTC,
+		prefix:   "quota:",
+		grace:    time.Hour,
+		clock:    realClock{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Manager{
+		store:  store,
+		limit:  limit,
+		period: period,
+		cfg:    cfg,
+	}
+}
+
+// Limit returns the events allowed per key and period.
+func (m *Manager) Limit() int {
+	return m.limit
+}
+
+// Window returns the start and end of the window holding t.
+func (m *Manager) Window(t time.Time) (start, end time.Time) {
+	t = t.In(m.cfg.location)
+	switch m.period {
+	case Monthly:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, m.cfg.location)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, m.cfg.location)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+// Consume counts n events of key against the current window. It reports
+// whether they are allowed and how many events the window has left after
+// them. Rejected events are not counted, and events are never partly
+// allowed.
+//
+// If the store fails, err is not nil and allowed follows the policy;
+// remaining is then zero.
+func (m *Manager) Consume(ctx context.Context, key string, n int) (allowed bool, remaining int, err error) {
+	if n <= 0 {
+		remaining, err = m.Remaining(ctx, key)
+		if err != nil {
+			return m.cfg.policy == FailOpen, 0, err
+		}
+		return true, remaining, nil
+	}
+
+	now := m.cfg.clock.Now()
+	storeKey, ttl := m.key(key, now)
+
+	count, err := m.store.IncrBy(ctx, storeKey, int64(n), ttl)
+	if err != nil {
+		return m.cfg.policy == FailOpen, 0, fmt.Errorf("quota store: %w", err)
+	}
+	if count <= int64(m.limit) {
+		return true, m.limit - int(count), nil
+	}
+
+	// Give the events back, so rejections do not use up the quota
+	count, err = m.store.IncrBy(ctx, storeKey, -int64(n), ttl)
+	if err != nil {
+		return false, 0, fmt.Errorf("quota store: %w", err)
+	}
+	return false, left(m.limit, count), nil
+}
+
+// Remaining returns how many events key has left in the current window.
+func (m *Manager) Remaining(ctx context.Context, key string) (int, error) {
+	storeKey, _ := m.key(key, m.cfg.clock.Now())
+	count, err := m.store.Get(ctx, storeKey)
+	if err != nil {
+		return 0, fmt.Errorf("quota store: %w", err)
+	}
+	return left(m.limit, count), nil
+}
+
+// ResetAt returns when the current window ends and the quota starts
+// afresh.
+func (m *Manager) ResetAt() time.Time {
+	_, end := m.Window(m.cfg.clock.Now())
+	return end
+}
+
+// key returns the store key of key in the window holding now, and how
+// long the store should keep it.
+func (m *Manager) key(key string, now time.Time) (string, time.Duration) {
+	start, end := m.Window(now)
+
+	layout := "2006-01-02"
+	if m.period == Monthly {
+		layout = "2006-01"
+	}
+	return m.cfg.prefix + key + ":" + start.Format(layout), end.Sub(now) + m.cfg.grace
+}
+
+// left returns the events left of limit after count.
+func left(limit int, count int64) int {
+	if count >= int64(limit) {
+		return 0
+	}
+	return limit - int(count)
+}
@@ -0,0 +1,210 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// brokenStore fails every call while down is set.
+type brokenStore struct {
+	Store
+	down bool
+}
+
+var errDown = errors.New("store down")
+
+func (s *brokenStore) Get(ctx context.Context, key string) (int64, error) {
+	if s.down {
+		return 0, errDown
+	}
+	return s.Store.Get(ctx, key)
+}
+
+func (s *brokenStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	if s.down {
+		return 0, errDown
+	}
+	return s.Store.IncrBy(ctx, key, n, ttl)
+}
+
+type consumeResult struct {
+	allowed   bool
+	remaining int
+}
+
+func consume(t *testing.T, m *Manager, key string, n int) consumeResult {
+	t.Helper()
+	allowed, remaining, err := m.Consume(context.Background(), key, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumeResult{allowed, remaining}
+}
+
+func TestDailyRollover(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 9, 23, 59, 58, 0, time.UTC)}
+	m := New(NewMemoryStore(clock), 3, Daily, WithClock(clock))
+	ctx := context.Background()
+
+	if got := consume(t, m, "alice", 2); got != (consumeResult{true, 1}) {
+		t.Errorf("Consume = %+v, want allowed with 1 left", got)
+	}
+
+	// Events are never partly allowed, and rejected ones are not counted
+	if got := consume(t, m, "alice", 2); got != (consumeResult{false, 1}) {
+		t.Errorf("Consume = %+v, want rejected with 1 left", got)
+	}
+	if got := consume(t, m, "alice", 1); got != (consumeResult{true, 0}) {
+		t.Errorf("Consume = %+v, want allowed with 0 left", got)
+	}
+	if got := consume(t, m, "alice", 1); got.allowed {
+		t.Error("quota should be used up")
+	}
+
+	// Other keys have their own quota
+	if got := consume(t, m, "bob", 1); got != (consumeResult{true, 2}) {
+		t.Errorf("Consume = %+v, want allowed with 2 left", got)
+	}
+
+	// Midnight starts a new window
+	if want := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC); !m.ResetAt().Equal(want) {
+		t.Errorf("ResetAt = %v, want %v", m.ResetAt(), want)
+	}
+	clock.Add(2 * time.Second)
+	if n, err := m.Remaining(ctx, "alice"); err != nil || n != 3 {
+		t.Errorf("Remaining = %d, %v, want 3", n, err)
+	}
+	if got := consume(t, m, "alice", 3); got != (consumeResult{true, 0}) {
+		t.Errorf("Consume = %+v, want allowed with 0 left", got)
+	}
+}
+
+func TestMonthlyRollover(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+
+	// 2024-01-31 23:30 in UTC+8 is still January there
+	clock := &fakeClock{now: time.Date(2024, 1, 31, 15, 30, 0, 0, time.UTC)}
+	m := New(NewMemoryStore(clock), 10, Monthly, WithClock(clock), WithLocation(loc))
+
+	start, end := m.Window(clock.Now())
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, loc); !start.Equal(want) {
+		t.Errorf("window start = %v, want %v", start, want)
+	}
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, loc); !end.Equal(want) {
+		t.Errorf("window end = %v, want %v", end, want)
+	}
+
+	if got := consume(t, m, "k", 10); !got.allowed {
+		t.Fatal("want the whole quota allowed")
+	}
+	clock.Add(29 * time.Minute)
+	if got := consume(t, m, "k", 1); got.allowed {
+		t.Error("want rejected before the month ends")
+	}
+
+	clock.Add(time.Minute)
+	if got := consume(t, m, "k", 1); got != (consumeResult{true, 9}) {
+		t.Errorf("Consume = %+v, want allowed with 9 left in February", got)
+	}
+}
+
+func TestStoreOutage(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)}
+	store := &brokenStore{Store: NewMemoryStore(clock)}
+	ctx := context.Background()
+
+	closed := New(store, 5, Daily, WithClock(clock))
+	open := New(store, 5, Daily, WithClock(clock), WithPolicy(FailOpen), WithPrefix("open:"))
+
+	consume(t, closed, "k", 1)
+	store.down = true
+
+	allowed, _, err := closed.Consume(ctx, "k", 1)
+	if allowed || !errors.Is(err, errDown) {
+		t.Errorf("fail-closed Consume = %v, %v, want rejected with the store error", allowed, err)
+	}
+	allowed, _, err = open.Consume(ctx, "k", 1)
+	if !allowed || !errors.Is(err, errDown) {
+		t.Errorf("fail-open Consume = %v, %v, want allowed with the store error", allowed, err)
+	}
+	if _, err := closed.Remaining(ctx, "k"); !errors.Is(err, errDown) {
+		t.Errorf("Remaining = %v, want the store error", err)
+	}
+
+	// Once the store is back, the counts carry on
+	store.down = false
+	if got := consume(t, closed, "k", 1); got != (consumeResult{true, 3}) {
+		t.Errorf("Consume = %+v, want allowed with 3 left", got)
+	}
+	if got := consume(t, open, "k", 1); got != (consumeResult{true, 4}) {
+		t.Errorf("Consume = %+v, want allowed with 4 left, the outage uncounted", got)
+	}
+}
+
+func TestSharedAcrossManagers(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore(clock)
+
+	// Two replicas using the same store
+	a := New(store, 100, Daily, WithClock(clock))
+	b := New(store, 100, Daily, WithClock(clock))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for _, m := range []*Manager{a, b} {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(m *Manager) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					ok, _, err := m.Consume(context.Background(), "k", 1)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if ok {
+						mu.Lock()
+						allowed++
+						mu.Unlock()
+					}
+				}
+			}(m)
+		}
+	}
+	wg.Wait()
+
+	if allowed != 100 {
+		t.Errorf("allowed %d events, want exactly the quota of 100", allowed)
+	}
+}
+
+func TestString(t *testing.T) {
+	if Daily.String() != "daily" || Monthly.String() != "monthly" || Period(7).String() != "Period(7)" {
+		t.Error("unexpected Period names")
+	}
+	if FailClosed.String() != "fail-closed" || FailOpen.String() != "fail-open" || Policy(7).String() != "Policy(7)" {
+		t.Error("unexpected Policy names")
+	}
+}
@@ -0,0 +1,148 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+	"github.com/go-redis/redis"
+)
+
+// MemoryStore implements Store.
+var _ Store = (*MemoryStore)(nil)
+
+// RedisStore implements Store.
+var _ Store = (*RedisStore)(nil)
+
+// MemoryStore keeps the counts in memory. It suits a single replica, or
+// tests; counts are lost on restart.
+type MemoryStore struct {
+	clock window.Clock
+
+	mu     sync.Mutex
+	counts map[string]memoryCount
+}
+
+type memoryCount struct {
+	n       int64
+	expires time.Time
+}
+
+// NewMemoryStore creates a MemoryStore expiring keys by clock, or by the
+// system clock if clock is nil.
+func NewMemoryStore(clock window.Clock) *MemoryStore {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &MemoryStore{
+		clock:  clock,
+		counts: make(map[string]memoryCount),
+	}
+}
+
+// Get returns the count of key, or zero if it does not exist.
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.live(key)
+	if !ok {
+		return 0, nil
+	}
+	return c.n, nil
+}
+
+// IncrBy adds n to the count of key and returns the new count. Expired
+// keys start again from zero.
+func (s *MemoryStore) IncrBy(_ context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.live(key)
+	if !ok {
+		c.expires = s.clock.Now().Add(ttl)
+	}
+	c.n += n
+	s.counts[key] = c
+	return c.n, nil
+}
+
+// Len returns how many keys are held, including expired ones not yet
+// dropped.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.counts)
+}
+
+// live returns the count of key if it has not expired, dropping it
+// otherwise. Caller must hold the lock.
+func (s *MemoryStore) live(key string) (memoryCount, bool) {
+	c, ok := s.counts[key]
+	if !ok {
+		return memoryCount{}, false
+	}
+	if !s.clock.Now().Before(c.expires) {
+		delete(s.counts, key)
+		return memoryCount{}, false
+	}
+	return c, true
+}
+
+// incrScript adds to a key and sets its TTL if the key was just created.
+const incrScript = `
+local n = redis.call("incrby", KEYS[1], ARGV[1])
+if redis.call("pttl", KEYS[1]) < 0 then
+	redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return n`
+
+// RedisStore keeps the counts in Redis, shared by every replica using the
+// same server.
+type RedisStore struct {
+	pool *redispool.RedisConnectionPool
+}
+
+// NewRedisStore creates a RedisStore using connections from pool.
+func NewRedisStore(pool *redispool.RedisConnectionPool) *RedisStore {
+	return &RedisStore{pool: pool}
+}
+
+// Get returns the count of key, or zero if it does not exist.
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := s.do(ctx, func(c *redis.Client) error {
+		var err error
+		n, err = c.Get(key).Int64()
+		if err == redis.Nil {
+			n, err = 0, nil
+		}
+		return err
+	})
+	return n, err
+}
+
+// IncrBy adds n to the count of key and returns the new count, setting
+// the TTL of a key that did not exist in the same script.
+func (s *RedisStore) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	var count int64
+	err := s.do(ctx, func(c *redis.Client) error {
+		var err error
+		count, err = c.Eval(incrScript, []string{key}, n, ttl.Milliseconds()).Int64()
+		return err
+	})
+	return count, err
+}
+
+// do runs fn with a pooled connection.
+func (s *RedisStore) do(ctx context.Context, fn func(c *redis.Client) error) error {
+	conn, err := s.pool.AcquireContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.pool.Release(conn)
+
+	return fn(conn.Conn.WithContext(ctx))
+}
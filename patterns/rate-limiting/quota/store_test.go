@@ -0,0 +1,103 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+// newRedisStore starts a miniredis server and returns a RedisStore on a
+// pool connected to it.
+func newRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+
+	pool := redispool.New(2, 0, time.Second)
+	pool.OpenConnection = func() (*redispool.RedisConn, error) {
+		return &redispool.RedisConn{
+			Conn: redis.NewClient(&redis.Options{
+				Addr:       mr.Addr(),
+				MaxRetries: 0,
+			}),
+			TimeOut: time.Hour,
+		}, nil
+	}
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return NewRedisStore(pool), mr
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	s := NewMemoryStore(clock)
+	ctx := context.Background()
+
+	s.IncrBy(ctx, "k", 2, time.Minute)
+	clock.Add(30 * time.Second)
+
+	// Later increments keep the TTL of the first
+	if n, _ := s.IncrBy(ctx, "k", 3, time.Hour); n != 5 {
+		t.Errorf("count = %d, want 5", n)
+	}
+	clock.Add(30 * time.Second)
+	if n, _ := s.Get(ctx, "k"); n != 0 {
+		t.Errorf("count = %d, want 0 once expired", n)
+	}
+	if s.Len() != 0 {
+		t.Errorf("Len = %d, want expired key dropped", s.Len())
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	s, mr := newRedisStore(t)
+	ctx := context.Background()
+
+	if n, err := s.Get(ctx, "k"); err != nil || n != 0 {
+		t.Fatalf("Get = %d, %v, want 0 for a missing key", n, err)
+	}
+	if n, err := s.IncrBy(ctx, "k", 2, time.Minute); err != nil || n != 2 {
+		t.Fatalf("IncrBy = %d, %v, want 2", n, err)
+	}
+	if n, err := s.IncrBy(ctx, "k", 3, time.Hour); err != nil || n != 5 {
+		t.Fatalf("IncrBy = %d, %v, want 5", n, err)
+	}
+	if ttl := mr.TTL("k"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want the first increment's minute", ttl)
+	}
+
+	mr.FastForward(time.Minute)
+	if n, err := s.Get(ctx, "k"); err != nil || n != 0 {
+		t.Errorf("Get = %d, %v, want 0 once expired", n, err)
+	}
+}
+
+func TestManagerOnRedis(t *testing.T) {
+	s, mr := newRedisStore(t)
+	clock := &fakeClock{now: time.Date(2024, 3, 9, 23, 0, 0, 0, time.UTC)}
+	m := New(s, 2, Daily, WithClock(clock), WithPolicy(FailOpen))
+
+	if got := consume(t, m, "k", 2); got != (consumeResult{true, 0}) {
+		t.Errorf("Consume = %+v, want allowed with 0 left", got)
+	}
+	if got := consume(t, m, "k", 1); got.allowed {
+		t.Error("quota should be used up")
+	}
+
+	// The key lives until the end of the day, plus the grace period
+	if ttl := mr.TTL("quota:k:2024-03-09"); ttl != 2*time.Hour {
+		t.Errorf("TTL = %v, want 2h", ttl)
+	}
+
+	// A Redis outage is fail-open
+	mr.Close()
+	allowed, _, err := m.Consume(context.Background(), "k", 1)
+	if !allowed || err == nil {
+		t.Errorf("Consume = %v, %v, want allowed with an error", allowed, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package ratelimittest provides the conformance test suite shared by all
+// ratelimit.Limiter implementations.
+package ratelimittest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+)
+
+// Run runs the conformance suite against limiters created by newLimiter.
+//
+// newLimiter must return a fresh limiter that admits its first event within
+// a second of creation, admits no more than a few hundred events per
+// second, and recovers from exhaustion within a few seconds. Implementations
+// holding resources can release them with t.Cleanup.
+func Run(t *testing.T, newLimiter func(t *testing.T) ratelimit.Limiter) {
+
+	t.Run("Allow", func(t *testing.T) {
+		l := newLimiter(t)
+		if !eventuallyAllow(l) {
+			t.Fatal("Allow never returned true")
+		}
+	})
+
+	t.Run("Exhaust", func(t *testing.T) {
+		l := newLimiter(t)
+		eventuallyAllow(l)
+		if !exhaust(l) {
+			t.Fatal("Allow never returned false")
+		}
+	})
+
+	t.Run("AllowNZero", func(t *testing.T) {
+		l := newLimiter(t)
+		eventuallyAllow(l)
+		exhaust(l)
+
+		// Zero events are always allowed, even when exhausted
+		if !l.AllowN(0) {
+			t.Error("AllowN(0) should return true")
+		}
+	})
+
+	t.Run("AllowNExhausted", func(t *testing.T) {
+		l := newLimiter(t)
+		eventuallyAllow(l)
+		exhaust(l)
+
+		// An exhausted limiter cannot admit a large batch
+		if l.AllowN(1 << 20) {
+			t.Error("AllowN(1<<20) should return false")
+		}
+	})
+
+	t.Run("WaitCancelled", func(t *testing.T) {
+		l := newLimiter(t)
+		eventuallyAllow(l)
+		exhaust(l)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		err := l.Wait(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Wait() = %v, want %v", err, context.Canceled)
+		}
+		if time.Since(start) > 100*time.Millisecond {
+			t.Errorf("Wait() took %v to notice the cancelled context", time.Since(start))
+		}
+	})
+
+	t.Run("Wait", func(t *testing.T) {
+		l := newLimiter(t)
+		eventuallyAllow(l)
+		exhaust(l)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := l.Wait(ctx); err != nil {
+			t.Errorf("Wait() = %v, want nil", err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		l := newLimiter(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					l.Allow()
+					l.AllowN(2)
+					if r, ok := l.(ratelimit.Reporter); ok {
+						r.Remaining()
+						r.RetryAfter()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("Reporter", func(t *testing.T) {
+		l := newLimiter(t)
+		r, ok := l.(ratelimit.Reporter)
+		if !ok {
+			t.Skip("limiter does not implement ratelimit.Reporter")
+		}
+
+		eventuallyAllow(l)
+		exhaust(l)
+
+		if r.Remaining() != 0 {
+			t.Errorf("Remaining() = %v after exhaustion, want 0", r.Remaining())
+		}
+		if r.RetryAfter() <= 0 {
+			t.Errorf("RetryAfter() = %v after exhaustion, want > 0", r.RetryAfter())
+		}
+		if r.RetryAfter() > 10*time.Second {
+			t.Errorf("RetryAfter() = %v, want a few seconds at most", r.RetryAfter())
+		}
+	})
+}
+
+// eventuallyAllow polls Allow for up to two seconds.
+func eventuallyAllow(l ratelimit.Limiter) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if l.Allow() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+// exhaust calls Allow until it returns false.
+func exhaust(l ratelimit.Limiter) bool {
+	for i := 0; i < 100000; i++ {
+		if !l.Allow() {
+			return true
+		}
+	}
+	return false
+}
@@ -2,15 +2,35 @@
 package tokenbucket
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"math"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
 )
 
+// TokenBucket implements ratelimit.Limiter and ratelimit.Reporter.
+var _ ratelimit.Limiter = (*TokenBucket)(nil)
+var _ ratelimit.Reporter = (*TokenBucket)(nil)
+var _ ratelimit.StatsProvider = (*TokenBucket)(nil)
+var _ ratelimit.Refunder = (*TokenBucket)(nil)
+var _ ratelimit.RateSetter = (*TokenBucket)(nil)
+
 // TokenBucket implements a token bucket that fills tokens at the specified rate.
 // It allows limiting access to resources by rate.
 type TokenBucket struct {
 
+	// mu guards rate, available and lastFill
+	mu sync.Mutex
+
+	// Clock times the filling and the waits
+	clock clock.Clock
+
 	// Rate tokens are added to the bucket per second (REQs/sec)
 	rate float64
 
@@ -20,44 +40,80 @@ type TokenBucket struct {
 	// Available tokens that can be taken
 	available int
 
+	// Time the last token was added
+	lastFill time.Time
+
 	// Channel used to receive and return tokens
 	tokens chan struct{}
 
 	// Channel signaled when bucket is closed
 	closed chan struct{}
+
+	// closeOnce makes Close close the channels once
+	closeOnce sync.Once
+
+	// Channel signaled when the rate changes, so the filling goroutine
+	// picks up the new interval
+	rateChanged chan struct{}
+
+	// Mirrors of available and the allow counters, read by Stats without
+	// taking mu
+	statAvailable int64
+	statAllowed   uint64
+	statRejected  uint64
 }
 
-// atomicClosedState and atomicTokensState are used to save the closed state of each channel
-var atomicClosedState uint32
-var atomicTokensState uint32
+// Option configures a TokenBucket.
+type Option func(*TokenBucket)
+
+// WithClock sets the clock timing the filling and the waits. The default
+// is the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(tb *TokenBucket) {
+		tb.clock = c
+	}
+}
 
 // New creates a new token bucket with the given rate and capacity.
-func New(rate float64, capacity int) *TokenBucket {
+func New(rate float64, capacity int, opts ...Option) *TokenBucket {
 
 	tb := &TokenBucket{
+		clock:     clock.New(),
 		rate:      rate,
 		capacity:  capacity,
 		available: 0,
 		tokens:    make(chan struct{}, capacity),
 		closed:    make(chan struct{}),
+
+		rateChanged: make(chan struct{}, 1),
 	}
+	for _, opt := range opts {
+		opt(tb)
+	}
+	tb.lastFill = tb.clock.Now()
 
 	// Start goroutine to fill tokens
-	go startFillingTokens(tb, rate)
+	go startFillingTokens(tb)
 
 	return tb
 }
 
-// startFillingTokens fills tokens at the rate
-func startFillingTokens(tb *TokenBucket, rate float64) {
-
-	fillInterval := time.Second / time.Duration(rate)
+// startFillingTokens fills tokens at the rate, following SetRate
+func startFillingTokens(tb *TokenBucket) {
 
 	for {
+		tb.mu.Lock()
+		fillInterval := tb.fillInterval()
+		tb.mu.Unlock()
+
+		timer := tb.clock.NewTimer(fillInterval)
 		select {
-		case <-time.After(fillInterval):
+		case <-timer.C():
 			tb.fillToken()
+		case <-tb.rateChanged:
+			timer.Stop()
 		case <-tb.closed:
+			timer.Stop()
 			return
 		}
 	}
@@ -66,32 +122,92 @@ func startFillingTokens(tb *TokenBucket, rate float64) {
 // fillToken adds a token if available tokens is less than capacity.
 func (tb *TokenBucket) fillToken() {
 
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	// Close may have run since the timer fired
+	if tb.isClosed() {
+		return
+	}
+
+	tb.lastFill = tb.clock.Now()
+
 	if tb.available < tb.capacity {
 		select {
 		case tb.tokens <- struct{}{}: // Add new token
 			tb.available++
+			atomic.StoreInt64(&tb.statAvailable, int64(tb.available))
 		default: // Bucket full, do nothing
 		}
 	}
 }
 
-// Take retrieves a token from the bucket. It blocks if no tokens available.
+// Take retrieves a token from the bucket. It returns an error if no tokens
+// are available.
 func (tb *TokenBucket) Take() error {
-	if tb.available <= 0 {
+	if !tb.AllowN(1) {
 		return errors.New("no tokens available")
 	}
 
-	<-tb.tokens
-	tb.available--
-
 	return nil
 }
 
+// Allow takes a token if one is available and reports whether it did.
+func (tb *TokenBucket) Allow() bool {
+	return tb.AllowN(1)
+}
+
+// AllowN takes n tokens if that many are available and reports whether
+// it did. It never takes fewer than n.
+func (tb *TokenBucket) AllowN(n int) bool {
+	if n <= 0 {
+		return true
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.available < n {
+		atomic.AddUint64(&tb.statRejected, uint64(n))
+		return false
+	}
+
+	// available tracks the tokens in the channel, so these never block
+	for i := 0; i < n; i++ {
+		<-tb.tokens
+	}
+	tb.available -= n
+	atomic.StoreInt64(&tb.statAvailable, int64(tb.available))
+	atomic.AddUint64(&tb.statAllowed, uint64(n))
+
+	return true
+}
+
+// RefundN puts back n tokens taken by AllowN, up to the capacity.
+func (tb *TokenBucket) RefundN(n int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.isClosed() {
+		return
+	}
+
+	for i := 0; i < n && tb.available < tb.capacity; i++ {
+		select {
+		case tb.tokens <- struct{}{}:
+			tb.available++
+			atomic.AddUint64(&tb.statAllowed, ^uint64(0))
+		default:
+		}
+	}
+	atomic.StoreInt64(&tb.statAvailable, int64(tb.available))
+}
+
 // Put returns a token back to the bucket.
 func (tb *TokenBucket) Put() error {
 
 	// Checks if the current available value exceeds capacity.
-	if tb.available >= tb.capacity {
+	if tb.Available() >= tb.capacity {
 		return errors.New("available exceeds capacity")
 	}
 
@@ -116,16 +232,44 @@ func (tb *TokenBucket) Put() error {
 	}
 
 	// add available
+	tb.mu.Lock()
 	tb.available++
+	atomic.StoreInt64(&tb.statAvailable, int64(tb.available))
+	tb.mu.Unlock()
 
 	return nil
 }
 
 // Rate returns the fill rate of the bucket.
 func (tb *TokenBucket) Rate() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
 	return tb.rate
 }
 
+// SetRate changes the fill rate of the bucket. It is safe to call while
+// tokens are being taken on other goroutines.
+func (tb *TokenBucket) SetRate(rate float64) {
+	tb.mu.Lock()
+	tb.rate = rate
+	tb.mu.Unlock()
+
+	select {
+	case tb.rateChanged <- struct{}{}:
+	default:
+	}
+}
+
+// fillInterval returns the time between two tokens. A rate of zero or less
+// never fills. Caller must hold the lock.
+func (tb *TokenBucket) fillInterval() time.Duration {
+	if tb.rate <= 0 {
+		return math.MaxInt64
+	}
+	return time.Duration(float64(time.Second) / tb.rate)
+}
+
 // Capacity returns the capacity of the bucket.
 func (tb *TokenBucket) Capacity() int {
 	return tb.capacity
@@ -133,31 +277,144 @@ func (tb *TokenBucket) Capacity() int {
 
 // Available returns the number of available tokens.
 func (tb *TokenBucket) Available() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
 	return tb.available
 }
 
-// Wait blocks until a token becomes available.
-func (tb *TokenBucket) Wait() {
-	<-tb.tokens
+// Stats returns a snapshot of the available tokens and the allow counters.
+// It does not take the bucket's lock.
+func (tb *TokenBucket) Stats() ratelimit.Stats {
+	return ratelimit.Stats{
+		Available: int(atomic.LoadInt64(&tb.statAvailable)),
+		Allowed:   atomic.LoadUint64(&tb.statAllowed),
+		Rejected:  atomic.LoadUint64(&tb.statRejected),
+	}
+}
+
+// StatsMap returns Stats as named values, for publishing through expvar.
+func (tb *TokenBucket) StatsMap() map[string]int64 {
+	return tb.Stats().Map()
+}
+
+// Remaining returns the number of available tokens.
+func (tb *TokenBucket) Remaining() int {
+	return tb.Available()
+}
+
+// RetryAfter returns how long until the next token is added, or zero if
+// a token is available now.
+func (tb *TokenBucket) RetryAfter() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.available > 0 {
+		return 0
+	}
+
+	// Tokens are never filled without a rate
+	if tb.rate <= 0 {
+		return math.MaxInt64
+	}
+
+	if d := tb.lastFill.Add(tb.fillInterval()).Sub(tb.clock.Now()); d > 0 {
+		return d
+	}
+
+	// The next token is due, allow a moment for it to arrive
+	return time.Millisecond
 }
 
-// Close stops the filling goroutine and closes channels.
+// Wait blocks until a token becomes available and takes it, or until ctx
+// is done. It returns an error if the bucket is closed.
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		if tb.AllowN(1) {
+			return nil
+		}
+
+		// Sleep until the next token is due
+		timer := tb.clock.NewTimer(tb.RetryAfter())
+		select {
+		case <-timer.C():
+		case <-tb.closed:
+			timer.Stop()
+			return errors.New("token bucket closed")
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// snapshot is the saved state of a TokenBucket.
+type snapshot struct {
+	Rate      float64 `json:"rate"`
+	Available int     `json:"available"`
+}
+
+// Snapshot returns the rate and the available tokens as JSON.
+func (tb *TokenBucket) Snapshot() ([]byte, error) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	return json.Marshal(snapshot{Rate: tb.rate, Available: tb.available})
+}
+
+// Restore sets the rate and the available tokens from a Snapshot. Tokens
+// beyond the capacity are dropped.
+func (tb *TokenBucket) Restore(data []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	tb.mu.Lock()
+	select {
+	case <-tb.closed:
+		tb.mu.Unlock()
+		return errors.New("token bucket closed")
+	default:
+	}
+	for tb.available > s.Available {
+		<-tb.tokens
+		tb.available--
+	}
+	for tb.available < s.Available && tb.available < tb.capacity {
+		tb.tokens <- struct{}{}
+		tb.available++
+	}
+	atomic.StoreInt64(&tb.statAvailable, int64(tb.available))
+	tb.mu.Unlock()
+
+	tb.SetRate(s.Rate)
+	return nil
+}
+
+// Close stops the filling goroutine and closes channels. Only the first
+// call has an effect.
 func (tb *TokenBucket) Close() {
-	// Close closed channel
-	tb.atomicClose(tb.closed, &atomicClosedState)
-	// Close Token channel
-	tb.atomicClose(tb.tokens, &atomicTokensState)
-
-	tb.available = 0
-}
-
-// atomicClose atomically closes the given channel
-// No operation is performed if it is already closed
-// The state parameter is used to save the closed state of the channel
-func (tb *TokenBucket) atomicClose(ch chan struct{}, state *uint32) {
-	// CAS operation to close the channel
-	// Do not perform a close if the state is already closed.
-	if atomic.CompareAndSwapUint32(state, 0, 1) {
-		close(ch)
+	tb.closeOnce.Do(func() {
+		// Close closed channel
+		close(tb.closed)
+
+		// Close Token channel under the lock, so no fill or refund is sending
+		tb.mu.Lock()
+		close(tb.tokens)
+		tb.available = 0
+		atomic.StoreInt64(&tb.statAvailable, 0)
+		tb.mu.Unlock()
+	})
+}
+
+// isClosed reports whether Close was called. Senders on tokens check it
+// under the lock.
+func (tb *TokenBucket) isClosed() bool {
+	select {
+	case <-tb.closed:
+		return true
+	default:
+		return false
 	}
 }
@@ -2,18 +2,40 @@
 package tokenbucket
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/ratelimittest"
 	"github.com/stretchr/testify/assert"
 )
 
+// newFake creates a bucket filled by a fake clock.
+func newFake(rate float64, capacity int) (*TokenBucket, *clock.Fake) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	return New(rate, capacity, WithClock(clk)), clk
+}
+
+// fill moves clk forward until tb filled n tokens.
+func fill(tb *TokenBucket, clk *clock.Fake, n int) {
+	interval := time.Duration(float64(time.Second) / tb.Rate())
+	for i := 0; i < n; i++ {
+		clk.BlockUntil(1)
+		clk.Add(interval)
+	}
+
+	// Back to waiting: the last token is in
+	clk.BlockUntil(1)
+}
+
 func TestNewTokenBucket(t *testing.T) {
 
 	rate := 100.0
 	capacity := 1000
 
-	tb := New(rate, capacity)
+	tb, clk := newFake(rate, capacity)
 
 	// check rate
 	if tb.Rate() != rate {
@@ -41,7 +63,7 @@ func TestNewTokenBucket(t *testing.T) {
 	}
 
 	// Started the goroutine to populate the token.
-	time.Sleep(10 * time.Millisecond)
+	fill(tb, clk, 1)
 	if tb.Available() == 0 {
 		t.Error("Goroutine to fill tokens not started")
 	}
@@ -53,7 +75,7 @@ func TestNewTokenBucket(t *testing.T) {
 func TestStartFillingTokens(t *testing.T) {
 
 	rate := 100.0
-	tb := New(rate, 1000)
+	tb, clk := newFake(rate, 1000)
 
 	// Correct fill interval
 	fillInterval := time.Second / time.Duration(rate)
@@ -62,24 +84,23 @@ func TestStartFillingTokens(t *testing.T) {
 	}
 
 	// Token filling goroutine started
-	time.Sleep(300 * time.Millisecond)
-	if tb.Available() <= 2 {
+	fill(tb, clk, 3)
+	if tb.Available() != 3 {
 		t.Error("Goroutine not filling tokens")
 	}
 
-	// Goroutine exits after closed
+	// Closing empties the bucket
 	tb.Close()
-	time.Sleep(200 * time.Millisecond)
-	if tb.Available() > 20 {
-		t.Error("Goroutine not exited after closed")
+	if tb.Available() != 0 {
+		t.Error("Tokens left after closed")
 	}
 }
 
 func TestTake(t *testing.T) {
 
-	tb := New(1000, 10)
+	tb, clk := newFake(1000, 10)
 
-	time.Sleep(500 * time.Millisecond)
+	fill(tb, clk, 10)
 
 	// Available is full before Take
 	assert.Equal(t, tb.Available(), 10)
@@ -105,9 +126,9 @@ func TestTake(t *testing.T) {
 
 func TestPut(t *testing.T) {
 
-	tb := New(1000, 10)
+	tb, clk := newFake(1000, 10)
 
-	time.Sleep(500 * time.Millisecond)
+	fill(tb, clk, 10)
 
 	tb.Take()
 
@@ -151,18 +172,12 @@ func TestClose(t *testing.T) {
 	tb := New(1000, 10)
 
 	// Channels are open before close
-	assert.Equal(t, atomicClosedState, uint32(0))
-	assert.Equal(t, atomicTokensState, uint32(0))
+	assert.False(t, tb.isClosed())
 
-	// States changed after close
+	// Repeated close does not panic
 	tb.Close()
-	assert.Equal(t, atomicClosedState, uint32(1))
-	assert.Equal(t, atomicTokensState, uint32(1))
-
-	// States stay the same after repeated close
 	tb.Close()
-	assert.Equal(t, atomicClosedState, uint32(1))
-	assert.Equal(t, atomicTokensState, uint32(1))
+	assert.True(t, tb.isClosed())
 
 	// Channels are closed
 	_, closed := <-tb.closed
@@ -173,30 +188,103 @@ func TestClose(t *testing.T) {
 
 }
 
-func TestAtomicClose(t *testing.T) {
+func TestCloseEachBucket(t *testing.T) {
+
+	first := New(1000, 10)
+	second := New(1000, 10)
+
+	// Closing one bucket leaves the other open
+	first.Close()
+	assert.True(t, first.isClosed())
+	assert.False(t, second.isClosed())
+
+	// The other closes on its own Close
+	second.Close()
+	assert.True(t, second.isClosed())
+	_, tokens := <-second.tokens
+	assert.False(t, tokens)
+
+}
+
+func TestConformance(t *testing.T) {
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Limiter {
+		return New(20, 5)
+	})
+}
+
+func TestAllowN(t *testing.T) {
 
 	tb := New(1000, 10)
 
-	// Initially not closed
-	assert.Equal(t, atomicClosedState, uint32(0))
+	time.Sleep(100 * time.Millisecond)
 
-	// Marked closed after call
-	tb.atomicClose(tb.closed, &atomicClosedState)
-	assert.Equal(t, atomicClosedState, uint32(1))
+	// Not enough tokens, nothing taken
+	assert.False(t, tb.AllowN(11))
+	assert.Equal(t, tb.Available(), 10)
+
+	// Enough tokens, all taken at once
+	assert.True(t, tb.AllowN(4))
+	assert.Equal(t, tb.Available(), 6)
+	assert.Equal(t, len(tb.tokens), 6)
+}
+
+func TestWait(t *testing.T) {
+
+	tb := New(1, 1)
+
+	// Returns when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := tb.Wait(ctx)
+	assert.Equal(t, err, context.Canceled)
+
+	// Waits for the first token to be filled and takes it
+	err = tb.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, tb.Available(), 0)
+}
+
+func TestStats(t *testing.T) {
 
-	// State stays the same after repeated calls
-	tb.atomicClose(tb.closed, &atomicClosedState)
-	assert.Equal(t, atomicClosedState, uint32(1))
+	tb := New(1000, 5)
+
+	time.Sleep(100 * time.Millisecond)
+
+	assert.True(t, tb.AllowN(2))
+	assert.False(t, tb.AllowN(10))
+
+	stats := tb.Stats()
+	assert.Equal(t, stats.Available, 3)
+	assert.Equal(t, stats.Allowed, uint64(2))
+	assert.Equal(t, stats.Rejected, uint64(10))
+}
+
+func TestRefundN(t *testing.T) {
+
+	tb, clk := newFake(20, 5)
+
+	fill(tb, clk, 5)
+
+	assert.True(t, tb.AllowN(3))
+
+	// Refunds never overfill the bucket
+	tb.RefundN(10)
+	assert.Equal(t, tb.Available(), 5)
+	assert.Equal(t, tb.Stats().Allowed, uint64(0))
+}
 
-	// Initially not closed
-	assert.Equal(t, atomicTokensState, uint32(0))
+func TestSetRate(t *testing.T) {
 
-	// Marked closed after call
-	tb.atomicClose(tb.tokens, &atomicTokensState)
-	assert.Equal(t, atomicTokensState, uint32(1))
+	tb := New(1, 100)
+	defer tb.Close()
 
-	// State stays the same after repeated calls
-	tb.atomicClose(tb.tokens, &atomicTokensState)
-	assert.Equal(t, atomicTokensState, uint32(1))
+	// Too slow to fill a token during the test
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, tb.Available(), 0)
 
+	// The filling goroutine picks up the new rate right away
+	tb.SetRate(1000)
+	assert.Equal(t, tb.Rate(), 1000.0)
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, tb.Available() > 10)
 }
@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// WarmUpLimiter implements Limiter.
+var _ Limiter = (*WarmUpLimiter)(nil)
+
+// RateSetter is implemented by limiters whose rate can be changed while
+// they are in use, such as a token bucket.
+type RateSetter interface {
+	SetRate(rate float64)
+}
+
+// Curve is the shape of a warm-up ramp.
+type Curve int
+
+const (
+	// Linear grows the rate by the same amount at every step.
+	Linear Curve = iota
+
+	// Exponential grows the rate by the same factor at every step, so it
+	// stays low for longer and climbs fastest at the end.
+	Exponential
+)
+
+// String returns the name of the curve.
+func (c Curve) String() string {
+	switch c {
+	case Linear:
+		return "linear"
+	case Exponential:
+		return "exponential"
+	default:
+		return fmt.Sprintf("Curve(%d)", int(c))
+	}
+}
+
+// WarmUpOption configures a WarmUpLimiter.
+type WarmUpOption func(*warmUpConfig)
+
+type warmUpConfig struct {
+	from  float64
+	curve Curve
+	steps int
+	now   func() time.Time
+}
+
+// WarmUpFrom sets the fraction of the target rate the ramp starts at. The
+// default is 0.1.
+func WarmUpFrom(fraction float64) WarmUpOption {
+	return func(c *warmUpConfig) {
+		c.from = fraction
+	}
+}
+
+// WarmUpCurve sets the shape of the ramp. The default is Linear.
+func WarmUpCurve(curve Curve) WarmUpOption {
+	return func(c *warmUpConfig) {
+		c.curve = curve
+	}
+}
+
+// WarmUpSteps sets how many times the rate is raised along the ramp. The
+// default is 20.
+func WarmUpSteps(n int) WarmUpOption {
+	return func(c *warmUpConfig) {
+		c.steps = n
+	}
+}
+
+// WarmUpClock sets the function reading the time. The default is
+// time.Now.
+func WarmUpClock(now func() time.Time) WarmUpOption {
+	return func(c *warmUpConfig) {
+		c.now = now
+	}
+}
+
+// WarmUpLimiter raises the rate of an inner limiter from a fraction of a
+// target to the target over a ramp, so a service coming back from a
+// deploy or an outage is not flooded at once.
+type WarmUpLimiter struct {
+	inner  Limiter
+	setter RateSetter
+	target float64
+	ramp   time.Duration
+	cfg    warmUpConfig
+
+	// mu guards the fields below.
+	mu    sync.Mutex
+	start time.Time
+	step  int
+	rate  float64
+}
+
+// WarmUp returns a limiter admitting events through inner, whose rate it
+// ramps up to target events per second over ramp, starting now. inner
+// must implement RateSetter; WarmUp panics otherwise.
+//
+// The rate is raised in steps, lazily on the calls to the limiter, so an
+// idle limiter does no work. Once the ramp is over the rate stays at
+// target until Reset.
+func WarmUp(inner Limiter, target float64, ramp time.Duration, opts ...WarmUpOption) *WarmUpLimiter {
+	setter, ok := inner.(RateSetter)
+	if !ok {
+		panic(fmt.Sprintf("ratelimit: WarmUp limiter %T does not implement RateSetter", inner))
+	}
+	if target <= 0 {
+		panic("ratelimit: WarmUp target must be positive")
+	}
+
+	cfg := warmUpConfig{
+		from:  0.1,
+		curve: Linear,
+		steps: 20,
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.from <= 0 || cfg.from > 1 {
+		panic("ratelimit: WarmUp fraction must be in (0, 1]")
+	}
+	if cfg.steps < 1 {
+		cfg.steps = 1
+	}
+
+	w := &WarmUpLimiter{
+		inner:  inner,
+		setter: setter,
+		target: target,
+		ramp:   ramp,
+		cfg:    cfg,
+	}
+	w.Reset()
+	return w
+}
+
+// Allow reports whether one event may happen now.
+func (w *WarmUpLimiter) Allow() bool {
+	w.update()
+	return w.inner.Allow()
+}
+
+// AllowN reports whether n events may happen now.
+func (w *WarmUpLimiter) AllowN(n int) bool {
+	w.update()
+	return w.inner.AllowN(n)
+}
+
+// Wait blocks until one event may happen, or until ctx is done. While the
+// ramp lasts it wakes up at every step to raise the rate, so a waiter is
+// not held back by the rate it started waiting at.
+func (w *WarmUpLimiter) Wait(ctx context.Context) error {
+	for {
+		if !w.update() {
+			return w.inner.Wait(ctx)
+		}
+
+		stepCtx, cancel := context.WithTimeout(ctx, w.ramp/time.Duration(w.cfg.steps))
+		err := w.inner.Wait(stepCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// Rate returns the rate set on the inner limiter, in events per second.
+func (w *WarmUpLimiter) Rate() float64 {
+	w.update()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rate
+}
+
+// Reset restarts the ramp from its lowest rate. Call it when the
+// protected service recovers, such as when a circuit breaker closes.
+func (w *WarmUpLimiter) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.start = w.cfg.now()
+	w.step = -1
+	w.advance(w.start)
+}
+
+// update raises the rate if a new step of the ramp was reached, and
+// reports whether the ramp is still going.
+func (w *WarmUpLimiter) update() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.step == w.cfg.steps {
+		return false
+	}
+	w.advance(w.cfg.now())
+	return w.step < w.cfg.steps
+}
+
+// advance sets the rate of the step reached at now, if it changed. Caller
+// must hold the lock.
+func (w *WarmUpLimiter) advance(now time.Time) {
+	step := w.cfg.steps
+	if elapsed := now.Sub(w.start); w.ramp > 0 && elapsed < w.ramp {
+		step = int(int64(elapsed) * int64(w.cfg.steps) / int64(w.ramp))
+	}
+	if step == w.step {
+		return
+	}
+
+	w.step = step
+	w.rate = w.rateAt(float64(step) / float64(w.cfg.steps))
+	w.setter.SetRate(w.rate)
+}
+
+// rateAt returns the rate after the fraction p of the ramp.
+func (w *WarmUpLimiter) rateAt(p float64) float64 {
+	if p >= 1 {
+		return w.target
+	}
+	from := w.target * w.cfg.from
+	if w.cfg.curve == Exponential {
+		return from * math.Pow(w.target/from, p)
+	}
+	return from + (w.target-from)*p
+}
@@ -0,0 +1,187 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock moved by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// clockBucket is a token bucket filled by a fake clock.
+type clockBucket struct {
+	clock *fakeClock
+
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	burst  float64
+	last   time.Time
+}
+
+func newClockBucket(clock *fakeClock, burst float64) *clockBucket {
+	return &clockBucket{clock: clock, burst: burst, last: clock.Now()}
+}
+
+func (b *clockBucket) fill() {
+	now := b.clock.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+func (b *clockBucket) SetRate(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	b.rate = rate
+}
+
+func (b *clockBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+func (b *clockBucket) AllowN(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+func (b *clockBucket) Wait(ctx context.Context) error {
+	for !b.Allow() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// admitted offers the limiter as many events as it takes for d of
+// simulated time and returns how many it admitted per second.
+func admitted(l Limiter, clock *fakeClock, d time.Duration) float64 {
+	const tick = 10 * time.Millisecond
+
+	n := 0
+	for elapsed := time.Duration(0); elapsed < d; elapsed += tick {
+		clock.Add(tick)
+		for l.Allow() {
+			n++
+		}
+	}
+	return float64(n) / d.Seconds()
+}
+
+func TestWarmUpLinear(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	w := WarmUp(newClockBucket(clock, 100), 1000, 10*time.Second,
+		WarmUpFrom(0.1), WarmUpSteps(10), WarmUpClock(clock.Now))
+
+	// Each second of the ramp admits the rate of its step
+	for i, want := range []float64{100, 190, 280, 370, 460, 550, 640, 730, 820, 910, 1000, 1000} {
+		if got := admitted(w, clock, time.Second); math.Abs(got-want) > want*0.05 {
+			t.Errorf("second %d: admitted %.0f/s, want about %.0f/s", i, got, want)
+		}
+	}
+	if w.Rate() != 1000 {
+		t.Errorf("Rate after the ramp = %v, want 1000", w.Rate())
+	}
+}
+
+func TestWarmUpExponential(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	w := WarmUp(newClockBucket(clock, 100), 1000, 3*time.Second,
+		WarmUpFrom(0.001), WarmUpSteps(3), WarmUpCurve(Exponential), WarmUpClock(clock.Now))
+
+	for i, want := range []float64{1, 10, 100, 1000} {
+		if got := w.Rate(); math.Abs(got-want) > want*1e-9 {
+			t.Errorf("step %d: Rate = %v, want %v", i, got, want)
+		}
+		if got := admitted(w, clock, time.Second); math.Abs(got-want) > want*0.1+1 {
+			t.Errorf("step %d: admitted %.0f/s, want about %.0f/s", i, got, want)
+		}
+	}
+}
+
+func TestWarmUpReset(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	bucket := newClockBucket(clock, 1)
+	w := WarmUp(bucket, 100, time.Second, WarmUpFrom(0.5), WarmUpClock(clock.Now))
+
+	clock.Add(2 * time.Second)
+	if w.Rate() != 100 {
+		t.Fatalf("Rate after the ramp = %v, want 100", w.Rate())
+	}
+
+	// Reset goes back to the start of the ramp
+	w.Reset()
+	if w.Rate() != 50 {
+		t.Errorf("Rate after Reset = %v, want 50", w.Rate())
+	}
+	clock.Add(time.Second / 2)
+	if got := w.Rate(); got != 75 {
+		t.Errorf("Rate halfway = %v, want 75", got)
+	}
+}
+
+func TestWarmUpNoRamp(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	w := WarmUp(newClockBucket(clock, 1), 100, 0, WarmUpClock(clock.Now))
+	if w.Rate() != 100 {
+		t.Errorf("Rate = %v, want the target at once", w.Rate())
+	}
+}
+
+func TestWarmUpWait(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	w := WarmUp(newClockBucket(clock, 1), 100, 40*time.Millisecond, WarmUpClock(clock.Now))
+
+	// The waiter gives up on ctx while nothing is admitted
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := w.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait = %v, want context.DeadlineExceeded", err)
+	}
+
+	// It is admitted once time moves on
+	done := make(chan error)
+	go func() {
+		done <- w.Wait(context.Background())
+	}()
+	clock.Add(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("Wait = %v, want nil", err)
+	}
+}
+
+func TestWarmUpRequiresRateSetter(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WarmUp should panic when the limiter has no SetRate")
+		}
+	}()
+	WarmUp(struct{ Limiter }{}, 100, time.Second)
+}
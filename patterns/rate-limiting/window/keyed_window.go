@@ -0,0 +1,339 @@
+package window
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+)
+
+// KeyedWindow keeps a separate SlidingWindow per key, so one client
+// exhausting its limit does not affect the others.
+//
+// Windows are created on demand. Memory is bounded by a maximum number of
+// keys, evicting the least recently used key when full, and optionally by
+// an idle TTL enforced by a background eviction loop. The key space is
+// split into shards, each with its own lock, to keep contention low.
+type KeyedWindow struct {
+
+	// windowSize is the window size of every per-key window.
+	windowSize time.Duration
+
+	// bucketSize is the bucket size of every per-key window.
+	bucketSize time.Duration
+
+	// limit is the limit applied to every per-key window.
+	limit int
+
+	// bucketLimit is the per-bucket limit applied to every per-key window.
+	bucketLimit int
+
+	// maxKeys bounds the number of keys kept.
+	maxKeys int
+
+	// idleTTL evicts keys not accessed for this long. Zero disables it.
+	idleTTL time.Duration
+
+	// clock supplies the current time to the windows and the eviction loop.
+	clock clock.Clock
+
+	// shards holds the keys, selected by hash.
+	shards []*keyedShard
+
+	// closed is closed to stop the eviction loop.
+	closed chan struct{}
+
+	// closeOnce guards closing closed.
+	closeOnce sync.Once
+}
+
+// keyedShard is an LRU of windows guarded by its own lock.
+type keyedShard struct {
+	sync.Mutex
+
+	// capacity is the maximum number of keys in the shard.
+	capacity int
+
+	// entries maps keys to their element in lru.
+	entries map[string]*list.Element
+
+	// lru orders entries from most to least recently used.
+	lru *list.List
+}
+
+// keyedEntry is a window tracked by a shard.
+type keyedEntry struct {
+	key        string
+	window     *SlidingWindow
+	lastAccess time.Time
+}
+
+// KeyStats describes the window of a single key.
+type KeyStats struct {
+	// Key is the key the window belongs to.
+	Key string
+
+	// Used is the number of events counted in the current window.
+	Used int
+
+	// Limit is the maximum number of events allowed in the window.
+	Limit int
+
+	// LastAccess is the last time the key was used.
+	LastAccess time.Time
+}
+
+// KeyedOption configures a KeyedWindow.
+type KeyedOption func(*KeyedWindow)
+
+// WithMaxKeys bounds the number of keys kept. The default is 10000.
+func WithMaxKeys(n int) KeyedOption {
+	return func(kw *KeyedWindow) {
+		kw.maxKeys = n
+	}
+}
+
+// WithIdleTTL evicts keys that have not been accessed for ttl. The default
+// is zero, which keeps keys until they are pushed out by WithMaxKeys.
+func WithIdleTTL(ttl time.Duration) KeyedOption {
+	return func(kw *KeyedWindow) {
+		kw.idleTTL = ttl
+	}
+}
+
+// WithShards sets the number of shards the keys are split into.
+// The default is 16.
+func WithShards(n int) KeyedOption {
+	return func(kw *KeyedWindow) {
+		if n > 0 {
+			kw.shards = make([]*keyedShard, n)
+		}
+	}
+}
+
+// WithKeyedPerBucketLimit sets the per-bucket limit of every per-key window.
+func WithKeyedPerBucketLimit(n int) KeyedOption {
+	return func(kw *KeyedWindow) {
+		kw.bucketLimit = n
+	}
+}
+
+// WithKeyedClock sets the clock used by the per-key windows and, if it is
+// a clock.Clock, the ticker of the eviction loop.
+func WithKeyedClock(c Clock) KeyedOption {
+	return func(kw *KeyedWindow) {
+		kw.clock = clock.From(c)
+	}
+}
+
+// NewKeyed creates a KeyedWindow whose per-key windows have the given
+// window size, bucket size and limit. Window size must be divisible by
+// bucket size.
+func NewKeyed(windowSize, bucketSize time.Duration, limit int, opts ...KeyedOption) (*KeyedWindow, error) {
+	if windowSize <= 0 || bucketSize <= 0 {
+		return nil, fmt.Errorf("window size and bucket size must be positive")
+	}
+	if windowSize%bucketSize != 0 {
+		return nil, fmt.Errorf("window size must be divisible by bucket size")
+	}
+
+	kw := &KeyedWindow{
+		windowSize: windowSize,
+		bucketSize: bucketSize,
+		limit:      limit,
+		maxKeys:    10000,
+		clock:      clock.New(),
+		shards:     make([]*keyedShard, 16),
+		closed:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(kw)
+	}
+
+	if kw.maxKeys <= 0 {
+		return nil, fmt.Errorf("max keys must be positive")
+	}
+
+	// Never keep more shards than keys, so every shard holds at least one
+	if len(kw.shards) > kw.maxKeys {
+		kw.shards = kw.shards[:kw.maxKeys]
+	}
+	for i := range kw.shards {
+		kw.shards[i] = &keyedShard{
+			capacity: kw.maxKeys / len(kw.shards),
+			entries:  make(map[string]*list.Element),
+			lru:      list.New(),
+		}
+	}
+
+	// Start the idle eviction loop
+	if kw.idleTTL > 0 {
+		go kw.evictLoop()
+	}
+
+	return kw, nil
+}
+
+// Get returns the window for key, creating it if needed. Getting a key
+// marks it as recently used.
+//
+// A window evicted while a caller still holds it keeps working, but its
+// counts no longer apply to the key.
+func (kw *KeyedWindow) Get(key string) *SlidingWindow {
+	shard := kw.shard(key)
+	now := kw.clock.Now()
+
+	shard.Lock()
+	defer shard.Unlock()
+
+	// Existing key, move it to the front
+	if el, ok := shard.entries[key]; ok {
+		entry := el.Value.(*keyedEntry)
+		entry.lastAccess = now
+		shard.lru.MoveToFront(el)
+		return entry.window
+	}
+
+	// Make room by evicting the least recently used keys
+	for shard.lru.Len() >= shard.capacity {
+		shard.remove(shard.lru.Back())
+	}
+
+	entry := &keyedEntry{
+		key:        key,
+		window:     kw.newWindow(),
+		lastAccess: now,
+	}
+	shard.entries[key] = shard.lru.PushFront(entry)
+
+	return entry.window
+}
+
+// Allow reports whether a new event for key should be allowed.
+func (kw *KeyedWindow) Allow(key string) bool {
+	return kw.Get(key).Allow()
+}
+
+// Stats returns the state of the window for key. It does not create the
+// window or mark the key as used; ok is false if the key is not tracked.
+func (kw *KeyedWindow) Stats(key string) (stats KeyStats, ok bool) {
+	shard := kw.shard(key)
+
+	shard.Lock()
+	el, ok := shard.entries[key]
+	if !ok {
+		shard.Unlock()
+		return KeyStats{}, false
+	}
+	entry := el.Value.(*keyedEntry)
+	lastAccess := entry.lastAccess
+	shard.Unlock()
+
+	return KeyStats{
+		Key:        key,
+		Used:       entry.window.Used(),
+		Limit:      entry.window.Limit(),
+		LastAccess: lastAccess,
+	}, true
+}
+
+// Len returns the number of keys currently tracked.
+func (kw *KeyedWindow) Len() int {
+	var n int
+	for _, shard := range kw.shards {
+		shard.Lock()
+		n += shard.lru.Len()
+		shard.Unlock()
+	}
+	return n
+}
+
+// Remove stops tracking key.
+func (kw *KeyedWindow) Remove(key string) {
+	shard := kw.shard(key)
+
+	shard.Lock()
+	defer shard.Unlock()
+
+	if el, ok := shard.entries[key]; ok {
+		shard.remove(el)
+	}
+}
+
+// EvictIdle removes every key not accessed within ttl and returns how many
+// were removed. The eviction loop calls it periodically with the idle TTL;
+// callers without the loop can run their own sweeps.
+func (kw *KeyedWindow) EvictIdle(ttl time.Duration) int {
+	cutoff := kw.clock.Now().Add(-ttl)
+
+	var evicted int
+	for _, shard := range kw.shards {
+		shard.Lock()
+		// Oldest entries are at the back, stop at the first fresh one
+		for el := shard.lru.Back(); el != nil; el = shard.lru.Back() {
+			if el.Value.(*keyedEntry).lastAccess.After(cutoff) {
+				break
+			}
+			shard.remove(el)
+			evicted++
+		}
+		shard.Unlock()
+	}
+
+	return evicted
+}
+
+// Close stops the eviction loop. The tracked windows keep working.
+func (kw *KeyedWindow) Close() {
+	kw.closeOnce.Do(func() {
+		close(kw.closed)
+	})
+}
+
+// evictLoop periodically evicts idle keys until Close is called.
+func (kw *KeyedWindow) evictLoop() {
+	// A ticker needs a positive period, which halving 1ns is not
+	period := kw.idleTTL / 2
+	if period <= 0 {
+		period = 1
+	}
+	ticker := kw.clock.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			kw.EvictIdle(kw.idleTTL)
+		case <-kw.closed:
+			return
+		}
+	}
+}
+
+// newWindow creates a per-key window from the configuration.
+func (kw *KeyedWindow) newWindow() *SlidingWindow {
+	bucketCount := int(kw.windowSize / kw.bucketSize)
+
+	// The sizes were validated in NewKeyed
+	sw, _ := New(kw.windowSize, kw.bucketSize, bucketCount, WithClock(kw.clock))
+	sw.limit = kw.limit
+	sw.bucketLimit = kw.bucketLimit
+
+	return sw
+}
+
+// shard returns the shard owning key.
+func (kw *KeyedWindow) shard(key string) *keyedShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return kw.shards[h.Sum32()%uint32(len(kw.shards))]
+}
+
+// remove drops el from the shard. Caller must hold the lock.
+func (s *keyedShard) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.entries, el.Value.(*keyedEntry).key)
+}
@@ -0,0 +1,192 @@
+package window
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+)
+
+func TestNewKeyed(t *testing.T) {
+	kw, err := NewKeyed(10*time.Second, time.Second, 5)
+	if err != nil {
+		t.Fatalf("NewKeyed() failed: %v", err)
+	}
+	defer kw.Close()
+
+	if len(kw.shards) != 16 {
+		t.Errorf("len(kw.shards) = %v, want 16", len(kw.shards))
+	}
+	if kw.maxKeys != 10000 {
+		t.Errorf("kw.maxKeys = %v, want 10000", kw.maxKeys)
+	}
+
+	if _, err := NewKeyed(10*time.Second, 3*time.Second, 5); err == nil {
+		t.Error("NewKeyed() should have failed")
+	}
+	if _, err := NewKeyed(10*time.Second, time.Second, 5, WithMaxKeys(0)); err == nil {
+		t.Error("NewKeyed() should have failed")
+	}
+
+	// Fewer keys than shards shrinks the shard count
+	kw, _ = NewKeyed(10*time.Second, time.Second, 5, WithMaxKeys(4))
+	if len(kw.shards) != 4 {
+		t.Errorf("len(kw.shards) = %v, want 4", len(kw.shards))
+	}
+}
+
+func TestKeyedAllow(t *testing.T) {
+	kw, _ := NewKeyed(10*time.Second, time.Second, 2)
+
+	// Each key has its own limit
+	for _, key := range []string{"a", "b"} {
+		for i := 0; i < 2; i++ {
+			if !kw.Allow(key) {
+				t.Errorf("Allow(%q) #%d should have returned true", key, i)
+			}
+		}
+		if kw.Allow(key) {
+			t.Errorf("Allow(%q) over limit should have returned false", key)
+		}
+	}
+
+	stats, ok := kw.Stats("a")
+	if !ok {
+		t.Fatal("Stats(a) not found")
+	}
+	if stats.Key != "a" || stats.Used != 2 || stats.Limit != 2 {
+		t.Errorf("Stats(a) = %+v", stats)
+	}
+
+	// Stats does not create keys
+	if _, ok := kw.Stats("c"); ok {
+		t.Error("Stats(c) should not be found")
+	}
+	if kw.Len() != 2 {
+		t.Errorf("kw.Len() = %v, want 2", kw.Len())
+	}
+
+	kw.Remove("a")
+	if _, ok := kw.Stats("a"); ok {
+		t.Error("Stats(a) should not be found after Remove")
+	}
+}
+
+func TestKeyedLRU(t *testing.T) {
+	kw, _ := NewKeyed(10*time.Second, time.Second, 10, WithMaxKeys(2), WithShards(1))
+
+	a := kw.Get("a")
+	kw.Get("b")
+
+	// Touch a so b is the least recently used
+	if kw.Get("a") != a {
+		t.Error("Get(a) returned a different window")
+	}
+	kw.Get("c")
+
+	if _, ok := kw.Stats("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if _, ok := kw.Stats("a"); !ok {
+		t.Error("a should not have been evicted")
+	}
+	if kw.Len() != 2 {
+		t.Errorf("kw.Len() = %v, want 2", kw.Len())
+	}
+}
+
+func TestKeyedIdleTTL(t *testing.T) {
+	clock := newFakeClock()
+	kw, _ := NewKeyed(10*time.Second, time.Second, 10, WithKeyedClock(clock))
+
+	kw.Allow("old")
+	clock.Add(time.Minute)
+	kw.Allow("new")
+
+	if n := kw.EvictIdle(30 * time.Second); n != 1 {
+		t.Errorf("EvictIdle() = %v, want 1", n)
+	}
+	if _, ok := kw.Stats("old"); ok {
+		t.Error("old should have been evicted")
+	}
+	if _, ok := kw.Stats("new"); !ok {
+		t.Error("new should not have been evicted")
+	}
+}
+
+func TestKeyedTinyIdleTTL(t *testing.T) {
+
+	// Half of 1ns is no ticker period, so the loop ticks every 1ns
+	kw, err := NewKeyed(10*time.Second, time.Second, 10, WithIdleTTL(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kw.Close()
+
+	kw.Allow("a")
+	for deadline := time.Now().Add(time.Second); kw.Len() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("kw.Len() = %v, want 0", kw.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKeyedEvictLoop(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	kw, _ := NewKeyed(10*time.Second, time.Second, 10, WithIdleTTL(time.Minute), WithKeyedClock(clk))
+	defer kw.Close()
+
+	kw.Allow("a")
+	clk.BlockUntil(1)
+	clk.Add(30 * time.Second)
+	if kw.Len() != 1 {
+		t.Errorf("kw.Len() = %v before the TTL, want 1", kw.Len())
+	}
+
+	// The loop evicts the key on the tick after the TTL
+	clk.Add(time.Minute)
+	for deadline := time.Now().Add(time.Second); kw.Len() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("kw.Len() = %v, want 0", kw.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKeyedStress(t *testing.T) {
+	const maxKeys = 1000
+	kw, _ := NewKeyed(time.Minute, time.Second, 1<<30, WithMaxKeys(maxKeys))
+
+	hot := kw.Get("hot")
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100000/8; i++ {
+				kw.Allow(fmt.Sprintf("client-%d-%d", w, i))
+
+				// The hot key is used far more often than any cold key
+				if i%10 == 0 {
+					kw.Allow("hot")
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if n := kw.Len(); n > maxKeys {
+		t.Errorf("kw.Len() = %v, want at most %v", n, maxKeys)
+	}
+	if kw.Get("hot") != hot {
+		t.Error("hot key was evicted")
+	}
+	stats, _ := kw.Stats("hot")
+	if stats.Used != 100000/8/10*8 {
+		t.Errorf("hot Used = %v, want %v", stats.Used, 100000/8/10*8)
+	}
+}
@@ -0,0 +1,93 @@
+package window
+
+// Ring holds a value for each of the latest n time slots. Slots are
+// numbered from an origin the caller chooses, such as a start time
+// divided by a slot size, and the ring keeps slots (head-n, head], where
+// head is the newest slot it advanced to. SlidingWindow uses it for its
+// buckets; stream operators use it for the accumulators of overlapping
+// windows.
+type Ring[T any] struct {
+	values []T
+	head   int
+}
+
+// NewRing creates a ring of n slots, at least 1, holding slots (-n, 0].
+func NewRing[T any](n int) *Ring[T] {
+	if n < 1 {
+		n = 1
+	}
+	return &Ring[T]{values: make([]T, n)}
+}
+
+// Len returns the number of slots the ring holds.
+func (r *Ring[T]) Len() int {
+	return len(r.values)
+}
+
+// Head returns the newest slot.
+func (r *Ring[T]) Head() int {
+	return r.head
+}
+
+// At returns the value of slot k, or nil if the ring does not hold it.
+func (r *Ring[T]) At(k int) *T {
+	if k > r.head || k <= r.head-len(r.values) {
+		return nil
+	}
+	return &r.values[r.index(k)]
+}
+
+// Advance moves the head forward to slot k; it does nothing if k is not
+// after the head. Each slot leaving the ring, oldest first, is passed to
+// evict with its value, including the slots entering and leaving within
+// the same call, which have the zero value. Slots entering the ring start
+// at the zero value. A nil evict skips slots that never held a value, so
+// long jumps cost at most one lap.
+func (r *Ring[T]) Advance(k int, evict func(slot int, v T)) {
+	if k <= r.head {
+		return
+	}
+
+	n := len(r.values)
+	if evict != nil {
+		var zero T
+		for s := r.head - n + 1; s <= k-n; s++ {
+			if v := r.At(s); v != nil {
+				evict(s, *v)
+			} else {
+				evict(s, zero)
+			}
+		}
+	}
+
+	// Clear every slot between the old head and k, at most one lap
+	from := r.head + 1
+	if k-from >= n {
+		from = k - n + 1
+	}
+	var zero T
+	for s := from; s <= k; s++ {
+		r.values[r.index(s)] = zero
+	}
+
+	r.head = k
+}
+
+// Reset sets every value to zero and the head to k.
+func (r *Ring[T]) Reset(k int) {
+	var zero T
+	for i := range r.values {
+		r.values[i] = zero
+	}
+	r.head = k
+}
+
+// index maps slot k onto [0, n), normalizing negative values.
+func (r *Ring[T]) index(k int) int {
+	n := len(r.values)
+	k %= n
+	if k < 0 {
+		k += n
+	}
+	return k
+}
@@ -0,0 +1,62 @@
+package window
+
+import "testing"
+
+func TestRing(t *testing.T) {
+	r := NewRing[int](3)
+	if r.Len() != 3 || r.Head() != 0 {
+		t.Fatalf("Len() = %d, Head() = %d, want 3, 0", r.Len(), r.Head())
+	}
+
+	// Slots (-3, 0] are held
+	for k := -2; k <= 0; k++ {
+		*r.At(k) = k + 10
+	}
+	if r.At(1) != nil || r.At(-3) != nil {
+		t.Error("At() should return nil for slots not held")
+	}
+
+	var evicted [][2]int
+	evict := func(slot, v int) { evicted = append(evicted, [2]int{slot, v}) }
+
+	// Moving to 2 evicts -2 and -1; slots 1 and 2 start at zero
+	r.Advance(2, evict)
+	want := [][2]int{{-2, 8}, {-1, 9}}
+	if len(evicted) != len(want) || evicted[0] != want[0] || evicted[1] != want[1] {
+		t.Errorf("evicted %v, want %v", evicted, want)
+	}
+	if *r.At(0) != 10 || *r.At(1) != 0 || *r.At(2) != 0 {
+		t.Errorf("slots 0-2 = %d %d %d, want 10 0 0", *r.At(0), *r.At(1), *r.At(2))
+	}
+
+	// A jump over more than a lap evicts every slot in between, in order
+	evicted = nil
+	r.Advance(7, evict)
+	if len(evicted) != 5 || evicted[0] != [2]int{0, 10} || evicted[4] != [2]int{4, 0} {
+		t.Errorf("evicted %v, want slots 0-4 with 0 valued 10", evicted)
+	}
+
+	// Going back does nothing
+	r.Advance(5, evict)
+	if r.Head() != 7 {
+		t.Errorf("Head() = %d, want 7", r.Head())
+	}
+
+	*r.At(7) = 1
+	r.Reset(100)
+	if r.Head() != 100 || *r.At(100) != 0 {
+		t.Errorf("after Reset, Head() = %d and slot 100 = %d, want 100 and 0", r.Head(), *r.At(100))
+	}
+}
+
+func TestRingAdvanceWithoutEvict(t *testing.T) {
+	r := NewRing[int](2)
+	*r.At(0) = 5
+
+	// A long jump only clears the slots once
+	const far = 1 << 40
+	r.Advance(far, nil)
+	if *r.At(far) != 0 || *r.At(far - 1) != 0 {
+		t.Error("slots should be zero after a jump")
+	}
+}
@@ -1,16 +1,50 @@
 package window
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sync"
 	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
 )
 
+// SlidingWindow implements ratelimit.Limiter and ratelimit.Reporter.
+var _ ratelimit.Limiter = (*SlidingWindow)(nil)
+var _ ratelimit.Reporter = (*SlidingWindow)(nil)
+var _ ratelimit.Refunder = (*SlidingWindow)(nil)
+
+// Clock supplies the current time to a SlidingWindow. If it is a
+// clock.Clock, Wait uses its timers too.
+type Clock interface {
+	Now() time.Time
+}
+
+// Option configures a SlidingWindow.
+type Option func(*SlidingWindow)
+
+// WithClock sets the clock used by the window. The default reads the
+// system clock.
+func WithClock(c Clock) Option {
+	return func(sw *SlidingWindow) {
+		sw.clock = clock.From(c)
+	}
+}
+
 // SlidingWindow implements a fixed-size sliding window for rate limiting.
+//
+// Bucket positions are computed from the time elapsed since a start time
+// captured once, on the first event. Times returned by time.Now carry a
+// monotonic clock reading, so with the default clock the elapsed time is
+// not affected by wall clock steps such as NTP adjustments.
 type SlidingWindow struct {
 	sync.Mutex
 
+	// clock supplies the current time and the timers of Wait.
+	clock clock.Clock
+
 	// windowSize is the size of the sliding window in time units.
 	windowSize time.Duration
 
@@ -20,19 +54,76 @@ type SlidingWindow struct {
 	// bucketCount is the number of buckets in the window.
 	bucketCount int
 
-	// buckets tracks the count in each bucket.
-	buckets []int
+	// ring tracks the count in each bucket. The window holds its slots
+	// (head-bucketCount, head], where head is the newest slot it has
+	// advanced to.
+	ring Ring[int]
 
-	// startTime records the start time of the window
+	// startTime records the start time of the window. Bucket slots are
+	// numbered from here: slot k covers the half-open interval
+	// [startTime+k*bucketSize, startTime+(k+1)*bucketSize) and is ring
+	// slot k, so an event exactly on a boundary belongs to the later
+	// bucket only.
 	startTime time.Time
 
 	// lastRequestTime records the end time of the window
 	lastRequestTime time.Time
+
+	// limit is the maximum number of events allowed in the window.
+	// Zero means no limit.
+	limit int
+
+	// bucketLimit is the maximum number of events allowed in a single
+	// bucket, shaping bursts within the window. Zero means no limit.
+	bucketLimit int
+}
+
+// Reason tells which constraint decided an Allow call.
+type Reason int
+
+const (
+	// ReasonAllowed means no constraint rejected the event.
+	ReasonAllowed Reason = iota
+
+	// ReasonWindowLimit means the window total reached the limit.
+	ReasonWindowLimit
+
+	// ReasonBucketLimit means the current bucket reached the per-bucket limit.
+	ReasonBucketLimit
+)
+
+// String returns the name of the reason.
+func (r Reason) String() string {
+	switch r {
+	case ReasonAllowed:
+		return "allowed"
+	case ReasonWindowLimit:
+		return "window limit"
+	case ReasonBucketLimit:
+		return "bucket limit"
+	default:
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+}
+
+// Decision describes the outcome of an Allow call.
+type Decision struct {
+	// Allowed reports whether the event was admitted.
+	Allowed bool
+
+	// Reason tells which constraint rejected the event, or ReasonAllowed.
+	Reason Reason
+
+	// Used is the window total after the decision.
+	Used int
+
+	// BucketUsed is the current bucket count after the decision.
+	BucketUsed int
 }
 
 // NewSlidingWindow creates a new sliding window with the given window size, bucket size
 // and bucket count. Window size must be divisible by bucket size.
-func New(windowSize, bucketSize time.Duration, bucketCount int) (*SlidingWindow, error) {
+func New(windowSize, bucketSize time.Duration, bucketCount int, opts ...Option) (*SlidingWindow, error) {
 	if windowSize%bucketSize != 0 {
 		return nil, fmt.Errorf("window size must be divisible by bucket size")
 	}
@@ -45,54 +136,220 @@ func New(windowSize, bucketSize time.Duration, bucketCount int) (*SlidingWindow,
 		windowSize:  windowSize,
 		bucketSize:  bucketSize,
 		bucketCount: bucketCount,
-		buckets:     make([]int, bucketCount),
+		ring:        Ring[int]{values: make([]int, bucketCount)},
+		clock:       clock.New(),
+	}
+	for _, opt := range opts {
+		opt(sw)
 	}
 	return sw, nil
 }
 
 // Allow reports whether a new event should be allowed, and if so increments the
+// count of the current bucket.
 func (sw *SlidingWindow) Allow() bool {
+	return sw.Decide().Allowed
+}
+
+// AllowN reports whether n new events should be allowed, and if so counts
+// all of them in the current bucket.
+func (sw *SlidingWindow) AllowN(n int) bool {
+	if n <= 0 {
+		return true
+	}
+	return sw.decide(n).Allowed
+}
+
+// Decide works like Allow but returns the full decision, including which
+// constraint rejected the event.
+func (sw *SlidingWindow) Decide() Decision {
+	return sw.decide(1)
+}
+
+// decide admits n events if every constraint allows them.
+func (sw *SlidingWindow) decide(n int) Decision {
 
 	sw.Lock()
 	defer sw.Unlock()
 
-	now := time.Now()
+	now := sw.clock.Now()
 
 	// Initialize start time
 	if sw.startTime.IsZero() {
 		sw.startTime = now
 	}
 
-	// Check if request time exceeds window size
-	if now.Sub(sw.startTime) > sw.windowSize {
+	// Slide the window, expiring buckets that fell out of it
+	sw.advance(now)
 
-		// Reset window if exceeded
-		sw.resetWindow(now)
-		return false
+	d := Decision{
+		Used:       sw.used(),
+		BucketUsed: sw.ring.values[sw.ring.index(sw.ring.head)],
 	}
 
-	// Calculate bucket index
-	bucketIdx := sw.getBucketIndex(now)
+	// Reject if the window has used up its limit
+	if sw.limit > 0 && d.Used+n > sw.limit {
+		d.Reason = ReasonWindowLimit
+		return d
+	}
 
-	// Increment bucket count
-	sw.buckets[bucketIdx]++
+	// Reject if the current bucket has used up its share
+	if sw.bucketLimit > 0 && d.BucketUsed+n > sw.bucketLimit {
+		d.Reason = ReasonBucketLimit
+		return d
+	}
+
+	// Increment the current bucket count
+	sw.ring.values[sw.ring.index(sw.ring.head)] += n
 
 	// Update last request time
 	sw.lastRequestTime = now
 
-	return true
+	d.Allowed = true
+	d.Used += n
+	d.BucketUsed += n
+	return d
 
 }
 
+// RefundN uncounts n events, newest bucket first. Events already slid out
+// of the window cannot be refunded.
+func (sw *SlidingWindow) RefundN(n int) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	sw.advance(sw.clock.Now())
+
+	for k := sw.ring.head; n > 0 && k > sw.ring.head-sw.bucketCount; k-- {
+		i := sw.ring.index(k)
+		take := n
+		if sw.ring.values[i] < take {
+			take = sw.ring.values[i]
+		}
+		sw.ring.values[i] -= take
+		n -= take
+	}
+}
+
+// Wait blocks until an event is allowed, or until ctx is done.
+func (sw *SlidingWindow) Wait(ctx context.Context) error {
+	for {
+		if sw.Allow() {
+			return nil
+		}
+
+		// Sleep until enough of the window has slid out
+		timer := sw.clock.NewTimer(sw.RetryAfter())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// Remaining returns how many events are allowed now. Without a limit it
+// returns math.MaxInt32.
+func (sw *SlidingWindow) Remaining() int {
+	sw.Lock()
+	defer sw.Unlock()
+
+	sw.advance(sw.clock.Now())
+
+	left := math.MaxInt32
+	if sw.limit > 0 {
+		left = sw.limit - sw.used()
+	}
+	if sw.bucketLimit > 0 {
+		if b := sw.bucketLimit - sw.ring.values[sw.ring.index(sw.ring.head)]; b < left {
+			left = b
+		}
+	}
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// RetryAfter returns how long until the next event is allowed, or zero if
+// one is allowed now.
+func (sw *SlidingWindow) RetryAfter() time.Duration {
+	sw.Lock()
+	defer sw.Unlock()
+
+	now := sw.clock.Now()
+	sw.advance(now)
+
+	var wait time.Duration
+
+	// The window limit frees up as the oldest buckets slide out
+	if used := sw.used(); sw.limit > 0 && used >= sw.limit {
+		for k := sw.ring.head - sw.bucketCount + 1; k <= sw.ring.head; k++ {
+			used -= sw.ring.values[sw.ring.index(k)]
+			if used < sw.limit {
+				wait = sw.slotStart(k + sw.bucketCount).Sub(now)
+				break
+			}
+		}
+	}
+
+	// The bucket limit frees up when the next bucket starts
+	if sw.bucketLimit > 0 && sw.ring.values[sw.ring.index(sw.ring.head)] >= sw.bucketLimit {
+		if d := sw.slotStart(sw.ring.head + 1).Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
 // Reset window by clearing buckets and resetting start time
 func (sw *SlidingWindow) resetWindow(now time.Time) {
 	sw.startTime = now
 	sw.lastRequestTime = now
+	sw.ring.head = 0
 
 	// Clear all bucket counts
-	for i := 0; i < len(sw.buckets); i++ {
-		sw.buckets[i] = 0
+	for i := 0; i < len(sw.ring.values); i++ {
+		sw.ring.values[i] = 0
+	}
+}
+
+// advance moves the ring forward to the slot containing now, zeroing the
+// buckets whose time range slid out of the window. Caller must hold the lock.
+func (sw *SlidingWindow) advance(now time.Time) {
+	if sw.startTime.IsZero() {
+		return
+	}
+
+	// A clock without monotonic readings can step backwards. Treat the
+	// step as time standing still: move the start back so now falls at the
+	// beginning of the head bucket instead of an older one.
+	if head := sw.slotStart(sw.ring.head); now.Before(head) {
+		sw.startTime = sw.startTime.Add(now.Sub(head))
+	}
+
+	slot := sw.getBucketIndex(now)
+	if slot <= sw.ring.head {
+		return
 	}
+
+	sw.ring.Advance(slot, nil)
+}
+
+// slotOf returns the slot currently held by ring index i.
+// Caller must hold the lock.
+func (sw *SlidingWindow) slotOf(i int) int {
+	return sw.ring.head - sw.ring.index(sw.ring.head-i)
+}
+
+// slotStart returns the start time of slot k. Caller must hold the lock.
+func (sw *SlidingWindow) slotStart(k int) time.Time {
+	return sw.startTime.Add(time.Duration(k) * sw.bucketSize)
 }
 
 // Count returns the total count for the given duration
@@ -117,48 +374,271 @@ func (sw *SlidingWindow) Count(d time.Duration) int {
 	var count int
 	for i := start; i < end; i++ {
 		bucketIndex := i % sw.bucketCount
-		count += sw.buckets[bucketIndex]
+		count += sw.ring.values[bucketIndex]
 	}
 
 	return count
 }
 
-// Get bucket index for the given timestamp
-func (sw *SlidingWindow) getBucketIndex(time time.Time) int {
+// Get bucket index for the given timestamp. Buckets are half-open, so a
+// timestamp exactly on a boundary maps to the later bucket.
+func (sw *SlidingWindow) getBucketIndex(t time.Time) int {
 
-	elapsed := time.Sub(sw.startTime).Nanoseconds()
+	elapsed := t.Sub(sw.startTime)
 
-	// Convert seconds to int64 to avoid precision loss
-	secs := int64(elapsed)
-
-	// Check overflow
-	if secs > math.MaxInt64 {
-		// Handle overflow case
-		return 0
+	// Floor division, so times before the start map to negative slots
+	idx := elapsed / sw.bucketSize
+	if elapsed < 0 && elapsed%sw.bucketSize != 0 {
+		idx--
 	}
 
-	bucketSizeSecs := int64(sw.bucketSize.Nanoseconds())
-
-	// Compute bucket index
-	idx := int(secs / bucketSizeSecs)
-
-	return idx
+	return int(idx)
 }
 
 // Reset resets the counts in all buckets to 0.
+//
+// Use ExpireBefore to clear only old buckets.
 func (sw *SlidingWindow) Reset() {
 	sw.Lock()
 	defer sw.Unlock()
 
 	for i := 0; i < sw.bucketCount; i++ {
-		sw.buckets[i] = 0
+		sw.ring.values[i] = 0
 	}
 }
 
 // BucketCount returns the current count for the given bucket index.
+// The index wraps around the ring in both directions, so any int is
+// valid: -1 refers to the last bucket and bucketCount to the first.
 func (sw *SlidingWindow) BucketCount(idx int) int {
 	sw.Lock()
 	defer sw.Unlock()
 
-	return sw.buckets[idx%sw.bucketCount]
+	sw.advance(sw.clock.Now())
+	return sw.ring.values[sw.ring.index(idx)]
+}
+
+// BucketInfo describes a single bucket in a Buckets snapshot.
+type BucketInfo struct {
+	// Count is the number of events counted in the bucket.
+	Count int
+
+	// Start is the inclusive start of the time range the bucket covers.
+	Start time.Time
+
+	// End is the exclusive end of the time range the bucket covers.
+	End time.Time
+}
+
+// Buckets returns a snapshot of every bucket in the ring, in ring order,
+// so Buckets()[i] matches BucketCount(i). Because the ring wraps, the
+// oldest bucket is not necessarily the first one.
+// The snapshot is a copy taken under the lock and is not affected by
+// later calls to Allow. Start and End are zero until the window has seen
+// its first event.
+func (sw *SlidingWindow) Buckets() []BucketInfo {
+	sw.Lock()
+	defer sw.Unlock()
+
+	sw.advance(sw.clock.Now())
+
+	infos := make([]BucketInfo, sw.bucketCount)
+	for i, c := range sw.ring.values {
+		infos[i].Count = c
+		if sw.startTime.IsZero() {
+			continue
+		}
+		k := sw.slotOf(i)
+		infos[i].Start = sw.slotStart(k)
+		infos[i].End = sw.slotStart(k + 1)
+	}
+
+	return infos
+}
+
+// ExpireBefore zeroes the buckets whose whole time range ends at or
+// before t, leaving buckets that overlap [t, now] untouched. It is safe to
+// call while Allow is running on other goroutines.
+func (sw *SlidingWindow) ExpireBefore(t time.Time) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	if sw.startTime.IsZero() {
+		return
+	}
+
+	sw.advance(sw.clock.Now())
+
+	for i := range sw.ring.values {
+		if !sw.slotStart(sw.slotOf(i) + 1).After(t) {
+			sw.ring.values[i] = 0
+		}
+	}
+}
+
+// SetLimit sets the maximum number of events allowed in the window.
+// A limit of zero or less disables limiting. It is safe to call while
+// Allow is running on other goroutines.
+func (sw *SlidingWindow) SetLimit(n int) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	sw.limit = n
+}
+
+// Limit returns the maximum number of events allowed in the window.
+func (sw *SlidingWindow) Limit() int {
+	sw.Lock()
+	defer sw.Unlock()
+
+	return sw.limit
+}
+
+// SetPerBucketLimit sets the maximum number of events allowed in a single
+// bucket, so the window budget cannot be spent in one burst. For example a
+// limit of 600 per minute with one second buckets and a per-bucket limit of
+// 20 allows at most 20 events in any one second. A limit of zero or less
+// disables it. It is safe to call while Allow is running on other goroutines.
+func (sw *SlidingWindow) SetPerBucketLimit(n int) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	sw.bucketLimit = n
+}
+
+// PerBucketLimit returns the maximum number of events allowed in a single bucket.
+func (sw *SlidingWindow) PerBucketLimit() int {
+	sw.Lock()
+	defer sw.Unlock()
+
+	return sw.bucketLimit
+}
+
+// Used returns the number of events counted in the current window.
+func (sw *SlidingWindow) Used() int {
+	sw.Lock()
+	defer sw.Unlock()
+
+	sw.advance(sw.clock.Now())
+	return sw.used()
+}
+
+// used sums all bucket counts. Caller must hold the lock.
+func (sw *SlidingWindow) used() int {
+	var total int
+	for _, c := range sw.ring.values {
+		total += c
+	}
+	return total
+}
+
+// Resize changes the window and bucket size of a live window. The bucket
+// count becomes windowSize / bucketSize.
+//
+// Existing counts are re-binned into the new buckets so recent history
+// survives the resize. This is an approximation: events are assumed to be
+// spread evenly over the part of their bucket that has already elapsed, so
+// a count split across several new buckets is divided in proportion to the
+// overlap and rounded down. When the new window is shorter, counts older
+// than the new window are dropped.
+//
+// It is safe to call while Allow is running on other goroutines.
+func (sw *SlidingWindow) Resize(windowSize, bucketSize time.Duration) error {
+	if windowSize <= 0 || bucketSize <= 0 {
+		return fmt.Errorf("window size and bucket size must be positive")
+	}
+	if windowSize%bucketSize != 0 {
+		return fmt.Errorf("window size must be divisible by bucket size")
+	}
+
+	sw.Lock()
+	defer sw.Unlock()
+
+	bucketCount := int(windowSize / bucketSize)
+	buckets := make([]int, bucketCount)
+	head := 0
+
+	// Re-bin recorded history into the new layout
+	if !sw.startTime.IsZero() {
+		now := sw.clock.Now()
+		sw.advance(now)
+		head = int(now.Sub(sw.startTime) / bucketSize)
+		sw.rebin(buckets, now, bucketSize, head)
+	}
+
+	sw.windowSize = windowSize
+	sw.bucketSize = bucketSize
+	sw.bucketCount = bucketCount
+	sw.ring = Ring[int]{values: buckets, head: head}
+
+	return nil
+}
+
+// rebin redistributes the current bucket counts into buckets, a ring of
+// bucketSize buckets whose newest slot is head. Caller must hold the lock.
+func (sw *SlidingWindow) rebin(buckets []int, now time.Time, bucketSize time.Duration, head int) {
+	elapsed := now.Sub(sw.startTime)
+	first := head - len(buckets) + 1
+
+	for i, c := range sw.ring.values {
+		if c == 0 {
+			continue
+		}
+
+		// Old bucket range as an offset from the start, clipped to now
+		k := sw.slotOf(i)
+		from := time.Duration(k) * sw.bucketSize
+		to := minDuration(from+sw.bucketSize, elapsed)
+		if to <= from {
+			to = from + 1
+		}
+		span := to - from
+
+		// Walk the new slots overlapping [from, to), handing out the
+		// count in proportion to the overlap
+		var overlap time.Duration
+		var given int
+		for j := maxInt(first, int(from/bucketSize)); j <= head; j++ {
+			lo := maxDuration(from, time.Duration(j)*bucketSize)
+			hi := minDuration(to, time.Duration(j+1)*bucketSize)
+			if hi <= lo {
+				break
+			}
+			overlap += hi - lo
+			share := int(float64(c) * float64(overlap) / float64(span))
+			idx := j % len(buckets)
+			if idx < 0 {
+				idx += len(buckets)
+			}
+			buckets[idx] += share - given
+			given = share
+		}
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
 }
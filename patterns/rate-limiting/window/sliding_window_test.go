@@ -1,8 +1,15 @@
 package window
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/ratelimittest"
 )
 
 func TestNew(t *testing.T) {
@@ -48,7 +55,8 @@ func TestAllow(t *testing.T) {
 	windowSize := 100 * time.Millisecond
 	bucketSize := 2 * time.Millisecond
 	bucketCount := 50
-	sw, err := New(windowSize, bucketSize, bucketCount)
+	clk := clock.NewFake(time.Unix(0, 0))
+	sw, err := New(windowSize, bucketSize, bucketCount, WithClock(clk))
 	if err != nil {
 		t.Errorf("New() failed: %v", err)
 	}
@@ -58,11 +66,35 @@ func TestAllow(t *testing.T) {
 		t.Errorf("Allow() should have returned true")
 	}
 
-	// Case 2: reject new event because window has been exceeded.
-	time.Sleep(windowSize + bucketSize)
+	// Case 2: old events expire once the window has slid past them.
+	clk.Add(windowSize + bucketSize)
 	ok = sw.Allow()
-	if ok {
-		t.Errorf("Allow() should have returned false")
+	if !ok {
+		t.Errorf("Allow() should have returned true")
+	}
+	if sw.Used() != 1 {
+		t.Errorf("sw.Used() = %v, want 1", sw.Used())
+	}
+}
+
+func TestWaitClock(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	sw, _ := New(time.Second, 100*time.Millisecond, 10, WithClock(clk))
+	sw.SetLimit(1)
+	sw.Allow()
+
+	// Wait sleeps on the clock until the event slides out
+	done := make(chan error)
+	go func() {
+		done <- sw.Wait(context.Background())
+	}()
+	clk.BlockUntil(1)
+	clk.Add(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("Wait() = %v, want nil", err)
+	}
+	if sw.Used() != 1 {
+		t.Errorf("sw.Used() = %v, want 1", sw.Used())
 	}
 }
 
@@ -80,9 +112,9 @@ func TestResetWindow(t *testing.T) {
 	sw.Allow()
 	sw.resetWindow(now)
 
-	for i := 0; i < len(sw.buckets); i++ {
-		if sw.buckets[i] != 0 {
-			t.Errorf("sw.buckets[%v] = %v, want 0", i, sw.buckets[i])
+	for i := 0; i < len(sw.ring.values); i++ {
+		if sw.ring.values[i] != 0 {
+			t.Errorf("sw.ring.values[%v] = %v, want 0", i, sw.ring.values[i])
 		}
 	}
 }
@@ -92,21 +124,21 @@ func TestCount(t *testing.T) {
 	sw, _ := New(10*time.Second, 1*time.Second, 10) // 创建测试滑动窗口
 
 	// 1个时间单位内计数
-	sw.buckets[0] = 1
+	sw.ring.values[0] = 1
 	c := sw.Count(sw.bucketSize)
 	if c != 1 {
 		t.Errorf("count 1 time unit failed, got %d", c)
 	}
 
 	// 多个时间单位内计数
-	sw.buckets[0] = 1
-	sw.buckets[1] = 2
+	sw.ring.values[0] = 1
+	sw.ring.values[1] = 2
 	c = sw.Count(2 * sw.bucketSize)
 	if c != 3 {
 		t.Errorf("count 2 time units failed, got %d", c)
 	}
 
-	sw.buckets[2] = 5
+	sw.ring.values[2] = 5
 	c = sw.Count(sw.windowSize)
 	if c != 8 {
 		t.Errorf("count 2 time units failed, got %d", c)
@@ -135,11 +167,11 @@ func TestGetBucketIndex(t *testing.T) {
 func TestReset(t *testing.T) {
 	sw := newTestSlidingWindow()
 
-	sw.buckets[0] = 10
+	sw.ring.values[0] = 10
 	sw.Reset()
 
 	for i := 0; i < sw.bucketCount; i++ {
-		if sw.buckets[i] != 0 {
+		if sw.ring.values[i] != 0 {
 			t.Error("Reset failed")
 		}
 	}
@@ -149,3 +181,599 @@ func newTestSlidingWindow() *SlidingWindow {
 	sw, _ := New(10*time.Second, 1*time.Second, 10) // 创建测试滑动窗口
 	return sw
 }
+
+func TestSetLimit(t *testing.T) {
+	sw := newTestSlidingWindow()
+	sw.SetLimit(3)
+
+	for i := 0; i < 3; i++ {
+		if !sw.Allow() {
+			t.Errorf("Allow() #%d should have returned true", i)
+		}
+	}
+	if sw.Allow() {
+		t.Error("Allow() over limit should have returned false")
+	}
+	if sw.Used() != 3 {
+		t.Errorf("sw.Used() = %v, want 3", sw.Used())
+	}
+
+	// Raising the limit admits more events
+	sw.SetLimit(4)
+	if !sw.Allow() {
+		t.Error("Allow() under raised limit should have returned true")
+	}
+
+	// Zero disables limiting
+	sw.SetLimit(0)
+	if !sw.Allow() {
+		t.Error("Allow() without limit should have returned true")
+	}
+}
+
+func TestResize(t *testing.T) {
+	sw := newTestSlidingWindow()
+
+	// Start 3s ago with 10 events in each of the first three 1s buckets
+	sw.startTime = time.Now().Add(-3 * time.Second)
+	sw.ring.head = 2
+	sw.ring.values[0] = 10
+	sw.ring.values[1] = 10
+	sw.ring.values[2] = 10
+
+	// Split into 500ms buckets: every old bucket spreads over two new ones
+	if err := sw.Resize(5*time.Second, 500*time.Millisecond); err != nil {
+		t.Fatalf("Resize() failed: %v", err)
+	}
+	if sw.bucketCount != 10 || len(sw.ring.values) != 10 {
+		t.Fatalf("sw.bucketCount = %v, want 10", sw.bucketCount)
+	}
+	for i := 0; i < 6; i++ {
+		if sw.ring.values[i] != 5 {
+			t.Errorf("sw.ring.values[%v] = %v, want 5", i, sw.ring.values[i])
+		}
+	}
+	if sw.Used() != 30 {
+		t.Errorf("sw.Used() = %v, want 30", sw.Used())
+	}
+
+	// Shrink below the elapsed time: only the most recent history is kept
+	if err := sw.Resize(time.Second, 500*time.Millisecond); err != nil {
+		t.Fatalf("Resize() failed: %v", err)
+	}
+	if sw.Used() != 5 {
+		t.Errorf("sw.Used() = %v, want 5", sw.Used())
+	}
+
+	// Invalid sizes are rejected
+	if err := sw.Resize(time.Second, 300*time.Millisecond); err == nil {
+		t.Error("Resize() should have failed")
+	}
+	if err := sw.Resize(0, 0); err == nil {
+		t.Error("Resize() should have failed")
+	}
+}
+
+func TestResizeConcurrent(t *testing.T) {
+	sw, _ := New(time.Second, 10*time.Millisecond, 100)
+	sw.SetLimit(1000)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var allowed int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if sw.Allow() {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+
+	sizes := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond, 5 * time.Millisecond}
+	for i := 0; i < 20; i++ {
+		if err := sw.Resize(time.Second, sizes[i%len(sizes)]); err != nil {
+			t.Fatalf("Resize() failed: %v", err)
+		}
+		sw.SetLimit(500 + i*50)
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	// The lock must still be usable
+	if !sw.TryLock() {
+		t.Fatal("lock still held after resize")
+	}
+	sw.Unlock()
+
+	used := sw.Used()
+	if used < 0 || used > sw.Limit() || int64(used) > atomic.LoadInt64(&allowed) {
+		t.Errorf("sw.Used() = %v out of range, limit %v, allowed %v", used, sw.Limit(), allowed)
+	}
+}
+
+func TestBucketCount(t *testing.T) {
+	sw := newTestSlidingWindow()
+	for i := 0; i < sw.bucketCount; i++ {
+		sw.ring.values[i] = i + 1
+	}
+
+	cases := []struct {
+		idx  int
+		want int
+	}{
+		{0, 1},
+		{9, 10},
+		{10, 1},
+		{-1, 10},
+		{-10, 1},
+		{-11, 10},
+		{-25, 6},
+	}
+	for _, c := range cases {
+		if got := sw.BucketCount(c.idx); got != c.want {
+			t.Errorf("BucketCount(%v) = %v, want %v", c.idx, got, c.want)
+		}
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	sw := newTestSlidingWindow()
+
+	// Ranges are zero before the first event
+	for i, b := range sw.Buckets() {
+		if !b.Start.IsZero() || !b.End.IsZero() || b.Count != 0 {
+			t.Errorf("bucket %v = %+v, want zero value", i, b)
+		}
+	}
+
+	sw.Allow()
+	infos := sw.Buckets()
+	if len(infos) != sw.bucketCount {
+		t.Fatalf("len(Buckets()) = %v, want %v", len(infos), sw.bucketCount)
+	}
+	if infos[0].Count != 1 {
+		t.Errorf("infos[0].Count = %v, want 1", infos[0].Count)
+	}
+	for i, b := range infos {
+		if b.End.Sub(b.Start) != sw.bucketSize {
+			t.Errorf("bucket %v spans %v, want %v", i, b.End.Sub(b.Start), sw.bucketSize)
+		}
+		// Ring order wraps: bucket 1 is the oldest, bucket 0 the newest
+		if i > 1 && !b.Start.Equal(infos[i-1].End) {
+			t.Errorf("bucket %v does not start where bucket %v ends", i, i-1)
+		}
+	}
+	if !infos[9].End.Equal(infos[0].Start) {
+		t.Error("bucket 0 does not start where bucket 9 ends")
+	}
+
+	// The snapshot is a copy
+	infos[0].Count = 100
+	if sw.BucketCount(0) != 1 {
+		t.Error("modifying the snapshot changed the window")
+	}
+}
+
+func TestBucketsConcurrent(t *testing.T) {
+	sw := newTestSlidingWindow()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var allowed int64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if sw.Allow() {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+
+	// Each snapshot must be internally consistent and never shrink
+	last := 0
+	for i := 0; i < 1000; i++ {
+		total := 0
+		for _, b := range sw.Buckets() {
+			total += b.Count
+		}
+		if total < last {
+			t.Fatalf("snapshot total went from %v to %v", last, total)
+		}
+		last = total
+	}
+	close(stop)
+	wg.Wait()
+
+	if int64(last) > atomic.LoadInt64(&allowed) {
+		t.Errorf("snapshot total %v exceeds allowed %v", last, allowed)
+	}
+}
+
+func TestExpireBefore(t *testing.T) {
+	sw := newTestSlidingWindow()
+
+	// Window started 5.5s ago, one event counted in each second so far
+	now := time.Now()
+	sw.startTime = now.Add(-5500 * time.Millisecond)
+	sw.ring.head = 5
+	for i := 0; i <= 5; i++ {
+		sw.ring.values[i] = 1
+	}
+
+	// Buckets ending at or before now-2.5s are slots 0 to 2
+	sw.ExpireBefore(now.Add(-2500 * time.Millisecond))
+
+	for i := 0; i <= 5; i++ {
+		want := 1
+		if i <= 2 {
+			want = 0
+		}
+		if sw.ring.values[i] != want {
+			t.Errorf("sw.ring.values[%v] = %v, want %v", i, sw.ring.values[i], want)
+		}
+	}
+	if sw.Used() != 3 {
+		t.Errorf("sw.Used() = %v, want 3", sw.Used())
+	}
+
+	// A bucket partially inside [t, now] is kept
+	sw.ExpireBefore(now.Add(-2200 * time.Millisecond))
+	if sw.ring.values[3] != 1 {
+		t.Errorf("sw.ring.values[3] = %v, want 1", sw.ring.values[3])
+	}
+
+	// Expiring before a fresh window is a no-op
+	fresh := newTestSlidingWindow()
+	fresh.ExpireBefore(time.Now())
+}
+
+func TestExpireBeforeConcurrent(t *testing.T) {
+	sw := newTestSlidingWindow()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				sw.Allow()
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		sw.ExpireBefore(time.Now().Add(-time.Hour))
+	}
+	wg.Wait()
+
+	// Nothing was old enough to expire
+	if sw.Used() != 4000 {
+		t.Errorf("sw.Used() = %v, want 4000", sw.Used())
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	sw := newTestSlidingWindow()
+
+	sw.startTime = time.Now().Add(-12500 * time.Millisecond)
+	for i := range sw.ring.values {
+		sw.ring.values[i] = 1
+	}
+	sw.ring.head = 9
+
+	// Moving to slot 12 expires slots 10 to 12, which reuse ring 0 to 2
+	sw.advance(time.Now())
+	if sw.ring.head != 12 {
+		t.Fatalf("sw.ring.head = %v, want 12", sw.ring.head)
+	}
+	if sw.used() != 7 {
+		t.Errorf("sw.used() = %v, want 7", sw.used())
+	}
+
+	// Moving more than a lap clears everything
+	sw.advance(time.Now().Add(time.Minute))
+	if sw.used() != 0 {
+		t.Errorf("sw.used() = %v, want 0", sw.used())
+	}
+}
+
+func TestPerBucketLimit(t *testing.T) {
+	// Passes the window limit but violates the bucket limit
+	sw := newTestSlidingWindow()
+	sw.SetLimit(100)
+	sw.SetPerBucketLimit(5)
+
+	for i := 0; i < 5; i++ {
+		if d := sw.Decide(); !d.Allowed || d.Reason != ReasonAllowed {
+			t.Errorf("Decide() #%d = %+v, want allowed", i, d)
+		}
+	}
+	d := sw.Decide()
+	if d.Allowed || d.Reason != ReasonBucketLimit {
+		t.Errorf("Decide() = %+v, want rejected by bucket limit", d)
+	}
+	if d.Used != 5 || d.BucketUsed != 5 {
+		t.Errorf("Decide() = %+v, want Used 5 and BucketUsed 5", d)
+	}
+
+	// Spread over buckets: every bucket is within its limit but the
+	// window total is exceeded
+	sw = newTestSlidingWindow()
+	sw.SetLimit(10)
+	sw.SetPerBucketLimit(5)
+	sw.startTime = time.Now().Add(-2500 * time.Millisecond)
+	sw.ring.head = 2
+	sw.ring.values[0] = 4
+	sw.ring.values[1] = 4
+	sw.ring.values[2] = 1
+
+	if d := sw.Decide(); !d.Allowed {
+		t.Errorf("Decide() = %+v, want allowed", d)
+	}
+	d = sw.Decide()
+	if d.Allowed || d.Reason != ReasonWindowLimit {
+		t.Errorf("Decide() = %+v, want rejected by window limit", d)
+	}
+	if d.BucketUsed != 2 {
+		t.Errorf("d.BucketUsed = %v, want 2", d.BucketUsed)
+	}
+
+	// Disabling the bucket limit lifts the burst cap
+	sw = newTestSlidingWindow()
+	sw.SetPerBucketLimit(1)
+	sw.Allow()
+	sw.SetPerBucketLimit(0)
+	if !sw.Allow() {
+		t.Error("Allow() without bucket limit should have returned true")
+	}
+	if sw.PerBucketLimit() != 0 {
+		t.Errorf("sw.PerBucketLimit() = %v, want 0", sw.PerBucketLimit())
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	if ReasonBucketLimit.String() != "bucket limit" {
+		t.Errorf("ReasonBucketLimit.String() = %q", ReasonBucketLimit.String())
+	}
+	if Reason(42).String() != "Reason(42)" {
+		t.Errorf("Reason(42).String() = %q", Reason(42).String())
+	}
+}
+
+// fakeClock is a Clock whose time is set by the test. Its readings carry
+// no monotonic component, like wall clock times after a step.
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 10, 1, 59, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestHalfOpenBuckets(t *testing.T) {
+	clock := newFakeClock()
+	sw, _ := New(10*time.Second, time.Second, 10, WithClock(clock))
+	start := clock.Now()
+
+	// One event at the start and one exactly on the next boundary
+	sw.Allow()
+	clock.Add(time.Second)
+	sw.Allow()
+
+	infos := sw.Buckets()
+	if infos[0].Count != 1 || infos[1].Count != 1 {
+		t.Fatalf("bucket counts = %v, %v, want 1, 1", infos[0].Count, infos[1].Count)
+	}
+	if !infos[1].Start.Equal(start.Add(time.Second)) {
+		t.Errorf("infos[1].Start = %v, want %v", infos[1].Start, start.Add(time.Second))
+	}
+
+	// Expiring everything before the boundary keeps the boundary event
+	sw.ExpireBefore(start.Add(time.Second))
+	if sw.Used() != 1 {
+		t.Errorf("sw.Used() = %v, want 1", sw.Used())
+	}
+
+	// Exactly one window after the boundary event, it slides out
+	clock.Add(10 * time.Second)
+	if sw.Used() != 0 {
+		t.Errorf("sw.Used() = %v, want 0", sw.Used())
+	}
+}
+
+func TestClockStepForward(t *testing.T) {
+	clock := newFakeClock()
+	sw, _ := New(10*time.Second, time.Second, 10, WithClock(clock))
+	sw.SetLimit(5)
+
+	for i := 0; i < 5; i++ {
+		sw.Allow()
+	}
+	if sw.Allow() {
+		t.Error("Allow() over limit should have returned false")
+	}
+
+	// A large forward step expires the whole window
+	clock.Add(time.Hour)
+	if !sw.Allow() {
+		t.Error("Allow() after forward step should have returned true")
+	}
+	if sw.Used() != 1 {
+		t.Errorf("sw.Used() = %v, want 1", sw.Used())
+	}
+}
+
+func TestClockStepBackward(t *testing.T) {
+	clock := newFakeClock()
+	sw, _ := New(10*time.Second, time.Second, 10, WithClock(clock))
+
+	clock.Add(2500 * time.Millisecond)
+	sw.Allow()
+	sw.Allow()
+	head := sw.ring.head
+
+	// A large backward step neither panics nor loses counts
+	clock.Add(-time.Hour)
+	if !sw.Allow() {
+		t.Error("Allow() after backward step should have returned true")
+	}
+	if sw.Used() != 3 {
+		t.Errorf("sw.Used() = %v, want 3", sw.Used())
+	}
+	if sw.ring.head != head {
+		t.Errorf("sw.ring.head = %v, want %v", sw.ring.head, head)
+	}
+
+	// Time moves on normally from the stepped clock
+	clock.Add(time.Second)
+	sw.Allow()
+	if sw.ring.head != head+1 {
+		t.Errorf("sw.ring.head = %v, want %v", sw.ring.head, head+1)
+	}
+	for i, b := range sw.Buckets() {
+		if b.Count < 0 {
+			t.Errorf("bucket %v has negative count %v", i, b.Count)
+		}
+	}
+
+	// The counts slide out one window later
+	clock.Add(9 * time.Second)
+	if sw.Used() != 1 {
+		t.Errorf("sw.Used() = %v, want 1", sw.Used())
+	}
+}
+
+func TestGetBucketIndexNegative(t *testing.T) {
+	sw := newTestSlidingWindow()
+	sw.startTime = time.Now()
+
+	if idx := sw.getBucketIndex(sw.startTime.Add(-500 * time.Millisecond)); idx != -1 {
+		t.Errorf("getBucketIndex(-0.5s) = %v, want -1", idx)
+	}
+	if idx := sw.getBucketIndex(sw.startTime.Add(-time.Second)); idx != -1 {
+		t.Errorf("getBucketIndex(-1s) = %v, want -1", idx)
+	}
+	if idx := sw.getBucketIndex(sw.startTime.Add(time.Second)); idx != 1 {
+		t.Errorf("getBucketIndex(1s) = %v, want 1", idx)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Limiter {
+		sw, _ := New(time.Second, 100*time.Millisecond, 10)
+		sw.SetLimit(5)
+		return sw
+	})
+}
+
+func TestAllowN(t *testing.T) {
+	sw := newTestSlidingWindow()
+	sw.SetLimit(10)
+	sw.SetPerBucketLimit(6)
+
+	if !sw.AllowN(6) {
+		t.Error("AllowN(6) should have returned true")
+	}
+
+	// All or nothing: the bucket has no room for two more
+	if sw.AllowN(2) {
+		t.Error("AllowN(2) should have returned false")
+	}
+	if sw.Used() != 6 {
+		t.Errorf("sw.Used() = %v, want 6", sw.Used())
+	}
+	if !sw.AllowN(0) {
+		t.Error("AllowN(0) should have returned true")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	clock := newFakeClock()
+	sw, _ := New(10*time.Second, time.Second, 10, WithClock(clock))
+	sw.SetLimit(3)
+
+	if sw.RetryAfter() != 0 || sw.Remaining() != 3 {
+		t.Errorf("fresh window: RetryAfter() = %v, Remaining() = %v", sw.RetryAfter(), sw.Remaining())
+	}
+
+	// Two events in slot 0, one in slot 2
+	sw.Allow()
+	sw.Allow()
+	clock.Add(2500 * time.Millisecond)
+	sw.Allow()
+
+	// Slot 0 slides out at 10s
+	if d := sw.RetryAfter(); d != 7500*time.Millisecond {
+		t.Errorf("RetryAfter() = %v, want 7.5s", d)
+	}
+	if sw.Remaining() != 0 {
+		t.Errorf("Remaining() = %v, want 0", sw.Remaining())
+	}
+
+	clock.Add(7500 * time.Millisecond)
+	if sw.RetryAfter() != 0 || sw.Remaining() != 2 {
+		t.Errorf("after slide: RetryAfter() = %v, Remaining() = %v", sw.RetryAfter(), sw.Remaining())
+	}
+
+	// The bucket limit waits for the next bucket
+	sw.SetPerBucketLimit(1)
+	sw.Allow()
+	if d := sw.RetryAfter(); d != time.Second {
+		t.Errorf("RetryAfter() = %v, want 1s", d)
+	}
+}
+
+func TestRefundN(t *testing.T) {
+	clock := newFakeClock()
+	sw, _ := New(10*time.Second, time.Second, 10, WithClock(clock))
+	sw.SetLimit(5)
+
+	sw.AllowN(2)
+	clock.Add(time.Second)
+	sw.AllowN(3)
+
+	// Newest bucket first, then older ones
+	sw.RefundN(4)
+	if got := sw.BucketCount(0); got != 1 {
+		t.Errorf("older bucket = %d, want 1", got)
+	}
+	if got := sw.Used(); got != 1 {
+		t.Errorf("Used() = %d, want 1", got)
+	}
+
+	// Never below zero
+	sw.RefundN(10)
+	if got := sw.Used(); got != 0 {
+		t.Errorf("Used() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,192 @@
+// Package readiness waits for the dependencies of a service, such as its
+// connection pools and downstream services, to be reachable before it
+// starts working.
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	"github.com/Alan-333333/go-channel-patterns/patterns/group"
+	dbpool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/db"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+)
+
+// DefaultBackoff spaces the attempts of the checks without a Backoff.
+var DefaultBackoff = backoff.Backoff{
+	Initial:    100 * time.Millisecond,
+	Max:        5 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Check is a named probe of a dependency.
+type Check struct {
+
+	// Name identifies the dependency in errors.
+	Name string
+
+	// Probe returns nil once the dependency is ready. It must return soon
+	// after ctx is done.
+	Probe func(ctx context.Context) error
+
+	// Backoff spaces the attempts of Probe. DefaultBackoff is used if
+	// nil.
+	Backoff *backoff.Backoff
+}
+
+// Failure is a check that was still failing when WaitReady gave up.
+type Failure struct {
+
+	// Name is the name of the check.
+	Name string
+
+	// Attempts counts the probes that returned.
+	Attempts int
+
+	// Err is the error of the last probe, or nil if none returned.
+	Err error
+}
+
+// NotReadyError is returned by WaitReady when ctx is done before every
+// check succeeded.
+type NotReadyError struct {
+
+	// Failing lists the checks that did not succeed, in the order they
+	// were given.
+	Failing []Failure
+
+	// Err is the cause of ctx.
+	Err error
+}
+
+func (e *NotReadyError) Error() string {
+	parts := make([]string, len(e.Failing))
+	for i, f := range e.Failing {
+		if f.Err == nil {
+			parts[i] = fmt.Sprintf("%s: no attempt finished", f.Name)
+		} else {
+			parts[i] = fmt.Sprintf("%s: %d attempts, last: %v", f.Name, f.Attempts, f.Err)
+		}
+	}
+	return fmt.Sprintf("not ready: %v: %s", e.Err, strings.Join(parts, "; "))
+}
+
+// Unwrap returns the cause of ctx.
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// WaitReady runs the checks concurrently, each trying again after its
+// backoff until it succeeds, and returns nil once all of them did. If
+// ctx is done first, it returns a *NotReadyError naming the checks still
+// failing.
+func WaitReady(ctx context.Context, checks ...Check) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	failures := make([]Failure, len(checks))
+	ready := make([]bool, len(checks))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		failures[i].Name = c.Name
+
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+
+			b := DefaultBackoff
+			if c.Backoff != nil {
+				b = *c.Backoff
+			}
+
+			for {
+				err := c.Probe(ctx)
+
+				mu.Lock()
+				if err == nil {
+					ready[i] = true
+				} else if ctx.Err() == nil {
+					// Errors caused by giving up are not the dependency's
+					failures[i].Attempts++
+					failures[i].Err = err
+				}
+				mu.Unlock()
+
+				if err == nil || b.Wait(ctx) != nil {
+					return
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	var failing []Failure
+	for i := range checks {
+		if !ready[i] {
+			failing = append(failing, failures[i])
+		}
+	}
+	if len(failing) == 0 {
+		return nil
+	}
+	return &NotReadyError{Failing: failing, Err: context.Cause(ctx)}
+}
+
+// Gate returns a Runner waiting for the checks to be ready before calling
+// r.Run, such as a consumer run by a group.Group. Its Run returns the
+// error of WaitReady without calling r.Run if they are not.
+func Gate(r group.Runner, checks ...Check) group.Runner {
+	return &gated{r: r, checks: checks}
+}
+
+type gated struct {
+	r      group.Runner
+	checks []Check
+}
+
+func (g *gated) Run(ctx context.Context) error {
+	if err := WaitReady(ctx, g.checks...); err != nil {
+		return err
+	}
+	return g.r.Run(ctx)
+}
+
+// DBPool checks that p can dial a connection, or has one, and ping the
+// database with it.
+func DBPool(name string, p *dbpool.ConnectionPool) Check {
+	return Check{Name: name, Probe: func(ctx context.Context) error {
+		return p.WithConn(ctx, func(conn *dbpool.DBConn) error {
+			return conn.DB.PingContext(ctx)
+		})
+	}}
+}
+
+// RedisPool checks that p can dial a connection, or has one, and PING the
+// server with it.
+func RedisPool(name string, p *redispool.RedisConnectionPool) Check {
+	return Check{Name: name, Probe: func(ctx context.Context) error {
+		return p.Do(ctx, func(conn *redispool.RedisConn) error {
+			return conn.Conn.Ping().Err()
+		})
+	}}
+}
+
+// TCP checks that a TCP connection to addr can be opened.
+func TCP(name, addr string) Check {
+	return Check{Name: name, Probe: func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}}
+}
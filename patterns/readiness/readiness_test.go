@@ -0,0 +1,147 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+)
+
+var fast = &backoff.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2}
+
+// flaky returns a check failing until its nth attempt, counting the
+// attempts in calls. A non-positive n never succeeds.
+func flaky(name string, n int32, calls *atomic.Int32) Check {
+	return Check{Name: name, Backoff: fast, Probe: func(ctx context.Context) error {
+		if i := calls.Add(1); n <= 0 || i < n {
+			return fmt.Errorf("%s refused, attempt %d", name, i)
+		}
+		return nil
+	}}
+}
+
+func TestWaitReady(t *testing.T) {
+	var db, cache atomic.Int32
+
+	// every check is tried again until it succeeds
+	err := WaitReady(context.Background(), flaky("db", 3, &db), flaky("cache", 5, &cache))
+	if err != nil {
+		t.Fatalf("WaitReady() = %v, want nil", err)
+	}
+	if db.Load() != 3 || cache.Load() != 5 {
+		t.Errorf("attempts db %d, cache %d, want 3 and 5", db.Load(), cache.Load())
+	}
+
+	// no checks are ready at once
+	if err := WaitReady(context.Background()); err != nil {
+		t.Errorf("WaitReady() = %v, want nil", err)
+	}
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	var db, cache, queue atomic.Int32
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the error names the checks still failing, with their last error
+	err := WaitReady(ctx, flaky("db", 0, &db), flaky("cache", 2, &cache), flaky("queue", 0, &queue))
+	var nr *NotReadyError
+	if !errors.As(err, &nr) {
+		t.Fatalf("WaitReady() = %v, want a *NotReadyError", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitReady() = %v, want it to wrap %v", err, context.DeadlineExceeded)
+	}
+	if len(nr.Failing) != 2 || nr.Failing[0].Name != "db" || nr.Failing[1].Name != "queue" {
+		t.Fatalf("failing %+v, want db and queue", nr.Failing)
+	}
+	for _, f := range nr.Failing {
+		if f.Attempts < 2 {
+			t.Errorf("%s made %d attempts, want several", f.Name, f.Attempts)
+		}
+		want := fmt.Sprintf("%s refused, attempt %d", f.Name, f.Attempts)
+		if f.Err == nil || f.Err.Error() != want {
+			t.Errorf("%s last error %v, want %q", f.Name, f.Err, want)
+		}
+	}
+	if msg := err.Error(); !strings.Contains(msg, "db:") || strings.Contains(msg, "cache") {
+		t.Errorf("Error() = %q, want db and not cache", msg)
+	}
+}
+
+func TestWaitReadyHangingProbe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// a probe that never returns before ctx is done has no attempt
+	err := WaitReady(ctx, Check{Name: "slow", Probe: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	var nr *NotReadyError
+	if !errors.As(err, &nr) || len(nr.Failing) != 1 || nr.Failing[0].Attempts != 0 || nr.Failing[0].Err != nil {
+		t.Fatalf("WaitReady() = %v, want slow failing without attempts", err)
+	}
+	if !strings.Contains(err.Error(), "slow: no attempt finished") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+
+	if err := TCP("up", addr).Probe(context.Background()); err != nil {
+		t.Errorf("Probe() = %v, want nil", err)
+	}
+
+	// a closed port is not ready
+	l.Close()
+	if err := TCP("down", addr).Probe(context.Background()); err == nil {
+		t.Error("Probe() should fail once nothing listens")
+	}
+}
+
+// runner records whether it ran.
+type runner struct {
+	ran atomic.Bool
+}
+
+func (r *runner) Run(context.Context) error {
+	r.ran.Store(true)
+	return nil
+}
+
+func TestGate(t *testing.T) {
+	var calls atomic.Int32
+	r := &runner{}
+
+	// Run waits for the checks, then runs the runner
+	if err := Gate(r, flaky("db", 3, &calls)).Run(context.Background()); err != nil {
+		t.Fatalf("Run() = %v, want nil", err)
+	}
+	if !r.ran.Load() || calls.Load() != 3 {
+		t.Errorf("ran %v after %d attempts, want after 3", r.ran.Load(), calls.Load())
+	}
+
+	// the runner does not run if the checks never succeed
+	r = &runner{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var nr *NotReadyError
+	if err := Gate(r, flaky("db", 0, &calls)).Run(ctx); !errors.As(err, &nr) {
+		t.Errorf("Run() = %v, want a *NotReadyError", err)
+	}
+	if r.ran.Load() {
+		t.Error("the runner should not run before the checks are ready")
+	}
+}
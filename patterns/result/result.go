@@ -0,0 +1,126 @@
+// Package result carries a value and its error together through a
+// channel, so producers of fallible values need neither a second error
+// channel nor a callback.
+package result
+
+import "context"
+
+// Result is a value or the error that prevented it.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Of returns the Result of a call returning v and err.
+func Of[T any](v T, err error) Result[T] {
+	return Result[T]{Value: v, Err: err}
+}
+
+// Wrap calls fn and returns its outcome as a Result.
+func Wrap[T any](fn func() (T, error)) Result[T] {
+	return Of(fn())
+}
+
+// Unwrap returns the value and the error.
+func (r Result[T]) Unwrap() (T, error) {
+	return r.Value, r.Err
+}
+
+// Split separates the results of in into values and errors. Each channel
+// is closed once in is closed and its items were delivered, or once ctx is
+// done.
+//
+// Values are handed over one at a time, so a slow reader of values slows
+// down in. Errors are queued until read, so ranging over values first and
+// errors afterwards does not block. The goroutine exits once both
+// channels were drained, or ctx is done.
+func Split[T any](ctx context.Context, in <-chan Result[T]) (<-chan T, <-chan error) {
+	values := make(chan T)
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+
+		var (
+			src      = in
+			value    T
+			hasValue bool
+			pending  []error
+		)
+		valuesOpen := true
+		defer func() {
+			if valuesOpen {
+				close(values)
+			}
+		}()
+
+		for src != nil || hasValue || len(pending) > 0 {
+			// Offer only what is pending, and read in only while no
+			// value is
+			var (
+				read      = src
+				valuesOut chan T
+				errsOut   chan error
+				err       error
+			)
+			if hasValue {
+				read = nil
+				valuesOut = values
+			}
+			if len(pending) > 0 {
+				errsOut = errs
+				err = pending[0]
+			}
+
+			select {
+			case r, ok := <-read:
+				switch {
+				case !ok:
+					src = nil
+				case r.Err != nil:
+					pending = append(pending, r.Err)
+				default:
+					value, hasValue = r.Value, true
+				}
+			case valuesOut <- value:
+				var zero T
+				value, hasValue = zero, false
+			case errsOut <- err:
+				pending = pending[1:]
+			case <-ctx.Done():
+				return
+			}
+
+			// Close values as soon as no more will come, so readers
+			// ranging over it can move on to errs
+			if valuesOpen && src == nil && !hasValue {
+				close(values)
+				valuesOpen = false
+			}
+		}
+	}()
+
+	return values, errs
+}
+
+// CollectAll reads in until it is closed and returns the values. It
+// returns at the first error, or with ctx.Err() if ctx is done first,
+// together with the values read so far. The producer of in is then left
+// blocked unless it watches a context the caller cancels.
+func CollectAll[T any](ctx context.Context, in <-chan Result[T]) ([]T, error) {
+	var values []T
+	for {
+		select {
+		case r, ok := <-in:
+			if !ok {
+				return values, nil
+			}
+			if r.Err != nil {
+				return values, r.Err
+			}
+			values = append(values, r.Value)
+		case <-ctx.Done():
+			return values, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package result
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+var errBoom = errors.New("boom")
+
+// source sends results to a new channel and closes it.
+func source(results ...Result[int]) <-chan Result[int] {
+	ch := make(chan Result[int])
+	go func() {
+		defer close(ch)
+		for _, r := range results {
+			ch <- r
+		}
+	}()
+	return ch
+}
+
+// mixed returns 1, 2 and 3 with an error after each value.
+func mixed() []Result[int] {
+	return []Result[int]{
+		{Value: 1}, {Err: errBoom},
+		{Value: 2}, {Err: errBoom},
+		{Value: 3}, {Err: errBoom},
+	}
+}
+
+func TestWrap(t *testing.T) {
+	r := Wrap(func() (int, error) { return strconv.Atoi("42") })
+	if v, err := r.Unwrap(); v != 42 || err != nil {
+		t.Errorf("Unwrap() = %d, %v, want 42, nil", v, err)
+	}
+
+	r = Wrap(func() (int, error) { return strconv.Atoi("x") })
+	if r.Err == nil {
+		t.Error("Wrap() should carry the error")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	values, errs := Split(context.Background(), source(mixed()...))
+
+	// Values first, then errors: queued errors do not block the values
+	var got []int
+	for v := range values {
+		got = append(got, v)
+	}
+	n := 0
+	for range errs {
+		n++
+	}
+
+	if len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("values = %v, want [1 2 3]", got)
+	}
+	if n != 3 {
+		t.Errorf("got %d errors, want 3", n)
+	}
+}
+
+func TestSplitInterleaved(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	values, errs := Split(context.Background(), source(mixed()...))
+
+	nv, ne := 0, 0
+	for values != nil || errs != nil {
+		select {
+		case _, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			nv++
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			ne++
+		}
+	}
+	if nv != 3 || ne != 3 {
+		t.Errorf("got %d values and %d errors, want 3 and 3", nv, ne)
+	}
+}
+
+func TestSplitOnlyValuesDrained(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// Without errors, draining values is enough for Split to finish
+	values, errs := Split(context.Background(), source(Result[int]{Value: 1}, Result[int]{Value: 2}))
+	for range values {
+	}
+	select {
+	case _, ok := <-errs:
+		if ok {
+			t.Error("errs should be closed without a value")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("errs not closed after values were drained")
+	}
+
+	// With errors nobody reads, cancelling ctx lets Split exit
+	ctx, cancel := context.WithCancel(context.Background())
+	values, _ = Split(ctx, source(mixed()...))
+	for range values {
+	}
+	cancel()
+}
+
+func TestSplitOnlyErrorsDrained(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	in := make(chan Result[int])
+	ctx, cancel := context.WithCancel(context.Background())
+	_, errs := Split(ctx, in)
+
+	// Split holds a value nobody reads, yet still forwards errors
+	go func() {
+		in <- Result[int]{Value: 1}
+		in <- Result[int]{Err: errBoom}
+	}()
+
+	select {
+	case err := <-errs:
+		t.Errorf("got error %v while a value was pending, want in to wait", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	for range errs {
+	}
+
+	// The sender is still blocked on the error; unblock it
+	<-in
+}
+
+func TestSplitCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	values, errs := Split(ctx, make(chan Result[int]))
+	cancel()
+
+	for range values {
+	}
+	for range errs {
+	}
+}
+
+func TestCollectAll(t *testing.T) {
+	got, err := CollectAll(context.Background(), source(Result[int]{Value: 1}, Result[int]{Value: 2}))
+	if err != nil || len(got) != 2 {
+		t.Errorf("CollectAll() = %v, %v, want [1 2], nil", got, err)
+	}
+}
+
+func TestCollectAllFirstError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan Result[int])
+	go func() {
+		defer close(in)
+		for _, r := range mixed() {
+			select {
+			case in <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	got, err := CollectAll(ctx, in)
+	if !errors.Is(err, errBoom) || len(got) != 1 || got[0] != 1 {
+		t.Errorf("CollectAll() = %v, %v, want [1], %v", got, err, errBoom)
+	}
+}
+
+func TestCollectAllCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := CollectAll(ctx, make(chan Result[int])); !errors.Is(err, context.Canceled) {
+		t.Errorf("CollectAll() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,140 @@
+// Package retry runs operations with exponential backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+)
+
+// Policy describes how an operation is retried.
+type Policy struct {
+
+	// MaxAttempts is the total number of calls, including the first one.
+	// Values below 1 mean a single call.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries. Zero means no cap.
+	MaxBackoff time.Duration
+
+	// Multiplier grows the delay after each retry. Values below 1 keep the
+	// delay constant.
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction in either
+	// direction, so 0.2 gives delays between 80% and 120% of the backoff.
+	Jitter float64
+
+	// Retryable reports whether an error should be retried. If nil, every
+	// error except a Permanent one is retried.
+	Retryable func(error) bool
+
+	// OnRetry is called before each retry with the attempt that failed,
+	// starting at 1, its error and the delay before the next attempt.
+	OnRetry func(attempt int, err error, delay time.Duration)
+
+	// Sleep waits for d or until ctx is done. If nil, backoff.Sleep is
+	// used.
+	// Tests can replace it to run without real delays.
+	Sleep func(ctx context.Context, d time.Duration) error
+
+	// Rand returns a random number in [0, 1) for the jitter. If nil,
+	// math/rand is used.
+	Rand func() float64
+}
+
+// DefaultPolicy returns a policy making 3 attempts, with delays starting
+// at 100ms and doubling up to 10s, randomized by 20%.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// permanentError marks an error that must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retryable. Do stops at once and returns err
+// itself, without the mark.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Do calls fn until it succeeds, returns a permanent or non-retryable
+// error, or the policy runs out of attempts, and returns the last error.
+// If ctx is done while waiting between attempts, Do returns the context
+// error.
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	b := policy.backoff()
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		// Stop on permanent errors, returning the original error
+		var p *permanentError
+		if errors.As(err, &p) {
+			return p.err
+		}
+
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		delay := b.Next()
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+		if err := policy.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the delays between attempts.
+func (p Policy) backoff() backoff.Backoff {
+	return backoff.Backoff{
+		Initial:    p.InitialBackoff,
+		Max:        p.MaxBackoff,
+		Multiplier: p.Multiplier,
+		Jitter:     p.Jitter,
+		Rand:       p.Rand,
+	}
+}
+
+// sleep waits for d using the policy's sleeper.
+func (p Policy) sleep(ctx context.Context, d time.Duration) error {
+	if p.Sleep != nil {
+		return p.Sleep(ctx, d)
+	}
+	return backoff.Sleep(ctx, d)
+}
@@ -0,0 +1,211 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recorder is an injected sleeper recording the requested delays.
+type recorder struct {
+	delays []time.Duration
+}
+
+func (r *recorder) sleep(ctx context.Context, d time.Duration) error {
+	r.delays = append(r.delays, d)
+	return ctx.Err()
+}
+
+func equalDelays(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var errTemp = errors.New("temporary")
+
+func TestDoSuccess(t *testing.T) {
+	rec := &recorder{}
+	p := Policy{MaxAttempts: 5, InitialBackoff: time.Second, Sleep: rec.sleep}
+
+	calls := 0
+	err := Do(context.Background(), p, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTemp
+		}
+		return nil
+	})
+
+	if err != nil || calls != 3 {
+		t.Errorf("Do() = %v after %d calls, want nil after 3", err, calls)
+	}
+	if len(rec.delays) != 2 {
+		t.Errorf("slept %d times, want 2", len(rec.delays))
+	}
+}
+
+func TestDoBackoff(t *testing.T) {
+	rec := &recorder{}
+	p := Policy{
+		MaxAttempts:    6,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     3,
+		Sleep:          rec.sleep,
+	}
+
+	err := Do(context.Background(), p, func(context.Context) error { return errTemp })
+	if !errors.Is(err, errTemp) {
+		t.Errorf("Do() = %v, want %v", err, errTemp)
+	}
+
+	// Grows by the multiplier, capped at MaxBackoff
+	want := []time.Duration{
+		100 * time.Millisecond,
+		300 * time.Millisecond,
+		900 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	if !equalDelays(rec.delays, want) {
+		t.Errorf("delays = %v, want %v", rec.delays, want)
+	}
+}
+
+func TestDoJitter(t *testing.T) {
+	rec := &recorder{}
+	rands := []float64{0, 0.5, 0.999999}
+	p := Policy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Second,
+		Jitter:         0.2,
+		Sleep:          rec.sleep,
+		Rand: func() float64 {
+			r := rands[0]
+			rands = rands[1:]
+			return r
+		},
+	}
+
+	Do(context.Background(), p, func(context.Context) error { return errTemp })
+
+	if rec.delays[0] != 800*time.Millisecond || rec.delays[1] != time.Second {
+		t.Errorf("delays = %v, want 800ms, 1s, ~1.2s", rec.delays)
+	}
+	if d := rec.delays[2]; d <= 1199*time.Millisecond || d > 1200*time.Millisecond {
+		t.Errorf("delays = %v, want 800ms, 1s, ~1.2s", rec.delays)
+	}
+}
+
+func TestDoPermanent(t *testing.T) {
+	rec := &recorder{}
+	p := Policy{MaxAttempts: 5, Sleep: rec.sleep}
+
+	errFatal := errors.New("fatal")
+	calls := 0
+	err := Do(context.Background(), p, func(context.Context) error {
+		calls++
+		return Permanent(errFatal)
+	})
+
+	// The original error is returned, without the mark
+	if err != errFatal || calls != 1 {
+		t.Errorf("Do() = %v after %d calls, want %v after 1", err, calls, errFatal)
+	}
+	if IsPermanent(err) {
+		t.Error("returned error should not be marked permanent")
+	}
+	if !IsPermanent(Permanent(errFatal)) || Permanent(nil) != nil {
+		t.Error("Permanent should mark non-nil errors only")
+	}
+}
+
+func TestDoRetryable(t *testing.T) {
+	rec := &recorder{}
+	errOther := errors.New("other")
+	p := Policy{
+		MaxAttempts: 5,
+		Sleep:       rec.sleep,
+		Retryable:   func(err error) bool { return errors.Is(err, errTemp) },
+	}
+
+	calls := 0
+	err := Do(context.Background(), p, func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return errTemp
+		}
+		return errOther
+	})
+
+	if err != errOther || calls != 2 {
+		t.Errorf("Do() = %v after %d calls, want %v after 2", err, calls, errOther)
+	}
+}
+
+func TestDoOnRetry(t *testing.T) {
+	type retry struct {
+		attempt int
+		delay   time.Duration
+	}
+	var got []retry
+
+	p := Policy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		Multiplier:     2,
+		Sleep:          (&recorder{}).sleep,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			if err != errTemp {
+				t.Errorf("OnRetry err = %v", err)
+			}
+			got = append(got, retry{attempt, delay})
+		},
+	}
+
+	Do(context.Background(), p, func(context.Context) error { return errTemp })
+
+	if len(got) != 2 || got[0] != (retry{1, time.Second}) || got[1] != (retry{2, 2 * time.Second}) {
+		t.Errorf("OnRetry calls = %v", got)
+	}
+}
+
+func TestDoCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 5, InitialBackoff: time.Hour}
+
+	// The real sleeper returns as soon as ctx is done
+	calls := 0
+	start := time.Now()
+	err := Do(ctx, p, func(context.Context) error {
+		calls++
+		cancel()
+		return errTemp
+	})
+
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Do() = %v after %d calls, want %v after 1", err, calls, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Do() should not wait out the backoff")
+	}
+}
+
+func TestDoSingleAttempt(t *testing.T) {
+	calls := 0
+	Do(context.Background(), Policy{}, func(context.Context) error {
+		calls++
+		return errTemp
+	})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
@@ -0,0 +1,98 @@
+// Package ringchan implements a bounded channel that evicts the oldest
+// item instead of blocking the writer when full.
+package ringchan
+
+import "sync/atomic"
+
+// RingChan buffers up to capacity items between In and Out. When the
+// buffer is full a new item evicts the oldest, so readers always see the
+// freshest window of data.
+type RingChan[T any] struct {
+	in  chan T
+	out chan T
+
+	// ring holds the buffered items, oldest at head.
+	ring  []T
+	head  int
+	count int
+
+	dropped atomic.Uint64
+}
+
+// New creates a RingChan buffering up to capacity items and starts its
+// goroutine. It panics if capacity is less than one. Close In to stop it.
+func New[T any](capacity int) *RingChan[T] {
+	if capacity < 1 {
+		panic("ringchan: capacity must be positive")
+	}
+
+	r := &RingChan[T]{
+		in:   make(chan T),
+		out:  make(chan T),
+		ring: make([]T, capacity),
+	}
+	go r.run()
+	return r
+}
+
+// In returns the channel to write to. Writes never wait on readers.
+// Close it to flush the buffered items to Out and then close Out.
+func (r *RingChan[T]) In() chan<- T {
+	return r.in
+}
+
+// Out returns the channel to read from.
+func (r *RingChan[T]) Out() <-chan T {
+	return r.out
+}
+
+// Dropped returns how many items were evicted to make room.
+func (r *RingChan[T]) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// run shuttles items from in, through the ring, to out.
+func (r *RingChan[T]) run() {
+	defer close(r.out)
+
+	in := r.in
+	for in != nil || r.count > 0 {
+		// Only offer an item when there is one
+		var out chan T
+		var next T
+		if r.count > 0 {
+			out = r.out
+			next = r.ring[r.head]
+		}
+
+		select {
+		case v, ok := <-in:
+			if !ok {
+				// Flush what is left
+				in = nil
+				continue
+			}
+			r.push(v)
+		case out <- next:
+			r.pop()
+		}
+	}
+}
+
+// push adds v, evicting the oldest item if the ring is full.
+func (r *RingChan[T]) push(v T) {
+	if r.count == len(r.ring) {
+		r.pop()
+		r.dropped.Add(1)
+	}
+	r.ring[(r.head+r.count)%len(r.ring)] = v
+	r.count++
+}
+
+// pop removes the oldest item.
+func (r *RingChan[T]) pop() {
+	var zero T
+	r.ring[r.head] = zero
+	r.head = (r.head + 1) % len(r.ring)
+	r.count--
+}
@@ -0,0 +1,92 @@
+package ringchan
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestOverload(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const capacity, total = 10, 1000
+
+	r := New[int](capacity)
+
+	// Nobody reads while writing
+	for i := 0; i < total; i++ {
+		r.In() <- i
+	}
+	close(r.In())
+
+	var got []int
+	for v := range r.Out() {
+		got = append(got, v)
+	}
+
+	if len(got) != capacity {
+		t.Fatalf("received %d items, want %d", len(got), capacity)
+	}
+	for i, v := range got {
+		if want := total - capacity + i; v != want {
+			t.Errorf("item %d = %d, want %d", i, v, want)
+		}
+	}
+	if d := r.Dropped(); d != total-capacity {
+		t.Errorf("Dropped() = %d, want %d", d, total-capacity)
+	}
+}
+
+func TestConcurrentReader(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	r := New[int](1)
+
+	done := make(chan []int)
+	go func() {
+		var got []int
+		for v := range r.Out() {
+			got = append(got, v)
+		}
+		done <- got
+	}()
+
+	for i := 0; i < 100; i++ {
+		r.In() <- i
+	}
+	close(r.In())
+
+	// Items come out in order, whatever was dropped
+	got := <-done
+	for i := 1; i < len(got); i++ {
+		if got[i] <= got[i-1] {
+			t.Fatalf("item %d after %d", got[i], got[i-1])
+		}
+	}
+	if len(got)+int(r.Dropped()) != 100 {
+		t.Errorf("received %d and dropped %d, want 100 in total", len(got), r.Dropped())
+	}
+	if got[len(got)-1] != 99 {
+		t.Errorf("last item = %d, want 99", got[len(got)-1])
+	}
+}
+
+func TestCloseEmpty(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	r := New[int](4)
+	close(r.In())
+
+	if _, ok := <-r.Out(); ok {
+		t.Error("Out should be closed")
+	}
+}
+
+func TestNewPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New(0) should panic")
+		}
+	}()
+	New[int](0)
+}
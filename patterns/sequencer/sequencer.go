@@ -0,0 +1,167 @@
+// Package sequencer restores the order of items processed in parallel,
+// using the sequence numbers they were given before being fanned out.
+package sequencer
+
+import (
+	"context"
+	"time"
+)
+
+// Indexed is an item with its sequence number. Numbers are assigned in
+// input order, one per item, starting at zero unless set with WithStart.
+type Indexed[T any] struct {
+	Seq   uint64
+	Value T
+}
+
+// Option configures Reorder.
+type Option func(*config)
+
+type config struct {
+	start      uint64
+	gapTimeout time.Duration
+	onGap      func(first, last uint64)
+}
+
+// WithStart sets the first sequence number. The default is zero.
+func WithStart(seq uint64) Option {
+	return func(c *config) {
+		c.start = seq
+	}
+}
+
+// WithGapTimeout gives up on a missing sequence number once later items
+// have waited for it for d: the missing numbers up to the next buffered
+// item are skipped and reported to onGap, which may be nil. By default
+// Reorder waits for the missing item for ever.
+func WithGapTimeout(d time.Duration, onGap func(first, last uint64)) Option {
+	return func(c *config) {
+		c.gapTimeout = d
+		c.onGap = onGap
+	}
+}
+
+// Reorder emits the values of in in sequence order. Items arriving early
+// are held in a buffer of at most window items; while it is full, in is
+// not read, so each item must arrive before window later ones did.
+//
+// A missing item stalls the output until it arrives, or is skipped after
+// the timeout set with WithGapTimeout. Items arriving after their number
+// was emitted or skipped are dropped. Once in is closed, missing numbers
+// can no longer arrive: the buffered items are emitted and the gaps
+// reported. The output is closed once in is closed and drained, or ctx is
+// done.
+func Reorder[T any](ctx context.Context, in <-chan Indexed[T], window int, opts ...Option) <-chan T {
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if window < 1 {
+		window = 1
+	}
+
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+
+		pending := make(map[uint64]T, window)
+		next := cfg.start
+
+		// timer runs while later items wait for waitingFor
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		var waitingFor uint64
+		stopTimer := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+		}
+		defer stopTimer()
+
+		// skip gives up on the numbers before the lowest buffered one
+		skip := func() {
+			lowest := next
+			first := true
+			for seq := range pending {
+				if first || seq < lowest {
+					lowest, first = seq, false
+				}
+			}
+			if cfg.onGap != nil && lowest > next {
+				cfg.onGap(next, lowest-1)
+			}
+			next = lowest
+		}
+
+		src := in
+		for {
+			// Emit what is in order
+			for {
+				v, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if !send(ctx, out, v) {
+					return
+				}
+				next++
+			}
+
+			if src == nil {
+				if len(pending) == 0 {
+					return
+				}
+				skip()
+				continue
+			}
+
+			// Time how long the buffered items wait for next
+			if timer != nil && (waitingFor != next || len(pending) == 0) {
+				stopTimer()
+			}
+			if cfg.gapTimeout > 0 && timer == nil && len(pending) > 0 {
+				timer = time.NewTimer(cfg.gapTimeout)
+				timeout = timer.C
+				waitingFor = next
+			}
+
+			read := src
+			if len(pending) >= window {
+				read = nil
+			}
+
+			select {
+			case iv, ok := <-read:
+				if !ok {
+					src = nil
+					stopTimer()
+					continue
+				}
+				if iv.Seq < next {
+					continue
+				}
+				pending[iv.Seq] = iv.Value
+			case <-timeout:
+				timer, timeout = nil, nil
+				skip()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// send writes v to out. It returns false if ctx is cancelled first.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+package sequencer
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// shuffled returns 0..n-1 shuffled so that no item arrives more than
+// window places early.
+func shuffled(rng *rand.Rand, n, window int) []uint64 {
+	seqs := make([]uint64, n)
+	for i := range seqs {
+		seqs[i] = uint64(i)
+	}
+
+	// Shuffle within blocks of window items, reversing some, which is the
+	// worst case for the buffer
+	for start := 0; start < n; start += window {
+		end := start + window
+		if end > n {
+			end = n
+		}
+		block := seqs[start:end]
+		if rng.Intn(2) == 0 {
+			for i, j := 0, len(block)-1; i < j; i, j = i+1, j-1 {
+				block[i], block[j] = block[j], block[i]
+			}
+			continue
+		}
+		rng.Shuffle(len(block), func(i, j int) { block[i], block[j] = block[j], block[i] })
+	}
+	return seqs
+}
+
+// feed sends an item per sequence number, valued by the number, and
+// counts the items sent.
+func feed(ctx context.Context, seqs []uint64, sent *atomic.Int64) <-chan Indexed[uint64] {
+	in := make(chan Indexed[uint64])
+	go func() {
+		defer close(in)
+		for _, seq := range seqs {
+			select {
+			case in <- Indexed[uint64]{Seq: seq, Value: seq}:
+				sent.Add(1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return in
+}
+
+func TestReorder(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	rng := rand.New(rand.NewSource(1))
+	for _, window := range []int{1, 2, 3, 8, 64} {
+		for round := 0; round < 20; round++ {
+			var sent atomic.Int64
+			out := Reorder(context.Background(), feed(context.Background(), shuffled(rng, 500, window), &sent), window)
+
+			var want uint64
+			for v := range out {
+				if v != want {
+					t.Fatalf("window %d: got %d, want %d", window, v, want)
+				}
+				want++
+
+				// Bounded memory: the items read but not emitted fit the
+				// window
+				if ahead := sent.Load() - int64(want); ahead > int64(window) {
+					t.Fatalf("window %d: %d items held, want at most %d", window, ahead, window)
+				}
+			}
+			if want != 500 {
+				t.Fatalf("window %d: got %d items, want 500", window, want)
+			}
+		}
+	}
+}
+
+func TestReorderStalls(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan Indexed[int])
+	out := Reorder(ctx, in, 3)
+
+	// 0 is missing: the output waits for it
+	in <- Indexed[int]{Seq: 1, Value: 1}
+	in <- Indexed[int]{Seq: 2, Value: 2}
+	select {
+	case v := <-out:
+		t.Fatalf("got %d while 0 is missing", v)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Once 0 arrives, everything flows
+	in <- Indexed[int]{Seq: 0, Value: 0}
+	for want := 0; want < 3; want++ {
+		if v := <-out; v != want {
+			t.Fatalf("got %d, want %d", v, want)
+		}
+	}
+
+	// 3 is missing and the buffer is full: in is no longer read
+	for seq := 4; seq < 7; seq++ {
+		in <- Indexed[int]{Seq: uint64(seq)}
+	}
+	select {
+	case in <- Indexed[int]{Seq: 7}:
+		t.Fatal("Reorder read past its window")
+	case v := <-out:
+		t.Fatalf("got %d while 3 is missing", v)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	for range out {
+	}
+}
+
+func TestReorderGapTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var mu sync.Mutex
+	var gaps [][2]uint64
+	onGap := func(first, last uint64) {
+		mu.Lock()
+		defer mu.Unlock()
+		gaps = append(gaps, [2]uint64{first, last})
+	}
+
+	in := make(chan Indexed[int])
+	out := Reorder(context.Background(), in, 4, WithGapTimeout(10*time.Millisecond, onGap))
+
+	go func() {
+		defer close(in)
+		// 0 and 1 are lost; 3 is late and dropped after 2 was skipped to
+		in <- Indexed[int]{Seq: 2, Value: 2}
+		in <- Indexed[int]{Seq: 4, Value: 4}
+		time.Sleep(30 * time.Millisecond)
+		in <- Indexed[int]{Seq: 1, Value: 1}
+		in <- Indexed[int]{Seq: 5, Value: 5}
+	}()
+
+	var got []int
+	for v := range out {
+		got = append(got, v)
+	}
+
+	want := []int{2, 4, 5}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(gaps) != 2 || gaps[0] != [2]uint64{0, 1} || gaps[1] != [2]uint64{3, 3} {
+		t.Errorf("gaps = %v, want [[0 1] [3 3]]", gaps)
+	}
+}
+
+func TestReorderClosedWithGaps(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var gaps [][2]uint64
+	in := make(chan Indexed[int], 3)
+	in <- Indexed[int]{Seq: 12, Value: 12}
+	in <- Indexed[int]{Seq: 10, Value: 10}
+	in <- Indexed[int]{Seq: 15, Value: 15}
+	close(in)
+
+	out := Reorder(context.Background(), in, 8, WithStart(10), WithGapTimeout(time.Hour, func(first, last uint64) {
+		gaps = append(gaps, [2]uint64{first, last})
+	}))
+
+	var got []int
+	for v := range out {
+		got = append(got, v)
+	}
+	if len(got) != 3 || got[0] != 10 || got[1] != 12 || got[2] != 15 {
+		t.Errorf("got %v, want [10 12 15]", got)
+	}
+	if len(gaps) != 2 || gaps[0] != [2]uint64{11, 11} || gaps[1] != [2]uint64{13, 14} {
+		t.Errorf("gaps = %v, want [[11 11] [13 14]]", gaps)
+	}
+}
+
+func TestReorderCancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan Indexed[int])
+	out := Reorder(ctx, in, 4, WithGapTimeout(time.Hour, nil))
+
+	in <- Indexed[int]{Seq: 1}
+	cancel()
+	for range out {
+	}
+}
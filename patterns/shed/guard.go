@@ -0,0 +1,183 @@
+// Package shed rejects work when the system is already saturated, judged
+// by probes such as queue depth and recent latency rather than request
+// counts. Each probe has a high and a low watermark, so decisions do not
+// flap around a single threshold.
+package shed
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reason tells why a Guard shed work.
+type Reason int
+
+const (
+	// ReasonNone means no probe is over its limit.
+	ReasonNone Reason = iota
+
+	// ReasonQueueFull means the queue depth reached its high watermark.
+	ReasonQueueFull
+
+	// ReasonLatencyHigh means the latency reached its high watermark.
+	ReasonLatencyHigh
+)
+
+// String returns the name of the reason.
+func (r Reason) String() string {
+	switch r {
+	case ReasonNone:
+		return "none"
+	case ReasonQueueFull:
+		return "queue full"
+	case ReasonLatencyHigh:
+		return "latency high"
+	default:
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+}
+
+// Stats counts a Guard's decisions.
+type Stats struct {
+	Allowed     uint64 // Calls admitted
+	QueueFull   uint64 // Calls shed because the queue was full
+	LatencyHigh uint64 // Calls shed because latency was high
+}
+
+// Option configures a Guard.
+type Option func(*Guard)
+
+// WithQueueDepth sheds work once depth returns high or more, until it
+// returns low or less. A buffered channel's length, such as a Consumer's
+// Buffer, makes a good probe.
+func WithQueueDepth(depth func() int, high, low int) Option {
+	return func(g *Guard) {
+		g.probes = append(g.probes, &probe{
+			reason: ReasonQueueFull,
+			value:  func() float64 { return float64(depth()) },
+			high:   float64(high),
+			low:    float64(low),
+		})
+	}
+}
+
+// WithLatency sheds work once latency returns high or more, until it
+// returns low or less. Latency.Estimate makes a good probe.
+func WithLatency(latency func() time.Duration, high, low time.Duration) Option {
+	return func(g *Guard) {
+		g.probes = append(g.probes, &probe{
+			reason: ReasonLatencyHigh,
+			value:  func() float64 { return float64(latency()) },
+			high:   float64(high),
+			low:    float64(low),
+		})
+	}
+}
+
+// WithTrickle admits one call every interval while shedding. Probes fed
+// by admitted work, such as a Latency observed by Middleware, need it to
+// see the system recover.
+func WithTrickle(interval time.Duration) Option {
+	return func(g *Guard) {
+		g.trickle = interval
+	}
+}
+
+// probe is a value with hysteresis: it trips at high and resets at low.
+type probe struct {
+	reason    Reason
+	value     func() float64
+	high, low float64
+	tripped   bool
+}
+
+// Guard decides whether to admit work by checking its probes.
+type Guard struct {
+	trickle time.Duration
+
+	// mu serializes probe updates and guards lastTrickle.
+	mu          sync.Mutex
+	probes      []*probe
+	lastTrickle time.Time
+
+	allowed     atomic.Uint64
+	queueFull   atomic.Uint64
+	latencyHigh atomic.Uint64
+}
+
+// New creates a Guard with the given probes. Probes are checked in the
+// order given; a low watermark above the high one is lowered to it.
+func New(opts ...Option) *Guard {
+	g := &Guard{}
+	for _, opt := range opts {
+		opt(g)
+	}
+	for _, p := range g.probes {
+		if p.low > p.high {
+			p.low = p.high
+		}
+	}
+	return g
+}
+
+// Allow reports whether to admit work now, and the reason of the first
+// probe over its limit, if any. Calls let through by WithTrickle are
+// admitted with the reason they would have been shed for.
+func (g *Guard) Allow() (bool, Reason) {
+	reason, trickle := g.check()
+	if reason == ReasonNone || trickle {
+		g.allowed.Add(1)
+		return true, reason
+	}
+
+	switch reason {
+	case ReasonQueueFull:
+		g.queueFull.Add(1)
+	case ReasonLatencyHigh:
+		g.latencyHigh.Add(1)
+	}
+	return false, reason
+}
+
+// Stats returns the decisions counted so far.
+func (g *Guard) Stats() Stats {
+	return Stats{
+		Allowed:     g.allowed.Load(),
+		QueueFull:   g.queueFull.Load(),
+		LatencyHigh: g.latencyHigh.Load(),
+	}
+}
+
+// check reads every probe and returns the first tripped one's reason,
+// and whether to let the call trickle through anyway. Every probe is
+// read, so each tracks its own watermarks.
+func (g *Guard) check() (Reason, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	reason := ReasonNone
+	for _, p := range g.probes {
+		v := p.value()
+		if p.tripped && v <= p.low {
+			p.tripped = false
+		} else if !p.tripped && v >= p.high {
+			p.tripped = true
+		}
+
+		if p.tripped && reason == ReasonNone {
+			reason = p.reason
+		}
+	}
+
+	if reason == ReasonNone || g.trickle <= 0 {
+		return reason, false
+	}
+	now := time.Now()
+	if now.Sub(g.lastTrickle) < g.trickle {
+		return reason, false
+	}
+	g.lastTrickle = now
+	return reason, true
+}
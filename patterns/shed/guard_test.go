@@ -0,0 +1,181 @@
+package shed
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueDepthHysteresis(t *testing.T) {
+	depth := 0
+	g := New(WithQueueDepth(func() int { return depth }, 80, 50))
+
+	steps := []struct {
+		depth int
+		allow bool
+	}{
+		{0, true},
+		{79, true},
+		{80, false}, // Trips at the high watermark
+		{70, false}, // Stays tripped between the watermarks
+		{51, false},
+		{50, true}, // Resets at the low watermark
+		{70, true}, // Stays reset between the watermarks
+		{79, true},
+		{100, false},
+		{10, true},
+	}
+	for i, s := range steps {
+		depth = s.depth
+		ok, reason := g.Allow()
+		if ok != s.allow {
+			t.Fatalf("step %d: depth %d: Allow() = %v, want %v", i, s.depth, ok, s.allow)
+		}
+		want := ReasonNone
+		if !s.allow {
+			want = ReasonQueueFull
+		}
+		if reason != want {
+			t.Errorf("step %d: reason = %v, want %v", i, reason, want)
+		}
+	}
+
+	want := Stats{Allowed: 6, QueueFull: 4}
+	if s := g.Stats(); s != want {
+		t.Errorf("Stats() = %+v, want %+v", s, want)
+	}
+}
+
+func TestLatencyHysteresis(t *testing.T) {
+	var latency time.Duration
+	g := New(WithLatency(func() time.Duration { return latency }, 200*time.Millisecond, 100*time.Millisecond))
+
+	steps := []struct {
+		latency time.Duration
+		allow   bool
+	}{
+		{50 * time.Millisecond, true},
+		{250 * time.Millisecond, false},
+		{150 * time.Millisecond, false},
+		{100 * time.Millisecond, true},
+		{150 * time.Millisecond, true},
+	}
+	for i, s := range steps {
+		latency = s.latency
+		if ok, reason := g.Allow(); ok != s.allow || (!ok && reason != ReasonLatencyHigh) {
+			t.Fatalf("step %d: latency %v: Allow() = %v, %v", i, s.latency, ok, reason)
+		}
+	}
+}
+
+func TestProbesIndependent(t *testing.T) {
+	depth := 0
+	var latency time.Duration
+	g := New(
+		WithQueueDepth(func() int { return depth }, 10, 5),
+		WithLatency(func() time.Duration { return latency }, time.Second, 500*time.Millisecond),
+	)
+
+	// Latency trips alone
+	latency = 2 * time.Second
+	if _, reason := g.Allow(); reason != ReasonLatencyHigh {
+		t.Fatalf("reason = %v, want %v", reason, ReasonLatencyHigh)
+	}
+
+	// Both trip, the queue is checked first
+	depth = 20
+	if _, reason := g.Allow(); reason != ReasonQueueFull {
+		t.Fatalf("reason = %v, want %v", reason, ReasonQueueFull)
+	}
+
+	// The queue drains, latency is still between its watermarks
+	depth = 0
+	latency = 700 * time.Millisecond
+	if _, reason := g.Allow(); reason != ReasonLatencyHigh {
+		t.Fatalf("reason = %v, want %v", reason, ReasonLatencyHigh)
+	}
+
+	latency = 0
+	if ok, _ := g.Allow(); !ok {
+		t.Error("Allow() should admit once every probe reset")
+	}
+}
+
+func TestNoProbes(t *testing.T) {
+	if ok, reason := New().Allow(); !ok || reason != ReasonNone {
+		t.Errorf("Allow() = %v, %v, want true, none", ok, reason)
+	}
+}
+
+func TestConcurrentAllow(t *testing.T) {
+	var mu sync.Mutex
+	depth := 0
+	g := New(WithQueueDepth(func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return depth
+	}, 10, 5))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				mu.Lock()
+				depth = (i + j) % 15
+				mu.Unlock()
+				g.Allow()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s := g.Stats()
+	if s.Allowed+s.QueueFull != 800 {
+		t.Errorf("Stats() = %+v, want 800 decisions", s)
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	for r, want := range map[Reason]string{
+		ReasonNone:        "none",
+		ReasonQueueFull:   "queue full",
+		ReasonLatencyHigh: "latency high",
+		Reason(9):         "Reason(9)",
+	} {
+		if got := r.String(); got != want {
+			t.Errorf("Reason(%d).String() = %q, want %q", int(r), got, want)
+		}
+	}
+}
+
+func TestLatency(t *testing.T) {
+	l := NewLatency(0.5)
+	if l.Estimate() != 0 {
+		t.Fatal("Estimate() should be zero before any observation")
+	}
+
+	l.Observe(100 * time.Millisecond)
+	l.Observe(200 * time.Millisecond)
+	if got := l.Estimate(); got != 150*time.Millisecond {
+		t.Errorf("Estimate() = %v, want 150ms", got)
+	}
+}
+
+func TestTrickle(t *testing.T) {
+	g := New(WithQueueDepth(func() int { return 100 }, 10, 5), WithTrickle(50*time.Millisecond))
+
+	// One call gets through right away, then one per interval
+	if ok, reason := g.Allow(); !ok || reason != ReasonQueueFull {
+		t.Fatalf("Allow() = %v, %v, want a trickle admitted as queue full", ok, reason)
+	}
+	if ok, _ := g.Allow(); ok {
+		t.Fatal("Allow() should shed until the interval passed")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := g.Allow(); !ok {
+		t.Error("Allow() should let a call trickle through after the interval")
+	}
+}
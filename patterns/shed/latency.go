@@ -0,0 +1,48 @@
+package shed
+
+import (
+	"sync"
+	"time"
+)
+
+// Latency estimates recent latency as an exponentially weighted moving
+// average of observed durations.
+type Latency struct {
+	alpha float64
+
+	mu       sync.Mutex
+	estimate float64
+	observed bool
+}
+
+// NewLatency creates a Latency giving each observation the weight alpha,
+// between 0 and 1. Higher values follow changes faster. Values out of
+// range mean 0.2.
+func NewLatency(alpha float64) *Latency {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	return &Latency{alpha: alpha}
+}
+
+// Observe adds a duration to the estimate.
+func (l *Latency) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The first observation seeds the average
+	if !l.observed {
+		l.estimate = float64(d)
+		l.observed = true
+		return
+	}
+	l.estimate += l.alpha * (float64(d) - l.estimate)
+}
+
+// Estimate returns the current estimate, or zero before any observation.
+func (l *Latency) Estimate() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return time.Duration(l.estimate)
+}
@@ -0,0 +1,63 @@
+package shed
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MiddlewareOption configures Middleware.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	latency    *Latency
+	retryAfter time.Duration
+}
+
+// WithObserver records the duration of every admitted request in l, so
+// the Guard can use l.Estimate as its latency probe.
+func WithObserver(l *Latency) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.latency = l
+	}
+}
+
+// WithRetryAfter sets the Retry-After header of shed requests. The
+// default is one second; zero omits the header.
+func WithRetryAfter(d time.Duration) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.retryAfter = d
+	}
+}
+
+// Middleware returns net/http middleware that answers 503 Service
+// Unavailable when g sheds a request, with the reason in the
+// X-Shed-Reason header.
+func Middleware(g *Guard, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	c := middlewareConfig{retryAfter: time.Second}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, reason := g.Allow(); !ok {
+				w.Header().Set("X-Shed-Reason", reason.String())
+				if c.retryAfter > 0 {
+					secs := int((c.retryAfter + time.Second - 1) / time.Second)
+					w.Header().Set("Retry-After", strconv.Itoa(secs))
+				}
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+
+			if c.latency == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			c.latency.Observe(time.Since(start))
+		})
+	}
+}
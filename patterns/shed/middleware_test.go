@@ -0,0 +1,95 @@
+package shed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	depth := 0
+	g := New(WithQueueDepth(func() int { return depth }, 10, 5))
+
+	calls := 0
+	h := Middleware(g)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("status = %d, calls = %d, want the handler called", rec.Code, calls)
+	}
+
+	depth = 10
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || calls != 1 {
+		t.Fatalf("status = %d, calls = %d, want 503 without calling the handler", rec.Code, calls)
+	}
+	if got := rec.Header().Get("X-Shed-Reason"); got != "queue full" {
+		t.Errorf("X-Shed-Reason = %q, want %q", got, "queue full")
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+}
+
+func TestMiddlewareObservesLatency(t *testing.T) {
+	lat := NewLatency(1)
+	g := New(WithLatency(lat.Estimate, 20*time.Millisecond, 10*time.Millisecond))
+
+	delay := 30 * time.Millisecond
+	h := Middleware(g, WithObserver(lat), WithRetryAfter(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	// The slow request trips the guard for the next one
+	if rec := serve(); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	rec := serve()
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "" {
+		t.Error("Retry-After should be omitted")
+	}
+}
+
+func TestMiddlewareRecoversWithTrickle(t *testing.T) {
+	lat := NewLatency(1)
+	g := New(WithLatency(lat.Estimate, 20*time.Millisecond, 10*time.Millisecond), WithTrickle(100*time.Millisecond))
+
+	delay := 30 * time.Millisecond
+	h := Middleware(g, WithObserver(lat))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+	}))
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+
+	// Once tripped, one request trickles through and the next is shed
+	serve()
+	serve()
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", code)
+	}
+
+	// The system recovers; a trickled request brings the estimate down
+	delay = 0
+	time.Sleep(110 * time.Millisecond)
+	serve()
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("status = %d, want 200 after recovery", code)
+	}
+}
@@ -0,0 +1,85 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	dbpool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/db"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+)
+
+// Producer returns the stop function of p, which runs with the context
+// cancelled by cancel and closes done once Run returned. It cancels, waits
+// for Run so no goroutine writes any more, then closes p so its readers
+// see the end of the data.
+func Producer(p *producerconsumer.Producer, cancel context.CancelFunc, done <-chan struct{}) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		cancel()
+		if err := wait(ctx, done); err != nil {
+			return err
+		}
+		p.Close()
+		return nil
+	}
+}
+
+// Consumer returns the stop function of c, whose Run closes done once it
+// returned. It closes c, waits for Run to drain what is left and for
+// the items handed off to a sink to be settled, abandoning them when ctx
+// is done. Close the components writing to c first.
+func Consumer(c *producerconsumer.Consumer, done <-chan struct{}) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		c.Close()
+		err := wait(ctx, done)
+
+		// Abandoning frees the processing goroutines waiting for a slot
+		report, pendingErr := c.WaitPending(ctx)
+		if pendingErr != nil {
+			return fmt.Errorf("abandoned %d pending items: %w", len(report.Abandoned), pendingErr)
+		}
+		return err
+	}
+}
+
+// ConnectionPool returns the stop function of p. Close the components
+// using p first, so no connection is acquired after it.
+func ConnectionPool(p *dbpool.ConnectionPool) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		p.Close()
+		return nil
+	}
+}
+
+// RedisConnectionPool returns the stop function of p. Close the
+// components using p first, so no connection is acquired after it.
+func RedisConnectionPool(p *redispool.RedisConnectionPool) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		p.Close()
+		return nil
+	}
+}
+
+// TokenBucket returns the stop function of tb, which stops its filling.
+// Close the components taking tokens first.
+func TokenBucket(tb *tokenbucket.TokenBucket) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		tb.Close()
+		return nil
+	}
+}
+
+// wait waits for done to be closed, or for ctx to be done. A nil done is
+// not waited for.
+func wait(ctx context.Context, done <-chan struct{}) error {
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,157 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrCycle is returned by CloseAll when the dependencies registered
+	// form a cycle, so no order closes every component safely.
+	ErrCycle = errors.New("dependency cycle")
+
+	// ErrUnknownDependency is returned by CloseAll when a component
+	// depends on a name that was never registered.
+	ErrUnknownDependency = errors.New("unknown dependency")
+
+	// ErrDuplicate is returned by CloseAll when a name was registered
+	// twice.
+	ErrDuplicate = errors.New("duplicate component")
+)
+
+// Closer closes components in dependency order: a component is closed
+// only once every component depending on it is, so a producer is closed
+// before the queue it writes to, and a consumer before the pools it uses.
+// Closing them the other way round is what makes a producer send on a
+// closed channel.
+type Closer struct {
+	mu         sync.Mutex
+	components []*component
+
+	once   sync.Once
+	report *Report
+}
+
+// NewCloser creates an empty Closer.
+func NewCloser() *Closer {
+	return &Closer{}
+}
+
+// Register adds a component closed by close on CloseAll. DependsOn names
+// the components closed after it; WithGroup is ignored, since the Closer
+// computes the groups.
+func (c *Closer) Register(name string, close func(ctx context.Context) error, opts ...Option) {
+	n := &component{name: name, stop: close}
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	c.mu.Lock()
+	c.components = append(c.components, n)
+	c.mu.Unlock()
+}
+
+// CloseAll closes every component and returns the report, with each
+// Result's Group set to the component's level in the order. Components of
+// one level run in parallel, each level once the previous one is done; a
+// failing component does not keep the rest from being closed.
+//
+// If the dependencies are not valid, CloseAll closes nothing and returns
+// an error wrapping ErrCycle, ErrUnknownDependency or ErrDuplicate. Once
+// they are, only the first call closes anything; later calls wait for it
+// and return the same report.
+func (c *Closer) CloseAll(ctx context.Context) (*Report, error) {
+	c.mu.Lock()
+	components := make([]*component, len(c.components))
+	copy(components, c.components)
+	c.mu.Unlock()
+
+	levels, err := order(components)
+	if err != nil {
+		return nil, err
+	}
+
+	c.once.Do(func() {
+		c.report = closeLevels(ctx, levels)
+	})
+	return c.report, nil
+}
+
+// order sorts components into levels: a component's level is past those
+// of every component depending on it. Components keep registration order
+// within a level.
+func order(components []*component) ([][]*component, error) {
+	byName := make(map[string]*component, len(components))
+	for _, n := range components {
+		if _, ok := byName[n.name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicate, n.name)
+		}
+		byName[n.name] = n
+	}
+
+	// dependents counts the components still to close before each one
+	dependents := make(map[string]int, len(components))
+	for _, n := range components {
+		for _, dep := range n.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("%w: %s depends on %s", ErrUnknownDependency, n.name, dep)
+			}
+			dependents[dep]++
+		}
+	}
+
+	var levels [][]*component
+	left := components
+	for len(left) > 0 {
+		var level, rest []*component
+		for _, n := range left {
+			if dependents[n.name] == 0 {
+				level = append(level, n)
+			} else {
+				rest = append(rest, n)
+			}
+		}
+
+		if len(level) == 0 {
+			names := make([]string, len(rest))
+			for i, n := range rest {
+				names[i] = n.name
+			}
+			return nil, fmt.Errorf("%w among %s", ErrCycle, strings.Join(names, ", "))
+		}
+
+		for _, n := range level {
+			for _, dep := range n.dependsOn {
+				dependents[dep]--
+			}
+		}
+		levels = append(levels, level)
+		left = rest
+	}
+	return levels, nil
+}
+
+// closeLevels closes the components level by level.
+func closeLevels(ctx context.Context, levels [][]*component) *Report {
+	report := &Report{}
+	for i, level := range levels {
+		results := make([]Result, len(level))
+
+		var wg sync.WaitGroup
+		for j, n := range level {
+			n.group = i
+			wg.Add(1)
+			go func(j int, n *component) {
+				defer wg.Done()
+				results[j] = stop(ctx, n)
+			}(j, n)
+		}
+		wg.Wait()
+
+		report.Results = append(report.Results, results...)
+	}
+	return report
+}
@@ -0,0 +1,305 @@
+package shutdown
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	dbpool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/db"
+	redispool "github.com/Alan-333333/go-channel-patterns/patterns/work-pools/redis"
+)
+
+func TestCloserOrder(t *testing.T) {
+	var r recorder
+	c := NewCloser()
+
+	// Registered out of order on purpose
+	c.Register("redis", r.stop("redis"))
+	c.Register("consumer", r.stop("consumer"), DependsOn("redis", "db", "limiter"))
+	c.Register("producer", r.stop("producer"), DependsOn("bridge"))
+	c.Register("db", r.stop("db"))
+	c.Register("bridge", r.stop("bridge"), DependsOn("consumer"))
+	c.Register("limiter", r.stop("limiter"))
+
+	report, err := c.CloseAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(r.order[:3], ",")
+	if got != "producer,bridge,consumer" {
+		t.Errorf("stopped in order %s", strings.Join(r.order, ","))
+	}
+
+	// The pools share the last level, in registration order
+	var levels []string
+	for _, res := range report.Results {
+		levels = append(levels, fmt.Sprintf("%s:%d", res.Name, res.Group))
+	}
+	want := "producer:0 bridge:1 consumer:2 redis:3 db:3 limiter:3"
+	if got := strings.Join(levels, " "); got != want {
+		t.Errorf("levels %s, want %s", got, want)
+	}
+}
+
+func TestCloserInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(c *Closer, r *recorder)
+		want     error
+	}{
+		{"cycle", func(c *Closer, r *recorder) {
+			c.Register("free", r.stop("free"))
+			c.Register("a", r.stop("a"), DependsOn("b"))
+			c.Register("b", r.stop("b"), DependsOn("c"))
+			c.Register("c", r.stop("c"), DependsOn("a"))
+		}, ErrCycle},
+		{"self", func(c *Closer, r *recorder) {
+			c.Register("a", r.stop("a"), DependsOn("a"))
+		}, ErrCycle},
+		{"unknown", func(c *Closer, r *recorder) {
+			c.Register("a", r.stop("a"), DependsOn("missing"))
+		}, ErrUnknownDependency},
+		{"duplicate", func(c *Closer, r *recorder) {
+			c.Register("a", r.stop("a"))
+			c.Register("a", r.stop("a"))
+		}, ErrDuplicate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r recorder
+			c := NewCloser()
+			tt.register(c, &r)
+
+			report, err := c.CloseAll(context.Background())
+			if !errors.Is(err, tt.want) || report != nil {
+				t.Fatalf("CloseAll = %v, %v, want %v", report, err, tt.want)
+			}
+
+			// Nothing is closed, not even the components outside the cycle
+			if len(r.order) != 0 {
+				t.Errorf("stopped %v", r.order)
+			}
+		})
+	}
+}
+
+func TestCloserCycleNamesMembers(t *testing.T) {
+	var r recorder
+	c := NewCloser()
+	c.Register("free", r.stop("free"))
+	c.Register("a", r.stop("a"), DependsOn("b"))
+	c.Register("b", r.stop("b"), DependsOn("a"))
+
+	_, err := c.CloseAll(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "a, b") || strings.Contains(err.Error(), "free") {
+		t.Errorf("CloseAll = %v, want the cycle named", err)
+	}
+}
+
+func TestCloserOnce(t *testing.T) {
+	var r recorder
+	c := NewCloser()
+	c.Register("a", r.stop("a"))
+
+	first, _ := c.CloseAll(context.Background())
+	second, _ := c.CloseAll(context.Background())
+	if first != second {
+		t.Error("second CloseAll returned another report")
+	}
+	if len(r.order) != 1 {
+		t.Errorf("stopped %d times, want 1", len(r.order))
+	}
+}
+
+func init() {
+	sql.Register("shutdowntest", fakeDriver{})
+}
+
+// fakeDriver opens connections that do nothing.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("shutdowntest: not supported")
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("shutdowntest: not supported")
+}
+
+// TestCloserPipeline closes a running producer, bridge and consumer using
+// both pools and a limiter. Any send on a closed channel or use of a
+// closed pool would panic or fail the report.
+func TestCloserPipeline(t *testing.T) {
+	ctx := context.Background()
+
+	// Pools and limiter
+	s := miniredis.RunT(t)
+	rp := redispool.New(4, 1, time.Second)
+	rp.OpenConnection = func() (*redispool.RedisConn, error) {
+		client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+		return &redispool.RedisConn{Conn: client, TimeOut: time.Minute}, nil
+	}
+	if err := rp.Open(); err != nil {
+		t.Fatal(err)
+	}
+	dp := dbpool.New(4, 1, time.Second)
+	dp.OpenConnection = func() (*dbpool.DBConn, error) {
+		db, err := sql.Open("shutdowntest", "")
+		return &dbpool.DBConn{DB: db, HeartBeat: time.Now(), TimeOut: time.Minute}, err
+	}
+	if err := dp.Open(); err != nil {
+		t.Fatal(err)
+	}
+	tb := tokenbucket.New(1000, 10)
+
+	// Producer -> q1 -> bridge -> q2 -> consumer
+	q1 := queue.New[interface{}](8)
+	q2 := queue.New[interface{}](8)
+
+	n := 0
+	p := producerconsumer.NewProducer(0, 1)
+	p.SetQueue(q1)
+	p.ProduceFunc = func() (interface{}, error) {
+		n++
+		return n, nil
+	}
+
+	c := producerconsumer.NewConsumer(0, 2)
+	c.SetQueue(q2)
+	c.Notify(func(string) {})
+	c.ConsumeFunc = func(data interface{}) error {
+		tb.Allow()
+		err := rp.Do(ctx, func(conn *redispool.RedisConn) error {
+			return conn.Conn.Incr("consumed").Err()
+		})
+		if err != nil {
+			return err
+		}
+		return dp.WithConn(ctx, func(conn *dbpool.DBConn) error {
+			return conn.DB.Ping()
+		})
+	}
+
+	pctx, cancel := context.WithCancel(ctx)
+	producerDone := make(chan struct{})
+	go func() {
+		defer close(producerDone)
+		p.Run(pctx)
+	}()
+	bridgeDone := make(chan struct{})
+	go func() {
+		defer close(bridgeDone)
+		for {
+			v, err := q1.Pop(ctx)
+			if err != nil {
+				return
+			}
+			if err := q2.Push(ctx, v); err != nil {
+				t.Errorf("bridge push: %v", err)
+				return
+			}
+		}
+	}()
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		c.Run(ctx)
+	}()
+
+	// Let data flow, then close everything
+	for c.Stats().Processed < 100 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closer := NewCloser()
+	closer.Register("producer", Producer(p, cancel, producerDone), DependsOn("bridge"))
+	closer.Register("bridge", func(ctx context.Context) error {
+		return wait(ctx, bridgeDone)
+	}, DependsOn("consumer"))
+	closer.Register("consumer", Consumer(c, consumerDone), DependsOn("redis", "db", "limiter"))
+	closer.Register("redis", RedisConnectionPool(rp))
+	closer.Register("db", ConnectionPool(dp))
+	closer.Register("limiter", TokenBucket(tb))
+
+	closeCtx, cancelClose := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelClose()
+	report, err := closer.CloseAll(closeCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("%v\n%s", err, report)
+	}
+
+	// Everything produced was drained and consumed
+	produced, consumed := p.Stats().Produced, c.Stats().Processed
+	if produced != consumed || c.Stats().Failed != 0 {
+		t.Errorf("produced %d, consumed %d, failed %d", produced, consumed, c.Stats().Failed)
+	}
+	if got, _ := s.Get("consumed"); got != fmt.Sprint(consumed) {
+		t.Errorf("redis counted %s, want %d", got, consumed)
+	}
+}
+
+func TestConsumerAbandonsPending(t *testing.T) {
+	handles := make(chan *producerconsumer.Pending, 2)
+	q := queue.New[interface{}](2)
+	c := producerconsumer.NewConsumer(0, 1)
+	c.SetQueue(q)
+	c.Notify(func(string) {})
+	c.HandleError(func(error) {})
+	c.MaxPending = 2
+	c.ConsumeFunc = func(interface{}) error {
+		p := producerconsumer.NewPending()
+		handles <- p
+		return p
+	}
+	q.Push(context.Background(), 1)
+	q.Push(context.Background(), 2)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(context.Background())
+	}()
+
+	// One item is confirmed, the other never is
+	(<-handles).Confirm()
+	<-handles
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := Consumer(c, done)(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "abandoned 1 pending") {
+		t.Fatalf("stop = %v, want the pending item abandoned", err)
+	}
+	if s := c.Stats(); s.Processed != 2 || s.Failed != 1 || s.Pending != 0 {
+		t.Errorf("stats %+v", s)
+	}
+}
@@ -0,0 +1,240 @@
+// Package shutdown tears down the components of a service in order, such
+// as producers before consumers before pools, on SIGTERM.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrTimeout is the error of a component whose stop function did not
+// return within its timeout.
+var ErrTimeout = errors.New("shutdown timed out")
+
+// PanicError is the error of a component whose stop function panicked.
+type PanicError struct {
+
+	// Value is the value passed to panic.
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("stop panicked: %v", e.Value)
+}
+
+// Option configures a registered component.
+type Option func(*component)
+
+// WithGroup puts the component in ordering group n. Groups are stopped in
+// increasing order, each once the previous one is done. The default is 0.
+func WithGroup(n int) Option {
+	return func(c *component) {
+		c.group = n
+	}
+}
+
+// WithTimeout bounds how long the component's stop function may take. Its
+// context is cancelled after d, and it is reported with ErrTimeout if it
+// has not returned by then. Without it, only the context passed to Trigger
+// bounds it.
+func WithTimeout(d time.Duration) Option {
+	return func(c *component) {
+		c.timeout = d
+	}
+}
+
+// DependsOn names the components that must still be running while this
+// one is stopped, such as the queue a producer writes to or the pool a
+// consumer uses. A Closer stops them after it; a Coordinator ignores it.
+func DependsOn(names ...string) Option {
+	return func(c *component) {
+		c.dependsOn = append(c.dependsOn, names...)
+	}
+}
+
+type component struct {
+	name      string
+	stop      func(ctx context.Context) error
+	group     int
+	timeout   time.Duration
+	dependsOn []string
+}
+
+// Result is the outcome of stopping one component.
+type Result struct {
+	Name     string
+	Group    int
+	Err      error // nil on success, ErrTimeout, a *PanicError, or the stop error
+	Duration time.Duration
+}
+
+// Report is the outcome of a shutdown, with a Result per component in the
+// order they were stopped.
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the results of the components that failed or timed out.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, res := range r.Results {
+		if res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Err returns the failures joined into one error naming each component,
+// or nil if every component stopped cleanly.
+func (r *Report) Err() error {
+	var errs []error
+	for _, res := range r.Failed() {
+		errs = append(errs, fmt.Errorf("%s: %w", res.Name, res.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// String summarises the report, one line per component.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, res := range r.Results {
+		status := "ok"
+		if res.Err != nil {
+			status = res.Err.Error()
+		}
+		fmt.Fprintf(&b, "[%d] %s: %s (%v)\n", res.Group, res.Name, status, res.Duration)
+	}
+	return b.String()
+}
+
+// Coordinator stops registered components group by group, running the
+// members of a group in parallel.
+type Coordinator struct {
+	mu         sync.Mutex
+	components []*component
+
+	once   sync.Once
+	report *Report
+}
+
+// New creates an empty Coordinator.
+func New() *Coordinator {
+	return &Coordinator{}
+}
+
+// Register adds a component stopped by stop on Trigger.
+func (c *Coordinator) Register(name string, stop func(ctx context.Context) error, opts ...Option) {
+	comp := &component{name: name, stop: stop}
+	for _, opt := range opts {
+		opt(comp)
+	}
+
+	c.mu.Lock()
+	c.components = append(c.components, comp)
+	c.mu.Unlock()
+}
+
+// Trigger stops every component and returns the report. Groups run one
+// after another; a failing component does not keep the rest from being
+// stopped. Only the first call stops anything; later calls wait for it
+// and return the same report.
+func (c *Coordinator) Trigger(ctx context.Context) *Report {
+	c.once.Do(func() {
+		c.report = c.run(ctx)
+	})
+	return c.report
+}
+
+// TriggerOnSignal waits for one of sigs, SIGINT and SIGTERM by default, or
+// for ctx to be done, then calls Trigger. The teardown itself is not
+// cancelled with ctx; use WithTimeout to bound it.
+func (c *Coordinator) TriggerOnSignal(ctx context.Context, sigs ...os.Signal) *Report {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	select {
+	case <-ch:
+	case <-ctx.Done():
+	}
+
+	return c.Trigger(context.WithoutCancel(ctx))
+}
+
+// run stops the components group by group.
+func (c *Coordinator) run(ctx context.Context) *Report {
+	c.mu.Lock()
+	components := make([]*component, len(c.components))
+	copy(components, c.components)
+	c.mu.Unlock()
+
+	// Registration order is kept within a group
+	sort.SliceStable(components, func(i, j int) bool {
+		return components[i].group < components[j].group
+	})
+
+	report := &Report{Results: make([]Result, len(components))}
+	for start := 0; start < len(components); {
+		end := start
+		for end < len(components) && components[end].group == components[start].group {
+			end++
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				report.Results[i] = stop(ctx, components[i])
+			}(i)
+		}
+		wg.Wait()
+
+		start = end
+	}
+	return report
+}
+
+// stop runs comp's stop function within its timeout.
+func stop(ctx context.Context, comp *component) Result {
+	res := Result{Name: comp.name, Group: comp.group}
+	begin := time.Now()
+
+	if comp.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, comp.timeout)
+		defer cancel()
+	}
+
+	// Buffered so a stop function outliving its timeout does not leak
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- &PanicError{Value: v}
+			}
+		}()
+		done <- comp.stop(ctx)
+	}()
+
+	select {
+	case res.Err = <-done:
+	case <-ctx.Done():
+		res.Err = ErrTimeout
+	}
+	res.Duration = time.Since(begin)
+	return res
+}
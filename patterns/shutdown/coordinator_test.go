@@ -0,0 +1,207 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recorder logs the order components are stopped in.
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) stop(name string) func(context.Context) error {
+	return func(context.Context) error {
+		r.mu.Lock()
+		r.order = append(r.order, name)
+		r.mu.Unlock()
+		return nil
+	}
+}
+
+func TestGroupOrdering(t *testing.T) {
+	var r recorder
+	c := New()
+
+	c.Register("pool", r.stop("pool"), WithGroup(2))
+	c.Register("producer", r.stop("producer"), WithGroup(0))
+	c.Register("consumer", r.stop("consumer"), WithGroup(1))
+	c.Register("limiter", r.stop("limiter"), WithGroup(1))
+
+	report := c.Trigger(context.Background())
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(r.order, ",")
+	if got != "producer,consumer,limiter,pool" && got != "producer,limiter,consumer,pool" {
+		t.Errorf("stopped in order %s", got)
+	}
+	if n := len(report.Results); n != 4 {
+		t.Errorf("report has %d results, want 4", n)
+	}
+}
+
+func TestGroupMembersRunInParallel(t *testing.T) {
+	c := New()
+
+	// Each waits for the other, so they must run at the same time
+	a, b := make(chan struct{}), make(chan struct{})
+	c.Register("a", func(context.Context) error {
+		close(a)
+		<-b
+		return nil
+	}, WithTimeout(time.Second))
+	c.Register("b", func(context.Context) error {
+		close(b)
+		<-a
+		return nil
+	}, WithTimeout(time.Second))
+
+	if err := c.Trigger(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var r recorder
+	c := New()
+
+	c.Register("stuck", func(context.Context) error {
+		select {}
+	}, WithTimeout(20*time.Millisecond))
+	c.Register("next", r.stop("next"), WithGroup(1))
+
+	start := time.Now()
+	report := c.Trigger(context.Background())
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Trigger took %v, the timeout should cut it short", elapsed)
+	}
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Name != "stuck" || !errors.Is(failed[0].Err, ErrTimeout) {
+		t.Fatalf("Failed() = %+v, want stuck timed out", failed)
+	}
+	if len(r.order) != 1 {
+		t.Error("later groups should still be stopped")
+	}
+}
+
+func TestTimeoutCancelsContext(t *testing.T) {
+	c := New()
+
+	c.Register("polite", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, WithTimeout(10*time.Millisecond))
+
+	report := c.Trigger(context.Background())
+	if report.Results[0].Duration > time.Second {
+		t.Errorf("stop context should be cancelled after the timeout")
+	}
+}
+
+func TestPanicDoesNotAbort(t *testing.T) {
+	var r recorder
+	c := New()
+
+	c.Register("panics", func(context.Context) error { panic("oops") })
+	c.Register("sibling", r.stop("sibling"))
+	c.Register("later", r.stop("later"), WithGroup(1))
+
+	report := c.Trigger(context.Background())
+
+	var pe *PanicError
+	if err := report.Err(); !errors.As(err, &pe) || pe.Value != "oops" {
+		t.Fatalf("Err() = %v, want a *PanicError", err)
+	}
+	if !strings.Contains(report.Err().Error(), "panics:") {
+		t.Errorf("Err() = %v, should name the component", report.Err())
+	}
+	if len(r.order) != 2 {
+		t.Errorf("stopped %v, want sibling and later", r.order)
+	}
+}
+
+func TestStopError(t *testing.T) {
+	boom := errors.New("boom")
+	c := New()
+	c.Register("db", func(context.Context) error { return boom })
+
+	report := c.Trigger(context.Background())
+	if !errors.Is(report.Err(), boom) {
+		t.Errorf("Err() = %v, want %v", report.Err(), boom)
+	}
+	if !strings.Contains(report.String(), "db: boom") {
+		t.Errorf("String() = %q", report.String())
+	}
+}
+
+func TestTriggerOnce(t *testing.T) {
+	calls := 0
+	c := New()
+	c.Register("x", func(context.Context) error {
+		calls++
+		return nil
+	})
+
+	first := c.Trigger(context.Background())
+	second := c.Trigger(context.Background())
+	if calls != 1 || first != second {
+		t.Errorf("stop called %d times, want once with the same report", calls)
+	}
+}
+
+func TestTriggerOnSignal(t *testing.T) {
+	var r recorder
+	c := New()
+	c.Register("x", r.stop("x"))
+
+	// Keep the signal from killing the test before the handler is installed
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, syscall.SIGUSR1)
+	defer signal.Stop(ignored)
+
+	done := make(chan *Report)
+	go func() {
+		done <- c.TriggerOnSignal(context.Background(), syscall.SIGUSR1)
+	}()
+
+	// Signal until the coordinator has seen one
+	timeout := time.After(time.Second)
+	for {
+		syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+		select {
+		case report := <-done:
+			if len(report.Results) != 1 || len(r.order) != 1 {
+				t.Errorf("report = %v", report)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("signal did not trigger shutdown")
+		}
+	}
+}
+
+func TestTriggerOnSignalContext(t *testing.T) {
+	var r recorder
+	c := New()
+	c.Register("x", r.stop("x"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := c.TriggerOnSignal(ctx)
+	if err := report.Err(); err != nil || len(r.order) != 1 {
+		t.Errorf("Err() = %v, stopped %v", err, r.order)
+	}
+}
@@ -0,0 +1,145 @@
+// Package signal provides Done, a channel closed once to broadcast that
+// something ended, which also tells why.
+package signal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is the reason of a Done closed without one.
+var ErrClosed = errors.New("signal closed")
+
+// closes numbers the closings of all Dones, so Merge can tell which of its
+// inputs closed first.
+var closes atomic.Uint64
+
+// Done is closed once, with the reason it was closed. The zero value is
+// an open Done.
+type Done struct {
+	mu     sync.Mutex
+	ch     chan struct{}
+	reason error
+
+	// seq orders the closing among those of other Dones.
+	seq uint64
+}
+
+// New creates an open Done.
+func New() *Done {
+	return &Done{}
+}
+
+// Close closes d with reason, or ErrClosed if reason is nil, and reports
+// whether it did. Only the first call closes d; later ones do nothing.
+func (d *Done) Close(reason error) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.reason != nil {
+		return false
+	}
+	if reason == nil {
+		reason = ErrClosed
+	}
+	d.reason = reason
+	d.seq = closes.Add(1)
+	close(d.chanLocked())
+	return true
+}
+
+// Done returns a channel closed when d is, for use in select.
+func (d *Done) Done() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.chanLocked()
+}
+
+// Reason returns why d was closed, or nil while it is open.
+func (d *Done) Reason() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.reason
+}
+
+// chanLocked returns the channel, making it on first use. The caller
+// holds mu.
+func (d *Done) chanLocked() chan struct{} {
+	if d.ch == nil {
+		d.ch = make(chan struct{})
+	}
+	return d.ch
+}
+
+// closed returns the closing order and reason of d, or a nil reason while
+// it is open.
+func (d *Done) closed() (uint64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.seq, d.reason
+}
+
+// Merge returns a Done closed when the first of dones closes, with its
+// reason, such as a component's Done merged with its parent's for
+// hierarchical teardown. If several are closed by the time it closes, the
+// reason is the one of the Done closed first. Closing the merged Done
+// does not close dones.
+//
+// Merge watches dones from goroutines until one of them or the merged
+// Done closes: close the merged Done once it is no longer needed.
+func Merge(dones ...*Done) *Done {
+	m := New()
+	if closeFirst(m, dones) {
+		return m
+	}
+
+	for _, d := range dones {
+		go func(d *Done) {
+			select {
+			case <-d.Done():
+				closeFirst(m, dones)
+			case <-m.Done():
+			}
+		}(d)
+	}
+	return m
+}
+
+// closeFirst closes m with the reason of the first of dones closed, if
+// any, and reports whether m is closed.
+func closeFirst(m *Done, dones []*Done) bool {
+	var first error
+	var firstSeq uint64
+	for _, d := range dones {
+		seq, reason := d.closed()
+		if reason != nil && (first == nil || seq < firstSeq) {
+			first, firstSeq = reason, seq
+		}
+	}
+	if first != nil {
+		m.Close(first)
+	}
+	return m.Reason() != nil
+}
+
+// Context returns a copy of parent cancelled when d closes, with the
+// reason of d as its context.Cause, or when the returned cancel function
+// is called.
+func Context(parent context.Context, d *Done) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	go func() {
+		select {
+		case <-d.Done():
+			cancel(d.Reason())
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
@@ -0,0 +1,183 @@
+package signal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// closedWithin reports whether d closes within a second.
+func closedWithin(d *Done) bool {
+	select {
+	case <-d.Done():
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestClose(t *testing.T) {
+	var d Done
+	if d.Reason() != nil {
+		t.Fatal("an open Done should have no reason")
+	}
+	select {
+	case <-d.Done():
+		t.Fatal("Done() closed before Close")
+	default:
+	}
+
+	errStop := errors.New("source exhausted")
+	if !d.Close(errStop) {
+		t.Error("the first Close should close")
+	}
+	if d.Close(errors.New("later")) {
+		t.Error("a later Close should do nothing")
+	}
+	if !closedWithin(&d) || d.Reason() != errStop {
+		t.Errorf("Reason() = %v, want %v", d.Reason(), errStop)
+	}
+
+	// closing without a reason
+	d2 := New()
+	d2.Close(nil)
+	if !errors.Is(d2.Reason(), ErrClosed) {
+		t.Errorf("Reason() = %v, want %v", d2.Reason(), ErrClosed)
+	}
+}
+
+func TestCloseRace(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		d := New()
+
+		var wg sync.WaitGroup
+		won := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			// waiters see the reason once Done is closed
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-d.Done()
+				if d.Reason() == nil {
+					t.Error("no reason after Done closed")
+				}
+			}()
+			wg.Add(1)
+			go func(err error) {
+				defer wg.Done()
+				if d.Close(err) {
+					won <- err
+				}
+			}(fmt.Errorf("closer %d", i))
+		}
+		wg.Wait()
+		close(won)
+
+		// exactly one closer wins, and its reason sticks
+		var winners []error
+		for err := range won {
+			winners = append(winners, err)
+		}
+		if len(winners) != 1 {
+			t.Fatalf("%d closers won, want 1", len(winners))
+		}
+		if d.Reason() != winners[0] {
+			t.Fatalf("Reason() = %v, want the winner %v", d.Reason(), winners[0])
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := New(), New()
+	m := Merge(a, b)
+
+	// the first input to close closes the merged Done with its reason
+	errB := errors.New("b failed")
+	b.Close(errB)
+	if !closedWithin(m) || m.Reason() != errB {
+		t.Errorf("Reason() = %v, want %v", m.Reason(), errB)
+	}
+	a.Close(errors.New("a failed"))
+	if m.Reason() != errB {
+		t.Errorf("Reason() = %v after another input closed, want %v", m.Reason(), errB)
+	}
+
+	// closing the merged Done leaves the inputs open
+	c := New()
+	m = Merge(c)
+	m.Close(nil)
+	if c.Reason() != nil {
+		t.Error("closing the merged Done should not close its inputs")
+	}
+}
+
+func TestMergeOrder(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		a, b, c := New(), New(), New()
+		m := Merge(a, b, c)
+
+		// inputs closing in quick succession: the first one's reason wins,
+		// whichever watcher runs first
+		errs := []error{errors.New("first"), errors.New("second"), errors.New("third")}
+		c.Close(errs[0])
+		a.Close(errs[1])
+		b.Close(errs[2])
+		if !closedWithin(m) || m.Reason() != errs[0] {
+			t.Fatalf("Reason() = %v, want %v", m.Reason(), errs[0])
+		}
+	}
+
+	// inputs closed before Merge
+	a, b := New(), New()
+	errA := errors.New("a")
+	a.Close(errA)
+	b.Close(errors.New("b"))
+	if m := Merge(b, a); m.Reason() != errA {
+		t.Errorf("Reason() = %v, want %v", m.Reason(), errA)
+	}
+}
+
+func TestMergeHierarchy(t *testing.T) {
+	// root -> service -> workers
+	root := New()
+	service := Merge(root)
+	other := New()
+	workers := []*Done{Merge(service, other), Merge(service)}
+
+	errShutdown := errors.New("shutdown")
+	root.Close(errShutdown)
+
+	for i, d := range append([]*Done{service}, workers...) {
+		if !closedWithin(d) || d.Reason() != errShutdown {
+			t.Errorf("level %d: Reason() = %v, want %v", i, d.Reason(), errShutdown)
+		}
+	}
+	if other.Reason() != nil {
+		t.Error("teardown should not close unrelated Dones")
+	}
+}
+
+func TestContext(t *testing.T) {
+	d := New()
+	ctx, cancel := Context(context.Background(), d)
+	defer cancel()
+
+	errFatal := errors.New("fatal")
+	d.Close(errFatal)
+	<-ctx.Done()
+	if context.Cause(ctx) != errFatal {
+		t.Errorf("Cause() = %v, want %v", context.Cause(ctx), errFatal)
+	}
+
+	// cancelling the returned context leaves d open
+	d = New()
+	ctx, cancel = Context(context.Background(), d)
+	cancel()
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.Canceled) || d.Reason() != nil {
+		t.Errorf("Err() = %v, Reason() = %v, want canceled and open", ctx.Err(), d.Reason())
+	}
+}
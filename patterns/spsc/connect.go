@@ -0,0 +1,70 @@
+package spsc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+)
+
+// ErrNotSingle is returned by Connect when the producer or the consumer
+// runs more than one goroutine.
+var ErrNotSingle = errors.New("spsc: producer and consumer must both have NumProcs 1")
+
+// Connect runs p and c with a Ring of the given capacity between them
+// instead of their Buffer channels. Both must have NumProcs 1, since the
+// ring allows one goroutine on each side. The producer's goroutine calls
+// ProduceFunc until it returns nil data, reporting errors to ErrHandler
+// like Producer.Run; the consumer's passes each item to c.Process.
+//
+// Connect returns nil once every item produced has been consumed, or the
+// context error if ctx is done first.
+func Connect(ctx context.Context, p *producerconsumer.Producer, c *producerconsumer.Consumer, capacity int) error {
+	if p.NumProcs != 1 || c.NumProcs != 1 {
+		return ErrNotSingle
+	}
+
+	ring := New[interface{}](capacity)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ring.Close()
+
+		for ctx.Err() == nil {
+			data, err := p.ProduceFunc()
+			if err != nil {
+				if p.ErrHandler != nil {
+					p.ErrHandler(err)
+				}
+				continue
+			}
+
+			// No more data
+			if data == nil {
+				return
+			}
+			if ring.Send(ctx, data) != nil {
+				return
+			}
+		}
+	}()
+
+	var err error
+	for {
+		var data interface{}
+		data, err = ring.Recv(ctx)
+		if err != nil {
+			break
+		}
+		c.Process(ctx, data)
+	}
+	wg.Wait()
+
+	if errors.Is(err, ErrClosed) {
+		return ctx.Err()
+	}
+	return err
+}
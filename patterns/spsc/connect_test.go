@@ -0,0 +1,121 @@
+package spsc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+)
+
+// counting returns a producer of the ints 1..n, failing on every tenth.
+func counting(n int) *producerconsumer.Producer {
+	p := producerconsumer.NewProducer(0, 1)
+	i := 0
+	p.ProduceFunc = func() (interface{}, error) {
+		i++
+		if i > n {
+			return nil, nil
+		}
+		if i%10 == 0 {
+			return nil, errors.New("skipped")
+		}
+		return i, nil
+	}
+	return p
+}
+
+func TestConnect(t *testing.T) {
+	p := counting(1000)
+	var errs int
+	p.HandleError(func(error) { errs++ })
+
+	var got []int
+	c := producerconsumer.NewConsumer(0, 1)
+	c.ConsumeFunc = func(data interface{}) error {
+		got = append(got, data.(int))
+		return nil
+	}
+
+	if err := Connect(context.Background(), p, c, 16); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 900 || errs != 100 {
+		t.Fatalf("consumed %d items with %d errors, want 900 and 100", len(got), errs)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] <= got[i-1] {
+			t.Fatalf("items out of order: %d after %d", got[i], got[i-1])
+		}
+	}
+}
+
+func TestConnectCancel(t *testing.T) {
+	p := producerconsumer.NewProducer(0, 1)
+	p.ProduceFunc = func() (interface{}, error) { return 1, nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := producerconsumer.NewConsumer(0, 1)
+	c.ConsumeFunc = func(interface{}) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := Connect(ctx, p, c, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("Connect = %v, want context.Canceled", err)
+	}
+}
+
+func TestConnectNotSingle(t *testing.T) {
+	p := counting(1)
+	c := producerconsumer.NewConsumer(0, 2)
+	if err := Connect(context.Background(), p, c, 4); !errors.Is(err, ErrNotSingle) {
+		t.Errorf("Connect = %v, want ErrNotSingle", err)
+	}
+}
+
+// BenchmarkConnect compares the ring with the Buffer channel between a
+// single producer and consumer.
+func BenchmarkConnect(b *testing.B) {
+	produce := func(n int) *producerconsumer.Producer {
+		p := producerconsumer.NewProducer(1024, 1)
+		i := 0
+		p.ProduceFunc = func() (interface{}, error) {
+			i++
+			if i > n {
+				return nil, nil
+			}
+			return i, nil
+		}
+		return p
+	}
+	consumer := func() *producerconsumer.Consumer {
+		c := producerconsumer.NewConsumer(1024, 1)
+		c.ConsumeFunc = func(interface{}) error { return nil }
+		return c
+	}
+
+	b.Run("Ring", func(b *testing.B) {
+		Connect(context.Background(), produce(b.N), consumer(), 1024)
+	})
+
+	b.Run("Channel", func(b *testing.B) {
+		p, c := produce(b.N), consumer()
+		go func() {
+			for {
+				data, _ := p.ProduceFunc()
+				if data == nil {
+					close(c.Buffer)
+					return
+				}
+				c.Buffer <- data
+			}
+		}()
+		for data := range c.Buffer {
+			c.Process(context.Background(), data)
+		}
+	})
+}
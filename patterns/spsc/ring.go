@@ -0,0 +1,203 @@
+// Package spsc implements a lock-free ring buffer for exactly one
+// producer goroutine and one consumer goroutine, a cheaper transport than
+// a buffered channel when neither side is shared.
+package spsc
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by Send after Close, and by Recv once the ring is
+// closed and drained.
+var ErrClosed = errors.New("spsc ring is closed")
+
+// cacheLine is the assumed size of a CPU cache line. The indices owned by
+// each side are kept on lines of their own, so the two goroutines do not
+// invalidate each other's caches on every operation.
+const cacheLine = 64
+
+// Ring is a bounded FIFO queue. Push, Send and Close may only be called
+// by the producer goroutine, and Pop and Recv only by the consumer
+// goroutine; Len and Cap may be called by either.
+type Ring[T any] struct {
+	buf  []T
+	mask uint64
+	_    [cacheLine - 32]byte
+
+	// head is the next slot to read. The consumer writes it after taking
+	// the item out, publishing the slot back to the producer.
+	head atomic.Uint64
+
+	// tailCache is the consumer's last view of tail, refreshed only when
+	// the ring looks empty.
+	tailCache uint64
+	_         [cacheLine - 16]byte
+
+	// tail is the next slot to write. The producer writes it after
+	// storing the item, publishing it to the consumer.
+	tail atomic.Uint64
+
+	// headCache is the producer's last view of head, refreshed only when
+	// the ring looks full.
+	headCache uint64
+	_         [cacheLine - 16]byte
+
+	closed atomic.Bool
+}
+
+// New creates a Ring holding at least capacity items; the capacity is
+// rounded up to a power of two. It panics if capacity is less than one.
+func New[T any](capacity int) *Ring[T] {
+	if capacity < 1 {
+		panic("spsc: capacity must be positive")
+	}
+
+	size := 1
+	for size < capacity {
+		size <<= 1
+	}
+	return &Ring[T]{
+		buf:  make([]T, size),
+		mask: uint64(size - 1),
+	}
+}
+
+// Cap returns how many items the ring holds.
+func (r *Ring[T]) Cap() int {
+	return len(r.buf)
+}
+
+// Len returns how many items are queued. It is only a snapshot when the
+// other side is running.
+func (r *Ring[T]) Len() int {
+	return int(r.tail.Load() - r.head.Load())
+}
+
+// Push queues v and reports whether it did; it fails at once if the ring
+// is full.
+func (r *Ring[T]) Push(v T) bool {
+	tail := r.tail.Load()
+	if tail-r.headCache == uint64(len(r.buf)) {
+		r.headCache = r.head.Load()
+		if tail-r.headCache == uint64(len(r.buf)) {
+			return false
+		}
+	}
+
+	r.buf[tail&r.mask] = v
+	r.tail.Store(tail + 1)
+	return true
+}
+
+// Pop takes the oldest item and reports whether there was one.
+func (r *Ring[T]) Pop() (T, bool) {
+	var zero T
+
+	head := r.head.Load()
+	if head == r.tailCache {
+		r.tailCache = r.tail.Load()
+		if head == r.tailCache {
+			return zero, false
+		}
+	}
+
+	// Clear the slot, so the ring does not keep the item alive
+	slot := &r.buf[head&r.mask]
+	v := *slot
+	*slot = zero
+	r.head.Store(head + 1)
+	return v, true
+}
+
+// Close marks the end of the items. Recv returns the items already
+// queued, then ErrClosed.
+func (r *Ring[T]) Close() {
+	r.closed.Store(true)
+}
+
+// Send queues v, waiting while the ring is full until ctx is done.
+func (r *Ring[T]) Send(ctx context.Context, v T) error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+
+	var b backoff
+	for !r.Push(v) {
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recv takes the oldest item, waiting while the ring is empty until ctx
+// is done. It returns ErrClosed once the ring is closed and drained.
+func (r *Ring[T]) Recv(ctx context.Context) (T, error) {
+	var b backoff
+	for {
+		// Read closed first: an item pushed before Close is then seen by
+		// the Pop that follows
+		closed := r.closed.Load()
+		if v, ok := r.Pop(); ok {
+			return v, nil
+		}
+		if closed {
+			var zero T
+			return zero, ErrClosed
+		}
+		if err := b.wait(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+}
+
+const (
+	// spins is how many times a waiting side yields before sleeping.
+	spins = 64
+
+	// maxSleep bounds the sleep between polls of an idle ring.
+	maxSleep = time.Millisecond
+)
+
+// backoff paces a side waiting on the other: it yields the processor
+// first, as the wait is usually short, then sleeps for doubling times.
+type backoff struct {
+	n     int
+	sleep time.Duration
+}
+
+// wait waits a little, or returns the context error if ctx is done.
+func (b *backoff) wait(ctx context.Context) error {
+	b.n++
+	if b.n%spins == 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+
+	if b.n < spins {
+		runtime.Gosched()
+		return nil
+	}
+
+	if b.sleep == 0 {
+		b.sleep = time.Microsecond
+	} else if b.sleep < maxSleep {
+		b.sleep *= 2
+	}
+	time.Sleep(b.sleep)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,199 @@
+package spsc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestRing(t *testing.T) {
+	r := New[int](3)
+	if r.Cap() != 4 {
+		t.Fatalf("Cap = %d, want capacity rounded up to 4", r.Cap())
+	}
+
+	if _, ok := r.Pop(); ok {
+		t.Error("Pop on an empty ring should fail")
+	}
+	for i := 0; i < 4; i++ {
+		if !r.Push(i) {
+			t.Fatalf("Push(%d) failed", i)
+		}
+	}
+	if r.Push(4) {
+		t.Error("Push on a full ring should fail")
+	}
+	if r.Len() != 4 {
+		t.Errorf("Len = %d, want 4", r.Len())
+	}
+
+	// Wrap around the end of the buffer
+	for i := 0; i < 10; i++ {
+		v, ok := r.Pop()
+		if !ok || v != i {
+			t.Fatalf("Pop = %d, %v, want %d", v, ok, i)
+		}
+		if !r.Push(i + 4) {
+			t.Fatalf("Push(%d) failed", i+4)
+		}
+	}
+	if r.Len() != 4 {
+		t.Errorf("Len = %d, want 4", r.Len())
+	}
+}
+
+func TestRingReleasesItems(t *testing.T) {
+	r := New[*int](2)
+	r.Push(new(int))
+	r.Pop()
+	if r.buf[0] != nil {
+		t.Error("Pop should clear the slot")
+	}
+}
+
+func TestRingPadding(t *testing.T) {
+	var r Ring[int]
+	head := unsafe.Offsetof(r.head)
+	tail := unsafe.Offsetof(r.tail)
+	if head < cacheLine || tail-head < cacheLine {
+		t.Errorf("head at %d and tail at %d should be a cache line apart", head, tail)
+	}
+}
+
+func TestSendRecv(t *testing.T) {
+	r := New[int](2)
+	ctx := context.Background()
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			if err := r.Send(ctx, i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		r.Close()
+	}()
+
+	for i := 0; i < 100; i++ {
+		v, err := r.Recv(ctx)
+		if err != nil || v != i {
+			t.Fatalf("Recv = %d, %v, want %d", v, err, i)
+		}
+	}
+	if _, err := r.Recv(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Recv = %v, want ErrClosed once drained", err)
+	}
+	if err := r.Send(ctx, 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send = %v, want ErrClosed", err)
+	}
+}
+
+func TestWaitCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	r := New[int](1)
+	if _, err := r.Recv(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Recv = %v, want context.DeadlineExceeded", err)
+	}
+
+	r.Push(1)
+	if err := r.Send(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// TestStress pushes many items through a small ring and compares a hash
+// of what was sent with a hash of what was received.
+func TestStress(t *testing.T) {
+	n := 2000000
+	if testing.Short() {
+		n = 100000
+	}
+
+	r := New[uint64](64)
+	ctx := context.Background()
+
+	sent := make(chan uint64)
+	go func() {
+		h := fnv.New64a()
+		var b [8]byte
+		for i := 0; i < n; i++ {
+			v := uint64(i) * 0x9e3779b97f4a7c15
+			binary.LittleEndian.PutUint64(b[:], v)
+			h.Write(b[:])
+
+			// Mix both paths
+			if i%3 == 0 {
+				for !r.Push(v) {
+					runtime.Gosched()
+				}
+			} else if err := r.Send(ctx, v); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		r.Close()
+		sent <- h.Sum64()
+	}()
+
+	h := fnv.New64a()
+	var b [8]byte
+	received := 0
+	for {
+		v, err := r.Recv(ctx)
+		if errors.Is(err, ErrClosed) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.LittleEndian.PutUint64(b[:], v)
+		h.Write(b[:])
+		received++
+	}
+
+	if received != n {
+		t.Fatalf("received %d items, want %d", received, n)
+	}
+	if want := <-sent; h.Sum64() != want {
+		t.Error("received items differ from the sent ones")
+	}
+}
+
+func BenchmarkRing(b *testing.B) {
+	r := New[int](1024)
+	ctx := context.Background()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			r.Send(ctx, i)
+		}
+		r.Close()
+	}()
+
+	for {
+		if _, err := r.Recv(ctx); err != nil {
+			return
+		}
+	}
+}
+
+func BenchmarkChannel(b *testing.B) {
+	ch := make(chan int, 1024)
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			ch <- i
+		}
+		close(ch)
+	}()
+
+	for range ch {
+	}
+}
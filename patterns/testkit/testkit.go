@@ -0,0 +1,387 @@
+// Package testkit soak-tests producers, consumers and pools: it drives
+// them with randomized workloads for a while, checks invariants on their
+// Stats as it goes, and reports a diagnostic snapshot when one breaks.
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// Workload generates load. It is called over and over by each of its
+// workers until the run ends, with the worker's own random source.
+// Returning an error other than the run's context error fails the run.
+type Workload func(ctx context.Context, rnd *rand.Rand) error
+
+// Snapshot holds the Stats of every observed component, by name.
+type Snapshot map[string]interface{}
+
+// Invariant checks a Snapshot, returning an error if it does not hold.
+type Invariant func(s Snapshot) error
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithDuration sets how long the workloads run. The default is the
+// TESTKIT_DURATION environment variable, such as "5m", or 2 seconds.
+func WithDuration(d time.Duration) Option {
+	return func(r *Runner) {
+		r.duration = d
+	}
+}
+
+// WithInterval sets how often the invariants are checked. The default is
+// 50ms.
+func WithInterval(d time.Duration) Option {
+	return func(r *Runner) {
+		r.interval = d
+	}
+}
+
+// WithSeed seeds the random sources of the workers, to replay a failed
+// run. The default is the TESTKIT_SEED environment variable, or the time.
+func WithSeed(seed int64) Option {
+	return func(r *Runner) {
+		r.seed = seed
+	}
+}
+
+// WithoutLeakCheck skips checking for goroutines left over once the run
+// is cleaned up.
+func WithoutLeakCheck() Option {
+	return func(r *Runner) {
+		r.leakCheck = false
+	}
+}
+
+// Runner runs a soak test. Register the workloads, observed components,
+// invariants and hooks, then call Run once.
+//
+// A run goes through the Start hooks, the workloads with the invariants
+// checked every interval, the Drain hooks, the final checks, the Cleanup
+// hooks and the leak check.
+type Runner struct {
+	duration  time.Duration
+	interval  time.Duration
+	seed      int64
+	leakCheck bool
+
+	workloads []workload
+	observed  []observed
+	checks    []check
+	finals    []check
+	starts    []func(ctx context.Context) error
+	drains    []func(ctx context.Context) error
+	cleanups  []func()
+}
+
+type workload struct {
+	name    string
+	workers int
+	fn      Workload
+}
+
+type observed struct {
+	name  string
+	stats func() interface{}
+}
+
+type check struct {
+	name string
+	fn   Invariant
+}
+
+// New creates a Runner.
+func New(opts ...Option) *Runner {
+	r := &Runner{
+		duration:  envDuration("TESTKIT_DURATION", 2*time.Second),
+		interval:  50 * time.Millisecond,
+		seed:      envSeed("TESTKIT_SEED"),
+		leakCheck: true,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Seed returns the seed of the run.
+func (r *Runner) Seed() int64 {
+	return r.seed
+}
+
+// Workload runs fn in workers goroutines for the duration of the run.
+func (r *Runner) Workload(name string, workers int, fn Workload) {
+	if workers < 1 {
+		workers = 1
+	}
+	r.workloads = append(r.workloads, workload{name: name, workers: workers, fn: fn})
+}
+
+// Observe adds the value returned by stats, such as a Stats method, to
+// every Snapshot under name. stats must be safe to call concurrently.
+func (r *Runner) Observe(name string, stats func() interface{}) {
+	r.observed = append(r.observed, observed{name: name, stats: stats})
+}
+
+// Invariant checks fn on a Snapshot every interval while the workloads
+// run, and once more after they end.
+func (r *Runner) Invariant(name string, fn Invariant) {
+	r.checks = append(r.checks, check{name: name, fn: fn})
+}
+
+// Final checks fn once, after the workloads end and the Drain hooks
+// return, for what only holds at rest, such as every item produced being
+// consumed.
+func (r *Runner) Final(name string, fn Invariant) {
+	r.finals = append(r.finals, check{name: name, fn: fn})
+}
+
+// Start adds a hook starting the components, such as running a consumer
+// in a goroutine. Hooks run in order when Run begins, after it noted the
+// goroutines already running, so the leak check covers what they start.
+func (r *Runner) Start(fn func(ctx context.Context) error) {
+	r.starts = append(r.starts, fn)
+}
+
+// Drain adds a hook bringing the components to rest once the workloads
+// end, such as closing a producer and waiting for its consumer. Hooks run
+// in order, before the final checks.
+func (r *Runner) Drain(fn func(ctx context.Context) error) {
+	r.drains = append(r.drains, fn)
+}
+
+// Cleanup adds a hook releasing the components after the final checks,
+// such as closing a pool. Hooks run in reverse order, before the leak
+// check, and run even if the run failed.
+func (r *Runner) Cleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+// Snapshot returns the Stats of the observed components now.
+func (r *Runner) Snapshot() Snapshot {
+	s := make(Snapshot, len(r.observed))
+	for _, o := range r.observed {
+		s[o.name] = o.stats()
+	}
+	return s
+}
+
+// Run runs the workloads for the duration, or until ctx is done, checking
+// the invariants every interval. It then drains the components, runs the
+// final checks, cleans up and looks for leaked goroutines. It returns a
+// *Failure for the first thing that went wrong, or nil.
+func (r *Runner) Run(ctx context.Context) (err error) {
+	ignore := goleak.IgnoreCurrent()
+	start := time.Now()
+	last := r.Snapshot()
+
+	fail := func(phase, name string, cause error) error {
+		return &Failure{
+			Seed:       r.seed,
+			Elapsed:    time.Since(start),
+			Phase:      phase,
+			Check:      name,
+			Err:        cause,
+			Snapshot:   last,
+			Goroutines: goroutines(),
+		}
+	}
+
+	defer func() {
+		for i := len(r.cleanups) - 1; i >= 0; i-- {
+			r.cleanups[i]()
+		}
+		if err == nil && r.leakCheck {
+			if leak := goleak.Find(ignore); leak != nil {
+				err = fail("cleanup", "goroutine leak", leak)
+			}
+		}
+	}()
+
+	for _, start := range r.starts {
+		if err := start(context.WithoutCancel(ctx)); err != nil {
+			return fail("start", "start", err)
+		}
+	}
+
+	// Workloads
+	runCtx, cancel := context.WithTimeout(ctx, r.duration)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i, w := range r.workloads {
+		for j := 0; j < w.workers; j++ {
+			wg.Add(1)
+			rnd := rand.New(rand.NewSource(r.seed + int64(i)*1000 + int64(j)))
+			go func(w workload) {
+				defer wg.Done()
+				for runCtx.Err() == nil {
+					if err := w.fn(runCtx, rnd); err != nil && runCtx.Err() == nil {
+						select {
+						case errc <- fmt.Errorf("workload %s: %w", w.name, err):
+						default:
+						}
+						cancel()
+						return
+					}
+				}
+			}(w)
+		}
+	}
+
+	// Invariants, every interval until the workloads end
+	var broken error
+	ticker := time.NewTicker(r.interval)
+loop:
+	for {
+		select {
+		case <-runCtx.Done():
+			break loop
+		case <-ticker.C:
+			last = r.Snapshot()
+			if name, err := r.check(r.checks, last); err != nil {
+				broken = fail("run", name, err)
+				cancel()
+				break loop
+			}
+		}
+	}
+	ticker.Stop()
+	wg.Wait()
+
+	if broken != nil {
+		return broken
+	}
+	select {
+	case err := <-errc:
+		return fail("run", "workload", err)
+	default:
+	}
+
+	// Drain, then check at rest
+	for _, drain := range r.drains {
+		if err := drain(context.WithoutCancel(ctx)); err != nil {
+			last = r.Snapshot()
+			return fail("drain", "drain", err)
+		}
+	}
+	last = r.Snapshot()
+	if name, err := r.check(r.checks, last); err != nil {
+		return fail("final", name, err)
+	}
+	if name, err := r.check(r.finals, last); err != nil {
+		return fail("final", name, err)
+	}
+	return nil
+}
+
+// check runs checks on s, returning the name and error of the first that
+// fails.
+func (r *Runner) check(checks []check, s Snapshot) (string, error) {
+	for _, c := range checks {
+		if err := c.fn(s); err != nil {
+			return c.name, err
+		}
+	}
+	return "", nil
+}
+
+// RunT runs the soak test as part of t, failing it with the diagnostic
+// dump. It is skipped with -short.
+func (r *Runner) RunT(t testing.TB) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("soak test skipped in short mode")
+	}
+
+	t.Logf("soak test for %v, seed %d (TESTKIT_SEED=%d to replay)", r.duration, r.seed, r.seed)
+	if err := r.Run(context.Background()); err != nil {
+		var f *Failure
+		if errors.As(err, &f) {
+			t.Fatal(f.Dump())
+		}
+		t.Fatal(err)
+	}
+}
+
+// Failure describes what broke in a run, and the state it broke in.
+type Failure struct {
+	Seed       int64         // Seed replaying the run
+	Elapsed    time.Duration // Time into the run
+	Phase      string        // "start", "run", "drain", "final" or "cleanup"
+	Check      string        // Invariant, or what else failed
+	Err        error         // What went wrong
+	Snapshot   Snapshot      // Stats last taken
+	Goroutines string        // Stacks of all goroutines
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("testkit: %s failed during %s after %v (seed %d): %v", f.Check, f.Phase, f.Elapsed, f.Seed, f.Err)
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Dump returns the failure with the snapshot, one component per line, and
+// the goroutine stacks.
+func (f *Failure) Dump() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, f.Error())
+
+	names := make([]string, 0, len(f.Snapshot))
+	for name := range f.Snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(&b, "\nsnapshot:")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s: %+v\n", name, f.Snapshot[name])
+	}
+	fmt.Fprintf(&b, "\ngoroutines:\n%s", f.Goroutines)
+	return b.String()
+}
+
+// goroutines returns the stacks of all goroutines.
+func goroutines() string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// envDuration reads a duration from the environment variable name.
+func envDuration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// envSeed reads a seed from the environment variable name, or makes one
+// from the time.
+func envSeed(name string) int64 {
+	if seed, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil {
+		return seed
+	}
+	return time.Now().UnixNano()
+}
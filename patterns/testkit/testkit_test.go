@@ -0,0 +1,236 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fast returns options for a short run.
+func fast(opts ...Option) []Option {
+	return append([]Option{WithDuration(100 * time.Millisecond), WithInterval(5 * time.Millisecond)}, opts...)
+}
+
+func TestRun(t *testing.T) {
+	var in, out atomic.Int64
+	r := New(fast()...)
+
+	r.Workload("pipe", 4, func(ctx context.Context, rnd *rand.Rand) error {
+		in.Add(1)
+		time.Sleep(time.Duration(rnd.Intn(100)) * time.Microsecond)
+		out.Add(1)
+		return nil
+	})
+	r.Observe("pipe", func() interface{} {
+		return [2]int64{in.Load(), out.Load()}
+	})
+
+	checks := 0
+	r.Invariant("out <= in", func(s Snapshot) error {
+		checks++
+		c := s["pipe"].([2]int64)
+		if c[1] > c[0] {
+			return fmt.Errorf("out %d > in %d", c[1], c[0])
+		}
+		return nil
+	})
+	r.Final("in == out", func(s Snapshot) error {
+		if c := s["pipe"].([2]int64); c[0] != c[1] {
+			return fmt.Errorf("in %d, out %d", c[0], c[1])
+		}
+		return nil
+	})
+
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if in.Load() == 0 {
+		t.Error("workload never ran")
+	}
+	if checks < 2 {
+		t.Errorf("invariant checked %d times", checks)
+	}
+}
+
+func TestInvariantFailure(t *testing.T) {
+	var n atomic.Int64
+	r := New(fast(WithSeed(42), WithDuration(time.Minute))...)
+
+	r.Workload("count", 1, func(ctx context.Context, rnd *rand.Rand) error {
+		n.Add(1)
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	r.Observe("counter", func() interface{} { return n.Load() })
+	r.Invariant("below 10", func(s Snapshot) error {
+		if v := s["counter"].(int64); v >= 10 {
+			return fmt.Errorf("counter at %d", v)
+		}
+		return nil
+	})
+	cleaned := false
+	r.Cleanup(func() { cleaned = true })
+
+	// The run stops at the failure, long before its duration
+	start := time.Now()
+	err := r.Run(context.Background())
+	if time.Since(start) > 10*time.Second {
+		t.Error("run did not stop at the failure")
+	}
+
+	var f *Failure
+	if !errors.As(err, &f) {
+		t.Fatalf("Run = %v, want a *Failure", err)
+	}
+	if f.Check != "below 10" || f.Phase != "run" || f.Seed != 42 {
+		t.Errorf("failure %+v", f)
+	}
+	if v := f.Snapshot["counter"].(int64); v < 10 {
+		t.Errorf("snapshot has counter %d, want the one that failed", v)
+	}
+	if !cleaned {
+		t.Error("cleanup did not run after the failure")
+	}
+
+	dump := f.Dump()
+	for _, want := range []string{"below 10", "seed 42", "counter:", "goroutine "} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump does not contain %q:\n%s", want, dump)
+		}
+	}
+}
+
+func TestWorkloadError(t *testing.T) {
+	boom := errors.New("boom")
+	r := New(fast()...)
+	r.Workload("fails", 2, func(ctx context.Context, rnd *rand.Rand) error {
+		return boom
+	})
+
+	err := r.Run(context.Background())
+	var f *Failure
+	if !errors.As(err, &f) || f.Check != "workload" || !errors.Is(err, boom) {
+		t.Fatalf("Run = %v, want the workload error", err)
+	}
+	if !strings.Contains(err.Error(), "workload fails") {
+		t.Errorf("error %q does not name the workload", err)
+	}
+}
+
+func TestDrainBeforeFinal(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) {
+		mu.Lock()
+		order = append(order, s)
+		mu.Unlock()
+	}
+
+	r := New(fast()...)
+	r.Workload("idle", 1, func(ctx context.Context, rnd *rand.Rand) error {
+		<-ctx.Done()
+		return nil
+	})
+	r.Drain(func(ctx context.Context) error {
+		record("drain")
+		return nil
+	})
+	r.Final("final", func(Snapshot) error {
+		record("final")
+		return nil
+	})
+	r.Cleanup(func() { record("cleanup 1") })
+	r.Cleanup(func() { record("cleanup 2") })
+
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ","); got != "drain,final,cleanup 2,cleanup 1" {
+		t.Errorf("ran %s", got)
+	}
+}
+
+func TestFinalFailure(t *testing.T) {
+	r := New(fast()...)
+	r.Final("never", func(Snapshot) error {
+		return errors.New("does not hold")
+	})
+
+	var f *Failure
+	if err := r.Run(context.Background()); !errors.As(err, &f) || f.Phase != "final" || f.Check != "never" {
+		t.Fatalf("Run = %v, want the final check to fail", err)
+	}
+}
+
+func TestLeakCheck(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	r := New(fast()...)
+	r.Drain(func(ctx context.Context) error {
+		go func() {
+			<-release
+		}()
+		return nil
+	})
+
+	var f *Failure
+	if err := r.Run(context.Background()); !errors.As(err, &f) || f.Check != "goroutine leak" {
+		t.Fatalf("Run = %v, want a leak", err)
+	}
+
+	r = New(fast(WithoutLeakCheck())...)
+	r.Drain(func(ctx context.Context) error {
+		go func() {
+			<-release
+		}()
+		return nil
+	})
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run without the leak check = %v", err)
+	}
+}
+
+func TestSeedReplays(t *testing.T) {
+	draws := func(seed int64) []int {
+		var mu sync.Mutex
+		var got []int
+		r := New(fast(WithSeed(seed))...)
+		r.Workload("draw", 1, func(ctx context.Context, rnd *rand.Rand) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if len(got) < 5 {
+				got = append(got, rnd.Int())
+			}
+			return nil
+		})
+		if err := r.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	a, b := draws(7), draws(7)
+	if fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Errorf("same seed drew %v and %v", a, b)
+	}
+	if c := draws(8); fmt.Sprint(a) == fmt.Sprint(c) {
+		t.Errorf("other seed drew the same %v", c)
+	}
+}
+
+func TestEnvDefaults(t *testing.T) {
+	t.Setenv("TESTKIT_DURATION", "3m")
+	t.Setenv("TESTKIT_SEED", "123")
+
+	r := New()
+	if r.duration != 3*time.Minute || r.Seed() != 123 {
+		t.Errorf("duration %v, seed %d", r.duration, r.Seed())
+	}
+}
@@ -0,0 +1,80 @@
+package watchdog
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+)
+
+// ProducerProbe reports the progress of p: the items it wrote, and those
+// waiting in its buffer.
+func ProducerProbe(p *producerconsumer.Producer) Probe {
+	return ProbeFunc(func() Progress {
+		s := p.Stats()
+		return Progress{Processed: s.Produced, Pending: s.Buffered, LastItem: s.LastItem}
+	})
+}
+
+// ConsumerProbe reports the progress of c: the items it processed, those
+// it is processing, and those waiting in its buffer.
+func ConsumerProbe(c *producerconsumer.Consumer) Probe {
+	return ProbeFunc(func() Progress {
+		s := c.Stats()
+		return Progress{Processed: s.Processed, Pending: s.Buffered, Active: s.Active, LastItem: s.LastItem}
+	})
+}
+
+// Meter counts the items passing through a Tap. It implements Probe.
+type Meter struct {
+	in     func() int
+	passed atomic.Uint64
+	last   atomic.Int64 // Unix nanoseconds of the latest item
+}
+
+// Progress reports the items passed, and those buffered in the tapped
+// channel, waiting to pass.
+func (m *Meter) Progress() Progress {
+	p := Progress{Processed: m.passed.Load()}
+	if m.in != nil {
+		p.Pending = m.in()
+	}
+	if n := m.last.Load(); n != 0 {
+		p.LastItem = time.Unix(0, n)
+	}
+	return p
+}
+
+// Tap forwards in to the returned channel, counting the items on the
+// returned Meter, so a pipeline stage can be watched. Tap the buffered
+// input of a stage: its waiting items are Pending, and the items the stage
+// took are Processed. The output is closed when in is closed or ctx is
+// done.
+func Tap[T any](ctx context.Context, in <-chan T) (<-chan T, *Meter) {
+	m := &Meter{in: func() int { return len(in) }}
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+					m.last.Store(time.Now().UnixNano())
+					m.passed.Add(1)
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, m
+}
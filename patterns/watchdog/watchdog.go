@@ -0,0 +1,269 @@
+// Package watchdog detects pipelines that stopped making progress: items
+// are waiting, the stages are running, but nothing comes out the end.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/window"
+)
+
+// Progress is what a stage reports to the watchdog.
+type Progress struct {
+
+	// Processed counts the items the stage handled so far.
+	Processed uint64
+
+	// Pending is the number of items waiting for the stage.
+	Pending int
+
+	// Active is the number of items the stage is working on.
+	Active int
+
+	// LastItem is when the stage last handled an item, if it knows.
+	LastItem time.Time
+}
+
+// Probe reports the progress of a stage.
+type Probe interface {
+	Progress() Progress
+}
+
+// ProbeFunc adapts a function to a Probe.
+type ProbeFunc func() Progress
+
+// Progress calls f.
+func (f ProbeFunc) Progress() Progress {
+	return f()
+}
+
+// State is the verdict of a check.
+type State int
+
+const (
+	// Healthy means items came out the end recently, or have not waited
+	// long.
+	Healthy State = iota
+
+	// Idle means nothing progressed because no items are waiting.
+	Idle
+
+	// Stalled means items have waited for the timeout while nothing came
+	// out the end.
+	Stalled
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Idle:
+		return "idle"
+	case Stalled:
+		return "stalled"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// StageSnapshot is the progress of one stage at a check.
+type StageSnapshot struct {
+	Name string
+	Progress
+
+	// Stuck is set when items waited for the stage for the timeout and it
+	// handled none.
+	Stuck bool
+}
+
+// Diagnosis is the outcome of a check.
+type Diagnosis struct {
+	State State
+
+	// Stage names the stage the stall is blamed on: the last stuck one,
+	// as the stages before it are held up behind it. It is empty unless
+	// Stalled.
+	Stage string
+
+	// Since is when the last stage last made progress, or when items
+	// started waiting if later.
+	Since time.Time
+
+	// Stages has the progress of every stage, in the order watched.
+	Stages []StageSnapshot
+}
+
+// Option configures a Watchdog.
+type Option func(*Watchdog)
+
+// WithInterval sets how often Run checks. The default is a quarter of the
+// timeout.
+func WithInterval(d time.Duration) Option {
+	return func(w *Watchdog) {
+		w.interval = d
+	}
+}
+
+// WithClock sets the clock used to time stalls, for tests.
+func WithClock(c window.Clock) Option {
+	return func(w *Watchdog) {
+		w.clock = c
+	}
+}
+
+// realClock reads the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// stage is a watched stage and what the watchdog saw of it.
+type stage struct {
+	name      string
+	probe     Probe
+	processed uint64
+	changed   time.Time
+}
+
+// Watchdog checks watched stages and reports a stall once per episode.
+type Watchdog struct {
+	timeout  time.Duration
+	onStall  func(Diagnosis)
+	interval time.Duration
+	clock    window.Clock
+
+	// mu guards the fields below.
+	mu      sync.Mutex
+	stages  []*stage
+	waiting time.Time // When items started waiting, zero if none are
+	stalled bool
+}
+
+// New creates a Watchdog calling onStall when items wait for timeout
+// while the last stage handles none.
+func New(timeout time.Duration, onStall func(Diagnosis), opts ...Option) *Watchdog {
+	w := &Watchdog{
+		timeout:  timeout,
+		onStall:  onStall,
+		interval: timeout / 4,
+		clock:    realClock{},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Watch adds a stage. Stages must be added from the first to the last:
+// the progress of the last one is the progress of the pipeline.
+func (w *Watchdog) Watch(name string, p Probe) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stages = append(w.stages, &stage{
+		name:      name,
+		probe:     p,
+		processed: p.Progress().Processed,
+		changed:   w.clock.Now(),
+	})
+}
+
+// Check probes the stages and returns the diagnosis. It calls onStall
+// when a stall starts; the next stall is reported only after progress
+// resumes or the items are gone.
+func (w *Watchdog) Check() Diagnosis {
+	w.mu.Lock()
+
+	now := w.clock.Now()
+	d := Diagnosis{Stages: make([]StageSnapshot, len(w.stages))}
+
+	pending := false
+	for i, s := range w.stages {
+		p := s.probe.Progress()
+		if p.Processed != s.processed {
+			s.processed = p.Processed
+			s.changed = now
+		}
+		d.Stages[i] = StageSnapshot{Name: s.name, Progress: p}
+		pending = pending || p.Pending > 0
+	}
+
+	if !pending {
+		w.waiting = time.Time{}
+		w.stalled = false
+		d.State = Idle
+		if len(w.stages) > 0 {
+			d.Since = w.stages[len(w.stages)-1].changed
+		}
+		w.mu.Unlock()
+		return d
+	}
+	if w.waiting.IsZero() {
+		w.waiting = now
+	}
+
+	// A stage is stuck if it handled nothing since items started waiting
+	for i, s := range w.stages {
+		since := later(s.changed, w.waiting)
+		if d.Stages[i].Pending > 0 && now.Sub(since) >= w.timeout {
+			d.Stages[i].Stuck = true
+			d.Stage = s.name
+		}
+	}
+
+	d.Since = later(w.stages[len(w.stages)-1].changed, w.waiting)
+	if now.Sub(d.Since) < w.timeout {
+		w.stalled = false
+		d.State = Healthy
+		d.Stage = ""
+		w.mu.Unlock()
+		return d
+	}
+
+	// Stalled, though no single stage is stuck: blame the last with items
+	d.State = Stalled
+	if d.Stage == "" {
+		for _, s := range d.Stages {
+			if s.Pending > 0 {
+				d.Stage = s.Name
+			}
+		}
+	}
+
+	report := !w.stalled
+	w.stalled = true
+	w.mu.Unlock()
+
+	if report && w.onStall != nil {
+		w.onStall(d)
+	}
+	return d
+}
+
+// Run checks every interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// later returns the later of a and b.
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,218 @@
+package watchdog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	producerconsumer "github.com/Alan-333333/go-channel-patterns/patterns/producer-consumer"
+	"github.com/Alan-333333/go-channel-patterns/patterns/queue"
+	"go.uber.org/goleak"
+)
+
+// fakeClock is a clock moved by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// waitFor polls cond until it holds, failing after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWedgedConsumer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	// The producer fills the queue shared with the consumer with 5 items
+	q := queue.New[interface{}](10)
+	p := producerconsumer.NewProducer(0, 1)
+	p.SetQueue(q)
+	n := 0
+	p.ProduceFunc = func() (interface{}, error) {
+		if n++; n > 5 {
+			return nil, nil
+		}
+		return n, nil
+	}
+	p.Run(context.Background())
+
+	// The consumer wedges on the first item
+	c := producerconsumer.NewConsumer(0, 1)
+	c.Notify(func(string) {})
+	c.SetQueue(q)
+	release := make(chan struct{})
+	c.ConsumeFunc = func(interface{}) error {
+		<-release
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Run(context.Background())
+		close(done)
+	}()
+	waitFor(t, func() bool { return c.Stats().Active == 1 })
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var stalls []Diagnosis
+	w := New(10*time.Second, func(d Diagnosis) { stalls = append(stalls, d) }, WithClock(clock))
+	w.Watch("producer", ProducerProbe(p))
+	w.Watch("consumer", ConsumerProbe(c))
+
+	if d := w.Check(); d.State != Healthy {
+		t.Fatalf("State = %v before the timeout, want healthy", d.State)
+	}
+
+	clock.Add(11 * time.Second)
+	d := w.Check()
+	if d.State != Stalled || d.Stage != "consumer" {
+		t.Fatalf("diagnosis = %v at %q, want stalled at consumer", d.State, d.Stage)
+	}
+	consumer := d.Stages[1]
+	if !consumer.Stuck || consumer.Active != 1 || consumer.Pending != 4 || consumer.Processed != 0 {
+		t.Errorf("consumer snapshot = %+v, want stuck with 1 active and 4 pending", consumer)
+	}
+	if len(stalls) != 1 {
+		t.Fatalf("onStall called %d times, want 1", len(stalls))
+	}
+
+	// A stall is reported once
+	clock.Add(time.Minute)
+	w.Check()
+	if len(stalls) != 1 {
+		t.Errorf("onStall called %d times for one stall, want 1", len(stalls))
+	}
+
+	// Once unwedged the consumer drains the queue and the pipeline idles
+	close(release)
+	waitFor(t, func() bool { return c.Stats().Processed == 5 })
+	if d := w.Check(); d.State != Idle {
+		t.Errorf("State = %v after draining, want idle", d.State)
+	}
+
+	c.Close()
+	<-done
+}
+
+func TestIdleIsNotStalled(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var progress Progress
+	w := New(time.Second, func(Diagnosis) { t.Error("idle pipeline reported as stalled") }, WithClock(clock))
+	w.Watch("stage", ProbeFunc(func() Progress { return progress }))
+
+	// No input for a long time
+	clock.Add(time.Hour)
+	if d := w.Check(); d.State != Idle {
+		t.Fatalf("State = %v, want idle", d.State)
+	}
+
+	// Input arriving after a long idle time gets the full timeout
+	progress.Pending = 3
+	if d := w.Check(); d.State != Healthy {
+		t.Fatalf("State = %v when input arrives, want healthy", d.State)
+	}
+	clock.Add(500 * time.Millisecond)
+	progress.Processed = 1
+	clock.Add(900 * time.Millisecond)
+	if d := w.Check(); d.State != Healthy {
+		t.Errorf("State = %v while progressing, want healthy", d.State)
+	}
+}
+
+func TestStallRearms(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	progress := Progress{Pending: 1}
+	stalls := 0
+	w := New(time.Second, func(Diagnosis) { stalls++ }, WithClock(clock))
+	w.Watch("stage", ProbeFunc(func() Progress { return progress }))
+
+	w.Check()
+	clock.Add(2 * time.Second)
+	w.Check()
+
+	// Progress ends the stall, a new one is reported again
+	progress.Processed++
+	if d := w.Check(); d.State != Healthy {
+		t.Fatalf("State = %v after progress, want healthy", d.State)
+	}
+	clock.Add(2 * time.Second)
+	w.Check()
+	if stalls != 2 {
+		t.Errorf("onStall called %d times, want 2", stalls)
+	}
+}
+
+func TestTap(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan int, 10)
+	tapped, meter := Tap(ctx, in)
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var stalled Diagnosis
+	w := New(time.Second, func(d Diagnosis) { stalled = d }, WithClock(clock))
+	w.Watch("map", meter)
+
+	// The stage takes one item, then wedges
+	for i := 0; i < 5; i++ {
+		in <- i
+	}
+	<-tapped
+	waitFor(t, func() bool { return meter.Progress().Pending == 3 })
+
+	w.Check()
+	clock.Add(2 * time.Second)
+	if d := w.Check(); d.State != Stalled || stalled.Stage != "map" {
+		t.Fatalf("diagnosis = %v at %q, want stalled at map", d.State, stalled.Stage)
+	}
+	if p := stalled.Stages[0]; p.Processed != 1 || p.LastItem.IsZero() {
+		t.Errorf("map snapshot = %+v, want 1 processed", p)
+	}
+
+	close(in)
+	for range tapped {
+	}
+}
+
+func TestRun(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	stalled := make(chan Diagnosis, 1)
+	w := New(20*time.Millisecond, func(d Diagnosis) { stalled <- d }, WithInterval(5*time.Millisecond))
+	w.Watch("stage", ProbeFunc(func() Progress { return Progress{Pending: 1} }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	if d := <-stalled; d.Stage != "stage" {
+		t.Errorf("stalled at %q, want stage", d.Stage)
+	}
+	cancel()
+	<-done
+}
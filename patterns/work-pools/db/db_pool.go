@@ -1,138 +1,320 @@
 package dbpool
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"sync"
 	"time"
 
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	"github.com/Alan-333333/go-channel-patterns/patterns/circuitbreaker"
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
 	_ "github.com/go-sql-driver/mysql"
 )
 
-var once sync.Once
-
 // DBConn 封装数据库连接
 type DBConn struct {
 	DB        *sql.DB
 	HeartBeat time.Time
 	TimeOut   time.Duration
+
+	// epoch is the quarantine epoch the connection was last known good in.
+	epoch uint64
 }
 
-// ConnectionPool manages a pool of connections.
+// ConnectionPool manages a pool of connections. It is a typed wrapper over
+// generic.Pool.
 type ConnectionPool struct {
 
-	// conns is the pool of connections.
-	conns chan *DBConn
+	// pool holds the connections.
+	pool *generic.Pool[*DBConn]
 
 	// maxConnections is the maximum number of connections in the pool.
 	maxConnections int
 
-	// minConnections is the minimum number of connections in the pool.
+	// minConnections is the minimum number of idle connections in the pool.
 	minConnections int
 
 	// waitTimeout is the timeout for getting a connection.
 	waitTimeout time.Duration
 
+	// clock times heartbeats, expiry and dial retries.
+	clock clock.Clock
+
+	// dialLimiter paces every OpenConnection call, if set.
+	dialLimiter ratelimit.Limiter
+
+	// healthCheck is the check of Check. It defaults to a ping.
+	healthCheck func(*DBConn) error
+
 	// OpenConnection opens a new connection.
 	OpenConnection func() (*DBConn, error)
 
-	// cleanupTicker ticks periodically for cleaning up expired connections.
-	cleanupTicker *time.Ticker
+	// Breaker guards OpenConnection if set, so a failing database is not
+	// dialed over and over.
+	Breaker *circuitbreaker.Breaker
+
+	// DialRetries is how many times a failed OpenConnection is tried
+	// again, waiting DialBackoff in between. Zero means no retries.
+	// Retries stop when the Breaker is open.
+	DialRetries int
+
+	// DialBackoff paces the retries. Each dial uses its own copy.
+	DialBackoff backoff.Backoff
+
+	// quarantine tracks failovers of the database.
+	quarantine quarantine
+}
+
+// Stats is a snapshot of the pool's gauges and counters.
+type Stats struct {
+
+	// Idle is the number of connections waiting in the pool.
+	Idle int
+
+	// InUse is the number of connections acquired and not yet released.
+	InUse int
+
+	// Waiters is the number of callers blocked in Acquire.
+	Waiters int
+
+	// AcquireTimeouts counts Acquire calls that timed out.
+	AcquireTimeouts uint64
+
+	// Dials counts connections opened.
+	Dials uint64
+
+	// ExpiredClosed counts connections closed because they expired or
+	// failed their check after a quarantine.
+	ExpiredClosed uint64
+
+	// Quarantined tells whether the pool is quarantined.
+	Quarantined bool
+
+	// Quarantines counts the times the pool entered quarantine.
+	Quarantines uint64
+}
+
+// Option configures a ConnectionPool.
+type Option func(*ConnectionPool)
+
+// WithClock sets the clock timing heartbeats, expiry, dial retries and the
+// cleanup. The default is the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(p *ConnectionPool) {
+		p.clock = c
+	}
 }
 
-// New creates a new ConnectionPool.
-func New(maxConnections, minConnections int, waitTimeout time.Duration) *ConnectionPool {
+// WithDialLimiter makes every OpenConnection call, whether by Open, an
+// Acquire growing the pool or the cleanup, wait for l first. Share l
+// between pools to throttle the dials of the whole process, so replicas
+// restarting together do not flood the database with handshakes. The wait
+// ends with the context of the dial.
+func WithDialLimiter(l ratelimit.Limiter) Option {
+	return func(p *ConnectionPool) {
+		p.dialLimiter = l
+	}
+}
 
-	return &ConnectionPool{
+// WithHealthCheck replaces the ping of Check with check, which returns an
+// error for an unhealthy connection, such as a query the database must
+// answer.
+func WithHealthCheck(check func(*DBConn) error) Option {
+	return func(p *ConnectionPool) {
+		p.healthCheck = check
+	}
+}
 
-		// Initialize the pool.
-		conns: make(chan *DBConn, maxConnections),
+// New creates a new ConnectionPool. Connections are opened on demand, up
+// to maxConnections, and Open keeps minConnections idle.
+func New(maxConnections, minConnections int, waitTimeout time.Duration, opts ...Option) *ConnectionPool {
 
-		// Set config fields.
+	p := &ConnectionPool{
 		maxConnections: maxConnections,
 		minConnections: minConnections,
 		waitTimeout:    waitTimeout,
+		clock:          clock.New(),
+		healthCheck:    ping,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+
+	p.pool = generic.New(generic.Config[*DBConn]{
+		Factory: func(ctx context.Context) (*DBConn, error) {
+
+			// Only the recovery dials a quarantined database
+			if p.Quarantined() {
+				return nil, ErrPoolQuarantined
+			}
+
+			conn, err := p.dial(ctx)
+			if ctx.Err() == nil {
+				p.recordHealth(err == nil)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if conn.HeartBeat.IsZero() {
+				conn.HeartBeat = p.clock.Now()
+			}
+			conn.epoch = p.quarantine.epoch.Load()
+			return conn, nil
+		},
+		Validate: func(conn *DBConn) bool {
+			return !p.isConnectionExpired(conn) && p.revalidate(conn)
+		},
+		Destroy:     p.closeConn,
+		MaxSize:     maxConnections,
+		MinIdle:     minConnections,
+		WaitTimeout: waitTimeout,
+		Clock:       p.clock,
+	})
+	return p
 }
 
-// Open initializes the connection pool.
+// Open opens minConnections connections and starts cleaning up expired
+// connections every minute.
 func (p *ConnectionPool) Open() error {
+	return p.pool.Open(context.Background())
+}
 
-	// Open maximum connections.
-	for i := 0; i < p.maxConnections; i++ {
-
-		conn, err := p.OpenConnection()
-		if err != nil {
-			return err
-		}
-		if conn.HeartBeat.IsZero() {
-			conn.HeartBeat = time.Now()
-		}
-		p.conns <- conn
+// Acquire retrieves a connection from the pool. Expired idle connections
+// are closed and replaced. It fails with ErrPoolQuarantined while the pool
+// is quarantined, unless the quarantine blocks.
+func (p *ConnectionPool) Acquire() (*DBConn, error) {
+	ctx := context.Background()
+	if p.waitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.waitTimeout)
+		defer cancel()
 	}
+	return p.AcquireContext(ctx)
+}
 
-	// Start a goroutine to clean up expired connections periodically.
-	p.cleanupTicker = time.NewTicker(time.Minute)
-	go func() {
-		for range p.cleanupTicker.C {
-			p.Cleaner()
-		}
-	}()
+// AcquireContext is like Acquire but waits until ctx is done instead of
+// the wait timeout.
+func (p *ConnectionPool) AcquireContext(ctx context.Context) (*DBConn, error) {
+	if err := p.admit(ctx, p.quarantine.cfg.Block); err != nil {
+		return nil, err
+	}
+	return p.pool.AcquireContext(ctx)
+}
 
-	return nil
+// TryAcquire retrieves a connection without waiting, returning
+// generic.ErrExhausted if all are in use, or ErrPoolQuarantined while the
+// pool is quarantined.
+func (p *ConnectionPool) TryAcquire() (*DBConn, error) {
+	if err := p.admit(context.Background(), false); err != nil {
+		return nil, err
+	}
+	return p.pool.TryAcquire()
 }
 
-// Acquire retrieves a connection from the pool.
-func (p *ConnectionPool) Acquire() (*DBConn, error) {
+// WithConn runs fn with a pooled connection and releases it afterwards,
+// so the connection cannot leak. It waits for a connection until ctx is
+// done or the wait timeout. A connection whose use panicked is discarded.
+func (p *ConnectionPool) WithConn(ctx context.Context, fn func(conn *DBConn) error) error {
 
-	// Try to get a connection before timeout.
-	select {
+	acquireCtx := ctx
+	if p.waitTimeout > 0 {
+		var cancel context.CancelFunc
+		acquireCtx, cancel = context.WithTimeout(ctx, p.waitTimeout)
+		defer cancel()
+	}
+
+	conn, err := p.AcquireContext(acquireCtx)
+	if err != nil {
+		return err
+	}
 
-	case conn := <-p.conns:
-		// Check connection health before reusing it.
-		if p.isConnectionExpired(conn) {
-			conn.DB.Close()
-			return nil, errors.New("connection expired")
+	defer func() {
+		if r := recover(); r != nil {
+			p.Discard(conn)
+			panic(r)
 		}
-		return conn, nil
+		p.Release(conn)
+	}()
 
-	case <-time.After(p.waitTimeout):
-		return nil, fmt.Errorf("timeout waiting for connection")
-	}
+	return fn(conn)
 }
 
 // Check if connection has expired.
 func (p *ConnectionPool) isConnectionExpired(conn *DBConn) bool {
-	return conn.HeartBeat.Add(conn.TimeOut).Before(time.Now())
+	return conn.HeartBeat.Add(conn.TimeOut).Before(p.clock.Now())
 }
 
 // Release puts a connection back into the pool.
 func (p *ConnectionPool) Release(conn *DBConn) {
 
 	// Mark connection as active again before releasing.
-	conn.HeartBeat = time.Now()
+	conn.HeartBeat = p.clock.Now()
 
-	p.conns <- conn
+	p.pool.Release(conn)
 }
 
-// Close closes the connection pool.
-func (p *ConnectionPool) Close() {
+// Discard closes a broken connection instead of putting it back.
+func (p *ConnectionPool) Discard(conn *DBConn) {
+	p.pool.Discard(conn)
+}
 
-	// Stop the cleaner.
-	p.cleanupTicker.Stop()
+// DetectLeaks reports connections held longer than threshold to onLeak,
+// with the stack that acquired them, during cleanup.
+func (p *ConnectionPool) DetectLeaks(threshold time.Duration, onLeak func(generic.Leak[*DBConn])) {
+	p.pool.DetectLeaks(threshold, onLeak)
+}
 
-	// Close all connections.
-	once.Do(func() {
-		close(p.conns)
-	})
+// Stats returns a snapshot of the pool's gauges and counters. It reads
+// atomics only, so it is safe to call from metrics scrapers at any time.
+func (p *ConnectionPool) Stats() Stats {
+	s := p.pool.Stats()
+	return Stats{
+		Idle:            s.Idle,
+		InUse:           s.InUse,
+		Waiters:         s.Waiters,
+		AcquireTimeouts: s.AcquireTimeouts,
+		Dials:           s.Dials,
+		ExpiredClosed:   s.Expired,
+		Quarantined:     p.quarantine.active.Load(),
+		Quarantines:     p.quarantine.count.Load(),
+	}
+}
 
-	for conn := range p.conns {
-		conn.DB.Close()
+// StatsMap returns Stats as named values, for publishing through expvar.
+func (p *ConnectionPool) StatsMap() map[string]int64 {
+	s := p.Stats()
+	var quarantined int64
+	if s.Quarantined {
+		quarantined = 1
+	}
+	return map[string]int64{
+		"idle":             int64(s.Idle),
+		"in_use":           int64(s.InUse),
+		"waiters":          int64(s.Waiters),
+		"acquire_timeouts": int64(s.AcquireTimeouts),
+		"dials":            int64(s.Dials),
+		"expired_closed":   int64(s.ExpiredClosed),
+		"quarantined":      quarantined,
+		"quarantines":      int64(s.Quarantines),
 	}
 }
 
-// CleanUpClosedConnections closes expired connections and
+// Close closes the idle connections and waits up to the wait timeout for
+// those in use, which are closed when released. It ends a quarantine.
+func (p *ConnectionPool) Close() {
+
+	p.closeQuarantine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.waitTimeout)
+	defer cancel()
+
+	p.pool.Close(ctx)
+}
+
+// Cleaner closes expired connections and
 // opens new connections to maintain min connections.
 func (p *ConnectionPool) Cleaner() {
 	// closes expired connections.
@@ -142,49 +324,75 @@ func (p *ConnectionPool) Cleaner() {
 	p.MaintainMinConnections()
 }
 
-// CloseExpiredConnections closes expired connections.
+// CloseExpiredConnections closes expired idle connections.
 func (p *ConnectionPool) CloseExpiredConnections() {
+	p.pool.EvictExpired()
+}
 
-	const timePerConn = 10 * time.Millisecond
-
-	var timeout = time.Duration(len(p.conns)) * timePerConn
+// MaintainMinConnections opens connections if below min.
+func (p *ConnectionPool) MaintainMinConnections() {
+	p.pool.Fill(context.Background())
+}
 
-	newConns := make(chan *DBConn)
-	// Loop to close expired connections
-	for {
-		select {
-		case conn := <-p.conns:
-			if !conn.HeartBeat.Add(conn.TimeOut).Before(time.Now()) {
-				newConns <- conn
-			} else {
-				conn.DB.Close()
-			}
+// dial opens a connection, retrying up to DialRetries times.
+func (p *ConnectionPool) dial(ctx context.Context) (*DBConn, error) {
 
-		case <-time.After(timeout):
-			// over time return
-			p.conns = newConns
-			return
+	b := p.DialBackoff
+	for retry := 0; ; retry++ {
+		conn, err := p.dialOnce(ctx)
+		if err == nil || retry >= p.DialRetries || errors.Is(err, circuitbreaker.ErrOpen) {
+			return conn, err
+		}
+		if err := p.clock.Sleep(ctx, b.Next()); err != nil {
+			return nil, err
 		}
 	}
-
 }
 
-// MaintainMinConnections opens connections if below min.
-func (p *ConnectionPool) MaintainMinConnections() {
+// dialOnce opens a connection through the dial limiter and the Breaker,
+// if set.
+func (p *ConnectionPool) dialOnce(ctx context.Context) (*DBConn, error) {
 
-	// Loop to open connections
-	for i := len(p.conns); i < p.minConnections; i++ {
-		conn, err := p.OpenConnection()
-		if err != nil {
-			continue
+	if p.dialLimiter != nil {
+		if err := p.dialLimiter.Wait(ctx); err != nil {
+			return nil, err
 		}
-		p.conns <- conn
 	}
+
+	if p.Breaker == nil {
+		return p.OpenConnection()
+	}
+
+	var conn *DBConn
+	err := p.Breaker.Execute(ctx, func(context.Context) error {
+		var err error
+		conn, err = p.OpenConnection()
+		return err
+	})
+	return conn, err
 }
 
-// Check returns true if connection is healthy.
+// Check returns true if connection is healthy. Failures count towards
+// quarantining the pool, except for connections opened before the last
+// quarantine.
 func (p *ConnectionPool) Check(conn *DBConn) bool {
 
-	// Check connection health with a ping.
-	return conn.DB.Ping() == nil
+	// Check connection health, with a ping by default.
+	ok := p.healthCheck(conn) == nil
+	if conn.epoch == p.quarantine.epoch.Load() {
+		p.recordHealth(ok)
+	}
+	return ok
+}
+
+// ping pings the database of conn.
+func ping(conn *DBConn) error {
+	return conn.DB.Ping()
+}
+
+// closeConn closes the database handle of conn, if any.
+func (p *ConnectionPool) closeConn(conn *DBConn) {
+	if conn.DB != nil {
+		conn.DB.Close()
+	}
 }
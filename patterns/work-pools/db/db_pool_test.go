@@ -1,11 +1,21 @@
 package dbpool
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	"github.com/Alan-333333/go-channel-patterns/patterns/circuitbreaker"
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic/pooltest"
 	"github.com/agiledragon/gomonkey"
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -30,8 +40,9 @@ func TestNew(t *testing.T) {
 		t.Errorf("waitTimeout not set correctly")
 	}
 
-	if cap(pool.conns) != maxConn {
-		t.Errorf("conns channel capacity not set correctly")
+	// no connections until opened or acquired
+	if stats := pool.Stats(); stats != (Stats{}) {
+		t.Errorf("Stats() = %+v, want zero", stats)
 	}
 
 }
@@ -42,7 +53,7 @@ func TestOpen(t *testing.T) {
 	openConnInvoked := 0
 	mockOpenConn := func() (*DBConn, error) {
 		openConnInvoked++
-		return &DBConn{}, nil
+		return &DBConn{TimeOut: time.Hour}, nil
 	}
 
 	// create pool
@@ -54,32 +65,37 @@ func TestOpen(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer pool.Close()
 
-	// check OpenConnection invoked
-	if openConnInvoked != pool.maxConnections {
-		t.Errorf("OpenConnection not invoked expected times")
+	// only the min connections are opened, the rest on demand
+	if openConnInvoked != pool.minConnections {
+		t.Errorf("OpenConnection invoked %d times, want %d", openConnInvoked, pool.minConnections)
 	}
 
 	// check connections
-	if len(pool.conns) != pool.maxConnections {
-		t.Errorf("number of connections not equals maxConnections")
+	if idle := pool.Stats().Idle; idle != pool.minConnections {
+		t.Errorf("%d idle connections, want %d", idle, pool.minConnections)
 	}
 
-	// check cleanup goroutine
-	if pool.cleanupTicker == nil {
-		t.Error("cleanup goroutine not started")
+}
+
+func TestOpenError(t *testing.T) {
+
+	pool := New(10, 5, 30*time.Second)
+	pool.OpenConnection = func() (*DBConn, error) {
+		return nil, errors.New("connection refused")
 	}
 
+	if err := pool.Open(); err == nil {
+		t.Error("Open should return the dial error")
+	}
 }
 
 func TestAcquire(t *testing.T) {
 
-	// mock connection
-	mockConn := &DBConn{}
-
 	// mock close with gomonkey
 	var closed bool
-	patches := gomonkey.ApplyMethod(reflect.TypeOf(mockConn.DB), "Close", func(*sql.DB) error {
+	patches := gomonkey.ApplyMethod(reflect.TypeOf((*sql.DB)(nil)), "Close", func(*sql.DB) error {
 		closed = true
 		return nil
 	})
@@ -87,43 +103,55 @@ func TestAcquire(t *testing.T) {
 
 	// create pool
 	pool := New(10, 5, 30*time.Second)
+	pool.OpenConnection = func() (*DBConn, error) {
+		return &DBConn{DB: &sql.DB{}, TimeOut: time.Hour}, nil
+	}
 
-	// mark mockConn expired
-	mockConn.HeartBeat = time.Now().Add(-1 * time.Hour)
+	expired, _ := pool.Acquire()
+	pool.Release(expired)
 
-	// add connection to pool
-	pool.conns <- mockConn
+	// mark connection expired
+	expired.HeartBeat = time.Now().Add(-2 * time.Hour)
 
 	// acquire connection
-	conn, _ := pool.Acquire()
+	conn, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// assert closed
 	if !closed {
 		t.Error("did not close expired connection")
 	}
 
-	// assert returned connection
-	if conn != nil {
-		t.Error("should return nil on expired connection")
+	// assert replaced
+	if conn == expired {
+		t.Error("should replace expired connection")
+	}
+
+	if stats := pool.Stats(); stats.ExpiredClosed != 1 || stats.Dials != 2 {
+		t.Errorf("Stats() = %+v, want 1 expired and 2 dials", stats)
 	}
 
 }
 
 func TestIsConnectionExpired(t *testing.T) {
 	// create pool
+	clk := clock.NewFake(time.Unix(0, 0))
 	conn := &DBConn{
-		HeartBeat: time.Now(),
+		HeartBeat: clk.Now(),
 		TimeOut:   10 * time.Second,
 	}
-	p := New(10, 5, 30*time.Second)
+	p := New(10, 5, 30*time.Second, WithClock(clk))
 
 	// not expired
+	clk.Add(10 * time.Second)
 	if p.isConnectionExpired(conn) {
 		t.Error("new connection should not be expired")
 	}
 
-	// update HeartBeat to 11 second ago
-	conn.HeartBeat = time.Now().Add(-11 * time.Second)
+	// HeartBeat is now 11 second ago
+	clk.Add(time.Second)
 
 	// expired
 	if !p.isConnectionExpired(conn) {
@@ -149,22 +177,23 @@ func TestRelease(t *testing.T) {
 }
 
 func TestClose(t *testing.T) {
-	// mock connection
-	mockConn := &DBConn{}
 
 	// mock close with gomonkey
 	var closed bool
-	patchesClose := gomonkey.ApplyMethod(reflect.TypeOf(mockConn.DB), "Close", func(*sql.DB) error {
+	patchesClose := gomonkey.ApplyMethod(reflect.TypeOf((*sql.DB)(nil)), "Close", func(*sql.DB) error {
 		closed = true
 		return nil
 	})
 	defer patchesClose.Reset()
 
 	// create pool with connection
-	pool := New(10, 5, 30*time.Second)
-	pool.conns <- mockConn
-
-	pool.cleanupTicker = time.NewTicker(time.Minute)
+	pool := New(10, 1, 30*time.Second)
+	pool.OpenConnection = func() (*DBConn, error) {
+		return &DBConn{DB: &sql.DB{}, TimeOut: time.Hour}, nil
+	}
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
 
 	// call Close
 	pool.Close()
@@ -174,37 +203,31 @@ func TestClose(t *testing.T) {
 		t.Error("connection not closed")
 	}
 
-	if len(pool.cleanupTicker.C) != 0 {
-		t.Error("ticker not stop")
+	if _, err := pool.Acquire(); !errors.Is(err, generic.ErrClosed) {
+		t.Errorf("Acquire() = %v, want %v", err, generic.ErrClosed)
 	}
 }
 
 func TestCloseExpiredConnections(t *testing.T) {
 
-	// Creat ConnectionPool
-	p := &ConnectionPool{
-		conns: make(chan *DBConn, 3),
+	// Creat ConnectionPool with an expired and a normal connection
+	heartBeats := []time.Time{time.Now().Add(-time.Hour), time.Now()}
+	p := New(3, 2, time.Second)
+	p.OpenConnection = func() (*DBConn, error) {
+		conn := &DBConn{HeartBeat: heartBeats[0], TimeOut: time.Minute}
+		heartBeats = heartBeats[1:]
+		return conn, nil
 	}
+	p.MaintainMinConnections()
 
-	expiredConn := &DBConn{HeartBeat: time.Now().Add(-time.Hour)}
-	normalConn := &DBConn{HeartBeat: time.Now()}
-
-	p.conns <- expiredConn
-	p.conns <- normalConn
-
-	patchesClose := gomonkey.ApplyMethod(reflect.TypeOf((*sql.DB)(nil)), "Close", func(*sql.DB) error {
-		return nil
-	})
-	defer patchesClose.Reset()
-
-	connsBefore := len(p.conns)
+	connsBefore := p.Stats().Idle
 	// connsBefore
 	t.Logf("conns before close: %d", connsBefore)
 
 	// CloseExpiredConnections
 	p.CloseExpiredConnections()
 
-	connsAfter := len(p.conns)
+	connsAfter := p.Stats().Idle
 	// connsAfter
 	t.Logf("conns after close: %d", connsAfter)
 
@@ -231,3 +254,215 @@ func TestMaintainMinConnections(t *testing.T) {
 		t.Error("did not open enough connections")
 	}
 }
+
+func TestStats(t *testing.T) {
+	pool := New(2, 1, 10*time.Millisecond)
+	pool.OpenConnection = func() (*DBConn, error) {
+		return &DBConn{TimeOut: time.Hour}, nil
+	}
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, _ := pool.Acquire()
+	pool.Acquire()
+
+	// No connections left, times out
+	if _, err := pool.Acquire(); err == nil {
+		t.Fatal("Acquire should time out")
+	}
+	pool.Release(conn)
+
+	stats := pool.Stats()
+	want := Stats{Idle: 1, InUse: 1, AcquireTimeouts: 1, Dials: 2}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestWithConn(t *testing.T) {
+	pool := New(1, 0, 10*time.Millisecond)
+	pool.OpenConnection = func() (*DBConn, error) {
+		return &DBConn{TimeOut: time.Hour}, nil
+	}
+
+	// the error of fn is returned, the connection is released
+	errQuery := errors.New("query failed")
+	err := pool.WithConn(context.Background(), func(conn *DBConn) error {
+		if s := pool.Stats(); s.InUse != 1 {
+			t.Errorf("InUse = %d inside WithConn, want 1", s.InUse)
+		}
+		return errQuery
+	})
+	if err != errQuery {
+		t.Errorf("WithConn() = %v, want %v", err, errQuery)
+	}
+	if s := pool.Stats(); s.InUse != 0 || s.Idle != 1 {
+		t.Errorf("Stats() = %+v after WithConn, want 1 idle", s)
+	}
+
+	// a connection whose use panicked is discarded
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithConn should pass the panic on")
+			}
+		}()
+		pool.WithConn(context.Background(), func(*DBConn) error {
+			panic("boom")
+		})
+	}()
+	if s := pool.Stats(); s.InUse != 0 || s.Idle != 0 {
+		t.Errorf("Stats() = %+v after a panic, want empty", s)
+	}
+
+	// waiting for a connection gives up after the wait timeout
+	conn, _ := pool.Acquire()
+	defer pool.Release(conn)
+	err = pool.WithConn(context.Background(), func(*DBConn) error {
+		t.Error("fn should not run without a connection")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WithConn() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDialBreaker(t *testing.T) {
+	// mock a database that is down
+	dials := 0
+	pool := New(10, 5, 30*time.Second)
+	pool.OpenConnection = func() (*DBConn, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	}
+
+	breaker, err := circuitbreaker.New(circuitbreaker.WithFailureThreshold(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Breaker = breaker
+
+	// maintain min tries 5 dials, the breaker stops after 2
+	pool.MaintainMinConnections()
+
+	if dials != 2 {
+		t.Errorf("dialed %d times, want 2", dials)
+	}
+	if _, err := pool.dial(context.Background()); !errors.Is(err, circuitbreaker.ErrOpen) {
+		t.Errorf("dial() = %v, want %v", err, circuitbreaker.ErrOpen)
+	}
+}
+
+func TestDialRetries(t *testing.T) {
+	// the database accepts the third dial
+	dials := 0
+	pool := New(10, 0, 30*time.Second)
+	pool.OpenConnection = func() (*DBConn, error) {
+		dials++
+		if dials < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return &DBConn{TimeOut: time.Hour}, nil
+	}
+	pool.DialRetries = 2
+	pool.DialBackoff = backoff.Backoff{Initial: time.Millisecond, Multiplier: 2}
+
+	if _, err := pool.dial(context.Background()); err != nil {
+		t.Fatalf("dial() = %v, want nil after retries", err)
+	}
+	if dials != 3 {
+		t.Errorf("dialed %d times, want 3", dials)
+	}
+
+	// cancellation stops the retries
+	dials = -10
+	pool.DialBackoff = backoff.Backoff{Initial: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.dial(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("dial() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSuite(t *testing.T) {
+	pooltest.Run(t, func(t *testing.T, maxSize, minIdle int, waitTimeout time.Duration) (pooltest.Pool[*DBConn], func() int) {
+		var dials int32
+		pool := New(maxSize, minIdle, waitTimeout)
+		pool.OpenConnection = func() (*DBConn, error) {
+			atomic.AddInt32(&dials, 1)
+			return &DBConn{TimeOut: time.Hour}, nil
+		}
+		if err := pool.Open(); err != nil {
+			t.Fatal(err)
+		}
+		return pool, func() int { return int(atomic.LoadInt32(&dials)) }
+	})
+}
+
+func TestDialLimiter(t *testing.T) {
+	// two pools share a limiter of 100 dials per second
+	bucket := tokenbucket.New(100, 1)
+	defer bucket.Close()
+
+	var mu sync.Mutex
+	var dials []time.Time
+	open := func() (*DBConn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dials = append(dials, time.Now())
+		return &DBConn{TimeOut: time.Hour}, nil
+	}
+
+	pools := []*ConnectionPool{
+		New(10, 10, time.Second, WithDialLimiter(bucket)),
+		New(10, 10, time.Second, WithDialLimiter(bucket)),
+	}
+	var wg sync.WaitGroup
+	for _, pool := range pools {
+		pool.OpenConnection = open
+		wg.Add(1)
+		go func(pool *ConnectionPool) {
+			defer wg.Done()
+			if err := pool.Open(); err != nil {
+				t.Error(err)
+			}
+		}(pool)
+	}
+	wg.Wait()
+	defer pools[0].Close()
+	defer pools[1].Close()
+
+	// the 20 dials of both pools take at least 19 intervals of 10ms
+	if len(dials) != 20 {
+		t.Fatalf("dialed %d times, want 20", len(dials))
+	}
+	if elapsed := dials[19].Sub(dials[0]); elapsed < 150*time.Millisecond {
+		t.Errorf("20 dials took %v, want about 190ms", elapsed)
+	}
+
+	// no 50ms holds more than the rate allows
+	for i := range dials {
+		n := 0
+		for _, d := range dials[i:] {
+			if d.Sub(dials[i]) < 50*time.Millisecond {
+				n++
+			}
+		}
+		if n > 7 {
+			t.Errorf("%d dials within 50ms of dial %d, want at most 7", n, i)
+		}
+	}
+
+	// growing the pool waits for the limiter until the context is done
+	starved := New(1, 0, time.Second, WithDialLimiter(tokenbucket.New(0.001, 1)))
+	starved.OpenConnection = open
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := starved.AcquireContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AcquireContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(dials) != 20 {
+		t.Errorf("dialed %d times without a token, want 20", len(dials))
+	}
+}
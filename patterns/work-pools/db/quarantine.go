@@ -0,0 +1,299 @@
+package dbpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+)
+
+// ErrPoolQuarantined is returned when acquiring from a quarantined pool.
+var ErrPoolQuarantined = errors.New("pool is quarantined")
+
+// QuarantineConfig configures the quarantine of a ConnectionPool, entered
+// when the database fails over and every connection breaks at once.
+type QuarantineConfig struct {
+
+	// Failures is how many consecutive dial or Check failures quarantine
+	// the pool. Zero means the pool is only quarantined by Quarantine.
+	Failures int
+
+	// Window bounds how long the consecutive failures may take. Zero
+	// means no bound.
+	Window time.Duration
+
+	// Recoveries is how many consecutive successful dials end the
+	// quarantine. The default is 3.
+	Recoveries int
+
+	// Backoff paces the recovery dials. Failed dials grow the delay, a
+	// successful one resets it. The default starts at 100ms and grows up
+	// to 10s.
+	Backoff backoff.Backoff
+
+	// Block makes Acquire wait for the quarantine to end, until its
+	// context is done or the wait timeout, instead of failing fast with
+	// ErrPoolQuarantined. TryAcquire always fails fast.
+	Block bool
+
+	// OnEvent is called when the pool enters or leaves quarantine.
+	// Optional.
+	OnEvent func(QuarantineEvent)
+}
+
+// QuarantineEvent reports a pool entering or leaving quarantine.
+type QuarantineEvent struct {
+
+	// Entered is true when the pool entered quarantine, false when it
+	// left it.
+	Entered bool
+
+	// Idle is the number of idle connections marked for revalidation on
+	// entry.
+	Idle int
+
+	// Failures is the number of consecutive failures that triggered the
+	// quarantine, or zero if Quarantine was called.
+	Failures int
+
+	// Dials and FailedDials count the recovery dials, on exit.
+	Dials       int
+	FailedDials int
+
+	// Rejected counts the Acquire calls failed fast, on exit.
+	Rejected uint64
+
+	// Duration is how long the pool was quarantined, on exit.
+	Duration time.Duration
+}
+
+// WithQuarantine configures the quarantine. Without it the pool is only
+// quarantined by Quarantine, with the default QuarantineConfig.
+func WithQuarantine(cfg QuarantineConfig) Option {
+	return func(p *ConnectionPool) {
+		p.quarantine.cfg = cfg
+	}
+}
+
+// quarantine tracks the health of the database and the quarantine.
+type quarantine struct {
+	cfg QuarantineConfig
+
+	// epoch is bumped on entry. Connections opened in an older epoch are
+	// checked before they are handed out again.
+	epoch atomic.Uint64
+
+	active   atomic.Bool
+	count    atomic.Uint64
+	rejected atomic.Uint64
+
+	// mu guards the fields below.
+	mu sync.Mutex
+
+	// exited is closed when the quarantine ends. It is nil outside one.
+	exited chan struct{}
+
+	// stop cancels the recovery.
+	stop context.CancelFunc
+
+	since  time.Time
+	closed bool
+
+	// failures counts the consecutive failures since firstFailure.
+	failures     int
+	firstFailure time.Time
+}
+
+// Quarantine quarantines the pool, such as when the database is known to
+// fail over: idle connections are marked to be checked before they are
+// handed out again, Acquire fails with ErrPoolQuarantined, or blocks, and
+// a goroutine dials the database with backoff until enough consecutive
+// dials succeed. Quarantining a quarantined or closed pool does nothing.
+func (p *ConnectionPool) Quarantine() {
+	p.enterQuarantine(0)
+}
+
+// Quarantined reports whether the pool is quarantined.
+func (p *ConnectionPool) Quarantined() bool {
+	return p.quarantine.active.Load()
+}
+
+// enterQuarantine quarantines the pool after failures consecutive
+// failures.
+func (p *ConnectionPool) enterQuarantine(failures int) {
+	q := &p.quarantine
+
+	q.mu.Lock()
+	if q.closed || q.exited != nil {
+		q.mu.Unlock()
+		return
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	exited := make(chan struct{})
+	q.exited = exited
+	q.stop = stop
+	q.since = p.clock.Now()
+	q.failures = 0
+	q.epoch.Add(1)
+	q.active.Store(true)
+	q.count.Add(1)
+	q.rejected.Store(0)
+	q.mu.Unlock()
+
+	p.notifyQuarantine(QuarantineEvent{
+		Entered:  true,
+		Idle:     p.pool.Stats().Idle,
+		Failures: failures,
+	})
+
+	go p.recoverQuarantine(ctx, exited)
+}
+
+// recoverQuarantine dials the database until enough consecutive dials
+// succeed, then ends the quarantine, unless ctx is done first.
+func (p *ConnectionPool) recoverQuarantine(ctx context.Context, exited chan struct{}) {
+	q := &p.quarantine
+
+	b := q.cfg.Backoff
+	if b.Initial <= 0 {
+		b = backoff.Backoff{Initial: 100 * time.Millisecond, Max: 10 * time.Second, Multiplier: 2, Jitter: 0.2}
+	}
+	recoveries := q.cfg.Recoveries
+	if recoveries < 1 {
+		recoveries = 3
+	}
+
+	ev := QuarantineEvent{}
+	for successes := 0; successes < recoveries; {
+		if err := p.clock.Sleep(ctx, b.Next()); err != nil {
+			return
+		}
+
+		conn, err := p.dialOnce(ctx)
+		if err != nil {
+			ev.FailedDials++
+			successes = 0
+			continue
+		}
+		p.closeConn(conn)
+		ev.Dials++
+		successes++
+		b.Reset()
+	}
+
+	q.mu.Lock()
+	if q.exited != exited {
+		q.mu.Unlock()
+		return
+	}
+	q.exited = nil
+	q.stop()
+	q.active.Store(false)
+	ev.Rejected = q.rejected.Load()
+	ev.Duration = p.clock.Now().Sub(q.since)
+	close(exited)
+	q.mu.Unlock()
+
+	// Check the marked idle connections now rather than on Acquire
+	p.pool.EvictExpired()
+	p.pool.Fill(context.Background())
+
+	p.notifyQuarantine(ev)
+}
+
+// admit lets an Acquire through, failing fast while quarantined, or
+// waiting until the quarantine ends or ctx is done if block is set.
+func (p *ConnectionPool) admit(ctx context.Context, block bool) error {
+	q := &p.quarantine
+	if !q.active.Load() {
+		return nil
+	}
+
+	q.mu.Lock()
+	exited := q.exited
+	q.mu.Unlock()
+	if exited == nil {
+		return nil
+	}
+
+	if !block {
+		q.rejected.Add(1)
+		return ErrPoolQuarantined
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-ctx.Done():
+		q.rejected.Add(1)
+		return fmt.Errorf("%w: %w", ErrPoolQuarantined, ctx.Err())
+	}
+}
+
+// recordHealth counts a dial or Check failing, quarantining the pool
+// after the configured consecutive failures, or succeeding.
+func (p *ConnectionPool) recordHealth(ok bool) {
+	q := &p.quarantine
+
+	q.mu.Lock()
+	if ok || q.exited != nil {
+		q.failures = 0
+		q.mu.Unlock()
+		return
+	}
+
+	now := p.clock.Now()
+	if q.failures == 0 || (q.cfg.Window > 0 && now.Sub(q.firstFailure) > q.cfg.Window) {
+		q.failures = 0
+		q.firstFailure = now
+	}
+	q.failures++
+	failures := q.failures
+	trip := q.cfg.Failures > 0 && failures >= q.cfg.Failures
+	q.mu.Unlock()
+
+	if trip {
+		p.enterQuarantine(failures)
+	}
+}
+
+// revalidate reports whether conn may be handed out, checking it first if
+// it was opened before the last quarantine.
+func (p *ConnectionPool) revalidate(conn *DBConn) bool {
+	epoch := p.quarantine.epoch.Load()
+	if conn.epoch == epoch {
+		return true
+	}
+	if !p.Check(conn) {
+		return false
+	}
+	conn.epoch = epoch
+	return true
+}
+
+// closeQuarantine stops the recovery and wakes the blocked Acquire calls,
+// which then find the pool closed.
+func (p *ConnectionPool) closeQuarantine() {
+	q := &p.quarantine
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	if q.exited != nil {
+		q.stop()
+		close(q.exited)
+		q.exited = nil
+		q.active.Store(false)
+	}
+}
+
+// notifyQuarantine calls OnEvent, if set.
+func (p *ConnectionPool) notifyQuarantine(ev QuarantineEvent) {
+	if p.quarantine.cfg.OnEvent != nil {
+		p.quarantine.cfg.OnEvent(ev)
+	}
+}
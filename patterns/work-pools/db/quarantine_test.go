@@ -0,0 +1,268 @@
+package dbpool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	"github.com/agiledragon/gomonkey"
+)
+
+// failover is a database that can go down, breaking the connections
+// opened before.
+type failover struct {
+	down atomic.Bool
+
+	mu     sync.Mutex
+	broken map[*sql.DB]bool
+	events []QuarantineEvent
+	exited chan QuarantineEvent
+}
+
+// newFailover mocks Close of the connections it opens.
+func newFailover(t *testing.T) *failover {
+	f := &failover{broken: make(map[*sql.DB]bool), exited: make(chan QuarantineEvent, 1)}
+
+	patches := gomonkey.ApplyMethod(reflect.TypeOf((*sql.DB)(nil)), "Close", func(*sql.DB) error {
+		return nil
+	})
+	t.Cleanup(patches.Reset)
+	return f
+}
+
+// check is the health check of the connections, failing the broken ones.
+func (f *failover) check(conn *DBConn) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.broken[conn.DB] {
+		return errors.New("broken pipe")
+	}
+	return nil
+}
+
+// open is the OpenConnection of the database.
+func (f *failover) open() (*DBConn, error) {
+	if f.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return &DBConn{DB: &sql.DB{}, TimeOut: time.Hour}, nil
+}
+
+// fail breaks the open connections and takes the database down.
+func (f *failover) fail(conns ...*DBConn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range conns {
+		f.broken[conn.DB] = true
+	}
+	f.down.Store(true)
+}
+
+// onEvent records the events, sending the exits to f.exited.
+func (f *failover) onEvent(ev QuarantineEvent) {
+	f.mu.Lock()
+	f.events = append(f.events, ev)
+	f.mu.Unlock()
+	if !ev.Entered {
+		f.exited <- ev
+	}
+}
+
+func TestQuarantineFailover(t *testing.T) {
+	f := newFailover(t)
+	pool := New(4, 2, time.Second, WithHealthCheck(f.check), WithQuarantine(QuarantineConfig{
+		Failures:   3,
+		Window:     time.Minute,
+		Recoveries: 3,
+		Backoff:    backoff.Backoff{Initial: time.Millisecond},
+		OnEvent:    f.onEvent,
+	}))
+	pool.OpenConnection = f.open
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// the primary fails over, breaking every connection
+	first, _ := pool.Acquire()
+	second, _ := pool.Acquire()
+	f.fail(first, second)
+
+	// two failed checks and a failed dial quarantine the pool
+	for _, conn := range []*DBConn{first, second} {
+		if pool.Check(conn) {
+			t.Fatal("Check() = true for a broken connection")
+		}
+		pool.Discard(conn)
+	}
+	if pool.Quarantined() {
+		t.Fatal("quarantined after 2 failures, want 3")
+	}
+	if _, err := pool.Acquire(); err == nil {
+		t.Fatal("Acquire should fail to dial")
+	}
+	if !pool.Quarantined() {
+		t.Fatal("not quarantined after 3 failures")
+	}
+
+	// Acquire fails fast instead of waiting for the wait timeout
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := pool.Acquire(); !errors.Is(err, ErrPoolQuarantined) {
+			t.Fatalf("Acquire() = %v, want %v", err, ErrPoolQuarantined)
+		}
+	}
+	if _, err := pool.TryAcquire(); !errors.Is(err, ErrPoolQuarantined) {
+		t.Fatalf("TryAcquire() = %v, want %v", err, ErrPoolQuarantined)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("quarantined Acquire took %v", elapsed)
+	}
+
+	// the new primary accepts connections, the pool recovers
+	time.Sleep(10 * time.Millisecond)
+	f.down.Store(false)
+	exit := <-f.exited
+
+	if exit.Dials != 3 || exit.FailedDials == 0 || exit.Rejected != 6 {
+		t.Errorf("exit event %+v, want 3 dials after failed ones and 6 rejected", exit)
+	}
+	f.mu.Lock()
+	entry := f.events[0]
+	f.mu.Unlock()
+	if !entry.Entered || entry.Failures != 3 {
+		t.Errorf("entry event %+v, want 3 failures", entry)
+	}
+
+	conn, err := pool.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() = %v after recovery", err)
+	}
+	pool.Release(conn)
+
+	s := pool.Stats()
+	if s.Quarantined || s.Quarantines != 1 || s.Idle != 2 {
+		t.Errorf("Stats() = %+v, want 2 idle after 1 quarantine", s)
+	}
+}
+
+func TestQuarantineRevalidatesIdle(t *testing.T) {
+	f := newFailover(t)
+	pool := New(4, 3, time.Second, WithHealthCheck(f.check), WithQuarantine(QuarantineConfig{
+		Recoveries: 1,
+		Backoff:    backoff.Backoff{Initial: time.Millisecond},
+		OnEvent:    f.onEvent,
+	}))
+	pool.OpenConnection = f.open
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// two of the idle connections broke in the failover
+	conns := make([]*DBConn, 3)
+	for i := range conns {
+		conns[i], _ = pool.Acquire()
+	}
+	for _, conn := range conns {
+		pool.Release(conn)
+	}
+	f.fail(conns[0], conns[1])
+	f.down.Store(false)
+
+	pool.Quarantine()
+	<-f.exited
+
+	// the broken ones are closed and replaced, the good one kept
+	f.mu.Lock()
+	entry := f.events[0]
+	f.mu.Unlock()
+	if !entry.Entered || entry.Idle != 3 || entry.Failures != 0 {
+		t.Errorf("entry event %+v, want 3 idle marked", entry)
+	}
+	s := pool.Stats()
+	if s.ExpiredClosed != 2 || s.Idle != 3 || s.Dials != 5 {
+		t.Errorf("Stats() = %+v, want 2 closed and replaced", s)
+	}
+	kept := false
+	for i := 0; i < 3; i++ {
+		conn, _ := pool.Acquire()
+		kept = kept || conn == conns[2]
+	}
+	if !kept {
+		t.Error("the healthy connection should be kept")
+	}
+}
+
+func TestQuarantineBlock(t *testing.T) {
+	f := newFailover(t)
+	pool := New(2, 0, time.Second, WithHealthCheck(f.check), WithQuarantine(QuarantineConfig{
+		Recoveries: 1,
+		Backoff:    backoff.Backoff{Initial: 50 * time.Millisecond},
+		Block:      true,
+		OnEvent:    f.onEvent,
+	}))
+	pool.OpenConnection = f.open
+	defer pool.Close()
+
+	pool.Quarantine()
+
+	// TryAcquire never blocks, a short wait gives up
+	if _, err := pool.TryAcquire(); !errors.Is(err, ErrPoolQuarantined) {
+		t.Errorf("TryAcquire() = %v, want %v", err, ErrPoolQuarantined)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := pool.AcquireContext(ctx); !errors.Is(err, ErrPoolQuarantined) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AcquireContext() = %v, want %v", err, ErrPoolQuarantined)
+	}
+
+	// Acquire waits for the quarantine to end
+	start := time.Now()
+	conn, err := pool.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() = %v, want a connection after the quarantine", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Acquire returned after %v, before the recovery", elapsed)
+	}
+	pool.Release(conn)
+	<-f.exited
+}
+
+func TestQuarantineClose(t *testing.T) {
+	f := newFailover(t)
+	f.down.Store(true)
+	pool := New(2, 0, time.Second, WithHealthCheck(f.check), WithQuarantine(QuarantineConfig{
+		Backoff: backoff.Backoff{Initial: time.Millisecond},
+		Block:   true,
+	}))
+	pool.OpenConnection = f.open
+
+	// closing the pool ends the quarantine, waking blocked callers
+	pool.Quarantine()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := pool.AcquireContext(context.Background())
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pool.Close()
+
+	if err := <-errc; err == nil {
+		t.Error("Acquire should fail on a closed pool")
+	}
+	if pool.Quarantined() {
+		t.Error("a closed pool should not stay quarantined")
+	}
+	pool.Quarantine()
+	if pool.Quarantined() {
+		t.Error("a closed pool should not be quarantined")
+	}
+}
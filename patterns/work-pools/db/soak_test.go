@@ -0,0 +1,123 @@
+package dbpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/testkit"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
+)
+
+// TestSoak acquires, holds, releases and discards connections at random
+// and checks the pool accounting reconciles. It is skipped with -short;
+// TESTKIT_DURATION sets how long it runs and TESTKIT_SEED replays it.
+func TestSoak(t *testing.T) {
+	const maxConn = 8
+	r := testkit.New()
+	pool := New(maxConn, 2, 20*time.Millisecond)
+
+	// Connections expire after a random time, so some are validated away
+	var mu sync.Mutex
+	rnd := rand.New(rand.NewSource(r.Seed()))
+	var dialed, discarded atomic.Uint64
+	pool.OpenConnection = func() (*DBConn, error) {
+		mu.Lock()
+		timeout := time.Duration(1+rnd.Intn(20)) * time.Millisecond
+		mu.Unlock()
+
+		dialed.Add(1)
+		return &DBConn{TimeOut: timeout}, nil
+	}
+
+	r.Start(func(ctx context.Context) error {
+		return pool.Open()
+	})
+	r.Cleanup(pool.Close)
+
+	errBroken := errors.New("broken connection")
+	r.Workload("clients", 12, func(ctx context.Context, rnd *rand.Rand) error {
+		hold := time.Duration(rnd.Intn(1000)) * time.Microsecond
+
+		switch n := rnd.Intn(10); {
+		case n < 6:
+			conn, err := pool.AcquireContext(ctx)
+			if err != nil {
+				return nil
+			}
+			time.Sleep(hold)
+			pool.Release(conn)
+
+		case n < 7:
+			conn, err := pool.TryAcquire()
+			if errors.Is(err, generic.ErrExhausted) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			pool.Release(conn)
+
+		case n < 8:
+			conn, err := pool.Acquire()
+			if err != nil {
+				return nil
+			}
+			discarded.Add(1)
+			pool.Discard(conn)
+
+		default:
+			err := pool.WithConn(ctx, func(*DBConn) error {
+				time.Sleep(hold)
+				return errBroken
+			})
+			if err != nil && !errors.Is(err, errBroken) && ctx.Err() == nil && !isTimeout(err) {
+				return err
+			}
+		}
+		return nil
+	})
+
+	r.Observe("pool", func() interface{} { return pool.Stats() })
+	r.Observe("dialed", func() interface{} { return dialed.Load() })
+	r.Observe("discarded", func() interface{} { return discarded.Load() })
+
+	r.Invariant("bounded", func(s testkit.Snapshot) error {
+		st := s["pool"].(Stats)
+		if st.InUse < 0 || st.Idle < 0 || st.InUse+st.Idle > maxConn {
+			return fmt.Errorf("%d in use and %d idle, max %d", st.InUse, st.Idle, maxConn)
+		}
+		if st.Dials > s["dialed"].(uint64) {
+			return fmt.Errorf("pool counted %d dials, %d made", st.Dials, s["dialed"])
+		}
+		return nil
+	})
+
+	r.Final("reconciles", func(s testkit.Snapshot) error {
+		st := s["pool"].(Stats)
+		dialed, discarded := s["dialed"].(uint64), s["discarded"].(uint64)
+		if st.InUse != 0 || st.Waiters != 0 {
+			return fmt.Errorf("%d in use and %d waiting at rest", st.InUse, st.Waiters)
+		}
+		if st.Dials != dialed {
+			return fmt.Errorf("pool counted %d dials, %d made", st.Dials, dialed)
+		}
+		if uint64(st.Idle) != dialed-discarded-st.ExpiredClosed {
+			return fmt.Errorf("%d idle, want %d dialed - %d discarded - %d expired",
+				st.Idle, dialed, discarded, st.ExpiredClosed)
+		}
+		return nil
+	})
+
+	r.RunT(t)
+}
+
+// isTimeout reports whether err is an acquire giving up waiting.
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,626 @@
+// Package generic implements a resource pool, such as a connection pool,
+// for any resource type. dbpool and redispool are typed wrappers over it.
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+)
+
+var (
+	// ErrClosed is returned when acquiring from a closed pool.
+	ErrClosed = errors.New("pool is closed")
+
+	// ErrExhausted is returned by TryAcquire when every resource is in use.
+	ErrExhausted = errors.New("pool exhausted")
+)
+
+// Config describes the resources of a Pool and how long they live.
+type Config[T comparable] struct {
+
+	// Factory creates a resource. It is required, and every resource it
+	// returns must be distinct.
+	Factory func(ctx context.Context) (T, error)
+
+	// Validate reports whether an idle resource may still be used. It is
+	// called before handing out an idle resource and by EvictExpired.
+	// Resources failing it are destroyed. Optional.
+	Validate func(T) bool
+
+	// Destroy releases a resource's underlying handles. Optional.
+	Destroy func(T)
+
+	// MaxSize bounds the resources in use. Values below 1 mean 1.
+	MaxSize int
+
+	// MinIdle is how many idle resources Fill keeps open.
+	MinIdle int
+
+	// MaxLifetime is how long a resource may live since it was created.
+	// Zero means forever.
+	MaxLifetime time.Duration
+
+	// MaxIdleTime is how long a resource may stay idle. Zero means
+	// forever.
+	MaxIdleTime time.Duration
+
+	// WaitTimeout bounds how long Acquire waits for a resource. Zero means
+	// no bound.
+	WaitTimeout time.Duration
+
+	// MaintenanceInterval is how often the goroutine started by Open
+	// evicts expired resources, fills up to MinIdle and checks for leaks.
+	// The default is one minute.
+	MaintenanceInterval time.Duration
+
+	// Clock times lifetimes, leaks and the maintenance. The default is
+	// the system clock. WaitTimeout is always timed by the system clock.
+	Clock clock.Clock
+}
+
+// Leak describes a resource held longer than the leak threshold.
+type Leak[T comparable] struct {
+
+	// Resource is the leaked resource.
+	Resource T
+
+	// AcquiredAt is when it was acquired.
+	AcquiredAt time.Time
+
+	// Stack is the stack trace of the goroutine that acquired it.
+	Stack []byte
+}
+
+// Stats is a snapshot of the pool's gauges and counters.
+type Stats struct {
+	Idle            int    // Resources waiting in the pool
+	InUse           int    // Resources acquired and not yet released
+	Waiters         int    // Callers waiting for a resource
+	AcquireTimeouts uint64 // Acquire calls that gave up waiting
+	Dials           uint64 // Resources created
+	Expired         uint64 // Resources destroyed because they expired or failed Validate
+	Leaks           uint64 // Resources reported as leaked
+}
+
+// entry is a resource and its bookkeeping.
+type entry[T comparable] struct {
+	value      T
+	created    time.Time
+	lastUsed   time.Time
+	acquiredAt time.Time
+	stack      []byte
+	leaked     bool
+}
+
+// Pool hands out resources, creating them on demand up to MaxSize and
+// reusing released ones, most recently used first.
+type Pool[T comparable] struct {
+	cfg Config[T]
+
+	// slots holds a token per resource in use or being created, bounding
+	// them to MaxSize.
+	slots chan struct{}
+
+	// closing is closed by Close to wake waiting acquirers.
+	closing chan struct{}
+
+	// returned is signalled when a resource comes back after Close.
+	returned chan struct{}
+
+	// mu guards the fields below.
+	mu            sync.Mutex
+	idle          []*entry[T]
+	inUse         map[T]*entry[T]
+	size          int
+	closed        bool
+	stop          chan struct{}
+	leakThreshold time.Duration
+	onLeak        func(Leak[T])
+
+	// Mirrors and counters backing Stats, read without taking mu.
+	idleCount       atomic.Int64
+	inUseCount      atomic.Int64
+	waiters         atomic.Int64
+	acquireTimeouts atomic.Uint64
+	dials           atomic.Uint64
+	expired         atomic.Uint64
+	leaks           atomic.Uint64
+}
+
+// New creates a Pool. It creates no resources until they are acquired, or
+// until Open or Fill. It panics if cfg.Factory is nil.
+func New[T comparable](cfg Config[T]) *Pool[T] {
+	if cfg.Factory == nil {
+		panic("generic: Config.Factory is nil")
+	}
+	if cfg.MaxSize < 1 {
+		cfg.MaxSize = 1
+	}
+	if cfg.MinIdle > cfg.MaxSize {
+		cfg.MinIdle = cfg.MaxSize
+	}
+	if cfg.MaintenanceInterval <= 0 {
+		cfg.MaintenanceInterval = time.Minute
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.New()
+	}
+
+	return &Pool[T]{
+		cfg:      cfg,
+		slots:    make(chan struct{}, cfg.MaxSize),
+		closing:  make(chan struct{}),
+		returned: make(chan struct{}, 1),
+		inUse:    make(map[T]*entry[T]),
+	}
+}
+
+// Open creates MinIdle resources, returning the first error, and starts a
+// goroutine running EvictExpired, Fill and CheckLeaks every
+// MaintenanceInterval until Close.
+func (p *Pool[T]) Open(ctx context.Context) error {
+	if err := p.fill(ctx, true); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+		go p.maintain(p.stop)
+	}
+	return nil
+}
+
+// DetectLeaks makes CheckLeaks report resources held longer than
+// threshold to onLeak, once each. It records the acquiring stack of every
+// resource from then on, which costs some time per Acquire.
+func (p *Pool[T]) DetectLeaks(threshold time.Duration, onLeak func(Leak[T])) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.leakThreshold = threshold
+	p.onLeak = onLeak
+}
+
+// Acquire returns a resource, waiting up to WaitTimeout for one to be
+// released when MaxSize are in use.
+func (p *Pool[T]) Acquire() (T, error) {
+	ctx := context.Background()
+	if p.cfg.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.WaitTimeout)
+		defer cancel()
+	}
+	return p.AcquireContext(ctx)
+}
+
+// AcquireContext returns a resource, waiting for one to be released when
+// MaxSize are in use until ctx is done. The context is also passed to
+// Factory when a resource is created.
+func (p *Pool[T]) AcquireContext(ctx context.Context) (T, error) {
+	var zero T
+
+	select {
+	case <-p.closing:
+		return zero, ErrClosed
+	default:
+	}
+
+	p.waiters.Add(1)
+	select {
+	case p.slots <- struct{}{}:
+		p.waiters.Add(-1)
+	case <-ctx.Done():
+		p.waiters.Add(-1)
+		p.acquireTimeouts.Add(1)
+		return zero, fmt.Errorf("timeout waiting for resource: %w", ctx.Err())
+	case <-p.closing:
+		p.waiters.Add(-1)
+		return zero, ErrClosed
+	}
+
+	v, err := p.take(ctx)
+	if err != nil {
+		<-p.slots
+		return zero, err
+	}
+	return v, nil
+}
+
+// TryAcquire returns a resource without waiting, or ErrExhausted if
+// MaxSize are in use. It may still create a resource.
+func (p *Pool[T]) TryAcquire() (T, error) {
+	var zero T
+
+	select {
+	case <-p.closing:
+		return zero, ErrClosed
+	default:
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return zero, ErrExhausted
+	}
+
+	v, err := p.take(context.Background())
+	if err != nil {
+		<-p.slots
+		return zero, err
+	}
+	return v, nil
+}
+
+// Release returns v to the pool. Resources that expired, or come back
+// after Close, are destroyed instead. Releasing a resource that is not in
+// use does nothing.
+func (p *Pool[T]) Release(v T) {
+	now := p.cfg.Clock.Now()
+
+	p.mu.Lock()
+	e, ok := p.inUse[v]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.inUse, v)
+	p.inUseCount.Add(-1)
+	e.lastUsed = now
+
+	if p.closed || p.size > p.cfg.MaxSize || p.tooOld(e, now) {
+		p.size--
+		p.mu.Unlock()
+		p.destroy(e.value)
+		p.notifyReturned()
+		<-p.slots
+		return
+	}
+
+	// Idle before freeing the slot, so a waiter finds it
+	p.idle = append(p.idle, e)
+	p.idleCount.Add(1)
+	p.mu.Unlock()
+	<-p.slots
+}
+
+// Discard destroys v instead of returning it, for resources found broken.
+// Discarding a resource that is not in use does nothing.
+func (p *Pool[T]) Discard(v T) {
+	p.mu.Lock()
+	if _, ok := p.inUse[v]; !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.inUse, v)
+	p.inUseCount.Add(-1)
+	p.size--
+	p.mu.Unlock()
+
+	p.destroy(v)
+	p.notifyReturned()
+	<-p.slots
+}
+
+// EvictExpired destroys the idle resources that outlived MaxLifetime or
+// MaxIdleTime, or fail Validate.
+func (p *Pool[T]) EvictExpired() {
+	now := p.cfg.Clock.Now()
+
+	// Validate may do I/O, so check the idle resources outside the lock
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.idleCount.Add(-int64(len(idle)))
+	p.mu.Unlock()
+
+	var keep, expired []*entry[T]
+	for _, e := range idle {
+		if p.usable(e, now) {
+			keep = append(keep, e)
+		} else {
+			expired = append(expired, e)
+		}
+	}
+
+	p.mu.Lock()
+	p.size -= len(expired)
+	if p.closed {
+		p.size -= len(keep)
+		expired = append(expired, keep...)
+	} else {
+		// Resources released meanwhile are more recently used
+		p.idle = append(keep, p.idle...)
+		p.idleCount.Add(int64(len(keep)))
+	}
+	p.mu.Unlock()
+
+	for _, e := range expired {
+		p.expired.Add(1)
+		p.destroy(e.value)
+	}
+}
+
+// Fill creates idle resources until there are MinIdle, without exceeding
+// MaxSize in total. Failed creations are not retried; it returns their
+// errors joined.
+func (p *Pool[T]) Fill(ctx context.Context) error {
+	return p.fill(ctx, false)
+}
+
+// fill implements Fill, stopping at the first error if failFast is set.
+func (p *Pool[T]) fill(ctx context.Context, failFast bool) error {
+	p.mu.Lock()
+	missing := p.cfg.MinIdle - len(p.idle)
+	p.mu.Unlock()
+
+	var errs []error
+	for i := 0; i < missing; i++ {
+		p.mu.Lock()
+		if p.closed || p.size >= p.cfg.MaxSize {
+			p.mu.Unlock()
+			break
+		}
+		p.size++
+		p.mu.Unlock()
+
+		v, err := p.cfg.Factory(ctx)
+		if err != nil {
+			p.mu.Lock()
+			p.size--
+			p.mu.Unlock()
+			if failFast {
+				return err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		p.dials.Add(1)
+
+		now := p.cfg.Clock.Now()
+		e := &entry[T]{value: v, created: now, lastUsed: now}
+		p.mu.Lock()
+		if p.closed {
+			p.size--
+			p.mu.Unlock()
+			p.destroy(v)
+			break
+		}
+		p.idle = append(p.idle, e)
+		p.idleCount.Add(1)
+		p.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// CheckLeaks reports the resources held longer than the DetectLeaks
+// threshold, once each.
+func (p *Pool[T]) CheckLeaks() {
+	now := p.cfg.Clock.Now()
+
+	p.mu.Lock()
+	threshold, onLeak := p.leakThreshold, p.onLeak
+	if threshold <= 0 || onLeak == nil {
+		p.mu.Unlock()
+		return
+	}
+	var leaks []Leak[T]
+	for _, e := range p.inUse {
+		if e.leaked || now.Sub(e.acquiredAt) < threshold {
+			continue
+		}
+		e.leaked = true
+		leaks = append(leaks, Leak[T]{Resource: e.value, AcquiredAt: e.acquiredAt, Stack: e.stack})
+	}
+	p.mu.Unlock()
+
+	for _, l := range leaks {
+		p.leaks.Add(1)
+		onLeak(l)
+	}
+}
+
+// Stats returns a snapshot of the pool's gauges and counters. It only
+// reads atomics, so metrics scrapers can call it at any time.
+func (p *Pool[T]) Stats() Stats {
+	return Stats{
+		Idle:            int(p.idleCount.Load()),
+		InUse:           int(p.inUseCount.Load()),
+		Waiters:         int(p.waiters.Load()),
+		AcquireTimeouts: p.acquireTimeouts.Load(),
+		Dials:           p.dials.Load(),
+		Expired:         p.expired.Load(),
+		Leaks:           p.leaks.Load(),
+	}
+}
+
+// Close stops handing out resources, destroys the idle ones and waits for
+// those in use to be released, destroying them as they come back. If ctx
+// is done first it returns an error saying how many are still in use;
+// they are still destroyed when released.
+func (p *Pool[T]) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.closing)
+		if p.stop != nil {
+			close(p.stop)
+		}
+	}
+	idle := p.idle
+	p.idle = nil
+	p.idleCount.Add(-int64(len(idle)))
+	p.size -= len(idle)
+	p.mu.Unlock()
+
+	for _, e := range idle {
+		p.destroy(e.value)
+	}
+
+	for {
+		p.mu.Lock()
+		n := len(p.inUse)
+		p.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-p.returned:
+		case <-ctx.Done():
+			return fmt.Errorf("%d resources still in use: %w", n, ctx.Err())
+		}
+	}
+}
+
+// take hands out an idle resource, or creates one. The caller holds a
+// slot.
+func (p *Pool[T]) take(ctx context.Context) (T, error) {
+	var zero T
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return zero, ErrClosed
+		}
+
+		// Reuse the most recently released resource
+		if n := len(p.idle); n > 0 {
+			e := p.idle[n-1]
+			p.idle[n-1] = nil
+			p.idle = p.idle[:n-1]
+			p.idleCount.Add(-1)
+			p.mu.Unlock()
+
+			if !p.usable(e, p.cfg.Clock.Now()) {
+				p.mu.Lock()
+				p.size--
+				p.mu.Unlock()
+				p.expired.Add(1)
+				p.destroy(e.value)
+				continue
+			}
+			return e.value, p.checkout(e)
+		}
+
+		// Grow lazily
+		p.size++
+		p.mu.Unlock()
+
+		v, err := p.cfg.Factory(ctx)
+		if err != nil {
+			p.mu.Lock()
+			p.size--
+			p.mu.Unlock()
+			return zero, err
+		}
+		p.dials.Add(1)
+
+		now := p.cfg.Clock.Now()
+		return v, p.checkout(&entry[T]{value: v, created: now, lastUsed: now})
+	}
+}
+
+// checkout marks e in use, or destroys it if the pool closed meanwhile.
+func (p *Pool[T]) checkout(e *entry[T]) error {
+	p.mu.Lock()
+	if p.closed {
+		p.size--
+		p.mu.Unlock()
+		p.destroy(e.value)
+		return ErrClosed
+	}
+
+	e.acquiredAt = p.cfg.Clock.Now()
+	e.leaked = false
+	e.stack = nil
+	if p.leakThreshold > 0 {
+		e.stack = debug.Stack()
+	}
+	p.inUse[e.value] = e
+	p.inUseCount.Add(1)
+	p.mu.Unlock()
+	return nil
+}
+
+// usable reports whether idle resource e may be handed out at now.
+func (p *Pool[T]) usable(e *entry[T], now time.Time) bool {
+	if p.tooOld(e, now) {
+		return false
+	}
+	if p.cfg.MaxIdleTime > 0 && now.Sub(e.lastUsed) >= p.cfg.MaxIdleTime {
+		return false
+	}
+	return p.cfg.Validate == nil || p.cfg.Validate(e.value)
+}
+
+// tooOld reports whether e outlived MaxLifetime at now.
+func (p *Pool[T]) tooOld(e *entry[T], now time.Time) bool {
+	return p.cfg.MaxLifetime > 0 && now.Sub(e.created) >= p.cfg.MaxLifetime
+}
+
+// destroy calls Destroy on v, if set.
+func (p *Pool[T]) destroy(v T) {
+	if p.cfg.Destroy != nil {
+		p.cfg.Destroy(v)
+	}
+}
+
+// notifyReturned wakes Close without blocking.
+func (p *Pool[T]) notifyReturned() {
+	select {
+	case p.returned <- struct{}{}:
+	default:
+	}
+}
+
+// maintain runs the periodic maintenance until stop is closed. A Fill
+// that fails is retried before the next round, backing off up to the
+// maintenance interval.
+func (p *Pool[T]) maintain(stop chan struct{}) {
+	ticker := p.cfg.Clock.NewTicker(p.cfg.MaintenanceInterval)
+	defer ticker.Stop()
+
+	b := backoff.Backoff{
+		Initial:    p.cfg.MaintenanceInterval / 16,
+		Max:        p.cfg.MaintenanceInterval,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+	retry := p.cfg.Clock.NewTimer(0)
+	retry.Stop()
+	defer retry.Stop()
+
+	fill := func() {
+		if p.Fill(context.Background()) == nil {
+			b.Reset()
+			retry.Stop()
+			return
+		}
+		retry.Reset(b.Next())
+	}
+
+	for {
+		select {
+		case <-ticker.C():
+			p.EvictExpired()
+			fill()
+			p.CheckLeaks()
+		case <-retry.C():
+			fill()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic/pooltest"
+)
+
+// resource is a fake pooled resource.
+type resource struct {
+	id        int
+	broken    atomic.Bool
+	destroyed atomic.Bool
+}
+
+// factory creates resources and counts them.
+type factory struct {
+	mu      sync.Mutex
+	created []*resource
+	fail    error
+}
+
+func (f *factory) create(context.Context) (*resource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		return nil, f.fail
+	}
+	r := &resource{id: len(f.created) + 1}
+	f.created = append(f.created, r)
+	return r, nil
+}
+
+func (f *factory) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.created)
+}
+
+// newPool returns a pool of fake resources.
+func newPool(cfg Config[*resource]) (*Pool[*resource], *factory) {
+	f := &factory{}
+	cfg.Factory = f.create
+	cfg.Validate = func(r *resource) bool { return !r.broken.Load() }
+	cfg.Destroy = func(r *resource) { r.destroyed.Store(true) }
+	return New(cfg), f
+}
+
+// closer adapts Pool to pooltest.Pool.
+type closer[T comparable] struct {
+	*Pool[T]
+}
+
+func (c closer[T]) Close() {
+	c.Pool.Close(context.Background())
+}
+
+func TestSuite(t *testing.T) {
+	pooltest.Run(t, func(t *testing.T, maxSize, minIdle int, waitTimeout time.Duration) (pooltest.Pool[*resource], func() int) {
+		p, f := newPool(Config[*resource]{MaxSize: maxSize, MinIdle: minIdle, WaitTimeout: waitTimeout})
+		if err := p.Open(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return closer[*resource]{p}, f.count
+	})
+}
+
+func TestInvalidReplaced(t *testing.T) {
+	p, f := newPool(Config[*resource]{MaxSize: 2})
+
+	r, _ := p.Acquire()
+	p.Release(r)
+	r.broken.Store(true)
+
+	// The broken idle resource is destroyed and a new one created
+	got, err := p.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == r || !r.destroyed.Load() || f.count() != 2 {
+		t.Error("broken resource should be destroyed and replaced")
+	}
+	if s := p.Stats(); s.Expired != 1 {
+		t.Errorf("Expired = %d, want 1", s.Expired)
+	}
+}
+
+func TestMaxLifetime(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	p, _ := newPool(Config[*resource]{MaxSize: 1, MaxLifetime: 10 * time.Millisecond, Clock: clk})
+
+	r, _ := p.Acquire()
+	clk.Add(10 * time.Millisecond)
+
+	// Too old to go back to the pool
+	p.Release(r)
+	if !r.destroyed.Load() {
+		t.Error("resource past its lifetime should be destroyed on Release")
+	}
+	if s := p.Stats(); s.Idle != 0 || s.InUse != 0 {
+		t.Errorf("Stats() = %+v, want empty", s)
+	}
+}
+
+func TestEvictExpired(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	p, _ := newPool(Config[*resource]{MaxSize: 2, MaxIdleTime: 10 * time.Millisecond, Clock: clk})
+
+	a, _ := p.Acquire()
+	b, _ := p.Acquire()
+	p.Release(a)
+	clk.Add(10 * time.Millisecond)
+	p.Release(b)
+
+	p.EvictExpired()
+	if !a.destroyed.Load() || b.destroyed.Load() {
+		t.Error("only the resource idle for too long should be evicted")
+	}
+	if s := p.Stats(); s.Idle != 1 || s.Expired != 1 {
+		t.Errorf("Stats() = %+v, want 1 idle and 1 expired", s)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	p, f := newPool(Config[*resource]{MaxSize: 1, WaitTimeout: 10 * time.Millisecond})
+
+	r, _ := p.Acquire()
+	p.Discard(r)
+
+	if !r.destroyed.Load() {
+		t.Error("discarded resource should be destroyed")
+	}
+
+	// The slot is free again
+	if _, err := p.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if f.count() != 2 {
+		t.Errorf("created %d resources, want 2", f.count())
+	}
+}
+
+func TestTryAcquire(t *testing.T) {
+	p, _ := newPool(Config[*resource]{MaxSize: 1})
+
+	r, err := p.TryAcquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.TryAcquire(); !errors.Is(err, ErrExhausted) {
+		t.Errorf("TryAcquire() = %v, want %v", err, ErrExhausted)
+	}
+	p.Release(r)
+}
+
+func TestFactoryErrorFreesSlot(t *testing.T) {
+	p, f := newPool(Config[*resource]{MaxSize: 1, WaitTimeout: 10 * time.Millisecond})
+
+	boom := errors.New("boom")
+	f.fail = boom
+	if _, err := p.Acquire(); !errors.Is(err, boom) {
+		t.Fatalf("Acquire() = %v, want %v", err, boom)
+	}
+
+	f.fail = nil
+	if _, err := p.Acquire(); err != nil {
+		t.Errorf("Acquire() = %v, the failed creation should free its slot", err)
+	}
+}
+
+func TestFill(t *testing.T) {
+	p, f := newPool(Config[*resource]{MaxSize: 4, MinIdle: 3})
+
+	if err := p.Fill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.Idle != 3 || f.count() != 3 {
+		t.Errorf("Stats() = %+v, want 3 idle", s)
+	}
+
+	// Already full
+	p.Fill(context.Background())
+	if f.count() != 3 {
+		t.Errorf("created %d resources, want 3", f.count())
+	}
+}
+
+func TestFillErrors(t *testing.T) {
+	p, f := newPool(Config[*resource]{MaxSize: 4, MinIdle: 2})
+	f.fail = errors.New("refused")
+
+	err := p.Fill(context.Background())
+	if err == nil || strings.Count(err.Error(), "refused") != 2 {
+		t.Errorf("Fill() = %v, want both failures", err)
+	}
+	if err := p.Open(context.Background()); !errors.Is(err, f.fail) {
+		t.Errorf("Open() = %v, want %v", err, f.fail)
+	}
+}
+
+func TestCloseWaitsForInUse(t *testing.T) {
+	p, _ := newPool(Config[*resource]{MaxSize: 2})
+
+	idle, _ := p.Acquire()
+	held, _ := p.Acquire()
+	p.Release(idle)
+
+	closed := make(chan error)
+	go func() {
+		closed <- p.Close(context.Background())
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if !idle.destroyed.Load() {
+		t.Error("idle resources should be destroyed right away")
+	}
+	select {
+	case <-closed:
+		t.Fatal("Close should wait for the resource in use")
+	default:
+	}
+
+	p.Release(held)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if !held.destroyed.Load() {
+		t.Error("resource released after Close should be destroyed")
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	p, _ := newPool(Config[*resource]{MaxSize: 1})
+	p.Acquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := p.Close(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "1 resources") {
+		t.Errorf("Close() = %v, want a timeout naming 1 resource", err)
+	}
+}
+
+func TestCloseWakesWaiters(t *testing.T) {
+	p, _ := newPool(Config[*resource]{MaxSize: 1})
+	r, _ := p.Acquire()
+
+	got := make(chan error)
+	go func() {
+		_, err := p.Acquire()
+		got <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	go p.Close(context.Background())
+
+	if err := <-got; !errors.Is(err, ErrClosed) {
+		t.Errorf("Acquire() = %v, want %v", err, ErrClosed)
+	}
+	p.Release(r)
+}
+
+func TestLeakDetection(t *testing.T) {
+	p, _ := newPool(Config[*resource]{MaxSize: 2})
+
+	var leaks []Leak[*resource]
+	p.DetectLeaks(10*time.Millisecond, func(l Leak[*resource]) {
+		leaks = append(leaks, l)
+	})
+
+	leaked, _ := p.Acquire()
+	returned, _ := p.Acquire()
+	p.Release(returned)
+
+	time.Sleep(15 * time.Millisecond)
+	p.CheckLeaks()
+	p.CheckLeaks()
+
+	if len(leaks) != 1 || leaks[0].Resource != leaked {
+		t.Fatalf("reported %d leaks, want the one held resource once", len(leaks))
+	}
+	if !strings.Contains(string(leaks[0].Stack), "TestLeakDetection") {
+		t.Error("leak should carry the acquiring stack")
+	}
+	if s := p.Stats(); s.Leaks != 1 {
+		t.Errorf("Leaks = %d, want 1", s.Leaks)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	p, f := newPool(Config[*resource]{MaxSize: 2, MinIdle: 1, MaintenanceInterval: 5 * time.Millisecond})
+	if err := p.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(context.Background())
+
+	// The idle resource breaks; maintenance replaces it
+	f.created[0].broken.Store(true)
+
+	deadline := time.Now().Add(time.Second)
+	for f.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if f.count() != 2 || !f.created[0].destroyed.Load() {
+		t.Error("maintenance should evict the broken resource and fill up again")
+	}
+}
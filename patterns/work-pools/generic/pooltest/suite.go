@@ -0,0 +1,169 @@
+// Package pooltest provides the test suite shared by the resource pools:
+// the generic pool and its dbpool and redispool wrappers.
+package pooltest
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Pool is the part of a resource pool the suite exercises.
+type Pool[T comparable] interface {
+	Acquire() (T, error)
+	Release(T)
+	Close()
+}
+
+// Opener returns an opened pool holding up to maxSize resources, keeping
+// minIdle idle and waiting up to waitTimeout in Acquire, and a function
+// counting the resources it created so far. The resources must not
+// expire during the test.
+type Opener[T comparable] func(t *testing.T, maxSize, minIdle int, waitTimeout time.Duration) (Pool[T], func() int)
+
+// Run runs the suite against pools returned by open.
+func Run[T comparable](t *testing.T, open Opener[T]) {
+
+	t.Run("LazyGrowth", func(t *testing.T) {
+		p, dials := open(t, 4, 1, time.Second)
+		defer p.Close()
+
+		if n := dials(); n != 1 {
+			t.Fatalf("Open created %d resources, want only the 1 idle", n)
+		}
+
+		var held []T
+		for i := 0; i < 3; i++ {
+			v, err := p.Acquire()
+			if err != nil {
+				t.Fatal(err)
+			}
+			held = append(held, v)
+		}
+		if n := dials(); n != 3 {
+			t.Errorf("created %d resources for 3 acquires, want 3", n)
+		}
+		for _, v := range held {
+			p.Release(v)
+		}
+	})
+
+	t.Run("Reuse", func(t *testing.T) {
+		p, dials := open(t, 2, 0, time.Second)
+		defer p.Close()
+
+		first, err := p.Acquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Release(first)
+
+		second, err := p.Acquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second != first || dials() != 1 {
+			t.Errorf("released resource not reused, %d created", dials())
+		}
+		p.Release(second)
+	})
+
+	t.Run("MaxSize", func(t *testing.T) {
+		p, _ := open(t, 2, 0, 20*time.Millisecond)
+		defer p.Close()
+
+		a, _ := p.Acquire()
+		b, _ := p.Acquire()
+
+		start := time.Now()
+		if _, err := p.Acquire(); err == nil {
+			t.Fatal("Acquire beyond the max size should time out")
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("Acquire gave up after %v, want the wait timeout", elapsed)
+		}
+
+		p.Release(a)
+		p.Release(b)
+	})
+
+	t.Run("WaiterWokenByRelease", func(t *testing.T) {
+		p, _ := open(t, 1, 0, time.Second)
+		defer p.Close()
+
+		held, _ := p.Acquire()
+
+		got := make(chan T)
+		go func() {
+			v, err := p.Acquire()
+			if err != nil {
+				t.Error(err)
+			}
+			got <- v
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		p.Release(held)
+
+		select {
+		case v := <-got:
+			if v != held {
+				t.Error("waiter should get the released resource")
+			}
+			p.Release(v)
+		case <-time.After(time.Second):
+			t.Fatal("waiter not woken by Release")
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		p, _ := open(t, 2, 1, 20*time.Millisecond)
+		p.Close()
+
+		if _, err := p.Acquire(); err == nil {
+			t.Error("Acquire after Close should fail")
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		const maxSize = 3
+
+		p, dials := open(t, maxSize, 0, time.Second)
+		defer p.Close()
+
+		var inUse, peak int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					v, err := p.Acquire()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					n := atomic.AddInt32(&inUse, 1)
+					for {
+						old := atomic.LoadInt32(&peak)
+						if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+							break
+						}
+					}
+					time.Sleep(100 * time.Microsecond)
+					atomic.AddInt32(&inUse, -1)
+					p.Release(v)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if peak > maxSize {
+			t.Errorf("%d resources in use at once, want at most %d", peak, maxSize)
+		}
+		if n := dials(); n > maxSize {
+			t.Errorf("created %d resources, want at most %d", n, maxSize)
+		}
+	})
+}
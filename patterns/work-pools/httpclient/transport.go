@@ -0,0 +1,339 @@
+// Package httpclient bounds concurrent outbound HTTP requests per host with
+// an http.RoundTripper backed by a generic.Pool of slots per host.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
+)
+
+// ErrQueueTimeout is returned by RoundTrip when a request waited longer
+// than the queue timeout for a slot on its host.
+var ErrQueueTimeout = errors.New("timed out waiting for a host slot")
+
+// Option configures a Transport.
+type Option func(*config)
+
+type config struct {
+	maxPerHost   int
+	queueTimeout time.Duration
+	adaptive     bool
+	minPerHost   int
+}
+
+// WithMaxPerHost bounds the requests in flight to a single host. The
+// default is 10.
+func WithMaxPerHost(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxPerHost = n
+		}
+	}
+}
+
+// WithQueueTimeout bounds how long a request waits for a slot on its host.
+// The default is no bound beyond the request's context.
+func WithQueueTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.queueTimeout = d
+	}
+}
+
+// WithAdaptive adjusts each host's limit AIMD-style: a 429 or 503
+// response halves it, down to min, and every limit successful responses
+// in a row raise it by one, up to the max per host.
+func WithAdaptive(min int) Option {
+	return func(c *config) {
+		if min < 1 {
+			min = 1
+		}
+		c.adaptive = true
+		c.minPerHost = min
+	}
+}
+
+// HostStats is a snapshot of one host's limit and counters.
+type HostStats struct {
+	Limit     int    // Requests allowed in flight now
+	InFlight  int    // Requests holding a slot
+	Waiting   int    // Requests waiting for a slot
+	Requests  uint64 // Requests sent
+	Throttled uint64 // 429 and 503 responses
+	Timeouts  uint64 // Requests that gave up waiting for a slot
+}
+
+// Transport is an http.RoundTripper that limits the requests in flight to
+// each host, queueing the rest. A request holds its slot until the
+// response body is closed or read to the end.
+type Transport struct {
+	base http.RoundTripper
+	cfg  config
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// New creates a Transport sending requests through base, or
+// http.DefaultTransport if base is nil.
+func New(base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := config{maxPerHost: 10}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.minPerHost > cfg.maxPerHost {
+		cfg.minPerHost = cfg.maxPerHost
+	}
+
+	return &Transport{
+		base:  base,
+		cfg:   cfg,
+		hosts: make(map[string]*host),
+	}
+}
+
+// RoundTrip implements http.RoundTripper. It waits for a slot on the
+// request's host, giving up with the context's error when the request is
+// canceled, or with ErrQueueTimeout after the queue timeout.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h := t.host(req.URL.Host)
+
+	s, err := h.acquire(req.Context(), t.cfg.queueTimeout)
+	if err != nil {
+		return nil, err
+	}
+	h.requests.Add(1)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		h.release(s)
+		return nil, err
+	}
+
+	if t.cfg.adaptive {
+		h.observe(resp.StatusCode)
+	} else if throttled(resp.StatusCode) {
+		h.throttled.Add(1)
+	}
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		h.release(s)
+		return resp, nil
+	}
+	resp.Body = &body{ReadCloser: resp.Body, release: func() { h.release(s) }}
+	return resp, nil
+}
+
+// Stats returns a snapshot per host seen so far.
+func (t *Transport) Stats() map[string]HostStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[string]HostStats, len(t.hosts))
+	for name, h := range t.hosts {
+		stats[name] = h.stats()
+	}
+	return stats
+}
+
+// CloseIdleConnections closes the idle connections of the base transport,
+// if it supports it.
+func (t *Transport) CloseIdleConnections() {
+	type closeIdler interface{ CloseIdleConnections() }
+	if c, ok := t.base.(closeIdler); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// host returns the slots of the named host, creating them on first use.
+func (t *Transport) host(name string) *host {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.hosts[name]
+	if !ok {
+		h = newHost(t.cfg)
+		t.hosts[name] = h
+	}
+	return h
+}
+
+// throttled reports whether status asks the client to slow down.
+func throttled(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// slot is a permit to have one request in flight. It is not empty, so
+// every slot has a distinct address.
+type slot struct {
+	_ byte
+}
+
+// host holds the slots of one host. Lowering the limit parks slots, so
+// the pool hands out fewer; raising it releases parked slots.
+type host struct {
+	pool *generic.Pool[*slot]
+	max  int
+	min  int
+
+	// mu guards the fields below.
+	mu        sync.Mutex
+	limit     int
+	parked    []*slot
+	debt      int // Slots to park as they are released
+	successes int
+
+	inFlight  atomic.Int64
+	waiting   atomic.Int64
+	requests  atomic.Uint64
+	throttled atomic.Uint64
+	timeouts  atomic.Uint64
+}
+
+func newHost(cfg config) *host {
+	return &host{
+		pool: generic.New(generic.Config[*slot]{
+			Factory: func(context.Context) (*slot, error) { return &slot{}, nil },
+			MaxSize: cfg.maxPerHost,
+		}),
+		max:   cfg.maxPerHost,
+		min:   cfg.minPerHost,
+		limit: cfg.maxPerHost,
+	}
+}
+
+// acquire waits for a slot until ctx is done or timeout passes.
+func (h *host) acquire(ctx context.Context, timeout time.Duration) (*slot, error) {
+	wait := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		wait, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	h.waiting.Add(1)
+	s, err := h.pool.AcquireContext(wait)
+	h.waiting.Add(-1)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		h.timeouts.Add(1)
+		return nil, ErrQueueTimeout
+	}
+
+	h.inFlight.Add(1)
+	return s, nil
+}
+
+// release gives s back, parking it if the limit was lowered meanwhile.
+func (h *host) release(s *slot) {
+	h.inFlight.Add(-1)
+
+	h.mu.Lock()
+	if h.debt > 0 {
+		h.debt--
+		h.parked = append(h.parked, s)
+		h.mu.Unlock()
+		return
+	}
+	h.mu.Unlock()
+	h.pool.Release(s)
+}
+
+// observe adjusts the limit to a response status.
+func (h *host) observe(status int) {
+	if throttled(status) {
+		h.throttled.Add(1)
+		h.mu.Lock()
+		h.successes = 0
+		h.setLimit(h.limit / 2)
+		h.mu.Unlock()
+		return
+	}
+
+	h.mu.Lock()
+	h.successes++
+	if h.successes >= h.limit {
+		h.successes = 0
+		h.setLimit(h.limit + 1)
+	}
+	h.mu.Unlock()
+}
+
+// setLimit moves the limit to n, clamped to [min, max], parking or
+// unparking slots. The caller holds h.mu.
+func (h *host) setLimit(n int) {
+	if n < h.min {
+		n = h.min
+	}
+	if n > h.max {
+		n = h.max
+	}
+
+	for ; h.limit > n; h.limit-- {
+		// Park an idle slot, or the next one released
+		s, err := h.pool.TryAcquire()
+		if err != nil {
+			h.debt++
+			continue
+		}
+		h.parked = append(h.parked, s)
+	}
+
+	for ; h.limit < n; h.limit++ {
+		if h.debt > 0 {
+			h.debt--
+			continue
+		}
+		last := len(h.parked) - 1
+		s := h.parked[last]
+		h.parked = h.parked[:last]
+		h.pool.Release(s)
+	}
+}
+
+func (h *host) stats() HostStats {
+	h.mu.Lock()
+	limit := h.limit
+	h.mu.Unlock()
+
+	return HostStats{
+		Limit:     limit,
+		InFlight:  int(h.inFlight.Load()),
+		Waiting:   int(h.waiting.Load()),
+		Requests:  h.requests.Load(),
+		Throttled: h.throttled.Load(),
+		Timeouts:  h.timeouts.Load(),
+	}
+}
+
+// body releases its slot once, when closed or read to the end.
+type body struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,253 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// server is a test server tracking its peak concurrency.
+type server struct {
+	*httptest.Server
+	status   atomic.Int32
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	latency  time.Duration
+}
+
+func newServer(t *testing.T, latency time.Duration) *server {
+	s := &server{latency: latency}
+	s.status.Store(http.StatusOK)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for {
+			old := s.peak.Load()
+			if n <= old || s.peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(s.latency)
+		w.WriteHeader(int(s.status.Load()))
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// get sends n requests to url concurrently and reads their bodies.
+func get(t *testing.T, c *http.Client, url string, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Get(url)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMaxPerHost(t *testing.T) {
+	srv := newServer(t, 20*time.Millisecond)
+	tr := New(nil, WithMaxPerHost(3))
+	c := &http.Client{Transport: tr}
+
+	get(t, c, srv.URL, 15)
+
+	if peak := srv.peak.Load(); peak != 3 {
+		t.Errorf("peak concurrency = %d, want 3", peak)
+	}
+
+	host := srv.Listener.Addr().String()
+	want := HostStats{Limit: 3, Requests: 15}
+	if got := tr.Stats()[host]; got != want {
+		t.Errorf("Stats()[%s] = %+v, want %+v", host, got, want)
+	}
+}
+
+func TestHostsLimitedSeparately(t *testing.T) {
+	a := newServer(t, 20*time.Millisecond)
+	b := newServer(t, 20*time.Millisecond)
+	c := &http.Client{Transport: New(nil, WithMaxPerHost(2))}
+
+	var wg sync.WaitGroup
+	for _, srv := range []*server{a, b} {
+		wg.Add(1)
+		go func(srv *server) {
+			defer wg.Done()
+			get(t, c, srv.URL, 8)
+		}(srv)
+	}
+	wg.Wait()
+
+	if a.peak.Load() != 2 || b.peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d and %d, want 2 on each host", a.peak.Load(), b.peak.Load())
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	srv := newServer(t, 100*time.Millisecond)
+	tr := New(nil, WithMaxPerHost(1), WithQueueTimeout(10*time.Millisecond))
+	c := &http.Client{Transport: tr}
+
+	go get(t, c, srv.URL, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	_, err := c.Get(srv.URL)
+	if !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("Get() = %v, want %v", err, ErrQueueTimeout)
+	}
+	if s := tr.Stats()[srv.Listener.Addr().String()]; s.Timeouts != 1 {
+		t.Errorf("Timeouts = %d, want 1", s.Timeouts)
+	}
+}
+
+func TestCanceledWhileQueued(t *testing.T) {
+	srv := newServer(t, 100*time.Millisecond)
+	tr := New(nil, WithMaxPerHost(1))
+	c := &http.Client{Transport: tr}
+
+	go get(t, c, srv.URL, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+	_, err := c.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Do() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if s := tr.Stats()[srv.Listener.Addr().String()]; s.Timeouts != 0 {
+		t.Errorf("Timeouts = %d, canceled requests are not queue timeouts", s.Timeouts)
+	}
+}
+
+func TestSlotHeldUntilBodyClosed(t *testing.T) {
+	srv := newServer(t, 0)
+	c := &http.Client{Transport: New(nil, WithMaxPerHost(1), WithQueueTimeout(10*time.Millisecond))}
+
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(srv.URL); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Get() = %v, want %v while the body is open", err, ErrQueueTimeout)
+	}
+
+	resp.Body.Close()
+	resp, err = c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() = %v after the body was closed", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTransportError(t *testing.T) {
+	srv := newServer(t, 0)
+	srv.Close()
+	tr := New(nil, WithMaxPerHost(1))
+	c := &http.Client{Transport: tr}
+
+	var uerr *url.Error
+	if _, err := c.Get(srv.URL); !errors.As(err, &uerr) {
+		t.Fatalf("Get() = %v, want a transport error", err)
+	}
+	if s := tr.Stats()[srv.Listener.Addr().String()]; s.InFlight != 0 {
+		t.Errorf("InFlight = %d, failed requests should free their slot", s.InFlight)
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	srv := newServer(t, 0)
+	tr := New(nil, WithMaxPerHost(8), WithAdaptive(2))
+	c := &http.Client{Transport: tr}
+	host := srv.Listener.Addr().String()
+
+	limit := func() int { return tr.Stats()[host].Limit }
+
+	// Throttled responses halve the limit down to the min
+	srv.status.Store(http.StatusServiceUnavailable)
+	for _, want := range []int{4, 2, 2} {
+		get(t, c, srv.URL, 1)
+		if got := limit(); got != want {
+			t.Fatalf("limit = %d, want %d", got, want)
+		}
+	}
+
+	// A window of successes raises it by one
+	srv.status.Store(http.StatusOK)
+	get(t, c, srv.URL, 1)
+	if got := limit(); got != 2 {
+		t.Fatalf("limit = %d after one success, want 2", got)
+	}
+	get(t, c, srv.URL, 1)
+	if got := limit(); got != 3 {
+		t.Fatalf("limit = %d after two successes, want 3", got)
+	}
+
+	if s := tr.Stats()[host]; s.Throttled != 3 {
+		t.Errorf("Throttled = %d, want 3", s.Throttled)
+	}
+}
+
+func TestAdaptiveCeiling(t *testing.T) {
+	srv := newServer(t, 20*time.Millisecond)
+	tr := New(nil, WithMaxPerHost(8), WithAdaptive(2))
+	c := &http.Client{Transport: tr}
+
+	srv.status.Store(http.StatusTooManyRequests)
+	get(t, c, srv.URL, 1)
+	get(t, c, srv.URL, 1)
+
+	// Throttled responses keep the limit at 2
+	srv.peak.Store(0)
+	get(t, c, srv.URL, 10)
+
+	if peak := srv.peak.Load(); peak != 2 {
+		t.Errorf("peak concurrency = %d, want the lowered limit 2", peak)
+	}
+}
+
+func TestLimitLoweredWhileInFlight(t *testing.T) {
+	h := newHost(config{maxPerHost: 4, minPerHost: 1})
+
+	var held []*slot
+	for i := 0; i < 4; i++ {
+		s, err := h.acquire(context.Background(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, s)
+	}
+
+	h.observe(http.StatusTooManyRequests)
+	for _, s := range held {
+		h.release(s)
+	}
+
+	// Two slots were parked as they came back
+	for i := 0; i < 2; i++ {
+		if _, err := h.pool.TryAcquire(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.pool.TryAcquire(); err == nil {
+		t.Error("only the lowered limit of 2 slots should be available")
+	}
+}
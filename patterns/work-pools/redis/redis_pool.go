@@ -1,10 +1,15 @@
 package redispool
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"time"
 
+	"github.com/Alan-333333/go-channel-patterns/patterns/backoff"
+	"github.com/Alan-333333/go-channel-patterns/patterns/circuitbreaker"
+	"github.com/Alan-333333/go-channel-patterns/patterns/clock"
+	ratelimit "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic"
 	"github.com/go-redis/redis"
 )
 
@@ -16,81 +21,196 @@ type RedisConn struct {
 }
 
 // RedisConnectionPool manages a set of Redis connections.
+// It is a typed wrapper over generic.Pool.
 type RedisConnectionPool struct {
-	conns chan *RedisConn
-
-	maxConnections int
-	minConnections int
+	pool *generic.Pool[*RedisConn]
 
 	waitTimeout time.Duration
 
+	// clock times heartbeats, expiry and dial retries
+	clock clock.Clock
+
+	// dialLimiter paces every OpenConnection call, if set
+	dialLimiter ratelimit.Limiter
+
 	OpenConnection func() (*RedisConn, error)
 
-	cleanupTicker *time.Ticker
+	// Breaker guards OpenConnection if set
+	Breaker *circuitbreaker.Breaker
+
+	// DialRetries is how many times a failed OpenConnection is tried again,
+	// waiting DialBackoff in between. Retries stop when the Breaker is open
+	DialRetries int
+
+	// DialBackoff paces the retries, each dial uses its own copy
+	DialBackoff backoff.Backoff
+}
+
+// Stats is a snapshot of the pool's gauges and counters.
+type Stats struct {
+	Idle            int    // Connections waiting in the pool
+	InUse           int    // Connections acquired and not yet released
+	Waiters         int    // Callers blocked in Acquire
+	AcquireTimeouts uint64 // Acquire calls that timed out
+	Dials           uint64 // Connections opened
+	ExpiredClosed   uint64 // Connections closed because they expired
+}
+
+// Option configures a RedisConnectionPool
+type Option func(*RedisConnectionPool)
+
+// WithClock sets the clock timing heartbeats, expiry, dial retries and the cleanup
+// The default is the system clock
+func WithClock(c clock.Clock) Option {
+	return func(pool *RedisConnectionPool) {
+		pool.clock = c
+	}
+}
+
+// WithDialLimiter makes every OpenConnection call wait for l first
+// Share l between pools to throttle the dials of the whole process
+// The wait ends with the context of the dial
+func WithDialLimiter(l ratelimit.Limiter) Option {
+	return func(pool *RedisConnectionPool) {
+		pool.dialLimiter = l
+	}
 }
 
 // New Creates a new Redis connection pool
-func New(maxConn, minConn int, waitTimeout time.Duration) *RedisConnectionPool {
-	return &RedisConnectionPool{
-		conns:          make(chan *RedisConn, maxConn),
-		maxConnections: maxConn,
-		minConnections: minConn,
-		waitTimeout:    waitTimeout,
+// Connections are opened on demand, up to maxConn
+func New(maxConn, minConn int, waitTimeout time.Duration, opts ...Option) *RedisConnectionPool {
+	pool := &RedisConnectionPool{waitTimeout: waitTimeout, clock: clock.New()}
+	for _, opt := range opts {
+		opt(pool)
 	}
+
+	pool.pool = generic.New(generic.Config[*RedisConn]{
+		Factory: func(ctx context.Context) (*RedisConn, error) {
+			conn, err := pool.dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if conn.HeartBeat.IsZero() {
+				conn.HeartBeat = pool.clock.Now()
+			}
+			return conn, nil
+		},
+		Validate: func(conn *RedisConn) bool {
+			return !pool.isConnectionExpired(conn)
+		},
+		Destroy: func(conn *RedisConn) {
+			if conn.Conn != nil {
+				conn.Conn.Close()
+			}
+		},
+		MaxSize:     maxConn,
+		MinIdle:     minConn,
+		WaitTimeout: waitTimeout,
+		Clock:       pool.clock,
+	})
+	return pool
 }
 
 // Open Initialize the connection pool
+// It opens the minimum number of connections and cleans up every minute
 func (pool *RedisConnectionPool) Open() error {
-	// Open the maximum number of connections
-	for i := 0; i < pool.maxConnections; i++ {
-		conn, err := pool.OpenConnection()
-		if err != nil {
-			return err
-		}
-		if conn.HeartBeat.IsZero() {
-			conn.HeartBeat = time.Now()
-		}
-		pool.conns <- conn
+	return pool.pool.Open(context.Background())
+}
+
+// Acquire Acquire a connection
+// Expired idle connections are closed and replaced
+func (pool *RedisConnectionPool) Acquire() (*RedisConn, error) {
+	return pool.pool.Acquire()
+}
+
+// AcquireContext Acquire a connection, waiting until ctx is done
+func (pool *RedisConnectionPool) AcquireContext(ctx context.Context) (*RedisConn, error) {
+	return pool.pool.AcquireContext(ctx)
+}
+
+// TryAcquire Acquire a connection without waiting
+// It returns generic.ErrExhausted if all are in use
+func (pool *RedisConnectionPool) TryAcquire() (*RedisConn, error) {
+	return pool.pool.TryAcquire()
+}
+
+// Do runs fn with a pooled connection, waiting for one until ctx is done
+// or the wait timeout, and releases it afterwards
+// A connection whose use panicked is discarded
+func (pool *RedisConnectionPool) Do(ctx context.Context, fn func(conn *RedisConn) error) error {
+	acquireCtx := ctx
+	if pool.waitTimeout > 0 {
+		var cancel context.CancelFunc
+		acquireCtx, cancel = context.WithTimeout(ctx, pool.waitTimeout)
+		defer cancel()
 	}
 
-	// Start a goroutine to periodically clean up expired connections.
-	pool.cleanupTicker = time.NewTicker(time.Minute)
-	go func() {
-		for range pool.cleanupTicker.C {
-			pool.Cleaner()
+	conn, err := pool.pool.AcquireContext(acquireCtx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			pool.Discard(conn)
+			panic(r)
 		}
+		pool.Release(conn)
 	}()
 
-	return nil
+	return fn(conn)
 }
 
-// Acquire Acquire a connection
-func (pool *RedisConnectionPool) Acquire() (*RedisConn, error) {
-	select {
-	case conn := <-pool.conns:
-		// Check if the connection has expired
-		if pool.isConnectionExpired(conn) {
-			conn.Conn.Close()
-			return nil, errors.New("connection expired")
-		}
-		return conn, nil
-	case <-time.After(pool.waitTimeout):
-		return nil, fmt.Errorf("timeout waiting for connection")
+// Release releases connections to the pool
+func (pool *RedisConnectionPool) Release(conn *RedisConn) {
+	conn.HeartBeat = pool.clock.Now()
+	pool.pool.Release(conn)
+}
+
+// Discard closes a broken connection instead of releasing it
+func (pool *RedisConnectionPool) Discard(conn *RedisConn) {
+	pool.pool.Discard(conn)
+}
+
+// DetectLeaks reports connections held longer than threshold during cleanup
+func (pool *RedisConnectionPool) DetectLeaks(threshold time.Duration, onLeak func(generic.Leak[*RedisConn])) {
+	pool.pool.DetectLeaks(threshold, onLeak)
+}
+
+// Stats returns a snapshot of the pool's gauges and counters
+// It only reads atomics, so metrics scrapers can call it at any time
+func (pool *RedisConnectionPool) Stats() Stats {
+	s := pool.pool.Stats()
+	return Stats{
+		Idle:            s.Idle,
+		InUse:           s.InUse,
+		Waiters:         s.Waiters,
+		AcquireTimeouts: s.AcquireTimeouts,
+		Dials:           s.Dials,
+		ExpiredClosed:   s.Expired,
 	}
 }
 
-// Release releases connections to the pool
-func (pool *RedisConnectionPool) Release(conn *RedisConn) {
-	conn.HeartBeat = time.Now()
-	pool.conns <- conn
+// StatsMap returns Stats as named values, for publishing through expvar
+func (pool *RedisConnectionPool) StatsMap() map[string]int64 {
+	s := pool.Stats()
+	return map[string]int64{
+		"idle":             int64(s.Idle),
+		"in_use":           int64(s.InUse),
+		"waiters":          int64(s.Waiters),
+		"acquire_timeouts": int64(s.AcquireTimeouts),
+		"dials":            int64(s.Dials),
+		"expired_closed":   int64(s.ExpiredClosed),
+	}
 }
 
 // Close closes the connection pool
+// It waits up to the wait timeout for connections in use
 func (pool *RedisConnectionPool) Close() {
-	close(pool.conns)
-	for conn := range pool.conns {
-		conn.Conn.Close()
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), pool.waitTimeout)
+	defer cancel()
+
+	pool.pool.Close(ctx)
 }
 
 // Checker checks if the connection is available
@@ -105,44 +225,52 @@ func (pool *RedisConnectionPool) Cleaner() {
 	pool.MaintainMinConnections()
 }
 
-// CloseExpiredConnections Close expired connections
+// CloseExpiredConnections Close expired idle connections
 func (pool *RedisConnectionPool) CloseExpiredConnections() {
-	const timePerConn = 10 * time.Millisecond
-
-	var timeout = time.Duration(len(pool.conns)) * timePerConn
-
-	newConns := make(chan *RedisConn)
-	// Loop to close expired connections
-	for {
-		select {
-		case conn := <-pool.conns:
-			if !conn.HeartBeat.Add(conn.TimeOut).Before(time.Now()) {
-				newConns <- conn
-			} else {
-				conn.Conn.Close()
-			}
+	pool.pool.EvictExpired()
+}
 
-		case <-time.After(timeout):
-			// over time return
-			pool.conns = newConns
-			return
+// MaintainMinConnections maintaining minimum number of connections
+func (pool *RedisConnectionPool) MaintainMinConnections() {
+	pool.pool.Fill(context.Background())
+}
+
+// dial opens a connection, retrying up to DialRetries times
+func (pool *RedisConnectionPool) dial(ctx context.Context) (*RedisConn, error) {
+	b := pool.DialBackoff
+	for retry := 0; ; retry++ {
+		conn, err := pool.dialOnce(ctx)
+		if err == nil || retry >= pool.DialRetries || errors.Is(err, circuitbreaker.ErrOpen) {
+			return conn, err
+		}
+		if err := pool.clock.Sleep(ctx, b.Next()); err != nil {
+			return nil, err
 		}
 	}
 }
 
-// MaintainMinConnections maintaining minimum number of connections
-func (pool *RedisConnectionPool) MaintainMinConnections() {
-	// Loop to open connections
-	for i := len(pool.conns); i < pool.minConnections; i++ {
-		conn, err := pool.OpenConnection()
-		if err != nil {
-			continue
+// dialOnce opens a connection through the dial limiter and the Breaker, if set
+func (pool *RedisConnectionPool) dialOnce(ctx context.Context) (*RedisConn, error) {
+	if pool.dialLimiter != nil {
+		if err := pool.dialLimiter.Wait(ctx); err != nil {
+			return nil, err
 		}
-		pool.conns <- conn
 	}
+
+	if pool.Breaker == nil {
+		return pool.OpenConnection()
+	}
+
+	var conn *RedisConn
+	err := pool.Breaker.Execute(ctx, func(context.Context) error {
+		var err error
+		conn, err = pool.OpenConnection()
+		return err
+	})
+	return conn, err
 }
 
 // isConnectionExpired Check if the connection has expired
 func (pool *RedisConnectionPool) isConnectionExpired(conn *RedisConn) bool {
-	return conn.HeartBeat.Add(conn.TimeOut).Before(time.Now())
+	return conn.HeartBeat.Add(conn.TimeOut).Before(pool.clock.Now())
 }
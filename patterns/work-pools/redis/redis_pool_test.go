@@ -0,0 +1,94 @@
+package redispool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tokenbucket "github.com/Alan-333333/go-channel-patterns/patterns/rate-limiting/token_bucket"
+	"github.com/Alan-333333/go-channel-patterns/patterns/work-pools/generic/pooltest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func TestSuite(t *testing.T) {
+	pooltest.Run(t, func(t *testing.T, maxSize, minIdle int, waitTimeout time.Duration) (pooltest.Pool[*RedisConn], func() int) {
+		var dials int32
+		pool := New(maxSize, minIdle, waitTimeout)
+		pool.OpenConnection = func() (*RedisConn, error) {
+			atomic.AddInt32(&dials, 1)
+			return &RedisConn{TimeOut: time.Hour}, nil
+		}
+		if err := pool.Open(); err != nil {
+			t.Fatal(err)
+		}
+		return pool, func() int { return int(atomic.LoadInt32(&dials)) }
+	})
+}
+
+func TestDo(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	pool := New(2, 0, time.Second)
+	pool.OpenConnection = func() (*RedisConn, error) {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		return &RedisConn{Conn: client, TimeOut: time.Hour}, nil
+	}
+	defer pool.Close()
+
+	err := pool.Do(context.Background(), func(conn *RedisConn) error {
+		return conn.Conn.Set("key", "value", 0).Err()
+	})
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	if got, _ := server.Get("key"); got != "value" {
+		t.Errorf("key = %q, want value", got)
+	}
+
+	// The connection went back to the pool
+	if s := pool.Stats(); s.InUse != 0 || s.Idle != 1 {
+		t.Errorf("Stats() = %+v after Do, want 1 idle", s)
+	}
+
+	// A connection whose use panicked is discarded
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Do should pass the panic on")
+			}
+		}()
+		pool.Do(context.Background(), func(*RedisConn) error {
+			panic("boom")
+		})
+	}()
+	if s := pool.Stats(); s.InUse != 0 || s.Idle != 0 {
+		t.Errorf("Stats() = %+v after a panic, want empty", s)
+	}
+}
+
+func TestDialLimiter(t *testing.T) {
+	bucket := tokenbucket.New(100, 1)
+	defer bucket.Close()
+
+	var dials int32
+	pool := New(5, 5, time.Second, WithDialLimiter(bucket))
+	pool.OpenConnection = func() (*RedisConn, error) {
+		atomic.AddInt32(&dials, 1)
+		return &RedisConn{TimeOut: time.Hour}, nil
+	}
+	defer pool.Close()
+
+	// 5 dials at 100 per second take about 50ms
+	start := time.Now()
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("5 dials took %v, want about 50ms", elapsed)
+	}
+	if n := atomic.LoadInt32(&dials); n != 5 {
+		t.Errorf("dialed %d times, want 5", n)
+	}
+}
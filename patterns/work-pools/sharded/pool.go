@@ -0,0 +1,199 @@
+// Package sharded implements a worker pool that routes items to shards by
+// key, so items with the same key are handled in order by one goroutine.
+package sharded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPoolClosed is returned by Submit after Shutdown has been called.
+var ErrPoolClosed = errors.New("sharded pool is shut down")
+
+// PanicError is the error recorded for an item whose handler panicked.
+type PanicError struct {
+
+	// Value is the value passed to panic.
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// ShardStats is a snapshot of one shard's queue and counters.
+type ShardStats struct {
+	Depth     int    // Items queued and not yet handled
+	Processed uint64 // Items handled, including failed ones
+	Errors    uint64 // Items whose handler failed or panicked
+}
+
+// shard is a queue drained by a single goroutine.
+type shard[T any] struct {
+	items     chan item[T]
+	processed atomic.Uint64
+	errors    atomic.Uint64
+}
+
+type item[T any] struct {
+	key   string
+	value T
+}
+
+// Pool runs one goroutine per shard. Items are routed to a shard by the
+// FNV hash of their key, so items with the same key are handled one at a
+// time, in the order they were submitted.
+type Pool[T any] struct {
+	handler func(key string, item T) error
+	shards  []*shard[T]
+
+	// mu guards closed; submitting tracks Submit calls in progress, so
+	// the queues are only closed once none can send on them.
+	mu         sync.RWMutex
+	closed     bool
+	submitting sync.WaitGroup
+
+	// quit is closed by Shutdown to unblock pending Submit calls.
+	quit chan struct{}
+
+	// done is closed once every shard has drained.
+	done chan struct{}
+
+	shutdownOnce sync.Once
+}
+
+// New creates a pool with the given number of shards, each queueing up to
+// queueSize items, and starts a goroutine per shard. Each item is handled
+// by handler.
+func New[T any](shards, queueSize int, handler func(key string, item T) error) *Pool[T] {
+	if shards <= 0 {
+		shards = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &Pool[T]{
+		handler: handler,
+		shards:  make([]*shard[T], shards),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	for i := range p.shards {
+		s := &shard[T]{items: make(chan item[T], queueSize)}
+		p.shards[i] = s
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(s)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(p.done)
+	}()
+
+	return p
+}
+
+// Shards returns the number of shards.
+func (p *Pool[T]) Shards() int {
+	return len(p.shards)
+}
+
+// ShardFor returns the index of the shard handling key.
+func (p *Pool[T]) ShardFor(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+// Submit queues item on the shard for key, blocking while that shard's
+// queue is full. It returns ErrPoolClosed after Shutdown, or the context
+// error if ctx is done first.
+func (p *Pool[T]) Submit(ctx context.Context, key string, value T) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrPoolClosed
+	}
+	p.submitting.Add(1)
+	p.mu.RUnlock()
+	defer p.submitting.Done()
+
+	s := p.shards[p.ShardFor(key)]
+	select {
+	case s.items <- item[T]{key: key, value: value}:
+		return nil
+	case <-p.quit:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of every shard, indexed like ShardFor.
+func (p *Pool[T]) Stats() []ShardStats {
+	stats := make([]ShardStats, len(p.shards))
+	for i, s := range p.shards {
+		stats[i] = ShardStats{
+			Depth:     len(s.items),
+			Processed: s.processed.Load(),
+			Errors:    s.errors.Load(),
+		}
+	}
+	return stats
+}
+
+// Shutdown stops accepting items and waits for every shard to drain its
+// queue. If ctx is done first it returns the context error; the shards
+// keep draining in the background.
+func (p *Pool[T]) Shutdown(ctx context.Context) error {
+	p.shutdownOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		close(p.quit)
+		p.mu.Unlock()
+
+		// No Submit can send once the in-flight ones have returned
+		p.submitting.Wait()
+		for _, s := range p.shards {
+			close(s.items)
+		}
+	})
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work handles a shard's items until its queue is closed and drained.
+func (p *Pool[T]) work(s *shard[T]) {
+	for it := range s.items {
+		if err := p.handle(it); err != nil {
+			s.errors.Add(1)
+		}
+		s.processed.Add(1)
+	}
+}
+
+// handle runs the handler on it, turning a panic into a *PanicError.
+func (p *Pool[T]) handle(it item[T]) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v}
+		}
+	}()
+	return p.handler(it.key, it.value)
+}
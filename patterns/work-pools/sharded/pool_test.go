@@ -0,0 +1,183 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPerKeyOrdering(t *testing.T) {
+	const keys, perKey = 20, 200
+
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	p := New(4, 8, func(key string, n int) error {
+		mu.Lock()
+		seen[key] = append(seen[key], n)
+		mu.Unlock()
+		return nil
+	})
+
+	// One submitter per key, all running at once
+	var wg sync.WaitGroup
+	for k := 0; k < keys; k++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 0; i < perKey; i++ {
+				if err := p.Submit(context.Background(), key, i); err != nil {
+					t.Errorf("Submit() = %v", err)
+				}
+			}
+		}(fmt.Sprintf("key-%d", k))
+	}
+	wg.Wait()
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, got := range seen {
+		if len(got) != perKey {
+			t.Fatalf("%s: handled %d items, want %d", key, len(got), perKey)
+		}
+		for i, n := range got {
+			if n != i {
+				t.Fatalf("%s: item %d handled at position %d", key, n, i)
+			}
+		}
+	}
+}
+
+func TestEvenDistribution(t *testing.T) {
+	const shards, keys = 16, 16000
+
+	p := New(shards, keys, func(string, int) error { return nil })
+	for i := 0; i < keys; i++ {
+		p.Submit(context.Background(), fmt.Sprintf("user-%d", i), i)
+	}
+	p.Shutdown(context.Background())
+
+	// Every shard gets within 15% of its fair share
+	want := keys / shards
+	for i, s := range p.Stats() {
+		if s.Processed < uint64(want*85/100) || s.Processed > uint64(want*115/100) {
+			t.Errorf("shard %d processed %d items, want about %d", i, s.Processed, want)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	release := make(chan struct{})
+	p := New(1, 10, func(_ string, n int) error {
+		<-release
+		if n%2 == 1 {
+			return errors.New("odd")
+		}
+		return nil
+	})
+
+	for i := 0; i < 4; i++ {
+		p.Submit(context.Background(), "k", i)
+	}
+
+	// The first item is being handled, the rest are queued
+	time.Sleep(10 * time.Millisecond)
+	if d := p.Stats()[0].Depth; d != 3 {
+		t.Errorf("Depth = %d, want 3", d)
+	}
+
+	close(release)
+	p.Shutdown(context.Background())
+
+	s := p.Stats()[0]
+	if s.Processed != 4 || s.Errors != 2 || s.Depth != 0 {
+		t.Errorf("Stats() = %+v, want 4 processed, 2 errors, empty queue", s)
+	}
+}
+
+func TestPanicCountsAsError(t *testing.T) {
+	p := New(1, 1, func(string, int) error { panic("oops") })
+
+	p.Submit(context.Background(), "k", 1)
+	p.Shutdown(context.Background())
+
+	if s := p.Stats()[0]; s.Errors != 1 {
+		t.Errorf("Errors = %d, want 1", s.Errors)
+	}
+}
+
+func TestShards(t *testing.T) {
+	p := New(8, 1, func(string, int) error { return nil })
+	defer p.Shutdown(context.Background())
+
+	if p.Shards() != 8 {
+		t.Errorf("Shards() = %d, want 8", p.Shards())
+	}
+	if p.ShardFor("a") != p.ShardFor("a") {
+		t.Error("ShardFor should be stable")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var handled int32
+	p := New(2, 10, func(string, int) error {
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&handled, 1)
+		return nil
+	})
+
+	for i := 0; i < 10; i++ {
+		p.Submit(context.Background(), fmt.Sprint(i), i)
+	}
+
+	// Shutdown drains every shard
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&handled); n != 10 {
+		t.Errorf("handled %d items, want 10", n)
+	}
+
+	if err := p.Submit(context.Background(), "k", 1); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit() = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	p := New(1, 1, func(string, int) error {
+		<-release
+		return nil
+	})
+	p.Submit(context.Background(), "k", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSubmitCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	p := New(1, 0, func(string, int) error {
+		<-release
+		return nil
+	})
+	p.Submit(context.Background(), "k", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, "k", 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,427 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSamples bounds the timings kept between two decisions.
+const maxSamples = 4096
+
+// ScaleReason tells why an AutoScaler changed the number of workers.
+type ScaleReason int
+
+const (
+	// ScaleUpQueueWait means tasks waited in the queue longer than the
+	// target.
+	ScaleUpQueueWait ScaleReason = iota
+
+	// ScaleUpLatency means tasks took longer than the latency target from
+	// submission to completion.
+	ScaleUpLatency
+
+	// ScaleDownIdle means workers were idle beyond the target
+	// utilization.
+	ScaleDownIdle
+)
+
+// String returns the name of the reason.
+func (r ScaleReason) String() string {
+	switch r {
+	case ScaleUpQueueWait:
+		return "queue-wait"
+	case ScaleUpLatency:
+		return "latency"
+	case ScaleDownIdle:
+		return "idle"
+	default:
+		return fmt.Sprintf("ScaleReason(%d)", int(r))
+	}
+}
+
+// Decision records a change of the number of workers, with the
+// measurements that led to it.
+type Decision struct {
+	At          time.Time
+	From        int
+	To          int
+	Reason      ScaleReason
+	QueueWait   time.Duration // Queue wait at the quantile
+	Latency     time.Duration // Submission to completion at the quantile
+	Utilization float64       // Busy fraction of the workers
+	Queued      int           // Tasks in the queue
+}
+
+// ScalerStats is a snapshot of an AutoScaler.
+type ScalerStats struct {
+	Workers     int           // Running workers
+	Min         int           // Fewest workers allowed
+	Max         int           // Most workers allowed
+	QueueWait   time.Duration // Queue wait at the quantile, last interval
+	Latency     time.Duration // Submission to completion at the quantile, last interval
+	Utilization float64       // Busy fraction of the workers, last interval
+	Samples     uint64        // Tasks timed since the scaler was attached
+	Decisions   []Decision    // Latest decisions, oldest first
+}
+
+// Clock supplies the current time to an AutoScaler.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock uses the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// ScalerOption configures an AutoScaler.
+type ScalerOption func(*scalerConfig)
+
+type scalerConfig struct {
+	min, max     int
+	interval     time.Duration
+	upCooldown   time.Duration
+	downCooldown time.Duration
+	gain         float64
+	quantile     float64
+	latency      time.Duration
+	utilization  float64
+	history      int
+	clock        Clock
+}
+
+// WithBounds keeps the number of workers within [min, max]. The default
+// is from 1 to four times the workers of the pool when attached.
+func WithBounds(min, max int) ScalerOption {
+	return func(c *scalerConfig) {
+		c.min = min
+		c.max = max
+	}
+}
+
+// WithInterval sets how often the scaler decides. The default is 1s.
+func WithInterval(d time.Duration) ScalerOption {
+	return func(c *scalerConfig) {
+		c.interval = d
+	}
+}
+
+// WithCooldown sets how long after a change the scaler waits before
+// adding, and before removing, workers. The default is one interval to
+// add and five to remove.
+func WithCooldown(up, down time.Duration) ScalerOption {
+	return func(c *scalerConfig) {
+		c.upCooldown = up
+		c.downCooldown = down
+	}
+}
+
+// WithGain sets the proportional gain: the share of the measured error
+// corrected in one decision. The default is 0.5.
+func WithGain(k float64) ScalerOption {
+	return func(c *scalerConfig) {
+		c.gain = k
+	}
+}
+
+// WithQuantile sets the quantile of the timings compared to the targets.
+// The default is 0.95.
+func WithQuantile(q float64) ScalerOption {
+	return func(c *scalerConfig) {
+		c.quantile = q
+	}
+}
+
+// WithLatencyTarget also adds workers when tasks take longer than d from
+// submission to completion. Only the queue wait part of it shrinks with
+// more workers, so d must leave room for the task itself. It is off by
+// default.
+func WithLatencyTarget(d time.Duration) ScalerOption {
+	return func(c *scalerConfig) {
+		c.latency = d
+	}
+}
+
+// WithUtilization sets the busy fraction the scaler sizes the pool for
+// when removing workers. The default is 0.75.
+func WithUtilization(u float64) ScalerOption {
+	return func(c *scalerConfig) {
+		c.utilization = u
+	}
+}
+
+// WithHistory sets how many decisions Stats keeps. The default is 32.
+func WithHistory(n int) ScalerOption {
+	return func(c *scalerConfig) {
+		c.history = n
+	}
+}
+
+// WithClock sets the clock used to measure intervals and cooldowns, for
+// tests.
+func WithClock(clock Clock) ScalerOption {
+	return func(c *scalerConfig) {
+		c.clock = clock
+	}
+}
+
+// resizer is the part of a Pool an AutoScaler drives.
+type resizer interface {
+	Workers() int
+	SetWorkers(n int)
+	queued() int
+}
+
+// AutoScaler adds and removes workers of a Pool to keep the queue wait
+// of its tasks under a target.
+//
+// Each interval it compares the quantile of the queue waits to the target
+// and grows the pool in proportion to the excess, at most doubling it.
+// Once the waits are under half the target, it shrinks the pool towards
+// the size that keeps the workers busy at the target utilization.
+type AutoScaler struct {
+	pool   resizer
+	detach func()
+	target time.Duration
+	cfg    scalerConfig
+
+	// mu guards the fields below.
+	mu         sync.Mutex
+	waits      []time.Duration
+	latencies  []time.Duration
+	busy       time.Duration
+	samples    uint64
+	lastStep   time.Time
+	lastChange time.Time
+	last       Decision
+	decisions  []Decision
+}
+
+// NewAutoScaler attaches an AutoScaler to p, keeping the queue wait of
+// its tasks under target. Call Run to start scaling.
+func NewAutoScaler[T, R any](p *Pool[T, R], target time.Duration, opts ...ScalerOption) (*AutoScaler, error) {
+	a, err := newAutoScaler(p, target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	a.detach = func() { p.scaler.CompareAndSwap(a, nil) }
+	p.scaler.Store(a)
+	return a, nil
+}
+
+// newAutoScaler creates an AutoScaler driving pool, without attaching it.
+func newAutoScaler(pool resizer, target time.Duration, opts ...ScalerOption) (*AutoScaler, error) {
+	cfg := scalerConfig{
+		min:         1,
+		max:         4 * pool.Workers(),
+		interval:    time.Second,
+		gain:        0.5,
+		quantile:    0.95,
+		utilization: 0.75,
+		history:     32,
+		clock:       realClock{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.upCooldown == 0 {
+		cfg.upCooldown = cfg.interval
+	}
+	if cfg.downCooldown == 0 {
+		cfg.downCooldown = 5 * cfg.interval
+	}
+
+	if target <= 0 {
+		return nil, fmt.Errorf("target must be positive")
+	}
+	if cfg.min <= 0 || cfg.max < cfg.min {
+		return nil, fmt.Errorf("bounds must satisfy 0 < min <= max")
+	}
+	if cfg.interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+	if cfg.gain <= 0 {
+		return nil, fmt.Errorf("gain must be positive")
+	}
+	if cfg.quantile <= 0 || cfg.quantile > 1 {
+		return nil, fmt.Errorf("quantile must be in (0, 1]")
+	}
+	if cfg.utilization <= 0 || cfg.utilization > 1 {
+		return nil, fmt.Errorf("utilization must be in (0, 1]")
+	}
+
+	return &AutoScaler{
+		pool:     pool,
+		detach:   func() {},
+		target:   target,
+		cfg:      cfg,
+		lastStep: cfg.clock.Now(),
+	}, nil
+}
+
+// Run decides every interval until ctx is done, then detaches the scaler
+// from the pool.
+func (a *AutoScaler) Run(ctx context.Context) {
+	defer a.detach()
+
+	ticker := time.NewTicker(a.cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.step()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats returns the latest measurements and decisions.
+func (a *AutoScaler) Stats() ScalerStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return ScalerStats{
+		Workers:     a.pool.Workers(),
+		Min:         a.cfg.min,
+		Max:         a.cfg.max,
+		QueueWait:   a.last.QueueWait,
+		Latency:     a.last.Latency,
+		Utilization: a.last.Utilization,
+		Samples:     a.samples,
+		Decisions:   append([]Decision(nil), a.decisions...),
+	}
+}
+
+// record adds the timings of a task.
+func (a *AutoScaler) record(wait, run time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.samples++
+	a.busy += run
+
+	// Past the bound, overwrite older timings
+	if len(a.waits) < maxSamples {
+		a.waits = append(a.waits, wait)
+		a.latencies = append(a.latencies, wait+run)
+		return
+	}
+	i := int(a.samples % maxSamples)
+	a.waits[i] = wait
+	a.latencies[i] = wait + run
+}
+
+// step measures the last interval and resizes the pool if needed.
+func (a *AutoScaler) step() {
+	now := a.cfg.clock.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := a.pool.Workers()
+	m := Decision{
+		At:        now,
+		From:      n,
+		QueueWait: quantile(a.waits, a.cfg.quantile),
+		Latency:   quantile(a.latencies, a.cfg.quantile),
+		Queued:    a.pool.queued(),
+	}
+	if elapsed := now.Sub(a.lastStep); elapsed > 0 && n > 0 {
+		m.Utilization = float64(a.busy) / float64(elapsed) / float64(n)
+	}
+	a.last = m
+	a.waits = a.waits[:0]
+	a.latencies = a.latencies[:0]
+	a.busy = 0
+	a.lastStep = now
+
+	next, reason := a.decide(n, m, now)
+	if next == n {
+		return
+	}
+
+	m.To = next
+	m.Reason = reason
+	a.lastChange = now
+	if a.cfg.history > 0 {
+		if len(a.decisions) == a.cfg.history {
+			copy(a.decisions, a.decisions[1:])
+			a.decisions = a.decisions[:len(a.decisions)-1]
+		}
+		a.decisions = append(a.decisions, m)
+	}
+	a.pool.SetWorkers(next)
+}
+
+// decide returns the number of workers for the measurements m of n
+// workers. Caller must hold the lock.
+func (a *AutoScaler) decide(n int, m Decision, now time.Time) (int, ScaleReason) {
+	since := now.Sub(a.lastChange)
+
+	// How far over target the worst measurement is
+	ratio := float64(m.QueueWait) / float64(a.target)
+	reason := ScaleUpQueueWait
+	if a.cfg.latency > 0 {
+		if r := float64(m.Latency) / float64(a.cfg.latency); r > ratio {
+			ratio = r
+			reason = ScaleUpLatency
+		}
+	}
+
+	next := n
+	switch {
+	case ratio > 1:
+		if since < a.cfg.upCooldown {
+			return n, reason
+		}
+		grow := a.cfg.gain * (ratio - 1)
+		if grow > 1 {
+			grow = 1
+		}
+		next = n + int(math.Ceil(float64(n)*grow))
+
+	case ratio <= 0.5:
+		// Only shrink well under target, so a pool sized just right does
+		// not flap. Tasks still queued have waits not measured yet.
+		if since < a.cfg.downCooldown || m.Queued > 0 {
+			return n, ScaleDownIdle
+		}
+		needed := int(math.Ceil(m.Utilization * float64(n) / a.cfg.utilization))
+		if needed >= n {
+			return n, ScaleDownIdle
+		}
+		next = n - int(math.Ceil(a.cfg.gain*float64(n-needed)))
+		reason = ScaleDownIdle
+	}
+
+	if next < a.cfg.min {
+		next = a.cfg.min
+	}
+	if next > a.cfg.max {
+		next = a.cfg.max
+	}
+	return next, reason
+}
+
+// quantile returns the q quantile of ds, or zero if ds is empty. It sorts
+// ds.
+func quantile(ds []time.Duration, q float64) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	i := int(math.Ceil(q*float64(len(ds)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return ds[i]
+}
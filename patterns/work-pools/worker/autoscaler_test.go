@@ -0,0 +1,358 @@
+package worker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// simPool is a simulated pool: tasks arrive evenly at a fixed rate and
+// each takes the current service time on the worker free first.
+type simPool struct {
+	service time.Duration
+	rate    float64 // Tasks per second
+
+	free   []time.Time // When each worker is free
+	starts []time.Time // Start of the tasks assigned, in order
+	next   time.Time   // Arrival of the next task
+}
+
+func newSimPool(workers int, service time.Duration, rate float64, now time.Time) *simPool {
+	p := &simPool{service: service, rate: rate, next: now}
+	p.SetWorkers(workers)
+	return p
+}
+
+func (p *simPool) Workers() int { return len(p.free) }
+
+func (p *simPool) SetWorkers(n int) {
+	sort.Slice(p.free, func(i, j int) bool { return p.free[i].Before(p.free[j]) })
+	for len(p.free) < n {
+		p.free = append(p.free, p.next)
+	}
+
+	// Idle workers go first
+	p.free = p.free[len(p.free)-n:]
+}
+
+// queued counts the tasks assigned but not started at the last arrival.
+func (p *simPool) queued() int {
+	n := 0
+	for _, s := range p.starts {
+		if s.After(p.next) {
+			n++
+		}
+	}
+	return n
+}
+
+// tick simulates the arrivals until now, recording the timings of each
+// task.
+func (p *simPool) tick(a *AutoScaler, now time.Time) {
+	gap := time.Duration(float64(time.Second) / p.rate)
+	p.starts = p.starts[:0]
+	for ; !p.next.After(now); p.next = p.next.Add(gap) {
+		// The worker free first takes the task
+		w := 0
+		for i := range p.free {
+			if p.free[i].Before(p.free[w]) {
+				w = i
+			}
+		}
+		start := p.next
+		if p.free[w].After(start) {
+			start = p.free[w]
+		}
+		p.free[w] = start.Add(p.service)
+		p.starts = append(p.starts, start)
+
+		a.record(start.Sub(p.next), p.service)
+	}
+}
+
+// simulate runs the pool for d, one interval at a time, and returns the
+// workers after each interval.
+func simulate(a *AutoScaler, p *simPool, clock *fakeClock, d, interval time.Duration) []int {
+	var workers []int
+	for elapsed := time.Duration(0); elapsed < d; elapsed += interval {
+		clock.Add(interval)
+		p.tick(a, clock.Now())
+		a.step()
+		workers = append(workers, p.Workers())
+	}
+	return workers
+}
+
+// changes counts the changes of direction in workers.
+func changes(workers []int) int {
+	n, dir := 0, 0
+	for i := 1; i < len(workers); i++ {
+		d := workers[i] - workers[i-1]
+		if d == 0 {
+			continue
+		}
+		if dir != 0 && (d > 0) != (dir > 0) {
+			n++
+		}
+		dir = d
+	}
+	return n
+}
+
+func TestAutoScalerConverges(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	interval := 100 * time.Millisecond
+	p := newSimPool(2, 20*time.Millisecond, 200, clock.Now())
+
+	a, err := newAutoScaler(p, 50*time.Millisecond,
+		WithBounds(1, 64), WithInterval(interval), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 200 tasks/s of 20ms keep 4 workers busy
+	workers := simulate(a, p, clock, 10*time.Second, interval)
+	settled := workers[len(workers)/2:]
+	for _, n := range settled {
+		if n < 4 || n > 10 {
+			t.Fatalf("workers = %v, want 4-10 once settled", workers)
+		}
+	}
+
+	// Tasks get four times slower: 16 workers are needed
+	p.service = 80 * time.Millisecond
+	workers = simulate(a, p, clock, 20*time.Second, interval)
+	settled = workers[len(workers)/2:]
+	for _, n := range settled {
+		if n < 16 || n > 40 {
+			t.Fatalf("workers = %v, want 16-40 once settled", workers)
+		}
+	}
+	if c := changes(workers); c > 2 {
+		t.Errorf("workers changed direction %d times: %v", c, workers)
+	}
+	if q := p.queued(); q > 20 {
+		t.Errorf("queue = %d once settled, want it drained", q)
+	}
+
+	// And fast again: the pool shrinks back
+	p.service = 20 * time.Millisecond
+	workers = simulate(a, p, clock, 20*time.Second, interval)
+	settled = workers[len(workers)/2:]
+	for _, n := range settled {
+		if n < 4 || n > 10 {
+			t.Fatalf("workers = %v, want 4-10 once settled", workers)
+		}
+	}
+	if c := changes(workers); c > 2 {
+		t.Errorf("workers changed direction %d times: %v", c, workers)
+	}
+
+	stats := a.Stats()
+	if len(stats.Decisions) == 0 || stats.Samples == 0 {
+		t.Errorf("Stats() = %+v, want decisions and samples", stats)
+	}
+	for _, d := range stats.Decisions {
+		if (d.To > d.From) == (d.Reason == ScaleDownIdle) {
+			t.Errorf("decision %+v goes the wrong way for its reason", d)
+		}
+	}
+}
+
+func TestAutoScalerCooldown(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := newSimPool(1, time.Millisecond, 1, clock.Now())
+
+	a, err := newAutoScaler(p, 10*time.Millisecond,
+		WithBounds(1, 100), WithInterval(time.Second), WithCooldown(3*time.Second, 10*time.Second), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every interval the queue wait is far over target
+	for i := 0; i < 6; i++ {
+		clock.Add(time.Second)
+		a.record(time.Second, time.Millisecond)
+		a.step()
+	}
+
+	// Grows at once, then once per cooldown, at most doubling
+	stats := a.Stats()
+	if len(stats.Decisions) != 2 {
+		t.Fatalf("decisions = %+v, want 2", stats.Decisions)
+	}
+	if d := stats.Decisions[0]; d.From != 1 || d.To != 2 || d.Reason != ScaleUpQueueWait {
+		t.Errorf("first decision = %+v, want 1 -> 2 for queue wait", d)
+	}
+	if d := stats.Decisions[1]; d.From != 2 || d.To != 4 {
+		t.Errorf("second decision = %+v, want 2 -> 4", d)
+	}
+}
+
+func TestAutoScalerLatencyTarget(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := newSimPool(2, time.Millisecond, 1, clock.Now())
+
+	a, err := newAutoScaler(p, time.Second,
+		WithLatencyTarget(100*time.Millisecond), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Add(time.Second)
+	a.record(80*time.Millisecond, 70*time.Millisecond)
+	a.step()
+
+	stats := a.Stats()
+	if len(stats.Decisions) != 1 || stats.Decisions[0].Reason != ScaleUpLatency {
+		t.Fatalf("decisions = %+v, want one for latency", stats.Decisions)
+	}
+	if stats.Latency != 150*time.Millisecond || stats.QueueWait != 80*time.Millisecond {
+		t.Errorf("Stats() = %+v, want latency 150ms and queue wait 80ms", stats)
+	}
+}
+
+func TestAutoScalerHoldsWhileQueued(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	p := newSimPool(8, time.Millisecond, 1, clock.Now())
+	p.starts = []time.Time{clock.Now().Add(time.Hour)}
+
+	a, err := newAutoScaler(p, time.Second, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No task completed, but some are queued behind busy workers
+	clock.Add(time.Minute)
+	a.step()
+	if n := p.Workers(); n != 8 {
+		t.Errorf("workers = %d, want 8 while tasks are queued", n)
+	}
+}
+
+func TestNewAutoScalerInvalid(t *testing.T) {
+	p := New(1, 1, double)
+	defer p.Shutdown(context.Background())
+
+	tests := []struct {
+		name   string
+		target time.Duration
+		opts   []ScalerOption
+	}{
+		{"target", 0, nil},
+		{"bounds", time.Second, []ScalerOption{WithBounds(3, 2)}},
+		{"interval", time.Second, []ScalerOption{WithInterval(-1)}},
+		{"gain", time.Second, []ScalerOption{WithGain(0)}},
+		{"quantile", time.Second, []ScalerOption{WithQuantile(2)}},
+		{"utilization", time.Second, []ScalerOption{WithUtilization(0)}},
+	}
+	for _, tt := range tests {
+		if _, err := NewAutoScaler(p, tt.target, tt.opts...); err == nil {
+			t.Errorf("%s: NewAutoScaler() should fail", tt.name)
+		}
+	}
+}
+
+func TestAutoScalerPool(t *testing.T) {
+	p := New(1, 1000, func(_ context.Context, n int) (int, error) {
+		time.Sleep(5 * time.Millisecond)
+		return n, nil
+	})
+	go func() {
+		for range p.Results() {
+		}
+	}()
+
+	a, err := NewAutoScaler(p, 5*time.Millisecond,
+		WithBounds(1, 8), WithInterval(20*time.Millisecond), WithCooldown(20*time.Millisecond, 40*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+
+	// A burst one worker cannot keep up with
+	for i := 0; i < 200; i++ {
+		p.Submit(context.Background(), i)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Workers() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.Workers(); n < 4 {
+		t.Fatalf("workers = %d, want the pool to grow", n)
+	}
+
+	// Once idle, the pool shrinks back
+	deadline = time.Now().Add(3 * time.Second)
+	for p.Workers() > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.Workers(); n != 1 {
+		t.Errorf("workers = %d, want 1 once idle", n)
+	}
+
+	cancel()
+	p.Shutdown(context.Background())
+}
+
+func TestSetWorkers(t *testing.T) {
+	release := make(chan struct{})
+	p := New(4, 10, func(_ context.Context, n int) (int, error) {
+		<-release
+		return n, nil
+	})
+
+	// Busy workers finish their task before exiting
+	p.Submit(context.Background(), 1)
+	p.SetWorkers(1)
+	time.Sleep(10 * time.Millisecond)
+	if n := p.Workers(); n != 1 {
+		t.Errorf("Workers() = %d, want 1", n)
+	}
+
+	p.SetWorkers(3)
+	if n := p.Workers(); n != 3 {
+		t.Errorf("Workers() = %d, want 3", n)
+	}
+
+	for i := 2; i <= 5; i++ {
+		p.Submit(context.Background(), i)
+	}
+	close(release)
+	p.Shutdown(context.Background())
+
+	var n int
+	for range p.Results() {
+		n++
+	}
+	if n != 5 {
+		t.Errorf("results = %d, want 5", n)
+	}
+
+	// Resizing after Shutdown does nothing
+	p.SetWorkers(10)
+	if n := p.Workers(); n != 0 {
+		t.Errorf("Workers() = %d after Shutdown, want 0", n)
+	}
+}
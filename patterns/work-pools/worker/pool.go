@@ -0,0 +1,343 @@
+// Package worker implements a generic goroutine worker pool.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+)
+
+// ErrPoolClosed is returned by Submit after Shutdown has been called.
+var ErrPoolClosed = errors.New("worker pool is shut down")
+
+// PanicError is the error of a task whose handler panicked.
+type PanicError struct {
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+// Result is the outcome of a task.
+type Result[T, R any] struct {
+
+	// Task is the task the result belongs to.
+	Task T
+
+	// Value is the value returned by the handler.
+	Value R
+
+	// Err is the error returned by the handler, or a *PanicError.
+	Err error
+}
+
+// Result returns the value and error without the task.
+func (r Result[T, R]) Result() result.Result[R] {
+	return result.Of(r.Value, r.Err)
+}
+
+// queued is a task with the time it was submitted.
+type queued[T any] struct {
+	task T
+	at   time.Time
+}
+
+// Pool runs tasks of type T on a number of goroutines and delivers
+// results of type R. The number is fixed unless changed with SetWorkers,
+// or by an AutoScaler.
+type Pool[T, R any] struct {
+
+	// handle processes a task.
+	handle func(ctx context.Context, task T) (R, error)
+
+	// tasks queues submitted tasks for the workers.
+	tasks chan queued[T]
+
+	// results delivers the result of every task.
+	results chan Result[T, R]
+
+	// ctx is passed to the handler and cancelled when Shutdown gives up.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards closed; submitting tracks Submit calls in progress, so
+	// tasks is only closed once none can send on it.
+	mu         sync.RWMutex
+	closed     bool
+	submitting sync.WaitGroup
+
+	// wg tracks the workers.
+	wg sync.WaitGroup
+
+	// sizeMu guards workers, target and resized. Workers above target
+	// exit after their current task, or at once when idle, woken by
+	// resized being closed.
+	sizeMu  sync.Mutex
+	workers int
+	target  int
+	resized chan struct{}
+
+	// scaler receives the timings of every task if an AutoScaler is
+	// attached.
+	scaler atomic.Pointer[AutoScaler]
+
+	// quit is closed by Shutdown to unblock pending Submit calls.
+	quit chan struct{}
+
+	// done is closed once every worker has exited.
+	done chan struct{}
+
+	shutdownOnce sync.Once
+}
+
+// New creates a pool with the given number of workers and queue size, and
+// starts the workers. Each task is processed by handle.
+func New[T, R any](workers, queueSize int, handle func(ctx context.Context, task T) (R, error)) *Pool[T, R] {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool[T, R]{
+		handle:  handle,
+		tasks:   make(chan queued[T], queueSize),
+		results: make(chan Result[T, R], queueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		resized: make(chan struct{}),
+	}
+
+	p.sizeMu.Lock()
+	p.target = workers
+	for i := 0; i < workers; i++ {
+		p.spawn()
+	}
+	p.sizeMu.Unlock()
+
+	// Close results once the workers are done with the queue
+	go func() {
+		p.wg.Wait()
+		cancel()
+		close(p.results)
+		close(p.done)
+	}()
+
+	return p
+}
+
+// Submit queues a task, blocking while the queue is full. It returns
+// ErrPoolClosed after Shutdown, or the context error if ctx is done first.
+func (p *Pool[T, R]) Submit(ctx context.Context, task T) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrPoolClosed
+	}
+	p.submitting.Add(1)
+	p.mu.RUnlock()
+	defer p.submitting.Done()
+
+	select {
+	case p.tasks <- queued[T]{task: task, at: time.Now()}:
+		return nil
+	case <-p.quit:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Results returns the channel delivering the result of every task. It is
+// closed after Shutdown once all queued tasks are done. Results must be
+// consumed, or the workers block once the channel's buffer is full.
+func (p *Pool[T, R]) Results() <-chan Result[T, R] {
+	return p.results
+}
+
+// Workers returns the number of running workers. It lags behind
+// SetWorkers while surplus workers finish their current task.
+func (p *Pool[T, R]) Workers() int {
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
+
+	return p.workers
+}
+
+// SetWorkers changes the number of workers to n, at least 1. New workers
+// start at once; surplus ones exit when idle or after their current task.
+// It does nothing after Shutdown.
+func (p *Pool[T, R]) SetWorkers(n int) {
+	if n <= 0 {
+		n = 1
+	}
+
+	// Holding mu keeps Shutdown from closing tasks meanwhile
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
+
+	p.target = n
+	for p.workers < n {
+		p.spawn()
+	}
+
+	// Wake idle workers so surplus ones exit
+	close(p.resized)
+	p.resized = make(chan struct{})
+}
+
+// queued returns the number of tasks in the queue.
+func (p *Pool[T, R]) queued() int {
+	return len(p.tasks)
+}
+
+// Values delivers the results without their tasks, as result.Result, for
+// helpers such as result.Split and result.CollectAll. It reads Results,
+// so use one or the other. The channel is closed once Results is, or once
+// ctx is done.
+func (p *Pool[T, R]) Values(ctx context.Context) <-chan result.Result[R] {
+	out := make(chan result.Result[R])
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case res, ok := <-p.results:
+				if !ok {
+					return
+				}
+				select {
+				case out <- res.Result():
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Shutdown stops accepting tasks and waits for the queued ones to finish.
+// If ctx is done first, the context passed to the handlers is cancelled and
+// Shutdown returns the context error; the workers still report a result
+// for every queued task before exiting.
+func (p *Pool[T, R]) Shutdown(ctx context.Context) error {
+	p.shutdownOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		close(p.quit)
+		p.mu.Unlock()
+
+		// No Submit can send once the in-flight ones have returned
+		p.submitting.Wait()
+		close(p.tasks)
+	})
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+// spawn starts a worker. Caller must hold sizeMu.
+func (p *Pool[T, R]) spawn() {
+	p.workers++
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.work()
+	}()
+}
+
+// work processes tasks until the queue is closed and drained, or the
+// worker is surplus.
+func (p *Pool[T, R]) work() {
+	for {
+		resized, retire := p.checkSize()
+		if retire {
+			return
+		}
+
+		select {
+		case q, ok := <-p.tasks:
+			if !ok {
+				p.sizeMu.Lock()
+				p.workers--
+				p.sizeMu.Unlock()
+				return
+			}
+			p.results <- p.run(q)
+		case <-resized:
+		}
+	}
+}
+
+// checkSize reports whether the worker is surplus, in which case it is no
+// longer counted, and otherwise returns the channel closed on the next
+// resize.
+func (p *Pool[T, R]) checkSize() (<-chan struct{}, bool) {
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
+
+	if p.workers > p.target {
+		p.workers--
+		return nil, true
+	}
+	return p.resized, false
+}
+
+// run processes a single task, turning a panic into a *PanicError.
+func (p *Pool[T, R]) run(q queued[T]) (res Result[T, R]) {
+	task := q.task
+	res.Task = task
+
+	start := time.Now()
+	if a := p.scaler.Load(); a != nil {
+		defer func() {
+			a.record(start.Sub(q.at), time.Since(start))
+		}()
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			res.Err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	// Tasks left over after Shutdown gave up are not started
+	if err := p.ctx.Err(); err != nil {
+		res.Err = err
+		return res
+	}
+
+	res.Value, res.Err = p.handle(p.ctx, task)
+	return res
+}
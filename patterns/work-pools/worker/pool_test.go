@@ -0,0 +1,241 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alan-333333/go-channel-patterns/patterns/result"
+)
+
+func double(_ context.Context, n int) (int, error) {
+	return n * 2, nil
+}
+
+func TestPool(t *testing.T) {
+	p := New(4, 10, double)
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			if err := p.Submit(context.Background(), i); err != nil {
+				t.Errorf("Submit(%d) = %v", i, err)
+			}
+		}
+		p.Shutdown(context.Background())
+	}()
+
+	var got []int
+	for res := range p.Results() {
+		if res.Err != nil {
+			t.Errorf("task %d: %v", res.Task, res.Err)
+		}
+		if res.Value != res.Task*2 {
+			t.Errorf("task %d: value = %d, want %d", res.Task, res.Value, res.Task*2)
+		}
+		got = append(got, res.Task)
+	}
+
+	sort.Ints(got)
+	if len(got) != 100 || got[0] != 0 || got[99] != 99 {
+		t.Errorf("got %d results, want tasks 0-99", len(got))
+	}
+}
+
+func TestShutdownDrains(t *testing.T) {
+	var done int32
+	p := New(1, 10, func(_ context.Context, n int) (int, error) {
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&done, 1)
+		return n, nil
+	})
+
+	for i := 0; i < 5; i++ {
+		p.Submit(context.Background(), i)
+	}
+
+	// Shutdown waits for the queued tasks
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if atomic.LoadInt32(&done) != 5 {
+		t.Errorf("done = %d, want 5", done)
+	}
+
+	var n int
+	for range p.Results() {
+		n++
+	}
+	if n != 5 {
+		t.Errorf("results = %d, want 5", n)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	p := New(1, 10, func(ctx context.Context, n int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	p.Submit(context.Background(), 1)
+	p.Submit(context.Background(), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Both the running and the queued task report the cancellation
+	var n int
+	for res := range p.Results() {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("task %d: err = %v, want %v", res.Task, res.Err, context.Canceled)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("results = %d, want 2", n)
+	}
+}
+
+func TestSubmitAfterShutdown(t *testing.T) {
+	p := New(1, 1, double)
+	p.Shutdown(context.Background())
+
+	if err := p.Submit(context.Background(), 1); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit() = %v, want %v", err, ErrPoolClosed)
+	}
+
+	// Shutdown can be called again
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown() = %v", err)
+	}
+}
+
+func TestSubmitBlockedByShutdown(t *testing.T) {
+	block := make(chan struct{})
+	p := New(1, 0, func(_ context.Context, n int) (int, error) {
+		<-block
+		return n, nil
+	})
+
+	// The worker is busy and there is no queue, so this Submit blocks
+	p.Submit(context.Background(), 1)
+	errc := make(chan error)
+	go func() { errc <- p.Submit(context.Background(), 2) }()
+	time.Sleep(10 * time.Millisecond)
+
+	go p.Shutdown(context.Background())
+	if err := <-errc; !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("blocked Submit() = %v, want %v", err, ErrPoolClosed)
+	}
+
+	close(block)
+	for range p.Results() {
+	}
+}
+
+func TestSubmitCancel(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	p := New(1, 0, func(_ context.Context, n int) (int, error) {
+		<-block
+		return n, nil
+	})
+
+	p.Submit(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	p := New(1, 2, func(_ context.Context, n int) (int, error) {
+		if n == 0 {
+			panic("boom")
+		}
+		return n, nil
+	})
+
+	p.Submit(context.Background(), 0)
+	p.Submit(context.Background(), 1)
+	p.Shutdown(context.Background())
+
+	var results []Result[int, int]
+	for res := range p.Results() {
+		results = append(results, res)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %d, want 2", len(results))
+	}
+
+	// The worker survives the panic and processes the next task
+	var pe *PanicError
+	if !errors.As(results[0].Err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Errorf("task 0: err = %v, want a PanicError", results[0].Err)
+	}
+	if results[1].Err != nil || results[1].Value != 1 {
+		t.Errorf("task 1: %+v", results[1])
+	}
+}
+
+func benchmarkPool(b *testing.B, workers int) {
+	p := New(workers, 1024, double)
+
+	go func() {
+		for range p.Results() {
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Submit(context.Background(), i)
+	}
+	p.Shutdown(context.Background())
+}
+
+func BenchmarkPool1(b *testing.B)  { benchmarkPool(b, 1) }
+func BenchmarkPool4(b *testing.B)  { benchmarkPool(b, 4) }
+func BenchmarkPool16(b *testing.B) { benchmarkPool(b, 16) }
+
+func TestValues(t *testing.T) {
+	errOdd := errors.New("odd")
+	p := New(2, 10, func(_ context.Context, n int) (int, error) {
+		if n%2 == 1 {
+			return 0, errOdd
+		}
+		return n * 2, nil
+	})
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			p.Submit(context.Background(), i)
+		}
+		p.Shutdown(context.Background())
+	}()
+
+	values, errs := result.Split(context.Background(), p.Values(context.Background()))
+
+	sum := 0
+	for v := range values {
+		sum += v
+	}
+	n := 0
+	for err := range errs {
+		if !errors.Is(err, errOdd) {
+			t.Errorf("error = %v, want %v", err, errOdd)
+		}
+		n++
+	}
+
+	if sum != 40 || n != 5 {
+		t.Errorf("sum = %d with %d errors, want 40 with 5", sum, n)
+	}
+}